@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,9 +37,29 @@ func main() {
 	powerModelPath := flag.String("power-model", "model/grid_power.json", "path to grid power NN model")
 	sigma := flag.Float64("sigma", 2.0, "standard deviation threshold for flagging anomalies")
 	minKWh := flag.Float64("min-kwh", 1.0, "minimum daily kWh to consider a day")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them at load")
+	roundTo := flag.Duration("round-timestamps", 0, "round reading timestamps to this grid at load (e.g. 1m), keeping the last value per sensor and slot in file order (0 = off)")
+	causeRulesPath := flag.String("cause-rules", "", "JSON file of {condition, message} cause rules tried before the built-in ones")
 	flag.Parse()
 
-	dataStore := loadAllData(*inputDir)
+	causes, err := compileCauseRules(defaultCauseRules)
+	if err != nil {
+		log.Fatalf("Built-in cause rules: %v", err)
+	}
+	if *causeRulesPath != "" {
+		custom, err := loadCauseRules(*causeRulesPath)
+		if err != nil {
+			log.Fatalf("Loading cause rules: %v", err)
+		}
+		causes = append(custom, causes...)
+	}
+
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+
+	dataStore := loadAllData(*inputDir, rules, *roundTo)
 
 	tr, ok := dataStore.GlobalTimeRange()
 	if !ok {
@@ -63,13 +85,10 @@ func main() {
 		log.Fatalf("Parsing power model: %v", err)
 	}
 
-	gridPowerID := findSensorID(dataStore, model.SensorGridPower)
-	if gridPowerID == "" {
+	if findSensorID(dataStore, model.SensorGridPower) == "" {
 		log.Fatal("No grid power sensor found")
 	}
 
-	extTempID := findSensorID(dataStore, model.SensorPumpExtTemp)
-
 	days := tr.End.Sub(tr.Start).Hours() / 24
 
 	fmt.Println()
@@ -79,7 +98,7 @@ func main() {
 	fmt.Println()
 
 	// Compute daily actual vs predicted
-	allDays := computeDailyStats(dataStore, gridPowerID, extTempID, tempPred, powerPred, tr, *minKWh)
+	allDays := computeDailyStats(dataStore, tempPred, powerPred, tr, *minKWh)
 
 	if len(allDays) == 0 {
 		fmt.Println("No days with sufficient data found.")
@@ -110,7 +129,7 @@ func main() {
 			} else {
 				d.Category = "LOW"
 			}
-			d.Cause = inferCause(d)
+			d.Cause = inferCause(d, causes)
 			flagged = append(flagged, *d)
 		}
 	}
@@ -146,13 +165,13 @@ func main() {
 
 func computeDailyStats(
 	s *store.Store,
-	gridPowerID, extTempID string,
 	tempPred *predictor.TemperaturePredictor,
 	powerPred *predictor.EnergyPredictor,
 	tr model.TimeRange,
 	minKWh float64,
 ) []dayStats {
-	readings := s.ReadingsInRange(gridPowerID, tr.Start, tr.End.Add(time.Nanosecond))
+	span := model.TimeRange{Start: tr.Start, End: tr.End.Add(time.Nanosecond)}
+	readings := s.SeriesByType(model.SensorGridPower, span)
 	if len(readings) < 2 {
 		return nil
 	}
@@ -187,18 +206,15 @@ func computeDailyStats(
 	}
 
 	// Gather actual temperatures by day
-	if extTempID != "" {
-		tempReadings := s.ReadingsInRange(extTempID, tr.Start, tr.End.Add(time.Nanosecond))
-		for _, r := range tempReadings {
-			dayKey := r.Timestamp.Format("2006-01-02")
-			acc, exists := dayMap[dayKey]
-			if !exists {
-				acc = &dayAccum{}
-				dayMap[dayKey] = acc
-			}
-			acc.tempSum += r.Value
-			acc.tempCount++
+	for _, r := range s.SeriesByType(model.SensorPumpExtTemp, span) {
+		dayKey := r.Timestamp.Format("2006-01-02")
+		acc, exists := dayMap[dayKey]
+		if !exists {
+			acc = &dayAccum{}
+			dayMap[dayKey] = acc
 		}
+		acc.tempSum += r.Value
+		acc.tempCount++
 	}
 
 	// Sort days
@@ -258,32 +274,155 @@ func computeDailyStats(
 	return result
 }
 
-func inferCause(d *dayStats) string {
-	if d.Category == "HIGH" {
-		if d.TempDevC < -3 {
-			return "Unexpected cold → extra heating"
+// causeRule names a likely cause for an anomalous day. Condition is a list of
+// comparisons joined by "&&", each "field op value" with op one of
+// < <= > >= == !=. Fields: category (HIGH or LOW, == and != only),
+// deviation_pct, temp_dev_c, actual_kwh, predicted_kwh, actual_temp_c.
+// An empty condition matches every day.
+type causeRule struct {
+	Condition string `json:"condition"`
+	Message   string `json:"message"`
+}
+
+// defaultCauseRules are the built-in heuristics, tried in order.
+var defaultCauseRules = []causeRule{
+	{"category == HIGH && temp_dev_c < -3", "Unexpected cold → extra heating"},
+	{"category == HIGH && deviation_pct > 100", "Very high usage — guests or appliance fault?"},
+	{"category == HIGH", "Above-normal consumption"},
+	{"category == LOW && temp_dev_c > 3", "Warmer than expected → less heating"},
+	{"category == LOW && deviation_pct < -50", "Very low usage — away from home?"},
+	{"category == LOW", "Below-normal consumption"},
+}
+
+// causeClause is one parsed comparison of a rule condition.
+type causeClause struct {
+	field, op string
+	num       float64
+	str       string
+}
+
+type compiledCause struct {
+	clauses []causeClause
+	message string
+}
+
+// dayFields maps the numeric condition fields to their day values.
+var dayFields = map[string]func(d *dayStats) float64{
+	"deviation_pct": func(d *dayStats) float64 { return d.DeviationPct },
+	"temp_dev_c":    func(d *dayStats) float64 { return d.TempDevC },
+	"actual_kwh":    func(d *dayStats) float64 { return d.ActualKWh },
+	"predicted_kwh": func(d *dayStats) float64 { return d.PredictedKWh },
+	"actual_temp_c": func(d *dayStats) float64 { return d.ActualTemp },
+}
+
+// loadCauseRules reads a JSON array of cause rules from path.
+func loadCauseRules(path string) ([]compiledCause, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []causeRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return compileCauseRules(rules)
+}
+
+func compileCauseRules(rules []causeRule) ([]compiledCause, error) {
+	out := make([]compiledCause, 0, len(rules))
+	for _, r := range rules {
+		if r.Message == "" {
+			return nil, fmt.Errorf("rule %q: empty message", r.Condition)
 		}
-		if d.DeviationPct > 100 {
-			return "Very high usage — guests or appliance fault?"
+		c := compiledCause{message: r.Message}
+		if strings.TrimSpace(r.Condition) != "" {
+			for _, part := range strings.Split(r.Condition, "&&") {
+				clause, err := parseCauseClause(part)
+				if err != nil {
+					return nil, fmt.Errorf("rule %q: %w", r.Condition, err)
+				}
+				c.clauses = append(c.clauses, clause)
+			}
 		}
-		return "Above-normal consumption"
+		out = append(out, c)
 	}
-	// LOW
-	if d.TempDevC > 3 {
-		return "Warmer than expected → less heating"
+	return out, nil
+}
+
+func parseCauseClause(s string) (causeClause, error) {
+	f := strings.Fields(s)
+	if len(f) != 3 {
+		return causeClause{}, fmt.Errorf("clause %q: want \"field op value\"", strings.TrimSpace(s))
 	}
-	if d.DeviationPct < -50 {
-		return "Very low usage — away from home?"
+	c := causeClause{field: f[0], op: f[1]}
+	switch c.op {
+	case "<", "<=", ">", ">=", "==", "!=":
+	default:
+		return causeClause{}, fmt.Errorf("clause %q: unknown operator %q", strings.TrimSpace(s), c.op)
 	}
-	return "Below-normal consumption"
+	if c.field == "category" {
+		if c.op != "==" && c.op != "!=" {
+			return causeClause{}, fmt.Errorf("clause %q: category supports == and != only", strings.TrimSpace(s))
+		}
+		c.str = strings.ToUpper(f[2])
+		return c, nil
+	}
+	if _, ok := dayFields[c.field]; !ok {
+		return causeClause{}, fmt.Errorf("clause %q: unknown field %q", strings.TrimSpace(s), c.field)
+	}
+	v, err := strconv.ParseFloat(f[2], 64)
+	if err != nil {
+		return causeClause{}, fmt.Errorf("clause %q: %w", strings.TrimSpace(s), err)
+	}
+	c.num = v
+	return c, nil
+}
+
+func (c causeClause) matches(d *dayStats) bool {
+	if c.field == "category" {
+		return (d.Category == c.str) == (c.op == "==")
+	}
+	v := dayFields[c.field](d)
+	switch c.op {
+	case "<":
+		return v < c.num
+	case "<=":
+		return v <= c.num
+	case ">":
+		return v > c.num
+	case ">=":
+		return v >= c.num
+	case "==":
+		return v == c.num
+	default:
+		return v != c.num
+	}
+}
+
+// inferCause returns the message of the first rule whose clauses all match
+// d, or "" when none does.
+func inferCause(d *dayStats, rules []compiledCause) string {
+	for _, r := range rules {
+		ok := true
+		for _, c := range r.clauses {
+			if !c.matches(d) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return r.message
+		}
+	}
+	return ""
 }
 
 // --- Data loading (shared with load-analysis) ---
 
-func loadAllData(inputDir string) *store.Store {
+func loadAllData(inputDir string, rules ingest.SanitizeRules, roundTo time.Duration) *store.Store {
 	dataStore := store.New()
 
-	loadLegacyCSVs(inputDir, dataStore)
+	loadLegacyCSVs(inputDir, dataStore, rules, roundTo)
 
 	recentDir := filepath.Join(inputDir, "recent")
 	if entries, err := os.ReadDir(recentDir); err == nil {
@@ -304,6 +443,10 @@ func loadAllData(inputDir string) *store.Store {
 				log.Printf("Warning: parsing %s: %v", path, err)
 				continue
 			}
+			readings, report := ingest.Prepare(readings, rules, roundTo)
+			if report.Total() > 0 {
+				log.Printf("Cleaned %s: %s", path, report)
+			}
 			if len(readings) > 0 {
 				registerSensors(readings, dataStore)
 				dataStore.AddReadings(readings)
@@ -330,6 +473,10 @@ func loadAllData(inputDir string) *store.Store {
 				log.Printf("Warning: parsing %s: %v", path, err)
 				continue
 			}
+			readings, report := ingest.Prepare(readings, rules, roundTo)
+			if report.Total() > 0 {
+				log.Printf("Cleaned %s: %s", path, report)
+			}
 			if len(readings) > 0 {
 				registerSensors(readings, dataStore)
 				dataStore.AddReadings(readings)
@@ -340,7 +487,7 @@ func loadAllData(inputDir string) *store.Store {
 	return dataStore
 }
 
-func loadLegacyCSVs(dir string, s *store.Store) {
+func loadLegacyCSVs(dir string, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		log.Fatalf("Reading input directory %s: %v", dir, err)
@@ -363,6 +510,10 @@ func loadLegacyCSVs(dir string, s *store.Store) {
 		if err != nil {
 			log.Fatalf("Parsing %s: %v", path, err)
 		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("Cleaned %s: %s", path, report)
+		}
 
 		if len(readings) > 0 {
 			name := string(sensorType)
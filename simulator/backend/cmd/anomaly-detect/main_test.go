@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferCause_Defaults(t *testing.T) {
+	rules, err := compileCauseRules(defaultCauseRules)
+	require.NoError(t, err)
+
+	tests := []struct {
+		day  dayStats
+		want string
+	}{
+		{dayStats{Category: "HIGH", TempDevC: -5, DeviationPct: 150}, "Unexpected cold → extra heating"},
+		{dayStats{Category: "HIGH", TempDevC: 0, DeviationPct: 150}, "Very high usage — guests or appliance fault?"},
+		{dayStats{Category: "HIGH", TempDevC: 0, DeviationPct: 40}, "Above-normal consumption"},
+		{dayStats{Category: "LOW", TempDevC: 4, DeviationPct: -60}, "Warmer than expected → less heating"},
+		{dayStats{Category: "LOW", TempDevC: 0, DeviationPct: -60}, "Very low usage — away from home?"},
+		{dayStats{Category: "LOW", TempDevC: 0, DeviationPct: -20}, "Below-normal consumption"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, inferCause(&tt.day, rules))
+	}
+}
+
+func TestInferCause_CustomRule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "causes.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"condition": "category == HIGH && actual_kwh >= 30 && temp_dev_c > -3", "message": "EV charging"}
+	]`), 0o644))
+
+	custom, err := loadCauseRules(path)
+	require.NoError(t, err)
+	defaults, err := compileCauseRules(defaultCauseRules)
+	require.NoError(t, err)
+	rules := append(custom, defaults...)
+
+	ev := dayStats{Category: "HIGH", ActualKWh: 42, PredictedKWh: 18, DeviationPct: 133, TempDevC: 1}
+	assert.Equal(t, "EV charging", inferCause(&ev, rules))
+
+	// A cold day still falls through to the built-in heating cause.
+	cold := dayStats{Category: "HIGH", ActualKWh: 42, PredictedKWh: 18, DeviationPct: 133, TempDevC: -6}
+	assert.Equal(t, "Unexpected cold → extra heating", inferCause(&cold, rules))
+}
+
+func TestCompileCauseRules_Invalid(t *testing.T) {
+	for _, cond := range []string{
+		"actual_kwh > ",
+		"voltage > 3",
+		"actual_kwh ~ 3",
+		"actual_kwh > many",
+		"category < HIGH",
+	} {
+		_, err := compileCauseRules([]causeRule{{Condition: cond, Message: "x"}})
+		assert.Error(t, err, cond)
+	}
+	_, err := compileCauseRules([]causeRule{{Condition: "category == HIGH"}})
+	assert.Error(t, err, "empty message")
+
+	rules, err := compileCauseRules([]causeRule{{Message: "anything"}})
+	require.NoError(t, err)
+	assert.Equal(t, "anything", inferCause(&dayStats{Category: "LOW"}, rules))
+}
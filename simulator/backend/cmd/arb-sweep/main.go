@@ -0,0 +1,289 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"energy_simulator/internal/ingest"
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/numfmt"
+	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/store"
+)
+
+// collector implements simulator.Callback, keeping only the latest summary.
+type collector struct {
+	summary simulator.Summary
+}
+
+func (c *collector) OnState(simulator.State)                               {}
+func (c *collector) OnReading(simulator.SensorReading)                     {}
+func (c *collector) OnSummary(s simulator.Summary)                         { c.summary = s }
+func (c *collector) OnBatteryUpdate(simulator.BatteryUpdate)               {}
+func (c *collector) OnBatterySummary(simulator.BatterySummary)             {}
+func (c *collector) OnArbitrageDayLog([]simulator.ArbitrageDayRecord)      {}
+func (c *collector) OnPredictionComparison(simulator.PredictionComparison) {}
+func (c *collector) OnHeatingStats([]simulator.HeatingMonthStat)           {}
+func (c *collector) OnMonthlyCosts([]simulator.MonthlyCost)                {}
+func (c *collector) OnAnomalyDays([]simulator.AnomalyDayRecord)            {}
+func (c *collector) OnLoadShiftStats(simulator.LoadShiftStats)             {}
+func (c *collector) OnHPDiagnostics(simulator.HPDiagnostics)               {}
+func (c *collector) OnPowerQuality(simulator.PowerQuality)                 {}
+func (c *collector) OnApplianceCosts([]simulator.ApplianceCost)            {}
+func (c *collector) OnStrategyComparison(simulator.StrategyComparison)     {}
+func (c *collector) OnConfigComparison(simulator.ConfigComparison)         {}
+func (c *collector) OnDailySummary(simulator.PeriodSummary)                {}
+func (c *collector) OnMonthlySummary(simulator.PeriodSummary)              {}
+func (c *collector) OnEvent(simulator.Event)                               {}
+func (c *collector) OnFlowSankey(simulator.FlowSankey)                     {}
+
+// band is a pair of daily price percentiles: the arbitrage battery charges at
+// or below low and discharges at or above high.
+type band struct {
+	low, high int
+}
+
+func (b band) String() string { return fmt.Sprintf("P%d/P%d", b.low, b.high) }
+
+// bandResult is one point of the wear vs savings curve.
+type bandResult struct {
+	band
+	cycles   float64
+	grossPLN float64 // no-battery cost − arbitrage cost
+	wearPLN  float64 // cycles × cycle cost
+}
+
+func (r bandResult) netPLN() float64 { return r.grossPLN - r.wearPLN }
+
+// sweepParams holds the battery settings shared by every band.
+type sweepParams struct {
+	capacity, cRate, cycleCost float64
+	step                       time.Duration
+}
+
+func main() {
+	inputDir := flag.String("input-dir", "input", "directory containing CSV data files")
+	capacity := flag.Float64("capacity", 10, "battery capacity in kWh")
+	cRate := flag.Float64("max-power-rate", 0.5, "C-rate for max charge/discharge power")
+	cycleCost := flag.Float64("cycle-cost", 3, "battery wear cost per full cycle, in -currency")
+	stepFlag := flag.String("step", "6h", "simulation step size (e.g. 1h, 6h, 24h)")
+	bandsFlag := flag.String("bands", "45/55,40/60,35/65,30/70,25/75,20/80,15/85,10/90,5/95", "comma-separated low/high price percentile bands, tight to wide")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them at load")
+	currency := flag.String("currency", numfmt.DefaultCurrency, "currency label for costs and savings")
+	locale := flag.String("locale", "plain", "number format: plain, en, pl, de, fr, ch (thousands/decimal separators)")
+	flag.Parse()
+
+	nf, err := numfmt.New(*currency, *locale)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stepDuration, err := time.ParseDuration(*stepFlag)
+	if err != nil {
+		log.Fatalf("Invalid step duration %q: %v", *stepFlag, err)
+	}
+	bands, err := parseBands(*bandsFlag)
+	if err != nil {
+		log.Fatalf("Invalid bands: %v", err)
+	}
+
+	p := sweepParams{capacity: *capacity, cRate: *cRate, cycleCost: *cycleCost, step: stepDuration}
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+
+	load := func() *store.Store { return loadCSVs(*inputDir, rules) }
+	results, err := sweep(load, bands, p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printTable(nf, results, p)
+}
+
+// sweep simulates the arbitrage battery once per band.
+func sweep(load func() *store.Store, bands []band, p sweepParams) ([]bandResult, error) {
+	results := make([]bandResult, 0, len(bands))
+	for _, b := range bands {
+		r, err := simulateBand(load, b, p)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+		fmt.Fprintf(os.Stderr, "  %s done\n", b)
+	}
+	return results, nil
+}
+
+// simulateBand replays a fresh store from load with the arbitrage thresholds
+// at band b and returns the shadow arbitrage battery's cycles and savings.
+func simulateBand(load func() *store.Store, b band, p sweepParams) (bandResult, error) {
+	dataStore := load()
+	cb := &collector{}
+	engine := simulator.New(dataStore, cb)
+	if !engine.Init() {
+		return bandResult{}, fmt.Errorf("failed to initialize simulation engine (no data?)")
+	}
+	priceSensor := ""
+	for _, sensor := range dataStore.Sensors() {
+		if sensor.Type == model.SensorEnergyPrice {
+			priceSensor = sensor.ID
+			break
+		}
+	}
+	if priceSensor == "" {
+		return bandResult{}, fmt.Errorf("no %s sensor: arbitrage needs prices", model.SensorEnergyPrice)
+	}
+	engine.SetPriceSensor(priceSensor)
+	engine.SetArbitragePercentiles(b.low, b.high)
+	engine.SetBattery(&simulator.BatteryConfig{
+		CapacityKWh:     p.capacity,
+		MaxPowerW:       p.capacity * p.cRate * 1000,
+		ChargeToPercent: 100,
+		CycleCostPLN:    p.cycleCost,
+	})
+	tr := engine.TimeRange()
+	for engine.State().Time.Before(tr.End) {
+		engine.Step(p.step)
+	}
+	cycles := engine.ArbitrageCycles()
+	return bandResult{
+		band:     b,
+		cycles:   cycles,
+		grossPLN: cb.summary.RawNetCostPLN - cb.summary.ArbNetCostPLN,
+		wearPLN:  cycles * p.cycleCost,
+	}, nil
+}
+
+// best returns the index of the band with the highest net savings, the
+// tighter one on ties. Returns -1 for no results.
+func best(results []bandResult) int {
+	idx := -1
+	for i, r := range results {
+		if idx < 0 || r.netPLN() > results[idx].netPLN() {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func printTable(nf numfmt.Formatter, results []bandResult, p sweepParams) {
+	if len(results) == 0 {
+		return
+	}
+	peak := best(results)
+
+	fmt.Println()
+	fmt.Println("Arbitrage Band Sweep")
+	fmt.Printf("  Battery: %.1f kWh, C-rate: %.1f, wear cost: %s/cycle\n", p.capacity, p.cRate, nf.Money(p.cycleCost))
+	fmt.Println()
+
+	fmt.Printf(" %9s │ %7s │ %10s │ %10s │ %10s\n", "Band", "Cycles", "Gross "+nf.Currency, "Wear "+nf.Currency, "Net "+nf.Currency)
+	fmt.Printf("───────────┼─────────┼────────────┼────────────┼────────────\n")
+	for i, r := range results {
+		mark := ""
+		if i == peak {
+			mark = "  ← best"
+		}
+		fmt.Printf(" %9s │ %7.1f │ %10s │ %10s │ %10s%s\n",
+			r.band, r.cycles, nf.Number(r.grossPLN, 2), nf.Number(r.wearPLN, 2), nf.Number(r.netPLN(), 2), mark)
+	}
+	fmt.Println()
+	fmt.Printf("Best band: %s (net %s)\n", results[peak].band, nf.Money(results[peak].netPLN()))
+	fmt.Println()
+}
+
+// parseBands parses "low/high" percentile pairs separated by commas.
+func parseBands(s string) ([]band, error) {
+	parts := strings.Split(s, ",")
+	bands := make([]band, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		lo, hi, ok := strings.Cut(p, "/")
+		if !ok {
+			return nil, fmt.Errorf("parsing %q: want low/high", p)
+		}
+		low, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", p, err)
+		}
+		high, err := strconv.Atoi(strings.TrimSpace(hi))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", p, err)
+		}
+		if low < 0 || high > 100 || low >= high {
+			return nil, fmt.Errorf("band %q: want 0 ≤ low < high ≤ 100", p)
+		}
+		bands = append(bands, band{low: low, high: high})
+	}
+	if len(bands) == 0 {
+		return nil, fmt.Errorf("no bands specified")
+	}
+	return bands, nil
+}
+
+func loadCSVs(dir string, rules ingest.SanitizeRules) *store.Store {
+	dataStore := store.New()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Fatalf("Reading input directory %s: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".csv") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Opening %s: %v", path, err)
+		}
+
+		sensorType, unit := sensorTypeFromFilename(entry.Name())
+		parser := ingest.NewHomeAssistantParser(sensorType, unit)
+		readings, err := parser.Parse(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Parsing %s: %v", path, err)
+		}
+		readings, report := ingest.Sanitize(readings, rules)
+		if report.Total() > 0 {
+			log.Printf("Sanitized %s: %s", path, report)
+		}
+
+		if len(readings) > 0 {
+			name := string(sensorType)
+			if info, ok := model.SensorCatalog[sensorType]; ok {
+				name = info.Name
+			}
+			dataStore.AddSensor(model.Sensor{
+				ID:   readings[0].SensorID,
+				Name: name,
+				Type: sensorType,
+				Unit: unit,
+			})
+			dataStore.AddReadings(readings)
+		}
+	}
+	// Three-phase meters without a total: sum the phases into grid_power.
+	simulator.SumGridPhases(dataStore)
+	return dataStore
+}
+
+func sensorTypeFromFilename(name string) (model.SensorType, string) {
+	base := strings.TrimSuffix(name, ".csv")
+	st := model.SensorType(base)
+	if info, ok := model.SensorCatalog[st]; ok {
+		return st, info.Unit
+	}
+	return st, ""
+}
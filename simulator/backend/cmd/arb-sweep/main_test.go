@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// rampStore holds 14 days of hourly data: a steady 3 kW import and a price
+// that climbs 0.05 PLN/kWh every hour from 0.20 at midnight. A 10 kWh battery
+// at 2.5 kW needs four hours to fill, so bands wider than four cheap hours
+// leave it partly empty while tighter ones discharge at a smaller spread.
+func rampStore() *store.Store {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for i := 0; i <= 14*24; i++ {
+		ts := base.Add(time.Duration(i) * time.Hour)
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 3000},
+			model.Reading{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: 0.2 + 0.05*float64(ts.Hour())},
+		)
+	}
+	s.AddReadings(readings)
+	return s
+}
+
+func TestSweep_ReportsNetSavingsPeak(t *testing.T) {
+	bands, err := parseBands("45/55,40/60,35/65,30/70,25/75,20/80,15/85,10/90,5/95")
+	require.NoError(t, err)
+	p := sweepParams{capacity: 10, cRate: 0.25, cycleCost: 3, step: time.Hour}
+	results, err := sweep(rampStore, bands, p)
+	require.NoError(t, err)
+	require.Len(t, results, len(bands))
+
+	peak := best(results)
+	require.Equal(t, band{15, 85}, results[peak].band)
+
+	// Net savings rise to the peak and fall after it, and the peak lies
+	// strictly inside the sweep.
+	require.Greater(t, peak, 0)
+	require.Less(t, peak, len(results)-1)
+	for i := 1; i <= peak; i++ {
+		assert.Greater(t, results[i].netPLN(), results[i-1].netPLN(), "%s", results[i].band)
+	}
+	for i := peak + 1; i < len(results); i++ {
+		assert.Less(t, results[i].netPLN(), results[i-1].netPLN(), "%s", results[i].band)
+	}
+
+	// Widening the band never cycles more, and wear is priced per cycle.
+	for i, r := range results {
+		assert.InDelta(t, r.cycles*p.cycleCost, r.wearPLN, 1e-9)
+		if i > 0 {
+			assert.LessOrEqual(t, r.cycles, results[i-1].cycles, "%s", r.band)
+		}
+	}
+	assert.Greater(t, results[0].cycles, results[len(results)-1].cycles)
+}
+
+func TestParseBands(t *testing.T) {
+	bands, err := parseBands("40/60, 10/90")
+	require.NoError(t, err)
+	assert.Equal(t, []band{{40, 60}, {10, 90}}, bands)
+
+	for _, bad := range []string{"", "40-60", "60/40", "0/101", "a/90"} {
+		_, err := parseBands(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,6 +14,7 @@ import (
 
 	"energy_simulator/internal/ingest"
 	"energy_simulator/internal/model"
+	"energy_simulator/internal/numfmt"
 	"energy_simulator/internal/simulator"
 	"energy_simulator/internal/store"
 )
@@ -31,18 +33,36 @@ func (c *collector) OnBatterySummary(s simulator.BatterySummary)     { c.battery
 func (c *collector) OnArbitrageDayLog([]simulator.ArbitrageDayRecord)       {}
 func (c *collector) OnPredictionComparison(simulator.PredictionComparison) {}
 func (c *collector) OnHeatingStats([]simulator.HeatingMonthStat)           {}
+func (c *collector) OnMonthlyCosts([]simulator.MonthlyCost)                {}
 func (c *collector) OnAnomalyDays([]simulator.AnomalyDayRecord)            {}
 func (c *collector) OnLoadShiftStats(simulator.LoadShiftStats)             {}
 func (c *collector) OnHPDiagnostics(simulator.HPDiagnostics)               {}
 func (c *collector) OnPowerQuality(simulator.PowerQuality)                 {}
+func (c *collector) OnApplianceCosts([]simulator.ApplianceCost)           {}
+func (c *collector) OnStrategyComparison(simulator.StrategyComparison)     {}
+func (c *collector) OnConfigComparison(simulator.ConfigComparison)         {}
+func (c *collector) OnDailySummary(simulator.PeriodSummary)                {}
+func (c *collector) OnMonthlySummary(simulator.PeriodSummary)              {}
+func (c *collector) OnEvent(simulator.Event)                               {}
+func (c *collector) OnFlowSankey(simulator.FlowSankey)                     {}
 
 type result struct {
 	capacity float64
 	maxPower float64
+	days     float64 // length of the simulated data
 	summary  simulator.Summary
 	battery  simulator.BatterySummary
 }
 
+// simParams holds the battery settings shared by every simulated capacity.
+type simParams struct {
+	cRate, floor, ceiling, efficiency float64
+	step                              time.Duration
+	checkBalance                      bool // fail on energy accumulator drift
+	mustRunW                          float64
+	spotPrices                        bool // price energy at the spot sensor (-recommend npv)
+}
+
 func main() {
 	inputDir := flag.String("input-dir", "input", "directory containing CSV data files")
 	cRate := flag.Float64("max-power-rate", 0.5, "C-rate for max charge/discharge power")
@@ -52,66 +72,267 @@ func main() {
 	capsFlag := flag.String("capacities", "5,7.5,10,12.5,15,20,25,30,40,50", "comma-separated battery capacities in kWh")
 	hpPct := flag.Float64("heat-pump-pct", 100, "heat pump usage percentage for off-grid coverage (0-100)")
 	appPct := flag.Float64("appliance-pct", 100, "appliance usage percentage for off-grid coverage (0-100)")
+	baseLoadW := flag.Float64("base-load-w", 0, "always-on base load (fridge, router) in W, split out of appliances for off-grid coverage")
+	baseLoadPct := flag.Float64("base-load-pct", 100, "base load usage percentage for off-grid coverage (0-100)")
+	mustRunW := flag.Float64("must-run-w", 0, "constant must-run load in W added to the measured demand (negative removes load); simulated through the battery and always counted in full for off-grid coverage")
+	efficiency := flag.Float64("efficiency", 100, "battery round-trip efficiency percentage; derates the battery's off-grid contribution")
+	goal := flag.String("recommend", "", "search capacities and recommend one: npv (maximize NPV) or offgrid (least cost reaching -offgrid-target); overrides -capacities")
+	searchMax := flag.Float64("search-max", 50, "largest capacity in kWh searched by -recommend")
+	searchStep := flag.Float64("search-step", 2.5, "capacity step in kWh searched by -recommend")
+	costPerKWh := flag.Float64("cost-per-kwh", 1500, "battery price per kWh of capacity in -currency, for -recommend")
+	years := flag.Int("years", 10, "evaluation horizon in years for NPV")
+	discount := flag.Float64("discount-rate", 5, "annual discount rate percentage for NPV")
+	offGridTarget := flag.Float64("offgrid-target", 80, "off-grid coverage percentage to reach with -recommend offgrid")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them at load")
+	checkBalance := flag.Bool("check-balance", false, "cross-check the engine's energy accumulators after each run and fail on drift (debugging)")
+	currency := flag.String("currency", numfmt.DefaultCurrency, "currency label for prices and savings")
+	locale := flag.String("locale", "plain", "number format: plain, en, pl, de, fr, ch (thousands/decimal separators)")
 	flag.Parse()
 
+	nf, err := numfmt.New(*currency, *locale)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	stepDuration, err := time.ParseDuration(*stepFlag)
 	if err != nil {
 		log.Fatalf("Invalid step duration %q: %v", *stepFlag, err)
 	}
 
-	capacities, err := parseCapacities(*capsFlag)
+	var capacities []float64
+	if *goal != "" {
+		if *goal != goalNPV && *goal != goalOffGrid {
+			log.Fatalf("Invalid -recommend %q: want %s or %s", *goal, goalNPV, goalOffGrid)
+		}
+		capacities, err = searchCapacities(*searchStep, *searchMax)
+	} else {
+		capacities, err = parseCapacities(*capsFlag)
+	}
 	if err != nil {
-		log.Fatalf("Invalid capacities %q: %v", *capsFlag, err)
+		log.Fatalf("Invalid capacities: %v", err)
 	}
 	sort.Float64s(capacities)
 
+	p := simParams{cRate: *cRate, floor: *floor, ceiling: *ceiling, efficiency: *efficiency, step: stepDuration, checkBalance: *checkBalance, mustRunW: *mustRunW, spotPrices: *goal == goalNPV}
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+	load := func() *store.Store { return loadCSVs(*inputDir, rules) }
 	results := make([]result, 0, len(capacities))
 	for _, cap := range capacities {
-		maxPower := cap * *cRate * 1000
-		dataStore := loadCSVs(*inputDir)
-		cb := &collector{}
-		engine := simulator.New(dataStore, cb)
-		if !engine.Init() {
-			log.Fatal("Failed to initialize simulation engine (no data?)")
-		}
-		engine.SetBattery(&simulator.BatteryConfig{
-			CapacityKWh:        cap,
-			MaxPowerW:          maxPower,
-			DischargeToPercent: *floor,
-			ChargeToPercent:    *ceiling,
-		})
-		tr := engine.TimeRange()
-		for engine.State().Time.Before(tr.End) {
-			engine.Step(stepDuration)
-		}
-		results = append(results, result{
-			capacity: cap,
-			maxPower: maxPower,
-			summary:  cb.summary,
-			battery:  cb.batterySummary,
-		})
+		r, err := simulate(load, cap, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		results = append(results, r)
 		fmt.Fprintf(os.Stderr, "  %.1f kWh done\n", cap)
 	}
 
-	printTable(results, *floor, *ceiling, *cRate, *hpPct, *appPct, *inputDir)
+	printTable(results, *floor, *ceiling, *cRate, *hpPct, *appPct, *baseLoadW, *baseLoadPct, *efficiency, load)
+
+	if *goal != "" {
+		ec := economics{costPerKWh: *costPerKWh, years: *years, discountRate: *discount / 100, nf: nf}
+		og := offGridParams{hpPct: *hpPct, appPct: *appPct, baseLoadW: *baseLoadW, baseLoadPct: *baseLoadPct, efficiency: *efficiency / 100}
+		rec, err := recommend(results, *goal, *offGridTarget, ec, og)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Recommendation")
+		fmt.Printf("  %.1f kWh — %s\n", rec.capacity, rec.reason)
+		fmt.Println()
+	}
+}
+
+// simulate replays a fresh store from load with a battery of the given
+// capacity and returns the final summaries.
+func simulate(load func() *store.Store, capacity float64, p simParams) (result, error) {
+	maxPower := capacity * p.cRate * 1000
+	dataStore := load()
+	cb := &collector{}
+	engine := simulator.New(dataStore, cb)
+	if !engine.Init() {
+		return result{}, fmt.Errorf("failed to initialize simulation engine (no data?)")
+	}
+	// The NPV is based on PLN savings, which need spot prices. Plain
+	// comparisons keep the table as it always was.
+	if p.spotPrices {
+		for _, sensor := range dataStore.Sensors() {
+			if sensor.Type == model.SensorEnergyPrice {
+				engine.SetPriceSensor(sensor.ID)
+				break
+			}
+		}
+	}
+	engine.SetBattery(&simulator.BatteryConfig{
+		CapacityKWh:            capacity,
+		MaxPowerW:              maxPower,
+		DischargeToPercent:     p.floor,
+		ChargeToPercent:        p.ceiling,
+		RoundTripEfficiencyPct: p.efficiency,
+	})
+	engine.SetMustRunLoad(p.mustRunW)
+	tr := engine.TimeRange()
+	for engine.State().Time.Before(tr.End) {
+		engine.Step(p.step)
+	}
+	if p.checkBalance {
+		if err := engine.CheckBalance(); err != nil {
+			return result{}, fmt.Errorf("%.1f kWh: energy balance: %w", capacity, err)
+		}
+	}
+	return result{
+		capacity: capacity,
+		maxPower: maxPower,
+		days:     tr.End.Sub(tr.Start).Hours() / 24,
+		summary:  cb.summary,
+		battery:  cb.batterySummary,
+	}, nil
+}
+
+// Recommendation goals for -recommend.
+const (
+	goalNPV     = "npv"
+	goalOffGrid = "offgrid"
+)
+
+// economics prices a battery and discounts its savings.
+type economics struct {
+	costPerKWh   float64 // per kWh of capacity, in nf's currency
+	years        int     // evaluation horizon
+	discountRate float64 // annual, as a fraction
+	nf           numfmt.Formatter
+}
+
+// investment is the up-front battery price.
+func (ec economics) investment(r result) float64 {
+	return r.capacity * ec.costPerKWh
+}
+
+// annualSavings extrapolates the simulated battery savings to a year.
+func (ec economics) annualSavings(r result) float64 {
+	if r.days <= 0 {
+		return 0
+	}
+	return r.summary.BatterySavingsPLN / r.days * 365
 }
 
-func printTable(results []result, floor, ceiling, cRate, hpPct, appPct float64, inputDir string) {
+// npv is the discounted annual savings over the horizon minus the investment.
+func (ec economics) npv(r result) float64 {
+	annual := ec.annualSavings(r)
+	v := -ec.investment(r)
+	for y := 1; y <= ec.years; y++ {
+		v += annual / math.Pow(1+ec.discountRate, float64(y))
+	}
+	return v
+}
+
+// offGridParams are the off-grid coverage settings of the table.
+type offGridParams struct {
+	hpPct, appPct, baseLoadW, baseLoadPct, efficiency float64
+}
+
+func (og offGridParams) coverage(r result) float64 {
+	baseLoadKWh := og.baseLoadW / 1000 * r.days * 24
+	return r.summary.OffGridCoverageWithEfficiency(og.hpPct, og.appPct, baseLoadKWh, og.baseLoadPct, og.efficiency)
+}
+
+// recommendation is the chosen capacity with a one-line justification.
+type recommendation struct {
+	result
+	npv     float64
+	offGrid float64
+	reason  string
+}
+
+// recommend picks a capacity from results (sorted by capacity). goalNPV
+// maximizes NPV; goalOffGrid picks the cheapest, i.e. smallest, capacity
+// reaching targetPct off-grid coverage.
+func recommend(results []result, goal string, targetPct float64, ec economics, og offGridParams) (recommendation, error) {
+	if len(results) == 0 {
+		return recommendation{}, fmt.Errorf("no capacities simulated")
+	}
+	switch goal {
+	case goalNPV:
+		best := 0
+		for i, r := range results {
+			if ec.npv(r) > ec.npv(results[best]) {
+				best = i
+			}
+		}
+		r := results[best]
+		rec := recommendation{result: r, npv: ec.npv(r), offGrid: og.coverage(r)}
+		rec.reason = fmt.Sprintf("highest %d-year NPV %s (investment %s, savings %s/year)",
+			ec.years, ec.nf.Money(rec.npv), ec.nf.Money(ec.investment(r)), ec.nf.Money(ec.annualSavings(r)))
+		if best+1 < len(results) {
+			next := results[best+1]
+			rec.reason += fmt.Sprintf("; %.1f kWh would add %s/year for %s more",
+				next.capacity, ec.nf.Money(ec.annualSavings(next)-ec.annualSavings(r)), ec.nf.Money(ec.investment(next)-ec.investment(r)))
+		}
+		if rec.npv <= 0 {
+			rec.reason += "; no size pays back within the horizon"
+		}
+		return rec, nil
+
+	case goalOffGrid:
+		bestCov, bestCap := 0.0, 0.0
+		for i, r := range results {
+			cov := og.coverage(r)
+			if cov >= targetPct {
+				rec := recommendation{result: r, npv: ec.npv(r), offGrid: cov}
+				rec.reason = fmt.Sprintf("smallest size reaching %.0f%% off-grid (%.1f%%) for %s",
+					targetPct, cov, ec.nf.Money(ec.investment(r)))
+				if i > 0 {
+					rec.reason += fmt.Sprintf("; %.1f kWh reaches %.1f%%", results[i-1].capacity, og.coverage(results[i-1]))
+				}
+				return rec, nil
+			}
+			if cov > bestCov {
+				bestCov, bestCap = cov, r.capacity
+			}
+		}
+		return recommendation{}, fmt.Errorf("no capacity up to %.1f kWh reaches %.0f%% off-grid (best %.1f%% at %.1f kWh)",
+			results[len(results)-1].capacity, targetPct, bestCov, bestCap)
+	}
+	return recommendation{}, fmt.Errorf("unknown goal %q", goal)
+}
+
+// searchCapacities returns step, 2·step, … up to max.
+func searchCapacities(step, max float64) ([]float64, error) {
+	if step <= 0 || max < step {
+		return nil, fmt.Errorf("search needs 0 < step <= max, got step %v max %v", step, max)
+	}
+	var caps []float64
+	for i := 1; float64(i)*step <= max+1e-9; i++ {
+		caps = append(caps, float64(i)*step)
+	}
+	return caps, nil
+}
+
+func printTable(results []result, floor, ceiling, cRate, hpPct, appPct, baseLoadW, baseLoadPct, efficiency float64, load func() *store.Store) {
 	if len(results) == 0 {
 		return
 	}
 
 	// Header info: use time range from first result's summary context
 	// We re-derive from a quick store load
-	dataStore := loadCSVs(inputDir)
+	dataStore := load()
 	tr, _ := dataStore.GlobalTimeRange()
 	days := tr.End.Sub(tr.Start).Hours() / 24
+	baseLoadKWh := baseLoadW / 1000 * tr.End.Sub(tr.Start).Hours()
 
 	fmt.Println()
 	fmt.Println("Battery Size Comparison")
 	fmt.Printf("  Discharge floor: %.0f%%, Charge ceiling: %.0f%%, C-rate: %.1f\n", floor, ceiling, cRate)
 	fmt.Printf("  Data: %s to %s (%.0f days)\n", tr.Start.Format("2006-01-02"), tr.End.Format("2006-01-02"), days)
-	fmt.Printf("  Off-grid calc: heat pump %.0f%%, appliances %.0f%%\n", hpPct, appPct)
+	fmt.Printf("  Off-grid calc: heat pump %.0f%%, appliances %.0f%%", hpPct, appPct)
+	if baseLoadW > 0 {
+		fmt.Printf(", base load %.0f W at %.0f%%", baseLoadW, baseLoadPct)
+	}
+	if efficiency < 100 {
+		fmt.Printf(", battery efficiency %.0f%%", efficiency)
+	}
+	fmt.Println()
 	fmt.Println()
 
 	// Table header
@@ -122,7 +343,7 @@ func printTable(results []result, floor, ceiling, cRate, hpPct, appPct float64,
 	for i, r := range results {
 		savings := r.summary.BatterySavingsKWh
 		savingsPerKWh := savings / r.capacity
-		offGrid := r.summary.OffGridCoverage(hpPct, appPct)
+		offGrid := r.summary.OffGridCoverageWithEfficiency(hpPct, appPct, baseLoadKWh, baseLoadPct, efficiency/100)
 
 		marginal := "-"
 		if i > 0 {
@@ -172,7 +393,7 @@ func parseCapacities(s string) ([]float64, error) {
 	return caps, nil
 }
 
-func loadCSVs(dir string) *store.Store {
+func loadCSVs(dir string, rules ingest.SanitizeRules) *store.Store {
 	dataStore := store.New()
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -196,6 +417,10 @@ func loadCSVs(dir string) *store.Store {
 		if err != nil {
 			log.Fatalf("Parsing %s: %v", path, err)
 		}
+		readings, report := ingest.Sanitize(readings, rules)
+		if report.Total() > 0 {
+			log.Printf("Sanitized %s: %s", path, report)
+		}
 
 		if len(readings) > 0 {
 			name := string(sensorType)
@@ -211,6 +436,8 @@ func loadCSVs(dir string) *store.Store {
 			dataStore.AddReadings(readings)
 		}
 	}
+	// Three-phase meters without a total: sum the phases into grid_power.
+	simulator.SumGridPhases(dataStore)
 	return dataStore
 }
 
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// surplusStore holds 14 days of hourly grid power: a 2 kW export from 10:00
+// to 14:00 and a 3 kW import from 18:00 to 22:00 at a flat 1 PLN/kWh. The
+// battery follows the grid one step late, so it stores at most 6 kWh a day and
+// any capacity beyond 6 kWh costs more without saving more.
+func surplusStore() *store.Store {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for h := 0; h <= 14*24; h++ {
+		ts := base.Add(time.Duration(h) * time.Hour)
+		grid := 0.0
+		switch hod := h % 24; {
+		case hod >= 10 && hod < 14:
+			grid = -2000
+		case hod >= 18 && hod < 22:
+			grid = 3000
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid},
+			model.Reading{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: 1},
+		)
+	}
+	s.AddReadings(readings)
+	return s
+}
+
+func TestRecommend_FindsNPVOptimum(t *testing.T) {
+	caps, err := searchCapacities(2, 16)
+	require.NoError(t, err)
+	p := simParams{cRate: 1, floor: 0, ceiling: 100, efficiency: 100, step: time.Hour, checkBalance: true, spotPrices: true}
+	var results []result
+	for _, c := range caps {
+		r, err := simulate(surplusStore, c, p)
+		require.NoError(t, err)
+		results = append(results, r)
+	}
+
+	ec := economics{costPerKWh: 500, years: 10, discountRate: 0.05}
+	rec, err := recommend(results, goalNPV, 0, ec, offGridParams{hpPct: 100, appPct: 100, efficiency: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 6.0, rec.capacity)
+	assert.Greater(t, rec.npv, 0.0)
+	assert.Contains(t, rec.reason, "highest 10-year NPV")
+}
+
+func TestRecommend_OffGridTargetAtLeastCost(t *testing.T) {
+	var results []result
+	for i, saved := range []float64{30, 60, 85, 90} {
+		r := result{capacity: float64(i+1) * 5, days: 365}
+		r.summary.HomeDemandKWh = 100
+		r.summary.BatterySavingsKWh = saved
+		results = append(results, r)
+	}
+	og := offGridParams{hpPct: 100, appPct: 100, efficiency: 1}
+	ec := economics{costPerKWh: 1000, years: 10}
+
+	rec, err := recommend(results, goalOffGrid, 80, ec, og)
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, rec.capacity)
+	assert.InDelta(t, 85, rec.offGrid, 1e-9)
+	assert.Contains(t, rec.reason, "10.0 kWh reaches 60.0%")
+
+	_, err = recommend(results, goalOffGrid, 95, ec, og)
+	assert.ErrorContains(t, err, "best 90.0% at 20.0 kWh")
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"energy_simulator/internal/ingest"
+)
+
+var (
+	weekFileRe  = regexp.MustCompile(`^\d{4}-W\d{2}\.csv$`)
+	monthFileRe = regexp.MustCompile(`^\d{4}-\d{2}\.csv$`)
+)
+
+func main() {
+	dir := flag.String("dir", "input/recent", "Directory containing weekly CSV files from ha-fetch-history")
+	period := flag.String("period", "month", "Target file period: month or year")
+	allowSkipped := flag.Bool("allow-skipped", false, "Compact even if some rows cannot be parsed, dropping them")
+	flag.Parse()
+
+	if err := compact(*dir, *period, *allowSkipped, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// compact merges weekly files in dir into one file per period ("2026-02.csv"
+// for month, "2026.csv" for year). Compacting to years also folds monthly
+// files in. Records are de-duplicated on (sensor, timestamp) and sorted.
+// Every target is written to a temp file and renamed into place before any
+// source file is removed, so an interrupted run loses nothing and a repeated
+// run is a no-op. Rows that cannot be parsed would be dropped by the
+// rewrite, so unless allowSkipped is set compact refuses to write or delete
+// anything when it finds one.
+func compact(dir, period string, allowSkipped bool, out io.Writer) error {
+	var keyFn func(float64) string
+	switch period {
+	case "month":
+		keyFn = monthKey
+	case "year":
+		keyFn = yearKey
+	default:
+		return fmt.Errorf("unknown period %q: expected month or year", period)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var sources []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if weekFileRe.MatchString(name) || (period == "year" && monthFileRe.MatchString(name)) {
+			sources = append(sources, filepath.Join(dir, name))
+		}
+	}
+	if len(sources) == 0 {
+		fmt.Fprintf(out, "Nothing to compact in %s\n", dir)
+		return nil
+	}
+
+	skipped := make(map[string]int)
+	byPeriod := make(map[string][]ingest.Record)
+	for _, path := range sources {
+		records, n, err := loadCSVFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if n > 0 {
+			skipped[path] = n
+		}
+		for _, r := range records {
+			k := keyFn(r.TS)
+			byPeriod[k] = append(byPeriod[k], r)
+		}
+	}
+
+	keys := make([]string, 0, len(byPeriod))
+	for k := range byPeriod {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Existing targets are rewritten too, so read them before touching anything.
+	existing := make(map[string][]ingest.Record, len(keys))
+	for _, k := range keys {
+		path := filepath.Join(dir, k+".csv")
+		records, n, err := loadCSVFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if n > 0 {
+			skipped[path] = n
+		}
+		existing[k] = records
+	}
+
+	if len(skipped) > 0 {
+		paths := make([]string, 0, len(skipped))
+		total := 0
+		for path, n := range skipped {
+			paths = append(paths, path)
+			total += n
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Fprintf(out, "%s: %d unparseable rows\n", filepath.Base(path), skipped[path])
+		}
+		if !allowSkipped {
+			return fmt.Errorf("%d unparseable rows in %d files; fix them or pass -allow-skipped to drop them", total, len(paths))
+		}
+		fmt.Fprintf(out, "Dropping %d unparseable rows\n", total)
+	}
+
+	targets := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		path := filepath.Join(dir, k+".csv")
+		targets[path] = true
+
+		merged := ingest.MergeRecords(existing[k], byPeriod[k])
+		if err := writeCSVAtomic(path, merged); err != nil {
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+		fmt.Fprintf(out, "%s.csv: %d records\n", k, len(merged))
+	}
+
+	for _, path := range sources {
+		if targets[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "Compacted %d files into %d\n", len(sources), len(keys))
+	return nil
+}
+
+// monthKey returns the month string for a unix timestamp, e.g. "2026-02".
+func monthKey(ts float64) string {
+	return unixTime(ts).Format("2006-01")
+}
+
+// yearKey returns the year string for a unix timestamp, e.g. "2026".
+func yearKey(ts float64) string {
+	return unixTime(ts).Format("2006")
+}
+
+func unixTime(ts float64) time.Time {
+	return time.Unix(int64(ts), int64((ts-float64(int64(ts)))*1e9))
+}
+
+// loadCSVFile reads one CSV file, returning its records and the number of
+// rows that could not be parsed.
+func loadCSVFile(path string) ([]ingest.Record, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return ingest.ReadRecords(f)
+}
+
+// writeCSVAtomic writes records to a temp file next to path and renames it
+// into place, so readers never see a partially written file.
+func writeCSVAtomic(path string, records []ingest.Record) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := ingest.WriteRecords(tmp, records); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
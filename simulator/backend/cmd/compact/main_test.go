@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/ingest"
+)
+
+func ts(s string) float64 {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return float64(t.Unix())
+}
+
+func rec(sensorID string, value, ts float64) ingest.Record {
+	return ingest.Record{SensorID: sensorID, Value: value, TS: ts}
+}
+
+func writeWeek(t *testing.T, dir, name string, records []ingest.Record) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(dir, name))
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, ingest.WriteRecords(f, records))
+}
+
+func csvNames(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	var names []string
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCompact_WeeksIntoMonths(t *testing.T) {
+	dir := t.TempDir()
+	writeWeek(t, dir, "2026-W03.csv", []ingest.Record{
+		rec("sensor.a", 1, ts("2026-01-12 10:00")),
+		rec("sensor.a", 2, ts("2026-01-13 10:00")),
+		rec("sensor.b", 3, ts("2026-01-13 10:00")),
+	})
+	// Overlaps W03 on one record and spans the month boundary.
+	writeWeek(t, dir, "2026-W05.csv", []ingest.Record{
+		rec("sensor.a", 2, ts("2026-01-13 10:00")),
+		rec("sensor.a", 4, ts("2026-01-28 12:00")),
+		rec("sensor.a", 5, ts("2026-02-01 12:00")),
+	})
+	writeWeek(t, dir, "2026-W07.csv", []ingest.Record{
+		rec("sensor.b", 6, ts("2026-02-10 08:00")),
+	})
+	// Non-weekly files are left alone.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.csv"), []byte("x\n"), 0o644))
+
+	require.NoError(t, compact(dir, "month", false, io.Discard))
+	assert.Equal(t, []string{"2026-01.csv", "2026-02.csv", "notes.csv"}, csvNames(t, dir))
+
+	jan, _, err := loadCSVFile(filepath.Join(dir, "2026-01.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, []ingest.Record{
+		rec("sensor.a", 1, ts("2026-01-12 10:00")),
+		rec("sensor.a", 2, ts("2026-01-13 10:00")),
+		rec("sensor.a", 4, ts("2026-01-28 12:00")),
+		rec("sensor.b", 3, ts("2026-01-13 10:00")),
+	}, jan)
+
+	feb, _, err := loadCSVFile(filepath.Join(dir, "2026-02.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, []ingest.Record{
+		rec("sensor.a", 5, ts("2026-02-01 12:00")),
+		rec("sensor.b", 6, ts("2026-02-10 08:00")),
+	}, feb)
+
+	// A second run finds nothing to do and changes nothing.
+	before, err := os.ReadFile(filepath.Join(dir, "2026-01.csv"))
+	require.NoError(t, err)
+	require.NoError(t, compact(dir, "month", false, io.Discard))
+	after, err := os.ReadFile(filepath.Join(dir, "2026-01.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+	assert.Equal(t, []string{"2026-01.csv", "2026-02.csv", "notes.csv"}, csvNames(t, dir))
+}
+
+func TestCompact_MergesIntoExistingMonth(t *testing.T) {
+	dir := t.TempDir()
+	writeWeek(t, dir, "2026-01.csv", []ingest.Record{
+		rec("sensor.a", 1, ts("2026-01-05 10:00")),
+	})
+	writeWeek(t, dir, "2026-W03.csv", []ingest.Record{
+		rec("sensor.a", 1, ts("2026-01-05 10:00")),
+		rec("sensor.a", 2, ts("2026-01-14 10:00")),
+	})
+
+	require.NoError(t, compact(dir, "month", false, io.Discard))
+
+	jan, _, err := loadCSVFile(filepath.Join(dir, "2026-01.csv"))
+	require.NoError(t, err)
+	assert.Len(t, jan, 2)
+	assert.Equal(t, []string{"2026-01.csv"}, csvNames(t, dir))
+}
+
+func TestCompact_Year(t *testing.T) {
+	dir := t.TempDir()
+	writeWeek(t, dir, "2025-12.csv", []ingest.Record{
+		rec("sensor.a", 1, ts("2025-12-10 10:00")),
+	})
+	writeWeek(t, dir, "2026-W03.csv", []ingest.Record{
+		rec("sensor.a", 2, ts("2026-01-14 10:00")),
+	})
+
+	require.NoError(t, compact(dir, "year", false, io.Discard))
+	assert.Equal(t, []string{"2025.csv", "2026.csv"}, csvNames(t, dir))
+}
+
+func TestCompact_RefusesToDropUnparseableRows(t *testing.T) {
+	dir := t.TempDir()
+	week := filepath.Join(dir, "2026-W03.csv")
+	require.NoError(t, os.WriteFile(week, []byte(
+		"sensor_id,value,updated_ts\n"+
+			"sensor.a,1,1768212000\n"+
+			"sensor.a,unavailable,1768215600\n"), 0o644))
+
+	require.Error(t, compact(dir, "month", false, io.Discard))
+	assert.Equal(t, []string{"2026-W03.csv"}, csvNames(t, dir), "nothing written or removed")
+
+	require.NoError(t, compact(dir, "month", true, io.Discard))
+	assert.Equal(t, []string{"2026-01.csv"}, csvNames(t, dir))
+}
+
+func TestCompact_UnknownPeriod(t *testing.T) {
+	assert.Error(t, compact(t.TempDir(), "decade", false, io.Discard))
+}
@@ -1,10 +1,17 @@
-// fetch-prices downloads historical DAM spot prices for Poland from the
-// Energy-Charts API (https://api.energy-charts.info), converts EUR/MWh to
-// PLN/kWh, and writes a CSV compatible with the RecentParser format
+// fetch-prices downloads historical DAM spot prices (Poland by default, any
+// bidding zone via -zone) from the Energy-Charts API
+// (https://api.energy-charts.info), converts EUR/MWh to PLN/kWh (at a static
+// rate, or with -fx-api at the NBP daily rate) unless told otherwise, and
+// writes a CSV compatible with the RecentParser format
 // (sensor_id,value,updated_ts).
+//
+// With -day-ahead it fetches only tomorrow's published auction prices and
+// merges them into the output file, so the simulator's arbitrage planner has
+// the coming day's prices in live mode.
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -13,23 +20,79 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const priceAPIBaseURL = "https://api.energy-charts.info"
+
+// biddingZones lists the bzn values accepted by the Energy-Charts price endpoint.
+var biddingZones = []string{
+	"AT", "BE", "BG", "CH", "CZ", "DE-AT-LU", "DE-LU", "DK1", "DK2", "EE", "ES",
+	"FI", "FR", "GR", "HR", "HU", "IT-Calabria", "IT-Centre-North", "IT-Centre-South",
+	"IT-North", "IT-SACOAC", "IT-SACODC", "IT-Sardinia", "IT-Sicily", "IT-South",
+	"LT", "LV", "ME", "NL", "NO1", "NO2", "NO2NSL", "NO3", "NO4", "NO5", "PL", "PT",
+	"RO", "RS", "SE1", "SE2", "SE3", "SE4", "SI", "SK",
+}
+
+// zoneTimeZones maps bidding zones outside central European time to their
+// time zone; every other zone follows CET/CEST.
+var zoneTimeZones = map[string]string{
+	"BG": "Europe/Sofia",
+	"EE": "Europe/Tallinn",
+	"FI": "Europe/Helsinki",
+	"GR": "Europe/Athens",
+	"LT": "Europe/Vilnius",
+	"LV": "Europe/Riga",
+	"PT": "Europe/Lisbon",
+	"RO": "Europe/Bucharest",
+}
+
+// Output units. The API always returns EUR/MWh.
+const (
+	unitPLNkWh = "PLN/kWh"
+	unitPLNMWh = "PLN/MWh"
+	unitEURkWh = "EUR/kWh"
+	unitEURMWh = "EUR/MWh"
+)
+
 type apiResponse struct {
 	UnixSeconds []int64   `json:"unix_seconds"`
 	Price       []float64 `json:"price"`
 	Unit        string    `json:"unit"`
 }
 
+type record struct {
+	ts    int64
+	price float64
+}
+
 func main() {
 	startDate := flag.String("start", "2018-01-01", "start date (YYYY-MM-DD)")
 	endDate := flag.String("end", "", "end date (YYYY-MM-DD), defaults to today")
-	eurPln := flag.Float64("eur-pln", 4.3, "EUR to PLN exchange rate")
+	zone := flag.String("zone", "PL", "Energy-Charts bidding zone (e.g. PL, DE-LU, SE4)")
+	unit := flag.String("unit", unitPLNkWh, "output unit: PLN/kWh, PLN/MWh, EUR/kWh or EUR/MWh")
+	noConvert := flag.Bool("no-convert", false, "write raw EUR/MWh prices (same as -unit EUR/MWh)")
+	eurPln := flag.Float64("eur-pln", 4.3, "EUR to PLN exchange rate (fallback when -fx-api is unavailable)")
+	fxAPI := flag.Bool("fx-api", false, "convert with daily EUR/PLN rates from the NBP API")
+	fxURL := flag.String("fx-url", nbpBaseURL, "NBP exchange rates API base URL")
+	apiURL := flag.String("api-url", priceAPIBaseURL, "Energy-Charts API base URL")
 	output := flag.String("output", "input/recent/historic_spot_prices.csv", "output CSV path")
 	sensorID := flag.String("sensor-id", "sensor.spotprice_now", "sensor ID in output")
+	dayAhead := flag.Bool("day-ahead", false, "fetch tomorrow's day-ahead prices and merge them into -output (ignores -start/-end)")
 	flag.Parse()
 
+	if !validZone(*zone) {
+		log.Fatalf("Unknown bidding zone %q; valid zones: %s", *zone, strings.Join(biddingZones, ", "))
+	}
+	if *noConvert {
+		*unit = unitEURMWh
+	}
+	if !validUnit(*unit) {
+		log.Fatalf("Unknown unit %q; use PLN/kWh, PLN/MWh, EUR/kWh or EUR/MWh", *unit)
+	}
+
 	start, err := time.Parse("2006-01-02", *startDate)
 	if err != nil {
 		log.Fatalf("Invalid start date: %v", err)
@@ -45,14 +108,138 @@ func main() {
 		}
 	}
 
-	log.Printf("Fetching PL spot prices from %s to %s (EUR/PLN=%.2f)",
-		start.Format("2006-01-02"), end.Format("2006-01-02"), *eurPln)
+	if *dayAhead {
+		loc, err := zoneLocation(*zone)
+		if err != nil {
+			log.Fatalf("Loading time zone of %s: %v", *zone, err)
+		}
+		start, end = dayAheadWindow(time.Now(), loc)
+	}
+
+	log.Printf("Fetching %s spot prices from %s to %s (output %s)",
+		*zone, start.Format("2006-01-02"), end.Format("2006-01-02"), *unit)
+
+	rate := func(int64) float64 { return *eurPln }
+	if strings.HasPrefix(*unit, "PLN") && *fxAPI {
+		if fx := loadFXRates(*fxURL, *eurPln, start, end); fx != nil {
+			rate = func(ts int64) float64 { return fx.rateOn(time.Unix(ts, 0)) }
+		}
+	}
+
+	records, err := fetchPrices(*apiURL, *zone, start, end, time.Second)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	for i := range records {
+		records[i].price = convertPrice(records[i].price, rate(records[i].ts), *unit)
+	}
+
+	if *dayAhead {
+		existing, err := readPriceCSV(*output)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Reading existing prices: %v", err)
+		}
+		records = mergePriceRecords(existing, records)
+	}
+
+	if err := writePriceCSV(*output, *sensorID, records); err != nil {
+		log.Fatalf("Writing output file: %v", err)
+	}
+	log.Printf("Wrote %d records to %s", len(records), *output)
+}
+
+// dayAheadWindow returns the calendar day after now in loc, the bidding
+// zone's time zone, which is the window the day-ahead auction publishes
+// prices for. The host's zone does not matter, so a UTC server still gets
+// the CET/CEST day for PL.
+func dayAheadWindow(now time.Time, loc *time.Location) (start, end time.Time) {
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	return today.AddDate(0, 0, 1), today.AddDate(0, 0, 2)
+}
+
+// zoneLocation returns the time zone of a bidding zone. Zones missing from
+// zoneTimeZones use Europe/Warsaw, which has the same CET/CEST clock as
+// the default PL zone.
+func zoneLocation(zone string) (*time.Location, error) {
+	name, ok := zoneTimeZones[zone]
+	if !ok {
+		name = "Europe/Warsaw"
+	}
+	return time.LoadLocation(name)
+}
+
+// writePriceCSV writes records in RecentParser-compatible format:
+// sensor_id,value,updated_ts.
+func writePriceCSV(path, sensorID string, records []record) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, "sensor_id,value,updated_ts")
+	for _, r := range records {
+		fmt.Fprintf(f, "%s,%.4f,%d\n", sensorID, r.price, r.ts)
+	}
+	return f.Close()
+}
 
-	type record struct {
-		ts    int64
-		price float64
+// readPriceCSV reads a file written by writePriceCSV. Prices are returned as
+// stored, i.e. already in the output unit.
+func readPriceCSV(path string) ([]record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
 	}
 	var records []record
+	for _, row := range rows[min(1, len(rows)):] {
+		if len(row) < 3 {
+			continue
+		}
+		price, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			continue
+		}
+		ts, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		records = append(records, record{ts: ts, price: price})
+	}
+	return records, nil
+}
+
+// mergePriceRecords combines existing and fetched prices sorted by timestamp;
+// fetched prices replace existing ones at the same timestamp.
+func mergePriceRecords(existing, fetched []record) []record {
+	byTS := make(map[int64]float64, len(existing)+len(fetched))
+	for _, r := range existing {
+		byTS[r.ts] = r.price
+	}
+	for _, r := range fetched {
+		byTS[r.ts] = r.price
+	}
+	merged := make([]record, 0, len(byTS))
+	for ts, price := range byTS {
+		merged = append(merged, record{ts: ts, price: price})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ts < merged[j].ts
+	})
+	return merged
+}
+
+// fetchPrices downloads raw EUR/MWh prices for zone in monthly chunks,
+// pausing between chunks, and returns them sorted and deduplicated.
+func fetchPrices(baseURL, zone string, start, end time.Time, pause time.Duration) ([]record, error) {
+	var records []record
 
 	// Fetch in monthly chunks to stay within API limits.
 	chunkStart := start
@@ -63,9 +250,10 @@ func main() {
 		}
 
 		url := fmt.Sprintf(
-			"https://api.energy-charts.info/price?bzn=PL&start=%s&end=%s",
-			chunkStart.Format("2006-01-02T15:04Z"),
-			chunkEnd.Format("2006-01-02T15:04Z"),
+			"%s/price?bzn=%s&start=%s&end=%s",
+			baseURL, zone,
+			chunkStart.UTC().Format("2006-01-02T15:04Z"),
+			chunkEnd.UTC().Format("2006-01-02T15:04Z"),
 		)
 
 		log.Printf("  %s → %s ...",
@@ -73,22 +261,18 @@ func main() {
 
 		data, err := fetchWithRetry(url)
 		if err != nil {
-			log.Fatalf("Fetching %s → %s: %v",
-				chunkStart.Format("2006-01-02"), chunkEnd.Format("2006-01-02"), err)
-		}
-
-		if len(data.UnixSeconds) != len(data.Price) {
-			log.Fatalf("Mismatched array lengths: %d timestamps, %d prices",
-				len(data.UnixSeconds), len(data.Price))
+			return nil, fmt.Errorf("fetching %s prices %s → %s: %w",
+				zone, chunkStart.Format("2006-01-02"), chunkEnd.Format("2006-01-02"), err)
 		}
 
 		for i, ts := range data.UnixSeconds {
-			plnKwh := data.Price[i] * *eurPln / 1000.0
-			records = append(records, record{ts: ts, price: plnKwh})
+			records = append(records, record{ts: ts, price: data.Price[i]})
 		}
 
 		chunkStart = chunkEnd
-		time.Sleep(1 * time.Second)
+		if chunkStart.Before(end) {
+			time.Sleep(pause)
+		}
 	}
 
 	// Sort by timestamp and deduplicate.
@@ -102,21 +286,36 @@ func main() {
 		}
 		deduped = append(deduped, r)
 	}
-	records = deduped
+	return deduped, nil
+}
 
-	// Write CSV in RecentParser-compatible format: sensor_id,value,updated_ts
-	f, err := os.Create(*output)
-	if err != nil {
-		log.Fatalf("Creating output file: %v", err)
+// convertPrice converts a EUR/MWh price to unit using eurPln for PLN units.
+func convertPrice(eurMWh, eurPln float64, unit string) float64 {
+	v := eurMWh
+	if strings.HasPrefix(unit, "PLN") {
+		v *= eurPln
 	}
-	defer f.Close()
+	if strings.HasSuffix(unit, "/kWh") {
+		v /= 1000.0
+	}
+	return v
+}
 
-	fmt.Fprintln(f, "sensor_id,value,updated_ts")
-	for _, r := range records {
-		fmt.Fprintf(f, "%s,%.4f,%d\n", *sensorID, r.price, r.ts)
+func validZone(zone string) bool {
+	for _, z := range biddingZones {
+		if z == zone {
+			return true
+		}
 	}
+	return false
+}
 
-	log.Printf("Wrote %d records to %s", len(records), *output)
+func validUnit(unit string) bool {
+	switch unit {
+	case unitPLNkWh, unitPLNMWh, unitEURkWh, unitEURMWh:
+		return true
+	}
+	return false
 }
 
 func fetchWithRetry(url string) (apiResponse, error) {
@@ -154,3 +353,118 @@ func fetchWithRetry(url string) (apiResponse, error) {
 	}
 	return apiResponse{}, fmt.Errorf("exhausted %d retries", maxRetries)
 }
+
+const nbpBaseURL = "https://api.nbp.pl/api/exchangerates/rates/A/EUR"
+
+// NBP limits a single rates query to 93 days.
+const nbpMaxDays = 90
+
+type nbpResponse struct {
+	Rates []struct {
+		EffectiveDate string  `json:"effectiveDate"`
+		Mid           float64 `json:"mid"`
+	} `json:"rates"`
+}
+
+// fxRates holds daily EUR/PLN mid rates from the NBP table A.
+// NBP publishes only on business days, so a date without its own rate uses
+// the latest earlier one. Dates before the first known rate use fallback.
+type fxRates struct {
+	baseURL  string
+	fallback float64
+	rates    map[string]float64 // "2006-01-02" → mid
+	dates    []string           // sorted keys of rates
+}
+
+func newFXRates(baseURL string, fallback float64) *fxRates {
+	return &fxRates{
+		baseURL:  baseURL,
+		fallback: fallback,
+		rates:    make(map[string]float64),
+	}
+}
+
+// load fetches rates covering [start, end]. It starts a week early so the
+// first days of the range have a preceding business-day rate.
+func (f *fxRates) load(start, end time.Time) error {
+	chunkStart := start.AddDate(0, 0, -7)
+	for !chunkStart.After(end) {
+		chunkEnd := chunkStart.AddDate(0, 0, nbpMaxDays)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		if err := f.fetchChunk(chunkStart, chunkEnd); err != nil {
+			return err
+		}
+		chunkStart = chunkEnd.AddDate(0, 0, 1)
+	}
+
+	f.dates = f.dates[:0]
+	for d := range f.rates {
+		f.dates = append(f.dates, d)
+	}
+	sort.Strings(f.dates)
+	return nil
+}
+
+func (f *fxRates) fetchChunk(start, end time.Time) error {
+	url := fmt.Sprintf("%s/%s/%s/?format=json", f.baseURL, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("FX request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// NBP answers 404 when the range has no published rates (e.g. a holiday week).
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading FX body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("FX API returned %d: %s", resp.StatusCode, body)
+	}
+
+	var data nbpResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fmt.Errorf("parsing FX JSON: %w", err)
+	}
+	for _, r := range data.Rates {
+		if r.Mid > 0 {
+			f.rates[r.EffectiveDate] = r.Mid
+		}
+	}
+	return nil
+}
+
+// rateOn returns the EUR/PLN rate effective on t's (UTC) date.
+func (f *fxRates) rateOn(t time.Time) float64 {
+	day := t.UTC().Format("2006-01-02")
+	if r, ok := f.rates[day]; ok {
+		return r
+	}
+	// Latest date <= day
+	idx := sort.SearchStrings(f.dates, day)
+	if idx == 0 {
+		return f.fallback
+	}
+	return f.rates[f.dates[idx-1]]
+}
+
+// loadFXRates fetches rates for the range, or returns nil (static rate) if
+// the API is unavailable.
+func loadFXRates(baseURL string, fallback float64, start, end time.Time) *fxRates {
+	fx := newFXRates(baseURL, fallback)
+	if err := fx.load(start, end); err != nil {
+		log.Printf("FX API unavailable, using static EUR/PLN=%.2f: %v", fallback, err)
+		return nil
+	}
+	if len(fx.dates) == 0 {
+		log.Printf("FX API returned no rates, using static EUR/PLN=%.2f", fallback)
+		return nil
+	}
+	log.Printf("Loaded %d daily EUR/PLN rates (%s → %s)", len(fx.dates), fx.dates[0], fx.dates[len(fx.dates)-1])
+	return fx
+}
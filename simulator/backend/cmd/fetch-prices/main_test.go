@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/ingest"
+)
+
+// fakeNBP serves fixed EUR rates for early January 2024.
+func fakeNBP(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"table":"A","currency":"euro","code":"EUR","rates":[
+			{"no":"001/A/NBP/2024","effectiveDate":"2024-01-02","mid":4.3480},
+			{"no":"002/A/NBP/2024","effectiveDate":"2024-01-03","mid":4.3589},
+			{"no":"003/A/NBP/2024","effectiveDate":"2024-01-05","mid":4.3688}
+		]}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFXRates_PerDate(t *testing.T) {
+	server := fakeNBP(t)
+	fx := newFXRates(server.URL, 4.3)
+	require.NoError(t, fx.load(date("2024-01-02"), date("2024-01-07")))
+
+	jan2 := fx.rateOn(date("2024-01-02").Add(14 * time.Hour))
+	jan3 := fx.rateOn(date("2024-01-03").Add(9 * time.Hour))
+	assert.Equal(t, 4.3480, jan2)
+	assert.Equal(t, 4.3589, jan3)
+	assert.NotEqual(t, jan2, jan3)
+
+	// No publication on the 4th or at the weekend: latest earlier rate applies
+	assert.Equal(t, 4.3589, fx.rateOn(date("2024-01-04")))
+	assert.Equal(t, 4.3688, fx.rateOn(date("2024-01-07")))
+
+	// Before the first known rate: static fallback
+	assert.Equal(t, 4.3, fx.rateOn(date("2023-12-25")))
+}
+
+func TestFXRates_RequestURL(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, `{"rates":[]}`)
+	}))
+	defer server.Close()
+
+	fx := newFXRates(server.URL, 4.3)
+	require.NoError(t, fx.load(date("2024-01-08"), date("2024-01-10")))
+	require.Len(t, paths, 1)
+	assert.Equal(t, "/2024-01-01/2024-01-10/", paths[0])
+}
+
+func TestLoadFXRates_FallbackOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	assert.Nil(t, loadFXRates(server.URL, 4.3, date("2024-01-02"), date("2024-01-07")))
+}
+
+// fakePriceAPI serves two hourly EUR/MWh prices and records request queries.
+func fakePriceAPI(t *testing.T, queries *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.RawQuery)
+		fmt.Fprint(w, `{"unix_seconds":[1704096000,1704099600],"price":[80.5,120.0],"unit":"EUR / MWh"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchPrices_ZoneInRequest(t *testing.T) {
+	var queries []string
+	server := fakePriceAPI(t, &queries)
+
+	records, err := fetchPrices(server.URL, "DE-LU", date("2024-01-01"), date("2024-01-02"), 0)
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.True(t, strings.HasPrefix(queries[0], "bzn=DE-LU&"), queries[0])
+	assert.Len(t, records, 2)
+}
+
+func TestFetchPrices_NoConvertKeepsEURMWh(t *testing.T) {
+	var queries []string
+	server := fakePriceAPI(t, &queries)
+
+	records, err := fetchPrices(server.URL, "SE4", date("2024-01-01"), date("2024-01-02"), 0)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	assert.Equal(t, 80.5, convertPrice(records[0].price, 4.3, unitEURMWh))
+	assert.Equal(t, 120.0, convertPrice(records[1].price, 4.3, unitEURMWh))
+	assert.InDelta(t, 0.34615, convertPrice(records[0].price, 4.3, unitPLNkWh), 1e-9)
+	assert.InDelta(t, 0.0805, convertPrice(records[0].price, 4.3, unitEURkWh), 1e-9)
+}
+
+func TestFetchPrices_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown bzn", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	_, err := fetchPrices(server.URL, "PL", date("2024-01-01"), date("2024-01-02"), 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PL")
+	assert.Contains(t, err.Error(), "400")
+	assert.Contains(t, err.Error(), "unknown bzn")
+}
+
+func TestDayAhead_StoresTomorrowsPrices(t *testing.T) {
+	// Tomorrow is the zone's calendar day, which starts at 23:00 UTC in CET,
+	// whatever the zone of now.
+	warsaw, err := zoneLocation("PL")
+	require.NoError(t, err)
+	now := time.Date(2024, 3, 10, 12, 15, 0, 0, time.UTC)
+	start, end := dayAheadWindow(now, warsaw)
+	assert.True(t, date("2024-03-11").Add(-time.Hour).Equal(start))
+	assert.True(t, date("2024-03-12").Add(-time.Hour).Equal(end))
+
+	// 23:30 UTC is already the 11th in Warsaw.
+	lateStart, _ := dayAheadWindow(date("2024-03-10").Add(23*time.Hour+30*time.Minute), warsaw)
+	assert.True(t, date("2024-03-12").Add(-time.Hour).Equal(lateStart))
+
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		// 2024-03-11 00:00 and 01:00 CET
+		fmt.Fprint(w, `{"unix_seconds":[1710111600,1710115200],"price":[-5.0,95.0],"unit":"EUR / MWh"}`)
+	}))
+	defer server.Close()
+
+	fetched, err := fetchPrices(server.URL, "PL", start, end, 0)
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.Contains(t, queries[0], "start=2024-03-10T23:00Z")
+	assert.Contains(t, queries[0], "end=2024-03-11T23:00Z")
+	for i := range fetched {
+		fetched[i].price = convertPrice(fetched[i].price, 4.3, unitPLNkWh)
+	}
+
+	// Today's prices already on disk are kept.
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	require.NoError(t, writePriceCSV(path, "sensor.spotprice_now", []record{{ts: 1710100800, price: 0.5}}))
+	existing, err := readPriceCSV(path)
+	require.NoError(t, err)
+	require.NoError(t, writePriceCSV(path, "sensor.spotprice_now", mergePriceRecords(existing, fetched)))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	readings, err := (&ingest.RecentParser{}).Parse(f)
+	require.NoError(t, err)
+	require.Len(t, readings, 3)
+
+	assert.Equal(t, "sensor.spotprice_now", readings[1].SensorID)
+	assert.True(t, start.Equal(readings[1].Timestamp))
+	assert.True(t, start.Add(time.Hour).Equal(readings[2].Timestamp))
+	assert.True(t, readings[1].Timestamp.After(now))
+	assert.InDelta(t, -0.0215, readings[1].Value, 1e-4)
+	assert.InDelta(t, 0.4085, readings[2].Value, 1e-4)
+	assert.InDelta(t, 0.5, readings[0].Value, 1e-9)
+}
+
+func TestZoneLocation(t *testing.T) {
+	summer := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for zone, offset := range map[string]int{"PL": 2, "DE-LU": 2, "FI": 3, "PT": 1} {
+		loc, err := zoneLocation(zone)
+		require.NoError(t, err, zone)
+		_, got := summer.In(loc).Zone()
+		assert.Equal(t, offset*3600, got, zone)
+	}
+}
+
+func TestValidZone(t *testing.T) {
+	assert.True(t, validZone("PL"))
+	assert.True(t, validZone("DE-LU"))
+	assert.False(t, validZone("pl"))
+	assert.False(t, validZone("XX"))
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
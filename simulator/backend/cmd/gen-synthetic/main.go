@@ -0,0 +1,267 @@
+// gen-synthetic writes a deterministic synthetic dataset for testing and
+// demos: grid power, PV, heat pump, outside temperature and spot price CSVs in
+// the RecentParser format (sensor_id,value,updated_ts), ready to be loaded
+// from an input directory's recent/ subdirectory.
+//
+// The series are generated from one weather draw per day, so they stay
+// physically consistent: cold days run the heat pump harder, sunny days
+// produce more PV, are warmer in the afternoon and push the midday price down.
+// The same -seed always produces the same files.
+//
+// Usage:
+//
+//	gen-synthetic
+//	gen-synthetic -days 60 -start 2024-01-01 -pv-peak 8000 -heat-pump large
+//	gen-synthetic -price-volatility 0.8 -seed 7 -output input.synthetic/recent
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"energy_simulator/internal/model"
+)
+
+// heatPumpProfiles maps a -heat-pump profile to the electric power drawn per
+// degree below the heating balance temperature (W/K).
+var heatPumpProfiles = map[string]float64{
+	"none":   0,
+	"small":  60,
+	"medium": 110,
+	"large":  170,
+}
+
+const (
+	// heatingBalanceC is the outside temperature above which no space
+	// heating is needed.
+	heatingBalanceC = 15.0
+	// basePricePLN is the mean spot price (PLN/kWh) the price shape varies around.
+	basePricePLN = 0.45
+)
+
+// params describes the dataset to generate.
+type params struct {
+	Start           time.Time
+	Days            int
+	Step            time.Duration
+	PVPeakW         float64
+	BaseLoadW       float64
+	HeatPumpWPerK   float64
+	PriceVolatility float64 // relative size of the daily price swing, 0 = flat
+	Seed            uint64
+}
+
+// outputs lists the generated files: name, sensor type and value format.
+var outputs = []struct {
+	file   string
+	sensor model.SensorType
+	format string
+}{
+	{"grid_power.csv", model.SensorGridPower, "%.1f"},
+	{"pv_power.csv", model.SensorPVPower, "%.1f"},
+	{"heat_pump.csv", model.SensorPumpHeatPower, "%.1f"},
+	{"temperature.csv", model.SensorPumpExtTemp, "%.1f"},
+	{"energy_prices.csv", model.SensorEnergyPrice, "%.4f"},
+}
+
+func main() {
+	startDate := flag.String("start", "2024-01-01", "first day (YYYY-MM-DD, UTC)")
+	days := flag.Int("days", 14, "number of days to generate")
+	step := flag.Duration("step", 15*time.Minute, "interval between power and temperature readings (prices are hourly)")
+	pvPeak := flag.Float64("pv-peak", 6000, "PV output at noon on a clear midsummer day (W)")
+	baseLoad := flag.Float64("base-load", 400, "average household load excluding the heat pump (W)")
+	heatPump := flag.String("heat-pump", "medium", "heat pump profile: none, small, medium or large")
+	volatility := flag.Float64("price-volatility", 0.4, "relative size of the daily spot price swing (0 = flat)")
+	seed := flag.Uint64("seed", 1, "random seed; the same seed reproduces the same files")
+	output := flag.String("output", "input.synthetic/recent", "output directory")
+	flag.Parse()
+
+	start, err := time.Parse("2006-01-02", *startDate)
+	if err != nil {
+		log.Fatalf("Invalid start date: %v", err)
+	}
+	wPerK, ok := heatPumpProfiles[*heatPump]
+	if !ok {
+		log.Fatalf("Unknown heat pump profile %q; use none, small, medium or large", *heatPump)
+	}
+	if *days <= 0 || *step <= 0 {
+		log.Fatalf("-days and -step must be positive")
+	}
+
+	readings := generate(params{
+		Start:           start,
+		Days:            *days,
+		Step:            *step,
+		PVPeakW:         *pvPeak,
+		BaseLoadW:       *baseLoad,
+		HeatPumpWPerK:   wPerK,
+		PriceVolatility: *volatility,
+		Seed:            *seed,
+	})
+
+	if err := writeDataset(*output, readings); err != nil {
+		log.Fatalf("Writing dataset: %v", err)
+	}
+	log.Printf("Wrote %d days (%s to %s) to %s",
+		*days, start.Format("2006-01-02"), start.AddDate(0, 0, *days).Format("2006-01-02"), *output)
+}
+
+// dayWeather is the weather drawn for one day; every series of that day is
+// derived from it.
+type dayWeather struct {
+	meanC  float64 // daily mean outside temperature
+	cloud  float64 // 0 = clear sky, 1 = overcast
+	swingC float64 // half of the day/night temperature difference
+}
+
+// generate returns readings for every output sensor from p.Start over p.Days.
+func generate(p params) map[model.SensorType][]model.Reading {
+	rng := rand.New(rand.NewPCG(p.Seed, 0))
+	out := make(map[model.SensorType][]model.Reading, len(outputs))
+	add := func(st model.SensorType, ts time.Time, v float64) {
+		out[st] = append(out[st], model.Reading{
+			Timestamp: ts,
+			SensorID:  model.SensorHomeAssistantID[st],
+			Type:      st,
+			Value:     v,
+			Min:       v,
+			Max:       v,
+			Unit:      model.SensorCatalog[st].Unit,
+		})
+	}
+
+	var anomaly float64 // persistent temperature anomaly, so cold spells last days
+	for d := 0; d < p.Days; d++ {
+		day := p.Start.AddDate(0, 0, d)
+		anomaly = 0.7*anomaly + rng.NormFloat64()*2.5
+		cloud := math.Max(0, math.Min(1, 0.5+0.3*rng.NormFloat64()))
+		w := dayWeather{
+			// Clear skies bring warmer days in summer and colder nights in winter.
+			meanC:  seasonalMeanC(day) + anomaly + (0.5-cloud)*2*seasonalSign(day),
+			cloud:  cloud,
+			swingC: 2 + 5*(1-cloud),
+		}
+
+		for ts := day; ts.Before(day.AddDate(0, 0, 1)); ts = ts.Add(p.Step) {
+			temp := w.meanC - w.swingC*math.Cos(2*math.Pi*(hourOf(ts)-3)/24)
+			pv := pvPower(ts, w, p.PVPeakW) * (1 + 0.05*rng.NormFloat64())
+			pv = math.Max(0, pv)
+			hp := heatPumpPower(temp, p.HeatPumpWPerK) * (1 + 0.1*rng.NormFloat64())
+			hp = math.Max(0, hp)
+			load := p.BaseLoadW * loadShape(ts) * (1 + 0.15*rng.NormFloat64())
+			load = math.Max(0.2*p.BaseLoadW, load)
+
+			add(model.SensorPumpExtTemp, ts, temp)
+			add(model.SensorPVPower, ts, pv)
+			add(model.SensorPumpHeatPower, ts, hp)
+			add(model.SensorGridPower, ts, load+hp-pv)
+		}
+
+		for h := 0; h < 24; h++ {
+			ts := day.Add(time.Duration(h) * time.Hour)
+			add(model.SensorEnergyPrice, ts, spotPrice(ts, w, p.PriceVolatility, rng))
+		}
+	}
+	return out
+}
+
+// seasonalMeanC is a Central European daily mean temperature: about −1 °C in
+// mid-January and 19 °C in mid-July.
+func seasonalMeanC(t time.Time) float64 {
+	return 9 - 10*math.Cos(2*math.Pi*float64(t.YearDay()-15)/365)
+}
+
+// seasonalSign is +1 in the warm half of the year and −1 in the cold half.
+func seasonalSign(t time.Time) float64 {
+	return math.Copysign(1, -math.Cos(2*math.Pi*float64(t.YearDay()-15)/365))
+}
+
+// daylight returns sunrise and sunset as fractional UTC hours, from 8 h of
+// daylight at the winter solstice to 16.5 h at the summer solstice.
+func daylight(t time.Time) (sunrise, sunset float64) {
+	length := 12.25 - 4.25*math.Cos(2*math.Pi*float64(t.YearDay()+10)/365)
+	return 12 - length/2, 12 + length/2
+}
+
+// pvPower is the PV output at t: a half-sine between sunrise and sunset scaled
+// by the sun's seasonal height and reduced by cloud cover.
+func pvPower(t time.Time, w dayWeather, peakW float64) float64 {
+	sunrise, sunset := daylight(t)
+	h := hourOf(t)
+	if h <= sunrise || h >= sunset {
+		return 0
+	}
+	height := 0.55 - 0.45*math.Cos(2*math.Pi*float64(t.YearDay()+10)/365)
+	return peakW * height * math.Sin(math.Pi*(h-sunrise)/(sunset-sunrise)) * (1 - 0.8*w.cloud)
+}
+
+// heatPumpPower is the electric draw for space heating at outside tempC.
+func heatPumpPower(tempC, wPerK float64) float64 {
+	return math.Max(0, heatingBalanceC-tempC) * wPerK
+}
+
+// loadShape is the household load relative to its daily average, with a
+// morning and a larger evening peak.
+func loadShape(t time.Time) float64 {
+	h := hourOf(t)
+	return 0.8 +
+		0.5*math.Exp(-math.Pow(h-7.5, 2)/2) +
+		0.9*math.Exp(-math.Pow(h-19, 2)/4)
+}
+
+// spotPrice is the hourly spot price: the evening peak and the midday solar
+// dip scale with volatility, clear skies deepen the dip and cold days raise
+// the whole day.
+func spotPrice(t time.Time, w dayWeather, volatility float64, rng *rand.Rand) float64 {
+	h := hourOf(t)
+	shape := 0.8*math.Exp(-math.Pow(h-19, 2)/4) +
+		0.3*math.Exp(-math.Pow(h-8, 2)/3) -
+		(0.3+0.7*(1-w.cloud))*math.Exp(-math.Pow(h-13, 2)/6) -
+		0.3*math.Exp(-math.Pow(h-3, 2)/6)
+	cold := 0.01 * math.Max(0, heatingBalanceC-w.meanC)
+	noise := 0.1 * rng.NormFloat64()
+	return basePricePLN * (1 + cold + volatility*(shape+noise))
+}
+
+func hourOf(t time.Time) float64 {
+	return float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+}
+
+// writeDataset writes one RecentParser-compatible CSV per output sensor to dir.
+func writeDataset(dir string, readings map[model.SensorType][]model.Reading) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, o := range outputs {
+		if err := writeRecentCSV(filepath.Join(dir, o.file), o.format, readings[o.sensor]); err != nil {
+			return fmt.Errorf("%s: %w", o.file, err)
+		}
+	}
+	return nil
+}
+
+// writeRecentCSV writes readings as sensor_id,value,updated_ts rows.
+func writeRecentCSV(path, format string, readings []model.Reading) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	b.WriteString("sensor_id,value,updated_ts\n")
+	for _, r := range readings {
+		fmt.Fprintf(&b, "%s,"+format+",%d\n", r.SensorID, r.Value, r.Timestamp.Unix())
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/ingest"
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+func testParams() params {
+	return params{
+		Start:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Days:            30,
+		Step:            15 * time.Minute,
+		PVPeakW:         6000,
+		BaseLoadW:       400,
+		HeatPumpWPerK:   heatPumpProfiles["medium"],
+		PriceVolatility: 0.4,
+		Seed:            3,
+	}
+}
+
+// loadDataset reads every generated file back through RecentParser.
+func loadDataset(t *testing.T, dir string) *store.Store {
+	t.Helper()
+	s := store.New()
+	for _, o := range outputs {
+		f, err := os.Open(filepath.Join(dir, o.file))
+		require.NoError(t, err)
+		readings, err := (&ingest.RecentParser{}).Parse(f)
+		f.Close()
+		require.NoError(t, err)
+		require.NotEmpty(t, readings, o.file)
+		s.AddSensor(model.Sensor{ID: readings[0].SensorID, Type: o.sensor, Unit: readings[0].Unit})
+		s.AddReadings(readings)
+	}
+	return s
+}
+
+func TestGenerate_LoadsBackAndCoversRange(t *testing.T) {
+	p := testParams()
+	dir := t.TempDir()
+	require.NoError(t, writeDataset(dir, generate(p)))
+	s := loadDataset(t, dir)
+
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+	end := p.Start.AddDate(0, 0, p.Days)
+	assert.Equal(t, p.Start, tr.Start)
+	assert.Equal(t, end.Add(-p.Step), tr.End)
+
+	for _, o := range outputs {
+		id := model.SensorHomeAssistantID[o.sensor]
+		want := p.Days * 24 * int(time.Hour/p.Step)
+		if o.sensor == model.SensorEnergyPrice {
+			want = p.Days * 24
+		}
+		assert.Equal(t, want, s.ReadingCount(id), o.file)
+	}
+
+	// The same seed replays the same files.
+	again := t.TempDir()
+	require.NoError(t, writeDataset(again, generate(p)))
+	for _, o := range outputs {
+		a, err := os.ReadFile(filepath.Join(dir, o.file))
+		require.NoError(t, err)
+		b, err := os.ReadFile(filepath.Join(again, o.file))
+		require.NoError(t, err)
+		assert.Equal(t, a, b, o.file)
+	}
+}
+
+func TestGenerate_CorrelatedSeries(t *testing.T) {
+	p := testParams()
+	p.Start = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) // heating and some sun
+	data := generate(p)
+
+	type dayTotals struct{ tempC, heatWh, pvWh float64 }
+	days := make(map[string]*dayTotals)
+	get := func(ts time.Time) *dayTotals {
+		key := ts.Format("2006-01-02")
+		if days[key] == nil {
+			days[key] = &dayTotals{}
+		}
+		return days[key]
+	}
+	stepH := p.Step.Hours()
+	samples := 24 / stepH
+	for _, r := range data[model.SensorPumpExtTemp] {
+		get(r.Timestamp).tempC += r.Value / samples
+	}
+	for _, r := range data[model.SensorPumpHeatPower] {
+		get(r.Timestamp).heatWh += r.Value * stepH
+	}
+	for _, r := range data[model.SensorPVPower] {
+		get(r.Timestamp).pvWh += r.Value * stepH
+		if h := r.Timestamp.Hour(); h < 4 || h >= 21 {
+			assert.Zero(t, r.Value, "no PV at night")
+		}
+	}
+
+	var coldest, warmest, sunniest, dullest *dayTotals
+	for _, d := range days {
+		if coldest == nil || d.tempC < coldest.tempC {
+			coldest = d
+		}
+		if warmest == nil || d.tempC > warmest.tempC {
+			warmest = d
+		}
+		if sunniest == nil || d.pvWh > sunniest.pvWh {
+			sunniest = d
+		}
+		if dullest == nil || d.pvWh < dullest.pvWh {
+			dullest = d
+		}
+	}
+	assert.Greater(t, coldest.heatWh, warmest.heatWh, "cold days heat more")
+	assert.Greater(t, sunniest.pvWh, 2*dullest.pvWh, "sunny days produce more PV")
+
+	// Grid power balances load, heat pump and PV at every sample.
+	grid, pv, hp := data[model.SensorGridPower], data[model.SensorPVPower], data[model.SensorPumpHeatPower]
+	for i := range grid {
+		load := grid[i].Value - hp[i].Value + pv[i].Value
+		assert.GreaterOrEqual(t, load, 0.2*p.BaseLoadW-1e-9)
+	}
+}
+
+func TestGenerate_NoHeatPump(t *testing.T) {
+	p := testParams()
+	p.Days = 3
+	p.HeatPumpWPerK = heatPumpProfiles["none"]
+	for _, r := range generate(p)[model.SensorPumpHeatPower] {
+		assert.Zero(t, r.Value)
+	}
+}
@@ -0,0 +1,189 @@
+// Command gen-ws-schema emits a JSON Schema for the WebSocket message
+// contract by reflecting over the payload structs in internal/ws.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"energy_simulator/internal/ws"
+)
+
+// message describes one envelope type and its payload. A nil payload means
+// the message carries none.
+type message struct {
+	typ       string
+	direction string // "client" (client -> server) or "server"
+	payload   any
+}
+
+// messages lists every ws.Type* constant. A test checks it against
+// messages.go so new message types cannot be missed.
+var messages = []message{
+	{ws.TypeSimStart, "client", nil},
+	{ws.TypeSimPause, "client", nil},
+	{ws.TypeSimSetSpeed, "client", ws.SetSpeedPayload{}},
+	{ws.TypeSimFinishIn, "client", ws.FinishInPayload{}},
+	{ws.TypeSimSeek, "client", ws.SeekPayload{}},
+	{ws.TypeSimSetSource, "client", ws.SetSourcePayload{}},
+	{ws.TypeBatteryConfig, "client", ws.BatteryConfigPayload{}},
+	{ws.TypeSimSetPrediction, "client", ws.SetPredictionPayload{}},
+	{ws.TypeConfigUpdate, "client", ws.ConfigUpdatePayload{}},
+	{ws.TypePVConfig, "client", ws.PVConfigPayload{}},
+	{ws.TypePVOptimize, "client", ws.PVOptimizePayload{}},
+	{ws.TypeDataOverview, "client", ws.DataOverviewPayload{}},
+	{ws.TypeRangeSave, "client", ws.RangeSavePayload{}},
+	{ws.TypeRangeList, "client", nil},
+	{ws.TypeSummaryRange, "client", ws.SummaryRangePayload{}},
+	{ws.TypeCompareConfig, "client", ws.CompareConfigPayload{}},
+
+	{ws.TypeSimState, "server", ws.SimStatePayload{}},
+	{ws.TypeSensorReading, "server", ws.SensorReadingPayload{}},
+	{ws.TypeSummaryUpdate, "server", ws.SummaryPayload{}},
+	{ws.TypeDataLoaded, "server", ws.DataLoadedPayload{}},
+	{ws.TypeBatteryUpdate, "server", ws.BatteryUpdatePayload{}},
+	{ws.TypeBatterySummary, "server", ws.BatterySummaryPayload{}},
+	{ws.TypeArbitrageDayLog, "server", ws.ArbitrageDayLogPayload{}},
+	{ws.TypePredictionComparison, "server", ws.PredictionComparisonPayload{}},
+	{ws.TypeHeatingStats, "server", []ws.HeatingMonthStatPayload{}},
+	{ws.TypeAnomalyDays, "server", []ws.AnomalyDayPayload{}},
+	{ws.TypeLoadShiftStats, "server", ws.LoadShiftStatsPayload{}},
+	{ws.TypeHPDiagnostics, "server", ws.HPDiagnosticsPayload{}},
+	{ws.TypePowerQuality, "server", ws.PowerQualityPayload{}},
+	{ws.TypePVOptimization, "server", ws.PVOptimizationPayload{}},
+	{ws.TypeDataOverviewResult, "server", ws.DataOverviewResultPayload{}},
+	{ws.TypeRangeListResult, "server", ws.RangeListResultPayload{}},
+	{ws.TypeSummaryRangeResult, "server", ws.SummaryRangeResultPayload{}},
+	{ws.TypeApplianceCosts, "server", []ws.ApplianceCostPayload{}},
+	{ws.TypeStrategyComparison, "server", ws.StrategyComparisonPayload{}},
+	{ws.TypeDailySummary, "server", ws.PeriodSummaryPayload{}},
+	{ws.TypeMonthlySummary, "server", ws.PeriodSummaryPayload{}},
+	{ws.TypeEventLog, "server", ws.EventPayload{}},
+	{ws.TypeFlowSankey, "server", ws.FlowSankeyPayload{}},
+	{ws.TypeConfigComparison, "server", ws.ConfigComparisonPayload{}},
+	{ws.TypeCostMonthly, "server", []ws.MonthlyCostPayload{}},
+}
+
+func main() {
+	outPath := flag.String("out", "", "write the schema to this file instead of stdout")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(generate(messages), "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding schema: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *outPath == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*outPath, data, 0644); err != nil {
+		log.Fatalf("Error writing %s: %v", *outPath, err)
+	}
+}
+
+type schema = map[string]any
+
+// generate returns a JSON Schema matching any envelope in msgs. Each message
+// is a oneOf branch pinning "type" to its constant; payload structs are
+// shared through $defs, named after their Go type.
+func generate(msgs []message) schema {
+	defs := make(map[string]schema)
+	var branches []schema
+	for _, m := range msgs {
+		props := schema{"type": schema{"const": m.typ}}
+		required := []string{"type"}
+		if m.payload != nil {
+			props["payload"] = typeSchema(reflect.TypeOf(m.payload), defs)
+			required = append(required, "payload")
+		}
+		branches = append(branches, schema{
+			"title":       m.typ,
+			"description": m.direction + " message",
+			"type":        "object",
+			"properties":  props,
+			"required":    required,
+		})
+	}
+	return schema{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "Energy simulator WebSocket messages",
+		"oneOf":   branches,
+		"$defs":   defs,
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeSchema maps a Go type to its JSON Schema, registering named structs in
+// defs and returning a $ref to them.
+func typeSchema(t reflect.Type, defs map[string]schema) schema {
+	if t == timeType {
+		return schema{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return schema{} // json.RawMessage: arbitrary JSON
+		}
+		return schema{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, defs)
+		}
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // guard against recursive types
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return schema{"$ref": "#/$defs/" + t.Name()}
+	}
+	return schema{}
+}
+
+// structSchema describes a struct's JSON fields. Fields without omitempty are
+// required, matching what encoding/json always emits.
+func structSchema(t reflect.Type, defs map[string]schema) schema {
+	props := schema{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = typeSchema(f.Type, defs)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	s := schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip encodes the generated schema and decodes it back into plain maps,
+// the shape a client would load.
+func roundTrip(t *testing.T) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(generate(messages))
+	require.NoError(t, err)
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(data, &out))
+	return out
+}
+
+func TestGenerate_SummaryPayload(t *testing.T) {
+	s := roundTrip(t)
+	defs := s["$defs"].(map[string]any)
+	summary := defs["SummaryPayload"].(map[string]any)
+	props := summary["properties"].(map[string]any)
+
+	assert.Equal(t, map[string]any{"type": "number"}, props["net_cost_pln"])
+	assert.Equal(t, map[string]any{"type": "boolean"}, props["arb_spread_profitable"])
+	assert.Contains(t, summary["required"], "net_cost_pln")
+	assert.NotContains(t, summary["required"], "thermal_rmse_c", "omitempty fields are optional")
+
+	// Maps and nested structs
+	assert.Equal(t, map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "number"}}, props["counters"])
+	assert.Equal(t, "#/$defs/PVArrayProdPayload", props["pv_array_production"].(map[string]any)["items"].(map[string]any)["$ref"])
+	assert.Contains(t, defs, "PVArrayProdPayload")
+}
+
+func TestGenerate_Envelopes(t *testing.T) {
+	s := roundTrip(t)
+	branches := s["oneOf"].([]any)
+	require.Len(t, branches, len(messages))
+
+	byType := map[string]map[string]any{}
+	for _, b := range branches {
+		branch := b.(map[string]any)
+		props := branch["properties"].(map[string]any)
+		byType[props["type"].(map[string]any)["const"].(string)] = props
+	}
+	assert.Equal(t, "#/$defs/SummaryPayload", byType["summary:update"]["payload"].(map[string]any)["$ref"])
+	assert.NotContains(t, byType["sim:start"], "payload")
+	assert.Equal(t, "array", byType["heating:stats"]["payload"].(map[string]any)["type"])
+}
+
+// TestMessagesCoverAllTypes keeps the message list in sync with the Type*
+// constants declared in messages.go.
+func TestMessagesCoverAllTypes(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "../../internal/ws/messages.go", nil, 0)
+	require.NoError(t, err)
+
+	var declared []string
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if !strings.HasPrefix(name.Name, "Type") || i >= len(vs.Values) {
+					continue
+				}
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				require.True(t, ok, name.Name)
+				v, err := strconv.Unquote(lit.Value)
+				require.NoError(t, err)
+				declared = append(declared, v)
+			}
+		}
+	}
+	require.NotEmpty(t, declared)
+
+	var listed []string
+	for _, m := range messages {
+		listed = append(listed, m.typ)
+	}
+	assert.ElementsMatch(t, declared, listed)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -17,15 +16,10 @@ import (
 	"strings"
 	"time"
 
+	"energy_simulator/internal/ingest"
 	"energy_simulator/internal/model"
 )
 
-type record struct {
-	sensorID string
-	value    float64
-	ts       float64 // unix epoch seconds
-}
-
 // weekKey returns the ISO week string for a unix timestamp, e.g. "2026-W07".
 func weekKey(ts float64) string {
 	t := time.Unix(int64(ts), int64((ts-float64(int64(ts)))*1e9))
@@ -38,99 +32,198 @@ func main() {
 	tokenFlag := flag.String("token", "", "Long-lived access token (overrides HA_TOKEN)")
 	outputDir := flag.String("output", "input/recent", "Output directory for weekly CSV files")
 	sinceFlag := flag.String("since", "", "Force fetch from this date (YYYY-MM-DD), ignoring existing timestamps")
+	sensorsFlag := flag.String("sensors", "", "Comma-separated sensor types (e.g. grid_voltage) or HA entity IDs to fetch (default: all)")
+	dryRun := flag.Bool("dry-run", false, "Print the time windows, entity IDs and weekly files that would be fetched, then exit")
 	flag.Parse()
 
 	loadDotEnv(".env")
 
 	haURL := resolveFlag(*urlFlag, "HA_URL")
 	haToken := resolveFlag(*tokenFlag, "HA_TOKEN")
-	if haURL == "" {
-		log.Fatal("HA_URL not set — use -url flag or set HA_URL in .env")
-	}
-	if haToken == "" {
-		log.Fatal("HA_TOKEN not set — use -token flag or set HA_TOKEN in .env")
+	if !*dryRun {
+		if haURL == "" {
+			log.Fatal("HA_URL not set — use -url flag or set HA_URL in .env")
+		}
+		if haToken == "" {
+			log.Fatal("HA_TOKEN not set — use -token flag or set HA_TOKEN in .env")
+		}
 	}
 	haURL = strings.TrimRight(haURL, "/")
 
-	entityIDs := collectEntityIDs()
+	entityIDs, err := selectEntityIDs(*sensorsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
 	if len(entityIDs) == 0 {
 		log.Fatal("no entity IDs found in model.SensorHomeAssistantID")
 	}
 
-	existing, earliestTS, latestTS := loadExistingDir(*outputDir)
-
-	endTime := time.Now()
-	client := &http.Client{Timeout: 30 * time.Second}
-	entityIDStr := strings.Join(entityIDs, ",")
-
-	var newRecords []record
-
-	// If -since is set, skip normal backfill/forward logic and fetch everything from that date
+	var since time.Time
 	if *sinceFlag != "" {
-		sinceTime, err := time.ParseInLocation("2006-01-02", *sinceFlag, time.Now().Location())
+		t, err := time.ParseInLocation("2006-01-02", *sinceFlag, time.Now().Location())
 		if err != nil {
 			log.Fatalf("invalid -since date %q: %v", *sinceFlag, err)
 		}
-		log.Printf("forced re-fetch from %s to %s", sinceTime.Format("2006-01-02"), endTime.Format("2006-01-02"))
-		fetched, err := fetchRange(client, haURL, haToken, sinceTime, endTime, entityIDStr)
-		if err != nil {
-			log.Fatalf("fetch: %v", err)
+		since = t
+	}
+
+	opts := runOptions{
+		baseURL:   haURL,
+		token:     haToken,
+		outputDir: *outputDir,
+		entityIDs: entityIDs,
+		since:     since,
+		now:       time.Now(),
+		dryRun:    *dryRun,
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	if err := run(opts, client, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runOptions holds the resolved command-line configuration.
+type runOptions struct {
+	baseURL, token string
+	outputDir      string
+	entityIDs      []string
+	since          time.Time // zero = incremental backfill/forward fetch
+	now            time.Time
+	dryRun         bool
+}
+
+// fetchWindow is one time range to request from the history API.
+type fetchWindow struct {
+	label      string
+	start, end time.Time
+}
+
+// planWindows returns the ranges to fetch. With since set, everything from
+// since to now is re-fetched. Otherwise data before the earliest existing
+// record is backfilled (up to 2 years back) and data after the latest is
+// fetched forward; on first run a single 2-year window is used.
+func planWindows(since, now time.Time, earliestTS, latestTS float64) []fetchWindow {
+	if !since.IsZero() {
+		return []fetchWindow{{label: "forced re-fetch", start: since, end: now}}
+	}
+
+	var windows []fetchWindow
+	backfillStart := now.AddDate(-2, 0, 0) // 2 years back — HA returns empty for missing periods
+	if earliestTS > 0 {
+		backfillEnd := time.Unix(int64(earliestTS), 0).Add(1 * time.Minute)
+		if backfillStart.Before(backfillEnd) {
+			windows = append(windows, fetchWindow{label: "backfill", start: backfillStart, end: backfillEnd})
 		}
-		newRecords = fetched
+	}
+
+	if latestTS > 0 {
+		start := time.Unix(int64(latestTS), 0).Add(-1 * time.Minute)
+		windows = append(windows, fetchWindow{label: "forward", start: start, end: now})
 	} else {
-		// Backfill: fetch data before the earliest existing record
-		backfillStart := endTime.AddDate(-2, 0, 0) // 2 years back — HA returns empty for missing periods
-		if earliestTS > 0 {
-			backfillEnd := time.Unix(int64(earliestTS), 0).Add(1 * time.Minute)
-			if backfillStart.Before(backfillEnd) {
-				log.Printf("backfilling from %s to %s", backfillStart.Format("2006-01-02"), backfillEnd.Format("2006-01-02"))
-				backfill, err := fetchRange(client, haURL, haToken, backfillStart, backfillEnd, entityIDStr)
-				if err != nil {
-					log.Fatalf("backfill: %v", err)
-				}
-				newRecords = append(newRecords, backfill...)
-			}
+		windows = append(windows, fetchWindow{label: "first run", start: backfillStart, end: now})
+	}
+	return windows
+}
+
+// weeksInWindow returns the ISO week keys a window spans, in order.
+func weeksInWindow(w fetchWindow) []string {
+	var weeks []string
+	seen := make(map[string]bool)
+	add := func(t time.Time) {
+		wk := weekKey(float64(t.Unix()))
+		if !seen[wk] {
+			seen[wk] = true
+			weeks = append(weeks, wk)
 		}
+	}
+	for day := w.start; day.Before(w.end); day = day.Add(24 * time.Hour) {
+		add(day)
+	}
+	if w.end.After(w.start) {
+		add(w.end.Add(-time.Second))
+	}
+	return weeks
+}
+
+// printDryRun describes what a fetch would do without contacting the API.
+func printDryRun(out io.Writer, dir string, windows []fetchWindow, entityIDs []string) {
+	fmt.Fprintf(out, "Dry run — nothing will be fetched or written\n\n")
+	fmt.Fprintf(out, "Time windows (%d):\n", len(windows))
+	for _, w := range windows {
+		fmt.Fprintf(out, "  %-16s %s → %s\n", w.label, w.start.Format(time.RFC3339), w.end.Format(time.RFC3339))
+	}
+
+	fmt.Fprintf(out, "\nEntity IDs (%d):\n", len(entityIDs))
+	for _, id := range entityIDs {
+		fmt.Fprintf(out, "  %s\n", id)
+	}
 
-		// Forward: fetch new data from latest timestamp onward (or from 2 years ago on first run)
-		var startTime time.Time
-		if latestTS > 0 {
-			startTime = time.Unix(int64(latestTS), 0).Add(-1 * time.Minute)
-			log.Printf("fetching new data from %s", startTime.Format(time.RFC3339))
-		} else {
-			startTime = backfillStart
-			log.Printf("first run — fetching all available data from %s", startTime.Format("2006-01-02"))
+	seen := make(map[string]bool)
+	var weeks []string
+	for _, w := range windows {
+		for _, wk := range weeksInWindow(w) {
+			if !seen[wk] {
+				seen[wk] = true
+				weeks = append(weeks, wk)
+			}
+		}
+	}
+	sort.Strings(weeks)
+	fmt.Fprintf(out, "\nWeekly files that may be touched (%d):\n", len(weeks))
+	for _, wk := range weeks {
+		path := filepath.Join(dir, wk+".csv")
+		status := "new"
+		if _, err := os.Stat(path); err == nil {
+			status = "merge"
 		}
+		fmt.Fprintf(out, "  %-40s %s\n", path, status)
+	}
+}
+
+// run fetches the planned windows and merges them into the weekly CSV files,
+// or only describes the plan when opts.dryRun is set.
+func run(opts runOptions, client *http.Client, out io.Writer) error {
+	existing, earliestTS, latestTS := loadExistingDir(opts.outputDir)
+	windows := planWindows(opts.since, opts.now, earliestTS, latestTS)
+
+	if opts.dryRun {
+		printDryRun(out, opts.outputDir, windows, opts.entityIDs)
+		return nil
+	}
 
-		forward, err := fetchRange(client, haURL, haToken, startTime, endTime, entityIDStr)
+	entityIDStr := strings.Join(opts.entityIDs, ",")
+	var newRecords []ingest.Record
+	for _, w := range windows {
+		log.Printf("%s: fetching %s to %s", w.label, w.start.Format(time.RFC3339), w.end.Format(time.RFC3339))
+		fetched, err := fetchRange(client, opts.baseURL, opts.token, w.start, w.end, entityIDStr)
 		if err != nil {
-			log.Fatalf("fetch: %v", err)
+			return fmt.Errorf("%s: %w", w.label, err)
 		}
-		newRecords = append(newRecords, forward...)
+		newRecords = append(newRecords, fetched...)
 	}
 
 	if len(newRecords) == 0 {
 		log.Printf("no new records fetched")
-		return
+		return nil
 	}
 
 	// Group new records by week
 	newByWeek := groupByWeek(newRecords)
 
 	// Merge with existing and write only affected week files
-	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
-		log.Fatalf("creating output directory: %v", err)
+	if err := os.MkdirAll(opts.outputDir, 0o755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
 	}
 
 	totalExisting := len(existing)
 	totalWritten := 0
 	filesWritten := 0
 	for week, newWeekRecords := range newByWeek {
-		path := filepath.Join(*outputDir, week+".csv")
+		path := filepath.Join(opts.outputDir, week+".csv")
 		existingWeek := loadCSVFile(path)
-		merged := mergeRecords(existingWeek, newWeekRecords)
+		merged := ingest.MergeRecords(existingWeek, newWeekRecords)
 		if err := writeCSV(path, merged); err != nil {
-			log.Fatalf("writing %s: %v", path, err)
+			return fmt.Errorf("writing %s: %w", path, err)
 		}
 		totalWritten += len(merged)
 		filesWritten++
@@ -142,7 +235,7 @@ func main() {
 	// Per-sensor summary
 	sensorCounts := make(map[string]int)
 	for _, r := range newRecords {
-		sensorCounts[r.sensorID]++
+		sensorCounts[r.SensorID]++
 	}
 	var sensorIDs []string
 	for sid := range sensorCounts {
@@ -159,6 +252,7 @@ func main() {
 		}
 		log.Printf("  %-35s %5d records", name, sensorCounts[sid])
 	}
+	return nil
 }
 
 // loadDotEnv reads a .env file and sets variables not already in the environment.
@@ -203,8 +297,40 @@ func collectEntityIDs() []string {
 	return ids
 }
 
+// selectEntityIDs returns the entity IDs named by filter, a comma-separated
+// list of sensor type slugs or Home Assistant entity IDs from the catalog.
+// An empty filter selects every known entity.
+func selectEntityIDs(filter string) ([]string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return collectEntityIDs(), nil
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, name := range strings.Split(filter, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		entityID, ok := model.SensorHomeAssistantID[model.SensorType(name)]
+		if !ok {
+			if _, known := model.HAEntityToSensorType[name]; !known {
+				return nil, fmt.Errorf("unknown sensor %q: expected a sensor type (e.g. %s) or a Home Assistant entity ID from the catalog",
+					name, model.SensorGridPower)
+			}
+			entityID = name
+		}
+		if !seen[entityID] {
+			seen[entityID] = true
+			ids = append(ids, entityID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
 // loadExistingDir scans all CSV files in the output directory to find earliest/latest timestamps.
-func loadExistingDir(dir string) (allRecords []record, earliestTS, latestTS float64) {
+func loadExistingDir(dir string) (allRecords []ingest.Record, earliestTS, latestTS float64) {
 	matches, err := filepath.Glob(filepath.Join(dir, "*.csv"))
 	if err != nil || len(matches) == 0 {
 		return nil, 0, 0
@@ -213,11 +339,11 @@ func loadExistingDir(dir string) (allRecords []record, earliestTS, latestTS floa
 	for _, path := range matches {
 		records := loadCSVFile(path)
 		for _, r := range records {
-			if r.ts > latestTS {
-				latestTS = r.ts
+			if r.TS > latestTS {
+				latestTS = r.TS
 			}
-			if earliestTS == 0 || r.ts < earliestTS {
-				earliestTS = r.ts
+			if earliestTS == 0 || r.TS < earliestTS {
+				earliestTS = r.TS
 			}
 		}
 		allRecords = append(allRecords, records...)
@@ -226,59 +352,33 @@ func loadExistingDir(dir string) (allRecords []record, earliestTS, latestTS floa
 	return allRecords, earliestTS, latestTS
 }
 
-func loadCSVFile(path string) []record {
+// loadCSVFile reads one weekly CSV file, returning nil if it is missing or
+// unreadable.
+func loadCSVFile(path string) []ingest.Record {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil
 	}
 	defer f.Close()
 
-	cr := csv.NewReader(f)
-	// skip header
-	if _, err := cr.Read(); err != nil {
+	records, _, err := ingest.ReadRecords(f)
+	if err != nil {
 		return nil
 	}
-
-	var records []record
-	for {
-		row, err := cr.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil || len(row) < 3 {
-			continue
-		}
-
-		value, err := strconv.ParseFloat(row[1], 64)
-		if err != nil {
-			continue
-		}
-		ts, err := strconv.ParseFloat(row[2], 64)
-		if err != nil {
-			continue
-		}
-
-		records = append(records, record{
-			sensorID: row[0],
-			value:    value,
-			ts:       ts,
-		})
-	}
-
 	return records
 }
 
-func groupByWeek(records []record) map[string][]record {
-	byWeek := make(map[string][]record)
+func groupByWeek(records []ingest.Record) map[string][]ingest.Record {
+	byWeek := make(map[string][]ingest.Record)
 	for _, r := range records {
-		wk := weekKey(r.ts)
+		wk := weekKey(r.TS)
 		byWeek[wk] = append(byWeek[wk], r)
 	}
 	return byWeek
 }
 
-func fetchRange(client *http.Client, baseURL, token string, start, end time.Time, entityIDs string) ([]record, error) {
-	var allRecords []record
+func fetchRange(client *http.Client, baseURL, token string, start, end time.Time, entityIDs string) ([]ingest.Record, error) {
+	var allRecords []ingest.Record
 	for day := start; day.Before(end); day = day.Add(24 * time.Hour) {
 		dayEnd := day.Add(24 * time.Hour)
 		if dayEnd.After(end) {
@@ -303,7 +403,7 @@ func fetchRange(client *http.Client, baseURL, token string, start, end time.Time
 	return allRecords, nil
 }
 
-func fetchDay(client *http.Client, baseURL, token string, start, end time.Time, entityIDs string) ([]record, error) {
+func fetchDay(client *http.Client, baseURL, token string, start, end time.Time, entityIDs string) ([]ingest.Record, error) {
 	url := fmt.Sprintf("%s/api/history/period/%s?end_time=%s&filter_entity_id=%s&minimal_response&no_attributes",
 		baseURL,
 		start.UTC().Format(time.RFC3339),
@@ -380,13 +480,13 @@ func doRequest(client *http.Client, url, token string) ([]byte, error) {
 // parseHistoryResponse parses the HA history API response.
 // Format: array of arrays. Each inner array is one entity's history.
 // With minimal_response, only the first entry has entity_id.
-func parseHistoryResponse(data []byte) ([]record, error) {
+func parseHistoryResponse(data []byte) ([]ingest.Record, error) {
 	var outer [][]json.RawMessage
 	if err := json.Unmarshal(data, &outer); err != nil {
 		return nil, fmt.Errorf("parsing JSON: %w", err)
 	}
 
-	var records []record
+	var records []ingest.Record
 	for _, entityHistory := range outer {
 		var currentEntityID string
 		for i, raw := range entityHistory {
@@ -430,10 +530,10 @@ func parseHistoryResponse(data []byte) ([]record, error) {
 				}
 			}
 
-			records = append(records, record{
-				sensorID: currentEntityID,
-				value:    value,
-				ts:       float64(ts.UnixNano()) / 1e9,
+			records = append(records, ingest.Record{
+				SensorID: currentEntityID,
+				Value:    value,
+				TS:       float64(ts.UnixNano()) / 1e9,
 			})
 		}
 	}
@@ -441,57 +541,14 @@ func parseHistoryResponse(data []byte) ([]record, error) {
 	return records, nil
 }
 
-func mergeRecords(existing, new []record) []record {
-	type key struct {
-		sensorID string
-		ts       float64
-	}
-
-	seen := make(map[key]record, len(existing)+len(new))
-	for _, r := range existing {
-		seen[key{r.sensorID, r.ts}] = r
-	}
-	for _, r := range new {
-		seen[key{r.sensorID, r.ts}] = r // new overwrites existing on conflict
-	}
-
-	merged := make([]record, 0, len(seen))
-	for _, r := range seen {
-		merged = append(merged, r)
-	}
-
-	sort.Slice(merged, func(i, j int) bool {
-		if merged[i].sensorID != merged[j].sensorID {
-			return merged[i].sensorID < merged[j].sensorID
-		}
-		return merged[i].ts < merged[j].ts
-	})
-
-	return merged
-}
-
-func writeCSV(path string, records []record) error {
+func writeCSV(path string, records []ingest.Record) error {
 	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	w := csv.NewWriter(f)
-	if err := w.Write([]string{"sensor_id", "value", "updated_ts"}); err != nil {
+	if err := ingest.WriteRecords(f, records); err != nil {
+		f.Close()
 		return err
 	}
-
-	for _, r := range records {
-		if err := w.Write([]string{
-			r.sensorID,
-			strconv.FormatFloat(r.value, 'f', -1, 64),
-			strconv.FormatFloat(r.ts, 'f', 7, 64),
-		}); err != nil {
-			return err
-		}
-	}
-
-	w.Flush()
-	return w.Error()
+	return f.Close()
 }
@@ -4,15 +4,21 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/ingest"
+	"energy_simulator/internal/model"
 )
 
 func TestParseHistoryResponse(t *testing.T) {
@@ -35,17 +41,17 @@ func TestParseHistoryResponse(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, records, 4)
 
-	assert.Equal(t, "sensor.0x943469fffed2bf71_power", records[0].sensorID)
-	assert.Equal(t, 150.5, records[0].value)
+	assert.Equal(t, "sensor.0x943469fffed2bf71_power", records[0].SensorID)
+	assert.Equal(t, 150.5, records[0].Value)
 
-	assert.Equal(t, "sensor.0x943469fffed2bf71_power", records[1].sensorID)
-	assert.Equal(t, 200.3, records[1].value)
+	assert.Equal(t, "sensor.0x943469fffed2bf71_power", records[1].SensorID)
+	assert.Equal(t, 200.3, records[1].Value)
 
-	assert.Equal(t, "sensor.hoymiles_gateway_solarh_3054300_real_power", records[2].sensorID)
-	assert.Equal(t, 1200.0, records[2].value)
+	assert.Equal(t, "sensor.hoymiles_gateway_solarh_3054300_real_power", records[2].SensorID)
+	assert.Equal(t, 1200.0, records[2].Value)
 
-	assert.Equal(t, "sensor.hoymiles_gateway_solarh_3054300_real_power", records[3].sensorID)
-	assert.Equal(t, 1350.7, records[3].value)
+	assert.Equal(t, "sensor.hoymiles_gateway_solarh_3054300_real_power", records[3].SensorID)
+	assert.Equal(t, 1350.7, records[3].Value)
 }
 
 func TestSkipUnavailable(t *testing.T) {
@@ -65,8 +71,8 @@ func TestSkipUnavailable(t *testing.T) {
 	records, err := parseHistoryResponse(data)
 	require.NoError(t, err)
 	assert.Len(t, records, 2)
-	assert.Equal(t, 150.5, records[0].value)
-	assert.Equal(t, 300.0, records[1].value)
+	assert.Equal(t, 150.5, records[0].Value)
+	assert.Equal(t, 300.0, records[1].Value)
 }
 
 func TestMinimalResponse(t *testing.T) {
@@ -87,41 +93,41 @@ func TestMinimalResponse(t *testing.T) {
 	assert.Len(t, records, 3)
 
 	for _, r := range records {
-		assert.Equal(t, "sensor.0x943469fffed2bf71_power", r.sensorID)
+		assert.Equal(t, "sensor.0x943469fffed2bf71_power", r.SensorID)
 	}
-	assert.Equal(t, 100.0, records[0].value)
-	assert.Equal(t, 200.0, records[1].value)
-	assert.Equal(t, 300.0, records[2].value)
+	assert.Equal(t, 100.0, records[0].Value)
+	assert.Equal(t, 200.0, records[1].Value)
+	assert.Equal(t, 300.0, records[2].Value)
 }
 
 func TestIncrementalMerge(t *testing.T) {
-	existing := []record{
-		{sensorID: "sensor.a", value: 100, ts: 1000},
-		{sensorID: "sensor.a", value: 200, ts: 2000},
-		{sensorID: "sensor.b", value: 50, ts: 1500},
+	existing := []ingest.Record{
+		{SensorID: "sensor.a", Value: 100, TS: 1000},
+		{SensorID: "sensor.a", Value: 200, TS: 2000},
+		{SensorID: "sensor.b", Value: 50, TS: 1500},
 	}
 
-	newRecords := []record{
-		{sensorID: "sensor.a", value: 200, ts: 2000}, // duplicate — same key
-		{sensorID: "sensor.a", value: 300, ts: 3000}, // new
-		{sensorID: "sensor.b", value: 75, ts: 2500},  // new
+	newRecords := []ingest.Record{
+		{SensorID: "sensor.a", Value: 200, TS: 2000}, // duplicate — same key
+		{SensorID: "sensor.a", Value: 300, TS: 3000}, // new
+		{SensorID: "sensor.b", Value: 75, TS: 2500},  // new
 	}
 
-	merged := mergeRecords(existing, newRecords)
+	merged := ingest.MergeRecords(existing, newRecords)
 
 	assert.Len(t, merged, 5)
 
 	// Verify sorted by (sensorID, ts)
-	assert.Equal(t, "sensor.a", merged[0].sensorID)
-	assert.Equal(t, 1000.0, merged[0].ts)
-	assert.Equal(t, "sensor.a", merged[1].sensorID)
-	assert.Equal(t, 2000.0, merged[1].ts)
-	assert.Equal(t, "sensor.a", merged[2].sensorID)
-	assert.Equal(t, 3000.0, merged[2].ts)
-	assert.Equal(t, "sensor.b", merged[3].sensorID)
-	assert.Equal(t, 1500.0, merged[3].ts)
-	assert.Equal(t, "sensor.b", merged[4].sensorID)
-	assert.Equal(t, 2500.0, merged[4].ts)
+	assert.Equal(t, "sensor.a", merged[0].SensorID)
+	assert.Equal(t, 1000.0, merged[0].TS)
+	assert.Equal(t, "sensor.a", merged[1].SensorID)
+	assert.Equal(t, 2000.0, merged[1].TS)
+	assert.Equal(t, "sensor.a", merged[2].SensorID)
+	assert.Equal(t, 3000.0, merged[2].TS)
+	assert.Equal(t, "sensor.b", merged[3].SensorID)
+	assert.Equal(t, 1500.0, merged[3].TS)
+	assert.Equal(t, "sensor.b", merged[4].SensorID)
+	assert.Equal(t, 2500.0, merged[4].TS)
 }
 
 func TestLoadDotEnv(t *testing.T) {
@@ -183,8 +189,8 @@ func TestFetchDay(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.Len(t, records, 2)
-	assert.Equal(t, 500.0, records[0].value)
-	assert.Equal(t, 600.0, records[1].value)
+	assert.Equal(t, 500.0, records[0].Value)
+	assert.Equal(t, 600.0, records[1].Value)
 }
 
 func TestFetchDayAuth401(t *testing.T) {
@@ -209,12 +215,12 @@ func TestLoadExistingDir(t *testing.T) {
 	dir := t.TempDir()
 
 	// Write two week files
-	writeTestCSV(t, filepath.Join(dir, "2026-W06.csv"), []record{
-		{sensorID: "sensor.a", value: 100, ts: 1000},
-		{sensorID: "sensor.a", value: 200, ts: 2000},
+	writeTestCSV(t, filepath.Join(dir, "2026-W06.csv"), []ingest.Record{
+		{SensorID: "sensor.a", Value: 100, TS: 1000},
+		{SensorID: "sensor.a", Value: 200, TS: 2000},
 	})
-	writeTestCSV(t, filepath.Join(dir, "2026-W07.csv"), []record{
-		{sensorID: "sensor.b", value: 50, ts: 3000},
+	writeTestCSV(t, filepath.Join(dir, "2026-W07.csv"), []ingest.Record{
+		{SensorID: "sensor.b", Value: 50, TS: 3000},
 	})
 
 	records, minTS, maxTS := loadExistingDir(dir)
@@ -248,10 +254,10 @@ func TestGroupByWeek(t *testing.T) {
 	week1ts := float64(time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC).Unix()) // Monday W02
 	week2ts := float64(time.Date(2025, 1, 13, 10, 0, 0, 0, time.UTC).Unix()) // Monday W03
 
-	records := []record{
-		{sensorID: "sensor.a", value: 100, ts: week1ts},
-		{sensorID: "sensor.a", value: 200, ts: week1ts + 3600},
-		{sensorID: "sensor.a", value: 300, ts: week2ts},
+	records := []ingest.Record{
+		{SensorID: "sensor.a", Value: 100, TS: week1ts},
+		{SensorID: "sensor.a", Value: 200, TS: week1ts + 3600},
+		{SensorID: "sensor.a", Value: 300, TS: week2ts},
 	}
 
 	byWeek := groupByWeek(records)
@@ -264,19 +270,19 @@ func TestWriteAndLoadCSV(t *testing.T) {
 	dir := t.TempDir()
 	csvPath := filepath.Join(dir, "test.csv")
 
-	records := []record{
-		{sensorID: "sensor.a", value: 123.456, ts: 1000.1234567},
-		{sensorID: "sensor.b", value: -50, ts: 2000.0},
+	records := []ingest.Record{
+		{SensorID: "sensor.a", Value: 123.456, TS: 1000.1234567},
+		{SensorID: "sensor.b", Value: -50, TS: 2000.0},
 	}
 
 	require.NoError(t, writeCSV(csvPath, records))
 
 	loaded := loadCSVFile(csvPath)
 	assert.Len(t, loaded, 2)
-	assert.Equal(t, "sensor.a", loaded[0].sensorID)
-	assert.Equal(t, 123.456, loaded[0].value)
-	assert.Equal(t, "sensor.b", loaded[1].sensorID)
-	assert.Equal(t, -50.0, loaded[1].value)
+	assert.Equal(t, "sensor.a", loaded[0].SensorID)
+	assert.Equal(t, 123.456, loaded[0].Value)
+	assert.Equal(t, "sensor.b", loaded[1].SensorID)
+	assert.Equal(t, -50.0, loaded[1].Value)
 }
 
 func TestLoadCSVFileMissing(t *testing.T) {
@@ -284,7 +290,115 @@ func TestLoadCSVFileMissing(t *testing.T) {
 	assert.Nil(t, records)
 }
 
-func writeTestCSV(t *testing.T, path string, records []record) {
+func TestPlanWindows(t *testing.T) {
+	now := mustParseTime("2026-02-20T12:00:00Z")
+
+	// First run: a single 2-year window
+	w := planWindows(time.Time{}, now, 0, 0)
+	require.Len(t, w, 1)
+	assert.Equal(t, "first run", w[0].label)
+	assert.Equal(t, now.AddDate(-2, 0, 0), w[0].start)
+
+	// Existing data: backfill before earliest, forward from latest
+	earliest := float64(mustParseTime("2026-01-10T00:00:00Z").Unix())
+	latest := float64(mustParseTime("2026-02-19T00:00:00Z").Unix())
+	w = planWindows(time.Time{}, now, earliest, latest)
+	require.Len(t, w, 2)
+	assert.Equal(t, "backfill", w[0].label)
+	assert.Equal(t, mustParseTime("2026-01-10T00:01:00Z"), w[0].end.UTC())
+	assert.Equal(t, "forward", w[1].label)
+	assert.Equal(t, mustParseTime("2026-02-18T23:59:00Z"), w[1].start.UTC())
+
+	// Forced since
+	since := mustParseTime("2026-02-01T00:00:00Z")
+	w = planWindows(since, now, earliest, latest)
+	require.Len(t, w, 1)
+	assert.Equal(t, since, w[0].start)
+}
+
+func TestRunDryRun(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	// Existing data: 2026-02-16 (W08) .. 2026-02-17
+	writeTestCSV(t, filepath.Join(dir, "2026-W08.csv"), []ingest.Record{
+		{SensorID: "sensor.a", Value: 1, TS: float64(mustParseTime("2026-02-16T10:00:00Z").Unix())},
+		{SensorID: "sensor.a", Value: 2, TS: float64(mustParseTime("2026-02-17T10:00:00Z").Unix())},
+	})
+	before, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	err = run(runOptions{
+		baseURL:   srv.URL,
+		token:     "token",
+		outputDir: dir,
+		entityIDs: []string{"sensor.grid_power", "sensor.pv_power"},
+		now:       mustParseTime("2026-02-26T12:00:00Z"),
+		dryRun:    true,
+	}, srv.Client(), &out)
+	require.NoError(t, err)
+
+	assert.Zero(t, requests.Load(), "dry run must not contact the API")
+	after, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, len(before), len(after), "dry run must not write files")
+
+	text := out.String()
+	assert.Contains(t, text, "backfill")
+	assert.Contains(t, text, "forward")
+	assert.Contains(t, text, "sensor.grid_power")
+	assert.Contains(t, text, "sensor.pv_power")
+	assert.Contains(t, text, "2026-W08.csv")
+	assert.Contains(t, text, "2026-W09.csv")
+}
+
+func TestSelectEntityIDs(t *testing.T) {
+	all, err := selectEntityIDs("")
+	require.NoError(t, err)
+	assert.Len(t, all, len(model.SensorHomeAssistantID))
+
+	ids, err := selectEntityIDs("grid_voltage, sensor.0x943469fffed2bf71_power,grid_voltage")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sensor.0x943469fffed2bf71_power", "sensor.0x943469fffed2bf71_voltage"}, ids)
+
+	_, err = selectEntityIDs("grid_voltage,bogus")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"bogus"`)
+}
+
+func TestRunFetchesOnlySelectedSensors(t *testing.T) {
+	var filters []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filters = append(filters, r.URL.Query().Get("filter_entity_id"))
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	ids, err := selectEntityIDs("grid_voltage")
+	require.NoError(t, err)
+
+	now := mustParseTime("2026-02-26T12:00:00Z")
+	err = run(runOptions{
+		baseURL:   srv.URL,
+		token:     "token",
+		outputDir: t.TempDir(),
+		entityIDs: ids,
+		since:     now.Add(-12 * time.Hour),
+		now:       now,
+	}, srv.Client(), io.Discard)
+	require.NoError(t, err)
+
+	require.Len(t, filters, 1)
+	assert.Equal(t, "sensor.0x943469fffed2bf71_voltage", filters[0])
+}
+
+func writeTestCSV(t *testing.T, path string, records []ingest.Record) {
 	t.Helper()
 	f, err := os.Create(path)
 	require.NoError(t, err)
@@ -292,9 +406,9 @@ func writeTestCSV(t *testing.T, path string, records []record) {
 	w.Write([]string{"sensor_id", "value", "updated_ts"})
 	for _, r := range records {
 		w.Write([]string{
-			r.sensorID,
-			fmt.Sprintf("%g", r.value),
-			fmt.Sprintf("%.7f", r.ts),
+			r.SensorID,
+			fmt.Sprintf("%g", r.Value),
+			fmt.Sprintf("%.7f", r.TS),
 		})
 	}
 	w.Flush()
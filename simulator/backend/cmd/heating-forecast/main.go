@@ -0,0 +1,475 @@
+// heating-forecast estimates heat-pump electricity use and cost for an
+// upcoming heating season. The temperature NN generates hourly outdoor
+// temperatures for a cold, normal and warm winter (via its anomaly input);
+// each hour's heat demand follows the building heat-loss coefficient fitted
+// from the data, and is converted to electricity with the measured COP curve.
+//
+// Usage:
+//
+//	heating-forecast
+//	heating-forecast -start 2025-10-01 -end 2026-05-01
+//	heating-forecast -tariff 1.10 -anomaly-spread 2
+//	heating-forecast -power-model model/grid_power.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"energy_simulator/internal/ingest"
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/numfmt"
+	"energy_simulator/internal/predictor"
+	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/store"
+)
+
+// copPoint is the measured COP at an outdoor temperature bucket midpoint.
+type copPoint struct {
+	TempC float64
+	COP   float64
+}
+
+// heatingModel converts outdoor temperature to heat-pump electrical power.
+type heatingModel struct {
+	HeatLossWC float64    // building heat-loss coefficient (W/°C)
+	IndoorC    float64    // indoor temperature held by the heat pump
+	COPCurve   []copPoint // sorted by TempC; empty uses DefaultCOP
+	DefaultCOP float64
+}
+
+// scenario is a named temperature anomaly fed to the temperature NN.
+type scenario struct {
+	Name    string
+	Anomaly float64
+}
+
+// seasonForecast is the forecast for one scenario.
+type seasonForecast struct {
+	Scenario scenario
+	AvgTempC float64
+	HeatKWh  float64 // heat delivered to the building
+	ElecKWh  float64 // heat-pump electricity
+	CostPLN  float64
+	GridKWh  float64 // whole-house grid import from the power NN; 0 without it
+}
+
+type tempFunc func(dayOfYear, hour int, anomaly float64) float64
+type powerFunc func(month, hour int, tempC float64) float64
+
+func main() {
+	inputDir := flag.String("input-dir", "input", "directory containing CSV data files")
+	tempModelPath := flag.String("temp-model", "model/temperature.json", "path to temperature NN model")
+	powerModelPath := flag.String("power-model", "", "optional grid power NN model for a whole-house grid forecast")
+	startFlag := flag.String("start", "", "first day of the season (YYYY-MM-DD); defaults to the next 1 October")
+	endFlag := flag.String("end", "", "day after the season (YYYY-MM-DD); defaults to 1 May after start")
+	tariff := flag.Float64("tariff", 0, "flat tariff in PLN/kWh (0 = hourly average spot price from data)")
+	spread := flag.Float64("anomaly-spread", 1.5, "temperature anomaly for the cold (-) and warm (+) scenarios")
+	heatLoss := flag.Float64("heat-loss", 0, "heat-loss coefficient in W/°C (0 = estimate from data)")
+	indoor := flag.Float64("indoor", 21, "indoor temperature in °C")
+	tempBucket := flag.Float64("temp-bucket", 5, "temperature bucket width in °C for the COP curve")
+	defaultCOP := flag.Float64("cop", 3, "COP used when the data has no production sensor")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them at load")
+	roundTo := flag.Duration("round-timestamps", 0, "round reading timestamps to this grid at load (e.g. 1m), keeping the last value per sensor and slot in file order (0 = off)")
+	currency := flag.String("currency", numfmt.DefaultCurrency, "currency label for costs")
+	locale := flag.String("locale", "plain", "number format: plain, en, pl, de, fr, ch (thousands/decimal separators)")
+	flag.Parse()
+
+	nf, err := numfmt.New(*currency, *locale)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+
+	start, end, err := seasonRange(*startFlag, *endFlag, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dataStore := loadAllData(*inputDir, rules, *roundTo)
+	tr, ok := dataStore.GlobalTimeRange()
+	if !ok {
+		log.Fatal("No data loaded")
+	}
+
+	tempModelData, err := os.ReadFile(*tempModelPath)
+	if err != nil {
+		log.Fatalf("Loading temperature model: %v", err)
+	}
+	tempPred, err := predictor.LoadTemperaturePredictor(tempModelData, 42)
+	if err != nil {
+		log.Fatalf("Parsing temperature model: %v", err)
+	}
+
+	var power powerFunc
+	if *powerModelPath != "" {
+		powerModelData, err := os.ReadFile(*powerModelPath)
+		if err != nil {
+			log.Fatalf("Loading power model: %v", err)
+		}
+		powerPred, err := predictor.LoadPredictor(powerModelData, 42)
+		if err != nil {
+			log.Fatalf("Parsing power model: %v", err)
+		}
+		power = powerPred.PredictClean
+	}
+
+	m := heatingModel{HeatLossWC: *heatLoss, IndoorC: *indoor, DefaultCOP: *defaultCOP}
+	if m.HeatLossWC <= 0 {
+		est, ok := simulator.EstimateHeatLoss(dataStore, tr)
+		if !ok {
+			log.Fatal("Not enough heating data to estimate heat loss — pass -heat-loss")
+		}
+		m.HeatLossWC = est.HeatLossWC
+	}
+	m.COPCurve = computeCOPCurve(dataStore, throughEnd(tr), *tempBucket)
+
+	var prices [24]float64
+	if *tariff > 0 {
+		for h := range prices {
+			prices[h] = *tariff
+		}
+	} else {
+		priceID := findSensorID(dataStore, model.SensorEnergyPrice)
+		if priceID == "" {
+			log.Fatal("No price sensor found — pass -tariff")
+		}
+		prices = hourlyAvgPrices(dataStore.ReadingsInRange(priceID, tr.Start, tr.End.Add(time.Nanosecond)))
+	}
+
+	fmt.Println()
+	fmt.Println("Heating Season Forecast")
+	fmt.Printf("  Season: %s to %s\n", start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))
+	fmt.Printf("  Heat loss: %.0f W/°C   Indoor: %.1f °C   COP points: %d\n", m.HeatLossWC, m.IndoorC, len(m.COPCurve))
+	fmt.Println()
+
+	fmt.Printf("  %-8s │ %7s │ %8s │ %10s │ %10s │ %10s", "Scenario", "Anomaly", "Avg °C", "Heat kWh", "Elec kWh", "Cost "+nf.Currency)
+	if power != nil {
+		fmt.Printf(" │ %10s", "Grid kWh")
+	}
+	fmt.Println()
+	for _, sc := range []scenario{{"cold", -*spread}, {"normal", 0}, {"warm", *spread}} {
+		f := forecastSeason(tempPred.PredictClean, power, m, prices, start, end, sc)
+		fmt.Printf("  %-8s │ %+7.1f │ %8.1f │ %10s │ %10s │ %10s",
+			sc.Name, sc.Anomaly, f.AvgTempC, nf.Number(f.HeatKWh, 0), nf.Number(f.ElecKWh, 0), nf.Number(f.CostPLN, 2))
+		if power != nil {
+			fmt.Printf(" │ %10s", nf.Number(f.GridKWh, 0))
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+
+	if defrost := simulator.DetectDefrost(dataStore, tr); len(defrost) > 0 {
+		fmt.Println("Defrost Cycles (historical)")
+		fmt.Printf("  %-8s │ %6s │ %8s │ %8s │ %10s\n", "Month", "Events", "Minutes", "kWh", "Cost "+nf.Currency)
+		for _, d := range defrost {
+			fmt.Printf("  %-8s │ %6d │ %8s │ %8s │ %10s\n",
+				d.Month.Format("2006-01"), d.Events, nf.Number(d.Duration.Minutes(), 0), nf.Number(d.EnergyKWh, 2), nf.Number(d.CostPLN, 2))
+		}
+		fmt.Println()
+	}
+}
+
+// forecastSeason steps hourly through [start, end) with temperatures from
+// temp at the scenario's anomaly. Cost uses the hour-of-day price profile.
+func forecastSeason(temp tempFunc, power powerFunc, m heatingModel, prices [24]float64, start, end time.Time, sc scenario) seasonForecast {
+	f := seasonForecast{Scenario: sc}
+	var tempSum float64
+	hours := 0
+	for t := start; t.Before(end); t = t.Add(time.Hour) {
+		outdoor := temp(t.YearDay(), t.Hour(), sc.Anomaly)
+		heatW := m.heatDemandW(outdoor)
+		elecW := heatW / m.copAt(outdoor)
+
+		f.HeatKWh += heatW / 1000
+		f.ElecKWh += elecW / 1000
+		f.CostPLN += elecW / 1000 * prices[t.Hour()]
+		if power != nil {
+			if gridW := power(int(t.Month()), t.Hour(), outdoor); gridW > 0 {
+				f.GridKWh += gridW / 1000
+			}
+		}
+		tempSum += outdoor
+		hours++
+	}
+	if hours > 0 {
+		f.AvgTempC = tempSum / float64(hours)
+	}
+	return f
+}
+
+// heatDemandW returns the heat needed to hold IndoorC at the given outdoor temperature.
+func (m heatingModel) heatDemandW(outdoorC float64) float64 {
+	return m.HeatLossWC * math.Max(0, m.IndoorC-outdoorC)
+}
+
+// copAt interpolates the COP curve linearly, holding the end values beyond it.
+func (m heatingModel) copAt(outdoorC float64) float64 {
+	c := m.COPCurve
+	if len(c) == 0 {
+		return math.Max(m.DefaultCOP, 1)
+	}
+	if outdoorC <= c[0].TempC {
+		return c[0].COP
+	}
+	for i := 1; i < len(c); i++ {
+		if outdoorC <= c[i].TempC {
+			frac := (outdoorC - c[i-1].TempC) / (c[i].TempC - c[i-1].TempC)
+			return c[i-1].COP + frac*(c[i].COP-c[i-1].COP)
+		}
+	}
+	return c[len(c)-1].COP
+}
+
+// computeCOPCurve buckets heat-pump production/consumption by outdoor
+// temperature and returns one point per bucket midpoint.
+func computeCOPCurve(s *store.Store, tr model.TimeRange, bucketWidth float64) []copPoint {
+	productionID := findSensorID(s, model.SensorPumpProduction)
+	extTempID := findSensorID(s, model.SensorPumpExtTemp)
+	if productionID == "" || extTempID == "" {
+		return nil
+	}
+
+	type accum struct{ consumptionWh, productionWh float64 }
+	buckets := make(map[int]*accum)
+	consumption := s.SeriesByType(model.SensorPumpConsumption, tr)
+	for i := 1; i < len(consumption); i++ {
+		prev, cur := consumption[i-1], consumption[i]
+		hours := cur.Timestamp.Sub(prev.Timestamp).Hours()
+		if hours <= 0 || hours > 2 {
+			continue
+		}
+		prod, ok := s.ReadingAt(productionID, cur.Timestamp)
+		if !ok {
+			continue
+		}
+		prevProd, ok := s.ReadingAt(productionID, prev.Timestamp)
+		if !ok {
+			continue
+		}
+		temp, ok := s.ReadingAt(extTempID, cur.Timestamp)
+		if !ok {
+			continue
+		}
+		consumptionWh := (prev.Value + cur.Value) / 2 * hours
+		productionWh := (prevProd.Value + prod.Value) / 2 * hours
+		if consumptionWh <= 0 || productionWh <= 0 {
+			continue
+		}
+		idx := int(math.Floor(temp.Value / bucketWidth))
+		if buckets[idx] == nil {
+			buckets[idx] = &accum{}
+		}
+		buckets[idx].consumptionWh += consumptionWh
+		buckets[idx].productionWh += productionWh
+	}
+
+	indices := make([]int, 0, len(buckets))
+	for idx := range buckets {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+
+	curve := make([]copPoint, 0, len(indices))
+	for _, idx := range indices {
+		a := buckets[idx]
+		curve = append(curve, copPoint{
+			TempC: (float64(idx) + 0.5) * bucketWidth,
+			COP:   math.Max(a.productionWh/a.consumptionWh, 1),
+		})
+	}
+	return curve
+}
+
+// hourlyAvgPrices averages spot prices by hour of day.
+func hourlyAvgPrices(readings []model.Reading) [24]float64 {
+	var sums [24]float64
+	var counts [24]int
+	for _, r := range readings {
+		h := r.Timestamp.Hour()
+		sums[h] += r.Value
+		counts[h]++
+	}
+	for h := range sums {
+		if counts[h] > 0 {
+			sums[h] /= float64(counts[h])
+		}
+	}
+	return sums
+}
+
+// seasonRange parses the season bounds. An empty start defaults to the next
+// 1 October after now; an empty end to 1 May after start.
+func seasonRange(startStr, endStr string, now time.Time) (start, end time.Time, err error) {
+	if startStr != "" {
+		start, err = time.ParseInLocation("2006-01-02", startStr, time.Local)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid -start: %w", err)
+		}
+	} else {
+		start = time.Date(now.Year(), time.October, 1, 0, 0, 0, 0, time.Local)
+		if !start.After(now) {
+			start = start.AddDate(1, 0, 0)
+		}
+	}
+	if endStr != "" {
+		end, err = time.ParseInLocation("2006-01-02", endStr, time.Local)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid -end: %w", err)
+		}
+	} else {
+		end = time.Date(start.Year(), time.May, 1, 0, 0, 0, 0, time.Local)
+		if !end.After(start) {
+			end = end.AddDate(1, 0, 0)
+		}
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("season end %s is not after start %s", end.Format("2006-01-02"), start.Format("2006-01-02"))
+	}
+	return start, end, nil
+}
+
+func loadAllData(inputDir string, rules ingest.SanitizeRules, roundTo time.Duration) *store.Store {
+	dataStore := store.New()
+
+	// Load legacy per-sensor CSVs from root
+	loadLegacyCSVs(inputDir, dataStore, rules, roundTo)
+
+	// Load multi-sensor recent and stats CSVs
+	loadDir(filepath.Join(inputDir, "recent"), &ingest.RecentParser{}, dataStore, rules, roundTo)
+	loadDir(filepath.Join(inputDir, "stats"), &ingest.StatsParser{}, dataStore, rules, roundTo)
+
+	return dataStore
+}
+
+func loadDir(dir string, parser ingest.Parser, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".csv") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Warning: opening %s: %v", path, err)
+			continue
+		}
+		readings, err := parser.Parse(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Warning: parsing %s: %v", path, err)
+			continue
+		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("Cleaned %s: %s", path, report)
+		}
+		if len(readings) > 0 {
+			registerSensors(readings, s)
+			s.AddReadings(readings)
+		}
+	}
+}
+
+func loadLegacyCSVs(dir string, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Fatalf("Reading input directory %s: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".csv") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Opening %s: %v", path, err)
+		}
+
+		sensorType, unit := sensorTypeFromFilename(entry.Name())
+		parser := ingest.NewHomeAssistantParser(sensorType, unit)
+		readings, err := parser.Parse(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Parsing %s: %v", path, err)
+		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("Cleaned %s: %s", path, report)
+		}
+
+		if len(readings) > 0 {
+			name := string(sensorType)
+			if info, ok := model.SensorCatalog[sensorType]; ok {
+				name = info.Name
+			}
+			s.AddSensor(model.Sensor{
+				ID:   readings[0].SensorID,
+				Name: name,
+				Type: sensorType,
+				Unit: unit,
+			})
+			s.AddReadings(readings)
+		}
+	}
+}
+
+func registerSensors(readings []model.Reading, s *store.Store) {
+	seen := make(map[model.SensorType]bool)
+	for _, r := range readings {
+		if seen[r.Type] {
+			continue
+		}
+		seen[r.Type] = true
+
+		name := string(r.Type)
+		unit := r.Unit
+		if info, ok := model.SensorCatalog[r.Type]; ok {
+			name = info.Name
+			unit = info.Unit
+		}
+		s.AddSensor(model.Sensor{
+			ID:   r.SensorID,
+			Name: name,
+			Type: r.Type,
+			Unit: unit,
+		})
+	}
+}
+
+func findSensorID(s *store.Store, st model.SensorType) string {
+	for _, sensor := range s.Sensors() {
+		if sensor.Type == st {
+			return sensor.ID
+		}
+	}
+	return ""
+}
+
+func sensorTypeFromFilename(name string) (model.SensorType, string) {
+	base := strings.TrimSuffix(name, ".csv")
+	st := model.SensorType(base)
+	if info, ok := model.SensorCatalog[st]; ok {
+		return st, info.Unit
+	}
+	return st, ""
+}
+
+func throughEnd(tr model.TimeRange) model.TimeRange {
+	return model.TimeRange{Start: tr.Start, End: tr.End.Add(time.Nanosecond)}
+}
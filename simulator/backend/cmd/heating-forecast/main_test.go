@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syntheticTemp is a winter with a daily swing, shifted 2 °C per unit anomaly.
+func syntheticTemp(dayOfYear, hour int, anomaly float64) float64 {
+	return 1 + 4*math.Sin(float64(hour)/24*2*math.Pi) + 2*anomaly
+}
+
+func TestForecastSeason_ColdAboveWarm(t *testing.T) {
+	m := heatingModel{
+		HeatLossWC: 150,
+		IndoorC:    21,
+		COPCurve:   []copPoint{{TempC: -7.5, COP: 2.2}, {TempC: 2.5, COP: 3.3}, {TempC: 12.5, COP: 4.5}},
+	}
+	var prices [24]float64
+	for h := range prices {
+		prices[h] = 0.8
+	}
+	start := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	cold := forecastSeason(syntheticTemp, nil, m, prices, start, end, scenario{"cold", -1.5})
+	normal := forecastSeason(syntheticTemp, nil, m, prices, start, end, scenario{"normal", 0})
+	warm := forecastSeason(syntheticTemp, nil, m, prices, start, end, scenario{"warm", 1.5})
+
+	assert.Greater(t, cold.ElecKWh, normal.ElecKWh)
+	assert.Greater(t, normal.ElecKWh, warm.ElecKWh)
+	assert.Greater(t, cold.CostPLN, warm.CostPLN)
+	assert.InDelta(t, 1, normal.AvgTempC, 0.01)
+	// Flat tariff: cost is electricity × price.
+	assert.InDelta(t, normal.ElecKWh*0.8, normal.CostPLN, 1e-6)
+	assert.Zero(t, normal.GridKWh)
+}
+
+func TestHeatingModel_COPInterpolation(t *testing.T) {
+	m := heatingModel{COPCurve: []copPoint{{TempC: -5, COP: 2}, {TempC: 5, COP: 4}}}
+	assert.InDelta(t, 2, m.copAt(-20), 1e-9)
+	assert.InDelta(t, 3, m.copAt(0), 1e-9)
+	assert.InDelta(t, 4, m.copAt(15), 1e-9)
+
+	assert.InDelta(t, 3, heatingModel{DefaultCOP: 3}.copAt(0), 1e-9)
+}
+
+func TestSeasonRange_Defaults(t *testing.T) {
+	now := time.Date(2025, 11, 15, 12, 0, 0, 0, time.Local)
+	start, end, err := seasonRange("", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local), start)
+	assert.Equal(t, time.Date(2027, 5, 1, 0, 0, 0, 0, time.Local), end)
+
+	_, _, err = seasonRange("2025-12-01", "2025-11-01", now)
+	assert.Error(t, err)
+}
@@ -13,12 +13,15 @@ import (
 
 	"energy_simulator/internal/ingest"
 	"energy_simulator/internal/model"
+	"energy_simulator/internal/numfmt"
+	"energy_simulator/internal/simulator"
 	"energy_simulator/internal/store"
 )
 
 type HourlyBucket struct {
 	KWh           float64
 	CostPLN       float64
+	PeakW         float64
 	ReadingsCount int
 }
 
@@ -35,14 +38,66 @@ type ShiftResult struct {
 	SavingsPLN     float64
 }
 
+// Decomposition splits household consumption (grid import plus PV) into a
+// constant base load, heating proportional to heating degree-days below
+// BalanceC, a time-of-year component fitted to what those two leave, and the
+// remainder. The four parts add up to TotalKWh.
+type Decomposition struct {
+	Days            int
+	BalanceC        float64
+	TotalKWh        float64
+	BaseKWh         float64
+	HeatingKWh      float64
+	SeasonalKWh     float64
+	OtherKWh        float64
+	BaseLoadW       float64
+	KWhPerDegreeDay float64
+}
+
+const (
+	// decompositionMinDays is the minimum number of full days for a fit.
+	decompositionMinDays = 7
+	// decompositionSeasonalMinDays is the data span below which a yearly
+	// harmonic would only fit noise, so the seasonal part stays zero.
+	decompositionSeasonalMinDays = 90
+	// decompositionMinDayHours is the coverage a day needs to be used.
+	decompositionMinDayHours = 20.0
+)
+
 func main() {
 	inputDir := flag.String("input-dir", "input", "directory containing CSV data files")
-	shiftWindow := flag.Int("shift-window", 4, "max hours to shift load")
+	shiftWindow := flag.Int("shift-window", simulator.DefaultLoadShiftWindowH, fmt.Sprintf("max hours to shift load (0-%d)", simulator.MaxLoadShiftWindowH))
 	minPower := flag.Float64("min-power", 50, "min watts to count as active")
 	tempBucket := flag.Float64("temp-bucket", 5, "temperature bucket width in °C")
+	peakMax := flag.Bool("peak-max", true, "use the Max of hourly stats readings for peak power (energy always uses the mean)")
+	balanceTemp := flag.Float64("balance-temp", 15, "outside temperature (°C) above which no heating is needed, for the consumption decomposition")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them at load")
+	roundTo := flag.Duration("round-timestamps", 0, "round reading timestamps to this grid at load (e.g. 1m), keeping the last value per sensor and slot in file order (0 = off)")
+	integrationFlag := flag.String("integration", "", "per-sensor integration overrides, e.g. oven=step,washing=step (trapezoid, left, right, step)")
+	currency := flag.String("currency", numfmt.DefaultCurrency, "currency label for costs and prices")
+	locale := flag.String("locale", "plain", "number format: plain, en, pl, de, fr, ch (thousands/decimal separators)")
 	flag.Parse()
 
-	dataStore := loadAllData(*inputDir)
+	if *shiftWindow < 0 || *shiftWindow > simulator.MaxLoadShiftWindowH {
+		log.Fatalf("-shift-window must be between 0 and %d hours", simulator.MaxLoadShiftWindowH)
+	}
+
+	var err error
+	integration, err = model.ParseIntegrationOverrides(*integrationFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	nf, err = numfmt.New(*currency, *locale)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+
+	dataStore := loadAllData(*inputDir, rules, *roundTo)
 
 	tr, ok := dataStore.GlobalTimeRange()
 	if !ok {
@@ -61,8 +116,13 @@ func main() {
 	fmt.Printf("  Data: %s to %s (%.0f days)\n", tr.Start.Format("2006-01-02"), tr.End.Format("2006-01-02"), days)
 	fmt.Println()
 
+	if d, ok := computeDecomposition(dataStore, tr, *balanceTemp); ok {
+		printDecomposition(d)
+		fmt.Println()
+	}
+
 	// Compute overall average spot price
-	overallAvgSpot := computeOverallAvgSpotPrice(dataStore, priceSensorID, tr)
+	overallAvgSpot := computeOverallAvgSpotPrice(dataStore, tr)
 
 	// Heat pump analysis (consumption + production + ext temp)
 	consumptionID := findSensorID(dataStore, model.SensorPumpConsumption)
@@ -72,13 +132,13 @@ func main() {
 	if consumptionID != "" {
 		fmt.Println("=== Heat Pump ===")
 
-		hourly := aggregateByHour(dataStore, consumptionID, priceSensorID, tr)
+		hourly := aggregateByHour(dataStore, model.SensorPumpConsumption, priceSensorID, tr, *peakMax)
 		totalKWh, totalCost := sumHourly(hourly)
 		avgPrice := safeDivide(totalCost, totalKWh)
 
 		var totalProdKWh float64
 		if productionID != "" {
-			prodHourly := aggregateByHour(dataStore, productionID, "", tr)
+			prodHourly := aggregateByHour(dataStore, model.SensorPumpProduction, "", tr, *peakMax)
 			totalProdKWh, _ = sumHourly(prodHourly)
 		}
 
@@ -87,8 +147,8 @@ func main() {
 
 		fmt.Printf("  Consumption: %s   Production: %s   COP: %.1f\n",
 			formatKWh(totalKWh), formatKWh(totalProdKWh), cop)
-		fmt.Printf("  Cost at spot: %.2f PLN   Avg price: %.2f PLN/kWh\n", totalCost, avgPrice)
-		fmt.Printf("  Overall avg spot: %.2f PLN/kWh   Efficiency: %.2fx", overallAvgSpot, efficiency)
+		fmt.Printf("  Cost at spot: %s   Avg price: %s %s\n", nf.Money(totalCost), nf.Number(avgPrice, 2), nf.PerKWh())
+		fmt.Printf("  Overall avg spot: %s %s   Efficiency: %.2fx", nf.Number(overallAvgSpot, 2), nf.PerKWh(), efficiency)
 		if efficiency > 1.01 {
 			fmt.Print(" (worse)")
 		} else if efficiency < 0.99 {
@@ -98,7 +158,7 @@ func main() {
 
 		// COP by temperature
 		if productionID != "" && extTempID != "" {
-			copBuckets := computeCOPCurve(dataStore, consumptionID, productionID, extTempID, tr, *tempBucket, *minPower)
+			copBuckets := computeCOPCurve(dataStore, productionID, extTempID, tr, *tempBucket, *minPower)
 			if len(copBuckets) > 0 {
 				fmt.Println()
 				printCOPTable(copBuckets)
@@ -110,7 +170,7 @@ func main() {
 		printHourlyTable(hourly, totalKWh)
 
 		// Shift potential
-		shift := computeShiftPotential(dataStore, consumptionID, priceSensorID, tr, *shiftWindow, *minPower)
+		shift := computeShiftPotential(dataStore, model.SensorPumpConsumption, priceSensorID, tr, *shiftWindow, *minPower)
 		if shift.CurrentCostPLN > 0 {
 			fmt.Println()
 			printShiftResult(shift, *shiftWindow)
@@ -131,8 +191,7 @@ func main() {
 	}
 
 	for sensorType, name := range applianceTypes {
-		sensorID := findSensorID(dataStore, sensorType)
-		if sensorID == "" {
+		if findSensorID(dataStore, sensorType) == "" {
 			continue
 		}
 		// Skip pump sub-sensors if we already printed the main consumption
@@ -142,7 +201,7 @@ func main() {
 			}
 		}
 
-		hourly := aggregateByHour(dataStore, sensorID, priceSensorID, tr)
+		hourly := aggregateByHour(dataStore, sensorType, priceSensorID, tr, *peakMax)
 		totalKWh, totalCost := sumHourly(hourly)
 		if totalKWh < 0.1 {
 			continue
@@ -153,8 +212,8 @@ func main() {
 
 		fmt.Printf("=== %s ===\n", name)
 		fmt.Printf("  Consumption: %s\n", formatKWh(totalKWh))
-		fmt.Printf("  Cost at spot: %.2f PLN   Avg price: %.2f PLN/kWh\n", totalCost, avgPrice)
-		fmt.Printf("  Overall avg spot: %.2f PLN/kWh   Efficiency: %.2fx", overallAvgSpot, efficiency)
+		fmt.Printf("  Cost at spot: %s   Avg price: %s %s\n", nf.Money(totalCost), nf.Number(avgPrice, 2), nf.PerKWh())
+		fmt.Printf("  Overall avg spot: %s %s   Efficiency: %.2fx", nf.Number(overallAvgSpot, 2), nf.PerKWh(), efficiency)
 		if efficiency > 1.01 {
 			fmt.Print(" (worse)")
 		} else if efficiency < 0.99 {
@@ -164,7 +223,7 @@ func main() {
 
 		printHourlyTable(hourly, totalKWh)
 
-		shift := computeShiftPotential(dataStore, sensorID, priceSensorID, tr, *shiftWindow, *minPower)
+		shift := computeShiftPotential(dataStore, sensorType, priceSensorID, tr, *shiftWindow, *minPower)
 		if shift.CurrentCostPLN > 0 {
 			fmt.Println()
 			printShiftResult(shift, *shiftWindow)
@@ -173,9 +232,12 @@ func main() {
 	}
 }
 
-func aggregateByHour(s *store.Store, sensorID, priceSensorID string, tr model.TimeRange) [24]HourlyBucket {
+// aggregateByHour integrates readings of st into hour-of-day buckets. Energy
+// always comes from Value (the mean for stats rows); with useMax the bucket
+// peak uses each reading's Max so hourly statistics don't hide short spikes.
+func aggregateByHour(s *store.Store, st model.SensorType, priceSensorID string, tr model.TimeRange, useMax bool) [24]HourlyBucket {
 	var buckets [24]HourlyBucket
-	readings := s.ReadingsInRange(sensorID, tr.Start, tr.End.Add(time.Nanosecond))
+	readings := s.SeriesByType(st, throughEnd(tr))
 	for i := 1; i < len(readings); i++ {
 		prev := readings[i-1]
 		cur := readings[i]
@@ -183,7 +245,16 @@ func aggregateByHour(s *store.Store, sensorID, priceSensorID string, tr model.Ti
 		if hours <= 0 || hours > 2 {
 			continue
 		}
-		avgPower := (prev.Value + cur.Value) / 2
+		h := cur.Timestamp.Hour()
+		peak := cur.Value
+		if useMax {
+			peak = cur.Peak()
+		}
+		if !model.IsCumulative(st) && peak > buckets[h].PeakW {
+			buckets[h].PeakW = peak
+		}
+
+		avgPower := intervalAvgPower(st, prev, cur, hours)
 		if avgPower <= 0 {
 			continue
 		}
@@ -197,7 +268,6 @@ func aggregateByHour(s *store.Store, sensorID, priceSensorID string, tr model.Ti
 			}
 		}
 
-		h := cur.Timestamp.Hour()
 		buckets[h].KWh += kwh
 		buckets[h].CostPLN += kwh * price
 		buckets[h].ReadingsCount++
@@ -205,8 +275,8 @@ func aggregateByHour(s *store.Store, sensorID, priceSensorID string, tr model.Ti
 	return buckets
 }
 
-func computeCOPCurve(s *store.Store, consumptionID, productionID, extTempID string, tr model.TimeRange, bucketWidth, minPower float64) []COPBucket {
-	consumptionReadings := s.ReadingsInRange(consumptionID, tr.Start, tr.End.Add(time.Nanosecond))
+func computeCOPCurve(s *store.Store, productionID, extTempID string, tr model.TimeRange, bucketWidth, minPower float64) []COPBucket {
+	consumptionReadings := s.SeriesByType(model.SensorPumpConsumption, throughEnd(tr))
 
 	// Build a map: temp bucket index → accumulator
 	type accum struct {
@@ -281,8 +351,8 @@ func computeCOPCurve(s *store.Store, consumptionID, productionID, extTempID stri
 	return result
 }
 
-func computeShiftPotential(s *store.Store, sensorID, priceSensorID string, tr model.TimeRange, shiftWindow int, minPower float64) ShiftResult {
-	readings := s.ReadingsInRange(sensorID, tr.Start, tr.End.Add(time.Nanosecond))
+func computeShiftPotential(s *store.Store, st model.SensorType, priceSensorID string, tr model.TimeRange, shiftWindow int, minPower float64) ShiftResult {
+	readings := s.SeriesByType(st, throughEnd(tr))
 	if len(readings) < 2 {
 		return ShiftResult{}
 	}
@@ -304,7 +374,7 @@ func computeShiftPotential(s *store.Store, sensorID, priceSensorID string, tr mo
 		if hours <= 0 || hours > 2 {
 			continue
 		}
-		avgPower := (prev.Value + cur.Value) / 2
+		avgPower := intervalAvgPower(st, prev, cur, hours)
 		if avgPower < minPower {
 			continue
 		}
@@ -335,7 +405,7 @@ func computeShiftPotential(s *store.Store, sensorID, priceSensorID string, tr mo
 	// Now compute day prices for shifting
 	// For each day, get the price at each hour
 	dayPrices := make(map[string][24]float64)
-	priceReadings := s.ReadingsInRange(priceSensorID, tr.Start, tr.End.Add(time.Nanosecond))
+	priceReadings := s.SeriesByType(model.SensorEnergyPrice, throughEnd(tr))
 	for _, r := range priceReadings {
 		dayKey := r.Timestamp.Format("2006-01-02")
 		h := r.Timestamp.Hour()
@@ -381,8 +451,125 @@ func computeShiftPotential(s *store.Store, sensorID, priceSensorID string, tr mo
 	}
 }
 
-func computeOverallAvgSpotPrice(s *store.Store, priceSensorID string, tr model.TimeRange) float64 {
-	readings := s.ReadingsInRange(priceSensorID, tr.Start, tr.End.Add(time.Nanosecond))
+// computeDecomposition fits daily consumption E = base + k·HDD by least
+// squares, where HDD is balanceC minus the day's mean outside temperature
+// (zero on warm days), then fits a yearly harmonic to the residual. Only days
+// with decompositionMinDayHours of grid and temperature data are used.
+// Returns false without grid power, outside temperature or enough days.
+func computeDecomposition(s *store.Store, tr model.TimeRange, balanceC float64) (Decomposition, bool) {
+	gridID := findSensorID(s, model.SensorGridPower)
+	tempID := findSensorID(s, model.SensorPumpExtTemp)
+	if gridID == "" || tempID == "" {
+		return Decomposition{}, false
+	}
+	load, hours := dailyEnergyKWh(s, gridID, model.SensorGridPower, tr)
+	if pvID := findSensorID(s, model.SensorPVPower); pvID != "" {
+		pv, _ := dailyEnergyKWh(s, pvID, model.SensorPVPower, tr)
+		for day, kwh := range pv {
+			load[day] += kwh
+		}
+	}
+	temps := make(map[time.Time][]float64)
+	for _, r := range s.ReadingsInRange(tempID, tr.Start, tr.End.Add(time.Nanosecond)) {
+		day := dayOf(r.Timestamp)
+		temps[day] = append(temps[day], r.Value)
+	}
+
+	type dayPoint struct {
+		day      time.Time
+		hdd, kwh float64
+	}
+	var points []dayPoint
+	for day, kwh := range load {
+		t := temps[day]
+		if hours[day] < decompositionMinDayHours || len(t) == 0 {
+			continue
+		}
+		var sum float64
+		for _, v := range t {
+			sum += v
+		}
+		points = append(points, dayPoint{day: day, hdd: math.Max(0, balanceC-sum/float64(len(t))), kwh: kwh})
+	}
+	if len(points) < decompositionMinDays {
+		return Decomposition{}, false
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].day.Before(points[j].day) })
+
+	d := Decomposition{Days: len(points), BalanceC: balanceC}
+	n := float64(len(points))
+	var meanHDD, meanKWh, sumHDD float64
+	for _, p := range points {
+		meanHDD += p.hdd / n
+		meanKWh += p.kwh / n
+		sumHDD += p.hdd
+		d.TotalKWh += p.kwh
+	}
+	var sxx, sxy float64
+	for _, p := range points {
+		sxx += (p.hdd - meanHDD) * (p.hdd - meanHDD)
+		sxy += (p.hdd - meanHDD) * (p.kwh - meanKWh)
+	}
+	if sxx > 0 {
+		d.KWhPerDegreeDay = math.Max(0, sxy/sxx)
+	}
+	base := meanKWh - d.KWhPerDegreeDay*meanHDD
+	d.BaseLoadW = base / 24 * 1000
+	d.BaseKWh = base * n
+	d.HeatingKWh = d.KWhPerDegreeDay * sumHDD
+
+	// Yearly harmonic on the residual: r = c·cos θ + s·sin θ.
+	if points[len(points)-1].day.Sub(points[0].day).Hours()/24 >= decompositionSeasonalMinDays {
+		var scc, scs, sss, src, srs float64
+		for _, p := range points {
+			r := p.kwh - base - d.KWhPerDegreeDay*p.hdd
+			theta := 2 * math.Pi * float64(p.day.YearDay()) / 365.25
+			c, sn := math.Cos(theta), math.Sin(theta)
+			scc += c * c
+			scs += c * sn
+			sss += sn * sn
+			src += r * c
+			srs += r * sn
+		}
+		if det := scc*sss - scs*scs; det > 0 {
+			cc := (src*sss - srs*scs) / det
+			cs := (srs*scc - src*scs) / det
+			for _, p := range points {
+				theta := 2 * math.Pi * float64(p.day.YearDay()) / 365.25
+				d.SeasonalKWh += cc*math.Cos(theta) + cs*math.Sin(theta)
+			}
+		}
+	}
+	d.OtherKWh = d.TotalKWh - d.BaseKWh - d.HeatingKWh - d.SeasonalKWh
+	return d, true
+}
+
+// dailyEnergyKWh integrates a power sensor per calendar day, keeping the sign
+// (grid export is negative). Each interval counts toward the day it starts
+// in; gaps over 2 h are skipped. Also returns the hours covered per day.
+func dailyEnergyKWh(s *store.Store, sensorID string, st model.SensorType, tr model.TimeRange) (kwh, hours map[time.Time]float64) {
+	kwh = make(map[time.Time]float64)
+	hours = make(map[time.Time]float64)
+	readings := s.ReadingsInRange(sensorID, tr.Start, tr.End.Add(time.Nanosecond))
+	for i := 1; i < len(readings); i++ {
+		prev, cur := readings[i-1], readings[i]
+		h := cur.Timestamp.Sub(prev.Timestamp).Hours()
+		if h <= 0 || h > 2 {
+			continue
+		}
+		day := dayOf(prev.Timestamp)
+		kwh[day] += intervalAvgPower(st, prev, cur, h) * h / 1000
+		hours[day] += h
+	}
+	return kwh, hours
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func computeOverallAvgSpotPrice(s *store.Store, tr model.TimeRange) float64 {
+	readings := s.SeriesByType(model.SensorEnergyPrice, throughEnd(tr))
 	if len(readings) == 0 {
 		return 0
 	}
@@ -409,8 +596,8 @@ func printCOPTable(buckets []COPBucket) {
 
 func printHourlyTable(hourly [24]HourlyBucket, totalKWh float64) {
 	fmt.Println("  Hourly Distribution:")
-	fmt.Printf("   %4s │ %8s │ %10s │ %9s │ %5s\n", "Hour", "kWh", "Avg Price", "Cost", "Share")
-	fmt.Printf("  ──────┼──────────┼────────────┼───────────┼──────\n")
+	fmt.Printf("   %4s │ %8s │ %7s │ %10s │ %9s │ %5s\n", "Hour", "kWh", "Peak kW", "Avg Price", "Cost "+nf.Currency, "Share")
+	fmt.Printf("  ──────┼──────────┼─────────┼────────────┼───────────┼──────\n")
 
 	// Find the most expensive hour
 	var maxCostHour int
@@ -433,26 +620,36 @@ func printHourlyTable(hourly [24]HourlyBucket, totalKWh float64) {
 		if h == maxCostHour && maxCost > 0 {
 			marker = " ← expensive"
 		}
-		fmt.Printf("     %02d │ %8.1f │ %10.2f │ %9.2f │ %4.1f%%%s\n",
-			h, b.KWh, avgPrice, b.CostPLN, share, marker)
+		fmt.Printf("     %02d │ %8s │ %7.1f │ %10s │ %9s │ %4.1f%%%s\n",
+			h, nf.Number(b.KWh, 1), b.PeakW/1000, nf.Number(avgPrice, 2), nf.Number(b.CostPLN, 2), share, marker)
 	}
 }
 
 func printShiftResult(r ShiftResult, window int) {
 	savingsPct := safeDivide(r.SavingsPLN, r.CurrentCostPLN) * 100
 	fmt.Printf("  Shift Potential (±%dh window):\n", window)
-	fmt.Printf("    Current cost:  %.2f PLN\n", r.CurrentCostPLN)
-	fmt.Printf("    Optimal cost:  %.2f PLN\n", r.OptimalCostPLN)
-	fmt.Printf("    Savings:       %.2f PLN (%.1f%%)\n", r.SavingsPLN, savingsPct)
+	fmt.Printf("    Current cost:  %s\n", nf.Money(r.CurrentCostPLN))
+	fmt.Printf("    Optimal cost:  %s\n", nf.Money(r.OptimalCostPLN))
+	fmt.Printf("    Savings:       %s (%.1f%%)\n", nf.Money(r.SavingsPLN), savingsPct)
+}
+
+func printDecomposition(d Decomposition) {
+	fmt.Println("=== Consumption Decomposition ===")
+	fmt.Printf("  %d days, %s total, heating below %.0f °C\n", d.Days, formatKWh(d.TotalKWh), d.BalanceC)
+	share := func(kwh float64) float64 { return safeDivide(kwh, d.TotalKWh) * 100 }
+	fmt.Printf("    Base load:  %10s (%5.1f%%)   %s W constant\n", formatKWh(d.BaseKWh), share(d.BaseKWh), nf.Number(d.BaseLoadW, 0))
+	fmt.Printf("    Heating:    %10s (%5.1f%%)   %s kWh per degree-day\n", formatKWh(d.HeatingKWh), share(d.HeatingKWh), nf.Number(d.KWhPerDegreeDay, 2))
+	fmt.Printf("    Seasonal:   %10s (%5.1f%%)\n", formatKWh(d.SeasonalKWh), share(d.SeasonalKWh))
+	fmt.Printf("    Other:      %10s (%5.1f%%)\n", formatKWh(d.OtherKWh), share(d.OtherKWh))
 }
 
 // --- Data loading ---
 
-func loadAllData(inputDir string) *store.Store {
+func loadAllData(inputDir string, rules ingest.SanitizeRules, roundTo time.Duration) *store.Store {
 	dataStore := store.New()
 
 	// Load legacy per-sensor CSVs from root
-	loadLegacyCSVs(inputDir, dataStore)
+	loadLegacyCSVs(inputDir, dataStore, rules, roundTo)
 
 	// Load multi-sensor recent CSVs (contains spot prices + more sensors)
 	recentDir := filepath.Join(inputDir, "recent")
@@ -474,6 +671,10 @@ func loadAllData(inputDir string) *store.Store {
 				log.Printf("Warning: parsing %s: %v", path, err)
 				continue
 			}
+			readings, report := ingest.Prepare(readings, rules, roundTo)
+			if report.Total() > 0 {
+				log.Printf("Cleaned %s: %s", path, report)
+			}
 			if len(readings) > 0 {
 				registerSensors(readings, dataStore)
 				dataStore.AddReadings(readings)
@@ -501,6 +702,10 @@ func loadAllData(inputDir string) *store.Store {
 				log.Printf("Warning: parsing %s: %v", path, err)
 				continue
 			}
+			readings, report := ingest.Prepare(readings, rules, roundTo)
+			if report.Total() > 0 {
+				log.Printf("Cleaned %s: %s", path, report)
+			}
 			if len(readings) > 0 {
 				registerSensors(readings, dataStore)
 				dataStore.AddReadings(readings)
@@ -511,7 +716,7 @@ func loadAllData(inputDir string) *store.Store {
 	return dataStore
 }
 
-func loadLegacyCSVs(dir string, s *store.Store) {
+func loadLegacyCSVs(dir string, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		log.Fatalf("Reading input directory %s: %v", dir, err)
@@ -534,6 +739,10 @@ func loadLegacyCSVs(dir string, s *store.Store) {
 		if err != nil {
 			log.Fatalf("Parsing %s: %v", path, err)
 		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("Cleaned %s: %s", path, report)
+		}
 
 		if len(readings) > 0 {
 			name := string(sensorType)
@@ -594,6 +803,45 @@ func sensorTypeFromFilename(name string) (model.SensorType, string) {
 
 // --- Helpers ---
 
+// integration holds per-sensor-type integration overrides from -integration.
+var integration map[model.SensorType]model.IntegrationMethod
+
+// nf formats numbers and money per -currency and -locale.
+var nf numfmt.Formatter
+
+// intervalAvgPower returns the mean power in W between two consecutive
+// readings. Cumulative energy counters (kWh or Wh) are differenced rather
+// than averaged, with counter resets handled by model.CounterDelta; other
+// counters (operation hours, kvarh) carry no power and yield 0.
+func intervalAvgPower(st model.SensorType, prev, cur model.Reading, hours float64) float64 {
+	if model.IsCumulative(st) {
+		unit := cur.Unit
+		if unit == "" {
+			unit = model.SensorCatalog[st].Unit
+		}
+		var whPerUnit float64
+		switch unit {
+		case "kWh":
+			whPerUnit = 1000
+		case "Wh":
+			whPerUnit = 1
+		default:
+			return 0
+		}
+		return model.CounterDelta(prev.Value, cur.Value) * whPerUnit / hours
+	}
+	m, ok := integration[st]
+	if !ok {
+		m = model.IntegrationFor(st)
+	}
+	return model.IntervalAverage(m, prev.Value, cur.Value)
+}
+
+// throughEnd widens tr so that a reading exactly at tr.End is included.
+func throughEnd(tr model.TimeRange) model.TimeRange {
+	return model.TimeRange{Start: tr.Start, End: tr.End.Add(time.Nanosecond)}
+}
+
 func sumHourly(buckets [24]HourlyBucket) (totalKWh, totalCost float64) {
 	for _, b := range buckets {
 		totalKWh += b.KWh
@@ -611,7 +859,7 @@ func safeDivide(a, b float64) float64 {
 
 func formatKWh(v float64) string {
 	if v >= 1000 {
-		return fmt.Sprintf("%.1f MWh", v/1000)
+		return nf.Number(v/1000, 1) + " MWh"
 	}
-	return fmt.Sprintf("%.1f kWh", v)
+	return nf.Number(v, 1) + " kWh"
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/numfmt"
+	"energy_simulator/internal/store"
+)
+
+// statsStore holds hourly stats rows for the heat pump: mean 1 kW, max 5 kW.
+func statsStore(t *testing.T) (*store.Store, model.TimeRange) {
+	t.Helper()
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.hp", Type: model.SensorPumpConsumption, Unit: "W"})
+	start := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for i := range 3 {
+		readings = append(readings, model.Reading{
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			SensorID:  "sensor.hp",
+			Type:      model.SensorPumpConsumption,
+			Value:     1000,
+			Min:       0,
+			Max:       5000,
+		})
+	}
+	s.AddReadings(readings)
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+	return s, tr
+}
+
+func TestAggregateByHour_StatsMaxIsPeakNotEnergy(t *testing.T) {
+	s, tr := statsStore(t)
+
+	buckets := aggregateByHour(s, model.SensorPumpConsumption, "", tr, true)
+
+	totalKWh, _ := sumHourly(buckets)
+	assert.InDelta(t, 2.0, totalKWh, 1e-9, "energy integrates the 1 kW mean")
+	assert.InDelta(t, 1.0, buckets[1].KWh, 1e-9)
+	assert.Equal(t, 5000.0, buckets[1].PeakW)
+	assert.Equal(t, 5000.0, buckets[2].PeakW)
+}
+
+func TestAggregateByHour_PeakFromMean(t *testing.T) {
+	s, tr := statsStore(t)
+
+	buckets := aggregateByHour(s, model.SensorPumpConsumption, "", tr, false)
+
+	assert.Equal(t, 1000.0, buckets[1].PeakW)
+	totalKWh, _ := sumHourly(buckets)
+	assert.InDelta(t, 2.0, totalKWh, 1e-9)
+}
+
+func TestIntervalAvgPower_IntegrationOverride(t *testing.T) {
+	prev := model.Reading{Value: 2000}
+	cur := model.Reading{Value: 0}
+	assert.Equal(t, 1000.0, intervalAvgPower(model.SensorOven, prev, cur, 1))
+
+	integration = map[model.SensorType]model.IntegrationMethod{model.SensorOven: model.IntegrateStep}
+	t.Cleanup(func() { integration = nil })
+	assert.Equal(t, 2000.0, intervalAvgPower(model.SensorOven, prev, cur, 1))
+	assert.Equal(t, 1000.0, intervalAvgPower(model.SensorWashing, prev, cur, 1))
+}
+
+func TestIntervalAvgPower_CounterUnits(t *testing.T) {
+	// A lifetime energy counter: 0.5 kWh over half an hour is 1 kW.
+	prev := model.Reading{Value: 100, Unit: "kWh"}
+	cur := model.Reading{Value: 100.5, Unit: "kWh"}
+	assert.InDelta(t, 1000, intervalAvgPower(model.SensorGridEnergyReactive, prev, cur, 0.5), 1e-9)
+	prev.Unit, cur.Unit = "Wh", "Wh"
+	assert.InDelta(t, 1, intervalAvgPower(model.SensorGridEnergyReactive, prev, cur, 0.5), 1e-9)
+
+	// Operation hours and reactive energy are not power.
+	assert.Zero(t, intervalAvgPower(model.SensorPumpHeaterRoom, model.Reading{Value: 10}, model.Reading{Value: 11}, 1))
+	assert.Zero(t, intervalAvgPower(model.SensorGridEnergyReactive, model.Reading{Value: 10}, model.Reading{Value: 11}, 1))
+}
+
+func TestFormatKWh_Locale(t *testing.T) {
+	assert.Equal(t, "1234.5 MWh", formatKWh(1234500))
+
+	var err error
+	nf, err = numfmt.New("EUR", "en")
+	require.NoError(t, err)
+	t.Cleanup(func() { nf = numfmt.Formatter{} })
+	assert.Equal(t, "1,234.5 MWh", formatKWh(1234500))
+	assert.Equal(t, "999.5 kWh", formatKWh(999.5))
+	assert.Equal(t, "1,234.57 EUR", nf.Money(1234.567))
+}
+
+// decompositionStore holds hourly data for a house with a constant 500 W base
+// load and heating of 2.4 kWh per degree-day below 15 °C, plus 2 kW of PV
+// from 10:00 to 14:00. Each day has a constant outside temperature, swinging
+// between −4 and 18 °C over 20 days.
+func decompositionStore(days int) (*store.Store, model.TimeRange) {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.temp", Type: model.SensorPumpExtTemp, Unit: "°C"})
+	start := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for h := 0; h < days*24; h++ {
+		ts := start.Add(time.Duration(h) * time.Hour)
+		temp := 7 + 11*math.Sin(2*math.Pi*float64(h/24)/20)
+		load := 500 + 2400.0/24*math.Max(0, 15-temp)
+		pv := 0.0
+		if hr := ts.Hour(); hr >= 10 && hr < 14 {
+			pv = 2000
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: load - pv},
+			model.Reading{Timestamp: ts, SensorID: "sensor.pv", Type: model.SensorPVPower, Value: pv},
+			model.Reading{Timestamp: ts, SensorID: "sensor.temp", Type: model.SensorPumpExtTemp, Value: temp},
+		)
+	}
+	s.AddReadings(readings)
+	tr, _ := s.GlobalTimeRange()
+	return s, tr
+}
+
+func TestComputeDecomposition_RecoversBaseAndHeating(t *testing.T) {
+	s, tr := decompositionStore(120)
+
+	d, ok := computeDecomposition(s, tr, 15)
+	require.True(t, ok)
+	assert.Equal(t, 120, d.Days)
+	assert.InDelta(t, 500, d.BaseLoadW, 10)
+	assert.InDelta(t, 2.4, d.KWhPerDegreeDay, 0.05)
+
+	baseShare := d.BaseKWh / d.TotalKWh
+	heatShare := d.HeatingKWh / d.TotalKWh
+	wantBase := 12.0 * float64(d.Days) / d.TotalKWh
+	assert.InDelta(t, wantBase, baseShare, 0.01)
+	assert.InDelta(t, 1-wantBase, heatShare, 0.01)
+	assert.InDelta(t, 0, (d.SeasonalKWh+d.OtherKWh)/d.TotalKWh, 0.01)
+	assert.InDelta(t, d.TotalKWh, d.BaseKWh+d.HeatingKWh+d.SeasonalKWh+d.OtherKWh, 1e-6)
+}
+
+func TestComputeDecomposition_NeedsTemperatureAndDays(t *testing.T) {
+	s, tr := decompositionStore(5)
+	_, ok := computeDecomposition(s, tr, 15)
+	assert.False(t, ok, "too few days")
+
+	noTemp := store.New()
+	noTemp.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	_, ok = computeDecomposition(noTemp, tr, 15)
+	assert.False(t, ok, "no outside temperature")
+}
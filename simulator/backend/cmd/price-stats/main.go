@@ -0,0 +1,322 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"energy_simulator/internal/ingest"
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/numfmt"
+	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/store"
+)
+
+// HistogramBin counts prices in [Lo, Hi).
+type HistogramBin struct {
+	Lo, Hi float64
+	Count  int
+}
+
+// PriceStats summarises spot-price volatility over a period.
+type PriceStats struct {
+	Count int
+	Days  int
+	Mean  float64
+	Std   float64
+	Min   float64
+	Max   float64
+
+	// AvgDailySpread is the mean of each day's max−min price.
+	AvgDailySpread float64
+	// DailyGaps holds each day's P67−P33 gap, the band the arbitrage
+	// strategy trades across, sorted ascending.
+	DailyGaps []float64
+
+	Histogram []HistogramBin
+}
+
+func main() {
+	inputDir := flag.String("input-dir", "input", "directory containing CSV data files")
+	startDate := flag.String("start", "", "start date (YYYY-MM-DD), defaults to first price reading")
+	endDate := flag.String("end", "", "end date (YYYY-MM-DD, exclusive), defaults to last price reading")
+	bins := flag.Int("bins", 10, "number of histogram bins")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them at load")
+	roundTo := flag.Duration("round-timestamps", 0, "round reading timestamps to this grid at load (e.g. 1m), keeping the last value per sensor and slot in file order (0 = off)")
+	currency := flag.String("currency", numfmt.DefaultCurrency, "currency label for prices")
+	locale := flag.String("locale", "plain", "number format: plain, en, pl, de, fr, ch (thousands/decimal separators)")
+	flag.Parse()
+
+	nf, err := numfmt.New(*currency, *locale)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+
+	dataStore := loadAllData(*inputDir, rules, *roundTo)
+
+	priceSensorID := findSensorID(dataStore, model.SensorEnergyPrice)
+	if priceSensorID == "" {
+		log.Fatal("No price sensor found")
+	}
+
+	tr, ok := dataStore.TimeRange(priceSensorID)
+	if !ok {
+		log.Fatal("No price readings loaded")
+	}
+	tr.End = tr.End.Add(time.Nanosecond)
+	if *startDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", *startDate, time.Local)
+		if err != nil {
+			log.Fatalf("Invalid start date %q: %v", *startDate, err)
+		}
+		tr.Start = t
+	}
+	if *endDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", *endDate, time.Local)
+		if err != nil {
+			log.Fatalf("Invalid end date %q: %v", *endDate, err)
+		}
+		tr.End = t
+	}
+
+	readings := dataStore.ReadingsInRange(priceSensorID, tr.Start, tr.End)
+	if len(readings) == 0 {
+		log.Fatal("No price readings in the requested range")
+	}
+
+	stats := computeStats(readings, *bins)
+	printStats(nf, stats, readings[0].Timestamp, readings[len(readings)-1].Timestamp)
+}
+
+// computeStats derives volatility statistics from time-sorted price readings.
+// Daily figures use the same per-day grouping and P33/P67 thresholds as the
+// arbitrage engine.
+func computeStats(readings []model.Reading, bins int) PriceStats {
+	var st PriceStats
+	if len(readings) == 0 {
+		return st
+	}
+
+	st.Count = len(readings)
+	st.Min = math.Inf(1)
+	st.Max = math.Inf(-1)
+	var sum float64
+	for _, r := range readings {
+		sum += r.Value
+		st.Min = min(st.Min, r.Value)
+		st.Max = max(st.Max, r.Value)
+	}
+	st.Mean = sum / float64(st.Count)
+
+	var sq float64
+	for _, r := range readings {
+		d := r.Value - st.Mean
+		sq += d * d
+	}
+	st.Std = math.Sqrt(sq / float64(st.Count))
+
+	var spreadSum float64
+	for _, day := range groupByDay(readings) {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, p := range day {
+			lo = min(lo, p)
+			hi = max(hi, p)
+		}
+		spreadSum += hi - lo
+		p33, p67 := simulator.PriceThresholds(day)
+		st.DailyGaps = append(st.DailyGaps, p67-p33)
+	}
+	st.Days = len(st.DailyGaps)
+	st.AvgDailySpread = spreadSum / float64(st.Days)
+	sort.Float64s(st.DailyGaps)
+
+	st.Histogram = histogram(readings, st.Min, st.Max, bins)
+	return st
+}
+
+// groupByDay splits time-sorted readings into per-calendar-day price slices.
+func groupByDay(readings []model.Reading) [][]float64 {
+	var days [][]float64
+	var curDay time.Time
+	for _, r := range readings {
+		day := time.Date(r.Timestamp.Year(), r.Timestamp.Month(), r.Timestamp.Day(), 0, 0, 0, 0, r.Timestamp.Location())
+		if len(days) == 0 || !day.Equal(curDay) {
+			days = append(days, nil)
+			curDay = day
+		}
+		days[len(days)-1] = append(days[len(days)-1], r.Value)
+	}
+	return days
+}
+
+// histogram bins prices into equal-width buckets over [lo, hi]. The top
+// bucket is closed so that the maximum price is counted.
+func histogram(readings []model.Reading, lo, hi float64, bins int) []HistogramBin {
+	if bins <= 0 {
+		return nil
+	}
+	width := (hi - lo) / float64(bins)
+	if width <= 0 {
+		return []HistogramBin{{Lo: lo, Hi: hi, Count: len(readings)}}
+	}
+
+	out := make([]HistogramBin, bins)
+	for i := range out {
+		out[i].Lo = lo + float64(i)*width
+		out[i].Hi = lo + float64(i+1)*width
+	}
+	for _, r := range readings {
+		idx := int((r.Value - lo) / width)
+		if idx >= bins {
+			idx = bins - 1
+		}
+		out[idx].Count++
+	}
+	return out
+}
+
+// percentile returns the p-th percentile (0-100) of sorted values.
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// --- Output formatting ---
+
+func printStats(nf numfmt.Formatter, st PriceStats, first, last time.Time) {
+	fmt.Println()
+	fmt.Println("Spot Price Statistics")
+	fmt.Printf("  Data: %s to %s (%d days, %d readings)\n",
+		first.Format("2006-01-02"), last.Format("2006-01-02"), st.Days, st.Count)
+	fmt.Println()
+
+	unit := nf.PerKWh()
+	fmt.Printf("  Mean:   %7s %s\n", nf.Number(st.Mean, 3), unit)
+	fmt.Printf("  Std:    %7s %s\n", nf.Number(st.Std, 3), unit)
+	fmt.Printf("  Min:    %7s %s\n", nf.Number(st.Min, 3), unit)
+	fmt.Printf("  Max:    %7s %s\n", nf.Number(st.Max, 3), unit)
+	fmt.Println()
+
+	fmt.Printf("  Avg daily spread (max−min): %s %s\n", nf.Number(st.AvgDailySpread, 3), unit)
+	fmt.Println("  Daily P33/P67 gap (arbitrage band):")
+	fmt.Printf("    P10: %s   P50: %s   P90: %s   max: %s %s\n",
+		nf.Number(percentile(st.DailyGaps, 10), 3), nf.Number(percentile(st.DailyGaps, 50), 3),
+		nf.Number(percentile(st.DailyGaps, 90), 3), nf.Number(percentile(st.DailyGaps, 100), 3), unit)
+	fmt.Println()
+
+	printHistogram(nf, st.Histogram, st.Count)
+	fmt.Println()
+}
+
+func printHistogram(nf numfmt.Formatter, bins []HistogramBin, total int) {
+	fmt.Println("  Price Distribution:")
+	fmt.Printf("   %17s │ %7s │ %5s\n", nf.PerKWh(), "Count", "Share")
+	fmt.Printf("  ──────────────────┼─────────┼──────────────────────────────\n")
+
+	maxCount := 0
+	for _, b := range bins {
+		maxCount = max(maxCount, b.Count)
+	}
+	for _, b := range bins {
+		share := 0.0
+		if total > 0 {
+			share = float64(b.Count) / float64(total) * 100
+		}
+		bar := 0
+		if maxCount > 0 {
+			bar = b.Count * 20 / maxCount
+		}
+		fmt.Printf("   %7s to %6s │ %7d │ %4.1f%% %s\n",
+			nf.Number(b.Lo, 3), nf.Number(b.Hi, 3), b.Count, share, strings.Repeat("█", bar))
+	}
+}
+
+// --- Data loading ---
+
+// loadAllData loads the multi-sensor recent and stats CSVs, which carry the
+// spot price sensor.
+func loadAllData(inputDir string, rules ingest.SanitizeRules, roundTo time.Duration) *store.Store {
+	dataStore := store.New()
+
+	loadDir(filepath.Join(inputDir, "recent"), &ingest.RecentParser{}, dataStore, rules, roundTo)
+	loadDir(filepath.Join(inputDir, "stats"), &ingest.StatsParser{}, dataStore, rules, roundTo)
+
+	return dataStore
+}
+
+func loadDir(dir string, parser ingest.Parser, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".csv") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Warning: opening %s: %v", path, err)
+			continue
+		}
+		readings, err := parser.Parse(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Warning: parsing %s: %v", path, err)
+			continue
+		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("Cleaned %s: %s", path, report)
+		}
+		if len(readings) > 0 {
+			registerSensors(readings, s)
+			s.AddReadings(readings)
+		}
+	}
+}
+
+func registerSensors(readings []model.Reading, s *store.Store) {
+	seen := make(map[model.SensorType]bool)
+	for _, r := range readings {
+		if seen[r.Type] {
+			continue
+		}
+		seen[r.Type] = true
+
+		name := string(r.Type)
+		unit := r.Unit
+		if info, ok := model.SensorCatalog[r.Type]; ok {
+			name = info.Name
+			unit = info.Unit
+		}
+		s.AddSensor(model.Sensor{
+			ID:   r.SensorID,
+			Name: name,
+			Type: r.Type,
+			Unit: unit,
+		})
+	}
+}
+
+func findSensorID(s *store.Store, st model.SensorType) string {
+	for _, sensor := range s.Sensors() {
+		if sensor.Type == st {
+			return sensor.ID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+)
+
+// hourlyPrices builds hourly readings over days, with price(day, hour).
+func hourlyPrices(days int, price func(d, h int) float64) []model.Reading {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	var out []model.Reading
+	for d := 0; d < days; d++ {
+		for h := 0; h < 24; h++ {
+			out = append(out, model.Reading{
+				Timestamp: start.Add(time.Duration(d*24+h) * time.Hour),
+				SensorID:  "sensor.spotprice_now",
+				Type:      model.SensorEnergyPrice,
+				Value:     price(d, h),
+			})
+		}
+	}
+	return out
+}
+
+func TestComputeStats_FlatVsVolatile(t *testing.T) {
+	flat := computeStats(hourlyPrices(7, func(int, int) float64 { return 0.5 }), 10)
+	volatile := computeStats(hourlyPrices(7, func(_, h int) float64 {
+		if h >= 16 {
+			return 1.2
+		}
+		if h < 8 {
+			return 0.1
+		}
+		return 0.5
+	}), 10)
+
+	assert.Equal(t, 7, flat.Days)
+	assert.InDelta(t, 0.5, flat.Mean, 1e-9)
+	assert.InDelta(t, 0, flat.Std, 1e-9)
+	assert.InDelta(t, 0, flat.AvgDailySpread, 1e-9)
+	for _, g := range flat.DailyGaps {
+		assert.InDelta(t, 0, g, 1e-9)
+	}
+
+	assert.Equal(t, 7, volatile.Days)
+	assert.InDelta(t, 1.1, volatile.AvgDailySpread, 1e-9)
+	assert.Greater(t, volatile.Std, flat.Std)
+	assert.Greater(t, volatile.AvgDailySpread, flat.AvgDailySpread)
+	require.Len(t, volatile.DailyGaps, 7)
+	assert.InDelta(t, 0.4, volatile.DailyGaps[0], 1e-9)
+}
+
+func TestComputeStats_Histogram(t *testing.T) {
+	readings := hourlyPrices(1, func(_, h int) float64 { return float64(h) })
+	st := computeStats(readings, 4)
+
+	require.Len(t, st.Histogram, 4)
+	total := 0
+	for _, b := range st.Histogram {
+		total += b.Count
+	}
+	assert.Equal(t, 24, total)
+	assert.Equal(t, 0.0, st.Histogram[0].Lo)
+	assert.Equal(t, 23.0, st.Histogram[3].Hi)
+}
+
+func TestComputeStats_FlatHistogramSingleBin(t *testing.T) {
+	st := computeStats(hourlyPrices(2, func(int, int) float64 { return 0.3 }), 10)
+	require.Len(t, st.Histogram, 1)
+	assert.Equal(t, 48, st.Histogram[0].Count)
+}
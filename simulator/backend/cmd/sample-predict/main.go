@@ -8,15 +8,28 @@
 //	sample-predict
 //	sample-predict -anomaly 1.0
 //	sample-predict -hours 72 -clean
+//	sample-predict -start-date 2025-01-01 -hours 744
+//	sample-predict -replay input/stats/export.csv -csv
 //	sample-predict -temp-model model/temperature.json -power-model model/grid_power.json
+//
+// With -replay, a stats or recent CSV is backtested instead: for every hour
+// with an actual outside temperature, the clean temperature prediction and the
+// power prediction (from the actual temperature) are printed next to the
+// measured values with running RMSE.
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"sort"
 	"time"
 
+	"energy_simulator/internal/ingest"
+	"energy_simulator/internal/model"
 	"energy_simulator/internal/predictor"
 )
 
@@ -24,12 +37,24 @@ func main() {
 	tempModelPath := flag.String("temp-model", "model/temperature.json", "path to temperature model JSON")
 	powerModelPath := flag.String("power-model", "model/grid_power.json", "path to power model JSON")
 	hours := flag.Int("hours", 48, "number of hours to predict")
+	startDate := flag.String("start-date", "", "first predicted hour (YYYY-MM-DD or YYYY-MM-DDTHH:MM, local time); defaults to now")
 	anomaly := flag.Float64("anomaly", 0, "temperature anomaly (0=normal, +1=warmer by 0.1-3°C)")
 	clean := flag.Bool("clean", false, "omit noise (deterministic output)")
 	seed := flag.Uint64("seed", 0, "random seed for noise (0 = use current time)")
 	csvOut := flag.Bool("csv", false, "output as CSV")
+	replayPath := flag.String("replay", "", "stats or recent CSV to backtest predictions against")
 	flag.Parse()
 
+	start := time.Now()
+	if *startDate != "" {
+		var err error
+		start, err = parseStartDate(*startDate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Load temperature model.
 	tempData, err := os.ReadFile(*tempModelPath)
 	if err != nil {
@@ -60,51 +85,198 @@ func main() {
 		os.Exit(1)
 	}
 
-	now := time.Now()
+	if *replayPath != "" {
+		readings, err := loadReplay(*replayPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading replay CSV: %v\n", err)
+			os.Exit(1)
+		}
+		points := hourlyActuals(readings)
+		if len(points) == 0 {
+			fmt.Fprintln(os.Stderr, "Replay CSV contains no outside temperature readings.")
+			os.Exit(1)
+		}
+		writeReplay(os.Stdout, tempPred, powerPred, points, *anomaly, *csvOut)
+		return
+	}
+
+	writePredictions(os.Stdout, tempPred, powerPred, start, *hours, *anomaly, *clean, *csvOut)
+}
 
-	if !*csvOut {
-		fmt.Printf("Generating %d hours of predictions starting from %s\n", *hours, now.Format("2006-01-02 15:04"))
-		fmt.Printf("Anomaly: %.1f\n", *anomaly)
-		if *clean {
-			fmt.Println("Mode: clean (no noise)")
+// parseStartDate parses a -start-date value in local time.
+func parseStartDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid start date %q (want YYYY-MM-DD or YYYY-MM-DDTHH:MM)", s)
+}
+
+// writePredictions chains the temperature NN into the power NN for hours
+// consecutive hours beginning at start.
+func writePredictions(w io.Writer, tempPred *predictor.TemperaturePredictor, powerPred *predictor.EnergyPredictor,
+	start time.Time, hours int, anomaly float64, clean, csvOut bool) {
+	if !csvOut {
+		fmt.Fprintf(w, "Generating %d hours of predictions starting from %s\n", hours, start.Format("2006-01-02 15:04"))
+		fmt.Fprintf(w, "Anomaly: %.1f\n", anomaly)
+		if clean {
+			fmt.Fprintln(w, "Mode: clean (no noise)")
 		} else {
-			fmt.Println("Mode: with noise")
+			fmt.Fprintln(w, "Mode: with noise")
 		}
-		fmt.Println()
-		fmt.Printf("%-20s  %9s  %9s\n", "Time", "Temp (°C)", "Power (W)")
-		fmt.Printf("%-20s  %9s  %9s\n", "--------------------", "---------", "---------")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%-20s  %9s  %9s\n", "Time", "Temp (°C)", "Power (W)")
+		fmt.Fprintf(w, "%-20s  %9s  %9s\n", "--------------------", "---------", "---------")
 	} else {
-		fmt.Println("timestamp,temp_c,power_w")
+		fmt.Fprintln(w, "timestamp,temp_c,power_w")
 	}
 
 	// Generate temperature sequence (correlated noise + rate constraints).
-	startDay := now.YearDay()
-	startHour := now.Hour()
+	startDay := start.YearDay()
+	startHour := start.Hour()
 	var temps []float64
-	if *clean {
-		temps = tempPred.PredictCleanSequence(startDay, startHour, *hours, *anomaly)
+	if clean {
+		temps = tempPred.PredictCleanSequence(startDay, startHour, hours, anomaly)
 	} else {
-		temps = tempPred.PredictSequence(startDay, startHour, *hours, *anomaly)
+		temps = tempPred.PredictSequence(startDay, startHour, hours, anomaly)
 	}
 
 	// Feed each temperature into the power model.
-	for i := 0; i < *hours; i++ {
-		t := now.Add(time.Duration(i) * time.Hour)
+	for i := 0; i < hours; i++ {
+		t := start.Add(time.Duration(i) * time.Hour)
 		month := int(t.Month())
 		hour := t.Hour()
 		temp := temps[i]
 
 		var power float64
-		if *clean {
+		if clean {
 			power = powerPred.PredictClean(month, hour, temp)
 		} else {
 			power = powerPred.Predict(month, hour, temp)
 		}
 
-		if *csvOut {
-			fmt.Printf("%s,%.1f,%.1f\n", t.Format(time.RFC3339), temp, power)
+		if csvOut {
+			fmt.Fprintf(w, "%s,%.1f,%.1f\n", t.Format(time.RFC3339), temp, power)
+		} else {
+			fmt.Fprintf(w, "%-20s  %9.1f  %9.0f\n", t.Format("2006-01-02 15:04"), temp, power)
+		}
+	}
+}
+
+// replayPoint holds the actual hourly values for one backtest step.
+type replayPoint struct {
+	t        time.Time
+	temp     float64
+	power    float64
+	hasPower bool
+}
+
+// loadReplay parses a stats CSV, falling back to the recent CSV format.
+func loadReplay(path string) ([]model.Reading, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	readings, err := (&ingest.StatsParser{}).Parse(bytes.NewReader(data))
+	if err == nil {
+		return readings, nil
+	}
+	readings, recentErr := (&ingest.RecentParser{}).Parse(bytes.NewReader(data))
+	if recentErr != nil {
+		return nil, fmt.Errorf("not a stats CSV (%v) or recent CSV (%v)", err, recentErr)
+	}
+	return readings, nil
+}
+
+// hourlyActuals averages outside temperature and grid power per hour and
+// returns the hours that have a temperature, in time order.
+func hourlyActuals(readings []model.Reading) []replayPoint {
+	type acc struct {
+		tempSum, powerSum float64
+		nTemp, nPower     int
+	}
+	byHour := make(map[time.Time]*acc)
+	for _, r := range readings {
+		if r.Type != model.SensorPumpExtTemp && r.Type != model.SensorGridPower {
+			continue
+		}
+		h := r.Timestamp.Truncate(time.Hour)
+		a := byHour[h]
+		if a == nil {
+			a = &acc{}
+			byHour[h] = a
+		}
+		if r.Type == model.SensorPumpExtTemp {
+			a.tempSum += r.Value
+			a.nTemp++
+		} else {
+			a.powerSum += r.Value
+			a.nPower++
+		}
+	}
+
+	var points []replayPoint
+	for h, a := range byHour {
+		if a.nTemp == 0 {
+			continue
+		}
+		p := replayPoint{t: h, temp: a.tempSum / float64(a.nTemp)}
+		if a.nPower > 0 {
+			p.power = a.powerSum / float64(a.nPower)
+			p.hasPower = true
+		}
+		points = append(points, p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].t.Before(points[j].t) })
+	return points
+}
+
+// writeReplay prints clean predictions against actual values with running
+// RMSE. Power is predicted from the actual temperature so that its error
+// reflects the power model alone; hours without grid power leave the power
+// columns empty.
+func writeReplay(w io.Writer, tempPred *predictor.TemperaturePredictor, powerPred *predictor.EnergyPredictor,
+	points []replayPoint, anomaly float64, csvOut bool) {
+	if csvOut {
+		fmt.Fprintln(w, "timestamp,temp_actual_c,temp_pred_c,power_actual_w,power_pred_w,temp_rmse_c,power_rmse_w")
+	} else {
+		fmt.Fprintf(w, "Backtesting %d hours from %s to %s\n", len(points),
+			points[0].t.Format("2006-01-02 15:04"), points[len(points)-1].t.Format("2006-01-02 15:04"))
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%-20s  %7s  %7s  %8s  %8s  %9s  %10s\n",
+			"Time", "T act", "T pred", "P act", "P pred", "T RMSE", "P RMSE")
+		fmt.Fprintf(w, "%-20s  %7s  %7s  %8s  %8s  %9s  %10s\n",
+			"--------------------", "-------", "-------", "--------", "--------", "---------", "----------")
+	}
+
+	var tempSqSum, powerSqSum float64
+	var nPower int
+	for i, p := range points {
+		tempPredC := tempPred.PredictClean(p.t.YearDay(), p.t.Hour(), anomaly)
+		dt := tempPredC - p.temp
+		tempSqSum += dt * dt
+		tempRMSE := math.Sqrt(tempSqSum / float64(i+1))
+
+		powerAct, powerPredW, powerRMSE := "", "", ""
+		if p.hasPower {
+			pw := powerPred.PredictClean(int(p.t.Month()), p.t.Hour(), p.temp)
+			dp := pw - p.power
+			powerSqSum += dp * dp
+			nPower++
+			powerAct = fmt.Sprintf("%.0f", p.power)
+			powerPredW = fmt.Sprintf("%.0f", pw)
+		}
+		if nPower > 0 {
+			powerRMSE = fmt.Sprintf("%.0f", math.Sqrt(powerSqSum/float64(nPower)))
+		}
+
+		if csvOut {
+			fmt.Fprintf(w, "%s,%.1f,%.1f,%s,%s,%.2f,%s\n", p.t.Format(time.RFC3339),
+				p.temp, tempPredC, powerAct, powerPredW, tempRMSE, powerRMSE)
 		} else {
-			fmt.Printf("%-20s  %9.1f  %9.0f\n", t.Format("2006-01-02 15:04"), temp, power)
+			fmt.Fprintf(w, "%-20s  %7.1f  %7.1f  %8s  %8s  %9.2f  %10s\n", p.t.Format("2006-01-02 15:04"),
+				p.temp, tempPredC, powerAct, powerPredW, tempRMSE, powerRMSE)
 		}
 	}
 }
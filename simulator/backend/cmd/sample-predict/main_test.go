@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/predictor"
+)
+
+// Single linear layers: temperature is 5°C + anomaly, power is 500 W + 100 W/°C.
+const (
+	testTempModel = `{
+		"network": {"layers": [{"weights": [[0, 0, 0, 0, 1]], "biases": [0]}]},
+		"normalization": {"temp_mean": 5, "temp_std": 1}
+	}`
+	testPowerModel = `{
+		"network": {"layers": [{"weights": [[0, 0, 0, 0, 1]], "biases": [0]}]},
+		"normalization": {"temp_mean": 0, "temp_std": 1, "power_mean": 500, "power_std": 100}
+	}`
+)
+
+func loadTestModels(t *testing.T) (*predictor.TemperaturePredictor, *predictor.EnergyPredictor) {
+	t.Helper()
+	tempPred, err := predictor.LoadTemperaturePredictor([]byte(testTempModel), 1)
+	require.NoError(t, err)
+	powerPred, err := predictor.LoadPredictor([]byte(testPowerModel), 2)
+	require.NoError(t, err)
+	return tempPred, powerPred
+}
+
+func TestParseStartDate(t *testing.T) {
+	d, err := parseStartDate("2026-01-15")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 15, 0, 0, 0, 0, time.Local), d)
+
+	dt, err := parseStartDate("2026-01-15T06:00")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 15, 6, 0, 0, 0, time.Local), dt)
+
+	_, err = parseStartDate("next january")
+	assert.Error(t, err)
+}
+
+func TestWritePredictions_StartsAtRequestedDate(t *testing.T) {
+	tempPred, powerPred := loadTestModels(t)
+	start, err := parseStartDate("2027-01-01")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writePredictions(&buf, tempPred, powerPred, start, 3, 0, true, true)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "timestamp,temp_c,power_w", lines[0])
+	assert.Equal(t, start.Format(time.RFC3339)+",5.0,1000.0", lines[1])
+	assert.True(t, strings.HasPrefix(lines[3], start.Add(2*time.Hour).Format(time.RFC3339)))
+}
+
+func TestWriteReplay_RMSEColumns(t *testing.T) {
+	tempPred, powerPred := loadTestModels(t)
+	readings, err := loadReplay("../../testdata/replay_sample.csv")
+	require.NoError(t, err)
+	points := hourlyActuals(readings)
+	require.Len(t, points, 3)
+
+	var buf bytes.Buffer
+	writeReplay(&buf, tempPred, powerPred, points, 0, true)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "timestamp,temp_actual_c,temp_pred_c,power_actual_w,power_pred_w,temp_rmse_c,power_rmse_w", lines[0])
+
+	var tempRMSE, powerRMSE []float64
+	for _, line := range lines[1:] {
+		cols := strings.Split(line, ",")
+		require.Len(t, cols, 7)
+		tr, err := strconv.ParseFloat(cols[5], 64)
+		require.NoError(t, err)
+		pr, err := strconv.ParseFloat(cols[6], 64)
+		require.NoError(t, err)
+		assert.False(t, math.IsNaN(tr) || math.IsInf(tr, 0))
+		assert.False(t, math.IsNaN(pr) || math.IsInf(pr, 0))
+		tempRMSE = append(tempRMSE, tr)
+		powerRMSE = append(powerRMSE, pr)
+	}
+
+	// Predicted temp is a constant 5°C against actuals of 4, 6 and 5.
+	assert.InDelta(t, 1.0, tempRMSE[0], 1e-9)
+	assert.InDelta(t, 1.0, tempRMSE[1], 1e-9)
+	assert.InDelta(t, math.Sqrt(2.0/3.0), tempRMSE[2], 0.01)
+	// Power 900 W vs 1200 W, then 1100 W vs 900 W; the last hour has no power.
+	assert.Equal(t, 300.0, powerRMSE[0])
+	assert.Equal(t, 255.0, powerRMSE[1])
+	assert.Equal(t, 255.0, powerRMSE[2])
+	last := strings.Split(lines[3], ",")
+	assert.Empty(t, last[3])
+	assert.Empty(t, last[4])
+}
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"energy_simulator/internal/ingest"
+	"energy_simulator/internal/metrics"
 	"energy_simulator/internal/model"
+	"energy_simulator/internal/numfmt"
 	"energy_simulator/internal/predictor"
 	"energy_simulator/internal/simulator"
 	"energy_simulator/internal/store"
@@ -20,28 +31,63 @@ import (
 
 func main() {
 	inputDir := flag.String("input-dir", "input", "directory containing CSV data files")
+	inputDirs := flag.String("input-dirs", "", "comma-separated input directories merged in order, later winning on duplicate readings (overrides -input-dir)")
 	frontendDir := flag.String("frontend-dir", "simulator/frontend/build", "directory containing frontend build")
 	addr := flag.String("addr", ":8080", "listen address")
+	originsFlag := flag.String("allowed-origins", "", "comma-separated extra origins allowed to open /ws, \"*\" for any (overrides WS_ALLOWED_ORIGINS)")
+	tokenFlag := flag.String("token", "", "bearer token required for /ws (overrides WS_TOKEN)")
+	rangesFile := flag.String("ranges-file", "", "JSON file persisting named replay ranges (in-memory if empty)")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings (e.g. 99999 W spikes) instead of dropping them at load")
+	roundTo := flag.Duration("round-timestamps", 0, "round reading timestamps to this grid at load (e.g. 1m), keeping the last value per sensor and slot in file order (0 = off)")
+	integrationFlag := flag.String("integration", "", "per-sensor energy integration overrides, e.g. oven=step,washing=step (trapezoid, left, right, step)")
+	auditFile := flag.String("audit-csv", "", "write one CSV row per grid interval (power, price, Wh, cost, battery) to this file for auditing")
+	tickInterval := flag.Duration("tick", 100*time.Millisecond, "live update interval of the replay loop (min 10ms); raise to save CPU")
+	kwhDecimals := flag.Int("kwh-decimals", 3, "decimal places of kWh figures in summaries (-1 = unrounded); money is always rounded to 0.01 PLN")
+	currency := flag.String("currency", numfmt.DefaultCurrency, "currency label carried in summary JSON; prices in the data are used as-is")
+	endFlag := flag.String("end", string(simulator.EndStop), "what the replay does at the end of the data: stop, loop (restart from the beginning) or hold")
+	calibrateFlag := flag.String("calibrate", "", "per-sensor calibration applied on read, e.g. sensor.pv=1.03,sensor.grid=1:-5 (sensor_id=scale[:offset])")
+	defaultCOP := flag.Bool("default-cop-curve", false, "model the pre-heating heat pump with a typical air-to-water COP curve instead of a flat COP of 1 when no production data gives a measured COP (cop_curve in config:update overrides it)")
+	sendQueue := flag.Int("ws-send-queue", ws.DefaultSendQueue, "per-client WebSocket send queue length; a client more than 3/4 behind skips sensor readings")
 	flag.Parse()
 
-	// Load CSV data
-	dataStore := store.New()
-	sourceRanges := make(map[string]model.TimeRange)
-
-	legacyRange, err := loadCSVs(*inputDir, dataStore)
+	integration, err := model.ParseIntegrationOverrides(*integrationFlag)
 	if err != nil {
-		log.Fatalf("Failed to load CSV data: %v", err)
+		log.Fatal(err)
 	}
-
-	statsRange, _, err := loadMultiSensorCSVs(filepath.Join(*inputDir, "stats"), &ingest.StatsParser{}, dataStore)
+	endBehavior, err := simulator.ParseEndBehavior(*endFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	calibrations, err := store.ParseCalibrations(*calibrateFlag)
 	if err != nil {
-		log.Printf("Stats data: %v", err)
+		log.Fatal(err)
 	}
 
-	recentRange, recentGPRange, err := loadMultiSensorCSVs(filepath.Join(*inputDir, "recent"), &ingest.RecentParser{}, dataStore)
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+
+	// Load CSV data
+	dirs := []string{*inputDir}
+	if *inputDirs != "" {
+		dirs = splitList(*inputDirs)
+	}
+	dataStore, loaded, err := loadInputDirs(dirs, rules, *roundTo)
 	if err != nil {
-		log.Printf("Recent data: %v", err)
+		log.Fatalf("Failed to load CSV data: %v", err)
+	}
+	for id, c := range calibrations {
+		dataStore.SetCalibration(id, c.Scale, c.Offset)
+	}
+	// Three-phase meters without a total: sum the phases into grid_power for
+	// energy and costs; the engine keeps the phases for imbalance.
+	if simulator.SumGridPhases(dataStore) {
+		log.Printf("Summed grid phases into %s", simulator.PhaseSumSensorID)
 	}
+	sourceRanges := make(map[string]model.TimeRange)
+	legacyRange, statsRange := loaded.legacy, loaded.stats
+	recentRange, recentGPRange := loaded.recent, loaded.recentGridPower
 
 	// Build archival range (legacy + stats)
 	archivalRange := mergeTimeRanges(legacyRange, statsRange)
@@ -74,12 +120,25 @@ func main() {
 
 	// Set up WebSocket hub and simulator
 	hub := ws.NewHub()
+	hub.SetSendQueue(*sendQueue)
 	bridge := ws.NewBridge(hub)
-	engine := simulator.New(dataStore, bridge)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	engine := simulator.New(dataStore, metrics.NewCallback(bridge, registry))
 	if !engine.Init() {
 		log.Fatal("Failed to initialize simulation engine")
 	}
 	engine.SetTimeRange(tr)
+	engine.SetTickInterval(*tickInterval)
+	engine.SetEndBehavior(endBehavior)
+	engine.SetKWhDecimals(*kwhDecimals)
+	engine.SetCurrency(*currency)
+	if *defaultCOP {
+		engine.SetCOPCurve(simulator.DefaultCOPCurve)
+	}
+	for st, m := range integration {
+		engine.SetIntegrationMethod(st, m)
+	}
 
 	// Configure price sensor for cost tracking
 	if priceID := findSensorID(dataStore, model.SensorEnergyPrice); priceID != "" {
@@ -93,10 +152,51 @@ func main() {
 		log.Printf("Temperature sensor configured: %s", tempID)
 	}
 
+	// Configure indoor temperature sensor for thermal model validation
+	for _, st := range []model.SensorType{model.SensorNetatmoLivingTemp, model.SensorNetatmoTemp} {
+		if indoorID := findSensorID(dataStore, st); indoorID != "" {
+			engine.SetIndoorTempSensor(indoorID)
+			log.Printf("Indoor temperature sensor configured: %s", indoorID)
+			break
+		}
+	}
+
+	// Estimate building heat loss instead of relying on a guessed insulation level
+	if est, ok := simulator.EstimateHeatLoss(dataStore, tr); ok {
+		engine.SetInsulationLevel(est.Level)
+		log.Printf("Heat loss estimated: %.0f W/°C over %d days → insulation %s", est.HeatLossWC, est.Days, est.Level)
+	}
+
+	if *auditFile != "" {
+		f, err := os.Create(*auditFile)
+		if err != nil {
+			log.Fatalf("Creating audit file: %v", err)
+		}
+		defer f.Close()
+		engine.SetAuditWriter(f)
+		log.Printf("Writing interval audit to %s", *auditFile)
+	}
+
 	// Attempt to load NN models for prediction mode
 	loadPredictionModels(engine, dataStore)
+	logCapabilities(engine.Capabilities())
 
 	handler := ws.NewHandler(hub, engine, sourceRanges)
+	access := ws.AccessConfig{
+		AllowedOrigins: splitList(resolveFlag(*originsFlag, "WS_ALLOWED_ORIGINS")),
+		Token:          resolveFlag(*tokenFlag, "WS_TOKEN"),
+	}
+	handler.SetAccess(access)
+	if access.Token == "" {
+		log.Printf("WebSocket auth disabled (no -token / WS_TOKEN)")
+	}
+	if *rangesFile != "" {
+		namedRanges, err := ws.LoadNamedRanges(*rangesFile)
+		if err != nil {
+			log.Fatalf("Named ranges: %v", err)
+		}
+		handler.SetNamedRanges(namedRanges)
+	}
 
 	// Routes
 	mux := http.NewServeMux()
@@ -104,6 +204,10 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, "ok")
 	})
+	mux.HandleFunc("GET /summary", summaryHandler(engine))
+	mux.HandleFunc("GET /state", stateHandler(engine))
+	mux.HandleFunc("GET /schemes", schemesHandler(engine))
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 	mux.Handle("/ws", handler)
 
 	// Serve frontend static files
@@ -112,15 +216,163 @@ func main() {
 		mux.Handle("/", http.FileServer(http.Dir(*frontendDir)))
 	}
 
-	log.Printf("Starting server on %s", *addr)
-	if err := http.ListenAndServe(*addr, mux); err != nil {
-		log.Fatal(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP reloads the recent directory, e.g. after ha-fetch-history runs.
+	// With several input directories the last one, which wins on merge, is
+	// the live one.
+	go watchReload(ctx, filepath.Join(dirs[len(dirs)-1], "recent"), dataStore, handler, rules, *roundTo)
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	srv.RegisterOnShutdown(hub.CloseAll)
+
+	go func() {
+		log.Printf("Starting server on %s", *addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down...")
+	engine.Stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown error: %v", err)
 	}
 }
 
+func resolveFlag(flagVal, envKey string) string {
+	if flagVal != "" {
+		return flagVal
+	}
+	return os.Getenv(envKey)
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// summaryHandler serves the current energy summary in the same shape as summary:update.
+func summaryHandler(engine *simulator.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, ws.SummaryFromEngine(engine.CurrentSummary()))
+	}
+}
+
+// stateHandler serves the current simulation state in the same shape as sim:state.
+func stateHandler(engine *simulator.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, ws.SimStateFromEngine(engine.State()))
+	}
+}
+
+// schemesHandler serves the net-metering vs net-billing comparison of the
+// replay so far, with per-month costs and the cheaper scheme.
+func schemesHandler(engine *simulator.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, ws.SchemeComparisonFromEngine(engine.SchemeComparison()))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+// watchReload appends readings from dir to the store on each SIGHUP and
+// extends the "current" and "all" sources to the new grid power end.
+func watchReload(ctx context.Context, dir string, s *store.Store, handler *ws.Handler, rules ingest.SanitizeRules, roundTo time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			end, err := reloadRecent(dir, s, rules, roundTo)
+			if err != nil {
+				log.Printf("Reload failed: %v", err)
+				continue
+			}
+			if !end.IsZero() {
+				handler.ExtendData(end, "current", "all")
+				log.Printf("Reloaded %s: data extended to %s", dir, end.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// reloadRecent re-reads the recent directory into the store and extends the
+// phase sum of a three-phase install over the appended readings. Returns the
+// latest grid power timestamp seen (zero if none).
+func reloadRecent(dir string, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) (time.Time, error) {
+	_, gridPower, err := loadMultiSensorCSVs(dir, &ingest.RecentParser{}, s, rules, roundTo)
+	if err != nil {
+		return time.Time{}, err
+	}
+	end := gridPower.End
+	if sumEnd, ok := simulator.ExtendGridPhaseSum(s); ok && sumEnd.After(end) {
+		end = sumEnd
+	}
+	return end, nil
+}
+
+// loadedRanges holds the time ranges covered by each kind of input data.
+type loadedRanges struct {
+	legacy, stats           model.TimeRange
+	recent, recentGridPower model.TimeRange
+}
+
+// loadInputDirs loads each input directory (legacy CSVs plus the stats and
+// recent subdirectories) into its own store and merges them in order, so a
+// later directory wins on a duplicate sensor and timestamp.
+func loadInputDirs(dirs []string, rules ingest.SanitizeRules, roundTo time.Duration) (*store.Store, loadedRanges, error) {
+	merged := store.New()
+	var ranges loadedRanges
+	for _, dir := range dirs {
+		s := store.New()
+		legacy, err := loadCSVs(dir, s, rules, roundTo)
+		if err != nil {
+			return nil, ranges, fmt.Errorf("%s: %w", dir, err)
+		}
+		stats, _, err := loadMultiSensorCSVs(filepath.Join(dir, "stats"), &ingest.StatsParser{}, s, rules, roundTo)
+		if err != nil {
+			log.Printf("Stats data: %v", err)
+		}
+		recent, recentGP, err := loadMultiSensorCSVs(filepath.Join(dir, "recent"), &ingest.RecentParser{}, s, rules, roundTo)
+		if err != nil {
+			log.Printf("Recent data: %v", err)
+		}
+
+		merged.Merge(s)
+		ranges.legacy = mergeTimeRanges(ranges.legacy, legacy)
+		ranges.stats = mergeTimeRanges(ranges.stats, stats)
+		ranges.recent = mergeTimeRanges(ranges.recent, recent)
+		ranges.recentGridPower = mergeTimeRanges(ranges.recentGridPower, recentGP)
+	}
+	return merged, ranges, nil
+}
+
 // loadCSVs loads legacy per-sensor CSV files from the root input directory.
+// Readings outside rules are dropped or clamped (nil rules disable
+// sanitizing) and timestamps are rounded to roundTo (0 leaves them as parsed).
 // Returns the combined time range of all loaded readings.
-func loadCSVs(dir string, s *store.Store) (model.TimeRange, error) {
+func loadCSVs(dir string, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) (model.TimeRange, error) {
 	var tr model.TimeRange
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -148,6 +400,10 @@ func loadCSVs(dir string, s *store.Store) (model.TimeRange, error) {
 		if err != nil {
 			return tr, fmt.Errorf("parsing %s: %w", path, err)
 		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("  Cleaned %s: %s", entry.Name(), report)
+		}
 
 		if len(readings) > 0 {
 			name := string(sensorType)
@@ -171,8 +427,10 @@ func loadCSVs(dir string, s *store.Store) (model.TimeRange, error) {
 
 // loadMultiSensorCSVs loads CSV files from a subdirectory using a multi-sensor
 // parser (StatsParser or RecentParser). It registers any new sensors discovered.
+// Readings outside rules are dropped or clamped (nil rules disable
+// sanitizing) and timestamps are rounded to roundTo (0 leaves them as parsed).
 // Returns the combined time range and the grid-power-only time range.
-func loadMultiSensorCSVs(dir string, p interface{ Parse(io.Reader) ([]model.Reading, error) }, s *store.Store) (all, gridPower model.TimeRange, err error) {
+func loadMultiSensorCSVs(dir string, p interface{ Parse(io.Reader) ([]model.Reading, error) }, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) (all, gridPower model.TimeRange, err error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return all, gridPower, fmt.Errorf("reading directory %s: %w", dir, err)
@@ -196,10 +454,14 @@ func loadMultiSensorCSVs(dir string, p interface{ Parse(io.Reader) ([]model.Read
 		if err != nil {
 			return all, gridPower, fmt.Errorf("parsing %s: %w", path, err)
 		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("  Cleaned %s: %s", entry.Name(), report)
+		}
 
 		if len(readings) > 0 {
 			registerSensorsFromReadings(readings, s)
-			s.AddReadings(readings)
+			s.AppendReadings(readings)
 			all = extendTimeRange(all, readings)
 			for _, r := range readings {
 				if r.Type == model.SensorGridPower {
@@ -317,6 +579,18 @@ func loadPredictionModels(engine *simulator.Engine, s *store.Store) {
 	log.Printf("NN prediction models loaded successfully")
 }
 
+// logCapabilities reports which optional features are available with the loaded data.
+func logCapabilities(caps []simulator.Capability) {
+	log.Printf("Capabilities:")
+	for _, c := range caps {
+		if c.Enabled {
+			log.Printf("  %s: enabled", c.Name)
+		} else {
+			log.Printf("  %s: disabled — %s", c.Name, c.Reason)
+		}
+	}
+}
+
 func sensorTypeFromFilename(name string) (model.SensorType, string) {
 	base := strings.TrimSuffix(name, ".csv")
 	st := model.SensorType(base)
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"energy_simulator/internal/ingest"
 	"energy_simulator/internal/model"
+	"energy_simulator/internal/simulator"
 	"energy_simulator/internal/store"
+	"energy_simulator/internal/ws"
 )
 
 func TestSensorTypeFromFilename(t *testing.T) {
@@ -142,3 +151,200 @@ func TestFindSensorID(t *testing.T) {
 		assert.Empty(t, id)
 	})
 }
+
+// testEngine returns an engine over two hours of constant 1000 W grid import.
+func testEngine(t *testing.T) *simulator.Engine {
+	t.Helper()
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid", Type: model.SensorGridPower, Unit: "W"})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.AddReadings([]model.Reading{
+		{Timestamp: start, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+		{Timestamp: start.Add(time.Hour), SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+		{Timestamp: start.Add(2 * time.Hour), SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+	})
+	engine := simulator.New(s, ws.NewBridge(ws.NewHub()))
+	require.True(t, engine.Init())
+	return engine
+}
+
+func TestSummaryHandler(t *testing.T) {
+	engine := testEngine(t)
+	engine.Step(2 * time.Hour)
+
+	rec := httptest.NewRecorder()
+	summaryHandler(engine)(rec, httptest.NewRequest(http.MethodGet, "/summary", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var summary ws.SummaryPayload
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Greater(t, summary.GridImportKWh, 0.0)
+	assert.InDelta(t, engine.CurrentSummary().GridImportKWh, summary.GridImportKWh, 1e-9)
+}
+
+func TestStateHandler(t *testing.T) {
+	engine := testEngine(t)
+
+	rec := httptest.NewRecorder()
+	stateHandler(engine)(rec, httptest.NewRequest(http.MethodGet, "/state", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var state ws.SimStatePayload
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	assert.Equal(t, "2024-01-01T00:00:00Z", state.Time)
+	assert.Equal(t, 3600.0, state.Speed)
+	assert.False(t, state.Running)
+}
+
+func TestSchemesHandler(t *testing.T) {
+	engine := testEngine(t)
+	engine.Step(2 * time.Hour)
+
+	rec := httptest.NewRecorder()
+	schemesHandler(engine)(rec, httptest.NewRequest(http.MethodGet, "/schemes", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var c ws.SchemeComparisonPayload
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &c))
+	// No export: both schemes pay the fixed tariff on 2 kWh.
+	assert.InDelta(t, 1.30, c.NMNetCostPLN, 1e-9)
+	assert.InDelta(t, 1.30, c.NBNetCostPLN, 1e-9)
+	assert.Empty(t, c.Cheaper)
+	require.Len(t, c.Months, 1)
+	assert.Equal(t, "2024-01", c.Months[0].Month)
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, splitList(" https://a.example, ,https://b.example "))
+	assert.Nil(t, splitList(""))
+}
+
+func TestReloadRecent(t *testing.T) {
+	dir := t.TempDir()
+	gridID := "sensor.0x943469fffed2bf71_power"
+	write := func(name, body string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("sensor_id,value,updated_ts\n"+body), 0o644))
+	}
+
+	s := store.New()
+	write("week1.csv", gridID+",100,1704067200\n"+gridID+",200,1704070800\n")
+	end, err := reloadRecent(dir, s, ingest.DefaultSanitizeRules(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1704070800, 0).UTC(), end.UTC())
+
+	// A new weekly file appears; reload picks it up without duplicating week1
+	write("week2.csv", gridID+",300,1704074400\n")
+	end, err = reloadRecent(dir, s, ingest.DefaultSanitizeRules(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1704074400, 0).UTC(), end.UTC())
+	assert.Equal(t, 3, s.ReadingCount(gridID))
+
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+	assert.Equal(t, end.UTC(), tr.End.UTC())
+}
+
+func TestReloadRecent_SanitizeDropsSpike(t *testing.T) {
+	dir := t.TempDir()
+	gridID := "sensor.0x943469fffed2bf71_power"
+	body := "sensor_id,value,updated_ts\n" +
+		gridID + ",100,1704067200\n" +
+		gridID + ",99999,1704070800\n" +
+		gridID + ",300,1704074400\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "week1.csv"), []byte(body), 0o644))
+
+	s := store.New()
+	_, err := reloadRecent(dir, s, ingest.DefaultSanitizeRules(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.ReadingCount(gridID))
+
+	// -no-sanitize keeps the spike
+	raw := store.New()
+	_, err = reloadRecent(dir, raw, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, raw.ReadingCount(gridID))
+}
+
+func TestReloadRecent_RoundTimestamps(t *testing.T) {
+	dir := t.TempDir()
+	gridID := "sensor.0x943469fffed2bf71_power"
+	body := "sensor_id,value,updated_ts\n" +
+		gridID + ",100,1704067200.4\n" +
+		gridID + ",200,1704067219.8\n" +
+		gridID + ",300,1704067260.2\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "week1.csv"), []byte(body), 0o644))
+
+	s := store.New()
+	_, err := reloadRecent(dir, s, nil, time.Minute)
+	require.NoError(t, err)
+
+	got := s.ReadingsInRange(gridID, time.Unix(1704067200, 0), time.Unix(1704067261, 0))
+	require.Len(t, got, 2)
+	assert.Equal(t, time.Unix(1704067200, 0).UTC(), got[0].Timestamp.UTC())
+	assert.Equal(t, 200.0, got[0].Value)
+	assert.Equal(t, time.Unix(1704067260, 0).UTC(), got[1].Timestamp.UTC())
+}
+
+func TestReloadRecent_ExtendsPhaseSum(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	phases := func(from, to int) []model.Reading {
+		var out []model.Reading
+		for i, st := range model.GridPhasePower {
+			for h := from; h <= to; h++ {
+				out = append(out, model.Reading{
+					Timestamp: base.Add(time.Duration(h) * time.Hour),
+					SensorID:  "sensor." + string(st), Type: st, Value: float64(100 * (i + 1)), Unit: "W",
+				})
+			}
+		}
+		return out
+	}
+
+	s := store.New()
+	for _, st := range model.GridPhasePower {
+		s.AddSensor(model.Sensor{ID: "sensor." + string(st), Type: st, Unit: "W"})
+	}
+	s.AddReadings(phases(0, 2))
+	require.True(t, simulator.SumGridPhases(s))
+
+	// Phase readings appended by a reload (phase-only data, no grid_power)
+	s.AppendReadings(phases(3, 4))
+	end, err := reloadRecent(t.TempDir(), s, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, base.Add(4*time.Hour), end.UTC())
+
+	r, ok := s.ReadingAt(simulator.PhaseSumSensorID, base.Add(4*time.Hour))
+	require.True(t, ok)
+	assert.Equal(t, base.Add(4*time.Hour), r.Timestamp.UTC())
+	assert.Equal(t, 600.0, r.Value)
+}
+
+func TestLoadInputDirs(t *testing.T) {
+	gridID := "sensor.0x943469fffed2bf71_power"
+	pvID := "sensor.hoymiles_gateway_solarh_3054300_real_power"
+	ovenID := "sensor.piekarnik_z2m_power"
+	newDir := func(body string) string {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "recent"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "recent", "week1.csv"), []byte("sensor_id,value,updated_ts\n"+body), 0o644))
+		return dir
+	}
+	// Both directories hold grid power at 1704070800; the second one wins.
+	first := newDir(gridID + ",100,1704067200\n" + gridID + ",200,1704070800\n" + pvID + ",50,1704067200\n")
+	second := newDir(gridID + ",250,1704070800\n" + gridID + ",300,1704074400\n" + ovenID + ",900,1704074400\n")
+
+	s, ranges, err := loadInputDirs([]string{first, second}, ingest.DefaultSanitizeRules(), 0)
+	require.NoError(t, err)
+
+	grid := s.ReadingsInRange(gridID, time.Unix(1704067200, 0), time.Unix(1704074401, 0))
+	require.Len(t, grid, 3)
+	assert.Equal(t, []float64{100, 250, 300}, []float64{grid[0].Value, grid[1].Value, grid[2].Value})
+	assert.Equal(t, 1, s.ReadingCount(pvID))
+	assert.Equal(t, 1, s.ReadingCount(ovenID))
+	assert.Equal(t, time.Unix(1704067200, 0).UTC(), ranges.recentGridPower.Start.UTC())
+	assert.Equal(t, time.Unix(1704074400, 0).UTC(), ranges.recentGridPower.End.UTC())
+
+	_, _, err = loadInputDirs([]string{first, filepath.Join(first, "missing")}, nil, 0)
+	assert.Error(t, err)
+}
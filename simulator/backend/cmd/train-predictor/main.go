@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"strings"
+	"time"
 
 	"energy_simulator/internal/ingest"
 	"energy_simulator/internal/model"
 	"energy_simulator/internal/predictor"
+	"energy_simulator/internal/store"
 )
 
 func main() {
@@ -19,7 +22,13 @@ func main() {
 	epochs := flag.Int("epochs", 300, "training epochs")
 	lr := flag.Float64("lr", 0.005, "learning rate")
 	batchSize := flag.Int("batch-size", 64, "mini-batch size")
+	dropout := flag.Float64("dropout", 0, "dropout rate for hidden layers during training (0 = off)")
+	l2 := flag.Float64("l2", 0, "L2 weight decay coefficient (0 = off)")
+	standardize := flag.Bool("standardize", true, "z-score network inputs using training-data statistics")
+	quantile := flag.Float64("quantile", 0, "fit this quantile of grid power with pinball loss, e.g. 0.9 (0 = mean, MSE)")
 	seed := flag.Uint64("seed", 42, "random seed")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them before training")
+	roundTo := flag.Duration("round-timestamps", 0, "round reading timestamps to this grid (e.g. 1m), keeping the last value per slot (0 = off)")
 	flag.Parse()
 
 	// Parse stats CSV.
@@ -36,19 +45,19 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error parsing stats CSV: %v\n", err)
 		os.Exit(1)
 	}
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+	readings, report := ingest.Prepare(readings, rules, *roundTo)
+	if report.Total() > 0 {
+		fmt.Printf("Cleaned %s: %s\n", *statsPath, report)
+	}
 
 	// Separate grid power and external temperature readings.
 	gridEntityID := model.SensorHomeAssistantID[model.SensorGridPower]
 	tempEntityID := model.SensorHomeAssistantID[model.SensorPumpExtTemp]
 
-	// Index by Unix timestamp for joining.
-	type indexed struct {
-		value float64
-		month int
-		hour  int
-	}
-	powerByTS := make(map[int64]indexed)
-
 	type tempIndexed struct {
 		value     float64
 		dayOfYear int
@@ -56,28 +65,35 @@ func main() {
 	}
 	tempByTS := make(map[int64]tempIndexed)
 
-	var nPower, nTemp int
+	var powerReadings, tempReadings []model.Reading
 	for _, r := range readings {
-		ts := r.Timestamp.Unix()
 		switch r.SensorID {
 		case gridEntityID:
-			powerByTS[ts] = indexed{
-				value: r.Value,
-				month: int(r.Timestamp.Month()),
-				hour:  r.Timestamp.Hour(),
-			}
-			nPower++
+			powerReadings = append(powerReadings, r)
 		case tempEntityID:
-			tempByTS[ts] = tempIndexed{
+			tempByTS[r.Timestamp.Unix()] = tempIndexed{
 				value:     r.Value,
 				dayOfYear: r.Timestamp.YearDay(),
 				hour:      r.Timestamp.Hour(),
 			}
-			nTemp++
+			tempReadings = append(tempReadings, r)
 		}
 	}
 
-	fmt.Printf("Parsed readings: %d grid power, %d ext temperature\n", nPower, nTemp)
+	fmt.Printf("Parsed readings: %d grid power, %d ext temperature\n", len(powerReadings), len(tempReadings))
+
+	if *dropout < 0 || *dropout >= 1 {
+		fmt.Fprintf(os.Stderr, "Invalid -dropout %v: must be in [0, 1)\n", *dropout)
+		os.Exit(1)
+	}
+	if *l2 < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -l2 %v: must be >= 0\n", *l2)
+		os.Exit(1)
+	}
+	if *quantile < 0 || *quantile >= 1 {
+		fmt.Fprintf(os.Stderr, "Invalid -quantile %v: must be in (0, 1), or 0 for MSE\n", *quantile)
+		os.Exit(1)
+	}
 
 	cfg := predictor.TrainConfig{
 		LearningRate: *lr,
@@ -86,6 +102,10 @@ func main() {
 		Epsilon:      1e-8,
 		BatchSize:    *batchSize,
 		Epochs:       *epochs,
+		DropoutRate:  *dropout,
+		L2:           *l2,
+
+		StandardizeInputs: *standardize,
 	}
 
 	// --- Train temperature model ---
@@ -129,6 +149,8 @@ func main() {
 	fmt.Printf("  anomaly=0 → %.1f°C\n", base)
 	fmt.Printf("  anomaly=1 → %.1f°C (diff: %+.1f°C)\n", warm, warm-base)
 
+	printMeta(tempPred.Meta())
+
 	tempData, err := tempPred.Save()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error serializing temperature model: %v\n", err)
@@ -144,22 +166,12 @@ func main() {
 	// --- Train power model ---
 	fmt.Println("\n=== Power Model ===")
 
-	// Join power + temperature by timestamp.
-	var powerSamples []predictor.Sample
-	for ts, p := range powerByTS {
-		ti, ok := tempByTS[ts]
-		if !ok {
-			continue
-		}
-		powerSamples = append(powerSamples, predictor.Sample{
-			Month:       p.month,
-			Hour:        p.hour,
-			Temperature: ti.value,
-			Power:       p.value,
-		})
-	}
+	// Join power + temperature on hourly slots; the two sensors rarely share
+	// exact sample timestamps.
+	powerSamples := joinSamples(store.Resample(powerReadings, time.Hour), store.Resample(tempReadings, time.Hour))
+	exact := joinSamples(powerReadings, tempReadings)
 
-	fmt.Printf("Joined training samples: %d\n", len(powerSamples))
+	fmt.Printf("Joined training samples: %d hourly slots (exact timestamp join: %d)\n", len(powerSamples), len(exact))
 	if len(powerSamples) == 0 {
 		fmt.Fprintln(os.Stderr, "No matching samples found. Check that stats CSV contains both grid power and ext temperature data.")
 		os.Exit(1)
@@ -167,7 +179,14 @@ func main() {
 
 	fmt.Printf("Training: epochs=%d lr=%.4f batch_size=%d seed=%d\n", cfg.Epochs, cfg.LearningRate, cfg.BatchSize, *seed)
 
-	powerPred, powerLosses := predictor.TrainPredictor(powerSamples, cfg, *seed)
+	powerCfg := cfg
+	if *quantile > 0 {
+		powerCfg.Loss = predictor.LossPinball
+		powerCfg.Quantile = *quantile
+		fmt.Printf("Loss: pinball, quantile %.2f\n", *quantile)
+	}
+
+	powerPred, powerLosses := predictor.TrainPredictor(powerSamples, powerCfg, *seed)
 
 	fmt.Printf("Initial val loss: %.6f\n", powerLosses[0])
 	fmt.Printf("Final val loss:   %.6f\n", powerLosses[len(powerLosses)-1])
@@ -180,6 +199,8 @@ func main() {
 		fmt.Printf("  June %02d:00 @ 20°C → %.0fW\n", hour, p)
 	}
 
+	printMeta(powerPred.Meta())
+
 	// Print hourly noise std.
 	fmt.Println("\nHourly noise std (W):")
 	powerData, err := powerPred.Save()
@@ -213,3 +234,37 @@ func main() {
 	}
 	fmt.Printf("\nPower model saved to %s (%d bytes)\n", *powerModelPath, len(powerData))
 }
+
+// joinSamples pairs grid power and temperature readings sharing a Unix
+// timestamp into power model samples, in power reading order.
+func joinSamples(power, temp []model.Reading) []predictor.Sample {
+	tempByTS := make(map[int64]float64, len(temp))
+	for _, r := range temp {
+		tempByTS[r.Timestamp.Unix()] = r.Value
+	}
+
+	var samples []predictor.Sample
+	for _, p := range power {
+		t, ok := tempByTS[p.Timestamp.Unix()]
+		if !ok {
+			continue
+		}
+		samples = append(samples, predictor.Sample{
+			Month:       int(p.Timestamp.Month()),
+			Hour:        p.Timestamp.Hour(),
+			Temperature: t,
+			Power:       p.Value,
+		})
+	}
+	return samples
+}
+
+// printMeta reports the metadata block written alongside a model.
+func printMeta(m *predictor.ModelMeta) {
+	if m == nil {
+		return
+	}
+	fmt.Printf("\nModel metadata: schema v%d, %d samples, final loss %.6f, trained %s\n",
+		m.SchemaVersion, m.NSamples, m.Loss, m.TrainedAt.Format("2006-01-02 15:04 MST"))
+	fmt.Printf("Features: %s\n", strings.Join(m.Features, ", "))
+}
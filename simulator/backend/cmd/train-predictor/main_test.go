@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+func series(sensorID string, start time.Time, values []float64) []model.Reading {
+	out := make([]model.Reading, len(values))
+	for i, v := range values {
+		out[i] = model.Reading{Timestamp: start.Add(time.Duration(i) * time.Hour), SensorID: sensorID, Value: v}
+	}
+	return out
+}
+
+func TestJoinSamples_HourlySlotsAlignOffsetClocks(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	power := series("sensor.grid", start, []float64{500, 800, 1200, 900})
+	temp := series("sensor.temp", start.Add(90*time.Second), []float64{14, 15, 17, 16})
+
+	assert.Empty(t, joinSamples(power, temp), "exact join misses the 90 s offset")
+
+	samples := joinSamples(store.Resample(power, time.Hour), store.Resample(temp, time.Hour))
+	require.Len(t, samples, 4)
+	for i, s := range samples {
+		assert.Equal(t, 6, s.Month)
+		assert.Equal(t, i, s.Hour)
+		assert.Equal(t, power[i].Value, s.Power)
+		assert.Equal(t, temp[i].Value, s.Temperature)
+	}
+}
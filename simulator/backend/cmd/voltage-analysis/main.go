@@ -13,6 +13,7 @@ import (
 
 	"energy_simulator/internal/ingest"
 	"energy_simulator/internal/model"
+	"energy_simulator/internal/simulator"
 	"energy_simulator/internal/store"
 )
 
@@ -24,6 +25,9 @@ type curtailmentEvent struct {
 	MaxVoltage float64
 	LostWh     float64
 	LostPLN    float64
+	// UnavoidableWh is curtailed PV above the export limit, which the site
+	// could not have exported anyway; it is not part of LostWh.
+	UnavoidableWh float64
 }
 
 func main() {
@@ -35,9 +39,23 @@ func main() {
 	csvOut := flag.String("csv-out", "", "optional CSV output for scatter data")
 	daylightStart := flag.Int("daylight-start", 9, "daylight start hour for curtailment detection")
 	daylightEnd := flag.Int("daylight-end", 16, "daylight end hour for curtailment detection")
+	noSanitize := flag.Bool("no-sanitize", false, "keep implausible readings instead of dropping them at load")
+	roundTo := flag.Duration("round-timestamps", 0, "round reading timestamps to this grid at load (e.g. 1m), keeping the last value per sensor and slot in file order (0 = off)")
+	perPhase := flag.Bool("per-phase", false, "analyze each phase of a three-phase install against its own voltage and power sensors")
+	batteryKWh := flag.Float64("battery-capacity", 0, "estimate how much curtailed PV a battery of this capacity (kWh) would recover; 0 disables")
+	cRate := flag.Float64("max-power-rate", 0.5, "C-rate for the -battery-capacity battery's max charge/discharge power")
+	exportLimit := flag.Float64("export-limit", 0, "site export limit (W); curtailed PV above it counts as unavoidable rather than lost; 0 disables")
+	timeWeighted := flag.Bool("time-weighted", false, "weight voltage averages by the time to the next reading instead of averaging readings, so bursts of readings do not bias them")
 	flag.Parse()
 
-	dataStore := loadAllData(*inputDir)
+	rules := ingest.DefaultSanitizeRules()
+	if *noSanitize {
+		rules = nil
+	}
+
+	dataStore := loadAllData(*inputDir, rules, *roundTo)
+	// Three-phase meters without a total: sum the phases for the export summary.
+	simulator.SumGridPhases(dataStore)
 
 	tr, ok := dataStore.GlobalTimeRange()
 	if !ok {
@@ -62,7 +80,15 @@ func main() {
 
 	// Export summary (always available if we have PV + grid)
 	if gridID != "" {
-		printExportSummary(dataStore, gridID, pvID, priceID, tr)
+		printExportSummary("Export Summary", dataStore, gridID, pvID, priceID, tr)
+	}
+
+	if *perPhase {
+		analyzePhases(dataStore, pvID, priceID, tr, curtailmentParams{
+			voltageThresh: *voltageThreshold, minPV: *minPV, pvDropPct: *pvDropPct, exportLimitW: *exportLimit,
+			peakWindow: *peakWindow, daylightStart: *daylightStart, daylightEnd: *daylightEnd,
+		}, *timeWeighted)
+		return
 	}
 
 	if voltageID == "" {
@@ -73,17 +99,26 @@ func main() {
 	}
 
 	// Voltage summary
-	printVoltageSummary(dataStore, voltageID, gridID, tr)
+	printVoltageSummary("Voltage Summary", dataStore, voltageID, gridID, tr, *timeWeighted)
 
 	// Curtailment detection
 	events := detectCurtailment(
-		dataStore, voltageID, pvID, priceID, tr,
-		*voltageThreshold, *minPV, *pvDropPct, *peakWindow,
+		dataStore, voltageID, pvID, gridID, priceID, tr,
+		*voltageThreshold, *minPV, *pvDropPct, *exportLimit, *peakWindow,
 		*daylightStart, *daylightEnd,
 	)
 
 	if len(events) > 0 {
-		printCurtailmentEvents(events)
+		printCurtailmentEvents("PV Curtailment Detection", events)
+		if *batteryKWh > 0 && gridID != "" {
+			cfg := simulator.BatteryConfig{
+				CapacityKWh:         *batteryKWh,
+				MaxPowerW:           *batteryKWh * *cRate * 1000,
+				ChargeToPercent:     100,
+				CurtailmentVoltageV: *voltageThreshold,
+			}
+			printRecovery(cfg, estimateRecovery(dataStore, gridID, voltageID, tr, events, cfg))
+		}
 	} else {
 		fmt.Println("  No curtailment events detected.")
 		fmt.Println()
@@ -95,7 +130,54 @@ func main() {
 	}
 }
 
-func printExportSummary(s *store.Store, gridID, pvID, priceID string, tr model.TimeRange) {
+// curtailmentParams holds the detectCurtailment thresholds for -per-phase.
+type curtailmentParams struct {
+	voltageThresh, minPV, pvDropPct, exportLimitW float64
+	peakWindow, daylightStart, daylightEnd        int
+}
+
+// analyzePhases runs the export, voltage and curtailment analysis once per
+// phase of a three-phase install. Voltage rise happens on the phase that
+// exports, so each phase voltage is compared with its own phase power.
+func analyzePhases(s *store.Store, pvID, priceID string, tr model.TimeRange, p curtailmentParams, timeWeighted bool) {
+	// The export limit applies to the whole site, so curtailment checks it
+	// against the total grid power rather than the phase's.
+	siteGridID := findSensorID(s, model.SensorGridPower)
+	found := false
+	for i := range model.GridPhasePower {
+		phase := fmt.Sprintf("L%d", i+1)
+		gridID := findSensorID(s, model.GridPhasePower[i])
+		voltageID := findSensorID(s, model.GridPhaseVoltage[i])
+		if gridID == "" && voltageID == "" {
+			continue
+		}
+		found = true
+		if gridID != "" {
+			printExportSummary("Export Summary "+phase, s, gridID, pvID, priceID, tr)
+		}
+		if voltageID == "" {
+			continue
+		}
+		printVoltageSummary("Voltage Summary "+phase, s, voltageID, gridID, tr, timeWeighted)
+		events := detectCurtailment(
+			s, voltageID, pvID, siteGridID, priceID, tr,
+			p.voltageThresh, p.minPV, p.pvDropPct, p.exportLimitW, p.peakWindow,
+			p.daylightStart, p.daylightEnd,
+		)
+		if len(events) > 0 {
+			printCurtailmentEvents("PV Curtailment Detection "+phase, events)
+		} else {
+			fmt.Printf("  No curtailment events detected on %s.\n", phase)
+			fmt.Println()
+		}
+	}
+	if !found {
+		fmt.Println("  ⚠  No per-phase grid sensors found (grid_power_l1..l3, grid_voltage_l1..l3).")
+		fmt.Println()
+	}
+}
+
+func printExportSummary(title string, s *store.Store, gridID, pvID, priceID string, tr model.TimeRange) {
 	gridReadings := s.ReadingsInRange(gridID, tr.Start, tr.End.Add(time.Nanosecond))
 
 	var exportWh, maxExportW float64
@@ -123,7 +205,7 @@ func printExportSummary(s *store.Store, gridID, pvID, priceID string, tr model.T
 		}
 	}
 
-	fmt.Println("=== Export Summary ===")
+	fmt.Printf("=== %s ===\n", title)
 	fmt.Printf("  Total export: %.1f kWh\n", exportWh/1000)
 	fmt.Printf("  Max export power: %.0f W\n", maxExportW)
 	if priceID != "" {
@@ -132,51 +214,97 @@ func printExportSummary(s *store.Store, gridID, pvID, priceID string, tr model.T
 	fmt.Println()
 }
 
-func printVoltageSummary(s *store.Store, voltageID, gridID string, tr model.TimeRange) {
-	readings := s.ReadingsInRange(voltageID, tr.Start, tr.End.Add(time.Nanosecond))
-	if len(readings) == 0 {
-		fmt.Println("  No voltage readings found.")
-		return
-	}
-
-	var sum, maxV float64
-	var count int
-	var exportSum float64
-	var exportCount int
+// voltageStats summarizes the voltage readings of a time range.
+type voltageStats struct {
+	Count        int
+	AvgV         float64
+	MaxV         float64
+	ExportCount  int     // readings taken while the grid was exporting
+	ExportAvgV   float64 // 0 when ExportWeight is 0
+	ExportWeight float64 // readings, or hours when time-weighted, behind ExportAvgV
+}
 
-	for _, r := range readings {
-		sum += r.Value
-		count++
-		if r.Value > maxV {
-			maxV = r.Value
+// voltageMaxWeight caps a time-weighted reading's interval, so a reading
+// before a gap in the data does not stand in for the whole gap.
+const voltageMaxWeight = time.Hour
+
+// computeVoltageStats averages the voltage readings in tr, overall and while
+// gridID (if set) shows export. By default every reading counts once; with
+// timeWeighted each reading is weighted by the time until the next one,
+// capped at voltageMaxWeight, so the result is the average over time and
+// bursts of closely spaced readings do not bias it. The last reading has no
+// next one and is weighted like the one before it.
+func computeVoltageStats(s *store.Store, voltageID, gridID string, tr model.TimeRange, timeWeighted bool) voltageStats {
+	readings := s.ReadingsInRange(voltageID, tr.Start, tr.End.Add(time.Nanosecond))
+	var st voltageStats
+	var sum, weight, exportSum float64
+	for i, r := range readings {
+		w := 1.0
+		if timeWeighted && len(readings) > 1 {
+			var gap time.Duration
+			if i+1 < len(readings) {
+				gap = readings[i+1].Timestamp.Sub(r.Timestamp)
+			} else {
+				gap = r.Timestamp.Sub(readings[i-1].Timestamp)
+			}
+			w = min(gap, voltageMaxWeight).Hours()
+		}
+		st.Count++
+		sum += r.Value * w
+		weight += w
+		if r.Value > st.MaxV {
+			st.MaxV = r.Value
 		}
+		if gridID == "" {
+			continue
+		}
+		if gr, ok := s.ReadingAt(gridID, r.Timestamp); ok && gr.Value < 0 {
+			st.ExportCount++
+			exportSum += r.Value * w
+			st.ExportWeight += w
+		}
+	}
+	if weight > 0 {
+		st.AvgV = sum / weight
 	}
+	if st.ExportWeight > 0 {
+		st.ExportAvgV = exportSum / st.ExportWeight
+	}
+	return st
+}
 
-	// During export moments
-	if gridID != "" {
-		for _, r := range readings {
-			if gr, ok := s.ReadingAt(gridID, r.Timestamp); ok && gr.Value < 0 {
-				exportSum += r.Value
-				exportCount++
-			}
-		}
+func printVoltageSummary(title string, s *store.Store, voltageID, gridID string, tr model.TimeRange, timeWeighted bool) {
+	st := computeVoltageStats(s, voltageID, gridID, tr, timeWeighted)
+	if st.Count == 0 {
+		fmt.Println("  No voltage readings found.")
+		return
 	}
 
-	fmt.Println("=== Voltage Summary ===")
-	fmt.Printf("  Readings: %d\n", count)
-	fmt.Printf("  Avg voltage: %.1f V\n", sum/float64(count))
-	fmt.Printf("  Max voltage: %.1f V\n", maxV)
-	if exportCount > 0 {
-		fmt.Printf("  Avg voltage during export: %.1f V (%d readings)\n", exportSum/float64(exportCount), exportCount)
+	avgLabel := "Avg voltage"
+	if timeWeighted {
+		avgLabel = "Avg voltage (time-weighted)"
+	}
+	fmt.Printf("=== %s ===\n", title)
+	fmt.Printf("  Readings: %d\n", st.Count)
+	fmt.Printf("  %s: %.1f V\n", avgLabel, st.AvgV)
+	fmt.Printf("  Max voltage: %.1f V\n", st.MaxV)
+	if st.ExportWeight > 0 {
+		fmt.Printf("  %s during export: %.1f V (%d readings)\n", avgLabel, st.ExportAvgV, st.ExportCount)
 	}
 	fmt.Println()
 }
 
+// detectCurtailment finds runs of readings where the voltage is above
+// voltageThresh while PV sits below its rolling peak, and estimates the PV
+// lost as peak minus actual. With exportLimitW > 0 only the part the site
+// could have exported counts as lost: the household load (PV plus grid power
+// from gridID, or none without it) plus the export limit caps what the peak
+// could have delivered, and the rest is reported as UnavoidableWh.
 func detectCurtailment(
 	s *store.Store,
-	voltageID, pvID, priceID string,
+	voltageID, pvID, gridID, priceID string,
 	tr model.TimeRange,
-	voltageThresh, minPV, pvDropPct float64,
+	voltageThresh, minPV, pvDropPct, exportLimitW float64,
 	peakWindow, daylightStart, daylightEnd int,
 ) []curtailmentEvent {
 	pvReadings := s.ReadingsInRange(pvID, tr.Start, tr.End.Add(time.Nanosecond))
@@ -245,6 +373,18 @@ func detectCurtailment(
 
 		if isCurtailed {
 			lostW := peak - pvW
+			var unavoidableWh float64
+			if exportLimitW > 0 {
+				var loadW float64
+				if gridID != "" {
+					if gr, ok := s.ReadingAt(gridID, cur.Timestamp); ok {
+						loadW = math.Max(0, pvW+gr.Value)
+					}
+				}
+				usable := math.Max(0, math.Min(peak, loadW+exportLimitW)-pvW)
+				unavoidableWh = (lostW - usable) * hours
+				lostW = usable
+			}
 			lostWh := lostW * hours
 
 			var lostPLN float64
@@ -268,6 +408,7 @@ func detectCurtailment(
 				}
 				current.LostWh += lostWh
 				current.LostPLN += lostPLN
+				current.UnavoidableWh += unavoidableWh
 			} else {
 				current = &curtailmentEvent{
 					Start:      cur.Timestamp,
@@ -277,6 +418,8 @@ func detectCurtailment(
 					MaxVoltage: vr.Value,
 					LostWh:     lostWh,
 					LostPLN:    lostPLN,
+
+					UnavoidableWh: unavoidableWh,
 				}
 			}
 		} else {
@@ -293,22 +436,26 @@ func detectCurtailment(
 	return events
 }
 
-func printCurtailmentEvents(events []curtailmentEvent) {
-	var totalLostKWh, totalLostPLN float64
+func printCurtailmentEvents(title string, events []curtailmentEvent) {
+	var totalLostKWh, totalLostPLN, totalUnavoidableKWh float64
 	var totalDuration time.Duration
 	for _, e := range events {
 		totalLostKWh += e.LostWh / 1000
+		totalUnavoidableKWh += e.UnavoidableWh / 1000
 		totalLostPLN += e.LostPLN
 		totalDuration += e.End.Sub(e.Start)
 	}
 
-	fmt.Println("=== PV Curtailment Detection ===")
+	fmt.Printf("=== %s ===\n", title)
 	fmt.Printf("  Events: %d\n", len(events))
 	fmt.Printf("  Total duration: %s\n", formatDuration(totalDuration))
 	fmt.Printf("  Estimated lost energy: %.2f kWh\n", totalLostKWh)
 	if totalLostPLN > 0 {
 		fmt.Printf("  Estimated lost revenue: %.2f PLN\n", totalLostPLN)
 	}
+	if totalUnavoidableKWh > 0 {
+		fmt.Printf("  Above export limit (unavoidable): %.2f kWh\n", totalUnavoidableKWh)
+	}
 	fmt.Println()
 
 	// Show up to 20 events
@@ -336,6 +483,73 @@ func printCurtailmentEvents(events []curtailmentEvent) {
 	fmt.Println()
 }
 
+// recoveryEstimate is how much of the detected curtailment a battery
+// would have absorbed.
+type recoveryEstimate struct {
+	LostWh       float64
+	RecoveredWh  float64
+	RecoveredPLN float64
+}
+
+// estimateRecovery replays the grid readings through a self-consumption
+// battery that charges at full power while exporting at or above cfg's
+// CurtailmentVoltageV, and credits each curtailment event with the PV the
+// battery reclaimed during it, capped at the event's lost energy. The battery
+// discharges into household import between events, so its headroom on a
+// curtailed afternoon depends on how full the morning export left it.
+func estimateRecovery(s *store.Store, gridID, voltageID string, tr model.TimeRange, events []curtailmentEvent, cfg simulator.BatteryConfig) recoveryEstimate {
+	var est recoveryEstimate
+	for _, e := range events {
+		est.LostWh += e.LostWh
+	}
+
+	reclaimed := make([]float64, len(events))
+	b := simulator.NewBattery(cfg)
+	ev := 0
+	var prev time.Time
+	for _, r := range s.ReadingsInRange(gridID, tr.Start, tr.End.Add(time.Nanosecond)) {
+		if vr, ok := s.ReadingAt(voltageID, r.Timestamp); ok {
+			b.SetGridVoltage(vr.Value)
+		}
+		before := b.ReclaimedWh
+		b.Process(r.Value, r.Timestamp)
+		// The battery acts on the interval from the previous reading, so
+		// credit the event that interval starts in.
+		if wh := b.ReclaimedWh - before; wh > 0 {
+			for ev < len(events) && events[ev].End.Before(prev) {
+				ev++
+			}
+			if ev < len(events) && !prev.Before(events[ev].Start) {
+				reclaimed[ev] += wh
+			}
+		}
+		prev = r.Timestamp
+	}
+
+	for i, e := range events {
+		wh := math.Min(reclaimed[i], e.LostWh)
+		est.RecoveredWh += wh
+		if e.LostWh > 0 {
+			est.RecoveredPLN += e.LostPLN * wh / e.LostWh
+		}
+	}
+	return est
+}
+
+func printRecovery(cfg simulator.BatteryConfig, est recoveryEstimate) {
+	fmt.Printf("=== Battery Recovery (%.1f kWh, %.1f kW) ===\n", cfg.CapacityKWh, cfg.MaxPowerW/1000)
+	fmt.Printf("  Curtailed energy:  %.2f kWh\n", est.LostWh/1000)
+	pct := 0.0
+	if est.LostWh > 0 {
+		pct = est.RecoveredWh / est.LostWh * 100
+	}
+	fmt.Printf("  Recoverable:       %.2f kWh (%.0f%%)\n", est.RecoveredWh/1000, pct)
+	if est.RecoveredPLN > 0 {
+		fmt.Printf("  Recovered revenue: %.2f PLN\n", est.RecoveredPLN)
+	}
+	fmt.Println()
+}
+
 func writeScatterCSV(s *store.Store, voltageID, gridID, pvID string, tr model.TimeRange, path string) {
 	gridReadings := s.ReadingsInRange(gridID, tr.Start, tr.End.Add(time.Nanosecond))
 
@@ -405,10 +619,10 @@ func formatDuration(d time.Duration) string {
 
 // --- Data loading (shared with load-analysis) ---
 
-func loadAllData(inputDir string) *store.Store {
+func loadAllData(inputDir string, rules ingest.SanitizeRules, roundTo time.Duration) *store.Store {
 	dataStore := store.New()
 
-	loadLegacyCSVs(inputDir, dataStore)
+	loadLegacyCSVs(inputDir, dataStore, rules, roundTo)
 
 	recentDir := filepath.Join(inputDir, "recent")
 	if entries, err := os.ReadDir(recentDir); err == nil {
@@ -429,6 +643,10 @@ func loadAllData(inputDir string) *store.Store {
 				log.Printf("Warning: parsing %s: %v", path, err)
 				continue
 			}
+			readings, report := ingest.Prepare(readings, rules, roundTo)
+			if report.Total() > 0 {
+				log.Printf("Cleaned %s: %s", path, report)
+			}
 			if len(readings) > 0 {
 				registerSensors(readings, dataStore)
 				dataStore.AddReadings(readings)
@@ -455,6 +673,10 @@ func loadAllData(inputDir string) *store.Store {
 				log.Printf("Warning: parsing %s: %v", path, err)
 				continue
 			}
+			readings, report := ingest.Prepare(readings, rules, roundTo)
+			if report.Total() > 0 {
+				log.Printf("Cleaned %s: %s", path, report)
+			}
 			if len(readings) > 0 {
 				registerSensors(readings, dataStore)
 				dataStore.AddReadings(readings)
@@ -465,7 +687,7 @@ func loadAllData(inputDir string) *store.Store {
 	return dataStore
 }
 
-func loadLegacyCSVs(dir string, s *store.Store) {
+func loadLegacyCSVs(dir string, s *store.Store, rules ingest.SanitizeRules, roundTo time.Duration) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		log.Fatalf("Reading input directory %s: %v", dir, err)
@@ -488,6 +710,10 @@ func loadLegacyCSVs(dir string, s *store.Store) {
 		if err != nil {
 			log.Fatalf("Parsing %s: %v", path, err)
 		}
+		readings, report := ingest.Prepare(readings, rules, roundTo)
+		if report.Total() > 0 {
+			log.Printf("Cleaned %s: %s", path, report)
+		}
 
 		if len(readings) > 0 {
 			name := string(sensorType)
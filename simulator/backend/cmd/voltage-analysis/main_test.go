@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/store"
+)
+
+// curtailedStore holds three days of 15-minute data for a 500 W household
+// with 5 kW of PV from 09:00 to 16:00. From 11:00 to 14:00 the voltage sits
+// at 255 V and the inverter curtails PV to 3 kW, losing 2 kW (6 kWh a day).
+func curtailedStore() *store.Store {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.voltage", Type: model.SensorGridVoltage, Unit: "V"})
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for i := 0; i <= 3*24*4; i++ {
+		ts := base.Add(time.Duration(i) * 15 * time.Minute)
+		pv, voltage := 0.0, 235.0
+		if h := ts.Hour(); h >= 9 && h < 16 {
+			pv = 5000
+			if h >= 11 && h < 14 {
+				pv, voltage = 3000, 255
+			}
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 500 - pv},
+			model.Reading{Timestamp: ts, SensorID: "sensor.pv", Type: model.SensorPVPower, Value: pv},
+			model.Reading{Timestamp: ts, SensorID: "sensor.voltage", Type: model.SensorGridVoltage, Value: voltage},
+		)
+	}
+	s.AddReadings(readings)
+	return s
+}
+
+func TestEstimateRecovery(t *testing.T) {
+	s := curtailedStore()
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+	events := detectCurtailment(s, "sensor.voltage", "sensor.pv", "sensor.grid", "", tr, 253, 500, 20, 0, 30, 9, 16)
+	require.Len(t, events, 3)
+
+	recover := func(capacityKWh float64) recoveryEstimate {
+		return estimateRecovery(s, "sensor.grid", "sensor.voltage", tr, events, simulator.BatteryConfig{
+			CapacityKWh:         capacityKWh,
+			MaxPowerW:           5000,
+			ChargeToPercent:     100,
+			CurtailmentVoltageV: 253,
+		})
+	}
+
+	est := recover(10)
+	assert.InDelta(t, 18000, est.LostWh, 1)
+	// Morning export fills most of the 10 kWh before the curtailed window,
+	// so only part of the lost energy fits.
+	assert.Greater(t, est.RecoveredWh, 0.0)
+	assert.Less(t, est.RecoveredWh, est.LostWh)
+	assert.LessOrEqual(t, est.RecoveredWh, 3*10000.0)
+
+	// A larger battery recovers more, never beyond what was lost.
+	big := recover(40)
+	assert.Greater(t, big.RecoveredWh, est.RecoveredWh)
+	assert.LessOrEqual(t, big.RecoveredWh, big.LostWh+1e-9)
+}
+
+func TestDetectCurtailment_ExportLimit(t *testing.T) {
+	s := curtailedStore()
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+	detect := func(exportLimitW float64) (lostWh, unavoidableWh float64) {
+		events := detectCurtailment(s, "sensor.voltage", "sensor.pv", "sensor.grid", "", tr, 253, 500, 20, exportLimitW, 30, 9, 16)
+		require.Len(t, events, 3)
+		for _, e := range events {
+			lostWh += e.LostWh
+			unavoidableWh += e.UnavoidableWh
+		}
+		return lostWh, unavoidableWh
+	}
+
+	// No limit: the full 2 kW drop for 3 h a day is lost.
+	lost, unavoidable := detect(0)
+	assert.InDelta(t, 18000, lost, 1)
+	assert.Zero(t, unavoidable)
+
+	// A 3 kW export limit with a 500 W load caps the peak at 3.5 kW, so only
+	// 500 W of the drop could have been used; the other 1.5 kW is unavoidable.
+	lost, unavoidable = detect(3000)
+	assert.InDelta(t, 4500, lost, 1)
+	assert.InDelta(t, 13500, unavoidable, 1)
+
+	// A limit above the peak changes nothing.
+	lost, _ = detect(10000)
+	assert.InDelta(t, 18000, lost, 1)
+}
+
+func TestComputeVoltageStats_TimeWeighted(t *testing.T) {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.voltage", Type: model.SensorGridVoltage, Unit: "V"})
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// A burst of 250 V readings a minute apart, then 230 V held for an hour.
+	var readings []model.Reading
+	for _, p := range []struct {
+		offset time.Duration
+		v      float64
+	}{{0, 250}, {time.Minute, 250}, {2 * time.Minute, 230}, {62 * time.Minute, 230}} {
+		readings = append(readings,
+			model.Reading{Timestamp: base.Add(p.offset), SensorID: "sensor.voltage", Type: model.SensorGridVoltage, Value: p.v},
+			model.Reading{Timestamp: base.Add(p.offset), SensorID: "sensor.grid", Type: model.SensorGridPower, Value: -1000},
+		)
+	}
+	s.AddReadings(readings)
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+
+	byCount := computeVoltageStats(s, "sensor.voltage", "sensor.grid", tr, false)
+	assert.Equal(t, 4, byCount.Count)
+	assert.InDelta(t, 240, byCount.AvgV, 0.001)
+	assert.InDelta(t, 240, byCount.ExportAvgV, 0.001)
+	assert.Equal(t, 250.0, byCount.MaxV)
+
+	byTime := computeVoltageStats(s, "sensor.voltage", "sensor.grid", tr, true)
+	assert.Equal(t, 4, byTime.Count)
+	// The last reading holds as long as the interval before it.
+	assert.InDelta(t, (250*2+230*120)/122.0, byTime.AvgV, 0.001)
+	assert.InDelta(t, byTime.AvgV, byTime.ExportAvgV, 0.001)
+	assert.Equal(t, 4, byTime.ExportCount)
+	assert.Less(t, byTime.AvgV, byCount.AvgV-5)
+}
+
+func TestComputeVoltageStats_CapsGaps(t *testing.T) {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.voltage", Type: model.SensorGridVoltage, Unit: "V"})
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// 250 V before a day-long outage of the meter, then 230 V hourly.
+	s.AddReadings([]model.Reading{
+		{Timestamp: base, SensorID: "sensor.voltage", Type: model.SensorGridVoltage, Value: 250},
+		{Timestamp: base.Add(24 * time.Hour), SensorID: "sensor.voltage", Type: model.SensorGridVoltage, Value: 230},
+		{Timestamp: base.Add(25 * time.Hour), SensorID: "sensor.voltage", Type: model.SensorGridVoltage, Value: 230},
+	})
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+
+	st := computeVoltageStats(s, "sensor.voltage", "", tr, true)
+	assert.InDelta(t, (250+230*2)/3.0, st.AvgV, 0.001)
+	assert.Zero(t, st.ExportWeight)
+}
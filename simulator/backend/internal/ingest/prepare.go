@@ -0,0 +1,42 @@
+package ingest
+
+import (
+	"fmt"
+	"time"
+
+	"energy_simulator/internal/model"
+)
+
+// PrepareReport counts what Prepare changed: readings dropped or clamped by
+// the sanitize rules, and readings collapsed by timestamp rounding.
+type PrepareReport struct {
+	SanitizeReport
+	Collapsed int
+}
+
+// Total returns the number of readings dropped, clamped or collapsed.
+func (r PrepareReport) Total() int {
+	return r.SanitizeReport.Total() + r.Collapsed
+}
+
+// String summarises the report, e.g. "grid_power: 2 dropped; 3 collapsed".
+func (r PrepareReport) String() string {
+	s := r.SanitizeReport.String()
+	if r.Collapsed == 0 {
+		return s
+	}
+	collapsed := fmt.Sprintf("%d collapsed", r.Collapsed)
+	if s == "" {
+		return collapsed
+	}
+	return s + "; " + collapsed
+}
+
+// Prepare is the load-time clean-up of parsed readings: Sanitize with rules,
+// then RoundTimestamps to grid. Nil rules and a zero grid return readings
+// unchanged. The input slice is not modified.
+func Prepare(readings []model.Reading, rules SanitizeRules, grid time.Duration) ([]model.Reading, PrepareReport) {
+	readings, sanitized := Sanitize(readings, rules)
+	readings, collapsed := RoundTimestamps(readings, grid)
+	return readings, PrepareReport{SanitizeReport: sanitized, Collapsed: collapsed}
+}
@@ -0,0 +1,41 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+)
+
+func TestPrepare_SanitizesThenRounds(t *testing.T) {
+	t0 := time.Date(2024, 11, 21, 12, 0, 0, 0, time.UTC)
+	readings := []model.Reading{
+		gridReading(t0.Add(2*time.Second), 1200),
+		gridReading(t0.Add(20*time.Second), 1350),
+		gridReading(t0.Add(25*time.Second), 99999), // dropped before it can win the 12:00 slot
+		gridReading(t0.Add(time.Minute), 900),
+	}
+
+	out, report := Prepare(readings, DefaultSanitizeRules(), time.Minute)
+
+	require.Len(t, out, 2)
+	assert.Equal(t, 1350.0, out[0].Value)
+	assert.Equal(t, 1, report.Dropped[model.SensorGridPower])
+	assert.Equal(t, 1, report.Collapsed)
+	assert.Equal(t, 2, report.Total())
+	assert.Equal(t, "grid_power: 1 dropped; 1 collapsed", report.String())
+}
+
+func TestPrepare_NoRulesNoGrid(t *testing.T) {
+	t0 := time.Date(2024, 11, 21, 12, 0, 0, 0, time.UTC)
+	readings := []model.Reading{gridReading(t0, 99999), gridReading(t0.Add(time.Second), 100)}
+
+	out, report := Prepare(readings, nil, 0)
+
+	assert.Equal(t, readings, out)
+	assert.Zero(t, report.Total())
+	assert.Empty(t, report.String())
+}
@@ -0,0 +1,115 @@
+package ingest
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Record is one raw row of a recent measurements CSV (the
+// sensor_id,value,updated_ts files ha-fetch-history writes). Unlike
+// RecentParser it keeps unknown entities and the exact epoch, so files can
+// be rewritten without losing anything.
+type Record struct {
+	SensorID string
+	Value    float64
+	TS       float64 // unix epoch seconds
+}
+
+// ReadRecords reads a recent measurements CSV. Rows that cannot be parsed
+// are not returned but counted in skipped, so callers rewriting the file
+// can tell that data would be lost. An empty file yields no records.
+func ReadRecords(r io.Reader) (records []Record, skipped int, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := validateRecentHeader(header); err != nil {
+		return nil, 0, err
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(row) < 3 {
+			skipped++
+			continue
+		}
+
+		value, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			skipped++
+			continue
+		}
+		ts, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		records = append(records, Record{SensorID: row[0], Value: value, TS: ts})
+	}
+
+	return records, skipped, nil
+}
+
+// MergeRecords de-duplicates existing and new on (sensor, timestamp), new
+// winning on conflict, and sorts the result by sensor then timestamp.
+func MergeRecords(existing, new []Record) []Record {
+	type key struct {
+		sensorID string
+		ts       float64
+	}
+
+	seen := make(map[key]Record, len(existing)+len(new))
+	for _, r := range existing {
+		seen[key{r.SensorID, r.TS}] = r
+	}
+	for _, r := range new {
+		seen[key{r.SensorID, r.TS}] = r
+	}
+
+	merged := make([]Record, 0, len(seen))
+	for _, r := range seen {
+		merged = append(merged, r)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].SensorID != merged[j].SensorID {
+			return merged[i].SensorID < merged[j].SensorID
+		}
+		return merged[i].TS < merged[j].TS
+	})
+
+	return merged
+}
+
+// WriteRecords writes records as a recent measurements CSV with header.
+func WriteRecords(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"sensor_id", "value", "updated_ts"}); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		if err := cw.Write([]string{
+			r.SensorID,
+			strconv.FormatFloat(r.Value, 'f', -1, 64),
+			strconv.FormatFloat(r.TS, 'f', 7, 64),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
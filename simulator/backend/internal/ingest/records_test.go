@@ -0,0 +1,44 @@
+package ingest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRecords_CountsSkippedRows(t *testing.T) {
+	input := `sensor_id,value,updated_ts
+sensor.unmapped,1.5,1000.1234567
+sensor.a,unavailable,1001
+sensor.a,2
+sensor.a,3,1002
+`
+	records, skipped, err := ReadRecords(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, 2, skipped)
+	assert.Equal(t, []Record{
+		{SensorID: "sensor.unmapped", Value: 1.5, TS: 1000.1234567},
+		{SensorID: "sensor.a", Value: 3, TS: 1002},
+	}, records)
+
+	_, _, err = ReadRecords(strings.NewReader("a,b,c\n"))
+	assert.Error(t, err, "wrong header")
+}
+
+func TestMergeRecords_RoundTrip(t *testing.T) {
+	merged := MergeRecords(
+		[]Record{{"sensor.b", 1, 2000}, {"sensor.a", 1, 1000}},
+		[]Record{{"sensor.a", 9, 1000}, {"sensor.a", 2, 1500}},
+	)
+	assert.Equal(t, []Record{{"sensor.a", 9, 1000}, {"sensor.a", 2, 1500}, {"sensor.b", 1, 2000}}, merged)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRecords(&buf, merged))
+	back, skipped, err := ReadRecords(&buf)
+	require.NoError(t, err)
+	assert.Zero(t, skipped)
+	assert.Equal(t, merged, back)
+}
@@ -0,0 +1,40 @@
+package ingest
+
+import (
+	"time"
+
+	"energy_simulator/internal/model"
+)
+
+// RoundTimestamps rounds each reading's timestamp to the nearest multiple of
+// grid (halfway rounds up, as time.Time.Round), so series sampled with
+// sub-second or few-second jitter join on exact timestamps. Readings of one
+// sensor landing on the same rounded timestamp collapse into the last one in
+// input order, which for unsorted input need not be the latest original
+// timestamp.
+// Returns the kept readings in input order and how many were collapsed. A
+// grid of zero or less returns readings unchanged. The input slice is not
+// modified.
+func RoundTimestamps(readings []model.Reading, grid time.Duration) ([]model.Reading, int) {
+	if grid <= 0 {
+		return readings, 0
+	}
+
+	type key struct {
+		sensorID string
+		ts       time.Time
+	}
+	idx := make(map[key]int, len(readings))
+	out := make([]model.Reading, 0, len(readings))
+	for _, r := range readings {
+		r.Timestamp = r.Timestamp.Round(grid)
+		k := key{r.SensorID, r.Timestamp}
+		if i, ok := idx[k]; ok {
+			out[i] = r
+			continue
+		}
+		idx[k] = len(out)
+		out = append(out, r)
+	}
+	return out, len(readings) - len(out)
+}
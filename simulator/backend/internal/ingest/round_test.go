@@ -0,0 +1,44 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+)
+
+func TestRoundTimestamps_CollapsesToLastValue(t *testing.T) {
+	t0 := time.Date(2024, 11, 21, 12, 0, 0, 0, time.UTC)
+	readings := []model.Reading{
+		gridReading(t0.Add(5*time.Second+120*time.Millisecond), 1200),
+		gridReading(t0.Add(25*time.Second+120*time.Millisecond), 1350), // 20 s later, same minute
+		gridReading(t0.Add(time.Minute+2*time.Second), 900),
+	}
+
+	out, collapsed := RoundTimestamps(readings, time.Minute)
+
+	require.Len(t, out, 2)
+	assert.Equal(t, 1, collapsed)
+	assert.Equal(t, t0, out[0].Timestamp)
+	assert.Equal(t, 1350.0, out[0].Value, "later value kept")
+	assert.Equal(t, t0.Add(time.Minute), out[1].Timestamp)
+	assert.Equal(t, 900.0, out[1].Value)
+	assert.Equal(t, t0.Add(5*time.Second+120*time.Millisecond), readings[0].Timestamp, "input must not be modified")
+}
+
+func TestRoundTimestamps_KeepsSensorsApart(t *testing.T) {
+	t0 := time.Date(2024, 11, 21, 12, 0, 0, 0, time.UTC)
+	pv := model.Reading{Timestamp: t0.Add(10 * time.Second), SensorID: "sensor.pv", Type: model.SensorPVPower, Value: 3000}
+	readings := []model.Reading{gridReading(t0.Add(-3*time.Second), 500), pv}
+
+	out, collapsed := RoundTimestamps(readings, time.Minute)
+	require.Len(t, out, 2)
+	assert.Zero(t, collapsed)
+	assert.Equal(t, out[0].Timestamp, out[1].Timestamp)
+
+	same, _ := RoundTimestamps(readings, 0)
+	assert.Equal(t, readings, same)
+}
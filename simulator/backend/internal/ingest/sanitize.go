@@ -0,0 +1,137 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"energy_simulator/internal/model"
+)
+
+// SanitizeAction selects what happens to a reading outside its plausible range.
+type SanitizeAction int
+
+const (
+	// SanitizeDrop removes the reading.
+	SanitizeDrop SanitizeAction = iota
+	// SanitizeClamp replaces the value with the nearest range bound.
+	SanitizeClamp
+)
+
+// RangeRule bounds the plausible values of one sensor type.
+type RangeRule struct {
+	Min, Max float64
+	Action   SanitizeAction
+}
+
+// SanitizeRules maps sensor types to their plausible ranges. Types without a
+// rule pass through unchanged.
+type SanitizeRules map[model.SensorType]RangeRule
+
+// DefaultSanitizeRules returns plausible ranges for a single-family house
+// with a heat pump: spikes such as a momentary 30 kW grid reading or a -99 °C
+// sensor fault are dropped.
+func DefaultSanitizeRules() SanitizeRules {
+	rules := SanitizeRules{
+		model.SensorGridPower:       {Min: -20000, Max: 20000},
+		model.SensorPVPower:         {Min: -100, Max: 20000},
+		model.SensorPumpHeatPower:   {Min: 0, Max: 15000},
+		model.SensorPumpCWUPower:    {Min: 0, Max: 15000},
+		model.SensorPumpConsumption: {Min: 0, Max: 15000},
+		model.SensorPumpProduction:  {Min: 0, Max: 50000},
+		model.SensorEnergyPrice:     {Min: -5, Max: 10},
+		model.SensorGridVoltage:     {Min: 150, Max: 280},
+	}
+	for _, st := range []model.SensorType{
+		model.SensorElectricKettle, model.SensorOven, model.SensorWashing, model.SensorDrier,
+		model.SensorTvMedia, model.SensorOlek1, model.SensorOlek2, model.SensorBeata,
+		model.SensorNetwork, model.SensorExternal,
+	} {
+		rules[st] = RangeRule{Min: 0, Max: 10000}
+	}
+	for _, st := range []model.SensorType{
+		model.SensorPumpExtTemp, model.SensorNetatmoOutdoorTemp, model.SensorTempWorkshopExt,
+		model.SensorTempBedroom1, model.SensorTempBedroom2, model.SensorTempKitchen,
+		model.SensorTempOffice1, model.SensorTempOffice2, model.SensorTempBathroom,
+		model.SensorTempWorkshop, model.SensorNetatmoTemp, model.SensorNetatmoLivingTemp,
+	} {
+		rules[st] = RangeRule{Min: -40, Max: 50}
+	}
+	for i := range model.GridPhasePower {
+		rules[model.GridPhasePower[i]] = rules[model.SensorGridPower]
+		rules[model.GridPhaseVoltage[i]] = rules[model.SensorGridVoltage]
+	}
+	return rules
+}
+
+// SanitizeReport counts readings removed or altered by Sanitize, per sensor type.
+type SanitizeReport struct {
+	Dropped map[model.SensorType]int
+	Clamped map[model.SensorType]int
+}
+
+// Total returns the number of readings dropped or clamped.
+func (r SanitizeReport) Total() int {
+	n := 0
+	for _, c := range r.Dropped {
+		n += c
+	}
+	for _, c := range r.Clamped {
+		n += c
+	}
+	return n
+}
+
+// String summarises the report, e.g. "grid_power: 2 dropped; pv_power: 1 clamped".
+func (r SanitizeReport) String() string {
+	var parts []string
+	for st, c := range r.Dropped {
+		parts = append(parts, fmt.Sprintf("%s: %d dropped", st, c))
+	}
+	for st, c := range r.Clamped {
+		parts = append(parts, fmt.Sprintf("%s: %d clamped", st, c))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+// Sanitize applies rules to parsed readings, returning the kept readings and
+// counts of what was changed. NaN and infinite values of ruled sensor types
+// are always dropped. The input slice is not modified.
+func Sanitize(readings []model.Reading, rules SanitizeRules) ([]model.Reading, SanitizeReport) {
+	report := SanitizeReport{
+		Dropped: make(map[model.SensorType]int),
+		Clamped: make(map[model.SensorType]int),
+	}
+	if len(rules) == 0 {
+		return readings, report
+	}
+
+	out := make([]model.Reading, 0, len(readings))
+	for _, r := range readings {
+		rule, ok := rules[r.Type]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+		if math.IsNaN(r.Value) || math.IsInf(r.Value, 0) {
+			report.Dropped[r.Type]++
+			continue
+		}
+		if r.Value >= rule.Min && r.Value <= rule.Max {
+			out = append(out, r)
+			continue
+		}
+		if rule.Action == SanitizeClamp {
+			r.Value = min(max(r.Value, rule.Min), rule.Max)
+			r.Min = min(max(r.Min, rule.Min), rule.Max)
+			r.Max = min(max(r.Max, rule.Min), rule.Max)
+			report.Clamped[r.Type]++
+			out = append(out, r)
+			continue
+		}
+		report.Dropped[r.Type]++
+	}
+	return out, report
+}
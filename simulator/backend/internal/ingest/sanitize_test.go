@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+)
+
+func gridReading(ts time.Time, v float64) model.Reading {
+	return model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: v, Unit: "W"}
+}
+
+func TestSanitize_DropsSpikeKeepsValid(t *testing.T) {
+	t0 := time.Date(2024, 11, 21, 12, 0, 0, 0, time.UTC)
+	readings := []model.Reading{
+		gridReading(t0, 1200),
+		gridReading(t0.Add(time.Minute), 99999),
+		gridReading(t0.Add(2*time.Minute), -3500),
+		gridReading(t0.Add(3*time.Minute), 800),
+	}
+
+	out, report := Sanitize(readings, DefaultSanitizeRules())
+
+	require.Len(t, out, 3)
+	assert.Equal(t, 1200.0, out[0].Value)
+	assert.Equal(t, -3500.0, out[1].Value)
+	assert.Equal(t, 800.0, out[2].Value)
+	assert.Equal(t, 1, report.Dropped[model.SensorGridPower])
+	assert.Equal(t, 1, report.Total())
+	assert.Equal(t, "grid_power: 1 dropped", report.String())
+	assert.Len(t, readings, 4, "input must not be modified")
+}
+
+func TestSanitize_TemperatureFault(t *testing.T) {
+	t0 := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	readings := []model.Reading{
+		{Timestamp: t0, Type: model.SensorPumpExtTemp, Value: -12},
+		{Timestamp: t0.Add(time.Hour), Type: model.SensorPumpExtTemp, Value: -99},
+		{Timestamp: t0.Add(2 * time.Hour), Type: model.SensorPumpExtTemp, Value: math.NaN()},
+		// Water temperatures are not bounded by the ambient rule.
+		{Timestamp: t0, Type: model.SensorPumpDischargeTemp, Value: 95},
+	}
+
+	out, report := Sanitize(readings, DefaultSanitizeRules())
+
+	require.Len(t, out, 2)
+	assert.Equal(t, -12.0, out[0].Value)
+	assert.Equal(t, 95.0, out[1].Value)
+	assert.Equal(t, 2, report.Dropped[model.SensorPumpExtTemp])
+}
+
+func TestSanitize_Clamp(t *testing.T) {
+	rules := SanitizeRules{model.SensorGridPower: {Min: -100, Max: 100, Action: SanitizeClamp}}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := gridReading(t0, 500)
+	r.Min, r.Max = 50, 900
+
+	out, report := Sanitize([]model.Reading{r, gridReading(t0.Add(time.Hour), -20)}, rules)
+
+	require.Len(t, out, 2)
+	assert.Equal(t, 100.0, out[0].Value)
+	assert.Equal(t, 50.0, out[0].Min)
+	assert.Equal(t, 100.0, out[0].Max)
+	assert.Equal(t, -20.0, out[1].Value)
+	assert.Equal(t, 1, report.Clamped[model.SensorGridPower])
+}
+
+func TestSanitize_NoRulesPassesThrough(t *testing.T) {
+	readings := []model.Reading{gridReading(time.Now(), 99999)}
+	out, report := Sanitize(readings, nil)
+	assert.Equal(t, readings, out)
+	assert.Zero(t, report.Total())
+}
@@ -0,0 +1,92 @@
+// Package metrics exposes live simulation values as Prometheus metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"energy_simulator/internal/simulator"
+)
+
+const namespace = "energy_sim"
+
+// Callback wraps a simulator.Callback, recording summary, battery, state and
+// reading events as metrics before forwarding them. Events it does not track
+// go straight to the wrapped callback.
+type Callback struct {
+	simulator.Callback
+
+	netCost    prometheus.Gauge
+	importCost prometheus.Gauge
+	exportRev  prometheus.Gauge
+	gridImport prometheus.Gauge
+	gridExport prometheus.Gauge
+	pvKWh      prometheus.Gauge
+	spotPrice  prometheus.Gauge
+	batterySoC prometheus.Gauge
+	batteryW   prometheus.Gauge
+	running    prometheus.Gauge
+	speed      prometheus.Gauge
+	readings   prometheus.Counter
+}
+
+// NewCallback registers the simulation metrics with reg and returns a
+// callback forwarding to next.
+func NewCallback(next simulator.Callback, reg prometheus.Registerer) *Callback {
+	gauge := func(name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help})
+	}
+	c := &Callback{
+		Callback:   next,
+		netCost:    gauge("net_cost_pln", "Net grid cost (import cost minus export revenue) since the start of the replay."),
+		importCost: gauge("grid_import_cost_pln", "Grid import cost since the start of the replay."),
+		exportRev:  gauge("grid_export_revenue_pln", "Grid export revenue since the start of the replay."),
+		gridImport: gauge("grid_import_kwh", "Energy imported from the grid since the start of the replay."),
+		gridExport: gauge("grid_export_kwh", "Energy exported to the grid since the start of the replay."),
+		pvKWh:      gauge("pv_production_kwh", "PV production since the start of the replay."),
+		spotPrice:  gauge("spot_price_pln_kwh", "Spot price at the current simulation time."),
+		batterySoC: gauge("battery_soc_percent", "Simulated battery state of charge."),
+		batteryW:   gauge("battery_power_w", "Simulated battery power, positive = discharging."),
+		running:    gauge("running", "1 while the simulation is playing, 0 when paused."),
+		speed:      gauge("speed", "Simulated seconds per real second."),
+		readings: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "readings_emitted_total",
+			Help:      "Sensor readings emitted by the replay.",
+		}),
+	}
+	reg.MustRegister(c.netCost, c.importCost, c.exportRev, c.gridImport, c.gridExport,
+		c.pvKWh, c.spotPrice, c.batterySoC, c.batteryW, c.running, c.speed, c.readings)
+	return c
+}
+
+func (c *Callback) OnState(s simulator.State) {
+	if s.Running {
+		c.running.Set(1)
+	} else {
+		c.running.Set(0)
+	}
+	c.speed.Set(s.Speed)
+	c.Callback.OnState(s)
+}
+
+func (c *Callback) OnReading(r simulator.SensorReading) {
+	c.readings.Inc()
+	c.Callback.OnReading(r)
+}
+
+func (c *Callback) OnSummary(s simulator.Summary) {
+	c.netCost.Set(s.NetCostPLN)
+	c.importCost.Set(s.GridImportCostPLN)
+	c.exportRev.Set(s.GridExportRevenuePLN)
+	c.gridImport.Set(s.GridImportKWh)
+	c.gridExport.Set(s.GridExportKWh)
+	c.pvKWh.Set(s.PVProductionKWh)
+	c.spotPrice.Set(s.CurrentSpotPrice)
+	c.Callback.OnSummary(s)
+}
+
+func (c *Callback) OnBatteryUpdate(u simulator.BatteryUpdate) {
+	c.batterySoC.Set(u.SoCPercent)
+	c.batteryW.Set(u.BatteryPowerW)
+	c.Callback.OnBatteryUpdate(u)
+}
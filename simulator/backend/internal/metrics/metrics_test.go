@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/store"
+)
+
+// nopCallback ignores all engine events.
+type nopCallback struct{}
+
+func (nopCallback) OnState(simulator.State)                               {}
+func (nopCallback) OnReading(simulator.SensorReading)                     {}
+func (nopCallback) OnSummary(simulator.Summary)                           {}
+func (nopCallback) OnBatteryUpdate(simulator.BatteryUpdate)               {}
+func (nopCallback) OnBatterySummary(simulator.BatterySummary)             {}
+func (nopCallback) OnArbitrageDayLog([]simulator.ArbitrageDayRecord)      {}
+func (nopCallback) OnPredictionComparison(simulator.PredictionComparison) {}
+func (nopCallback) OnHeatingStats([]simulator.HeatingMonthStat)           {}
+func (nopCallback) OnMonthlyCosts([]simulator.MonthlyCost)                {}
+func (nopCallback) OnAnomalyDays([]simulator.AnomalyDayRecord)            {}
+func (nopCallback) OnLoadShiftStats(simulator.LoadShiftStats)             {}
+func (nopCallback) OnHPDiagnostics(simulator.HPDiagnostics)               {}
+func (nopCallback) OnPowerQuality(simulator.PowerQuality)                 {}
+func (nopCallback) OnApplianceCosts([]simulator.ApplianceCost)            {}
+func (nopCallback) OnStrategyComparison(simulator.StrategyComparison)     {}
+func (nopCallback) OnConfigComparison(simulator.ConfigComparison)         {}
+func (nopCallback) OnDailySummary(simulator.PeriodSummary)                {}
+func (nopCallback) OnMonthlySummary(simulator.PeriodSummary)              {}
+func (nopCallback) OnEvent(simulator.Event)                               {}
+func (nopCallback) OnFlowSankey(simulator.FlowSankey)                     {}
+
+func TestMetricsEndpoint(t *testing.T) {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for h := range 4 {
+		s.AddReadings([]model.Reading{{
+			Timestamp: start.Add(time.Duration(h) * time.Hour),
+			SensorID:  "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W",
+		}})
+	}
+
+	reg := prometheus.NewRegistry()
+	engine := simulator.New(s, NewCallback(nopCallback{}, reg))
+	require.True(t, engine.Init())
+	engine.SetBattery(&simulator.BatteryConfig{
+		CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 10, ChargeToPercent: 100, InitialSoCPercent: 80,
+	})
+	engine.Step(3 * time.Hour)
+
+	srv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	text := string(body)
+
+	for _, name := range []string{
+		"energy_sim_net_cost_pln",
+		"energy_sim_grid_import_kwh",
+		"energy_sim_spot_price_pln_kwh",
+		"energy_sim_battery_soc_percent",
+		"energy_sim_running",
+		"energy_sim_readings_emitted_total",
+	} {
+		assert.Regexp(t, "(?m)^"+name+" ", text)
+	}
+
+	soc := regexp.MustCompile(`(?m)^energy_sim_battery_soc_percent (\S+)$`).FindStringSubmatch(text)
+	require.Len(t, soc, 2)
+	socPct, err := strconv.ParseFloat(soc[1], 64)
+	require.NoError(t, err)
+	// 1 kW load discharged from 80% for up to 3 h of a 10 kWh battery.
+	assert.Greater(t, socPct, 10.0)
+	assert.Less(t, socPct, 80.0)
+
+	assert.Contains(t, text, "energy_sim_readings_emitted_total 4")
+	assert.Contains(t, text, "energy_sim_running 0")
+}
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type SensorType string
 
@@ -30,6 +34,13 @@ const (
 	SensorGridPowerFactor    SensorType = "grid_power_factor"
 	SensorGridPowerReactive  SensorType = "grid_power_reactive"
 	SensorGridEnergyReactive SensorType = "grid_energy_reactive"
+	// Three-phase installs: per-phase grid power and voltage
+	SensorGridPowerL1        SensorType = "grid_power_l1"
+	SensorGridPowerL2        SensorType = "grid_power_l2"
+	SensorGridPowerL3        SensorType = "grid_power_l3"
+	SensorGridVoltageL1      SensorType = "grid_voltage_l1"
+	SensorGridVoltageL2      SensorType = "grid_voltage_l2"
+	SensorGridVoltageL3      SensorType = "grid_voltage_l3"
 	SensorPumpHeaterRoom     SensorType = "pump_heater_room_hours"
 	SensorPumpHeaterDHW      SensorType = "pump_heater_dhw_hours"
 	SensorPumpFlow           SensorType = "pump_flow"
@@ -185,6 +196,79 @@ func init() {
 type SensorInfo struct {
 	Name string
 	Unit string
+	// Cumulative marks monotonic counters (lifetime kWh, operation hours)
+	// whose consumption is the difference between readings, not an integral.
+	Cumulative bool
+	// Integration is the default method for integrating power readings.
+	Integration IntegrationMethod
+}
+
+// IntegrationMethod selects how power is averaged over the interval between
+// two consecutive readings when integrating it into energy.
+type IntegrationMethod int
+
+const (
+	// IntegrateTrapezoid averages both endpoints (linear change between samples).
+	IntegrateTrapezoid IntegrationMethod = iota
+	// IntegrateLeft holds the previous value over the interval.
+	IntegrateLeft
+	// IntegrateRight applies the current value to the whole interval.
+	IntegrateRight
+)
+
+// IntegrateStep is for step-valued sensors (appliances reporting on change)
+// that hold a value until the next sample; it is the left-endpoint rule.
+const IntegrateStep = IntegrateLeft
+
+var integrationNames = map[string]IntegrationMethod{
+	"trapezoid": IntegrateTrapezoid,
+	"left":      IntegrateLeft,
+	"right":     IntegrateRight,
+	"step":      IntegrateStep,
+}
+
+// ParseIntegrationMethod parses "trapezoid", "left", "right" or "step".
+func ParseIntegrationMethod(s string) (IntegrationMethod, error) {
+	m, ok := integrationNames[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("unknown integration method %q", s)
+	}
+	return m, nil
+}
+
+// ParseIntegrationOverrides parses a comma-separated list of
+// sensor_type=method pairs, e.g. "oven=step,washing=step".
+func ParseIntegrationOverrides(spec string) (map[SensorType]IntegrationMethod, error) {
+	out := make(map[SensorType]IntegrationMethod)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		st, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid integration override %q: want type=method", pair)
+		}
+		m, err := ParseIntegrationMethod(name)
+		if err != nil {
+			return nil, err
+		}
+		out[SensorType(strings.TrimSpace(st))] = m
+	}
+	return out, nil
+}
+
+// IntervalAverage returns the average power over the interval between a
+// reading of prev and the next reading of cur.
+func IntervalAverage(m IntegrationMethod, prev, cur float64) float64 {
+	switch m {
+	case IntegrateLeft:
+		return prev
+	case IntegrateRight:
+		return cur
+	default:
+		return (prev + cur) / 2
+	}
 }
 
 // SensorCatalog maps every known SensorType to its display name and unit.
@@ -213,9 +297,15 @@ var SensorCatalog = map[SensorType]SensorInfo{
 	SensorGridVoltage:       {Name: "Grid Voltage", Unit: "V"},
 	SensorGridPowerFactor:   {Name: "Power Factor", Unit: "%"},
 	SensorGridPowerReactive: {Name: "Reactive Power", Unit: "VAR"},
-	SensorGridEnergyReactive: {Name: "Reactive Energy", Unit: "kvarh"},
-	SensorPumpHeaterRoom:    {Name: "Backup Heater Room Hours", Unit: "h"},
-	SensorPumpHeaterDHW:     {Name: "Backup Heater DHW Hours", Unit: "h"},
+	SensorGridEnergyReactive: {Name: "Reactive Energy", Unit: "kvarh", Cumulative: true},
+	SensorGridPowerL1:       {Name: "Grid Power L1", Unit: "W"},
+	SensorGridPowerL2:       {Name: "Grid Power L2", Unit: "W"},
+	SensorGridPowerL3:       {Name: "Grid Power L3", Unit: "W"},
+	SensorGridVoltageL1:     {Name: "Grid Voltage L1", Unit: "V"},
+	SensorGridVoltageL2:     {Name: "Grid Voltage L2", Unit: "V"},
+	SensorGridVoltageL3:     {Name: "Grid Voltage L3", Unit: "V"},
+	SensorPumpHeaterRoom:    {Name: "Backup Heater Room Hours", Unit: "h", Cumulative: true},
+	SensorPumpHeaterDHW:     {Name: "Backup Heater DHW Hours", Unit: "h", Cumulative: true},
 	SensorPumpFlow:          {Name: "Pump Flow", Unit: "L/min"},
 	SensorPumpDHWTemp:       {Name: "DHW Tank Temperature", Unit: "°C"},
 	SensorPumpFanSpeed:      {Name: "Fan Speed", Unit: "R/min"},
@@ -271,6 +361,33 @@ var SensorCatalog = map[SensorType]SensorInfo{
 	SensorVoltageLivingMedia: {Name: "Living Room Media Voltage", Unit: "V"},
 }
 
+// GridPhasePower and GridPhaseVoltage list the per-phase grid sensors of a
+// three-phase install, indexed by phase (L1, L2, L3).
+var (
+	GridPhasePower   = [3]SensorType{SensorGridPowerL1, SensorGridPowerL2, SensorGridPowerL3}
+	GridPhaseVoltage = [3]SensorType{SensorGridVoltageL1, SensorGridVoltageL2, SensorGridVoltageL3}
+)
+
+// IsCumulative reports whether st is a monotonic counter sensor.
+func IsCumulative(st SensorType) bool {
+	return SensorCatalog[st].Cumulative
+}
+
+// IntegrationFor returns the catalog integration method for st.
+func IntegrationFor(st SensorType) IntegrationMethod {
+	return SensorCatalog[st].Integration
+}
+
+// CounterDelta returns the increase of a cumulative counter between two
+// readings. A drop means the counter was reset (meter replaced or device
+// restarted), so the new value is the amount counted since the reset.
+func CounterDelta(prev, cur float64) float64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
 type Reading struct {
 	Timestamp time.Time
 	SensorID  string
@@ -281,6 +398,15 @@ type Reading struct {
 	Unit      string
 }
 
+// Peak returns the highest value the reading covers: Max for aggregated
+// statistics rows, otherwise Value.
+func (r Reading) Peak() float64 {
+	if r.Max > r.Value {
+		return r.Max
+	}
+	return r.Value
+}
+
 type Sensor struct {
 	ID   string
 	Name string
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSensorType(t *testing.T) {
@@ -77,3 +78,71 @@ func TestSensor(t *testing.T) {
 	assert.Equal(t, "sensor.zigbee_power", s.ID)
 	assert.Equal(t, SensorGridPower, s.Type)
 }
+
+func TestIsCumulative(t *testing.T) {
+	assert.True(t, IsCumulative(SensorGridEnergyReactive))
+	assert.True(t, IsCumulative(SensorPumpHeaterRoom))
+	assert.False(t, IsCumulative(SensorGridPower))
+	assert.False(t, IsCumulative(SensorType("unknown")))
+}
+
+func TestCounterDelta_ResetMidSeries(t *testing.T) {
+	// Operation hours climb, the counter resets to zero, then climbs again.
+	series := []float64{100, 102, 105, 1, 3}
+	var total float64
+	for i := 1; i < len(series); i++ {
+		total += CounterDelta(series[i-1], series[i])
+	}
+	// 2 + 3 before the reset, 1 counted since it, then 2.
+	assert.InDelta(t, 8.0, total, 1e-9)
+	assert.Equal(t, 0.0, CounterDelta(5, 5))
+}
+
+func TestReadingPeak(t *testing.T) {
+	stats := Reading{Value: 1000, Min: 200, Max: 5000}
+	assert.Equal(t, 5000.0, stats.Peak())
+
+	// Instantaneous readings carry Min = Max = Value; zero Max falls back too.
+	assert.Equal(t, 750.0, Reading{Value: 750, Min: 750, Max: 750}.Peak())
+	assert.Equal(t, 750.0, Reading{Value: 750}.Peak())
+}
+
+func TestIntervalAverage_StepFunction(t *testing.T) {
+	// A kettle reports on change: 2000 W at 0:00, off (0 W) at 0:30, idle
+	// until a final 0 W sample at 1:00. True energy is 1000 Wh.
+	ts := []float64{0, 0.5, 1}
+	vals := []float64{2000, 0, 0}
+	integrate := func(m IntegrationMethod) float64 {
+		var wh float64
+		for i := 1; i < len(vals); i++ {
+			wh += IntervalAverage(m, vals[i-1], vals[i]) * (ts[i] - ts[i-1])
+		}
+		return wh
+	}
+
+	assert.InDelta(t, 500, integrate(IntegrateTrapezoid), 1e-9, "trapezoid under-estimates a step down")
+	assert.InDelta(t, 1000, integrate(IntegrateStep), 1e-9)
+	assert.InDelta(t, 0, integrate(IntegrateRight), 1e-9)
+
+	// Switching on: the right endpoint catches the new value, trapezoid
+	// credits half of it to the interval before the switch.
+	assert.InDelta(t, 1000, IntervalAverage(IntegrateTrapezoid, 0, 2000), 1e-9)
+	assert.InDelta(t, 0, IntervalAverage(IntegrateLeft, 0, 2000), 1e-9)
+	assert.InDelta(t, 2000, IntervalAverage(IntegrateRight, 0, 2000), 1e-9)
+}
+
+func TestParseIntegrationOverrides(t *testing.T) {
+	got, err := ParseIntegrationOverrides("oven=step, washing=Right,")
+	require.NoError(t, err)
+	assert.Equal(t, map[SensorType]IntegrationMethod{
+		SensorOven:    IntegrateLeft,
+		SensorWashing: IntegrateRight,
+	}, got)
+
+	_, err = ParseIntegrationOverrides("oven=simpson")
+	assert.Error(t, err)
+	_, err = ParseIntegrationOverrides("oven")
+	assert.Error(t, err)
+
+	assert.Equal(t, IntegrateTrapezoid, IntegrationFor(SensorGridPower))
+}
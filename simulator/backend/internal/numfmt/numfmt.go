@@ -0,0 +1,97 @@
+// Package numfmt formats numbers and money for the analysis tools' output,
+// with a configurable currency label and locale-specific separators.
+package numfmt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of the bundled price data.
+const DefaultCurrency = "PLN"
+
+// Locale selects the decimal and thousands separators.
+type Locale struct {
+	Decimal   string
+	Thousands string
+}
+
+// Locales maps the names accepted by -locale to their separators. "plain"
+// matches Go's default formatting (no grouping).
+var Locales = map[string]Locale{
+	"plain": {Decimal: ".", Thousands: ""},
+	"en":    {Decimal: ".", Thousands: ","},
+	"pl":    {Decimal: ",", Thousands: " "},
+	"de":    {Decimal: ",", Thousands: "."},
+	"fr":    {Decimal: ",", Thousands: " "},
+	"ch":    {Decimal: ".", Thousands: "'"},
+}
+
+// Formatter renders numbers with a locale's separators and money with a
+// currency label. The zero value formats like Go's default with PLN.
+type Formatter struct {
+	Currency string
+	Locale   Locale
+}
+
+// New returns a Formatter for the currency label and locale name. An empty
+// currency means DefaultCurrency and an empty locale means "plain".
+func New(currency, locale string) (Formatter, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if locale == "" {
+		locale = "plain"
+	}
+	loc, ok := Locales[strings.ToLower(locale)]
+	if !ok {
+		return Formatter{}, fmt.Errorf("unknown locale %q", locale)
+	}
+	return Formatter{Currency: currency, Locale: loc}, nil
+}
+
+// Number formats v with the given number of decimals, grouping the integer
+// part in thousands.
+func (f Formatter) Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	intPart, fracPart, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(f.Locale.Thousands)
+		}
+		b.WriteRune(d)
+	}
+	if fracPart != "" {
+		if f.Locale.Decimal == "" {
+			b.WriteByte('.')
+		} else {
+			b.WriteString(f.Locale.Decimal)
+		}
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+// Money formats an amount with two decimals and the currency label.
+func (f Formatter) Money(v float64) string {
+	return f.Number(v, 2) + " " + f.currency()
+}
+
+// PerKWh returns the unit label for prices, e.g. "PLN/kWh".
+func (f Formatter) PerKWh() string {
+	return f.currency() + "/kWh"
+}
+
+func (f Formatter) currency() string {
+	if f.Currency == "" {
+		return DefaultCurrency
+	}
+	return f.Currency
+}
@@ -0,0 +1,45 @@
+package numfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumber_Separators(t *testing.T) {
+	en, err := New("", "en")
+	require.NoError(t, err)
+	assert.Equal(t, "1,234,567.89", en.Number(1234567.891, 2))
+	assert.Equal(t, "999.5", en.Number(999.5, 1))
+	assert.Equal(t, "-12,345", en.Number(-12345, 0))
+	assert.Equal(t, "0.00", en.Number(-0.001, 2), "no negative zero")
+
+	pl, err := New("", "pl")
+	require.NoError(t, err)
+	assert.Equal(t, "1 234,50", pl.Number(1234.5, 2))
+
+	de, err := New("", "de")
+	require.NoError(t, err)
+	assert.Equal(t, "1.234.567,0", de.Number(1234567, 1))
+
+	plain, err := New("", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1234567.89", plain.Number(1234567.89, 2))
+}
+
+func TestMoney_CurrencyLabel(t *testing.T) {
+	f, err := New("EUR", "en")
+	require.NoError(t, err)
+	assert.Equal(t, "12,345.68 EUR", f.Money(12345.678))
+	assert.Equal(t, "EUR/kWh", f.PerKWh())
+
+	var zero Formatter
+	assert.Equal(t, "1234.50 PLN", zero.Money(1234.5))
+	assert.Equal(t, "PLN/kWh", zero.PerKWh())
+}
+
+func TestNew_UnknownLocale(t *testing.T) {
+	_, err := New("PLN", "xx")
+	assert.Error(t, err)
+}
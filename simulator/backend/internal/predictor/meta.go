@@ -0,0 +1,70 @@
+package predictor
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ModelSchemaVersion is the saved-model format written by Save. Bump it when
+// the feature encoding or JSON layout changes incompatibly.
+//
+//  1. initial metadata block
+//  2. network input_mean/input_std standardization; builds that predate it
+//     would ignore the statistics and predict garbage
+const ModelSchemaVersion = 2
+
+// minModelSchemaVersion is the oldest format this build still loads. Version
+// 1 models carry no input statistics, so they run unstandardized as trained.
+const minModelSchemaVersion = 1
+
+// PowerFeatures names the inputs produced by EncodeFeatures, in order.
+var PowerFeatures = []string{"sin_month", "cos_month", "sin_hour", "cos_hour", "norm_temp"}
+
+// TempFeatures names the inputs produced by EncodeTempFeatures, in order.
+var TempFeatures = []string{"sin_day", "cos_day", "sin_hour", "cos_hour", "anomaly"}
+
+// ModelMeta describes how a saved model was trained.
+type ModelMeta struct {
+	SchemaVersion int       `json:"schema_version"`
+	TrainedAt     time.Time `json:"trained_at"`
+	NSamples      int       `json:"n_samples"`
+	Features      []string  `json:"features"`
+	Loss          float64   `json:"loss"`               // final validation loss (normalized units)
+	Quantile      float64   `json:"quantile,omitempty"` // set for pinball-loss models
+}
+
+// newModelMeta builds metadata for a freshly trained model.
+func newModelMeta(features []string, nSamples int, losses []float64, cfg TrainConfig) ModelMeta {
+	m := ModelMeta{
+		SchemaVersion: ModelSchemaVersion,
+		TrainedAt:     time.Now().UTC(),
+		NSamples:      nSamples,
+		Features:      slices.Clone(features),
+	}
+	if len(losses) > 0 {
+		m.Loss = losses[len(losses)-1]
+	}
+	if cfg.Loss == LossPinball {
+		m.Quantile = cfg.Quantile
+	}
+	return m
+}
+
+// validateMeta checks that a loaded model matches this build's schema and
+// feature encoding. Models saved before metadata was introduced have no meta
+// block and are accepted as-is, like version 1.
+func validateMeta(m *ModelMeta, features []string) error {
+	if m == nil {
+		return nil
+	}
+	if m.SchemaVersion < minModelSchemaVersion || m.SchemaVersion > ModelSchemaVersion {
+		return fmt.Errorf("model schema version %d is not supported (expected %d–%d); retrain with train-predictor",
+			m.SchemaVersion, minModelSchemaVersion, ModelSchemaVersion)
+	}
+	if !slices.Equal(m.Features, features) {
+		return fmt.Errorf("model features %v do not match expected %v; retrain with train-predictor",
+			m.Features, features)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package predictor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelMeta_WrittenOnSave(t *testing.T) {
+	samples := generateSyntheticSamples(200, 42)
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 5
+
+	pred, losses := TrainPredictor(samples, cfg, 42)
+	data, err := pred.Save()
+	require.NoError(t, err)
+
+	var m SavedModel
+	require.NoError(t, json.Unmarshal(data, &m))
+	require.NotNil(t, m.Meta)
+	assert.Equal(t, ModelSchemaVersion, m.Meta.SchemaVersion)
+	assert.Equal(t, len(samples), m.Meta.NSamples)
+	assert.Equal(t, PowerFeatures, m.Meta.Features)
+	assert.Equal(t, losses[len(losses)-1], m.Meta.Loss)
+	assert.False(t, m.Meta.TrainedAt.IsZero())
+
+	loaded, err := LoadPredictor(data, 1)
+	require.NoError(t, err)
+	assert.Equal(t, m.Meta.NSamples, loaded.Meta().NSamples)
+}
+
+func TestModelMeta_UnknownVersionRejected(t *testing.T) {
+	model := `{
+		"meta": {"schema_version": 99, "features": ["sin_month", "cos_month", "sin_hour", "cos_hour", "norm_temp"]},
+		"network": {"layers": [{"weights": [[0, 0, 0, 0, 1]], "biases": [0]}]}
+	}`
+
+	_, err := LoadPredictor([]byte(model), 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "schema version 99")
+	assert.Contains(t, err.Error(), "retrain")
+
+	_, err = LoadTemperaturePredictor([]byte(model), 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "temperature model")
+}
+
+func TestModelMeta_Version1Loads(t *testing.T) {
+	// Saved before input standardization: no input_mean/input_std.
+	model := `{
+		"meta": {"schema_version": 1, "features": ["sin_month", "cos_month", "sin_hour", "cos_hour", "norm_temp"]},
+		"network": {"layers": [{"weights": [[0, 0, 0, 0, 1]], "biases": [0]}]}
+	}`
+
+	pred, err := LoadPredictor([]byte(model), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pred.Meta().SchemaVersion)
+	assert.Empty(t, pred.net.InputMean)
+
+	_, err = LoadPredictor([]byte(`{"meta": {"schema_version": 0, "features": []}}`), 1)
+	assert.Error(t, err)
+}
+
+func TestModelMeta_FeatureMismatchRejected(t *testing.T) {
+	samples := generateSyntheticTempSamples(100, 42)
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 2
+	tempPred, _ := TrainTemperaturePredictor(samples, cfg, 42)
+	data, err := tempPred.Save()
+	require.NoError(t, err)
+
+	// A temperature model loaded as a power model has the wrong features.
+	_, err = LoadPredictor(data, 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "features")
+}
+
+func TestModelMeta_LegacyModelWithoutMeta(t *testing.T) {
+	model := `{"network": {"layers": [{"weights": [[0, 0, 0, 0, 1]], "biases": [0]}]}}`
+
+	pred, err := LoadPredictor([]byte(model), 1)
+	require.NoError(t, err)
+	assert.Nil(t, pred.Meta())
+}
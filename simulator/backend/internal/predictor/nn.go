@@ -18,6 +18,7 @@ type Layer struct {
 	// Cached activations for backprop (not serialized).
 	input  []float64
 	output []float64
+	mask   []float64 // dropout scale per unit (nil when not dropping)
 	dW     [][]float64
 	dB     []float64
 }
@@ -25,8 +26,23 @@ type Layer struct {
 // Network is a feedforward neural network with ReLU hidden layers and linear output.
 type Network struct {
 	Layers []Layer `json:"layers"`
+
+	// InputMean and InputStd standardize each input feature in Forward when
+	// set; they are computed from training data and saved with the model.
+	InputMean []float64 `json:"input_mean,omitempty"`
+	InputStd  []float64 `json:"input_std,omitempty"`
 }
 
+// LossKind selects the training loss.
+type LossKind string
+
+const (
+	// LossMSE fits the conditional mean (default).
+	LossMSE LossKind = "mse"
+	// LossPinball fits the conditional TrainConfig.Quantile.
+	LossPinball LossKind = "pinball"
+)
+
 // TrainConfig holds hyperparameters for training.
 type TrainConfig struct {
 	LearningRate float64
@@ -35,6 +51,23 @@ type TrainConfig struct {
 	Epsilon      float64
 	BatchSize    int
 	Epochs       int
+
+	// DropoutRate is the probability of zeroing each hidden activation
+	// during training (0 disables dropout). Inference never drops.
+	DropoutRate float64
+
+	// L2 is the weight-decay coefficient: L2·w is added to each weight's
+	// gradient before the Adam update (0 disables it). Biases are not decayed.
+	L2 float64
+
+	// Loss selects the training loss; empty means LossMSE. Quantile (0-1)
+	// is the target quantile for LossPinball.
+	Loss     LossKind
+	Quantile float64
+
+	// StandardizeInputs z-scores each input feature using statistics from
+	// the training split, stored on the Network for predict time.
+	StandardizeInputs bool
 }
 
 // DefaultTrainConfig returns sensible defaults for training.
@@ -46,6 +79,8 @@ func DefaultTrainConfig() TrainConfig {
 		Epsilon:      1e-8,
 		BatchSize:    64,
 		Epochs:       200,
+
+		StandardizeInputs: true,
 	}
 }
 
@@ -88,10 +123,31 @@ func (n *Network) initAdam() {
 	}
 }
 
+// WeightNorm returns the L2 norm of all weights (biases excluded).
+func (n *Network) WeightNorm() float64 {
+	var sum float64
+	for _, l := range n.Layers {
+		for _, row := range l.Weights {
+			for _, w := range row {
+				sum += w * w
+			}
+		}
+	}
+	return math.Sqrt(sum)
+}
+
 // Forward computes the network output, caching activations for backprop.
-// Hidden layers use ReLU; the output layer is linear.
+// Hidden layers use ReLU; the output layer is linear. Forward never applies
+// dropout, so it is the pass used at predict time.
 func (n *Network) Forward(input []float64) []float64 {
-	x := input
+	return n.forward(input, 0, nil)
+}
+
+// forward is Forward with inverted dropout on hidden activations: each unit is
+// zeroed with probability rate and survivors are scaled by 1/(1-rate), so no
+// rescaling is needed at inference.
+func (n *Network) forward(input []float64, rate float64, rng *rand.Rand) []float64 {
+	x := n.standardize(input)
 	for i := range n.Layers {
 		l := &n.Layers[i]
 		l.input = make([]float64, len(x))
@@ -116,12 +172,68 @@ func (n *Network) Forward(input []float64) []float64 {
 			}
 		}
 
+		l.mask = nil
+		if rate > 0 && i < len(n.Layers)-1 {
+			l.mask = make([]float64, out)
+			keep := 1 / (1 - rate)
+			for j := range y {
+				if rng.Float64() >= rate {
+					l.mask[j] = keep
+				}
+				y[j] *= l.mask[j]
+			}
+		}
+
 		l.output = y
 		x = y
 	}
 	return x
 }
 
+// standardize applies the stored input standardization, if any.
+func (n *Network) standardize(input []float64) []float64 {
+	if len(n.InputMean) != len(input) || len(n.InputStd) != len(input) {
+		return input
+	}
+	x := make([]float64, len(input))
+	for k, v := range input {
+		x[k] = (v - n.InputMean[k]) / n.InputStd[k]
+	}
+	return x
+}
+
+// ComputeInputStandardization returns per-feature mean and standard deviation
+// of X. Constant features get std 1 so they pass through centred.
+func ComputeInputStandardization(X [][]float64) (mean, std []float64) {
+	if len(X) == 0 {
+		return nil, nil
+	}
+	nf := len(X[0])
+	mean = make([]float64, nf)
+	std = make([]float64, nf)
+	for _, x := range X {
+		for k, v := range x {
+			mean[k] += v
+		}
+	}
+	for k := range mean {
+		mean[k] /= float64(len(X))
+	}
+	for _, x := range X {
+		for k, v := range x {
+			d := v - mean[k]
+			std[k] += d * d
+		}
+	}
+	for k := range std {
+		std[k] = math.Sqrt(std[k] / float64(len(X)))
+		if std[k] < 1e-10 {
+			std[k] = 1
+		}
+	}
+	return mean, std
+}
+
 // Backward computes gradients given the derivative of loss w.r.t. the output.
 // Must be called after Forward. Gradients are accumulated in layer.dW / layer.dB.
 func (n *Network) Backward(dOutput []float64) {
@@ -131,11 +243,14 @@ func (n *Network) Backward(dOutput []float64) {
 		out := len(l.Weights)
 		in := len(l.Weights[0])
 
-		// Apply ReLU derivative for hidden layers.
+		// Apply ReLU (and dropout) derivative for hidden layers. Dropped
+		// units have zero output, so they are cleared here as well.
 		if i < len(n.Layers)-1 {
 			for j := 0; j < out; j++ {
 				if l.output[j] <= 0 {
 					dx[j] = 0
+				} else if l.mask != nil {
+					dx[j] *= l.mask[j]
 				}
 			}
 		}
@@ -182,8 +297,9 @@ func (n *Network) UpdateAdam(cfg TrainConfig, step int) {
 		l := &n.Layers[i]
 		for j := range l.Weights {
 			for k := range l.Weights[j] {
-				l.mW[j][k] = cfg.Beta1*l.mW[j][k] + (1-cfg.Beta1)*l.dW[j][k]
-				l.vW[j][k] = cfg.Beta2*l.vW[j][k] + (1-cfg.Beta2)*l.dW[j][k]*l.dW[j][k]
+				g := l.dW[j][k] + cfg.L2*l.Weights[j][k]
+				l.mW[j][k] = cfg.Beta1*l.mW[j][k] + (1-cfg.Beta1)*g
+				l.vW[j][k] = cfg.Beta2*l.vW[j][k] + (1-cfg.Beta2)*g*g
 				mHat := l.mW[j][k] / (1 - math.Pow(cfg.Beta1, float64(step)))
 				vHat := l.vW[j][k] / (1 - math.Pow(cfg.Beta2, float64(step)))
 				l.Weights[j][k] -= cfg.LearningRate * mHat / (math.Sqrt(vHat) + cfg.Epsilon)
@@ -199,7 +315,8 @@ func (n *Network) UpdateAdam(cfg TrainConfig, step int) {
 	}
 }
 
-// Train runs mini-batch Adam training and returns per-epoch validation MSE loss.
+// Train runs mini-batch Adam training and returns per-epoch validation loss
+// (MSE, or pinball loss when cfg.Loss is LossPinball).
 func (n *Network) Train(trainX, trainY, valX, valY [][]float64, cfg TrainConfig, rng *rand.Rand) []float64 {
 	nTrain := len(trainX)
 	indices := make([]int, nTrain)
@@ -227,10 +344,9 @@ func (n *Network) Train(trainX, trainY, valX, valY [][]float64, cfg TrainConfig,
 			n.ZeroGrad()
 			for b := batchStart; b < batchEnd; b++ {
 				idx := indices[b]
-				output := n.Forward(trainX[idx])
-				// MSE gradient: 2*(pred - target) / batchSize
-				dOutput := []float64{2 * (output[0] - trainY[idx][0]) / float64(batchSize)}
-				n.Backward(dOutput)
+				output := n.forward(trainX[idx], cfg.DropoutRate, rng)
+				grad := lossGradient(cfg, output[0], trainY[idx][0])
+				n.Backward([]float64{grad / float64(batchSize)})
 			}
 
 			step++
@@ -239,12 +355,46 @@ func (n *Network) Train(trainX, trainY, valX, valY [][]float64, cfg TrainConfig,
 		}
 
 		// Compute validation loss.
-		epochLosses[epoch] = n.MSELoss(valX, valY)
+		epochLosses[epoch] = n.Loss(valX, valY, cfg)
 	}
 
 	return epochLosses
 }
 
+// lossGradient returns d(loss)/d(prediction) for a single sample.
+func lossGradient(cfg TrainConfig, pred, target float64) float64 {
+	if cfg.Loss == LossPinball {
+		// Pinball loss: q·r for r ≥ 0, (q−1)·r otherwise, with r = target − pred.
+		if target > pred {
+			return -cfg.Quantile
+		}
+		return 1 - cfg.Quantile
+	}
+	// MSE gradient: 2*(pred - target)
+	return 2 * (pred - target)
+}
+
+// Loss computes the configured training loss over a dataset.
+func (n *Network) Loss(X, Y [][]float64, cfg TrainConfig) float64 {
+	if cfg.Loss == LossPinball {
+		return n.PinballLoss(X, Y, cfg.Quantile)
+	}
+	return n.MSELoss(X, Y)
+}
+
+// PinballLoss computes the mean quantile (pinball) loss for quantile q.
+func (n *Network) PinballLoss(X, Y [][]float64, q float64) float64 {
+	if len(X) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for i := range X {
+		r := Y[i][0] - n.Forward(X[i])[0]
+		sum += max(q*r, (q-1)*r)
+	}
+	return sum / float64(len(X))
+}
+
 // MSELoss computes mean squared error over a dataset.
 func (n *Network) MSELoss(X, Y [][]float64) float64 {
 	if len(X) == 0 {
@@ -259,7 +409,7 @@ func (n *Network) MSELoss(X, Y [][]float64) float64 {
 	return sum / float64(len(X))
 }
 
-// MarshalJSON serializes the network weights and biases.
+// MarshalJSON serializes the network weights, biases and input standardization.
 func (n *Network) MarshalJSON() ([]byte, error) {
 	type layerJSON struct {
 		Weights [][]float64 `json:"weights"`
@@ -270,22 +420,28 @@ func (n *Network) MarshalJSON() ([]byte, error) {
 		layers[i] = layerJSON{Weights: l.Weights, Biases: l.Biases}
 	}
 	return json.Marshal(struct {
-		Layers []layerJSON `json:"layers"`
-	}{Layers: layers})
+		Layers    []layerJSON `json:"layers"`
+		InputMean []float64   `json:"input_mean,omitempty"`
+		InputStd  []float64   `json:"input_std,omitempty"`
+	}{Layers: layers, InputMean: n.InputMean, InputStd: n.InputStd})
 }
 
-// UnmarshalJSON deserializes network weights/biases and reinitializes Adam state.
+// UnmarshalJSON deserializes network weights/biases and input standardization,
+// and reinitializes Adam state.
 func (n *Network) UnmarshalJSON(data []byte) error {
 	type layerJSON struct {
 		Weights [][]float64 `json:"weights"`
 		Biases  []float64   `json:"biases"`
 	}
 	var raw struct {
-		Layers []layerJSON `json:"layers"`
+		Layers    []layerJSON `json:"layers"`
+		InputMean []float64   `json:"input_mean"`
+		InputStd  []float64   `json:"input_std"`
 	}
 	if err := json.Unmarshal(data, &raw); err != nil {
 		return err
 	}
+	n.InputMean, n.InputStd = raw.InputMean, raw.InputStd
 	n.Layers = make([]Layer, len(raw.Layers))
 	for i, l := range raw.Layers {
 		n.Layers[i] = Layer{Weights: l.Weights, Biases: l.Biases}
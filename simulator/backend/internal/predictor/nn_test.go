@@ -115,3 +115,105 @@ func TestNetwork_GradientCheck(t *testing.T) {
 		}
 	}
 }
+
+func TestNetwork_ForwardNeverDrops(t *testing.T) {
+	rng := rand.New(rand.NewPCG(42, 0))
+	net := NewNetwork([]int{5, 32, 16, 1}, rng)
+	input := []float64{0.1, 0.2, 0.3, 0.4, 0.5}
+
+	// A dropout training pass must not leave state that affects inference.
+	net.forward(input, 0.9, rng)
+	first := net.Forward(input)[0]
+	for range 5 {
+		assert.Equal(t, first, net.Forward(input)[0])
+	}
+}
+
+func TestNetwork_DropoutNarrowsGeneralizationGap(t *testing.T) {
+	// A tiny noisy dataset that a wide network can memorize.
+	dataRng := rand.New(rand.NewPCG(7, 0))
+	var X, Y [][]float64
+	for range 40 {
+		x := []float64{dataRng.Float64()*2 - 1, dataRng.Float64()*2 - 1, dataRng.Float64()*2 - 1}
+		X = append(X, x)
+		Y = append(Y, []float64{x[0] + dataRng.NormFloat64()*0.5})
+	}
+	trainX, trainY, valX, valY := X[:20], Y[:20], X[20:], Y[20:]
+
+	gap := func(dropout float64) float64 {
+		rng := rand.New(rand.NewPCG(42, 0))
+		net := NewNetwork([]int{3, 64, 64, 1}, rng)
+		cfg := DefaultTrainConfig()
+		cfg.LearningRate = 0.01
+		cfg.BatchSize = 20
+		cfg.Epochs = 1500
+		cfg.DropoutRate = dropout
+		net.Train(trainX, trainY, valX, valY, cfg, rng)
+		return net.MSELoss(valX, valY) - net.MSELoss(trainX, trainY)
+	}
+
+	noDropout := gap(0)
+	heavyDropout := gap(0.5)
+	t.Logf("val-train gap: no dropout %.4f, dropout 0.5 %.4f", noDropout, heavyDropout)
+	assert.Less(t, heavyDropout, noDropout)
+}
+
+func TestNetwork_L2ShrinksWeights(t *testing.T) {
+	dataRng := rand.New(rand.NewPCG(7, 0))
+	var X, Y [][]float64
+	for range 100 {
+		x := []float64{dataRng.Float64()*2 - 1, dataRng.Float64()*2 - 1}
+		X = append(X, x)
+		Y = append(Y, []float64{x[0] - 2*x[1] + dataRng.NormFloat64()*0.1})
+	}
+
+	weightNorm := func(l2 float64) float64 {
+		rng := rand.New(rand.NewPCG(42, 0))
+		net := NewNetwork([]int{2, 16, 1}, rng)
+		cfg := DefaultTrainConfig()
+		cfg.LearningRate = 0.01
+		cfg.Epochs = 200
+		cfg.L2 = l2
+		net.Train(X, Y, X, Y, cfg, rng)
+		return net.WeightNorm()
+	}
+
+	plain := weightNorm(0)
+	decayed := weightNorm(0.1)
+	t.Logf("weight norm: L2=0 %.3f, L2=0.1 %.3f", plain, decayed)
+	assert.Less(t, decayed, plain)
+}
+
+func TestTrainNetworkOnData_StandardizationSpeedsConvergence(t *testing.T) {
+	// Real power feature encoding, but with the raw °C temperature as input.
+	samples := generateSyntheticSamples(1000, 42)
+	norm := ComputeNormalization(samples)
+	X := make([][]float64, len(samples))
+	Y := make([][]float64, len(samples))
+	for i, s := range samples {
+		X[i] = EncodeFeatures(s.Month, s.Hour, s.Temperature)
+		Y[i] = []float64{(s.Power - norm.PowerMean) / norm.PowerStd}
+	}
+
+	lossAt50 := func(standardize bool) (float64, *Network) {
+		cfg := DefaultTrainConfig()
+		cfg.Epochs = 50
+		cfg.StandardizeInputs = standardize
+		net, losses := TrainNetworkOnData(X, Y, []int{5, 32, 16, 1}, cfg, rand.New(rand.NewPCG(42, 0)))
+		return losses[len(losses)-1], net
+	}
+
+	raw, rawNet := lossAt50(false)
+	std, stdNet := lossAt50(true)
+	t.Logf("val loss after 50 epochs: raw %.4f, standardized %.4f", raw, std)
+	assert.Less(t, std, raw)
+	assert.Nil(t, rawNet.InputMean)
+	require.Len(t, stdNet.InputMean, 5)
+
+	// Standardization survives a save/load roundtrip.
+	data, err := json.Marshal(stdNet)
+	require.NoError(t, err)
+	var loaded Network
+	require.NoError(t, json.Unmarshal(data, &loaded))
+	assert.Equal(t, stdNet.Forward(X[0])[0], loaded.Forward(X[0])[0])
+}
@@ -2,6 +2,7 @@ package predictor
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
 	"math/rand/v2"
 )
@@ -24,6 +25,7 @@ type Normalization struct {
 
 // SavedModel is the JSON-serializable model artifact.
 type SavedModel struct {
+	Meta           *ModelMeta     `json:"meta,omitempty"`
 	Network        *Network       `json:"network"`
 	Normalization  Normalization  `json:"normalization"`
 	HourlyNoiseStd [24]float64   `json:"hourly_noise_std"`
@@ -35,6 +37,7 @@ type EnergyPredictor struct {
 	norm  Normalization
 	noise [24]float64
 	rng   *rand.Rand
+	meta  *ModelMeta // nil for models saved without metadata
 }
 
 // EncodeFeatures converts (month, hour, normTemp) to a 5-element cyclical feature vector.
@@ -117,12 +120,14 @@ func TrainPredictor(samples []Sample, cfg TrainConfig, seed uint64) (*EnergyPred
 		actuals[i] = s.Power
 	}
 	hourlyNoise := ComputeResidualNoiseByHour(hours, predictions, actuals)
+	meta := newModelMeta(PowerFeatures, len(samples), losses, cfg)
 
 	return &EnergyPredictor{
 		net:   net,
 		norm:  norm,
 		noise: hourlyNoise,
 		rng:   rng,
+		meta:  &meta,
 	}, losses
 }
 
@@ -131,6 +136,11 @@ func (p *EnergyPredictor) Norm() Normalization {
 	return p.norm
 }
 
+// Meta returns the training metadata, or nil for models saved without it.
+func (p *EnergyPredictor) Meta() *ModelMeta {
+	return p.meta
+}
+
 // Predict returns a power prediction in watts with realistic noise.
 func (p *EnergyPredictor) Predict(month, hour int, tempC float64) float64 {
 	clean := p.PredictClean(month, hour, tempC)
@@ -149,6 +159,7 @@ func (p *EnergyPredictor) PredictClean(month, hour int, tempC float64) float64 {
 // Save serializes the model to JSON.
 func (p *EnergyPredictor) Save() ([]byte, error) {
 	m := SavedModel{
+		Meta:           p.meta,
 		Network:        p.net,
 		Normalization:  p.norm,
 		HourlyNoiseStd: p.noise,
@@ -156,17 +167,22 @@ func (p *EnergyPredictor) Save() ([]byte, error) {
 	return json.MarshalIndent(m, "", "  ")
 }
 
-// LoadPredictor deserializes a model from JSON.
+// LoadPredictor deserializes a model from JSON. It returns an error if the
+// model's metadata reports an incompatible schema version or feature set.
 func LoadPredictor(data []byte, seed uint64) (*EnergyPredictor, error) {
 	var m SavedModel
 	if err := json.Unmarshal(data, &m); err != nil {
 		return nil, err
 	}
+	if err := validateMeta(m.Meta, PowerFeatures); err != nil {
+		return nil, fmt.Errorf("loading power model: %w", err)
+	}
 	return &EnergyPredictor{
 		net:   m.Network,
 		norm:  m.Normalization,
 		noise: m.HourlyNoiseStd,
 		rng:   rand.New(rand.NewPCG(seed, 0)),
+		meta:  m.Meta,
 	}, nil
 }
 
@@ -206,6 +222,9 @@ func ShuffleAndSplit(X, Y [][]float64, rng *rand.Rand) (trainX, trainY, valX, va
 func TrainNetworkOnData(X, Y [][]float64, sizes []int, cfg TrainConfig, rng *rand.Rand) (*Network, []float64) {
 	trainX, trainY, valX, valY := ShuffleAndSplit(X, Y, rng)
 	net := NewNetwork(sizes, rng)
+	if cfg.StandardizeInputs {
+		net.InputMean, net.InputStd = ComputeInputStandardization(trainX)
+	}
 	losses := net.Train(trainX, trainY, valX, valY, cfg, rng)
 	return net, losses
 }
@@ -104,6 +104,49 @@ func TestTrainPredictor_ConvergesOnSyntheticData(t *testing.T) {
 	assert.Less(t, rmse, 50.0, "RMSE should be < 50W, got %.1fW", rmse)
 }
 
+func TestTrainPredictor_PinballQuantile(t *testing.T) {
+	// Right-skewed load: a base curve plus exponential spikes.
+	rng := rand.New(rand.NewPCG(7, 0))
+	samples := make([]Sample, 1500)
+	for i := range samples {
+		hour := rng.IntN(24)
+		temp := -5.0 + 30.0*rng.Float64()
+		samples[i] = Sample{
+			Month:       rng.IntN(12) + 1,
+			Hour:        hour,
+			Temperature: temp,
+			Power:       800 - 10*temp + rng.ExpFloat64()*400,
+		}
+	}
+
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 60
+	cfg.LearningRate = 0.005
+	cfg.Loss = LossPinball
+
+	cfg.Quantile = 0.5
+	median, _ := TrainPredictor(samples, cfg, 42)
+	cfg.Quantile = 0.9
+	upper, _ := TrainPredictor(samples, cfg, 42)
+
+	var above int
+	var medianSum, upperSum float64
+	for _, s := range samples {
+		m := median.PredictClean(s.Month, s.Hour, s.Temperature)
+		u := upper.PredictClean(s.Month, s.Hour, s.Temperature)
+		medianSum += m
+		upperSum += u
+		if u > m {
+			above++
+		}
+	}
+	n := float64(len(samples))
+	t.Logf("mean prediction: q0.5 %.0f W, q0.9 %.0f W", medianSum/n, upperSum/n)
+	assert.Greater(t, upperSum/n, medianSum/n+300, "q0.9 should sit well above the median")
+	assert.Greater(t, float64(above)/n, 0.95)
+	assert.Equal(t, 0.9, upper.Meta().Quantile)
+}
+
 func generateSyntheticSamples(n int, seed uint64) []Sample {
 	rng := rand.New(rand.NewPCG(seed, 0))
 	samples := make([]Sample, n)
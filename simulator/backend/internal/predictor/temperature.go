@@ -2,6 +2,7 @@ package predictor
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
 	"math/rand/v2"
 )
@@ -21,6 +22,7 @@ type TempNormalization struct {
 
 // TempSavedModel is the JSON-serializable temperature model artifact.
 type TempSavedModel struct {
+	Meta           *ModelMeta        `json:"meta,omitempty"`
 	Network        *Network          `json:"network"`
 	Normalization  TempNormalization `json:"normalization"`
 	HourlyNoiseStd [24]float64      `json:"hourly_noise_std"`
@@ -32,6 +34,7 @@ type TemperaturePredictor struct {
 	norm  TempNormalization
 	noise [24]float64
 	rng   *rand.Rand
+	meta  *ModelMeta // nil for models saved without metadata
 }
 
 // EncodeTempFeatures converts (dayOfYear, hour, anomaly) to a 5-element feature vector.
@@ -121,12 +124,14 @@ func TrainTemperaturePredictor(samples []TempSample, cfg TrainConfig, seed uint6
 		actuals[i] = s.Temp
 	}
 	hourlyNoise := ComputeResidualNoiseByHour(hours, predictions, actuals)
+	meta := newModelMeta(TempFeatures, len(samples), losses, cfg)
 
 	return &TemperaturePredictor{
 		net:   net,
 		norm:  norm,
 		noise: hourlyNoise,
 		rng:   rng,
+		meta:  &meta,
 	}, losses
 }
 
@@ -135,6 +140,11 @@ func (p *TemperaturePredictor) Norm() TempNormalization {
 	return p.norm
 }
 
+// Meta returns the training metadata, or nil for models saved without it.
+func (p *TemperaturePredictor) Meta() *ModelMeta {
+	return p.meta
+}
+
 // Predict returns a temperature prediction in °C with realistic noise.
 func (p *TemperaturePredictor) Predict(dayOfYear, hour int, anomaly float64) float64 {
 	clean := p.PredictClean(dayOfYear, hour, anomaly)
@@ -152,6 +162,7 @@ func (p *TemperaturePredictor) PredictClean(dayOfYear, hour int, anomaly float64
 // Save serializes the temperature model to JSON.
 func (p *TemperaturePredictor) Save() ([]byte, error) {
 	m := TempSavedModel{
+		Meta:           p.meta,
 		Network:        p.net,
 		Normalization:  p.norm,
 		HourlyNoiseStd: p.noise,
@@ -159,17 +170,23 @@ func (p *TemperaturePredictor) Save() ([]byte, error) {
 	return json.MarshalIndent(m, "", "  ")
 }
 
-// LoadTemperaturePredictor deserializes a temperature model from JSON.
+// LoadTemperaturePredictor deserializes a temperature model from JSON. It
+// returns an error if the model's metadata reports an incompatible schema
+// version or feature set.
 func LoadTemperaturePredictor(data []byte, seed uint64) (*TemperaturePredictor, error) {
 	var m TempSavedModel
 	if err := json.Unmarshal(data, &m); err != nil {
 		return nil, err
 	}
+	if err := validateMeta(m.Meta, TempFeatures); err != nil {
+		return nil, fmt.Errorf("loading temperature model: %w", err)
+	}
 	return &TemperaturePredictor{
 		net:   m.Network,
 		norm:  m.Normalization,
 		noise: m.HourlyNoiseStd,
 		rng:   rand.New(rand.NewPCG(seed, 0)),
+		meta:  m.Meta,
 	}, nil
 }
 
@@ -0,0 +1,67 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// auditHeader names the columns of the interval audit CSV.
+var auditHeader = []string{
+	"timestamp", "raw_power_w", "adjusted_power_w", "price_pln_kwh",
+	"import_wh", "export_wh", "cost_pln", "battery_power_w", "soc_pct",
+}
+
+// auditInterval carries the battery-side values of the grid reading being
+// integrated, so updateEnergy can write them alongside the billed energy.
+type auditInterval struct {
+	rawW     float64
+	batteryW float64
+	socPct   float64
+}
+
+// SetAuditWriter enables interval auditing: during replay one CSV row per
+// grid interval is written to w with the raw and battery-adjusted power, the
+// spot price, imported and exported Wh and the interval's net cost. The
+// cost_pln column is rounded to grosze so that it sums to the (rounded)
+// Summary.NetCostPLN. A nil w disables auditing.
+// Write errors are not reported; auditing is a debug aid.
+func (e *Engine) SetAuditWriter(w io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if w == nil {
+		e.audit = nil
+		return
+	}
+	e.audit = csv.NewWriter(w)
+	e.auditCost = MoneyRounder{}
+	e.audit.Write(auditHeader)
+	e.audit.Flush()
+}
+
+// setAuditInterval records the battery-side values for the next grid
+// interval. No-op when auditing is disabled.
+func (e *Engine) setAuditInterval(rawW, batteryW, socPct float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.audit != nil {
+		e.auditPending = auditInterval{rawW: rawW, batteryW: batteryW, socPct: socPct}
+	}
+}
+
+// writeAuditRow writes one grid interval. Must be called with mu held.
+func (e *Engine) writeAuditRow(t time.Time, adjustedW, price, importWh, exportWh, costPLN float64) {
+	if e.audit == nil {
+		return
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	p := e.auditPending
+	e.audit.Write([]string{
+		t.Format(time.RFC3339),
+		f(p.rawW), f(adjustedW), f(price),
+		f(importWh), f(exportWh), f(e.auditCost.Add(costPLN)),
+		f(p.batteryW), f(p.socPct),
+	})
+	e.audit.Flush()
+}
@@ -0,0 +1,82 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+func TestEngine_AuditCostSumsToNetCost(t *testing.T) {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	grid := []float64{-2000, -1500, 500, 1500, 3000, 800}
+	prices := []float64{0.20, 0.10, 0.60, 0.90, 1.10, 0.40}
+	for h, w := range grid {
+		ts := startTime.Add(time.Duration(h) * hour)
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: w, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: prices[h], Unit: "PLN/kWh"},
+		})
+	}
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	e.SetBattery(&BatteryConfig{
+		CapacityKWh:        2,
+		MaxPowerW:          1000,
+		DischargeToPercent: 0,
+		ChargeToPercent:    100,
+	})
+	var buf bytes.Buffer
+	e.SetAuditWriter(&buf)
+	e.Step(6 * hour)
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, len(grid)) // header + one row per interval
+	assert.Equal(t, auditHeader, rows[0])
+
+	var costSum, importWh, exportWh float64
+	sawBattery := false
+	for _, row := range rows[1:] {
+		cost, err := strconv.ParseFloat(row[6], 64)
+		require.NoError(t, err)
+		costSum += cost
+		imp, _ := strconv.ParseFloat(row[4], 64)
+		exp, _ := strconv.ParseFloat(row[5], 64)
+		importWh += imp
+		exportWh += exp
+		if row[7] != "0" {
+			sawBattery = true
+		}
+	}
+
+	sum := cb.lastSummary()
+	assert.InDelta(t, sum.NetCostPLN, costSum, 1e-9)
+	assert.InDelta(t, sum.GridImportKWh, importWh/1000, 1e-9)
+	assert.InDelta(t, sum.GridExportKWh, exportWh/1000, 1e-9)
+	assert.True(t, sawBattery, "battery power column should be populated")
+	assert.Equal(t, startTime.Add(hour).Format(time.RFC3339), rows[1][0])
+	assert.Equal(t, "-1500", rows[1][1], "raw power is the unadjusted reading")
+}
+
+func TestEngine_AuditDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	e := New(makeStoreWithPrices([]float64{1000, 1000, 1000}, 0.5), &mockCallback{})
+	e.Init()
+	e.SetAuditWriter(&buf)
+	e.SetAuditWriter(nil)
+	e.Step(3 * hour)
+	assert.Equal(t, "timestamp,raw_power_w,adjusted_power_w,price_pln_kwh,import_wh,export_wh,cost_pln,battery_power_w,soc_pct\n", buf.String())
+}
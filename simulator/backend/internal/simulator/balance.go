@@ -0,0 +1,71 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	// balanceToleranceKWh absorbs float accumulation error in the checks.
+	balanceToleranceKWh = 0.001
+	// balanceTolerancePLN is one grosz.
+	balanceTolerancePLN = 0.01
+)
+
+// CheckBalance cross-checks the parallel energy accumulators and returns an
+// error listing every invariant that drifted beyond tolerance, or nil:
+//
+//   - the battery-adjusted grid differs from the raw grid by exactly what the
+//     battery discharged net, plus reclaimed curtailment, minus inverter
+//     standby. The grid integrates battery power across each interval while
+//     the battery applies the power it settled on at the interval end, so
+//     the per-interval difference (trackBatteryEdge) is accounted too.
+//   - PV minus the adjusted export equals the reported self-consumption,
+//     which is clamped at zero, so export never exceeds PV.
+//   - net-metering credits used or banked never exceed the raw export.
+//   - the net-billing deposit equals the export value minus what was drawn.
+//
+// It is meant for tests and debugging (battery-compare -check-balance), at the
+// end of a run started from the beginning of the time range.
+func (e *Engine) CheckBalance() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	rawNetKWh := (e.rawGridImportWh - e.rawGridExportWh) / 1000
+	adjNetKWh := (e.gridImportWh - e.gridExportWh) / 1000
+
+	var shiftKWh float64
+	if b := e.battery; b != nil {
+		standbyKWh := b.config.InverterStandbyW * e.gridHours / 1000
+		shiftKWh = (b.NetDischargeWh+b.ReclaimedWh+e.batteryEdgeWh)/1000 - standbyKWh
+	}
+	if d := (rawNetKWh - adjNetKWh) - shiftKWh; math.Abs(d) > balanceToleranceKWh {
+		errs = append(errs, fmt.Errorf("grid: raw net %.3f kWh − adjusted net %.3f kWh should equal battery shift %.3f kWh, off by %.3f kWh",
+			rawNetKWh, adjNetKWh, shiftKWh, d))
+	}
+
+	if e.pvWh > 0 {
+		pvKWh, exportKWh := e.pvWh/1000, e.gridExportWh/1000
+		selfKWh := e.buildSummary().SelfConsumptionKWh
+		// The summary rounds kWh to kwhDecimals.
+		tol := balanceToleranceKWh + 0.5*math.Pow10(-e.kwhDecimals)
+		if d := (pvKWh - exportKWh) - selfKWh; math.Abs(d) > tol {
+			errs = append(errs, fmt.Errorf("pv: PV %.3f kWh − export %.3f kWh should equal self-consumption %.3f kWh, off by %.3f kWh",
+				pvKWh, exportKWh, selfKWh, d))
+		}
+	}
+
+	nmCreditsKWh := e.nmCreditUsedKWh + e.nmCreditBankKWh
+	if rawExportKWh := e.rawGridExportWh / 1000; nmCreditsKWh-rawExportKWh > balanceToleranceKWh {
+		errs = append(errs, fmt.Errorf("net metering: credits used+banked %.3f kWh exceed export %.3f kWh", nmCreditsKWh, rawExportKWh))
+	}
+
+	if d := e.nbDepositPLN - (e.nbExportValuedPLN - e.nbDepositUsedPLN); math.Abs(d) > balanceTolerancePLN {
+		errs = append(errs, fmt.Errorf("net billing: deposit %.2f PLN should equal export value %.2f − used %.2f PLN, off by %.2f PLN",
+			e.nbDepositPLN, e.nbExportValuedPLN, e.nbDepositUsedPLN, d))
+	}
+
+	return errors.Join(errs...)
+}
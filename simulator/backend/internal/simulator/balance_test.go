@@ -0,0 +1,115 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// balanceStore holds a week of 15-minute data: a PV bell around noon, a
+// steady house load with an evening peak, and a daily price wave. Grid power
+// is load minus PV.
+func balanceStore() *store.Store {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for i := 0; i <= 7*96; i++ {
+		ts := base.Add(time.Duration(i) * 15 * time.Minute)
+		h := float64(ts.Hour()) + float64(ts.Minute())/60
+		pv := max(0, 4000*math.Sin((h-6)/12*math.Pi))
+		load := 400.0
+		if h >= 17 && h < 22 {
+			load = 2500
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: load - pv},
+			model.Reading{Timestamp: ts, SensorID: "sensor.pv", Type: model.SensorPVPower, Value: pv},
+			model.Reading{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: 0.6 + 0.4*math.Sin(h/24*2*math.Pi)},
+		)
+	}
+	s.AddReadings(readings)
+	return s
+}
+
+func TestEngine_CheckBalance(t *testing.T) {
+	e := New(balanceStore(), &mockCallback{})
+	require.True(t, e.Init())
+	e.SetPriceSensor("sensor.price")
+	e.SetBattery(&BatteryConfig{
+		CapacityKWh:      10,
+		MaxPowerW:        5000,
+		ChargeToPercent:  100,
+		InverterStandbyW: 20,
+	})
+	for e.State().Time.Before(e.TimeRange().End) {
+		e.Step(time.Hour)
+	}
+
+	s := e.CurrentSummary()
+	require.Greater(t, s.BatterySavingsKWh, 10.0, "battery must actually shift energy")
+	require.Greater(t, s.NMCreditBankKWh, 0.0)
+	assert.NoError(t, e.CheckBalance())
+
+	// A drifting accumulator is reported.
+	e.mu.Lock()
+	e.gridImportWh += 5000
+	e.nbDepositPLN += 1
+	e.mu.Unlock()
+	err := e.CheckBalance()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "grid:")
+	assert.Contains(t, err.Error(), "net billing:")
+	assert.NotContains(t, err.Error(), "net metering:")
+}
+
+func TestEngine_CheckBalanceDataGap(t *testing.T) {
+	// Drop six hours on the second day: the gap must not widen the tolerance.
+	full := balanceStore()
+	gapStart := time.Date(2024, 6, 2, 9, 0, 0, 0, time.UTC)
+	gapEnd := gapStart.Add(6 * time.Hour)
+	s := store.New()
+	for _, sensor := range full.Sensors() {
+		s.AddSensor(sensor)
+		tr, _ := full.GlobalTimeRange()
+		var kept []model.Reading
+		for _, r := range full.ReadingsInRange(sensor.ID, tr.Start, tr.End.Add(time.Second)) {
+			if r.Timestamp.Before(gapStart) || !r.Timestamp.Before(gapEnd) {
+				kept = append(kept, r)
+			}
+		}
+		s.AddReadings(kept)
+	}
+
+	e := New(s, &mockCallback{})
+	require.True(t, e.Init())
+	e.SetPriceSensor("sensor.price")
+	e.SetBattery(&BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100})
+	for e.State().Time.Before(e.TimeRange().End) {
+		e.Step(time.Hour)
+	}
+	require.NoError(t, e.CheckBalance())
+
+	e.mu.Lock()
+	e.gridImportWh += 50
+	e.mu.Unlock()
+	err := e.CheckBalance()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "grid:")
+
+	// Exporting more than PV produced leaves no self-consumption to match.
+	e.mu.Lock()
+	e.gridExportWh = e.pvWh + 1000
+	e.mu.Unlock()
+	err = e.CheckBalance()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pv:")
+}
@@ -1,19 +1,92 @@
 package simulator
 
 import (
+	"fmt"
 	"math"
 	"time"
 )
 
+// ChargePriority decides which source fills the battery when an interval has
+// both PV surplus and a cheap grid price.
+type ChargePriority string
+
+const (
+	// ChargePriorityPriceFirst charges at max power in cheap hours, topping
+	// up PV surplus with grid energy. This is the default.
+	ChargePriorityPriceFirst ChargePriority = "price-first"
+	// ChargePriorityPVFirst charges only from PV surplus while there is any,
+	// leaving grid charging to cheap hours without surplus. Negative prices
+	// still charge at max power, since import is then paid.
+	ChargePriorityPVFirst ChargePriority = "pv-first"
+)
+
+// ParseChargePriority parses "price-first" or "pv-first"; "" is
+// ChargePriorityPriceFirst.
+func ParseChargePriority(s string) (ChargePriority, error) {
+	switch p := ChargePriority(s); p {
+	case "":
+		return ChargePriorityPriceFirst, nil
+	case ChargePriorityPriceFirst, ChargePriorityPVFirst:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown charge priority %q (want price-first or pv-first)", s)
+}
+
 // BatteryConfig holds the user-configurable parameters.
 type BatteryConfig struct {
 	CapacityKWh        float64 `json:"capacity_kwh"`
 	MaxPowerW          float64 `json:"max_power_w"`
+	MaxChargeW         float64 `json:"max_charge_w"`    // overrides MaxPowerW when charging, 0 = use MaxPowerW
+	MaxDischargeW      float64 `json:"max_discharge_w"` // overrides MaxPowerW when discharging, 0 = use MaxPowerW
 	DischargeToPercent float64 `json:"discharge_to_percent"`
 	ChargeToPercent    float64 `json:"charge_to_percent"`
-	DegradationCycles  float64 `json:"degradation_cycles"` // cycles to 80% capacity, 0 = disabled
+	DegradationCycles  float64 `json:"degradation_cycles"`  // cycles to 80% capacity, 0 = disabled
+	MinDwellMinutes    float64 `json:"min_dwell_minutes"`   // arbitrage: minimum time before reversing direction, 0 = disabled
+	InitialSoCPercent  float64 `json:"initial_soc_percent"` // SoC at start and after Reset, 0 = DischargeToPercent
+	// CalendarFadePctPerYear is capacity lost per year of simulated time,
+	// added to cycle fade. 0 = disabled.
+	CalendarFadePctPerYear float64 `json:"calendar_fade_pct_per_year"`
+	// RoundTripEfficiencyPct and CycleCostPLN (wear cost per full cycle)
+	// feed the arbitrage break-even spread; the SoC model itself is lossless.
+	// 0 = 100% efficient / no wear cost.
+	RoundTripEfficiencyPct float64 `json:"round_trip_efficiency_pct"`
+	CycleCostPLN           float64 `json:"cycle_cost_pln"`
+	// SelfDischargePctPerDay is the share of the stored charge lost per day,
+	// drained from the SoC every interval (never below the discharge floor).
+	// Arbitrage also skips charging when the spread to the expensive price no
+	// longer covers the losses over the expected idle time. 0 = disabled.
+	SelfDischargePctPerDay float64 `json:"self_discharge_pct_per_day"`
+	// CurtailmentVoltageV forces max charging while exporting at or above
+	// this grid voltage, absorbing PV the inverter would curtail. 0 = disabled.
+	CurtailmentVoltageV float64 `json:"curtailment_voltage_v"`
+	// ExportLimitW is the grid connection's feed-in cap. Arbitrage discharge
+	// that would push net export above it is not performed; discharge
+	// offsetting load is unaffected. 0 = unlimited.
+	ExportLimitW float64 `json:"export_limit_w"`
+	// ChargePriority applies to the arbitrage and hybrid strategies; "" =
+	// ChargePriorityPriceFirst.
+	ChargePriority ChargePriority `json:"charge_priority"`
+	// MaxDailyCycles caps equivalent full cycles per calendar day; once the
+	// day's throughput reaches it the battery idles until midnight.
+	// 0 = unlimited.
+	MaxDailyCycles float64 `json:"max_daily_cycles"`
+	// InverterStandbyW is the inverter/BMS idle draw, added to grid import
+	// for every interval the battery is installed. 0 = none.
+	InverterStandbyW float64 `json:"inverter_standby_w"`
+	// ChargeTaperStartPct is the SoC above which charge acceptance drops
+	// (CV phase): max charge power derates linearly from full at this SoC
+	// to chargeTaperMinFraction of it at 100%. 0 = disabled.
+	ChargeTaperStartPct float64 `json:"charge_taper_start_pct"`
+	// GridImportLimitW is the main fuse: battery charging that would push
+	// grid import above it is clamped, in every strategy. Household load
+	// alone is never curtailed. 0 = unlimited.
+	GridImportLimitW float64 `json:"grid_import_limit_w"`
 }
 
+// chargeTaperMinFraction is the share of max charge power a tapering battery
+// still accepts at 100% SoC, so it can top off.
+const chargeTaperMinFraction = 0.1
+
 // ProcessResult is returned by Battery.Process for each reading.
 type ProcessResult struct {
 	BatteryPowerW float64 // positive = discharging, negative = charging
@@ -27,9 +100,17 @@ type BatterySummary struct {
 	Cycles               float64                    `json:"cycles"`
 	EffectiveCapacityKWh float64                    `json:"effective_capacity_kwh"`
 	DegradationPct       float64                    `json:"degradation_pct"`
+	ReclaimedKWh         float64                    `json:"reclaimed_kwh"`
 	TimeAtPowerSec       map[int]float64            `json:"time_at_power_sec"`
 	TimeAtSoCPctSec      map[int]float64            `json:"time_at_soc_pct_sec"`
 	MonthSoCSeconds      map[string]map[int]float64 `json:"month_soc_seconds"`
+	// Arbitrage battery energy per 10 gr price band, keyed by band start in
+	// grosze (e.g. 30 = 0.30–0.40 PLN/kWh)
+	ArbChargeKWhByPrice    map[int]float64 `json:"arb_charge_kwh_by_price,omitempty"`
+	ArbDischargeKWhByPrice map[int]float64 `json:"arb_discharge_kwh_by_price,omitempty"`
+	// ImportLimitedIntervals counts intervals whose charging was clamped by
+	// GridImportLimitW, i.e. that would have tripped the main fuse.
+	ImportLimitedIntervals int `json:"import_limited_intervals,omitempty"`
 }
 
 // Battery simulates a home battery storage system.
@@ -40,41 +121,122 @@ type Battery struct {
 	SoCWh      float64
 	PowerW     float64
 	LastTime   time.Time
-	LastDemand float64 // previous reading's demand, used for backward-looking intervals
+	LastDemand float64   // previous reading's demand, used for backward-looking intervals
+	StartTime  time.Time // first processed reading, for calendar aging
+
+	// Curtailment-aware charging
+	GridVoltageV float64 // latest grid voltage reading
+	LastVoltageV float64 // grid voltage at LastTime, used like LastDemand
+
+	// Arbitrage direction tracking for MinDwellMinutes
+	LastDirection  int       // -1 = charging, 1 = discharging, 0 = never moved
+	LastSwitchTime time.Time // when LastDirection was entered
+
+	// Arbitrage idle time, for the SelfDischargePctPerDay charge check
+	LastChargeTime time.Time // end of the last charging interval
+	ExpectedIdleH  float64   // last charge → discharge gap, at most maxExpectedIdleH
+
+	// Daily cycle cap tracking (MaxDailyCycles)
+	DayStart        time.Time // calendar day DayThroughputWh belongs to
+	DayThroughputWh float64
 
 	// Stats
 	TotalThroughputWh float64
+	NetDischargeWh    float64                    // discharged minus charged at the terminals
+	SelfDischargedWh  float64                    // lost to SelfDischargePctPerDay
+	ReclaimedWh       float64                    // charge beyond recorded export while curtailing
+	ImportLimited     int                        // intervals with charging clamped by GridImportLimitW
 	TimeAtPowerSec    map[int]float64            // 1kW buckets
 	TimeAtSoCPctSec   map[int]float64            // 10% buckets
 	MonthSoCSeconds   map[string]map[int]float64 // "2024-11" → {10: 3600}
+
+	// Energy per price band (Wh), see priceBand. Recorded by ProcessArbitrage.
+	ChargeWhByPrice    map[int]float64
+	DischargeWhByPrice map[int]float64
 }
 
-// NewBattery creates a battery starting at the discharge floor SoC.
+// NewBattery creates a battery starting at InitialSoCPercent, or at the
+// discharge floor when that is unset.
 func NewBattery(cfg BatteryConfig) *Battery {
-	capacityWh := cfg.CapacityKWh * 1000
-	floorWh := capacityWh * cfg.DischargeToPercent / 100
-	return &Battery{
+	b := &Battery{
 		config:          cfg,
-		SoCWh:           floorWh,
 		TimeAtPowerSec:  make(map[int]float64),
 		TimeAtSoCPctSec: make(map[int]float64),
 		MonthSoCSeconds: make(map[string]map[int]float64),
+
+		ChargeWhByPrice:    make(map[int]float64),
+		DischargeWhByPrice: make(map[int]float64),
+	}
+	b.SoCWh = b.initialSoCWh()
+	return b
+}
+
+// initialSoCWh returns the configured starting SoC, clamped to the
+// discharge floor and charge ceiling.
+func (b *Battery) initialSoCWh() float64 {
+	capacityWh := b.config.CapacityKWh * 1000
+	floorWh := capacityWh * b.config.DischargeToPercent / 100
+	if b.config.InitialSoCPercent <= 0 {
+		return floorWh
 	}
+	ceilWh := capacityWh * b.config.ChargeToPercent / 100
+	return math.Max(floorWh, math.Min(ceilWh, capacityWh*b.config.InitialSoCPercent/100))
 }
 
-// EffectiveCapacityKWh returns capacity after degradation fade.
-// Linear fade from 100% to 80% over DegradationCycles full cycles.
+// EffectiveCapacityKWh returns capacity after degradation fade: linear cycle
+// fade from 100% to 80% over DegradationCycles full cycles, plus calendar
+// fade of CalendarFadePctPerYear per simulated year.
 func (b *Battery) EffectiveCapacityKWh() float64 {
-	if b.config.DegradationCycles <= 0 {
-		return b.config.CapacityKWh
+	var fade float64
+	if b.config.DegradationCycles > 0 {
+		fade = math.Min(b.Cycles()/b.config.DegradationCycles*0.2, 0.2)
 	}
-	fade := b.Cycles() / b.config.DegradationCycles * 0.2
-	if fade > 0.2 {
-		fade = 0.2
+	fade += b.AgeYears() * b.config.CalendarFadePctPerYear / 100
+	if fade > 1 {
+		fade = 1
 	}
 	return b.config.CapacityKWh * (1 - fade)
 }
 
+// BreakEvenSpread returns the minimum high−low price spread (PLN/kWh) at which
+// charging at lowPrice and discharging later is profitable: round-trip losses
+// must be bought at lowPrice and each discharged kWh carries its share of
+// the per-cycle wear cost.
+func (c BatteryConfig) BreakEvenSpread(lowPrice float64) float64 {
+	return c.IdleBreakEvenSpread(lowPrice, 0)
+}
+
+// IdleBreakEvenSpread is BreakEvenSpread for energy held idleHours between
+// charge and discharge: the SelfDischargePctPerDay lost meanwhile shrinks
+// what is left to sell, like a lower round-trip efficiency.
+func (c BatteryConfig) IdleBreakEvenSpread(lowPrice, idleHours float64) float64 {
+	eff := 1.0
+	if c.RoundTripEfficiencyPct > 0 {
+		eff = c.RoundTripEfficiencyPct / 100
+	}
+	if c.SelfDischargePctPerDay > 0 && idleHours > 0 {
+		eff *= math.Max(0, 1-c.SelfDischargePctPerDay/100*idleHours/24)
+	}
+	if eff <= 0 {
+		return math.Inf(1)
+	}
+	var wearPerKWh float64
+	if c.CapacityKWh > 0 {
+		wearPerKWh = c.CycleCostPLN / c.CapacityKWh
+	}
+	return lowPrice*(1/eff-1) + wearPerKWh
+}
+
+// AgeYears returns simulated time elapsed since the first processed reading.
+func (b *Battery) AgeYears() float64 {
+	if b.StartTime.IsZero() {
+		return 0
+	}
+	return b.LastTime.Sub(b.StartTime).Hours() / hoursPerYear
+}
+
+const hoursPerYear = 365.25 * 24
+
 // Process handles one grid_power reading using self-consumption strategy.
 // homeDemandW: positive = consuming from grid, negative = exporting to grid.
 //
@@ -82,26 +244,223 @@ func (b *Battery) EffectiveCapacityKWh() float64 {
 // battery action for the interval [LastTime, timestamp]. This ensures that
 // an export reading followed by a consumption reading correctly charges the
 // battery during the export interval.
+//
+// With CurtailmentVoltageV set, an export interval starting at or above that
+// voltage charges at full power instead. Charge beyond the recorded export is
+// assumed to come from PV the inverter would otherwise have curtailed, so it
+// is counted in ReclaimedWh rather than as grid import.
 func (b *Battery) Process(homeDemandW float64, timestamp time.Time) ProcessResult {
 	var desired float64
+	curtailing := false
+	prevTime := b.LastTime
 	if !b.LastTime.IsZero() {
 		desired = b.selfConsumptionDecision(b.LastDemand)
+		if b.curtailing() {
+			curtailing = true
+			desired = b.curtailmentDecision()
+		}
 	}
 	result := b.process(desired, homeDemandW, timestamp)
+	if curtailing {
+		if reclaimedW := -result.BatteryPowerW + b.LastDemand; reclaimedW > 0 {
+			b.ReclaimedWh += reclaimedW * timestamp.Sub(prevTime).Hours()
+			result.AdjustedGridW -= reclaimedW
+		}
+	}
 	b.LastDemand = homeDemandW
+	b.LastVoltageV = b.GridVoltageV
 	return result
 }
 
+// SetGridVoltage records the latest grid voltage for curtailment-aware charging.
+func (b *Battery) SetGridVoltage(v float64) {
+	b.GridVoltageV = v
+}
+
+// curtailing reports whether the interval starting at LastTime was exporting
+// at a voltage where the inverter curtails PV.
+func (b *Battery) curtailing() bool {
+	return b.config.CurtailmentVoltageV > 0 &&
+		b.LastVoltageV >= b.config.CurtailmentVoltageV &&
+		b.LastDemand < 0
+}
+
+// curtailmentDecision charges at max power up to the ceiling.
+func (b *Battery) curtailmentDecision() float64 {
+	capacityWh := b.EffectiveCapacityKWh() * 1000
+	ceilWh := capacityWh * b.config.ChargeToPercent / 100
+	if ceilWh-b.SoCWh <= 0 {
+		return 0
+	}
+	return -b.maxChargeW()
+}
+
 // ProcessArbitrage handles one grid_power reading using price arbitrage strategy.
 // Charges at max power when price <= lowThresh, discharges at max power when
 // price >= highThresh, holds otherwise. Unlike self-consumption, this can import
-// from grid to charge.
+// from grid to charge; with ChargePriorityPVFirst it does not while exporting.
+// With SelfDischargePctPerDay set it also skips unprofitable charging, see
+// idleLossCheck.
 func (b *Battery) ProcessArbitrage(gridPowerW float64, timestamp time.Time, price, lowThresh, highThresh float64) ProcessResult {
 	var desired float64
 	if !b.LastTime.IsZero() {
-		desired = b.arbitrageDecision(price, lowThresh, highThresh)
+		desired = b.applyDwell(b.idleLossCheck(b.arbitrageDecision(price, lowThresh, highThresh), price, highThresh))
+		desired = b.capExport(desired, gridPowerW)
+		if b.config.ChargePriority == ChargePriorityPVFirst && desired < 0 && gridPowerW < 0 && price >= 0 {
+			// PV surplus available: charge from it alone.
+			desired = math.Max(desired, gridPowerW)
+		}
+	}
+	prevTime := b.LastTime
+	result := b.process(desired, gridPowerW, timestamp)
+	if !prevTime.IsZero() {
+		b.recordPriceBand(result.BatteryPowerW*timestamp.Sub(prevTime).Hours(), price)
+		switch {
+		case result.BatteryPowerW < 0:
+			b.LastChargeTime = timestamp
+		case result.BatteryPowerW > 0 && !b.LastChargeTime.IsZero():
+			// First discharge since the last charge: remember the gap.
+			b.ExpectedIdleH = math.Min(prevTime.Sub(b.LastChargeTime).Hours(), maxExpectedIdleH)
+			b.LastChargeTime = time.Time{}
+		}
+	}
+	return result
+}
+
+// maxExpectedIdleH caps the idle time assumed by idleLossCheck. Arbitrage
+// thresholds are per day, so energy bought today is expected to sell within
+// a day; the cap also keeps one long hold from blocking charging for good.
+const maxExpectedIdleH = 24.0
+
+// idleLossCheck drops a charge decision when selling at highThresh would not
+// pay for the energy bought at price, after round-trip losses, wear and
+// self-discharge over the expected idle time (the last observed charge →
+// discharge gap). Negative prices always charge, since import is then paid.
+// Without SelfDischargePctPerDay it passes through.
+func (b *Battery) idleLossCheck(desiredPowerW, price, highThresh float64) float64 {
+	if desiredPowerW >= 0 || b.config.SelfDischargePctPerDay <= 0 || price < 0 {
+		return desiredPowerW
+	}
+	if highThresh-price < b.config.IdleBreakEvenSpread(price, b.ExpectedIdleH) {
+		return 0
+	}
+	return desiredPowerW
+}
+
+// ProcessHybrid handles one grid_power reading combining both strategies.
+// Self-consumption takes priority: the battery offsets import and absorbs PV
+// surplus first. Arbitrage uses what is left — it decides alone when
+// self-consumption is idle, and tops up to max power when it agrees in
+// direction (e.g. charging surplus PV plus cheap grid energy).
+func (b *Battery) ProcessHybrid(gridPowerW float64, timestamp time.Time, price, lowThresh, highThresh float64) ProcessResult {
+	var desired float64
+	if !b.LastTime.IsZero() {
+		sc := b.selfConsumptionDecision(b.LastDemand)
+		desired = b.hybridDecision(b.LastDemand, price, lowThresh, highThresh)
+		if desired > sc {
+			desired = math.Max(sc, b.capExport(desired, gridPowerW))
+		}
+	}
+	result := b.process(desired, gridPowerW, timestamp)
+	b.LastDemand = gridPowerW
+	return result
+}
+
+// hybridDecision returns the self-consumption decision, widened or replaced
+// by the arbitrage decision where that does not work against it. At negative
+// prices arbitrage (charging) always wins.
+func (b *Battery) hybridDecision(intervalDemand, price, lowThresh, highThresh float64) float64 {
+	sc := b.selfConsumptionDecision(intervalDemand)
+	arb := b.arbitrageDecision(price, lowThresh, highThresh)
+	if sc == 0 || price < 0 {
+		// Discharging to cover demand at a negative price gives up paid import.
+		return b.applyDwell(arb)
+	}
+	if sc < 0 && b.config.ChargePriority == ChargePriorityPVFirst {
+		// PV surplus available: charge from it alone, no grid top-up.
+		return sc
+	}
+	if (sc > 0 && arb > sc) || (sc < 0 && arb < sc) {
+		return b.applyDwell(arb)
+	}
+	return sc
+}
+
+// capExport limits discharge so that net export (gridPowerW − discharge) stays
+// within ExportLimitW. Charging and an unset limit pass through.
+func (b *Battery) capExport(desiredPowerW, gridPowerW float64) float64 {
+	if b.config.ExportLimitW <= 0 || desiredPowerW <= 0 {
+		return desiredPowerW
+	}
+	return math.Max(0, math.Min(desiredPowerW, gridPowerW+b.config.ExportLimitW))
+}
+
+// capImport limits charging so that grid import (gridPowerW + charge) stays
+// within GridImportLimitW. Discharge and an unset limit pass through.
+func (b *Battery) capImport(desiredPowerW, gridPowerW float64) float64 {
+	if b.config.GridImportLimitW <= 0 || desiredPowerW >= 0 {
+		return desiredPowerW
+	}
+	return math.Min(0, math.Max(desiredPowerW, gridPowerW-b.config.GridImportLimitW))
+}
+
+// applyDwell suppresses a direction reversal until MinDwellMinutes have passed
+// since the current direction started. A suppressed reversal holds (0 W)
+// instead; going idle is always allowed. The decided interval starts at LastTime.
+func (b *Battery) applyDwell(desiredPowerW float64) float64 {
+	direction := 0
+	if desiredPowerW > 0 {
+		direction = 1
+	} else if desiredPowerW < 0 {
+		direction = -1
+	}
+	if direction == 0 || direction == b.LastDirection {
+		return desiredPowerW
+	}
+
+	dwell := time.Duration(b.config.MinDwellMinutes * float64(time.Minute))
+	if b.LastDirection != 0 && dwell > 0 && b.LastTime.Sub(b.LastSwitchTime) < dwell {
+		return 0
+	}
+
+	b.LastDirection = direction
+	b.LastSwitchTime = b.LastTime
+	return desiredPowerW
+}
+
+// maxChargeW returns the charge power limit, falling back to MaxPowerW,
+// derated by the SoC charge taper.
+func (b *Battery) maxChargeW() float64 {
+	limit := b.config.MaxPowerW
+	if b.config.MaxChargeW > 0 {
+		limit = b.config.MaxChargeW
+	}
+	return limit * b.chargeTaper()
+}
+
+// chargeTaper returns the fraction of max charge power accepted at the
+// current SoC: 1 below ChargeTaperStartPct, falling linearly to
+// chargeTaperMinFraction at full.
+func (b *Battery) chargeTaper() float64 {
+	knee := b.config.ChargeTaperStartPct
+	capacityWh := b.EffectiveCapacityKWh() * 1000
+	if knee <= 0 || knee >= 100 || capacityWh <= 0 {
+		return 1
+	}
+	socPct := b.SoCWh / capacityWh * 100
+	if socPct <= knee {
+		return 1
+	}
+	over := math.Min((socPct-knee)/(100-knee), 1)
+	return 1 - over*(1-chargeTaperMinFraction)
+}
+
+// maxDischargeW returns the discharge power limit, falling back to MaxPowerW.
+func (b *Battery) maxDischargeW() float64 {
+	if b.config.MaxDischargeW > 0 {
+		return b.config.MaxDischargeW
 	}
-	return b.process(desired, gridPowerW, timestamp)
+	return b.config.MaxPowerW
 }
 
 // selfConsumptionDecision decides battery action based on home demand.
@@ -116,14 +475,14 @@ func (b *Battery) selfConsumptionDecision(intervalDemand float64) float64 {
 		if availableWh <= 0 {
 			return 0
 		}
-		return math.Min(intervalDemand, b.config.MaxPowerW)
+		return math.Min(intervalDemand, b.maxDischargeW())
 	} else if intervalDemand < 0 {
 		excessW := -intervalDemand
 		availableWh := ceilWh - b.SoCWh
 		if availableWh <= 0 {
 			return 0
 		}
-		return -math.Min(excessW, b.config.MaxPowerW)
+		return -math.Min(excessW, b.maxChargeW())
 	}
 	return 0
 }
@@ -135,17 +494,18 @@ func (b *Battery) arbitrageDecision(price, lowThresh, highThresh float64) float6
 	floorWh := capacityWh * b.config.DischargeToPercent / 100
 	ceilWh := capacityWh * b.config.ChargeToPercent / 100
 
-	if price <= lowThresh {
+	// A negative price pays for import, so charge regardless of thresholds.
+	if price < 0 || price <= lowThresh {
 		if ceilWh-b.SoCWh <= 0 {
 			return 0
 		}
-		return -b.config.MaxPowerW // charge
+		return -b.maxChargeW() // charge
 	}
 	if price >= highThresh {
 		if b.SoCWh-floorWh <= 0 {
 			return 0
 		}
-		return b.config.MaxPowerW // discharge
+		return b.maxDischargeW() // discharge
 	}
 	return 0
 }
@@ -170,6 +530,7 @@ func (b *Battery) process(desiredPowerW, gridPowerW float64, timestamp time.Time
 	if b.LastTime.IsZero() {
 		b.PowerW = 0
 		b.LastTime = timestamp
+		b.StartTime = timestamp
 
 		socPct := 0.0
 		if capacityWh > 0 {
@@ -185,10 +546,17 @@ func (b *Battery) process(desiredPowerW, gridPowerW float64, timestamp time.Time
 	dt := timestamp.Sub(b.LastTime).Seconds()
 	hours := dt / 3600
 
-	batteryPowerW := desiredPowerW
+	batteryPowerW := b.capImport(desiredPowerW, gridPowerW)
+	if batteryPowerW != desiredPowerW {
+		b.ImportLimited++
+	}
 
 	// Apply energy constraints based on time delta
 	if dt > 0 {
+		if day := startOfDay(b.LastTime); !day.Equal(b.DayStart) {
+			b.DayStart = day
+			b.DayThroughputWh = 0
+		}
 		energyWh := batteryPowerW * hours
 
 		if batteryPowerW > 0 {
@@ -211,8 +579,24 @@ func (b *Battery) process(desiredPowerW, gridPowerW float64, timestamp time.Time
 			}
 		}
 
+		// Daily cycle cap: use at most what is left of today's throughput
+		if leftWh, capped := b.dailyThroughputLeftWh(); capped && math.Abs(energyWh) > leftWh {
+			energyWh = math.Copysign(leftWh, energyWh)
+			if hours > 0 {
+				batteryPowerW = energyWh / hours
+			}
+		}
+
 		b.SoCWh -= energyWh
+		b.NetDischargeWh += energyWh
 		b.TotalThroughputWh += math.Abs(energyWh)
+		b.DayThroughputWh += math.Abs(energyWh)
+
+		if b.config.SelfDischargePctPerDay > 0 && b.SoCWh > floorWh {
+			leakWh := math.Min(b.SoCWh*b.config.SelfDischargePctPerDay/100*hours/24, b.SoCWh-floorWh)
+			b.SoCWh -= leakWh
+			b.SelfDischargedWh += leakWh
+		}
 	}
 
 	b.PowerW = batteryPowerW
@@ -261,6 +645,46 @@ func (b *Battery) recordStats(dtSec float64) {
 	b.MonthSoCSeconds[month][socBucket] += dtSec
 }
 
+// dailyThroughputLeftWh returns the throughput MaxDailyCycles still allows
+// in the current day. capped is false when there is no limit.
+func (b *Battery) dailyThroughputLeftWh() (leftWh float64, capped bool) {
+	if b.config.MaxDailyCycles <= 0 {
+		return 0, false
+	}
+	limitWh := b.config.MaxDailyCycles * 2 * b.config.CapacityKWh * 1000
+	return math.Max(0, limitWh-b.DayThroughputWh), true
+}
+
+// priceBand returns the 10 gr price band of price, as the band start in grosze.
+func priceBand(price float64) int {
+	// Round to 0.1 gr first so e.g. 0.3 PLN lands in band 30, not 20.
+	return int(math.Floor(math.Round(price*1000)/100)) * 10
+}
+
+// recordPriceBand accumulates an interval's battery energy (Wh, positive =
+// discharged) into the price band histograms.
+func (b *Battery) recordPriceBand(energyWh, price float64) {
+	band := priceBand(price)
+	if energyWh > 0 {
+		b.DischargeWhByPrice[band] += energyWh
+	} else if energyWh < 0 {
+		b.ChargeWhByPrice[band] -= energyWh
+	}
+}
+
+// PriceBandsKWh returns copies of the charged and discharged energy per price
+// band in kWh.
+func (b *Battery) PriceBandsKWh() (charge, discharge map[int]float64) {
+	toKWh := func(m map[int]float64) map[int]float64 {
+		out := make(map[int]float64, len(m))
+		for k, wh := range m {
+			out[k] = wh / 1000
+		}
+		return out
+	}
+	return toKWh(b.ChargeWhByPrice), toKWh(b.DischargeWhByPrice)
+}
+
 // Cycles returns the equivalent full cycle count.
 func (b *Battery) Cycles() float64 {
 	capacityWh := b.config.CapacityKWh * 1000
@@ -287,21 +711,39 @@ func (b *Battery) Summary() BatterySummary {
 		Cycles:               b.Cycles(),
 		EffectiveCapacityKWh: effectiveKWh,
 		DegradationPct:       degradationPct,
+		ReclaimedKWh:         b.ReclaimedWh / 1000,
 		TimeAtPowerSec:       b.TimeAtPowerSec,
 		TimeAtSoCPctSec:      b.TimeAtSoCPctSec,
 		MonthSoCSeconds:      b.MonthSoCSeconds,
+
+		ImportLimitedIntervals: b.ImportLimited,
 	}
 }
 
-// Reset clears state and stats, setting SoC to discharge floor.
+// Reset clears state and stats, restoring the configured initial SoC
+// (the discharge floor when unset).
 func (b *Battery) Reset() {
-	capacityWh := b.config.CapacityKWh * 1000
-	b.SoCWh = capacityWh * b.config.DischargeToPercent / 100
+	b.SoCWh = b.initialSoCWh()
 	b.PowerW = 0
 	b.LastTime = time.Time{}
+	b.StartTime = time.Time{}
 	b.LastDemand = 0
+	b.GridVoltageV = 0
+	b.LastVoltageV = 0
+	b.ReclaimedWh = 0
+	b.ImportLimited = 0
+	b.NetDischargeWh = 0
+	b.LastDirection = 0
+	b.LastSwitchTime = time.Time{}
+	b.LastChargeTime = time.Time{}
+	b.ExpectedIdleH = 0
+	b.SelfDischargedWh = 0
 	b.TotalThroughputWh = 0
+	b.DayStart = time.Time{}
+	b.DayThroughputWh = 0
 	b.TimeAtPowerSec = make(map[int]float64)
 	b.TimeAtSoCPctSec = make(map[int]float64)
 	b.MonthSoCSeconds = make(map[string]map[int]float64)
+	b.ChargeWhByPrice = make(map[int]float64)
+	b.DischargeWhByPrice = make(map[int]float64)
 }
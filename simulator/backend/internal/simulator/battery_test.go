@@ -1,10 +1,12 @@
 package simulator
 
 import (
+	"math"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var defaultBatteryConfig = BatteryConfig{
@@ -165,6 +167,69 @@ func TestBattery_Reset(t *testing.T) {
 	assert.True(t, b.LastTime.IsZero())
 }
 
+func TestBattery_InitialSoC(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.InitialSoCPercent = 50
+	b := NewBattery(cfg)
+	assert.InDelta(t, 5000, b.SoCWh, 0.01)
+
+	// Early dispatch can discharge right away instead of waiting for a charge.
+	b.Process(3000, t0)
+	r := b.Process(3000, t0.Add(time.Hour))
+	assert.InDelta(t, 3000, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, 20, r.SoCPercent, 0.01)
+
+	// Reset returns to the configured start, not the floor.
+	b.Reset()
+	assert.InDelta(t, 5000, b.SoCWh, 0.01)
+	r = b.Process(3000, t0)
+	r = b.Process(3000, t0.Add(time.Hour))
+	assert.InDelta(t, 3000, r.BatteryPowerW, 0.01)
+}
+
+func TestBattery_InitialSoCClamped(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.ChargeToPercent = 90
+	cfg.InitialSoCPercent = 100
+	assert.InDelta(t, 9000, NewBattery(cfg).SoCWh, 0.01)
+
+	cfg.InitialSoCPercent = 5 // below the 10% floor
+	assert.InDelta(t, 1000, NewBattery(cfg).SoCWh, 0.01)
+}
+
+func TestBattery_CurtailmentForcesMaxCharge(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.DischargeToPercent = 0
+	cfg.CurtailmentVoltageV = 253
+	b := NewBattery(cfg)
+
+	b.SetGridVoltage(255)
+	b.Process(-1000, t0)
+	r := b.Process(-1000, t0.Add(time.Hour))
+
+	// Full 5 kW charge, of which 4 kW was PV the inverter would have curtailed.
+	assert.InDelta(t, -5000, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, 0, r.AdjustedGridW, 0.01)
+	assert.InDelta(t, 4000, b.ReclaimedWh, 0.01)
+	assert.InDelta(t, 4, b.Summary().ReclaimedKWh, 0.001)
+
+	b.Reset()
+	assert.Zero(t, b.ReclaimedWh)
+}
+
+func TestBattery_CurtailmentBelowThreshold(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.CurtailmentVoltageV = 253
+	b := NewBattery(cfg)
+
+	b.SetGridVoltage(245)
+	b.Process(-1000, t0)
+	r := b.Process(-1000, t0.Add(time.Hour))
+
+	assert.InDelta(t, -1000, r.BatteryPowerW, 0.01)
+	assert.Zero(t, b.ReclaimedWh)
+}
+
 func TestBattery_Summary(t *testing.T) {
 	b := NewBattery(defaultBatteryConfig)
 	b.SoCWh = 5000
@@ -208,6 +273,201 @@ func TestBattery_ArbitrageDischargesOnHighPrice(t *testing.T) {
 	assert.InDelta(t, -4000, r.AdjustedGridW, 0.01)
 }
 
+func TestBattery_ArbitrageDischargeExportCapped(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.ExportLimitW = 1500
+	b := NewBattery(cfg)
+	b.SoCWh = 8000
+
+	// Low load at a high price: 5 kW discharge would export 4.8 kW, so it is
+	// capped at load + 1.5 kW export.
+	b.ProcessArbitrage(200, t0, 0.90, 0.20, 0.80)
+	r := b.ProcessArbitrage(200, t0.Add(time.Hour), 0.90, 0.20, 0.80)
+	assert.InDelta(t, 1700, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, -1500, r.AdjustedGridW, 0.01)
+	assert.InDelta(t, 8000-1700, b.SoCWh, 0.01)
+
+	// PV already exporting beyond the cap: no arbitrage discharge at all.
+	r = b.ProcessArbitrage(-2000, t0.Add(2*time.Hour), 0.90, 0.20, 0.80)
+	assert.InDelta(t, 0, r.BatteryPowerW, 0.01)
+
+	// Charging is not affected by the export cap (limited only by the
+	// 3.7 kWh left to the ceiling).
+	r = b.ProcessArbitrage(200, t0.Add(3*time.Hour), 0.10, 0.20, 0.80)
+	assert.InDelta(t, -3700, r.BatteryPowerW, 0.01)
+}
+
+func TestBattery_ArbitrageChargeImportCapped(t *testing.T) {
+	cfg := BatteryConfig{CapacityKWh: 30, MaxPowerW: 10000, ChargeToPercent: 100, GridImportLimitW: 11000}
+	b := NewBattery(cfg)
+
+	// Cheap hour with 4 kW of load: 10 kW charging would import 14 kW, so
+	// it is held to the 7 kW left under the 11 kW fuse.
+	b.ProcessArbitrage(4000, t0, 0.10, 0.20, 0.80)
+	r := b.ProcessArbitrage(4000, t0.Add(time.Hour), 0.10, 0.20, 0.80)
+	assert.InDelta(t, -7000, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, 11000, r.AdjustedGridW, 0.01)
+	assert.InDelta(t, 7000, b.SoCWh, 0.01)
+
+	// Load alone above the fuse: no grid charging, the load is not cut.
+	r = b.ProcessArbitrage(12000, t0.Add(2*time.Hour), 0.10, 0.20, 0.80)
+	assert.InDelta(t, 0, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, 12000, r.AdjustedGridW, 0.01)
+
+	// Light load fits full power under the fuse; discharge is unaffected.
+	r = b.ProcessArbitrage(500, t0.Add(3*time.Hour), 0.10, 0.20, 0.80)
+	assert.InDelta(t, -10000, r.BatteryPowerW, 0.01)
+	r = b.ProcessArbitrage(500, t0.Add(4*time.Hour), 0.90, 0.20, 0.80)
+	assert.InDelta(t, 10000, r.BatteryPowerW, 0.01)
+
+	assert.Equal(t, 2, b.Summary().ImportLimitedIntervals)
+
+	// Without a limit the first interval charges at full power.
+	cfg.GridImportLimitW = 0
+	free := NewBattery(cfg)
+	free.ProcessArbitrage(4000, t0, 0.10, 0.20, 0.80)
+	r = free.ProcessArbitrage(4000, t0.Add(time.Hour), 0.10, 0.20, 0.80)
+	assert.InDelta(t, 14000, r.AdjustedGridW, 0.01)
+	assert.Zero(t, free.Summary().ImportLimitedIntervals)
+}
+
+func TestBattery_HybridExportCapKeepsSelfConsumption(t *testing.T) {
+	b := NewBattery(BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 0, ChargeToPercent: 100, ExportLimitW: 500})
+	b.SoCWh = 9000
+
+	// Expensive interval: arbitrage would discharge 5 kW, but only load
+	// (self-consumption) plus 500 W of export is allowed.
+	b.ProcessHybrid(3000, t0, 0.90, 0.30, 0.80)
+	r := b.ProcessHybrid(3000, t0.Add(time.Hour), 0.90, 0.30, 0.80)
+	assert.InDelta(t, 3500, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, -500, r.AdjustedGridW, 0.01)
+
+	// Load fell since the decided interval started: self-consumption still
+	// discharges the full previous demand even though that exceeds the cap.
+	r = b.ProcessHybrid(0, t0.Add(2*time.Hour), 0.90, 0.30, 0.80)
+	assert.InDelta(t, 3000, r.BatteryPowerW, 0.01)
+}
+
+func TestBattery_ChargePriority(t *testing.T) {
+	// 2 kW PV surplus during a cheap hour, battery half full.
+	tests := []struct {
+		priority ChargePriority
+		wantW    float64 // battery power, negative = charging
+		wantGrid float64
+	}{
+		{"", -5000, 3000},                       // default: grid tops up PV
+		{ChargePriorityPriceFirst, -5000, 3000}, // cheap grid energy used at max power
+		{ChargePriorityPVFirst, -2000, 0},       // only the free PV surplus
+	}
+	for _, tt := range tests {
+		t.Run("arbitrage/"+string(tt.priority), func(t *testing.T) {
+			b := NewBattery(BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100, ChargePriority: tt.priority})
+			b.SoCWh = 5000
+			b.ProcessArbitrage(-2000, t0, 0.10, 0.30, 0.80)
+			r := b.ProcessArbitrage(-2000, t0.Add(time.Hour), 0.10, 0.30, 0.80)
+			assert.InDelta(t, tt.wantW, r.BatteryPowerW, 0.01)
+			assert.InDelta(t, tt.wantGrid, r.AdjustedGridW, 0.01)
+		})
+		t.Run("hybrid/"+string(tt.priority), func(t *testing.T) {
+			b := NewBattery(BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100, ChargePriority: tt.priority})
+			b.SoCWh = 5000
+			b.ProcessHybrid(-2000, t0, 0.10, 0.30, 0.80)
+			r := b.ProcessHybrid(-2000, t0.Add(time.Hour), 0.10, 0.30, 0.80)
+			assert.InDelta(t, tt.wantW, r.BatteryPowerW, 0.01)
+			assert.InDelta(t, tt.wantGrid, r.AdjustedGridW, 0.01)
+		})
+	}
+}
+
+func TestBattery_ChargeTaper(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.InitialSoCPercent = 70
+	cfg.ChargeTaperStartPct = 80
+	b := NewBattery(cfg)
+	flat := NewBattery(BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 10, ChargeToPercent: 100, InitialSoCPercent: 70})
+
+	// 5 kW of surplus in 6-minute steps.
+	b.Process(-5000, t0)
+	flat.Process(-5000, t0)
+	var prevSoC, prevPower float64
+	for i := 1; i <= 10; i++ {
+		ts := t0.Add(time.Duration(i) * 6 * time.Minute)
+		socBefore := b.SoCWh / 100
+		r := b.Process(-5000, ts)
+		flat.Process(-5000, ts)
+		charge := -r.BatteryPowerW
+		if socBefore <= 80 {
+			assert.InDelta(t, 5000, charge, 0.01, "full power below the knee (step %d)", i)
+		} else {
+			// Linear: 1 − 0.9 × (SoC − 80) / 20 of max power.
+			assert.InDelta(t, 5000*(1-0.9*(socBefore-80)/20), charge, 0.01, "step %d", i)
+			assert.Less(t, charge, prevPower, "power keeps falling as SoC climbs (step %d)", i)
+		}
+		assert.Greater(t, r.SoCPercent, prevSoC)
+		prevSoC, prevPower = r.SoCPercent, charge
+	}
+	assert.Less(t, b.SoCWh, flat.SoCWh, "taper absorbs less surplus")
+	assert.InDelta(t, 10000, flat.SoCWh, 0.01)
+
+	// Disabled by default.
+	assert.Equal(t, 1.0, NewBattery(defaultBatteryConfig).chargeTaper())
+}
+
+func TestBattery_PVFirstGridChargesWithoutSurplus(t *testing.T) {
+	b := NewBattery(BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100, ChargePriority: ChargePriorityPVFirst})
+	b.SoCWh = 5000
+
+	// Cheap hour with the house importing: no PV to wait for, charge from grid.
+	b.ProcessHybrid(0, t0, 0.10, 0.30, 0.80)
+	r := b.ProcessHybrid(500, t0.Add(time.Hour), 0.10, 0.30, 0.80)
+	assert.InDelta(t, -5000, r.BatteryPowerW, 0.01)
+}
+
+func TestBattery_MaxDailyCycles(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.MaxDailyCycles = 0.4 // 8 kWh of throughput per day
+	b := NewBattery(cfg)
+
+	// Volatile days: two cheap hours, two expensive hours, repeating.
+	day := time.Date(2024, 11, 21, 0, 0, 0, 0, time.UTC)
+	throughputKWh := map[int]float64{}
+	lastActive := map[int]int{}
+	for h := 0; h <= 48; h++ {
+		price := 1.00
+		if h%4 < 2 {
+			price = 0.10
+		}
+		r := b.ProcessArbitrage(500, day.Add(time.Duration(h)*time.Hour), price, 0.20, 0.80)
+		if h == 0 {
+			continue
+		}
+		d := (h - 1) / 24 // day of the interval [h-1, h)
+		throughputKWh[d] += math.Abs(r.BatteryPowerW) / 1000
+		if r.BatteryPowerW != 0 {
+			lastActive[d] = h
+		}
+	}
+
+	assert.InDelta(t, 8, throughputKWh[0], 1e-9, "day 1 capped at 0.4 cycles")
+	assert.InDelta(t, 8, throughputKWh[1], 1e-9, "cap resets and cycling resumes on day 2")
+	// 5 kWh charged in the first hour, the cap cuts discharge to 3 kWh in the second.
+	assert.Equal(t, 2, lastActive[0], "idle for the rest of day 1 after the cap")
+	assert.Equal(t, 26, lastActive[1])
+
+	// Unlimited by default
+	b = NewBattery(defaultBatteryConfig)
+	var total float64
+	for h := 0; h <= 24; h++ {
+		price := 1.00
+		if h%4 < 2 {
+			price = 0.10
+		}
+		r := b.ProcessArbitrage(500, day.Add(time.Duration(h)*time.Hour), price, 0.20, 0.80)
+		total += math.Abs(r.BatteryPowerW) / 1000
+	}
+	assert.Greater(t, total, 10.0)
+}
+
 func TestBattery_ArbitrageHoldsInMiddle(t *testing.T) {
 	b := NewBattery(defaultBatteryConfig)
 	b.SoCWh = 5000
@@ -220,6 +480,27 @@ func TestBattery_ArbitrageHoldsInMiddle(t *testing.T) {
 	assert.InDelta(t, 50, r.SoCPercent, 0.01)
 }
 
+func TestBattery_ArbitrageChargesOnNegativePrice(t *testing.T) {
+	b := NewBattery(defaultBatteryConfig)
+	b.SoCWh = 5000
+
+	// Whole day negative: -0.10 is at the day's P67, but import still pays.
+	b.ProcessArbitrage(1000, t0, -0.10, -0.50, -0.10)
+	r := b.ProcessArbitrage(1000, t0.Add(time.Hour), -0.10, -0.50, -0.10)
+	assert.InDelta(t, -5000, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, 6000, r.AdjustedGridW, 0.01)
+}
+
+func TestBattery_HybridChargesOnNegativePrice(t *testing.T) {
+	b := NewBattery(defaultBatteryConfig)
+	b.SoCWh = 5000
+
+	// Home demand would normally be covered from the battery.
+	b.ProcessHybrid(2000, t0, -0.05, 0.20, 0.80)
+	r := b.ProcessHybrid(2000, t0.Add(time.Hour), -0.05, 0.20, 0.80)
+	assert.InDelta(t, -5000, r.BatteryPowerW, 0.01)
+}
+
 func TestBattery_ArbitrageChargesFromGrid(t *testing.T) {
 	b := NewBattery(defaultBatteryConfig)
 
@@ -298,6 +579,35 @@ func TestBattery_DegradationInSummary(t *testing.T) {
 	assert.InDelta(t, 5.0, s.DegradationPct, 0.1)
 }
 
+func TestBattery_CalendarFadeWhileIdle(t *testing.T) {
+	cfg := BatteryConfig{
+		CapacityKWh:            10,
+		MaxPowerW:              5000,
+		DischargeToPercent:     0,
+		ChargeToPercent:        100,
+		DegradationCycles:      4000,
+		CalendarFadePctPerYear: 2,
+	}
+	b := NewBattery(cfg)
+
+	// Idle for five simulated years: no cycles, only calendar fade.
+	b.Process(0, t0)
+	b.Process(0, t0.Add(5*365*24*time.Hour+30*time.Hour))
+	assert.InDelta(t, 5, b.AgeYears(), 1e-9)
+	assert.Zero(t, b.Cycles())
+
+	s := b.Summary()
+	assert.InDelta(t, 9.0, s.EffectiveCapacityKWh, 1e-9)
+	assert.InDelta(t, 10.0, s.DegradationPct, 1e-9)
+
+	// Cycle fade adds on top: 1000 cycles → +5%
+	b.TotalThroughputWh = 2 * 1000 * 10000
+	assert.InDelta(t, 8.5, b.EffectiveCapacityKWh(), 1e-9)
+
+	b.Reset()
+	assert.InDelta(t, 10.0, b.EffectiveCapacityKWh(), 1e-9)
+}
+
 func TestBattery_DegradationAffectsChargeCeiling(t *testing.T) {
 	cfg := BatteryConfig{
 		CapacityKWh:        10,
@@ -322,6 +632,31 @@ func TestBattery_DegradationAffectsChargeCeiling(t *testing.T) {
 	assert.InDelta(t, 100, r.SoCPercent, 0.1)
 }
 
+func TestBattery_HybridSelfConsumptionTakesPriority(t *testing.T) {
+	b := NewBattery(BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 0, ChargeToPercent: 100})
+	b.SoCWh = 9000
+
+	// Home is importing at a cheap price: arbitrage alone would charge,
+	// but self-consumption discharges to cover the import.
+	b.ProcessHybrid(1000, t0, 0.20, 0.30, 0.80)
+	r := b.ProcessHybrid(1000, t0.Add(time.Hour), 0.20, 0.30, 0.80)
+	assert.InDelta(t, 1000, r.BatteryPowerW, 0.01)
+
+	// Expensive: arbitrage widens the discharge to max power.
+	r = b.ProcessHybrid(1000, t0.Add(2*time.Hour), 0.90, 0.30, 0.80)
+	assert.InDelta(t, 5000, r.BatteryPowerW, 0.01)
+}
+
+func TestBattery_HybridArbitrageWhenIdle(t *testing.T) {
+	b := NewBattery(BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 10, ChargeToPercent: 100})
+
+	// Battery at floor cannot cover the import, so cheap grid energy charges it.
+	b.ProcessHybrid(1000, t0, 0.20, 0.30, 0.80)
+	r := b.ProcessHybrid(1000, t0.Add(time.Hour), 0.20, 0.30, 0.80)
+	assert.InDelta(t, -5000, r.BatteryPowerW, 0.01)
+	assert.InDelta(t, 6000, r.AdjustedGridW, 0.01)
+}
+
 func TestBattery_ArbitrageRespectsCeiling(t *testing.T) {
 	cfg := defaultBatteryConfig
 	cfg.ChargeToPercent = 90
@@ -334,3 +669,198 @@ func TestBattery_ArbitrageRespectsCeiling(t *testing.T) {
 	assert.InDelta(t, 0, r.BatteryPowerW, 0.01)
 	assert.InDelta(t, 90, r.SoCPercent, 0.01)
 }
+
+func TestBattery_ArbitrageMinDwellSuppressesReversal(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.MinDwellMinutes = 60
+	b := NewBattery(cfg)
+	b.SoCWh = 5000
+
+	// Price alternates across both thresholds every 15 minutes.
+	prices := []float64{0.10, 0.10, 0.90, 0.10, 0.90, 0.90, 0.90, 0.90}
+	var powers []float64
+	for i, p := range prices {
+		r := b.ProcessArbitrage(0, t0.Add(time.Duration(i)*15*time.Minute), p, 0.20, 0.80)
+		powers = append(powers, r.BatteryPowerW)
+	}
+
+	// Interval decisions use price at the end of each interval.
+	assert.InDelta(t, 0, powers[0], 0.01)     // baseline
+	assert.InDelta(t, -5000, powers[1], 0.01) // charging starts at 0:00
+	assert.InDelta(t, 0, powers[2], 0.01)     // reversal at 0:15 suppressed → hold
+	assert.InDelta(t, -5000, powers[3], 0.01) // charging continues
+	assert.InDelta(t, 0, powers[4], 0.01)     // reversal at 0:45 still suppressed
+	assert.InDelta(t, 5000, powers[5], 0.01)  // 1:00 — dwell elapsed, discharge allowed
+	assert.InDelta(t, 5000, powers[6], 0.01)
+	assert.Equal(t, 1, b.LastDirection)
+}
+
+func TestBattery_ArbitrageNoDwellReversesImmediately(t *testing.T) {
+	b := NewBattery(defaultBatteryConfig)
+	b.SoCWh = 5000
+
+	b.ProcessArbitrage(0, t0, 0.10, 0.20, 0.80)
+	r := b.ProcessArbitrage(0, t0.Add(15*time.Minute), 0.10, 0.20, 0.80)
+	assert.InDelta(t, -5000, r.BatteryPowerW, 0.01)
+	r = b.ProcessArbitrage(0, t0.Add(30*time.Minute), 0.90, 0.20, 0.80)
+	assert.InDelta(t, 5000, r.BatteryPowerW, 0.01)
+}
+
+func TestBattery_ResetClearsDwellState(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.MinDwellMinutes = 60
+	b := NewBattery(cfg)
+
+	b.ProcessArbitrage(0, t0, 0.10, 0.20, 0.80)
+	b.ProcessArbitrage(0, t0.Add(15*time.Minute), 0.10, 0.20, 0.80)
+	assert.Equal(t, -1, b.LastDirection)
+
+	b.Reset()
+	assert.Equal(t, 0, b.LastDirection)
+	assert.True(t, b.LastSwitchTime.IsZero())
+}
+
+func TestBattery_AsymmetricPowerLimits(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.MaxChargeW = 3000
+	cfg.MaxDischargeW = 5000
+	cfg.MaxPowerW = 4000 // fallback, overridden in both directions
+
+	t.Run("self-consumption charge capped", func(t *testing.T) {
+		b := NewBattery(cfg)
+		b.Process(-8000, t0)
+		r := b.Process(-8000, t0.Add(time.Hour))
+		assert.InDelta(t, -3000, r.BatteryPowerW, 0.01)
+		assert.InDelta(t, -5000, r.AdjustedGridW, 0.01)
+	})
+
+	t.Run("self-consumption discharge capped", func(t *testing.T) {
+		b := NewBattery(cfg)
+		b.SoCWh = 9000
+		b.Process(8000, t0)
+		r := b.Process(8000, t0.Add(time.Hour))
+		assert.InDelta(t, 5000, r.BatteryPowerW, 0.01)
+		assert.InDelta(t, 3000, r.AdjustedGridW, 0.01)
+	})
+
+	t.Run("arbitrage charge capped", func(t *testing.T) {
+		b := NewBattery(cfg)
+		b.ProcessArbitrage(0, t0, 0.10, 0.20, 0.80)
+		r := b.ProcessArbitrage(0, t0.Add(time.Hour), 0.10, 0.20, 0.80)
+		assert.InDelta(t, -3000, r.BatteryPowerW, 0.01)
+	})
+
+	t.Run("arbitrage discharge capped", func(t *testing.T) {
+		b := NewBattery(cfg)
+		b.SoCWh = 9000
+		b.ProcessArbitrage(0, t0, 0.90, 0.20, 0.80)
+		r := b.ProcessArbitrage(0, t0.Add(time.Hour), 0.90, 0.20, 0.80)
+		assert.InDelta(t, 5000, r.BatteryPowerW, 0.01)
+	})
+}
+
+func TestBattery_MaxPowerFallback(t *testing.T) {
+	cfg := defaultBatteryConfig
+	cfg.MaxPowerW = 2000
+	cfg.MaxDischargeW = 4000 // only discharge overridden
+
+	b := NewBattery(cfg)
+	b.Process(-8000, t0)
+	r := b.Process(-8000, t0.Add(time.Hour))
+	assert.InDelta(t, -2000, r.BatteryPowerW, 0.01)
+}
+
+func TestBatteryConfig_BreakEvenSpread(t *testing.T) {
+	// Lossless, no wear: any positive spread pays.
+	assert.InDelta(t, 0, BatteryConfig{CapacityKWh: 10}.BreakEvenSpread(0.5), 1e-9)
+
+	// 80% round trip at 0.40 PLN/kWh loses 0.10; wear 2 PLN/cycle on 10 kWh adds 0.20.
+	cfg := BatteryConfig{CapacityKWh: 10, RoundTripEfficiencyPct: 80, CycleCostPLN: 2}
+	assert.InDelta(t, 0.30, cfg.BreakEvenSpread(0.40), 1e-9)
+}
+
+func TestBatteryConfig_IdleBreakEvenSpread(t *testing.T) {
+	// 80% round trip and 10%/day self-discharge held 2.4 h: 0.8 × 0.99 kept.
+	cfg := BatteryConfig{CapacityKWh: 10, RoundTripEfficiencyPct: 80, SelfDischargePctPerDay: 10}
+	assert.InDelta(t, 0.10, cfg.IdleBreakEvenSpread(0.40, 0), 1e-9)
+	assert.InDelta(t, 0.40*(1/(0.8*0.99)-1), cfg.IdleBreakEvenSpread(0.40, 2.4), 1e-9)
+	assert.Equal(t, cfg.BreakEvenSpread(0.40), cfg.IdleBreakEvenSpread(0.40, 0))
+}
+
+func TestBattery_ArbitrageIdleLoss(t *testing.T) {
+	// Charge one hour at 0.50, hold at 0.55, sell at 0.60, then 0.50 again.
+	// The 0.10 spread covers the 90% round trip plus 10%/day self-discharge
+	// over an hour's hold (break-even 0.058) but not over a day (0.117), so
+	// after a long hold the next cheap hour is not bought.
+	cfg := BatteryConfig{
+		CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100,
+		RoundTripEfficiencyPct: 90, SelfDischargePctPerDay: 10,
+	}
+	rechargeAfter := func(idle time.Duration) (*Battery, float64) {
+		b := NewBattery(cfg)
+		t0 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		b.ProcessArbitrage(0, t0, 0.50, 0.50, 0.60)
+		r := b.ProcessArbitrage(0, t0.Add(time.Hour), 0.50, 0.50, 0.60)
+		require.InDelta(t, -5000, r.BatteryPowerW, 0.01)
+		held := t0.Add(time.Hour + idle)
+		b.ProcessArbitrage(0, held, 0.55, 0.50, 0.60)
+		r = b.ProcessArbitrage(0, held.Add(time.Hour), 0.60, 0.50, 0.60)
+		require.Greater(t, r.BatteryPowerW, 0.0, "bought energy is always sold")
+		return b, b.ProcessArbitrage(0, held.Add(2*time.Hour), 0.50, 0.50, 0.60).BatteryPowerW
+	}
+
+	b, power := rechargeAfter(time.Hour)
+	assert.InDelta(t, 1, b.ExpectedIdleH, 1e-9)
+	assert.InDelta(t, -5000, power, 0.01)
+
+	// The three-day hold counts as a day, the longest assumed.
+	b, power = rechargeAfter(72 * time.Hour)
+	assert.InDelta(t, maxExpectedIdleH, b.ExpectedIdleH, 1e-9)
+	assert.Zero(t, power)
+
+	// Without self-discharge the long hold does not stop charging.
+	cfg.SelfDischargePctPerDay = 0
+	_, power = rechargeAfter(72 * time.Hour)
+	assert.InDelta(t, -5000, power, 0.01)
+}
+
+func TestBattery_SelfDischargeDrainsSoC(t *testing.T) {
+	b := NewBattery(BatteryConfig{
+		CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 10, ChargeToPercent: 100,
+		InitialSoCPercent: 50, SelfDischargePctPerDay: 10,
+	})
+	t0 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	b.Process(0, t0)
+	r := b.Process(0, t0.Add(24*time.Hour))
+
+	assert.InDelta(t, 4500, b.SoCWh, 1e-6)
+	assert.InDelta(t, 45, r.SoCPercent, 1e-6)
+	assert.InDelta(t, 500, b.SelfDischargedWh, 1e-6)
+	assert.Zero(t, b.NetDischargeWh, "no energy reached the grid")
+
+	// Never below the discharge floor.
+	b.Process(0, t0.Add(100*24*time.Hour))
+	assert.InDelta(t, 1000, b.SoCWh, 1e-6)
+}
+
+func TestPriceBand(t *testing.T) {
+	assert.Equal(t, 30, priceBand(0.3))
+	assert.Equal(t, 30, priceBand(0.399))
+	assert.Equal(t, 0, priceBand(0.05))
+	assert.Equal(t, -10, priceBand(-0.05))
+	assert.Equal(t, 120, priceBand(1.2))
+}
+
+func TestParseChargePriority(t *testing.T) {
+	for s, want := range map[string]ChargePriority{
+		"":            ChargePriorityPriceFirst,
+		"price-first": ChargePriorityPriceFirst,
+		"pv-first":    ChargePriorityPVFirst,
+	} {
+		p, err := ParseChargePriority(s)
+		require.NoError(t, err)
+		assert.Equal(t, want, p)
+	}
+	_, err := ParseChargePriority("pv_first")
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package simulator
+
+import "energy_simulator/internal/model"
+
+// Capability reports whether an optional feature is available and why not.
+type Capability struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Capabilities lists optional features and whether the loaded data and
+// configured sensors support them.
+func (e *Engine) Capabilities() []Capability {
+	hasSensor := make(map[model.SensorType]bool)
+	for _, s := range e.store.Sensors() {
+		hasSensor[s.Type] = true
+	}
+
+	e.mu.Lock()
+	priceSensorID := e.priceSensorID
+	tempSensorID := e.tempSensorID
+	hasPrediction := e.prediction != nil
+	e.mu.Unlock()
+
+	return []Capability{
+		capability("cost_tracking", priceSensorID != "", "no energy_price sensor"),
+		capability("arbitrage", priceSensorID != "", "no energy_price sensor"),
+		capability("prediction_comparison", tempSensorID != "", "no pump_ext_temp sensor"),
+		capability("prediction_mode", hasPrediction, "prediction models not loaded"),
+		capability("custom_pv", hasSensor[model.SensorPVPower], "no pv_power sensor"),
+		capability("heat_pump_stats", hasSensor[model.SensorPumpConsumption], "no pump_total_consumption sensor"),
+	}
+}
+
+func capability(name string, enabled bool, disabledReason string) Capability {
+	c := Capability{Name: name, Enabled: enabled}
+	if !enabled {
+		c.Reason = disabledReason
+	}
+	return c
+}
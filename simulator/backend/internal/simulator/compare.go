@@ -0,0 +1,122 @@
+package simulator
+
+import "energy_simulator/internal/model"
+
+// ConfigComparisonSide is one battery setup of a ConfigComparison. Strategy is
+// StrategyNoBattery when the side has no battery; SavingsPLN is measured
+// against the no-battery baseline and negative when the battery costs more.
+type ConfigComparisonSide struct {
+	Strategy    string  `json:"strategy"`
+	CapacityKWh float64 `json:"capacity_kwh"`
+	MaxPowerW   float64 `json:"max_power_w"`
+	NetCostPLN  float64 `json:"net_cost_pln"`
+	SavingsPLN  float64 `json:"savings_pln"`
+}
+
+// ConfigComparison contrasts the configured battery (A) with the comparison
+// battery set by SetCompareBattery (B), both replayed over the same data.
+// DifferencePLN is B's savings minus A's; Better is "a", "b", or empty when
+// they save the same.
+type ConfigComparison struct {
+	A             ConfigComparisonSide `json:"a"`
+	B             ConfigComparisonSide `json:"b"`
+	DifferencePLN float64              `json:"difference_pln"`
+	Better        string               `json:"better"`
+}
+
+// SetCompareBattery configures a second, independent battery replayed
+// alongside the configured one with its own settings and strategy
+// (StrategySelfConsumption, StrategyArbitrage or StrategyHybrid; anything
+// else means self-consumption), so two setups can be compared without
+// reconfiguring. Pass nil to disable.
+func (e *Engine) SetCompareBattery(cfg *BatteryConfig, strategy string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cfg == nil {
+		e.cmpBattery = nil
+		return
+	}
+	switch strategy {
+	case StrategyArbitrage, StrategyHybrid:
+	default:
+		strategy = StrategySelfConsumption
+	}
+	e.cmpBattery = NewBattery(*cfg)
+	e.cmpStrategy = strategy
+}
+
+// processCompareBattery replays grid reading r through the comparison battery
+// with its strategy and accounts the adjusted grid cost. Price strategies
+// idle while there are no price thresholds, like the arbitrage shadow.
+func (e *Engine) processCompareBattery(bat *Battery, strategy, priceSensor string, r model.Reading) {
+	result := ProcessResult{AdjustedGridW: r.Value}
+	switch strategy {
+	case StrategyArbitrage, StrategyHybrid:
+		low, high := e.priceThresholds(r.Timestamp)
+		if priceSensor != "" && low != high {
+			var price float64
+			if pr, ok := e.store.ReadingAt(priceSensor, r.Timestamp); ok {
+				price = pr.Value
+			}
+			if strategy == StrategyArbitrage {
+				result = bat.ProcessArbitrage(r.Value, r.Timestamp, price, low, high)
+			} else {
+				result = bat.ProcessHybrid(r.Value, r.Timestamp, price, low, high)
+			}
+		}
+	default:
+		if bat.config.CurtailmentVoltageV > 0 {
+			if v, ok := e.gridVoltageAt(r.Timestamp); ok {
+				bat.SetGridVoltage(v)
+			}
+		}
+		result = bat.Process(r.Value, r.Timestamp)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := r.SensorID + ":cmp"
+	adjusted := r
+	adjusted.Value = result.AdjustedGridW
+	last, exists := e.lastReadings[key]
+	e.lastReadings[key] = adjusted
+	if !exists {
+		return
+	}
+	hours := r.Timestamp.Sub(last.Timestamp).Hours()
+	wh := e.intervalAverage(r.Type, last.Value, adjusted.Value)*hours + bat.config.InverterStandbyW*hours
+	price := e.spotPrice(r.Timestamp)
+	if wh > 0 {
+		e.cmpGridImportCostPLN += (wh / 1000) * price
+	} else if wh < 0 {
+		e.cmpGridExportRevenuePLN += e.exportRevenue(-wh, price, r.Timestamp)
+	}
+}
+
+// buildConfigComparison compares the configured battery from summary s with
+// the comparison battery. Must be called with mu held and cmpBattery set.
+func (e *Engine) buildConfigComparison(s Summary) ConfigComparison {
+	a := ConfigComparisonSide{Strategy: StrategyNoBattery, NetCostPLN: s.NetCostPLN}
+	if e.battery != nil {
+		a.Strategy = StrategySelfConsumption
+		a.CapacityKWh = e.battery.config.CapacityKWh
+		a.MaxPowerW = e.battery.config.MaxPowerW
+	}
+	b := ConfigComparisonSide{
+		Strategy:    e.cmpStrategy,
+		CapacityKWh: e.cmpBattery.config.CapacityKWh,
+		MaxPowerW:   e.cmpBattery.config.MaxPowerW,
+		NetCostPLN:  RoundPLN(e.cmpGridImportCostPLN - e.cmpGridExportRevenuePLN),
+	}
+	a.SavingsPLN = RoundPLN(s.RawNetCostPLN - a.NetCostPLN)
+	b.SavingsPLN = RoundPLN(s.RawNetCostPLN - b.NetCostPLN)
+
+	c := ConfigComparison{A: a, B: b, DifferencePLN: RoundPLN(b.SavingsPLN - a.SavingsPLN)}
+	switch {
+	case c.DifferencePLN > 0:
+		c.Better = "b"
+	case c.DifferencePLN < 0:
+		c.Better = "a"
+	}
+	return c
+}
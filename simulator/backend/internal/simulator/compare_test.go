@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/predictor"
+	"energy_simulator/internal/store"
+)
+
+// compareStore holds two days of a 4 kW midday export and a 1.5 kW import
+// the rest of the day at a flat 0.8 PLN/kWh. Runs sell exports at a fifth of
+// that, so storing them pays.
+func compareStore() *store.Store {
+	grid := make([]float64, 49)
+	for i := range grid {
+		grid[i] = 1500
+		if h := startTime.Add(time.Duration(i) * hour).Hour(); h >= 9 && h < 15 {
+			grid[i] = -4000
+		}
+	}
+	return makeStoreWithPrices(grid, 0.8)
+}
+
+func runComparison(t *testing.T, a, b *BatteryConfig, strategy string) (ConfigComparison, *mockCallback) {
+	t.Helper()
+	cb := &mockCallback{}
+	e := New(compareStore(), cb)
+	require.True(t, e.Init())
+	e.SetPriceSensor("sensor.price")
+	e.SetExportCoefficient(0.2)
+	e.SetBattery(a)
+	e.SetCompareBattery(b, strategy)
+	e.Step(48 * hour)
+	c, ok := cb.lastConfigComparison()
+	require.True(t, ok)
+	return c, cb
+}
+
+func TestEngine_ConfigComparison(t *testing.T) {
+	small := &BatteryConfig{CapacityKWh: 5, MaxPowerW: 5000, ChargeToPercent: 100}
+	large := &BatteryConfig{CapacityKWh: 20, MaxPowerW: 5000, ChargeToPercent: 100}
+	c, cb := runComparison(t, small, large, "")
+	summary := cb.lastSummary()
+
+	assert.Equal(t, StrategySelfConsumption, c.A.Strategy)
+	assert.Equal(t, 5.0, c.A.CapacityKWh)
+	assert.InDelta(t, summary.NetCostPLN, c.A.NetCostPLN, 1e-9)
+	assert.Equal(t, StrategySelfConsumption, c.B.Strategy)
+	assert.Equal(t, 20.0, c.B.CapacityKWh)
+
+	// Both report savings and the larger battery stores more of the export.
+	assert.Greater(t, c.A.SavingsPLN, 0.0)
+	assert.Greater(t, c.B.SavingsPLN, c.A.SavingsPLN)
+	assert.InDelta(t, summary.RawNetCostPLN-c.B.NetCostPLN, c.B.SavingsPLN, 0.01)
+	assert.InDelta(t, c.B.SavingsPLN-c.A.SavingsPLN, c.DifferencePLN, 0.01)
+	assert.Equal(t, "b", c.Better)
+
+	// An identical comparison battery matches the configured one.
+	same, _ := runComparison(t, small, small, StrategySelfConsumption)
+	assert.InDelta(t, same.A.NetCostPLN, same.B.NetCostPLN, 0.01)
+	assert.Empty(t, same.Better)
+}
+
+func TestEngine_ConfigComparisonWithoutBattery(t *testing.T) {
+	c, cb := runComparison(t, nil, &BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100}, "bogus")
+	assert.Equal(t, StrategyNoBattery, c.A.Strategy)
+	assert.Zero(t, c.A.SavingsPLN)
+	assert.Equal(t, StrategySelfConsumption, c.B.Strategy)
+	assert.Greater(t, c.B.SavingsPLN, 0.0)
+	assert.Equal(t, "b", c.Better)
+	assert.InDelta(t, cb.lastSummary().RawNetCostPLN, c.A.NetCostPLN, 1e-9)
+}
+
+func TestEngine_ConfigComparisonDisabled(t *testing.T) {
+	cb := &mockCallback{}
+	e := New(compareStore(), cb)
+	require.True(t, e.Init())
+	e.SetCompareBattery(&BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000}, "")
+	e.SetCompareBattery(nil, "")
+	e.Step(4 * hour)
+	_, ok := cb.lastConfigComparison()
+	assert.False(t, ok)
+}
+
+func TestEngine_ConfigComparisonContinuesIntoPrediction(t *testing.T) {
+	tempPred, err := predictor.LoadTemperaturePredictor([]byte(linearTempModel), 1)
+	require.NoError(t, err)
+	powerPred, err := predictor.LoadPredictor([]byte(constPowerModel), 1)
+	require.NoError(t, err)
+
+	cb := &mockCallback{}
+	e := New(makeStoreWithPrices([]float64{1000, 1000, 1000, 1000}, 0.8), cb)
+	require.True(t, e.Init())
+	e.SetPriceSensor("sensor.price")
+	e.SetPrediction(NewPredictionProvider(tempPred, powerPred, "sensor.grid"))
+	e.SetPredictionCatchUp(true)
+	cfg := &BatteryConfig{CapacityKWh: 5, MaxPowerW: 5000, DischargeToPercent: 10, ChargeToPercent: 100, InitialSoCPercent: 90}
+	e.SetBattery(cfg)
+	e.SetCompareBattery(cfg, StrategySelfConsumption)
+
+	e.Step(3 * hour)
+	require.True(t, e.PredictionMode())
+	e.Step(6 * hour)
+
+	// An identical comparison battery keeps matching the configured one
+	// through the forecast instead of freezing at the handoff.
+	c, ok := cb.lastConfigComparison()
+	require.True(t, ok)
+	assert.Greater(t, c.A.SavingsPLN, 0.0)
+	assert.InDelta(t, c.A.NetCostPLN, c.B.NetCostPLN, 0.01)
+	assert.Empty(t, c.Better)
+}
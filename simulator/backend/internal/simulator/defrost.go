@@ -0,0 +1,120 @@
+package simulator
+
+import (
+	"time"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+const (
+	// defrostMaxProductionW is the heat output below which the pump is
+	// treated as delivering nothing: during defrost the cycle reverses and
+	// draws heat back from the water circuit.
+	defrostMaxProductionW = 100.0
+	// defrostMinConsumptionW is the draw that separates a defrost (compressor
+	// running) from the pump simply being idle.
+	defrostMinConsumptionW = 300.0
+	// Frost builds up on the outdoor coil in the humid band around freezing;
+	// colder air is too dry and warmer air does not freeze.
+	defrostMinOutdoorC = -10.0
+	defrostMaxOutdoorC = 7.0
+	// defrostMaxGap ends an event at a gap in the consumption data instead
+	// of stretching it over the missing interval.
+	defrostMaxGap = 30 * time.Minute
+)
+
+// DefrostMonth summarises the defrost cycles detected in one calendar month.
+type DefrostMonth struct {
+	Month     time.Time     // first day of the month
+	Events    int           // number of separate defrost cycles
+	Duration  time.Duration // total time spent defrosting
+	EnergyKWh float64       // consumption during defrost
+	CostPLN   float64       // EnergyKWh priced at spot; 0 without a price sensor
+}
+
+// DetectDefrost finds heat-pump defrost cycles over tr: intervals where
+// production is near zero while consumption stays high and the outdoor
+// temperature is around freezing. Consecutive matching consumption readings
+// form one event, which counts towards the month it starts in. Outdoor
+// temperature comes from the heat pump sensor, falling back to Netatmo; with
+// neither the temperature check is skipped. Months without events are
+// omitted; the result is in month order.
+func DetectDefrost(s *store.Store, tr model.TimeRange) []DefrostMonth {
+	consumption := s.SeriesByType(model.SensorPumpConsumption, tr)
+	production := s.SeriesByType(model.SensorPumpProduction, tr)
+	if len(consumption) == 0 || len(production) == 0 {
+		return nil
+	}
+	outdoorSeries := s.SeriesByType(model.SensorPumpExtTemp, tr)
+	if len(outdoorSeries) == 0 {
+		outdoorSeries = s.SeriesByType(model.SensorNetatmoOutdoorTemp, tr)
+	}
+	prod := seriesCursor{readings: production}
+	outdoor := seriesCursor{readings: outdoorSeries}
+	price := seriesCursor{readings: s.SeriesByType(model.SensorEnergyPrice, tr)}
+
+	var months []DefrostMonth
+	inEvent := false
+	for i, r := range consumption {
+		var dt time.Duration
+		if i+1 < len(consumption) {
+			dt = consumption[i+1].Timestamp.Sub(r.Timestamp)
+		}
+		if dt <= 0 || dt > defrostMaxGap || !isDefrost(r.Value, &prod, &outdoor, r.Timestamp) {
+			inEvent = false
+			continue
+		}
+
+		month := time.Date(r.Timestamp.Year(), r.Timestamp.Month(), 1, 0, 0, 0, 0, r.Timestamp.Location())
+		if !inEvent {
+			if len(months) == 0 || !months[len(months)-1].Month.Equal(month) {
+				months = append(months, DefrostMonth{Month: month})
+			}
+			months[len(months)-1].Events++
+			inEvent = true
+		}
+		m := &months[len(months)-1]
+		kwh := r.Value / 1000 * dt.Hours()
+		m.Duration += dt
+		m.EnergyKWh += kwh
+		if p, ok := price.at(r.Timestamp); ok {
+			m.CostPLN += kwh * p
+		}
+	}
+	return months
+}
+
+// isDefrost reports whether a consumption reading of consW at t matches the
+// defrost signature.
+func isDefrost(consW float64, prod, outdoor *seriesCursor, t time.Time) bool {
+	if consW < defrostMinConsumptionW {
+		return false
+	}
+	p, ok := prod.at(t)
+	if !ok || p > defrostMaxProductionW {
+		return false
+	}
+	if len(outdoor.readings) == 0 {
+		return true
+	}
+	c, ok := outdoor.at(t)
+	return ok && c >= defrostMinOutdoorC && c <= defrostMaxOutdoorC
+}
+
+// seriesCursor looks up the latest value at or before t in a time-ordered
+// series. Queries must not go back in time.
+type seriesCursor struct {
+	readings []model.Reading
+	next     int
+}
+
+func (c *seriesCursor) at(t time.Time) (float64, bool) {
+	for c.next < len(c.readings) && !c.readings[c.next].Timestamp.After(t) {
+		c.next++
+	}
+	if c.next == 0 {
+		return 0, false
+	}
+	return c.readings[c.next-1].Value, true
+}
@@ -0,0 +1,85 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// defrostStore builds minute-resolution heat pump data from base for the
+// given number of hours: steady heating (1 kW in, 3 kW out) interrupted by
+// 5-minute defrost dips starting at each offset in dips.
+func defrostStore(base time.Time, hours int, outdoorC float64, dips []time.Duration) *store.Store {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.cons", Type: model.SensorPumpConsumption, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.prod", Type: model.SensorPumpProduction, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.out", Type: model.SensorPumpExtTemp, Unit: "°C"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+
+	inDip := func(off time.Duration) bool {
+		for _, d := range dips {
+			if off >= d && off < d+5*time.Minute {
+				return true
+			}
+		}
+		return false
+	}
+
+	var readings []model.Reading
+	for m := 0; m < hours*60; m++ {
+		off := time.Duration(m) * time.Minute
+		ts := base.Add(off)
+		prod := 3000.0
+		if inDip(off) {
+			prod = 0
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.cons", Type: model.SensorPumpConsumption, Value: 1000},
+			model.Reading{Timestamp: ts, SensorID: "sensor.prod", Type: model.SensorPumpProduction, Value: prod},
+		)
+		if m%60 == 0 {
+			readings = append(readings,
+				model.Reading{Timestamp: ts, SensorID: "sensor.out", Type: model.SensorPumpExtTemp, Value: outdoorC},
+				model.Reading{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: 0.6},
+			)
+		}
+	}
+	s.AddReadings(readings)
+	return s
+}
+
+func TestDetectDefrost_CountsDips(t *testing.T) {
+	base := time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)
+	// Two dips on 31 January, three on 1 February.
+	dips := []time.Duration{
+		30 * time.Minute, 2 * time.Hour,
+		5 * time.Hour, 6 * time.Hour, 7*time.Hour + 30*time.Minute,
+	}
+	s := defrostStore(base, 10, 1, dips)
+
+	months := DetectDefrost(s, model.TimeRange{Start: base, End: base.Add(10 * time.Hour)})
+	require.Len(t, months, 2)
+
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), months[0].Month)
+	assert.Equal(t, 2, months[0].Events)
+	assert.Equal(t, 10*time.Minute, months[0].Duration)
+
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), months[1].Month)
+	assert.Equal(t, 3, months[1].Events)
+	assert.Equal(t, 15*time.Minute, months[1].Duration)
+	// 15 min at 1 kW = 0.25 kWh at 0.6 PLN/kWh.
+	assert.InDelta(t, 0.25, months[1].EnergyKWh, 1e-9)
+	assert.InDelta(t, 0.15, months[1].CostPLN, 1e-9)
+}
+
+func TestDetectDefrost_IgnoresDipsOutsideFrostBand(t *testing.T) {
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := defrostStore(base, 4, 15, []time.Duration{time.Hour, 2 * time.Hour})
+
+	assert.Empty(t, DetectDefrost(s, model.TimeRange{Start: base, End: base.Add(4 * time.Hour)}))
+}
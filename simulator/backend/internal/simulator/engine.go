@@ -1,6 +1,10 @@
 package simulator
 
 import (
+	"encoding/csv"
+	"fmt"
+	"maps"
+	"math"
 	"sort"
 	"sync"
 	"time"
@@ -17,8 +21,35 @@ type State struct {
 	Running bool      `json:"running"`
 }
 
+// EndBehavior decides what the replay does on reaching the end of its time
+// range (unless it hands off to prediction).
+type EndBehavior string
+
+const (
+	// EndStop stops the replay at the end. This is the default.
+	EndStop EndBehavior = "stop"
+	// EndLoop seeks back to the start, resetting accumulators, and keeps
+	// replaying, for kiosk and demo displays.
+	EndLoop EndBehavior = "loop"
+	// EndHold stays at the end, still running, showing the final state
+	// until paused or seeked.
+	EndHold EndBehavior = "hold"
+)
+
+// ParseEndBehavior parses "stop", "loop" or "hold".
+func ParseEndBehavior(s string) (EndBehavior, error) {
+	switch b := EndBehavior(s); b {
+	case EndStop, EndLoop, EndHold:
+		return b, nil
+	}
+	return "", fmt.Errorf("unknown end behavior %q (want stop, loop or hold)", s)
+}
+
 // Summary holds running energy totals.
 type Summary struct {
+	// Currency labels every …PLN amount; the math is currency-agnostic
+	Currency string `json:"currency"`
+
 	TodayKWh float64 `json:"today_kwh"`
 	MonthKWh float64 `json:"month_kwh"`
 	TotalKWh float64 `json:"total_kwh"`
@@ -46,10 +77,23 @@ type Summary struct {
 	ArbNetCostPLN        float64 `json:"arb_net_cost_pln"`
 	ArbBatterySavingsPLN float64 `json:"arb_battery_savings_pln"`
 
+	// Current day's P33/P67 spread vs the battery's break-even spread, in
+	// PLN/kWh; kept unrounded since grosze would hide sub-grosz spreads
+	ArbSpreadPLN          float64 `json:"arb_spread_pln" round:"-"`
+	ArbBreakEvenSpreadPLN float64 `json:"arb_break_even_spread_pln" round:"-"`
+	ArbSpreadProfitable   bool    `json:"arb_spread_profitable"`
+
+	// Hybrid strategy comparison (self-consumption first, arbitrage on the rest)
+	HybridNetCostPLN        float64 `json:"hybrid_net_cost_pln"`
+	HybridBatterySavingsPLN float64 `json:"hybrid_battery_savings_pln"`
+
 	// Cheap export tracking
 	CheapExportKWh    float64 `json:"cheap_export_kwh"`
 	CheapExportRevPLN float64 `json:"cheap_export_rev_pln"`
-	CurrentSpotPrice  float64 `json:"current_spot_price"`
+	// Export at negative spot prices and what it cost (positive PLN)
+	NegativeExportKWh     float64 `json:"negative_export_kwh"`
+	NegativeExportCostPLN float64 `json:"negative_export_cost_pln"`
+	CurrentSpotPrice      float64 `json:"current_spot_price"`
 
 	// Net metering
 	NMNetCostPLN    float64 `json:"nm_net_cost_pln"`
@@ -59,12 +103,35 @@ type Summary struct {
 	NBNetCostPLN float64 `json:"nb_net_cost_pln"`
 	NBDepositPLN float64 `json:"nb_deposit_pln"`
 
+	// Reactive energy beyond tan φ × active import, charged per kvarh
+	ReactivePenaltyPLN float64 `json:"reactive_penalty_pln"`
+
+	// Appliance load shifting: realized savings and net cost as if shifted
+	ApplianceShiftSavingsPLN   float64 `json:"appliance_shift_savings_pln"`
+	ApplianceShiftedNetCostPLN float64 `json:"appliance_shifted_net_cost_pln"`
+
 	// Pre-heating
 	PreHeatCostPLN    float64 `json:"pre_heat_cost_pln"`
 	PreHeatSavingsPLN float64 `json:"pre_heat_savings_pln"`
 
+	// Thermal model validation against measured indoor temperature
+	ThermalRMSEC   float64 `json:"thermal_rmse_c,omitempty"`
+	ThermalSamples int     `json:"thermal_samples,omitempty"`
+
 	// PV arrays
 	PVArrayProduction []PVArrayProd `json:"pv_array_production,omitempty"`
+
+	// Three-phase installs: per-phase grid energy and the spread between
+	// the most and least loaded phase (time-weighted average and peak)
+	Phases             []PhaseEnergy `json:"phases,omitempty"`
+	PhaseImbalanceAvgW float64       `json:"phase_imbalance_avg_w,omitempty"`
+	PhaseImbalanceMaxW float64       `json:"phase_imbalance_max_w,omitempty"`
+
+	// Increase of cumulative counter sensors (native units, e.g. kvarh, h)
+	Counters map[model.SensorType]float64 `json:"counters,omitempty"`
+
+	// Must-run load added to the measured demand (SetMustRunLoad)
+	MustRunKWh float64 `json:"must_run_kwh,omitempty"`
 }
 
 // PVArrayProd holds per-array PV production for the summary.
@@ -75,17 +142,45 @@ type PVArrayProd struct {
 
 // OffGridCoverage returns the percentage of adjusted home demand that could be
 // covered by non-grid sources (PV self-consumption + battery). heatPumpPct and
-// appliancePct scale the respective demand components (0–100).
+// appliancePct scale the respective demand components (0–100). It is
+// OffGridCoverageWithBaseLoad with no separate base load.
 func (s *Summary) OffGridCoverage(heatPumpPct, appliancePct float64) float64 {
+	return s.OffGridCoverageWithBaseLoad(heatPumpPct, appliancePct, 0, 100)
+}
+
+// OffGridCoverageWithBaseLoad is OffGridCoverage with always-on base load
+// (fridge, router) split out of the appliance bucket. baseLoadKWh is taken
+// from the appliance share (capped at it) and scaled by baseLoadPct instead
+// of appliancePct. The battery is treated as lossless.
+func (s *Summary) OffGridCoverageWithBaseLoad(heatPumpPct, appliancePct, baseLoadKWh, baseLoadPct float64) float64 {
+	return s.OffGridCoverageWithEfficiency(heatPumpPct, appliancePct, baseLoadKWh, baseLoadPct, 1)
+}
+
+// OffGridCoverageWithEfficiency is OffGridCoverageWithBaseLoad with the
+// battery contribution derated by its round-trip efficiency (0–1, 0 = 1):
+// the same stored surplus covers only efficiency × BatterySavingsKWh.
+// The engine's must-run load (MustRunKWh) is unschedulable and always
+// counts in full, whatever the usage percentages.
+func (s *Summary) OffGridCoverageWithEfficiency(heatPumpPct, appliancePct, baseLoadKWh, baseLoadPct, efficiency float64) float64 {
+	if efficiency <= 0 {
+		efficiency = 1
+	}
 	applianceKWh := s.HomeDemandKWh - s.HeatPumpKWh
 	if applianceKWh < 0 {
 		applianceKWh = 0
 	}
-	adjustedDemand := s.HeatPumpKWh*(heatPumpPct/100) + applianceKWh*(appliancePct/100)
+	mustRunKWh := max(0, min(s.MustRunKWh, applianceKWh))
+	applianceKWh -= mustRunKWh
+	baseLoadKWh = max(0, min(baseLoadKWh, applianceKWh))
+	applianceKWh -= baseLoadKWh
+	adjustedDemand := s.HeatPumpKWh*(heatPumpPct/100) +
+		applianceKWh*(appliancePct/100) +
+		baseLoadKWh*(baseLoadPct/100) +
+		mustRunKWh
 	if adjustedDemand <= 0 {
 		return 100
 	}
-	nonGridKWh := s.SelfConsumptionKWh + s.BatterySavingsKWh
+	nonGridKWh := s.SelfConsumptionKWh + s.BatterySavingsKWh*efficiency
 	coverage := nonGridKWh / adjustedDemand * 100
 	if coverage > 100 {
 		coverage = 100
@@ -122,6 +217,64 @@ type ArbitrageDayRecord struct {
 	GapMinutes         int     `json:"gap_minutes"`
 	CyclesDelta        float64 `json:"cycles_delta"`
 	EarningsPLN        float64 `json:"earnings_pln"`
+	SpreadPLN          float64 `json:"spread_pln"`            // P67 − P33 of the day's prices
+	BreakEvenSpreadPLN float64 `json:"break_even_spread_pln"` // minimum profitable spread, incl. self-discharge over the gap
+	Profitable         bool    `json:"profitable"`            // SpreadPLN clears BreakEvenSpreadPLN
+}
+
+// PeriodSummary is the finalized energy balance of one calendar day or month,
+// emitted when the simulation crosses into the next period.
+type PeriodSummary struct {
+	Start            string  `json:"start"` // period start, RFC3339
+	GridImportKWh    float64 `json:"grid_import_kwh"`
+	GridExportKWh    float64 `json:"grid_export_kwh"`
+	ImportCostPLN    float64 `json:"import_cost_pln"`
+	ExportRevenuePLN float64 `json:"export_revenue_pln"`
+	NetCostPLN       float64 `json:"net_cost_pln"`
+	PVKWh            float64 `json:"pv_kwh"`
+}
+
+// periodAcc accumulates energy and cost for the current day or month.
+type periodAcc struct {
+	importWh, exportWh              float64
+	importCostPLN, exportRevenuePLN float64
+	pvWh                            float64
+}
+
+func (a periodAcc) summary(start time.Time) PeriodSummary {
+	return PeriodSummary{
+		Start:            start.Format(time.RFC3339),
+		GridImportKWh:    a.importWh / 1000,
+		GridExportKWh:    a.exportWh / 1000,
+		ImportCostPLN:    a.importCostPLN,
+		ExportRevenuePLN: a.exportRevenuePLN,
+		NetCostPLN:       a.importCostPLN - a.exportRevenuePLN,
+		PVKWh:            a.pvWh / 1000,
+	}
+}
+
+// EventKind identifies a notable condition detected during replay.
+type EventKind string
+
+const (
+	EventBatteryFull     EventKind = "battery_full"      // charged up to ChargeToPercent
+	EventBatteryEmpty    EventKind = "battery_empty"     // discharged down to DischargeToPercent
+	EventCurtailment     EventKind = "curtailment"       // battery started absorbing curtailed PV
+	EventAnomalyDay      EventKind = "anomaly_day"       // day's consumption far from prediction
+	EventNMCreditExpired EventKind = "nm_credit_expired" // net-metering credits aged out
+)
+
+// anomalyEventPct is the |deviation| above which a finished day raises an
+// EventAnomalyDay, matching the anomaly log's cut-off.
+const anomalyEventPct = 20
+
+// Event is a typed, timestamped annotation emitted when a condition is first
+// detected, so the UI can mark it on the timeline.
+type Event struct {
+	Kind      EventKind `json:"kind"`
+	Timestamp string    `json:"timestamp"` // RFC3339
+	Message   string    `json:"message"`
+	Value     float64   `json:"value"` // SoC %, kWh or deviation %, depending on Kind
 }
 
 // PredictionComparison holds actual vs predicted values for a single timestamp.
@@ -144,6 +297,16 @@ type HeatingMonthStat struct {
 	TempReadings   int
 }
 
+// MonthlyCost is one calendar month's grid import cost and export revenue;
+// the month in progress reports its cost so far. Amounts are rounded so the
+// months add up to the rounded summary totals.
+type MonthlyCost struct {
+	Month            string // YYYY-MM
+	ImportCostPLN    float64
+	ExportRevenuePLN float64
+	NetCostPLN       float64
+}
+
 // AnomalyDayRecord captures a day's actual vs predicted consumption deviation.
 type AnomalyDayRecord struct {
 	Date         string
@@ -177,6 +340,31 @@ type PowerQuality struct {
 	ReactivePowerVAR float64 `json:"reactive_power_var"`
 }
 
+// ApplianceCost holds spot-priced energy attributed to one appliance, in
+// total and for the current simulated month.
+type ApplianceCost struct {
+	Type         model.SensorType `json:"type"`
+	Name         string           `json:"name"`
+	KWh          float64          `json:"kwh"`
+	CostPLN      float64          `json:"cost_pln"`
+	MonthKWh     float64          `json:"month_kwh"`
+	MonthCostPLN float64          `json:"month_cost_pln"`
+}
+
+// applianceSensors are the per-appliance power plugs whose energy is costed.
+var applianceSensors = map[model.SensorType]bool{
+	model.SensorElectricKettle: true,
+	model.SensorOven:           true,
+	model.SensorWashing:        true,
+	model.SensorDrier:          true,
+	model.SensorTvMedia:        true,
+	model.SensorOlek1:          true,
+	model.SensorOlek2:          true,
+	model.SensorBeata:          true,
+	model.SensorNetwork:        true,
+	model.SensorExternal:       true,
+}
+
 // LoadShiftStats holds load shifting analysis data sent to frontend.
 type LoadShiftStats struct {
 	Heatmap         [7][24]HeatmapCell `json:"heatmap"`
@@ -211,6 +399,22 @@ type hourlySlot struct {
 	priceN    int
 }
 
+// applianceAcc accumulates energy and cost for one appliance.
+type applianceAcc struct {
+	wh, costPLN           float64
+	month                 time.Time
+	monthWh, monthCostPLN float64
+}
+
+// costMonthAcc accumulates one month's grid costs and, for the reactive
+// penalty, its grid import and reactive energy.
+type costMonthAcc struct {
+	importCostPLN    float64
+	exportRevenuePLN float64
+	importWh         float64
+	reactiveKvarh    float64
+}
+
 // heatingMonthAcc is a private accumulator for per-month heating data.
 type heatingMonthAcc struct {
 	consumptionWh float64
@@ -230,10 +434,18 @@ type Callback interface {
 	OnArbitrageDayLog(records []ArbitrageDayRecord)
 	OnPredictionComparison(comp PredictionComparison)
 	OnHeatingStats(stats []HeatingMonthStat)
+	OnMonthlyCosts(costs []MonthlyCost)
 	OnAnomalyDays(records []AnomalyDayRecord)
 	OnLoadShiftStats(stats LoadShiftStats)
 	OnHPDiagnostics(diag HPDiagnostics)
 	OnPowerQuality(pq PowerQuality)
+	OnApplianceCosts(costs []ApplianceCost)
+	OnStrategyComparison(comp StrategyComparison)
+	OnConfigComparison(comp ConfigComparison)
+	OnDailySummary(summary PeriodSummary)
+	OnMonthlySummary(summary PeriodSummary)
+	OnEvent(event Event)
+	OnFlowSankey(flow FlowSankey)
 }
 
 // Engine replays historical sensor data at configurable speed.
@@ -242,23 +454,35 @@ type Engine struct {
 	store    *store.Store
 	callback Callback
 
-	running   bool
-	speed     float64
-	simTime   time.Time
-	timeRange model.TimeRange
+	running     bool
+	speed       float64
+	simTime     time.Time
+	timeRange   model.TimeRange
+	endBehavior EndBehavior
 
 	// Battery simulation (nil when disabled)
 	battery    *Battery
 	altBattery *Battery // arbitrage shadow (nil when battery disabled)
+	hybBattery *Battery // hybrid shadow (nil when battery disabled)
 
 	// Arbitrage cost tracking
 	arbGridImportWh, arbGridExportWh             float64
 	arbGridImportCostPLN, arbGridExportRevenuePLN float64
 
+	// Hybrid cost tracking
+	hybGridImportCostPLN, hybGridExportRevenuePLN float64
+
+	// Comparison battery (nil unless set by SetCompareBattery)
+	cmpBattery                                    *Battery
+	cmpStrategy                                   string
+	cmpGridImportCostPLN, cmpGridExportRevenuePLN float64
+
 	// Price threshold cache (per day)
 	arbThresholdDay  time.Time
 	arbLowThreshold  float64
 	arbHighThreshold float64
+	// Daily price percentiles the thresholds sit at (default 33/67)
+	arbLowPct, arbHighPct int
 
 	// Arbitrage day log tracking
 	arbitrageDayRecords                                            []ArbitrageDayRecord
@@ -269,11 +493,13 @@ type Engine struct {
 	arbitrageDayDischargeStart, arbitrageDayDischargeEnd           string
 	arbitrageDayStartThroughputWh                                  float64
 	arbitrageDayStartRawNetCost, arbitrageDayStartArbNetCost       float64
+	arbitrageDayLowPrice, arbitrageDayHighPrice                    float64
 
 	// Prediction mode
-	predictionMode bool
-	prediction     *PredictionProvider
-	savedTimeRange model.TimeRange
+	predictionMode    bool
+	predictionCatchUp bool // replay history, then hand off to prediction
+	prediction        *PredictionProvider
+	savedTimeRange    model.TimeRange
 
 	// Temperature sensor (for prediction comparison)
 	tempSensorID string
@@ -286,27 +512,88 @@ type Engine struct {
 	monthWh      float64
 	totalWh      float64
 
+	// Per-day and per-month rollups, emitted on period boundaries
+	dayAcc, monthAcc              periodAcc
+	pendingDaily, pendingMonthly []PeriodSummary
+	// Hourly energy flow (sankey) accumulation
+	flowLastTime, flowHour     time.Time
+	flowLastGridW, flowLastPVW float64
+	flowHourAcc, flowTotal     FlowEdges
+	pendingFlows               []FlowSankey
+
+	// Replay events, emitted with the next summary broadcast
+	pendingEvents []Event
+	batteryLimit  int  // 1 = at ceiling, -1 = at floor, 0 = in between
+	curtailing    bool // battery absorbed curtailed PV in the last interval
+
+	// Interval audit CSV (nil = disabled)
+	audit        *csv.Writer
+	auditPending auditInterval
+	auditCost    MoneyRounder
+
+	// Decimal places of kWh figures in summaries; money is always grosze
+	kwhDecimals                int
+	currency                   string
+	dayRounding, monthRounding periodRounding
+
 	// Per-source energy tracking (Wh)
 	pvWh, heatPumpWh, heatPumpProdWh float64
+
+	// Cumulative counter increases, by sensor type
+	counterTotals map[model.SensorType]float64
+
+	// Appliance load shifting: shiftAppliance's energy in the daily window
+	// [shiftStartH, shiftEndH) is re-priced at the window's cheapest hour.
+	// An end at or before the start wraps past midnight.
+	shiftAppliance  model.SensorType // "" = disabled
+	shiftStartH     int
+	shiftEndH       int
+	shiftDay        time.Time // window start shiftBestPrice was found for
+	shiftBestPrice  float64
+	shiftSavingsPLN float64
+
+	// Per-appliance spot-priced cost attribution
+	applianceCosts map[model.SensorType]*applianceAcc
+	applianceDirty bool
 	heatPumpCostPLN                  float64
 	gridImportWh, gridExportWh       float64
 	rawGridImportWh, rawGridExportWh float64 // before battery adjustment
+	// Grid interval bookkeeping for CheckBalance
+	gridHours float64
+	// Grid-integrated minus battery-accounted battery energy, see trackBatteryEdge
+	batteryEdgeWh float64
+	// Three-phase installs: per-phase grid energy and imbalance
+	hasPhases                                                 bool
+	phaseIDs                                                  [3]string
+	phaseImportWh, phaseExportWh                              [3]float64
+	phaseImbalanceWh, phaseImbalanceHours, phaseImbalanceMaxW float64
 
 	// Energy cost tracking (PLN)
 	priceSensorID                                string
 	gridImportCostPLN, gridExportRevenuePLN      float64
 	rawGridImportCostPLN, rawGridExportRevenuePLN float64
 
-	// Export coefficient (0-1, default 0.8)
-	exportCoefficient float64
+	// Export coefficient (0-1, default 0.8), optionally per calendar month
+	exportCoefficient        float64
+	exportCoefficientByMonth []float64 // indexed by month-1; nil = scalar
 
 	// Price threshold and cheap export tracking
-	priceThresholdPLN                    float64
-	cheapExportWh, cheapExportRevenuePLN float64
-	currentSpotPrice                     float64
+	priceThresholdPLN                       float64
+	// Cheap export as the day's price percentile instead (0 = fixed threshold)
+	cheapExportPct                          int
+	cheapThresholdDay                       time.Time
+	cheapThresholdPLN                       float64
+	cheapExportWh, cheapExportRevenuePLN    float64
+	negativeExportWh, negativeExportCostPLN float64 // export at price < 0
+	currentSpotPrice                        float64
+
+	// Reactive energy penalty
+	tanPhiLimit      float64 // default 0.4
+	reactivePricePLN float64 // PLN/kvarh, default 0.65
 
 	// Net metering simulation
 	fixedTariffPLN    float64 // default 0.65
+	touTariff         *TOUTariff // replaces fixedTariffPLN for imports when set
 	distributionFeePLN float64 // default 0.20
 	netMeteringRatio  float64 // default 0.8
 	nmCreditBuckets   [12]float64   // rolling 12-month credit bank (kWh), indexed by month%12
@@ -321,6 +608,9 @@ type Engine struct {
 	nbDepositUsedPLN   float64 // total deposit consumed
 	nbExportValuedPLN  float64 // total export valued at RCEm
 
+	// Net metering vs net billing cost per month, keyed "2006-01"
+	schemeMonths map[string]*SchemeMonth
+
 	// RCEm cache (monthly average spot price)
 	nbRCEmMonth time.Time
 	nbRCEmValue float64
@@ -329,22 +619,55 @@ type Engine struct {
 	heatingMonths     map[string]*heatingMonthAcc
 	heatingMonthOrder []string
 
+	// Per-month grid cost accumulators (keyed by "YYYY-MM")
+	costMonths      map[string]*costMonthAcc
+	costMonthOrder  []string
+	costMonthsDirty bool
+
 	// Pre-heating thermal model (shadow, like arbitrage battery)
 	thermal        *ThermalModel
 	preHeatCostPLN float64
 	insulationLevel InsulationLevel
+	comfortMinC     float64
+	comfortMaxC     float64
+	hpMinOnTime     time.Duration
+	hpMinOffTime    time.Duration
+	copCurve        []COPPoint // nil = COP 1 without measured production
+
+	// Per-sensor-type integration method overrides (catalog default otherwise)
+	integration map[model.SensorType]model.IntegrationMethod
+
+	// Thermal model validation against a measured indoor temperature
+	indoorSensorID    string
+	thermalCheck      *ThermalModel
+	thermalSqErrSum   float64
+	thermalErrSamples int
 
 	// Load shift hourly tracking
 	dayOfWeekHourly [7][24]hourlySlot
 	overallPriceSum float64
 	overallPriceN   int
 	loadShiftDirty  bool
+	loadShiftWindow int // hours, see SetLoadShiftWindow
+
+	// Constant must-run load added to grid power (W, negative removes load)
+	mustRunW  float64
+	mustRunWh float64 // energy actually added, integrated per grid interval
+	// First PV power and grid voltage sensors, resolved at Init and Seek
+	// so the replay does not scan the store per reading ("" = none)
+	pvSensorID    string
+	gridVoltageID string
+
+	// Sensor types streamed through OnReading, nil = all (SetEmittedSensorTypes)
+	emittedTypes map[model.SensorType]bool
 
 	// Custom PV configuration
 	pvCustomEnabled bool
 	pvBaseProfile   *solar.PVProfile
 	pvArrays        []PVArrayConfig
 	pvArrayWh       []float64 // per-array production accumulators
+	// Linear panel output loss per year since timeRange.Start (percent)
+	pvDegradationPctPerYear float64
 
 	// HP diagnostics snapshot values
 	hpDiagCOP             float64
@@ -370,6 +693,7 @@ type Engine struct {
 	// Anomaly tracking (per-day during historical replay with prediction)
 	anomalyDays           []AnomalyDayRecord
 	anomalyCurrentDay     string
+	anomalyDayStart       time.Time // midnight of anomalyCurrentDay in the data's zone
 	anomalyActualWh       float64
 	anomalyPredictedWh    float64
 	anomalyTempSum        float64
@@ -380,7 +704,10 @@ type Engine struct {
 	anomalyLastPredictedW float64
 	anomalyHasLastGrid    bool
 
-	stopCh chan struct{}
+	stopCh       chan struct{}
+	loopDone     chan struct{} // closed when the current loop goroutine exits
+	tickInterval time.Duration
+	ticker       *time.Ticker // ticker of the running loop, nil when stopped
 }
 
 func New(s *store.Store, cb Callback) *Engine {
@@ -388,16 +715,78 @@ func New(s *store.Store, cb Callback) *Engine {
 		store:              s,
 		callback:           cb,
 		speed:              3600,
+		tickInterval:       defaultTickInterval,
+		endBehavior:        EndStop,
 		exportCoefficient:  0.8,
 		priceThresholdPLN:  0.1,
 		fixedTariffPLN:     0.65,
 		distributionFeePLN: 0.20,
 		netMeteringRatio:   0.8,
+		tanPhiLimit:        0.4,
+		reactivePricePLN:   0.65,
+		kwhDecimals:        defaultKWhDecimals,
+		arbLowPct:          defaultArbLowPct,
+		arbHighPct:         defaultArbHighPct,
+		loadShiftWindow:    DefaultLoadShiftWindowH,
+		comfortMinC:        DefaultComfortMinC,
+		comfortMaxC:        DefaultComfortMaxC,
+		currency:           defaultCurrency,
 		lastReadings:       make(map[string]model.Reading),
 		heatingMonths:      make(map[string]*heatingMonthAcc),
+		costMonths:         make(map[string]*costMonthAcc),
 	}
 }
 
+// cloneConfigLocked returns a fresh engine on the same store with e's
+// configuration (sensors, tariffs, batteries, thermal and PV settings) and
+// none of its replay state. Fields set through a Set* method belong here.
+// Must be called with mu held.
+func (e *Engine) cloneConfigLocked(cb Callback) *Engine {
+	c := New(e.store, cb)
+	c.priceSensorID = e.priceSensorID
+	c.tempSensorID = e.tempSensorID
+	c.indoorSensorID = e.indoorSensorID
+	c.phaseIDs, c.hasPhases = e.phaseIDs, e.hasPhases
+	c.pvSensorID, c.gridVoltageID = e.pvSensorID, e.gridVoltageID
+	c.kwhDecimals = e.kwhDecimals
+	c.currency = e.currency
+	c.exportCoefficient = e.exportCoefficient
+	c.exportCoefficientByMonth = e.exportCoefficientByMonth
+	c.priceThresholdPLN = e.priceThresholdPLN
+	c.cheapExportPct = e.cheapExportPct
+	c.arbLowPct, c.arbHighPct = e.arbLowPct, e.arbHighPct
+	c.tanPhiLimit = e.tanPhiLimit
+	c.reactivePricePLN = e.reactivePricePLN
+	c.fixedTariffPLN = e.fixedTariffPLN
+	c.touTariff = e.touTariff
+	c.distributionFeePLN = e.distributionFeePLN
+	c.netMeteringRatio = e.netMeteringRatio
+	c.shiftAppliance = e.shiftAppliance
+	c.shiftStartH, c.shiftEndH = e.shiftStartH, e.shiftEndH
+	c.insulationLevel = e.insulationLevel
+	c.comfortMinC, c.comfortMaxC = e.comfortMinC, e.comfortMaxC
+	c.hpMinOnTime, c.hpMinOffTime = e.hpMinOnTime, e.hpMinOffTime
+	c.copCurve = e.copCurve
+	c.integration = maps.Clone(e.integration)
+	c.loadShiftWindow = e.loadShiftWindow
+	c.mustRunW = e.mustRunW
+	c.emittedTypes = e.emittedTypes
+	c.pvCustomEnabled = e.pvCustomEnabled
+	c.pvBaseProfile = e.pvBaseProfile
+	c.pvArrays = e.pvArrays
+	c.pvArrayWh = make([]float64, len(e.pvArrays))
+	c.pvDegradationPctPerYear = e.pvDegradationPctPerYear
+	if e.battery != nil {
+		cfg := e.battery.config
+		c.battery, c.altBattery, c.hybBattery = NewBattery(cfg), NewBattery(cfg), NewBattery(cfg)
+	}
+	if e.cmpBattery != nil {
+		c.cmpBattery = NewBattery(e.cmpBattery.config)
+		c.cmpStrategy = e.cmpStrategy
+	}
+	return c
+}
+
 // SetExportCoefficient sets the export revenue multiplier (0-1).
 func (e *Engine) SetExportCoefficient(c float64) {
 	e.mu.Lock()
@@ -405,6 +794,38 @@ func (e *Engine) SetExportCoefficient(c float64) {
 	e.mu.Unlock()
 }
 
+// SetMonthlyExportCoefficients sets a per-month export revenue multiplier,
+// indexed January..December, overriding the scalar coefficient. Anything
+// other than 12 values reverts to the scalar.
+func (e *Engine) SetMonthlyExportCoefficients(coeffs []float64) {
+	e.mu.Lock()
+	if len(coeffs) == 12 {
+		e.exportCoefficientByMonth = append([]float64(nil), coeffs...)
+	} else {
+		e.exportCoefficientByMonth = nil
+	}
+	e.mu.Unlock()
+}
+
+// exportCoefficientAt returns the export revenue multiplier for t.
+// Must be called with mu held.
+func (e *Engine) exportCoefficientAt(t time.Time) float64 {
+	if e.exportCoefficientByMonth != nil {
+		return e.exportCoefficientByMonth[t.Month()-1]
+	}
+	return e.exportCoefficient
+}
+
+// exportRevenue returns the revenue for exporting wh at price. The export
+// coefficient discounts positive revenue only: at a negative price the full
+// price is charged for the exported energy. Must be called with mu held.
+func (e *Engine) exportRevenue(wh, price float64, t time.Time) float64 {
+	if price < 0 {
+		return (wh / 1000) * price
+	}
+	return (wh / 1000) * price * e.exportCoefficientAt(t)
+}
+
 // SetPriceThreshold sets the PLN threshold for cheap export tracking.
 func (e *Engine) SetPriceThreshold(t float64) {
 	e.mu.Lock()
@@ -412,6 +833,38 @@ func (e *Engine) SetPriceThreshold(t float64) {
 	e.mu.Unlock()
 }
 
+// SetCheapExportPercentile flags export as cheap below the given percentile
+// (1–99) of each day's prices instead of the fixed PLN threshold, so the
+// definition follows seasonal price levels. 0 restores the fixed threshold.
+func (e *Engine) SetCheapExportPercentile(pct int) {
+	if pct < 0 || pct > 99 {
+		return
+	}
+	e.mu.Lock()
+	e.cheapExportPct = pct
+	e.cheapThresholdDay = time.Time{}
+	e.mu.Unlock()
+}
+
+// cheapExportThreshold returns the price below which export at t counts as
+// cheap: the fixed threshold, or the day's percentile when configured. Falls
+// back to the fixed threshold on days without prices.
+// Must be called with mu held.
+func (e *Engine) cheapExportThreshold(t time.Time) float64 {
+	if e.cheapExportPct == 0 || e.priceSensorID == "" {
+		return e.priceThresholdPLN
+	}
+	day := startOfDay(t)
+	if !day.Equal(e.cheapThresholdDay) {
+		e.cheapThresholdDay = day
+		e.cheapThresholdPLN = e.priceThresholdPLN
+		if prices := e.dayPrices(e.priceSensorID, day); len(prices) > 0 {
+			e.cheapThresholdPLN, _ = PriceThresholdsAt(prices, e.cheapExportPct, e.cheapExportPct)
+		}
+	}
+	return e.cheapThresholdPLN
+}
+
 // SetFixedTariff sets the fixed tariff rate for net metering/billing (PLN/kWh).
 func (e *Engine) SetFixedTariff(v float64) {
 	e.mu.Lock()
@@ -419,6 +872,22 @@ func (e *Engine) SetFixedTariff(v float64) {
 	e.mu.Unlock()
 }
 
+// SetTOUTariff bills net metering/billing imports by a time-of-use tariff
+// instead of the fixed rate; nil goes back to the fixed tariff.
+func (e *Engine) SetTOUTariff(t *TOUTariff) {
+	e.mu.Lock()
+	e.touTariff = t
+	e.mu.Unlock()
+}
+
+// importTariffLocked returns the import price per kWh at t. Must be called with mu held.
+func (e *Engine) importTariffLocked(t time.Time) float64 {
+	if e.touTariff != nil {
+		return e.touTariff.RateAt(t)
+	}
+	return e.fixedTariffPLN
+}
+
 // SetDistributionFee sets the distribution fee for net metering (PLN/kWh).
 func (e *Engine) SetDistributionFee(v float64) {
 	e.mu.Lock()
@@ -426,6 +895,99 @@ func (e *Engine) SetDistributionFee(v float64) {
 	e.mu.Unlock()
 }
 
+// SetTanPhiLimit sets the reactive-to-active energy ratio (tan φ) allowed
+// before reactive energy is penalized.
+func (e *Engine) SetTanPhiLimit(v float64) {
+	e.mu.Lock()
+	e.tanPhiLimit = v
+	e.mu.Unlock()
+}
+
+// SetReactivePrice sets the charge for reactive energy beyond the tan φ
+// limit (PLN/kvarh).
+func (e *Engine) SetReactivePrice(v float64) {
+	e.mu.Lock()
+	e.reactivePricePLN = v
+	e.mu.Unlock()
+}
+
+// reactivePenalty returns the charge for reactive energy exceeding
+// tanPhiLimit × grid import so far. Like the operator's bill it is settled
+// per month, so a compliant month does not offset an excessive one. Zero
+// without a reactive energy sensor. Must be called with mu held.
+func (e *Engine) reactivePenalty() float64 {
+	if _, ok := e.counterTotals[model.SensorGridEnergyReactive]; !ok {
+		return 0
+	}
+	var penalty float64
+	for _, acc := range e.costMonths {
+		excess := acc.reactiveKvarh - e.tanPhiLimit*acc.importWh/1000
+		if excess > 0 {
+			penalty += excess * e.reactivePricePLN
+		}
+	}
+	return penalty
+}
+
+// SetApplianceShift simulates moving appliance st's energy within the daily
+// hour window [startH, endH) to that window's cheapest hour and reports the
+// realized savings. An endH at or before startH wraps past midnight (22, 6
+// is 22:00–06:00 the next day; equal hours span a whole day). An empty st
+// disables shifting.
+func (e *Engine) SetApplianceShift(st model.SensorType, startH, endH int) {
+	startH = max(0, min(startH, 23))
+	endH = max(0, min(endH, 24))
+	e.mu.Lock()
+	e.shiftAppliance = st
+	e.shiftStartH = startH
+	e.shiftEndH = endH
+	e.shiftDay = time.Time{}
+	e.mu.Unlock()
+}
+
+// SetKWhDecimals sets the decimal places energy figures in summaries are
+// rounded to (default 3); negative disables kWh rounding. Money is always
+// rounded to grosze.
+func (e *Engine) SetKWhDecimals(n int) {
+	e.mu.Lock()
+	e.kwhDecimals = n
+	e.mu.Unlock()
+}
+
+// defaultCurrency labels summaries until SetCurrency; the bundled price data
+// is in PLN.
+const defaultCurrency = "PLN"
+
+// SetCurrency sets the currency label reported with summaries. Prices and
+// costs are taken as-is from the data; no conversion is applied.
+func (e *Engine) SetCurrency(currency string) {
+	e.mu.Lock()
+	e.currency = currency
+	e.mu.Unlock()
+}
+
+// SetIntegrationMethod overrides how readings of st are integrated into
+// energy, e.g. model.IntegrateStep for appliances that hold a value between
+// samples.
+func (e *Engine) SetIntegrationMethod(st model.SensorType, m model.IntegrationMethod) {
+	e.mu.Lock()
+	if e.integration == nil {
+		e.integration = make(map[model.SensorType]model.IntegrationMethod)
+	}
+	e.integration[st] = m
+	e.mu.Unlock()
+}
+
+// intervalAverage returns the average power of st between two readings using
+// its integration method. Must be called with mu held.
+func (e *Engine) intervalAverage(st model.SensorType, prev, cur float64) float64 {
+	m, ok := e.integration[st]
+	if !ok {
+		m = model.IntegrationFor(st)
+	}
+	return model.IntervalAverage(m, prev, cur)
+}
+
 // SetNetMeteringRatio sets the credit ratio for net metering (e.g. 0.8 for 1:0.8).
 func (e *Engine) SetNetMeteringRatio(v float64) {
 	e.mu.Lock()
@@ -441,9 +1003,120 @@ func (e *Engine) SetInsulationLevel(level InsulationLevel) {
 		e.thermal.HeatLossWC = HeatLossForInsulation(level)
 		e.thermal.Insulation = level
 	}
+	if e.thermalCheck != nil {
+		e.thermalCheck.HeatLossWC = HeatLossForInsulation(level)
+		e.thermalCheck.Insulation = level
+	}
+	e.mu.Unlock()
+}
+
+// SetComfortBand sets the indoor temperature band for the pre-heating
+// simulation. A zero bound restores its default (DefaultComfortMinC,
+// DefaultComfortMaxC), so 0, 0 resets the band; a band with min above max
+// is ignored.
+func (e *Engine) SetComfortBand(minC, maxC float64) {
+	minC, maxC, ok := ComfortBand(minC, maxC)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	e.comfortMinC = minC
+	e.comfortMaxC = maxC
+	if e.thermal != nil {
+		e.thermal.SetComfortBand(minC, maxC)
+	}
 	e.mu.Unlock()
 }
 
+// SetHeatPumpMinRunTimes sets the pre-heating simulation's anti-cycling
+// limits (minimum on and off time); zero disables a limit.
+func (e *Engine) SetHeatPumpMinRunTimes(minOn, minOff time.Duration) {
+	e.mu.Lock()
+	e.hpMinOnTime = minOn
+	e.hpMinOffTime = minOff
+	if e.thermal != nil {
+		e.thermal.SetMinRunTimes(minOn, minOff)
+	}
+	e.mu.Unlock()
+}
+
+// HeatPumpMinRunTimes returns the pre-heating simulation's anti-cycling
+// limits set by SetHeatPumpMinRunTimes.
+func (e *Engine) HeatPumpMinRunTimes() (minOn, minOff time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.hpMinOnTime, e.hpMinOffTime
+}
+
+// SetCOPCurve sets the outdoor temperature → COP curve the pre-heating and
+// validation thermal models use when no heat pump production data gives a
+// measured COP. An empty curve restores a flat COP of 1; curves with a
+// non-positive COP are ignored.
+func (e *Engine) SetCOPCurve(points []COPPoint) {
+	for _, p := range points {
+		if p.COP <= 0 {
+			return
+		}
+	}
+	if len(points) == 0 {
+		points = nil
+	}
+	e.mu.Lock()
+	e.copCurve = points
+	if e.thermal != nil {
+		e.thermal.SetCOPCurve(points)
+	}
+	if e.thermalCheck != nil {
+		e.thermalCheck.SetCOPCurve(points)
+	}
+	e.mu.Unlock()
+}
+
+// SetMustRunLoad sets a constant must-run load (W) added to every grid power
+// reading before the battery and the energy accounting see it, e.g. a
+// planned always-on appliance. A negative value removes measured load, at
+// most down to zero home demand. The added energy is reported as
+// Summary.MustRunKWh and counted in full by the off-grid coverage.
+func (e *Engine) SetMustRunLoad(w float64) {
+	e.mu.Lock()
+	e.mustRunW = w
+	e.mu.Unlock()
+}
+
+// withMustRun returns grid power gridW at t with the must-run load applied.
+// Removing load never takes the home demand (grid + PV) below zero.
+// Must be called with mu held.
+func (e *Engine) withMustRun(gridW float64, t time.Time) float64 {
+	if e.mustRunW >= 0 {
+		return gridW + e.mustRunW
+	}
+	var pvW float64
+	if e.pvSensorID != "" {
+		if r, ok := e.store.ReadingAt(e.pvSensorID, t); ok {
+			pvW = r.Value
+		}
+	}
+	return min(gridW, max(gridW+e.mustRunW, -pvW))
+}
+
+// applyMustRun applies the must-run load to grid reading r and integrates
+// the load added since the previous grid reading into mustRunWh, so a load
+// changed mid-run only counts from the change on. Must be called with mu held.
+func (e *Engine) applyMustRun(r *model.Reading) {
+	added := *r
+	added.Value = 0
+	if e.mustRunW != 0 {
+		r.Value = e.withMustRun(r.Value, r.Timestamp)
+		added.Value = max(0, e.mustRunW)
+	}
+	key := r.SensorID + ":mustrun"
+	if last, ok := e.lastReadings[key]; ok {
+		hours := r.Timestamp.Sub(last.Timestamp).Hours()
+		e.mustRunWh += e.intervalAverage(r.Type, last.Value, added.Value) * hours
+	}
+	e.lastReadings[key] = added
+}
+
 // SetPVConfig configures custom PV arrays.
 func (e *Engine) SetPVConfig(enabled bool, arrays []PVArrayConfig) {
 	e.mu.Lock()
@@ -458,6 +1131,25 @@ func (e *Engine) SetPVConfig(enabled bool, arrays []PVArrayConfig) {
 	e.mu.Unlock()
 }
 
+// SetPVDegradation sets the yearly loss of custom PV output in percent
+// (typically ~0.5), applied linearly from the start of the time range.
+// 0 (the default) keeps output constant.
+func (e *Engine) SetPVDegradation(pctPerYear float64) {
+	e.mu.Lock()
+	e.pvDegradationPctPerYear = pctPerYear
+	e.mu.Unlock()
+}
+
+// pvDegradationFactor returns the fraction of nameplate output left at t.
+// Must be called with mu held.
+func (e *Engine) pvDegradationFactor(t time.Time) float64 {
+	if e.pvDegradationPctPerYear <= 0 || !t.After(e.timeRange.Start) {
+		return 1
+	}
+	years := t.Sub(e.timeRange.Start).Hours() / (24 * 365.25)
+	return max(0, 1-e.pvDegradationPctPerYear/100*years)
+}
+
 // buildPVBaseProfile derives a PV generation profile from stored data.
 // Must be called with mu held.
 func (e *Engine) buildPVBaseProfile() {
@@ -495,6 +1187,7 @@ func (e *Engine) computeCustomPV(t time.Time) (float64, []float64) {
 
 	hour := float64(t.Hour()) + float64(t.Minute())/60.0
 	baseAzimuth := 90.0 // original east-facing installation
+	degradation := e.pvDegradationFactor(t)
 
 	var total float64
 	perArray := make([]float64, len(e.pvArrays))
@@ -503,13 +1196,100 @@ func (e *Engine) computeCustomPV(t time.Time) (float64, []float64) {
 			continue
 		}
 		oriented := solar.GenerateOrientedProfile(*e.pvBaseProfile, arr.Azimuth, arr.Tilt, baseAzimuth)
-		power := oriented.PowerAt(hour, arr.PeakWp)
+		power := oriented.PowerAt(hour, arr.PeakWp) * degradation
 		perArray[i] = power
 		total += power
 	}
 	return total, perArray
 }
 
+// OptimizePVOrientation grid-searches azimuth/tilt for an array of peakWp
+// against the stored PV profile. Returns false when no PV data is available.
+func (e *Engine) OptimizePVOrientation(objective solar.OrientationObjective, peakWp float64) (solar.OrientationResult, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pvBaseProfile == nil {
+		e.buildPVBaseProfile()
+	}
+	if e.pvBaseProfile == nil {
+		return solar.OrientationResult{}, false
+	}
+	if peakWp <= 0 {
+		peakWp = e.pvBaseProfile.PeakWp
+	}
+
+	search := solar.DefaultOrientationSearch(objective, peakWp, 90)
+	search.DemandW = e.averageHourlyDemand()
+	return solar.OptimizeOrientation(*e.pvBaseProfile, search), true
+}
+
+// averageHourlyDemand returns the mean home demand per hour of day over the
+// simulated time range. Demand = grid + historical PV.
+// Must be called with mu held.
+func (e *Engine) averageHourlyDemand() [24]float64 {
+	var demand [24]float64
+	for _, sensor := range e.store.Sensors() {
+		if sensor.Type != model.SensorGridPower && sensor.Type != model.SensorPVPower {
+			continue
+		}
+		var sum [24]float64
+		var count [24]int
+		for _, r := range e.store.ReadingsInRange(sensor.ID, e.timeRange.Start, e.timeRange.End) {
+			h := r.Timestamp.Hour()
+			sum[h] += r.Value
+			count[h]++
+		}
+		for h := 0; h < 24; h++ {
+			if count[h] > 0 {
+				demand[h] += sum[h] / float64(count[h])
+			}
+		}
+	}
+	for h := 0; h < 24; h++ {
+		if demand[h] < 0 {
+			demand[h] = 0
+		}
+	}
+	return demand
+}
+
+// Load shift window bounds in hours, see SetLoadShiftWindow.
+const (
+	DefaultLoadShiftWindowH = 4
+	MaxLoadShiftWindowH     = 12
+)
+
+// SetLoadShiftWindow sets how many hours (0–MaxLoadShiftWindowH) heat pump
+// consumption may move either way when the load shift stats look for the
+// cheapest hour. Out-of-range values are ignored.
+func (e *Engine) SetLoadShiftWindow(hours int) {
+	if hours < 0 || hours > MaxLoadShiftWindowH {
+		return
+	}
+	e.mu.Lock()
+	e.loadShiftWindow = hours
+	e.loadShiftDirty = true
+	e.mu.Unlock()
+}
+
+// SetEmittedSensorTypes limits the readings streamed through OnReading to
+// the given sensor types, e.g. only grid, PV and battery for a focused view.
+// Energy, cost and battery accounting still use every sensor. An empty list
+// streams all types again.
+func (e *Engine) SetEmittedSensorTypes(types []model.SensorType) {
+	var emitted map[model.SensorType]bool
+	if len(types) > 0 {
+		emitted = make(map[model.SensorType]bool, len(types))
+		for _, t := range types {
+			emitted[t] = true
+		}
+	}
+	e.mu.Lock()
+	e.emittedTypes = emitted
+	e.mu.Unlock()
+}
+
 // SetTempOffset sets the temperature offset for NN prediction.
 func (e *Engine) SetTempOffset(offset float64) {
 	e.mu.Lock()
@@ -519,15 +1299,31 @@ func (e *Engine) SetTempOffset(offset float64) {
 	e.mu.Unlock()
 }
 
+// SetAwayMode sets the NN prediction's away-mode overlay, see
+// PredictionProvider.SetAwayMode.
+func (e *Engine) SetAwayMode(start, end time.Time, factor float64) {
+	e.mu.Lock()
+	if e.prediction != nil {
+		e.prediction.SetAwayMode(start, end, factor)
+	}
+	e.mu.Unlock()
+}
+
 // Init sets up the engine with the store's time range.
 func (e *Engine) Init() bool {
 	tr, ok := e.store.GlobalTimeRange()
 	if !ok {
 		return false
 	}
+	// Three-phase meters: the loader sums the phases into grid_power for
+	// energy and costs (SumGridPhases); the phases give the imbalance.
+	phaseIDs, hasPhases := phaseSensorIDs(e.store)
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.phaseIDs, e.hasPhases = phaseIDs, hasPhases
+	e.resolveSensorIDs()
 	e.timeRange = tr
 	e.simTime = tr.Start
 	e.dayStart = startOfDay(tr.Start)
@@ -560,10 +1356,12 @@ func (e *Engine) Start() {
 	}
 	e.running = true
 	e.stopCh = make(chan struct{})
+	e.loopDone = make(chan struct{})
+	stopCh, done := e.stopCh, e.loopDone
 	e.mu.Unlock()
 
 	e.broadcastState()
-	go e.loop()
+	go e.loop(stopCh, done)
 }
 
 // Pause stops the simulation loop.
@@ -580,6 +1378,27 @@ func (e *Engine) Pause() {
 	e.broadcastState()
 }
 
+// Stop halts the simulation loop and waits for its goroutine to exit.
+// Safe to call when the engine is not running.
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	wasRunning := e.running
+	if e.running {
+		e.running = false
+		close(e.stopCh)
+	}
+	done := e.loopDone
+	e.loopDone = nil
+	e.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	if wasRunning {
+		e.broadcastState()
+	}
+}
+
 // SetSpeed sets the simulation speed multiplier.
 func (e *Engine) SetSpeed(speed float64) {
 	if speed < 0.1 {
@@ -596,15 +1415,58 @@ func (e *Engine) SetSpeed(speed float64) {
 	e.broadcastState()
 }
 
+// SetTickInterval sets how often the loop advances and broadcasts, clamped to
+// minTickInterval. Simulated time per tick scales with it, so the replay
+// speed is unchanged. Takes effect immediately when running.
+func (e *Engine) SetTickInterval(d time.Duration) {
+	if d < minTickInterval {
+		d = minTickInterval
+	}
+
+	e.mu.Lock()
+	e.tickInterval = d
+	if e.ticker != nil {
+		e.ticker.Reset(d)
+	}
+	e.mu.Unlock()
+}
+
+// SetEndBehavior sets what the replay does at the end of its time range.
+// Unknown values are ignored.
+func (e *Engine) SetEndBehavior(b EndBehavior) {
+	if _, err := ParseEndBehavior(string(b)); err != nil {
+		return
+	}
+	e.mu.Lock()
+	e.endBehavior = b
+	e.mu.Unlock()
+}
+
+// SetSpeedToFinishIn sets the speed so the remaining time range replays in
+// roughly d of wall-clock time. Returns the applied (clamped) speed.
+func (e *Engine) SetSpeedToFinishIn(d time.Duration) float64 {
+	if d <= 0 {
+		return e.State().Speed
+	}
+	e.mu.Lock()
+	remaining := e.timeRange.End.Sub(e.simTime)
+	e.mu.Unlock()
+
+	e.SetSpeed(float64(remaining) / float64(d))
+	return e.State().Speed
+}
+
 // SetBattery configures the battery simulation. Pass nil to disable.
 func (e *Engine) SetBattery(cfg *BatteryConfig) {
 	e.mu.Lock()
 	if cfg == nil {
 		e.battery = nil
 		e.altBattery = nil
+		e.hybBattery = nil
 	} else {
 		e.battery = NewBattery(*cfg)
 		e.altBattery = NewBattery(*cfg)
+		e.hybBattery = NewBattery(*cfg)
 	}
 	e.mu.Unlock()
 }
@@ -629,12 +1491,10 @@ func (e *Engine) SetPredictionMode(enabled bool) {
 		e.predictionMode = true
 		now := time.Now().UTC()
 		e.simTime = now
-		e.timeRange = model.TimeRange{
-			Start: now,
-			End:   time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC),
-		}
+		e.timeRange = model.TimeRange{Start: now, End: predictionHorizonEnd}
 		e.resetAccumulators()
 		if e.prediction != nil {
+			e.prediction.CalibrateAnomaly(e.recentTempReadings())
 			e.prediction.Init(now)
 		}
 	} else {
@@ -649,6 +1509,48 @@ func (e *Engine) SetPredictionMode(enabled bool) {
 	e.broadcastSummary()
 }
 
+// predictionHorizonEnd is the open-ended time range end used in prediction mode.
+var predictionHorizonEnd = time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SetPredictionCatchUp enables a continuous "past + forecast" replay: when
+// replay reaches the latest available reading it switches into prediction
+// mode from that point instead of ending, keeping battery SoC and all
+// accumulators. Requires a prediction provider.
+func (e *Engine) SetPredictionCatchUp(enabled bool) {
+	e.mu.Lock()
+	e.predictionCatchUp = enabled
+	e.mu.Unlock()
+}
+
+// handoffToPrediction switches a replay that reached the end of data into
+// prediction mode at the current sim time without resetting anything.
+// Returns false when catch-up is off or not possible. Must be called with
+// mu held.
+func (e *Engine) handoffToPrediction() bool {
+	if !e.predictionCatchUp || e.predictionMode || e.prediction == nil {
+		return false
+	}
+	e.savedTimeRange = e.timeRange
+	e.predictionMode = true
+	e.timeRange.End = predictionHorizonEnd
+	e.prediction.CalibrateAnomaly(e.recentTempReadings())
+	e.prediction.Init(e.simTime)
+	return true
+}
+
+// recentTempReadings returns the last anomalyCalibrationWindow of actual
+// temperature readings. Must be called with mu held.
+func (e *Engine) recentTempReadings() []model.Reading {
+	if e.tempSensorID == "" {
+		return nil
+	}
+	tr, ok := e.store.TimeRange(e.tempSensorID)
+	if !ok {
+		return nil
+	}
+	return e.store.ReadingsInRange(e.tempSensorID, tr.End.Add(-anomalyCalibrationWindow), tr.End.Add(time.Nanosecond))
+}
+
 // SetPriceSensor configures the sensor used for spot price lookups.
 func (e *Engine) SetPriceSensor(sensorID string) {
 	e.mu.Lock()
@@ -663,6 +1565,15 @@ func (e *Engine) SetTempSensor(sensorID string) {
 	e.mu.Unlock()
 }
 
+// SetIndoorTempSensor configures a measured indoor temperature sensor. When
+// set, a thermal model driven by the actual heat pump power is validated
+// against it and the RMSE is reported in the summary.
+func (e *Engine) SetIndoorTempSensor(sensorID string) {
+	e.mu.Lock()
+	e.indoorSensorID = sensorID
+	e.mu.Unlock()
+}
+
 // spotPrice returns the spot price at the given time. Must be called with mu held.
 func (e *Engine) spotPrice(t time.Time) float64 {
 	if e.priceSensorID == "" {
@@ -689,7 +1600,28 @@ func (e *Engine) resetAccumulators() {
 	e.todayWh = 0
 	e.monthWh = 0
 	e.totalWh = 0
+	e.dayAcc = periodAcc{}
+	e.monthAcc = periodAcc{}
+	e.dayRounding = periodRounding{}
+	e.monthRounding = periodRounding{}
+	e.auditCost = MoneyRounder{}
+	e.pendingDaily = nil
+	e.pendingMonthly = nil
+	e.flowLastTime = time.Time{}
+	e.flowHour = time.Time{}
+	e.flowLastGridW, e.flowLastPVW = 0, 0
+	e.flowHourAcc = FlowEdges{}
+	e.flowTotal = FlowEdges{}
+	e.pendingFlows = nil
+	e.pendingEvents = nil
+	e.batteryLimit = 0
+	e.curtailing = false
 	e.pvWh = 0
+	e.counterTotals = nil
+	e.applianceCosts = nil
+	e.applianceDirty = true // clients drop costs from the previous run
+	e.shiftDay = time.Time{}
+	e.shiftSavingsPLN = 0
 	e.heatPumpWh = 0
 	e.heatPumpProdWh = 0
 	e.heatPumpCostPLN = 0
@@ -697,6 +1629,14 @@ func (e *Engine) resetAccumulators() {
 	e.gridExportWh = 0
 	e.rawGridImportWh = 0
 	e.rawGridExportWh = 0
+	e.gridHours = 0
+	e.mustRunWh = 0
+	e.batteryEdgeWh = 0
+	e.phaseImportWh = [3]float64{}
+	e.phaseExportWh = [3]float64{}
+	e.phaseImbalanceWh = 0
+	e.phaseImbalanceHours = 0
+	e.phaseImbalanceMaxW = 0
 	e.gridImportCostPLN = 0
 	e.gridExportRevenuePLN = 0
 	e.rawGridImportCostPLN = 0
@@ -705,8 +1645,14 @@ func (e *Engine) resetAccumulators() {
 	e.arbGridExportWh = 0
 	e.arbGridImportCostPLN = 0
 	e.arbGridExportRevenuePLN = 0
+	e.hybGridImportCostPLN = 0
+	e.hybGridExportRevenuePLN = 0
+	e.cmpGridImportCostPLN = 0
+	e.cmpGridExportRevenuePLN = 0
 	e.cheapExportWh = 0
 	e.cheapExportRevenuePLN = 0
+	e.negativeExportWh = 0
+	e.negativeExportCostPLN = 0
 	e.currentSpotPrice = 0
 	e.arbThresholdDay = time.Time{}
 	e.arbLowThreshold = 0
@@ -735,17 +1681,24 @@ func (e *Engine) resetAccumulators() {
 	e.nbImportChargedPLN = 0
 	e.nbDepositUsedPLN = 0
 	e.nbExportValuedPLN = 0
+	e.schemeMonths = nil
 	e.nbRCEmMonth = time.Time{}
 	e.nbRCEmValue = 0
 
 	// Heating stats reset
 	e.heatingMonths = make(map[string]*heatingMonthAcc)
 	e.heatingMonthOrder = nil
+	e.costMonths = make(map[string]*costMonthAcc)
+	e.costMonthOrder = nil
+	e.costMonthsDirty = true // clients drop months from the previous run
 
 	// Thermal model reset
 	if e.thermal != nil {
 		e.thermal.Reset()
 	}
+	e.thermalCheck = nil
+	e.thermalSqErrSum = 0
+	e.thermalErrSamples = 0
 	e.preHeatCostPLN = 0
 
 	// Load shift reset
@@ -781,6 +1734,7 @@ func (e *Engine) resetAccumulators() {
 	// Anomaly tracking reset
 	e.anomalyDays = nil
 	e.anomalyCurrentDay = ""
+	e.anomalyDayStart = time.Time{}
 	e.anomalyActualWh = 0
 	e.anomalyPredictedWh = 0
 	e.anomalyTempSum = 0
@@ -798,6 +1752,12 @@ func (e *Engine) resetAccumulators() {
 	if e.altBattery != nil {
 		e.altBattery.Reset()
 	}
+	if e.hybBattery != nil {
+		e.hybBattery.Reset()
+	}
+	if e.cmpBattery != nil {
+		e.cmpBattery.Reset()
+	}
 }
 
 // Seek jumps to a specific time. Resets energy summaries and battery.
@@ -811,6 +1771,8 @@ func (e *Engine) Seek(t time.Time) {
 	}
 
 	e.simTime = t
+	// A reload may have added sensors since Init
+	e.resolveSensorIDs()
 	e.resetAccumulators()
 	e.mu.Unlock()
 
@@ -818,6 +1780,20 @@ func (e *Engine) Seek(t time.Time) {
 	e.broadcastSummary()
 }
 
+// resolveSensorIDs looks up the sensors the replay reads by type on every
+// interval. Must be called with mu held.
+func (e *Engine) resolveSensorIDs() {
+	e.pvSensorID, e.gridVoltageID = "", ""
+	for _, sensor := range e.store.Sensors() {
+		switch {
+		case sensor.Type == model.SensorPVPower && e.pvSensorID == "":
+			e.pvSensorID = sensor.ID
+		case sensor.Type == model.SensorGridVoltage && e.gridVoltageID == "":
+			e.gridVoltageID = sensor.ID
+		}
+	}
+}
+
 // SetTimeRange updates the engine's time range and seeks to its start.
 func (e *Engine) SetTimeRange(tr model.TimeRange) {
 	e.mu.Lock()
@@ -826,6 +1802,24 @@ func (e *Engine) SetTimeRange(tr model.TimeRange) {
 	e.Seek(tr.Start)
 }
 
+// ExtendTimeRange moves the replay end forward to include newly appended
+// data, without seeking or resetting accumulators. Ends at or before the
+// current end are ignored. In prediction mode the saved historical range
+// is extended instead.
+func (e *Engine) ExtendTimeRange(end time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.predictionMode {
+		if end.After(e.savedTimeRange.End) {
+			e.savedTimeRange.End = end
+		}
+		return
+	}
+	if end.After(e.timeRange.End) {
+		e.timeRange.End = end
+	}
+}
+
 // TimeRange returns the data time range.
 func (e *Engine) TimeRange() model.TimeRange {
 	e.mu.Lock()
@@ -838,10 +1832,24 @@ func (e *Engine) Sensors() []model.Sensor {
 	return e.store.Sensors()
 }
 
+// SensorCoverage reports how completely a sensor's data covers time.
+func (e *Engine) SensorCoverage(sensorID string) (store.Coverage, bool) {
+	return e.store.Coverage(sensorID)
+}
+
+// Overview returns a sensor's readings in tr aggregated into at most buckets points.
+func (e *Engine) Overview(sensorID string, tr model.TimeRange, buckets int) []model.Reading {
+	return e.store.Downsample(sensorID, tr, buckets)
+}
+
 // Step advances the simulation by the given duration and emits readings.
 // Useful for deterministic testing. Does not require Start().
 func (e *Engine) Step(delta time.Duration) {
 	e.mu.Lock()
+	if e.holdingAtEnd() {
+		e.mu.Unlock()
+		return
+	}
 
 	prevTime := e.simTime
 	e.simTime = e.simTime.Add(delta)
@@ -862,21 +1870,64 @@ func (e *Engine) Step(delta time.Duration) {
 
 	if ended {
 		e.mu.Lock()
-		e.running = false
+		if e.handoffToPrediction() {
+			e.mu.Unlock()
+			e.broadcastState()
+			return
+		}
+		switch e.endBehavior {
+		case EndLoop:
+			e.rewind()
+			e.mu.Unlock()
+			e.broadcastState()
+			e.broadcastSummary()
+			return
+		case EndHold:
+		default:
+			e.running = false
+		}
 		e.mu.Unlock()
 		e.broadcastState()
 	}
 }
 
-const tickInterval = 100 * time.Millisecond
+// holdingAtEnd reports whether an EndHold replay sits at the end of its
+// range, where advancing would only re-emit the final readings. Must be
+// called with mu held.
+func (e *Engine) holdingAtEnd() bool {
+	return e.endBehavior == EndHold && !e.predictionMode && !e.simTime.Before(e.timeRange.End)
+}
+
+// rewind moves an EndLoop replay back to the start of its range and resets
+// accumulators, like Seek. Must be called with mu held.
+func (e *Engine) rewind() {
+	e.simTime = e.timeRange.Start
+	e.resetAccumulators()
+}
+
+const (
+	defaultTickInterval = 100 * time.Millisecond
+	minTickInterval     = 10 * time.Millisecond
+)
 
-func (e *Engine) loop() {
-	ticker := time.NewTicker(tickInterval)
-	defer ticker.Stop()
+func (e *Engine) loop(stopCh <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	e.mu.Lock()
+	ticker := time.NewTicker(e.tickInterval)
+	e.ticker = ticker
+	e.mu.Unlock()
+	defer func() {
+		ticker.Stop()
+		e.mu.Lock()
+		if e.ticker == ticker {
+			e.ticker = nil
+		}
+		e.mu.Unlock()
+	}()
 
 	for {
 		select {
-		case <-e.stopCh:
+		case <-stopCh:
 			return
 		case <-ticker.C:
 			if e.tick() {
@@ -889,8 +1940,12 @@ func (e *Engine) loop() {
 // tick advances one frame. Returns true if simulation reached the end.
 func (e *Engine) tick() bool {
 	e.mu.Lock()
+	if e.holdingAtEnd() {
+		e.mu.Unlock()
+		return false
+	}
 
-	simDelta := time.Duration(float64(tickInterval) * e.speed)
+	simDelta := time.Duration(float64(e.tickInterval) * e.speed)
 	prevTime := e.simTime
 	e.simTime = e.simTime.Add(simDelta)
 
@@ -912,6 +1967,21 @@ func (e *Engine) tick() bool {
 
 	if ended {
 		e.mu.Lock()
+		if e.handoffToPrediction() {
+			e.mu.Unlock()
+			return false
+		}
+		switch e.endBehavior {
+		case EndLoop:
+			e.rewind()
+			e.mu.Unlock()
+			e.broadcastState()
+			e.broadcastSummary()
+			return false
+		case EndHold:
+			e.mu.Unlock()
+			return false
+		}
 		e.running = false
 		close(e.stopCh)
 		e.mu.Unlock()
@@ -926,6 +1996,7 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 	e.mu.Lock()
 	inPrediction := e.predictionMode
 	pred := e.prediction
+	emitted := e.emittedTypes
 	e.mu.Unlock()
 
 	if inPrediction && pred != nil {
@@ -945,6 +2016,9 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 			// Custom PV mode: replace PV readings and adjust grid readings
 			e.mu.Lock()
 			pvCustom := e.pvCustomEnabled
+			if r.Type == model.SensorGridPower {
+				e.applyMustRun(&r)
+			}
 			e.mu.Unlock()
 
 			if pvCustom && r.Type == model.SensorPVPower {
@@ -972,12 +2046,9 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 				// Adjust grid: remove historical PV contribution, add new PV
 				// Historical PV at this time
 				var historicalPV float64
-				for _, s := range e.store.Sensors() {
-					if s.Type == model.SensorPVPower {
-						if pvR, ok := e.store.ReadingAt(s.ID, r.Timestamp); ok {
-							historicalPV = pvR.Value
-						}
-						break
+				if e.pvSensorID != "" {
+					if pvR, ok := e.store.ReadingAt(e.pvSensorID, r.Timestamp); ok {
+						historicalPV = pvR.Value
 					}
 				}
 				newPV, _ := e.computeCustomPV(r.Timestamp)
@@ -987,12 +2058,14 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 				e.mu.Unlock()
 			}
 
-			e.callback.OnReading(SensorReading{
-				SensorID:  r.SensorID,
-				Value:     r.Value,
-				Unit:      r.Unit,
-				Timestamp: r.Timestamp.Format(time.RFC3339),
-			})
+			if emitted == nil || emitted[r.Type] {
+				e.callback.OnReading(SensorReading{
+					SensorID:  r.SensorID,
+					Value:     r.Value,
+					Unit:      r.Unit,
+					Timestamp: r.Timestamp.Format(time.RFC3339),
+				})
+			}
 
 			// Capture HP diagnostic and power quality snapshot values
 			e.captureDiagnosticSnapshot(r)
@@ -1018,6 +2091,8 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 			e.mu.Lock()
 			bat := e.battery
 			altBat := e.altBattery
+			hybBat := e.hybBattery
+			cmpBat, cmpStrategy := e.cmpBattery, e.cmpStrategy
 			priceSensor := e.priceSensorID
 			localPred := e.prediction
 			tempSensor := e.tempSensorID
@@ -1047,6 +2122,8 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 					if dayKey != e.anomalyCurrentDay {
 						e.finalizeAnomalyDay()
 						e.anomalyCurrentDay = dayKey
+						y, m, d := r.Timestamp.Date()
+						e.anomalyDayStart = time.Date(y, m, d, 0, 0, 0, 0, r.Timestamp.Location())
 						e.anomalyActualWh = 0
 						e.anomalyPredictedWh = 0
 						e.anomalyTempSum = 0
@@ -1072,11 +2149,25 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 				}
 			}
 
+			if cmpBat != nil && r.Type == model.SensorGridPower {
+				e.processCompareBattery(cmpBat, cmpStrategy, priceSensor, r)
+			}
+
 			if bat != nil && r.Type == model.SensorGridPower {
 				e.updateRawGridEnergy(r)
 				e.updateNetMeteringEnergy(r)
 				e.updateNetBillingEnergy(r)
+				if bat.config.CurtailmentVoltageV > 0 {
+					if v, ok := e.gridVoltageAt(r.Timestamp); ok {
+						bat.SetGridVoltage(v)
+					}
+				}
+				reclaimedWh := bat.ReclaimedWh
 				result := bat.Process(r.Value, r.Timestamp)
+				e.trackBatteryEdge(r, result.AdjustedGridW)
+				e.trackBatteryEvents(bat, result, r.Timestamp, bat.ReclaimedWh-reclaimedWh)
+				e.setAuditInterval(r.Value, result.BatteryPowerW, result.SoCPercent)
+				e.trackFlow(r.Timestamp, result.AdjustedGridW, result.BatteryPowerW)
 				e.callback.OnBatteryUpdate(BatteryUpdate{
 					BatteryPowerW: result.BatteryPowerW,
 					AdjustedGridW: result.AdjustedGridW,
@@ -1088,7 +2179,7 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 				adjusted.Value = result.AdjustedGridW
 				e.updateEnergy(adjusted)
 
-				// Shadow arbitrage battery
+				// Shadow arbitrage and hybrid batteries
 				if altBat != nil && priceSensor != "" {
 					low, high := e.priceThresholds(r.Timestamp)
 					if low != high {
@@ -1101,6 +2192,13 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 						arbAdjusted.Value = arbResult.AdjustedGridW
 						e.updateArbGridEnergy(arbAdjusted)
 						e.trackArbitrageDay(arbResult.BatteryPowerW, r.Timestamp)
+
+						if hybBat != nil {
+							hybResult := hybBat.ProcessHybrid(r.Value, r.Timestamp, price, low, high)
+							hybAdjusted := r
+							hybAdjusted.Value = hybResult.AdjustedGridW
+							e.updateHybridGridEnergy(hybAdjusted)
+						}
 					}
 				}
 			} else {
@@ -1108,6 +2206,8 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 					e.updateRawGridEnergy(r)
 					e.updateNetMeteringEnergy(r)
 					e.updateNetBillingEnergy(r)
+					e.setAuditInterval(r.Value, 0, 0)
+					e.trackFlow(r.Timestamp, r.Value, 0)
 				}
 				e.updateEnergy(r)
 			}
@@ -1115,10 +2215,71 @@ func (e *Engine) emitReadings(prevTime, currentTime, endTime time.Time) {
 	}
 }
 
+// trackThermalValidation drives the validation model with the heat pump's
+// electrical power over the interval ending at t and accumulates its error
+// against the measured indoor temperature. Must be called with mu held.
+func (e *Engine) trackThermalValidation(t time.Time, hpElecW float64) {
+	if e.indoorSensorID == "" {
+		return
+	}
+	measured, ok := e.store.ReadingAt(e.indoorSensorID, t)
+	if !ok {
+		return
+	}
+	if e.thermalCheck == nil {
+		e.thermalCheck = NewThermalModel(e.insulationLevel)
+		e.thermalCheck.SetCOPCurve(e.copCurve)
+	}
+	if e.thermalCheck.LastTimestamp.IsZero() {
+		// Start from the measured temperature.
+		e.thermalCheck.IndoorTempC = measured.Value
+		e.thermalCheck.Track(0, 0, 0, t)
+		return
+	}
+
+	outdoorTemp := 10.0
+	cop := 0.0 // COP curve unless production data gives a measured COP
+	if acc := e.heatingMonths[t.Format("2006-01")]; acc != nil {
+		if acc.tempCount > 0 {
+			outdoorTemp = acc.tempSum / float64(acc.tempCount)
+		}
+		if acc.consumptionWh > 0 && acc.productionWh > 0 {
+			cop = max(acc.productionWh/acc.consumptionWh, 1)
+		}
+	}
+	if e.tempSensorID != "" {
+		if tr, ok := e.store.ReadingAt(e.tempSensorID, t); ok {
+			outdoorTemp = tr.Value
+		}
+	}
+
+	modeled := e.thermalCheck.Track(outdoorTemp, hpElecW, cop, t)
+	diff := modeled - measured.Value
+	e.thermalSqErrSum += diff * diff
+	e.thermalErrSamples++
+}
+
+// gridVoltageAt returns the grid voltage reading at or before t. Sensors are
+// replayed one after another within a step, so the store is queried rather
+// than relying on the voltage reading having been emitted already.
+func (e *Engine) gridVoltageAt(t time.Time) (float64, bool) {
+	e.mu.Lock()
+	id := e.gridVoltageID
+	e.mu.Unlock()
+	if id == "" {
+		return 0, false
+	}
+	r, ok := e.store.ReadingAt(id, t)
+	return r.Value, ok
+}
+
 func (e *Engine) emitPredictions(prevTime, currentTime time.Time) {
 	e.mu.Lock()
 	pred := e.prediction
 	bat := e.battery
+	cmpBat, cmpStrategy := e.cmpBattery, e.cmpStrategy
+	priceSensor := e.priceSensorID
+	emitted := e.emittedTypes
 	e.mu.Unlock()
 
 	readings := pred.ReadingsForRange(prevTime, currentTime)
@@ -1143,8 +2304,6 @@ func (e *Engine) emitPredictions(prevTime, currentTime time.Time) {
 			e.mu.Unlock()
 		}
 
-		e.callback.OnReading(sr)
-
 		r := model.Reading{
 			Timestamp: ts,
 			SensorID:  sr.SensorID,
@@ -1152,12 +2311,28 @@ func (e *Engine) emitPredictions(prevTime, currentTime time.Time) {
 			Value:     sr.Value,
 			Unit:      sr.Unit,
 		}
+		// The forecast carries the must-run load like the replay before it.
+		e.mu.Lock()
+		e.applyMustRun(&r)
+		e.mu.Unlock()
+		sr.Value = r.Value
+
+		if emitted == nil || emitted[model.SensorGridPower] {
+			e.callback.OnReading(sr)
+		}
+
+		// Keep the comparison battery running so config:comparison spans
+		// history and forecast like the configured battery.
+		if cmpBat != nil {
+			e.processCompareBattery(cmpBat, cmpStrategy, priceSensor, r)
+		}
 
 		if bat != nil {
 			e.updateRawGridEnergy(r)
 			e.updateNetMeteringEnergy(r)
 			e.updateNetBillingEnergy(r)
 			result := bat.Process(r.Value, r.Timestamp)
+			e.trackBatteryEdge(r, result.AdjustedGridW)
 			e.callback.OnBatteryUpdate(BatteryUpdate{
 				BatteryPowerW: result.BatteryPowerW,
 				AdjustedGridW: result.AdjustedGridW,
@@ -1186,45 +2361,87 @@ func (e *Engine) updateEnergy(r model.Reading) {
 		return
 	}
 
+	if model.IsCumulative(r.Type) {
+		// Counters already hold the running total; integrating them as
+		// power would be meaningless.
+		if e.counterTotals == nil {
+			e.counterTotals = make(map[model.SensorType]float64)
+		}
+		delta := model.CounterDelta(last.Value, r.Value)
+		e.counterTotals[r.Type] += delta
+		if r.Type == model.SensorGridEnergyReactive {
+			mk := last.Timestamp.In(e.monthStart.Location()).Format("2006-01")
+			e.getOrCreateCostMonth(mk).reactiveKvarh += delta
+		}
+		e.lastReadings[r.SensorID] = r
+		return
+	}
+
 	hours := r.Timestamp.Sub(last.Timestamp).Hours()
-	avgPower := (last.Value + r.Value) / 2
+	avgPower := e.intervalAverage(r.Type, last.Value, r.Value)
 	wh := avgPower * hours
 
 	switch r.Type {
 	case model.SensorGridPower:
+		wh += e.standbyWh(hours)
 		// Split into import (positive) and export (negative)
 		price := e.spotPrice(r.Timestamp)
 		e.currentSpotPrice = price
+		e.advancePeriods(last.Timestamp)
+		month := e.getOrCreateCostMonth(e.monthStart.Format("2006-01"))
+		e.costMonthsDirty = true
+		var importWh, exportWh, intervalCost float64
 		if wh > 0 {
+			cost := (wh / 1000) * price
+			month.importCostPLN += cost
+			month.importWh += wh
+			importWh, intervalCost = wh, cost
 			e.gridImportWh += wh
-			e.gridImportCostPLN += (wh / 1000) * price
+			e.gridImportCostPLN += cost
+			e.dayAcc.importWh += wh
+			e.dayAcc.importCostPLN += cost
+			e.monthAcc.importWh += wh
+			e.monthAcc.importCostPLN += cost
 
-			newDay := startOfDay(r.Timestamp)
-			if newDay.After(e.dayStart) {
-				e.dayStart = newDay
-				e.todayWh = 0
-			}
-			newMonth := startOfMonth(r.Timestamp)
-			if newMonth.After(e.monthStart) {
-				e.monthStart = newMonth
-				e.monthWh = 0
-			}
 			e.todayWh += wh
 			e.monthWh += wh
 			e.totalWh += wh
 		} else if wh < 0 {
-			exportWh := -wh
+			exportWh = -wh
+			revenue := e.exportRevenue(exportWh, price, r.Timestamp)
+			intervalCost = -revenue
+			month.exportRevenuePLN += revenue
 			e.gridExportWh += exportWh
-			e.gridExportRevenuePLN += (exportWh / 1000) * price * e.exportCoefficient
+			e.gridExportRevenuePLN += revenue
+			e.dayAcc.exportWh += exportWh
+			e.dayAcc.exportRevenuePLN += revenue
+			e.monthAcc.exportWh += exportWh
+			e.monthAcc.exportRevenuePLN += revenue
 			// Track cheap export
-			if price < e.priceThresholdPLN {
+			if price < e.cheapExportThreshold(r.Timestamp) {
 				e.cheapExportWh += exportWh
-				e.cheapExportRevenuePLN += (exportWh / 1000) * price * e.exportCoefficient
+				e.cheapExportRevenuePLN += revenue
 			}
+			if price < 0 {
+				e.negativeExportWh += exportWh
+				e.negativeExportCostPLN -= revenue
+			}
+		}
+		e.writeAuditRow(r.Timestamp, r.Value, price, importWh, exportWh, intervalCost)
+		e.trackPhaseImbalance(r.Timestamp, hours)
+	case model.SensorGridPowerL1, model.SensorGridPowerL2, model.SensorGridPowerL3:
+		i, _ := phaseIndex(r.Type)
+		if wh > 0 {
+			e.phaseImportWh[i] += wh
+		} else {
+			e.phaseExportWh[i] -= wh
 		}
 	case model.SensorPVPower:
+		e.advancePeriods(last.Timestamp)
 		if wh > 0 {
 			e.pvWh += wh
+			e.dayAcc.pvWh += wh
+			e.monthAcc.pvWh += wh
 		}
 	case model.SensorPumpConsumption:
 		if wh > 0 {
@@ -1255,6 +2472,9 @@ func (e *Engine) updateEnergy(r model.Reading) {
 			// Pre-heating thermal shadow
 			if e.thermal == nil {
 				e.thermal = NewThermalModel(e.insulationLevel)
+				e.thermal.SetComfortBand(e.comfortMinC, e.comfortMaxC)
+				e.thermal.SetMinRunTimes(e.hpMinOnTime, e.hpMinOffTime)
+				e.thermal.SetCOPCurve(e.copCurve)
 			}
 			if e.priceSensorID != "" {
 				low, high := e.arbLowThreshold, e.arbHighThreshold
@@ -1263,17 +2483,15 @@ func (e *Engine) updateEnergy(r model.Reading) {
 				if acc.tempCount > 0 {
 					outdoorTemp = acc.tempSum / float64(acc.tempCount)
 				}
-				cop := 1.0
+				cop := 0.0 // COP curve without production data
 				if acc.consumptionWh > 0 && acc.productionWh > 0 {
-					cop = acc.productionWh / acc.consumptionWh
-				}
-				if cop < 1 {
-					cop = 1
+					cop = max(acc.productionWh/acc.consumptionWh, 1)
 				}
 				e.thermal.Step(outdoorTemp, price, low, high, r.Value, cop, r.Timestamp)
 				e.preHeatCostPLN = e.thermal.CostPLN
 			}
 		}
+		e.trackThermalValidation(r.Timestamp, avgPower)
 	case model.SensorPumpProduction:
 		if wh > 0 {
 			e.heatPumpProdWh += wh
@@ -1281,11 +2499,133 @@ func (e *Engine) updateEnergy(r model.Reading) {
 			acc := e.getOrCreateHeatingMonth(mk)
 			acc.productionWh += wh
 		}
+	default:
+		if applianceSensors[r.Type] && wh > 0 {
+			e.addApplianceCost(r, wh)
+			if r.Type == e.shiftAppliance {
+				e.addApplianceShift(r, wh)
+			}
+		}
 	}
 
 	e.lastReadings[r.SensorID] = r
 }
 
+// advancePeriods rolls the day and month accumulators over when t (the start
+// of the interval being integrated) falls in a later period, queueing the
+// finished period's rollup for broadcast.
+// Must be called with mu held.
+func (e *Engine) advancePeriods(t time.Time) {
+	if newDay := startOfDay(t); newDay.After(e.dayStart) {
+		if !e.dayStart.IsZero() {
+			e.pendingDaily = append(e.pendingDaily, e.dayRounding.round(e.dayAcc.summary(e.dayStart), e.kwhDecimals))
+		}
+		e.dayStart = newDay
+		e.todayWh = 0
+		e.dayAcc = periodAcc{}
+	}
+	if newMonth := startOfMonth(t); newMonth.After(e.monthStart) {
+		if !e.monthStart.IsZero() {
+			e.pendingMonthly = append(e.pendingMonthly, e.monthRounding.round(e.monthAcc.summary(e.monthStart), e.kwhDecimals))
+		}
+		e.monthStart = newMonth
+		e.monthWh = 0
+		e.monthAcc = periodAcc{}
+	}
+}
+
+// addApplianceCost attributes wh ending at r to its appliance at the spot
+// price. Must be called with e.mu held.
+func (e *Engine) addApplianceCost(r model.Reading, wh float64) {
+	if e.applianceCosts == nil {
+		e.applianceCosts = make(map[model.SensorType]*applianceAcc)
+	}
+	acc, ok := e.applianceCosts[r.Type]
+	if !ok {
+		acc = &applianceAcc{}
+		e.applianceCosts[r.Type] = acc
+	}
+	cost := (wh / 1000) * e.spotPrice(r.Timestamp)
+	if month := startOfMonth(r.Timestamp); month.After(acc.month) {
+		acc.month = month
+		acc.monthWh = 0
+		acc.monthCostPLN = 0
+	}
+	acc.wh += wh
+	acc.costPLN += cost
+	acc.monthWh += wh
+	acc.monthCostPLN += cost
+	e.applianceDirty = true
+}
+
+// addApplianceShift accrues the saving from moving wh ending at r to the
+// cheapest hour of its day's shift window; energy outside the window stays
+// put. Must be called with e.mu held.
+func (e *Engine) addApplianceShift(r model.Reading, wh float64) {
+	start, ok := e.shiftWindowStart(r.Timestamp)
+	if !ok {
+		return
+	}
+	if !start.Equal(e.shiftDay) {
+		e.shiftDay = start
+		e.shiftBestPrice = math.Inf(1)
+		for i := range e.shiftWindowHours() {
+			// time.Date normalizes the hour past midnight and keeps wall
+			// clock hours on DST change days.
+			h := time.Date(start.Year(), start.Month(), start.Day(), e.shiftStartH+i, 0, 0, 0, start.Location())
+			e.shiftBestPrice = math.Min(e.shiftBestPrice, e.spotPrice(h))
+		}
+	}
+	e.shiftSavingsPLN += (wh / 1000) * (e.spotPrice(r.Timestamp) - e.shiftBestPrice)
+}
+
+// shiftWindowHours returns the length of the shift window in hours.
+// Must be called with e.mu held.
+func (e *Engine) shiftWindowHours() int {
+	if n := (e.shiftEndH - e.shiftStartH + 24) % 24; n > 0 {
+		return n
+	}
+	return 24
+}
+
+// shiftWindowStart returns the start of the shift window t falls in, which
+// is on the previous day for the early hours of a window wrapping past
+// midnight, and false when t is outside the window. Must be called with
+// e.mu held.
+func (e *Engine) shiftWindowStart(t time.Time) (time.Time, bool) {
+	offset := (t.Hour() - e.shiftStartH + 24) % 24
+	if offset >= e.shiftWindowHours() {
+		return time.Time{}, false
+	}
+	day := t
+	if t.Hour() < e.shiftStartH {
+		day = t.AddDate(0, 0, -1)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), e.shiftStartH, 0, 0, 0, t.Location()), true
+}
+
+// buildApplianceCosts returns per-appliance costs sorted by sensor type.
+// Must be called with e.mu held.
+func (e *Engine) buildApplianceCosts() []ApplianceCost {
+	out := make([]ApplianceCost, 0, len(e.applianceCosts))
+	for st, acc := range e.applianceCosts {
+		name := string(st)
+		if info, ok := model.SensorCatalog[st]; ok {
+			name = info.Name
+		}
+		out = append(out, ApplianceCost{
+			Type:         st,
+			Name:         name,
+			KWh:          acc.wh / 1000,
+			CostPLN:      acc.costPLN,
+			MonthKWh:     acc.monthWh / 1000,
+			MonthCostPLN: acc.monthCostPLN,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
 func (e *Engine) updateRawGridEnergy(r model.Reading) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -1299,8 +2639,9 @@ func (e *Engine) updateRawGridEnergy(r model.Reading) {
 	}
 
 	hours := r.Timestamp.Sub(last.Timestamp).Hours()
-	avgPower := (last.Value + r.Value) / 2
+	avgPower := e.intervalAverage(r.Type, last.Value, r.Value)
 	wh := avgPower * hours
+	e.gridHours += hours
 
 	price := e.spotPrice(r.Timestamp)
 	if wh > 0 {
@@ -1308,13 +2649,46 @@ func (e *Engine) updateRawGridEnergy(r model.Reading) {
 		e.rawGridImportCostPLN += (wh / 1000) * price
 	} else if wh < 0 {
 		e.rawGridExportWh += -wh
-		e.rawGridExportRevenuePLN += (-wh / 1000) * price * e.exportCoefficient
+		e.rawGridExportRevenuePLN += e.exportRevenue(-wh, price, r.Timestamp)
 	}
 
 	e.lastReadings[key] = r
 }
 
-// priceThresholds returns daily P33/P67 price thresholds for arbitrage.
+// trackBatteryEdge accumulates, for CheckBalance, how much the grid's
+// integration of the battery over the interval ending at grid reading r
+// differs from the battery's own accounting, which applies the power it
+// settled on at r to the whole interval. adjustedW is r after the battery.
+func (e *Engine) trackBatteryEdge(r model.Reading, adjustedW float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := r.SensorID + ":edge"
+	shift := r
+	shift.Value = r.Value - adjustedW
+	if last, ok := e.lastReadings[key]; ok {
+		hours := r.Timestamp.Sub(last.Timestamp).Hours()
+		e.batteryEdgeWh += (e.intervalAverage(r.Type, last.Value, shift.Value) - shift.Value) * hours
+	}
+	e.lastReadings[key] = shift
+}
+
+// SetArbitragePercentiles sets the daily price percentiles (0–100) below
+// which the arbitrage battery charges and above which it discharges. A tight
+// band (e.g. 45/55) cycles often on small spreads, a wide one (10/90) only
+// trades the extremes. Invalid bands (low ≥ high) are ignored.
+func (e *Engine) SetArbitragePercentiles(low, high int) {
+	if low < 0 || high > 100 || low >= high {
+		return
+	}
+	e.mu.Lock()
+	e.arbLowPct, e.arbHighPct = low, high
+	e.arbThresholdDay = time.Time{} // recompute today's thresholds
+	e.mu.Unlock()
+}
+
+// priceThresholds returns the day's arbitrage price thresholds at the
+// configured percentiles (P33/P67 by default).
 // Returns (0, 0) if no price data available, which makes low == high and skips arb.
 func (e *Engine) priceThresholds(t time.Time) (low, high float64) {
 	day := startOfDay(t)
@@ -1326,35 +2700,59 @@ func (e *Engine) priceThresholds(t time.Time) (low, high float64) {
 		return
 	}
 	priceSensor := e.priceSensorID
+	lowPct, highPct := e.arbLowPct, e.arbHighPct
 	e.mu.Unlock()
 
 	if priceSensor == "" {
 		return 0, 0
 	}
 
-	dayEnd := day.Add(24 * time.Hour)
-	readings := e.store.ReadingsInRange(priceSensor, day, dayEnd)
-	if len(readings) == 0 {
+	prices := e.dayPrices(priceSensor, day)
+	if len(prices) == 0 {
 		return 0, 0
 	}
+	low, high = PriceThresholdsAt(prices, lowPct, highPct)
+
+	e.mu.Lock()
+	e.arbThresholdDay = day
+	e.arbLowThreshold = low
+	e.arbHighThreshold = high
+	e.mu.Unlock()
+
+	return low, high
+}
 
+// dayPrices returns the price readings of the calendar day starting at day.
+func (e *Engine) dayPrices(priceSensor string, day time.Time) []float64 {
+	readings := e.store.ReadingsInRange(priceSensor, day, day.Add(24*time.Hour))
 	prices := make([]float64, len(readings))
 	for i, r := range readings {
 		prices[i] = r.Value
 	}
-	sort.Float64s(prices)
+	return prices
+}
 
-	n := len(prices)
-	p33 := prices[(n-1)*33/100]
-	p67 := prices[(n-1)*67/100]
+// Default arbitrage percentiles, see SetArbitragePercentiles.
+const (
+	defaultArbLowPct  = 33
+	defaultArbHighPct = 67
+)
 
-	e.mu.Lock()
-	e.arbThresholdDay = day
-	e.arbLowThreshold = p33
-	e.arbHighThreshold = p67
-	e.mu.Unlock()
+// PriceThresholds returns the P33/P67 percentiles of a day's prices, the
+// default charge/discharge thresholds used by the arbitrage strategy. The
+// input slice is sorted in place. Returns (0, 0) for an empty slice.
+func PriceThresholds(prices []float64) (low, high float64) {
+	return PriceThresholdsAt(prices, defaultArbLowPct, defaultArbHighPct)
+}
 
-	return p33, p67
+// PriceThresholdsAt is PriceThresholds at the lowPct/highPct percentiles.
+func PriceThresholdsAt(prices []float64, lowPct, highPct int) (low, high float64) {
+	n := len(prices)
+	if n == 0 {
+		return 0, 0
+	}
+	sort.Float64s(prices)
+	return prices[(n-1)*lowPct/100], prices[(n-1)*highPct/100]
 }
 
 func (e *Engine) updateArbGridEnergy(r model.Reading) {
@@ -1369,8 +2767,8 @@ func (e *Engine) updateArbGridEnergy(r model.Reading) {
 	}
 
 	hours := r.Timestamp.Sub(last.Timestamp).Hours()
-	avgPower := (last.Value + r.Value) / 2
-	wh := avgPower * hours
+	avgPower := e.intervalAverage(r.Type, last.Value, r.Value)
+	wh := avgPower*hours + e.standbyWh(hours)
 
 	price := e.spotPrice(r.Timestamp)
 	if wh > 0 {
@@ -1378,7 +2776,40 @@ func (e *Engine) updateArbGridEnergy(r model.Reading) {
 		e.arbGridImportCostPLN += (wh / 1000) * price
 	} else if wh < 0 {
 		e.arbGridExportWh += -wh
-		e.arbGridExportRevenuePLN += (-wh / 1000) * price * e.exportCoefficient
+		e.arbGridExportRevenuePLN += e.exportRevenue(-wh, price, r.Timestamp)
+	}
+
+	e.lastReadings[key] = r
+}
+
+// standbyWh returns the inverter standby energy drawn over hours, or 0
+// when no battery is configured. Must be called with mu held.
+func (e *Engine) standbyWh(hours float64) float64 {
+	if e.battery == nil {
+		return 0
+	}
+	return e.battery.config.InverterStandbyW * hours
+}
+
+func (e *Engine) updateHybridGridEnergy(r model.Reading) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := r.SensorID + ":hybrid"
+	last, exists := e.lastReadings[key]
+	if !exists {
+		e.lastReadings[key] = r
+		return
+	}
+
+	hours := r.Timestamp.Sub(last.Timestamp).Hours()
+	wh := e.intervalAverage(r.Type, last.Value, r.Value)*hours + e.standbyWh(hours)
+
+	price := e.spotPrice(r.Timestamp)
+	if wh > 0 {
+		e.hybGridImportCostPLN += (wh / 1000) * price
+	} else if wh < 0 {
+		e.hybGridExportRevenuePLN += e.exportRevenue(-wh, price, r.Timestamp)
 	}
 
 	e.lastReadings[key] = r
@@ -1396,11 +2827,12 @@ func (e *Engine) updateNetMeteringEnergy(r model.Reading) {
 	}
 
 	hours := r.Timestamp.Sub(last.Timestamp).Hours()
-	avgPower := (last.Value + r.Value) / 2
+	avgPower := e.intervalAverage(r.Type, last.Value, r.Value)
 	wh := avgPower * hours
 	kwh := wh / 1000
 
 	curMonth := startOfMonth(r.Timestamp)
+	costBefore := e.nmImportCostPLN
 
 	if kwh < 0 {
 		// Export: store credits at ratio
@@ -1424,6 +2856,9 @@ func (e *Engine) updateNetMeteringEnergy(r model.Reading) {
 			if !e.nmCreditBucketMonth[idx].IsZero() {
 				age := curMonth.Sub(e.nmCreditBucketMonth[idx])
 				if age > 365*24*time.Hour {
+					e.addEvent(EventNMCreditExpired, r.Timestamp, e.nmCreditBuckets[idx],
+						"%.1f kWh net-metering credit from %s expired",
+						e.nmCreditBuckets[idx], e.nmCreditBucketMonth[idx].Format("2006-01"))
 					e.nmCreditBuckets[idx] = 0
 					continue
 				}
@@ -1439,9 +2874,9 @@ func (e *Engine) updateNetMeteringEnergy(r model.Reading) {
 			e.nmImportCostPLN += used * e.distributionFeePLN
 		}
 
-		// Uncredited remainder pays full fixed tariff
+		// Uncredited remainder pays the full tariff
 		if remaining > 0 {
-			e.nmImportCostPLN += remaining * e.fixedTariffPLN
+			e.nmImportCostPLN += remaining * e.importTariffLocked(last.Timestamp)
 		}
 	}
 
@@ -1451,6 +2886,7 @@ func (e *Engine) updateNetMeteringEnergy(r model.Reading) {
 		total += v
 	}
 	e.nmCreditBankKWh = total
+	e.addSchemeMonth(last.Timestamp, e.nmImportCostPLN-costBefore, 0)
 
 	e.lastReadings[key] = r
 }
@@ -1467,7 +2903,7 @@ func (e *Engine) updateNetBillingEnergy(r model.Reading) {
 	}
 
 	hours := r.Timestamp.Sub(last.Timestamp).Hours()
-	avgPower := (last.Value + r.Value) / 2
+	avgPower := e.intervalAverage(r.Type, last.Value, r.Value)
 	wh := avgPower * hours
 	kwh := wh / 1000
 
@@ -1479,18 +2915,20 @@ func (e *Engine) updateNetBillingEnergy(r model.Reading) {
 		e.nbDepositPLN += value
 		e.nbExportValuedPLN += value
 	} else if kwh > 0 {
-		// Import: charge at fixed tariff, deduct from deposit
-		importCost := kwh * e.fixedTariffPLN
+		// Import: charge at the tariff, deduct from deposit
+		importCost := kwh * e.importTariffLocked(last.Timestamp)
 		e.nbImportChargedPLN += importCost
 
+		var deduct float64
 		if e.nbDepositPLN > 0 {
-			deduct := importCost
+			deduct = importCost
 			if deduct > e.nbDepositPLN {
 				deduct = e.nbDepositPLN
 			}
 			e.nbDepositPLN -= deduct
 			e.nbDepositUsedPLN += deduct
 		}
+		e.addSchemeMonth(last.Timestamp, 0, importCost-deduct)
 	}
 
 	e.lastReadings[key] = r
@@ -1563,6 +3001,9 @@ func (e *Engine) trackArbitrageDay(batteryPowerW float64, ts time.Time) {
 		}
 		e.arbitrageDayStartRawNetCost = e.rawGridImportCostPLN - e.rawGridExportRevenuePLN
 		e.arbitrageDayStartArbNetCost = e.arbGridImportCostPLN - e.arbGridExportRevenuePLN
+		// priceThresholds has just been evaluated for ts
+		e.arbitrageDayLowPrice = e.arbLowThreshold
+		e.arbitrageDayHighPrice = e.arbHighThreshold
 	}
 
 	// Track charge/discharge windows as non-overlapping phases:
@@ -1623,6 +3064,9 @@ func (e *Engine) finalizeArbitrageDay() {
 		}
 	}
 
+	spread := e.arbitrageDayHighPrice - e.arbitrageDayLowPrice
+	breakEven := e.altBattery.config.IdleBreakEvenSpread(e.arbitrageDayLowPrice, float64(gapMinutes)/60)
+
 	rec := ArbitrageDayRecord{
 		Date:               e.arbitrageCurrentDay,
 		ChargeStartTime:    e.arbitrageDayChargeStart,
@@ -1634,14 +3078,36 @@ func (e *Engine) finalizeArbitrageDay() {
 		GapMinutes:         gapMinutes,
 		CyclesDelta:        cyclesDelta,
 		EarningsPLN:        earnings,
+		SpreadPLN:          spread,
+		BreakEvenSpreadPLN: breakEven,
+		Profitable:         spread > breakEven,
 	}
 
 	e.arbitrageDayRecords = append(e.arbitrageDayRecords, rec)
 	e.arbitrageDayLogDirty = true
 }
 
-func (e *Engine) broadcastSummary() {
+// ArbitrageCycles returns the equivalent full cycles of the shadow arbitrage
+// battery, or 0 without a battery.
+func (e *Engine) ArbitrageCycles() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.altBattery == nil {
+		return 0
+	}
+	return e.altBattery.Cycles()
+}
+
+// CurrentSummary returns the energy summary at the current simulation time.
+func (e *Engine) CurrentSummary() Summary {
 	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.buildSummary()
+}
+
+// buildSummary assembles the energy summary from the accumulators.
+// Must be called with mu held.
+func (e *Engine) buildSummary() Summary {
 	pvKWh := e.pvWh / 1000
 	gridExportKWh := e.gridExportWh / 1000
 	gridImportKWh := e.gridImportWh / 1000
@@ -1682,7 +3148,24 @@ func (e *Engine) broadcastSummary() {
 		}
 	}
 
+	var hybNetCost, hybSavingsPLN float64
+	if e.hybBattery != nil {
+		hybNetCost = e.hybGridImportCostPLN - e.hybGridExportRevenuePLN
+		hybSavingsPLN = rawNetCost - hybNetCost
+		if hybSavingsPLN < 0 {
+			hybSavingsPLN = 0
+		}
+	}
+
+	var arbSpread, arbBreakEven float64
+	if e.altBattery != nil && !e.arbThresholdDay.IsZero() {
+		arbSpread = e.arbHighThreshold - e.arbLowThreshold
+		arbBreakEven = e.altBattery.config.BreakEvenSpread(e.arbLowThreshold)
+	}
+
 	s := Summary{
+		Currency: e.currency,
+
 		TodayKWh:           e.todayWh / 1000,
 		MonthKWh:           e.monthWh / 1000,
 		TotalKWh:           e.totalWh / 1000,
@@ -1707,17 +3190,45 @@ func (e *Engine) broadcastSummary() {
 		ArbNetCostPLN:        arbNetCost,
 		ArbBatterySavingsPLN: arbSavingsPLN,
 
-		CheapExportKWh:    e.cheapExportWh / 1000,
-		CheapExportRevPLN: e.cheapExportRevenuePLN,
-		CurrentSpotPrice:  e.currentSpotPrice,
+		ArbSpreadPLN:          arbSpread,
+		ArbBreakEvenSpreadPLN: arbBreakEven,
+		ArbSpreadProfitable:   arbSpread > arbBreakEven,
+
+		HybridNetCostPLN:        hybNetCost,
+		HybridBatterySavingsPLN: hybSavingsPLN,
+
+		CheapExportKWh:        e.cheapExportWh / 1000,
+		CheapExportRevPLN:     e.cheapExportRevenuePLN,
+		NegativeExportKWh:     e.negativeExportWh / 1000,
+		NegativeExportCostPLN: e.negativeExportCostPLN,
+		CurrentSpotPrice:      e.currentSpotPrice,
 
 		NMNetCostPLN:    e.nmImportCostPLN,
 		NMCreditBankKWh: e.nmCreditBankKWh,
 		NBNetCostPLN:    e.nbImportChargedPLN - e.nbDepositUsedPLN,
 		NBDepositPLN:    e.nbDepositPLN,
 
+		ReactivePenaltyPLN: e.reactivePenalty(),
+
+		ApplianceShiftSavingsPLN:   e.shiftSavingsPLN,
+		ApplianceShiftedNetCostPLN: netCost - e.shiftSavingsPLN,
+
 		PreHeatCostPLN:    e.preHeatCostPLN,
 		PreHeatSavingsPLN: e.heatPumpCostPLN - e.preHeatCostPLN,
+
+		Counters: maps.Clone(e.counterTotals),
+
+		MustRunKWh: e.mustRunWh / 1000,
+
+		Phases:             e.phaseEnergies(),
+		PhaseImbalanceMaxW: e.phaseImbalanceMaxW,
+	}
+	if e.phaseImbalanceHours > 0 {
+		s.PhaseImbalanceAvgW = e.phaseImbalanceWh / e.phaseImbalanceHours
+	}
+	if e.thermalErrSamples > 0 {
+		s.ThermalRMSEC = math.Sqrt(e.thermalSqErrSum / float64(e.thermalErrSamples))
+		s.ThermalSamples = e.thermalErrSamples
 	}
 	// PV array production breakdown
 	if e.pvCustomEnabled && len(e.pvArrayWh) > 0 {
@@ -1730,12 +3241,42 @@ func (e *Engine) broadcastSummary() {
 			}
 		}
 	}
+	roundAmounts(&s, e.kwhDecimals)
+	return s
+}
+
+func (e *Engine) broadcastSummary() {
+	e.mu.Lock()
+	s := e.buildSummary()
 	bat := e.battery
+	var arbCharge, arbDischarge map[int]float64
+	if e.altBattery != nil {
+		arbCharge, arbDischarge = e.altBattery.PriceBandsKWh()
+	}
+	hasPrices := e.priceSensorID != ""
+	var comparison StrategyComparison
+	if hasPrices {
+		comparison = e.buildStrategyComparison(s)
+	}
+	hasCompare := e.cmpBattery != nil
+	var configComparison ConfigComparison
+	if hasCompare {
+		configComparison = e.buildConfigComparison(s)
+	}
 	e.mu.Unlock()
 
 	e.callback.OnSummary(s)
 	if bat != nil {
-		e.callback.OnBatterySummary(bat.Summary())
+		bs := bat.Summary()
+		bs.ArbChargeKWhByPrice, bs.ArbDischargeKWhByPrice = arbCharge, arbDischarge
+		e.callback.OnBatterySummary(bs)
+	}
+	// Costs are all zero without prices, so there is nothing to rank.
+	if hasPrices {
+		e.callback.OnStrategyComparison(comparison)
+	}
+	if hasCompare {
+		e.callback.OnConfigComparison(configComparison)
 	}
 
 	// Broadcast arb day log if dirty
@@ -1780,6 +3321,19 @@ func (e *Engine) broadcastSummary() {
 	e.mu.Unlock()
 	e.callback.OnHeatingStats(heatingStats)
 
+	// Broadcast per-month costs if dirty
+	e.mu.Lock()
+	costsDirty := e.costMonthsDirty
+	var monthlyCosts []MonthlyCost
+	if costsDirty {
+		monthlyCosts = e.buildMonthlyCosts()
+		e.costMonthsDirty = false
+	}
+	e.mu.Unlock()
+	if costsDirty {
+		e.callback.OnMonthlyCosts(monthlyCosts)
+	}
+
 	// Broadcast anomaly days if dirty
 	e.mu.Lock()
 	anomalyDirty := e.anomalyDirty
@@ -1854,12 +3408,49 @@ func (e *Engine) broadcastSummary() {
 	if pqDirtyFlag {
 		e.callback.OnPowerQuality(pq)
 	}
+
+	// Broadcast appliance costs if dirty
+	e.mu.Lock()
+	appDirty := e.applianceDirty
+	var appCosts []ApplianceCost
+	if appDirty {
+		appCosts = e.buildApplianceCosts()
+		e.applianceDirty = false
+	}
+	e.mu.Unlock()
+	if appDirty {
+		e.callback.OnApplianceCosts(appCosts)
+	}
+
+	// Broadcast finished day/month rollups
+	e.mu.Lock()
+	daily, monthly := e.pendingDaily, e.pendingMonthly
+	e.pendingDaily, e.pendingMonthly = nil, nil
+	events := e.pendingEvents
+	e.pendingEvents = nil
+	flows := e.pendingFlows
+	e.pendingFlows = nil
+	e.mu.Unlock()
+	for _, d := range daily {
+		e.callback.OnDailySummary(d)
+	}
+	for _, m := range monthly {
+		e.callback.OnMonthlySummary(m)
+	}
+	for _, f := range flows {
+		e.callback.OnFlowSankey(f)
+	}
+
+	// Broadcast replay events
+	for _, ev := range events {
+		e.callback.OnEvent(ev)
+	}
 }
 
 // buildLoadShiftStats computes load shift analysis from hourly accumulators.
 // Must be called with mu held.
 func (e *Engine) buildLoadShiftStats() LoadShiftStats {
-	const shiftWindow = 4
+	shiftWindow := e.loadShiftWindow
 
 	var stats LoadShiftStats
 	stats.ShiftWindowH = shiftWindow
@@ -1937,6 +3528,36 @@ func (e *Engine) getOrCreateHeatingMonth(mk string) *heatingMonthAcc {
 	return acc
 }
 
+// getOrCreateCostMonth returns the grid cost accumulator for the given month
+// key. Must be called with mu held.
+func (e *Engine) getOrCreateCostMonth(mk string) *costMonthAcc {
+	acc, ok := e.costMonths[mk]
+	if !ok {
+		acc = &costMonthAcc{}
+		e.costMonths[mk] = acc
+		e.costMonthOrder = append(e.costMonthOrder, mk)
+	}
+	return acc
+}
+
+// buildMonthlyCosts returns the per-month grid costs in month order.
+// Must be called with mu held.
+func (e *Engine) buildMonthlyCosts() []MonthlyCost {
+	var importCost, exportRevenue MoneyRounder
+	out := make([]MonthlyCost, 0, len(e.costMonthOrder))
+	for _, mk := range e.costMonthOrder {
+		acc := e.costMonths[mk]
+		c := MonthlyCost{
+			Month:            mk,
+			ImportCostPLN:    importCost.Add(acc.importCostPLN),
+			ExportRevenuePLN: exportRevenue.Add(acc.exportRevenuePLN),
+		}
+		c.NetCostPLN = RoundPLN(c.ImportCostPLN - c.ExportRevenuePLN)
+		out = append(out, c)
+	}
+	return out
+}
+
 // finalizeAnomalyDay builds an AnomalyDayRecord for the completed day.
 // Must be called with mu held.
 func (e *Engine) finalizeAnomalyDay() {
@@ -1956,6 +3577,57 @@ func (e *Engine) finalizeAnomalyDay() {
 		AvgTempC:     avgTemp,
 	})
 	e.anomalyDirty = true
+	if math.Abs(deviationPct) > anomalyEventPct {
+		e.addEvent(EventAnomalyDay, e.anomalyDayStart, deviationPct,
+			"%s consumption %+.0f%% vs prediction (%.1f kWh actual, %.1f kWh predicted)",
+			e.anomalyCurrentDay, deviationPct, e.anomalyActualWh/1000, e.anomalyPredictedWh/1000)
+	}
+}
+
+// addEvent queues an event for the next summary broadcast. Must be called
+// with mu held.
+func (e *Engine) addEvent(kind EventKind, t time.Time, value float64, format string, args ...any) {
+	e.pendingEvents = append(e.pendingEvents, Event{
+		Kind:      kind,
+		Timestamp: t.Format(time.RFC3339),
+		Message:   fmt.Sprintf(format, args...),
+		Value:     value,
+	})
+}
+
+// trackBatteryEvents raises events when the battery reaches its ceiling or
+// floor and when it starts absorbing curtailed PV. Reaching a limit only
+// counts when the battery moved during the interval, so a battery idling at
+// its floor from the start stays quiet.
+func (e *Engine) trackBatteryEvents(bat *Battery, result ProcessResult, t time.Time, reclaimedWh float64) {
+	const socEpsilon = 1e-6
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	limit := 0
+	switch {
+	case result.SoCPercent >= bat.config.ChargeToPercent-socEpsilon:
+		limit = 1
+	case result.SoCPercent <= bat.config.DischargeToPercent+socEpsilon:
+		limit = -1
+	}
+	if limit != e.batteryLimit && result.BatteryPowerW != 0 {
+		switch limit {
+		case 1:
+			e.addEvent(EventBatteryFull, t, result.SoCPercent, "Battery full (%.0f%% SoC)", result.SoCPercent)
+		case -1:
+			e.addEvent(EventBatteryEmpty, t, result.SoCPercent, "Battery empty (%.0f%% SoC)", result.SoCPercent)
+		}
+	}
+	e.batteryLimit = limit
+
+	curtailing := reclaimedWh > 0
+	if curtailing && !e.curtailing {
+		e.addEvent(EventCurtailment, t, reclaimedWh/1000,
+			"Grid voltage high: battery absorbing curtailed PV")
+	}
+	e.curtailing = curtailing
 }
 
 // captureDiagnosticSnapshot stores HP diagnostic and power quality values.
@@ -1,6 +1,7 @@
 package simulator
 
 import (
+	"math"
 	"sync"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"energy_simulator/internal/model"
+	"energy_simulator/internal/solar"
 	"energy_simulator/internal/store"
 )
 
@@ -22,7 +24,15 @@ type mockCallback struct {
 	arbitrageDayLogs      [][]ArbitrageDayRecord
 	predictionComparisons []PredictionComparison
 	heatingStats          [][]HeatingMonthStat
+	monthlyCosts          [][]MonthlyCost
 	anomalyDays           [][]AnomalyDayRecord
+	applianceCosts        [][]ApplianceCost
+	strategyComparisons   []StrategyComparison
+	configComparisons     []ConfigComparison
+	dailySummaries        []PeriodSummary
+	monthlySummaries      []PeriodSummary
+	events                []Event
+	flows                 []FlowSankey
 }
 
 func (m *mockCallback) OnState(s State) {
@@ -83,6 +93,102 @@ func (m *mockCallback) OnLoadShiftStats(stats LoadShiftStats) {}
 func (m *mockCallback) OnHPDiagnostics(HPDiagnostics)        {}
 func (m *mockCallback) OnPowerQuality(PowerQuality)           {}
 
+func (m *mockCallback) OnApplianceCosts(costs []ApplianceCost) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applianceCosts = append(m.applianceCosts, costs)
+}
+
+func (m *mockCallback) OnStrategyComparison(c StrategyComparison) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strategyComparisons = append(m.strategyComparisons, c)
+}
+
+func (m *mockCallback) OnDailySummary(s PeriodSummary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dailySummaries = append(m.dailySummaries, s)
+}
+
+func (m *mockCallback) OnMonthlySummary(s PeriodSummary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.monthlySummaries = append(m.monthlySummaries, s)
+}
+
+func (m *mockCallback) OnEvent(ev Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, ev)
+}
+
+func (m *mockCallback) OnConfigComparison(c ConfigComparison) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configComparisons = append(m.configComparisons, c)
+}
+
+func (m *mockCallback) OnMonthlyCosts(c []MonthlyCost) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.monthlyCosts = append(m.monthlyCosts, c)
+}
+
+func (m *mockCallback) OnFlowSankey(f FlowSankey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flows = append(m.flows, f)
+}
+
+func (m *mockCallback) eventsOfKind(kind EventKind) []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Event
+	for _, ev := range m.events {
+		if ev.Kind == kind {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func (m *mockCallback) lastApplianceCosts() []ApplianceCost {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.applianceCosts) == 0 {
+		return nil
+	}
+	return m.applianceCosts[len(m.applianceCosts)-1]
+}
+
+func (m *mockCallback) lastStrategyComparison() (StrategyComparison, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.strategyComparisons) == 0 {
+		return StrategyComparison{}, false
+	}
+	return m.strategyComparisons[len(m.strategyComparisons)-1], true
+}
+
+func (m *mockCallback) lastConfigComparison() (ConfigComparison, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.configComparisons) == 0 {
+		return ConfigComparison{}, false
+	}
+	return m.configComparisons[len(m.configComparisons)-1], true
+}
+
+func (m *mockCallback) lastMonthlyCosts() []MonthlyCost {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.monthlyCosts) == 0 {
+		return nil
+	}
+	return m.monthlyCosts[len(m.monthlyCosts)-1]
+}
+
 func (m *mockCallback) lastHeatingStats() []HeatingMonthStat {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -115,6 +221,89 @@ func TestSummary_OffGridCoverage(t *testing.T) {
 	// No battery savings, no self-consumption → 0%
 	empty := Summary{HomeDemandKWh: 500, HeatPumpKWh: 100}
 	assert.InDelta(t, 0.0, empty.OffGridCoverage(100, 100), 0.1)
+
+	// Base load at full usage matches the two-term result
+	assert.InDelta(t, 50.0, s.OffGridCoverageWithBaseLoad(100, 100, 200, 100), 0.1)
+
+	// Base load 200 always on, appliances halved: demand=400+200+200=800 → 62.5%
+	assert.InDelta(t, 62.5, s.OffGridCoverageWithBaseLoad(100, 50, 200, 100), 0.1)
+
+	// Only base load kept: demand=200, non-grid=500 → 100%
+	assert.InDelta(t, 100.0, s.OffGridCoverageWithBaseLoad(0, 0, 200, 100), 0.1)
+
+	// Base load larger than the appliance bucket is capped at it: demand=400+600 → 50%
+	assert.InDelta(t, 50.0, s.OffGridCoverageWithBaseLoad(100, 0, 900, 100), 0.1)
+
+	// Must-run load counts in full: demand=400+(600−200)×0.5+200=800 → 62.5%
+	mustRun := s
+	mustRun.MustRunKWh = 200
+	assert.InDelta(t, 62.5, mustRun.OffGridCoverage(100, 50), 0.1)
+	assert.InDelta(t, 100.0, mustRun.OffGridCoverage(0, 0), 0.1)
+	mustRun.SelfConsumptionKWh, mustRun.BatterySavingsKWh = 50, 50
+	assert.InDelta(t, 50.0, mustRun.OffGridCoverage(0, 0), 0.1)
+
+	// Same throughput at 90% round trip: non-grid=300+180 → 48%
+	ideal := s.OffGridCoverageWithEfficiency(100, 100, 0, 100, 1)
+	lossy := s.OffGridCoverageWithEfficiency(100, 100, 0, 100, 0.9)
+	assert.InDelta(t, 50.0, ideal, 0.1)
+	assert.InDelta(t, 48.0, lossy, 0.1)
+	assert.Less(t, lossy, ideal)
+	// Zero efficiency means unset, not a useless battery
+	assert.InDelta(t, ideal, s.OffGridCoverageWithEfficiency(100, 100, 0, 100, 0), 1e-9)
+}
+
+func TestEngine_MustRunLoadReducesOffGridCoverage(t *testing.T) {
+	// Two days of 4 kW PV from 08:00 to 16:00 under a 1 kW home load, with
+	// a 10 kWh battery shifting the surplus into the evening.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower, Unit: "W"})
+	for h := 0; h <= 48; h++ {
+		ts := startTime.Add(time.Duration(h) * hour)
+		pv := 0.0
+		if hr := ts.Hour(); hr >= 8 && hr < 16 {
+			pv = 4000
+		}
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000 - pv, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.pv", Type: model.SensorPVPower, Value: pv, Unit: "W"},
+		})
+	}
+	run := func(baseLoadW float64) Summary {
+		e := New(s, &mockCallback{})
+		require.True(t, e.Init())
+		e.SetBattery(&BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100})
+		e.SetMustRunLoad(baseLoadW)
+		e.Step(48 * hour)
+		return e.CurrentSummary()
+	}
+
+	plain, loaded := run(0), run(500)
+	assert.Zero(t, plain.MustRunKWh)
+	assert.InDelta(t, 24, loaded.MustRunKWh, 1e-9)
+	// Home demand also picks up the battery's extra conversion losses.
+	assert.InDelta(t, plain.HomeDemandKWh+24, loaded.HomeDemandKWh, 1)
+	assert.Greater(t, loaded.GridImportKWh, plain.GridImportKWh)
+	assert.Less(t, loaded.OffGridCoverage(100, 100), plain.OffGridCoverage(100, 100)-5)
+
+	// Removing more load than the home draws leaves zero demand, not export
+	// beyond the PV.
+	removed := run(-2000)
+	assert.Zero(t, removed.MustRunKWh)
+	assert.Zero(t, removed.GridImportKWh)
+	assert.LessOrEqual(t, removed.GridExportKWh, removed.PVProductionKWh)
+}
+
+func TestEngine_MustRunLoadChangedMidRun(t *testing.T) {
+	e := New(makeStore([]float64{1000, 1000, 1000, 1000, 1000}), &mockCallback{})
+	require.True(t, e.Init())
+	e.Step(2 * hour)
+	e.SetMustRunLoad(500)
+	e.Step(2 * hour)
+
+	// Only from the change on: the interval spanning it (13:00–14:00)
+	// averages 250 W, the two after it 500 W, instead of 4 h at 500 W.
+	assert.InDelta(t, 1.25, e.CurrentSummary().MustRunKWh, 1e-9)
 }
 
 func (m *mockCallback) readingCount() int {
@@ -205,6 +394,87 @@ func TestEngine_StartPause(t *testing.T) {
 	assert.False(t, e.State().Running)
 }
 
+func TestEngine_SetTickInterval(t *testing.T) {
+	ticksIn := func(interval time.Duration) int {
+		cb := &mockCallback{}
+		e := New(makeStore([]float64{100, 200, 300}), cb)
+		e.Init()
+		e.SetSpeed(1) // the 2 h range outlasts the test
+		e.SetTickInterval(interval)
+		e.Start()
+		time.Sleep(300 * time.Millisecond)
+		e.Stop()
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+		return len(cb.states)
+	}
+
+	fast, slow := ticksIn(10*time.Millisecond), ticksIn(100*time.Millisecond)
+	assert.Greater(t, fast, 2*slow, "fast=%d slow=%d", fast, slow)
+}
+
+func TestEngine_SetTickIntervalWhileRunning(t *testing.T) {
+	cb := &mockCallback{}
+	e := New(makeStore([]float64{100, 200, 300}), cb)
+	e.Init()
+	e.SetSpeed(1)
+	e.SetTickInterval(time.Hour) // clamped from below only; no ticks yet
+	e.Start()
+	time.Sleep(50 * time.Millisecond)
+	cb.mu.Lock()
+	before := len(cb.states)
+	cb.mu.Unlock()
+
+	e.SetTickInterval(0) // clamped to minTickInterval
+	time.Sleep(200 * time.Millisecond)
+	e.Stop()
+	assert.Equal(t, minTickInterval, e.tickInterval)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	assert.Greater(t, len(cb.states), before+5)
+}
+
+func TestEngine_Stop(t *testing.T) {
+	s := makeStore([]float64{100, 200, 300})
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetSpeed(1) // slow enough that the loop is still running when stopped
+
+	e.Start()
+	done := e.loopDone
+	require.True(t, e.State().Running)
+
+	stopped := make(chan struct{})
+	go func() {
+		e.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return")
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("loop goroutine still running after Stop")
+	}
+	assert.False(t, e.State().Running)
+
+	// Idempotent when already stopped
+	assert.NotPanics(t, e.Stop)
+}
+
+func TestEngine_StopNotStarted(t *testing.T) {
+	e := New(makeStore([]float64{100, 200}), &mockCallback{})
+	e.Init()
+
+	assert.NotPanics(t, e.Stop)
+	assert.False(t, e.State().Running)
+}
+
 func TestEngine_SetSpeed(t *testing.T) {
 	s := makeStore([]float64{100, 200, 300})
 	cb := &mockCallback{}
@@ -224,6 +494,28 @@ func TestEngine_SetSpeed(t *testing.T) {
 	assert.Equal(t, 2592000.0, e.State().Speed)
 }
 
+func TestEngine_SetSpeedToFinishIn(t *testing.T) {
+	// 5 hourly readings → 4h span
+	e := New(makeStore([]float64{100, 200, 300, 400, 500}), &mockCallback{})
+	e.Init()
+
+	// 4h remaining in 2 minutes → 120x
+	speed := e.SetSpeedToFinishIn(2 * time.Minute)
+	assert.InDelta(t, 120.0, speed, 1e-9)
+	assert.InDelta(t, 120.0, e.State().Speed, 1e-9)
+
+	// After seeking 1h in, 3h remaining in 36s → 300x
+	e.Seek(startTime.Add(hour))
+	assert.InDelta(t, 300.0, e.SetSpeedToFinishIn(36*time.Second), 1e-9)
+
+	// Clamped to the SetSpeed bounds
+	assert.Equal(t, 0.1, e.SetSpeedToFinishIn(1000*time.Hour))
+	assert.Equal(t, 2592000.0, e.SetSpeedToFinishIn(time.Nanosecond))
+
+	// Non-positive duration leaves speed unchanged
+	assert.Equal(t, 2592000.0, e.SetSpeedToFinishIn(0))
+}
+
 func TestEngine_Seek(t *testing.T) {
 	s := makeStore([]float64{100, 200, 300, 400, 500})
 	cb := &mockCallback{}
@@ -272,6 +564,69 @@ func TestEngine_Step_ToEnd(t *testing.T) {
 	assert.Equal(t, startTime.Add(2*hour), e.State().Time)
 }
 
+func TestEngine_EndLoop(t *testing.T) {
+	s := makeStore([]float64{100, 200, 300})
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetEndBehavior(EndLoop)
+
+	// Reaching the end wraps back to the start with fresh accumulators.
+	e.Step(10 * hour)
+	assert.Equal(t, 3, cb.readingCount())
+	assert.Equal(t, startTime, e.State().Time)
+	assert.Equal(t, 0.0, cb.lastSummary().TotalKWh)
+
+	// The next pass re-emits the first readings.
+	e.Step(90 * time.Minute)
+	readings := cb.allReadings()
+	require.Len(t, readings, 5)
+	assert.Equal(t, startTime.Format(time.RFC3339), readings[3].Timestamp)
+	assert.InDelta(t, 100.0, readings[3].Value, 0.001)
+	assert.InDelta(t, 200.0, readings[4].Value, 0.001)
+
+	// The live loop keeps running through the wrap.
+	e.SetSpeed(10 * 3600)
+	e.mu.Lock()
+	e.running = true
+	e.mu.Unlock()
+	assert.False(t, e.tick(), "loop never ends")
+	assert.True(t, e.State().Running)
+	assert.Equal(t, startTime, e.State().Time)
+}
+
+func TestEngine_EndHold(t *testing.T) {
+	s := makeStore([]float64{100, 200, 300})
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetEndBehavior(EndHold)
+	e.mu.Lock()
+	e.running = true
+	e.mu.Unlock()
+
+	e.Step(10 * hour)
+	assert.Equal(t, startTime.Add(2*hour), e.State().Time)
+	assert.True(t, e.State().Running, "hold keeps running at the end")
+	kwh := cb.lastSummary().TotalKWh
+
+	// Further steps and ticks do not re-emit the final reading.
+	e.Step(hour)
+	assert.False(t, e.tick())
+	assert.Equal(t, 3, cb.readingCount())
+	assert.Equal(t, kwh, cb.lastSummary().TotalKWh)
+}
+
+func TestParseEndBehavior(t *testing.T) {
+	for _, s := range []string{"stop", "loop", "hold"} {
+		b, err := ParseEndBehavior(s)
+		require.NoError(t, err)
+		assert.Equal(t, EndBehavior(s), b)
+	}
+	_, err := ParseEndBehavior("rewind")
+	assert.Error(t, err)
+}
+
 func TestEngine_EnergySummary(t *testing.T) {
 	// 2 readings, 1 hour apart, both 1000W -> 1000 Wh = 1 kWh
 	s := makeStore([]float64{1000, 1000})
@@ -317,6 +672,101 @@ func TestEngine_SeekResetsEnergy(t *testing.T) {
 	assert.InDelta(t, 0.0, cb.lastSummary().TotalKWh, 0.01)
 }
 
+func TestEngine_CumulativeCounterDelta(t *testing.T) {
+	s := makeStore([]float64{1000, 1000, 1000, 1000, 1000})
+	s.AddSensor(model.Sensor{ID: "sensor.heater_hours", Name: "Backup Heater Room Hours", Type: model.SensorPumpHeaterRoom, Unit: "h"})
+	// Counter climbs 100 -> 105, resets, then climbs 1 -> 3.
+	counter := []float64{100, 102, 105, 1, 3}
+	readings := make([]model.Reading, len(counter))
+	for i, v := range counter {
+		readings[i] = model.Reading{
+			Timestamp: startTime.Add(time.Duration(i) * hour),
+			SensorID:  "sensor.heater_hours",
+			Type:      model.SensorPumpHeaterRoom,
+			Value:     v,
+			Unit:      "h",
+		}
+	}
+	s.AddReadings(readings)
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+
+	e.Step(5 * hour)
+
+	summary := cb.lastSummary()
+	assert.InDelta(t, 8.0, summary.Counters[model.SensorPumpHeaterRoom], 1e-9)
+	// Grid energy is still integrated as power
+	assert.InDelta(t, 4.0, summary.TotalKWh, 0.01)
+}
+
+func TestEngine_ReactivePenalty(t *testing.T) {
+	tests := []struct {
+		name        string
+		reactive    []float64 // cumulative kvarh
+		wantPenalty float64
+	}{
+		// 3 kWh imported allows 1.2 kvarh at tan φ 0.4; 1.8 kvarh excess at 0.65 PLN
+		{"above tan phi", []float64{10, 11, 12, 13}, 1.8 * 0.65},
+		{"below tan phi", []float64{10, 10.3, 10.6, 10.9}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := makeStore([]float64{1000, 1000, 1000, 1000})
+			s.AddSensor(model.Sensor{ID: "sensor.reactive", Name: "Reactive Energy", Type: model.SensorGridEnergyReactive, Unit: "kvarh"})
+			for i, v := range tt.reactive {
+				s.AddReadings([]model.Reading{{
+					Timestamp: startTime.Add(time.Duration(i) * hour),
+					SensorID:  "sensor.reactive",
+					Type:      model.SensorGridEnergyReactive,
+					Value:     v,
+					Unit:      "kvarh",
+				}})
+			}
+			cb := &mockCallback{}
+			e := New(s, cb)
+			e.Init()
+			e.Step(4 * hour)
+
+			summary := cb.lastSummary()
+			assert.InDelta(t, 3.0, summary.GridImportKWh, 1e-9)
+			assert.InDelta(t, tt.wantPenalty, summary.ReactivePenaltyPLN, 1e-9)
+		})
+	}
+
+	// Without a reactive energy sensor there is nothing to penalize.
+	cb := &mockCallback{}
+	e := New(makeStore([]float64{1000, 1000}), cb)
+	e.Init()
+	e.Step(2 * hour)
+	assert.Zero(t, cb.lastSummary().ReactivePenaltyPLN)
+}
+
+func TestEngine_ReactivePenaltyPerMonth(t *testing.T) {
+	// 2 kWh imported in January with 2 kvarh, 3 kWh in February with none:
+	// the whole run stays within tan φ 0.4, but January alone does not.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.reactive", Name: "Reactive Energy", Type: model.SensorGridEnergyReactive, Unit: "kvarh"})
+	start := time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC)
+	reactive := []float64{0, 1, 2, 2, 2, 2}
+	for i, v := range reactive {
+		ts := start.Add(time.Duration(i) * hour)
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.reactive", Type: model.SensorGridEnergyReactive, Value: v, Unit: "kvarh"},
+		})
+	}
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.Step(6 * hour)
+
+	summary := cb.lastSummary()
+	assert.InDelta(t, 5.0, summary.GridImportKWh, 1e-9)
+	assert.InDelta(t, (2-0.4*2)*0.65, summary.ReactivePenaltyPLN, 1e-9)
+}
+
 func TestEngine_TimeRange(t *testing.T) {
 	s := makeStore([]float64{100, 200, 300})
 	cb := &mockCallback{}
@@ -352,6 +802,35 @@ func TestEngine_SetTimeRange(t *testing.T) {
 	assert.InDelta(t, 0.0, cb.lastSummary().TotalKWh, 0.001)
 }
 
+func TestEngine_ExtendTimeRange(t *testing.T) {
+	s := makeStore([]float64{100, 200, 300})
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+
+	e.Step(2 * hour) // reached the end
+	summaryBefore := cb.lastSummary()
+
+	newEnd := startTime.Add(4 * hour)
+	s.AppendReadings([]model.Reading{
+		{Timestamp: startTime.Add(3 * hour), SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 400, Unit: "W"},
+		{Timestamp: newEnd, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 500, Unit: "W"},
+	})
+	e.ExtendTimeRange(newEnd)
+
+	assert.Equal(t, newEnd, e.TimeRange().End)
+	assert.Equal(t, startTime.Add(2*hour), e.State().Time, "extending must not seek")
+
+	// Replay continues into the new data and keeps accumulating
+	e.Step(2 * hour)
+	assert.Equal(t, newEnd, e.State().Time)
+	assert.Greater(t, cb.lastSummary().TotalKWh, summaryBefore.TotalKWh)
+
+	// Earlier end is ignored
+	e.ExtendTimeRange(startTime)
+	assert.Equal(t, newEnd, e.TimeRange().End)
+}
+
 func TestEngine_SetTimeRange_ResetsAndReplays(t *testing.T) {
 	s := makeStore([]float64{100, 200, 300, 400, 500})
 	cb := &mockCallback{}
@@ -461,6 +940,42 @@ func TestEngine_BatteryAbsorbsExport(t *testing.T) {
 	assert.Greater(t, bu.AdjustedGridW, -1500.0) // less export to grid
 }
 
+func TestEngine_BatteryReclaimsCurtailment(t *testing.T) {
+	run := func(voltage float64) BatterySummary {
+		s := makeStore([]float64{-1000, -1000, -1000})
+		s.AddSensor(model.Sensor{ID: "sensor.voltage", Name: "Grid Voltage", Type: model.SensorGridVoltage, Unit: "V"})
+		var readings []model.Reading
+		for i := range 3 {
+			readings = append(readings, model.Reading{
+				Timestamp: startTime.Add(time.Duration(i) * hour), SensorID: "sensor.voltage",
+				Type: model.SensorGridVoltage, Value: voltage, Unit: "V",
+			})
+		}
+		s.AddReadings(readings)
+
+		cb := &mockCallback{}
+		e := New(s, cb)
+		e.Init()
+		e.SetBattery(&BatteryConfig{
+			CapacityKWh:         20,
+			MaxPowerW:           5000,
+			ChargeToPercent:     100,
+			CurtailmentVoltageV: 253,
+		})
+		e.Step(3 * hour)
+		return cb.lastBatterySummary()
+	}
+
+	// Two export intervals at 255 V: 5 kW charge vs 1 kW recorded export.
+	high := run(255)
+	assert.InDelta(t, 8.0, high.ReclaimedKWh, 0.01)
+	assert.InDelta(t, 50, high.SoCPercent, 0.01)
+
+	low := run(240)
+	assert.Zero(t, low.ReclaimedKWh)
+	assert.InDelta(t, 10, low.SoCPercent, 0.01)
+}
+
 func TestEngine_SeekResetsBattery(t *testing.T) {
 	s := makeStore([]float64{1000, 1000, 1000, 1000})
 	cb := &mockCallback{}
@@ -600,6 +1115,19 @@ func TestEngine_PVAccumulation(t *testing.T) {
 	assert.InDelta(t, 1.0, summary.PVProductionKWh, 0.01)
 }
 
+func TestEngine_CalibratedPV(t *testing.T) {
+	s := makeEnergyStore()
+	s.SetCalibration("sensor.pv", 1.03, 0)
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+
+	e.Step(2 * hour)
+
+	// 1.0 kWh measured, the meter reads 3% low
+	assert.InDelta(t, 1.03, cb.lastSummary().PVProductionKWh, 1e-6)
+}
+
 func TestEngine_HeatPumpAccumulation(t *testing.T) {
 	s := makeEnergyStore()
 	cb := &mockCallback{}
@@ -679,39 +1207,128 @@ func TestEngine_ArbitrageSavings(t *testing.T) {
 	assert.Less(t, summary.ArbNetCostPLN, summary.RawNetCostPLN, "arb should cost less than raw")
 }
 
-func TestEngine_BatterySavings(t *testing.T) {
-	// 3 readings at 2000W consumption, battery fully offsets
-	s := makeStore([]float64{2000, 2000, 2000})
+func TestEngine_HybridOutperformsPureStrategies(t *testing.T) {
+	// Two identical days with both a price spread and PV surplus:
+	// hours 0-7 cheap night, 8-9 expensive morning, 10-15 PV export at a
+	// mid price, 16-23 expensive evening.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+
+	base := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	var gridReadings, priceReadings []model.Reading
+	for h := 0; h < 48; h++ {
+		ts := base.Add(time.Duration(h) * hour)
+		grid, price := 1500.0, 1.00
+		switch hod := h % 24; {
+		case hod < 8:
+			grid, price = 1000, 0.20
+		case hod < 10:
+			grid = 2000
+		case hod < 16:
+			grid, price = -3000, 0.60
+		}
+		gridReadings = append(gridReadings, model.Reading{
+			Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid, Unit: "W",
+		})
+		priceReadings = append(priceReadings, model.Reading{
+			Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price, Unit: "PLN/kWh",
+		})
+	}
+	s.AddReadings(gridReadings)
+	s.AddReadings(priceReadings)
+
 	cb := &mockCallback{}
 	e := New(s, cb)
 	e.Init()
-
+	e.SetPriceSensor("sensor.price")
 	e.SetBattery(&BatteryConfig{
 		CapacityKWh:        10,
 		MaxPowerW:          5000,
-		DischargeToPercent: 0,
+		DischargeToPercent: 10,
 		ChargeToPercent:    100,
 	})
-	e.mu.Lock()
-	e.battery.SoCWh = 5000
-	e.mu.Unlock()
 
-	e.Step(3 * hour)
+	e.Step(48 * hour)
 
 	summary := cb.lastSummary()
-	// Raw grid import: 2000W * 2h = 4000 Wh = 4.0 kWh
-	// With battery, adjusted grid = 0 for intervals 2+3 (backward-looking)
-	// Battery savings = rawImport - adjustedImport > 0
-	assert.Greater(t, summary.BatterySavingsKWh, 0.0)
+	assert.Greater(t, summary.HybridBatterySavingsPLN, 0.0)
+	assert.Less(t, summary.HybridNetCostPLN, summary.NetCostPLN, "hybrid should beat self-consumption")
+	assert.Less(t, summary.HybridNetCostPLN, summary.ArbNetCostPLN, "hybrid should beat arbitrage")
+	assert.InDelta(t, summary.RawNetCostPLN-summary.HybridNetCostPLN, summary.HybridBatterySavingsPLN, 1e-9)
 }
 
-func (m *mockCallback) lastArbitrageDayLog() []ArbitrageDayRecord {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if len(m.arbitrageDayLogs) == 0 {
-		return nil
-	}
-	return m.arbitrageDayLogs[len(m.arbitrageDayLogs)-1]
+func TestEngine_ThermalValidationRMSE(t *testing.T) {
+	// Outdoor equals indoor and the heat pump is off, so the model holds the
+	// seeded 21 °C while the measured series swings ±1 °C around it.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.hp", Name: "HP", Type: model.SensorPumpConsumption, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.out", Name: "Outdoor", Type: model.SensorPumpExtTemp, Unit: "°C"})
+	s.AddSensor(model.Sensor{ID: "sensor.living", Name: "Living", Type: model.SensorNetatmoLivingTemp, Unit: "°C"})
+
+	base := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for h := 0; h < 12; h++ {
+		ts := base.Add(time.Duration(h) * hour)
+		indoor := 21.0
+		if h >= 2 {
+			indoor = 21 + float64(1-2*(h%2))
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.hp", Type: model.SensorPumpConsumption, Value: 0, Unit: "W"},
+			model.Reading{Timestamp: ts, SensorID: "sensor.out", Type: model.SensorPumpExtTemp, Value: 21, Unit: "°C"},
+			model.Reading{Timestamp: ts, SensorID: "sensor.living", Type: model.SensorNetatmoLivingTemp, Value: indoor, Unit: "°C"},
+		)
+	}
+	s.AddReadings(readings)
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetTempSensor("sensor.out")
+	e.SetIndoorTempSensor("sensor.living")
+
+	e.Step(11 * hour)
+
+	summary := cb.lastSummary()
+	// Readings at h0 (baseline) and h1 (seed) produce no sample.
+	assert.Equal(t, 10, summary.ThermalSamples)
+	assert.InDelta(t, 1.0, summary.ThermalRMSEC, 1e-9)
+}
+
+func TestEngine_BatterySavings(t *testing.T) {
+	// 3 readings at 2000W consumption, battery fully offsets
+	s := makeStore([]float64{2000, 2000, 2000})
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+
+	e.SetBattery(&BatteryConfig{
+		CapacityKWh:        10,
+		MaxPowerW:          5000,
+		DischargeToPercent: 0,
+		ChargeToPercent:    100,
+	})
+	e.mu.Lock()
+	e.battery.SoCWh = 5000
+	e.mu.Unlock()
+
+	e.Step(3 * hour)
+
+	summary := cb.lastSummary()
+	// Raw grid import: 2000W * 2h = 4000 Wh = 4.0 kWh
+	// With battery, adjusted grid = 0 for intervals 2+3 (backward-looking)
+	// Battery savings = rawImport - adjustedImport > 0
+	assert.Greater(t, summary.BatterySavingsKWh, 0.0)
+}
+
+func (m *mockCallback) lastArbitrageDayLog() []ArbitrageDayRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.arbitrageDayLogs) == 0 {
+		return nil
+	}
+	return m.arbitrageDayLogs[len(m.arbitrageDayLogs)-1]
 }
 
 func TestEngine_ArbitrageDayLog(t *testing.T) {
@@ -773,6 +1390,45 @@ func TestEngine_ArbitrageDayLog(t *testing.T) {
 		rec.CyclesDelta, rec.EarningsPLN)
 }
 
+func TestEngine_ArbitragePriceBands(t *testing.T) {
+	// Same fixture as TestEngine_ArbitrageDayLog: 0.20 PLN hours 0-7, 0.80 otherwise.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	base := time.Date(2024, 11, 21, 0, 0, 0, 0, time.UTC)
+	for h := 0; h < 49; h++ {
+		ts := base.Add(time.Duration(h) * hour)
+		price := 0.80
+		if h%24 < 8 {
+			price = 0.20
+		}
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price, Unit: "PLN/kWh"},
+		})
+	}
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	e.SetBattery(&BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 10, ChargeToPercent: 100})
+	e.Step(49 * hour)
+
+	bs := cb.lastBatterySummary()
+	require.NotEmpty(t, bs.ArbChargeKWhByPrice)
+	require.NotEmpty(t, bs.ArbDischargeKWhByPrice)
+	for band, kWh := range bs.ArbChargeKWhByPrice {
+		assert.Equal(t, 20, band, "charging only in the cheap band")
+		assert.Greater(t, kWh, 0.0)
+	}
+	for band := range bs.ArbDischargeKWhByPrice {
+		assert.Equal(t, 80, band, "discharging only in the expensive band")
+	}
+	// Two days filling from the 10% floor to full: 9 kWh each.
+	assert.InDelta(t, 18.0, bs.ArbChargeKWhByPrice[20], 1e-6)
+}
+
 func TestEngine_ArbitrageDayLog_NonOverlappingWindowsAndGap(t *testing.T) {
 	// 48 hours across 2 days with price data that could cause interleaving:
 	// Hours 0-5: cheap (0.10) → charge
@@ -934,6 +1590,149 @@ func TestEngine_CheapExportTracking(t *testing.T) {
 	assert.InDelta(t, 3.0, summary.GridExportKWh, 0.01, "total export should be 3 kWh")
 }
 
+func TestEngine_CheapExportPercentile(t *testing.T) {
+	// Four days of constant 1 kW export with prices rising 0.01 PLN/kWh per
+	// hour within a day and 0.30 PLN/kWh from day to day, like a season
+	// moving from cheap to expensive energy.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	for h := 0; h <= 4*24; h++ {
+		ts := startTime.Add(time.Duration(h) * hour)
+		price := 0.05 + 0.30*float64(h/24) + 0.01*float64(h%24)
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: -1000, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price, Unit: "PLN/kWh"},
+		})
+	}
+	run := func(pct int) Summary {
+		cb := &mockCallback{}
+		e := New(s, cb)
+		e.Init()
+		e.SetPriceSensor("sensor.price")
+		e.SetPriceThreshold(0.1)
+		e.SetCheapExportPercentile(pct)
+		e.Step(4 * 24 * hour)
+		return cb.lastSummary()
+	}
+
+	// Fixed 0.10 PLN/kWh: only the first day's early hours (intervals ending
+	// 01:00–04:00) are cheap.
+	fixed := run(0)
+	assert.InDelta(t, 4.0, fixed.CheapExportKWh, 0.001)
+
+	// Daily P25 (the 6th cheapest of 24 hourly prices, 00:00–04:00 below it):
+	// the cheapest hours of every day count, including the expensive days
+	// the fixed threshold never flags. Day one misses its first interval.
+	pct := run(25)
+	assert.InDelta(t, 4.0+5+5+5, pct.CheapExportKWh, 0.001)
+	assert.Greater(t, pct.CheapExportRevPLN, 2*fixed.CheapExportRevPLN)
+	assert.Equal(t, fixed.GridExportKWh, pct.GridExportKWh)
+}
+
+func TestEngine_InverterStandby(t *testing.T) {
+	// A month of steady import; an empty battery has nothing to offset, so
+	// the only difference between runs is the inverter standby draw.
+	const hours = 30 * 24
+	grid := make([]float64, hours)
+	for i := range grid {
+		grid[i] = 1000
+	}
+	run := func(standbyW float64) Summary {
+		cb := &mockCallback{}
+		e := New(makeStoreWithPrices(grid, 0.50), cb)
+		e.Init()
+		e.SetPriceSensor("sensor.price")
+		e.SetBattery(&BatteryConfig{
+			CapacityKWh:      10,
+			MaxPowerW:        5000,
+			ChargeToPercent:  100,
+			InverterStandbyW: standbyW,
+		})
+		e.Step(hours * hour)
+		return cb.lastSummary()
+	}
+
+	base := run(0)
+	standby := run(30)
+	// 30 W over 719 intervals = 21.57 kWh at 0.50 PLN/kWh; costs are
+	// rounded to grosze
+	assert.InDelta(t, 21.57, standby.GridImportKWh-base.GridImportKWh, 1e-6)
+	assert.InDelta(t, 21.57*0.50, standby.NetCostPLN-base.NetCostPLN, 0.01)
+	// The no-battery baseline never pays for standby.
+	assert.InDelta(t, base.RawNetCostPLN, standby.RawNetCostPLN, 1e-9)
+}
+
+func TestEngine_StrategyComparison(t *testing.T) {
+	// Two days alternating PV export and evening import with a cheap night
+	// and an expensive evening, so every strategy sees different costs.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	for i := 0; i < 48; i++ {
+		ts := startTime.Add(time.Duration(i) * hour)
+		grid, price := 500.0, 0.6
+		switch h := ts.Hour(); {
+		case h < 6:
+			price = 0.2
+		case h >= 10 && h < 15:
+			grid = -2000
+		case h >= 17 && h < 21:
+			grid, price = 2500, 1.5
+		}
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price, Unit: "PLN/kWh"},
+		})
+	}
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	e.SetBattery(&BatteryConfig{CapacityKWh: 10, MaxPowerW: 5000, ChargeToPercent: 100})
+	e.Step(48 * hour)
+
+	summary := cb.lastSummary()
+	comp, ok := cb.lastStrategyComparison()
+	require.True(t, ok)
+
+	want := map[string]float64{
+		StrategyNoBattery:       summary.RawNetCostPLN,
+		StrategySelfConsumption: summary.NetCostPLN,
+		StrategyArbitrage:       summary.ArbNetCostPLN,
+		StrategyHybrid:          summary.HybridNetCostPLN,
+		StrategyNetMetering:     summary.NMNetCostPLN,
+		StrategyNetBilling:      summary.NBNetCostPLN,
+	}
+	require.Len(t, comp.Strategies, len(want))
+	best := 0
+	for i, r := range comp.Strategies {
+		assert.InDelta(t, want[r.Name], r.NetCostPLN, 1e-9, r.Name)
+		assert.InDelta(t, summary.RawNetCostPLN-r.NetCostPLN, r.SavingsPLN, 1e-9, r.Name)
+		if i > 0 {
+			assert.LessOrEqual(t, comp.Strategies[i-1].NetCostPLN, r.NetCostPLN)
+		}
+		if r.Best {
+			best++
+		}
+	}
+	assert.Equal(t, 1, best)
+	assert.True(t, comp.Strategies[0].Best)
+	assert.Equal(t, comp.Strategies[0].Name, comp.Best)
+	for _, cost := range want {
+		assert.LessOrEqual(t, comp.Strategies[0].NetCostPLN, cost)
+	}
+}
+
+func TestEngine_StrategyComparisonNeedsPrices(t *testing.T) {
+	cb := &mockCallback{}
+	e := New(makeStore([]float64{1000, 1000}), cb)
+	e.Init()
+	e.Step(2 * hour)
+	_, ok := cb.lastStrategyComparison()
+	assert.False(t, ok)
+}
+
 func makeStoreWithPrices(gridValues []float64, price float64) *store.Store {
 	s := store.New()
 	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
@@ -992,6 +1791,61 @@ func TestEngine_NetMeteringCreditBank(t *testing.T) {
 	assert.InDelta(t, 1.6, summary.NMCreditBankKWh, 0.01)
 }
 
+func TestEngine_NetMeteringCreditExpiryEvent(t *testing.T) {
+	// 1.6 kWh credited in November 2024, next import in December 2025:
+	// the bucket is over 12 months old and expires instead of offsetting it.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	later := time.Date(2025, 12, 21, 12, 0, 0, 0, time.UTC)
+	add := func(ts time.Time, w float64) {
+		s.AddReadings([]model.Reading{{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: w, Unit: "W"}})
+	}
+	add(startTime, -1000)
+	add(startTime.Add(hour), -1000)
+	add(startTime.Add(2*hour), -1000)
+	add(startTime.Add(3*hour), 0)
+	add(later, 0)
+	add(later.Add(hour), 2000)
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.Step(3 * hour)
+	assert.Empty(t, cb.eventsOfKind(EventNMCreditExpired))
+
+	e.Step(later.Add(hour).Sub(startTime.Add(3 * hour)))
+
+	expired := cb.eventsOfKind(EventNMCreditExpired)
+	require.Len(t, expired, 1)
+	assert.InDelta(t, 2.0, expired[0].Value, 0.01) // 2.5 kWh exported × 0.8
+	assert.Equal(t, later.Add(hour).Format(time.RFC3339), expired[0].Timestamp)
+	assert.Contains(t, expired[0].Message, "2024-11")
+
+	summary := cb.lastSummary()
+	assert.InDelta(t, 0, summary.NMCreditBankKWh, 0.001)
+	assert.InDelta(t, 1.0*0.65, summary.NMNetCostPLN, 0.001) // 1 kWh at full tariff
+}
+
+func TestEngine_BatteryLimitEvents(t *testing.T) {
+	// 2 kW export fills a 2 kWh battery from its 10% floor in the first
+	// hour; then 2 kW import drains it back to the floor in one hour.
+	s := makeStore([]float64{-2000, -2000, -2000, 2000, 2000, 2000})
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetBattery(&BatteryConfig{CapacityKWh: 2, MaxPowerW: 2000, DischargeToPercent: 10, ChargeToPercent: 100})
+	e.Step(6 * hour)
+
+	full := cb.eventsOfKind(EventBatteryFull)
+	require.Len(t, full, 1, "idling at the ceiling must not repeat the event")
+	assert.Equal(t, startTime.Add(hour).Format(time.RFC3339), full[0].Timestamp)
+	assert.InDelta(t, 100, full[0].Value, 0.01)
+
+	empty := cb.eventsOfKind(EventBatteryEmpty)
+	require.Len(t, empty, 1, "starting at the floor is not an event")
+	assert.Equal(t, startTime.Add(4*hour).Format(time.RFC3339), empty[0].Timestamp)
+}
+
 func TestEngine_NetBillingDeposit(t *testing.T) {
 	// Export only: 3 readings at -1000W = 2 kWh export
 	// Valued at RCEm (monthly avg spot price = 0.50)
@@ -1030,6 +1884,34 @@ func TestEngine_NetBillingImportOffset(t *testing.T) {
 	assert.InDelta(t, 0.0, summary.NBDepositPLN, 0.01)
 }
 
+func TestEngine_TOUTariffHolidayBilling(t *testing.T) {
+	// 1 kWh imported 09:00-10:00 on a Wednesday, billed under net billing.
+	run := func(day time.Time, tou *TOUTariff) float64 {
+		s := store.New()
+		s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+		s.AddReadings([]model.Reading{
+			{Timestamp: day.Add(9 * time.Hour), SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+			{Timestamp: day.Add(10 * time.Hour), SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+		})
+		cb := &mockCallback{}
+		e := New(s, cb)
+		e.Init()
+		e.SetTOUTariff(tou)
+		e.Step(2 * hour)
+		return cb.lastSummary().NBNetCostPLN
+	}
+
+	cal, err := NewHolidayCalendar(true, nil)
+	require.NoError(t, err)
+	tou := &TOUTariff{PeakPLN: 1.10, OffPeakPLN: 0.60, Holidays: cal}
+	labourDay := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	workday := time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)
+
+	assert.InDelta(t, 0.60, run(labourDay, tou), 0.001, "holiday billed off-peak")
+	assert.InDelta(t, 1.10, run(workday, tou), 0.001, "workday billed peak")
+	assert.InDelta(t, 0.65, run(labourDay, nil), 0.001, "no TOU: fixed tariff")
+}
+
 func TestEngine_NetMeteringResetOnSeek(t *testing.T) {
 	s := makeStoreWithPrices([]float64{-1000, -1000, -1000, 1000, 1000}, 0.50)
 	cb := &mockCallback{}
@@ -1259,3 +2141,573 @@ func TestEngine_HeatingMonthStatsResetOnSeek(t *testing.T) {
 	stats := cb.lastHeatingStats()
 	assert.Empty(t, stats)
 }
+
+func TestEngine_OptimizePVOrientation(t *testing.T) {
+	s := makeStore([]float64{500, 500, 500})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Name: "PV Power", Type: model.SensorPVPower, Unit: "W"})
+	// East-facing PV: bell curve peaking at 10:00 over a few June days
+	june := time.Date(2024, time.June, 10, 0, 0, 0, 0, time.UTC)
+	var pv []model.Reading
+	for d := 0; d < 3; d++ {
+		for h := 4; h <= 16; h++ {
+			dist := float64(h - 10)
+			pv = append(pv, model.Reading{
+				Timestamp: june.AddDate(0, 0, d).Add(time.Duration(h) * hour),
+				SensorID:  "sensor.pv",
+				Type:      model.SensorPVPower,
+				Value:     5000 * (1 - dist*dist/49),
+				Unit:      "W",
+			})
+		}
+	}
+	s.AddReadings(pv)
+
+	e := New(s, &mockCallback{})
+	e.Init()
+
+	result, ok := e.OptimizePVOrientation(solar.ObjectiveTotalEnergy, 4000)
+	require.True(t, ok)
+	assert.NotEmpty(t, result.Surface)
+	// Base profile is east-facing: rotating away truncates generation at sunrise/sunset
+	assert.InDelta(t, 90, result.Best.Azimuth, 15)
+	assert.Greater(t, result.Best.EnergyKWh, 0.0)
+}
+
+func TestEngine_OptimizePVOrientation_NoPVData(t *testing.T) {
+	e := New(makeStore([]float64{100, 200}), &mockCallback{})
+	e.Init()
+
+	_, ok := e.OptimizePVOrientation(solar.ObjectiveTotalEnergy, 4000)
+	assert.False(t, ok)
+}
+
+func TestEngine_ApplianceCosts(t *testing.T) {
+	// Prices: 0.50 PLN/kWh for the first two hours, then 2.00 PLN/kWh.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	s.AddSensor(model.Sensor{ID: "sensor.oven", Name: "Oven", Type: model.SensorOven, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.washing", Name: "Washing Machine", Type: model.SensorWashing, Unit: "W"})
+	prices := []float64{0.5, 0.5, 2.0, 2.0, 2.0}
+	var priceReadings []model.Reading
+	for i, p := range prices {
+		priceReadings = append(priceReadings, model.Reading{
+			Timestamp: startTime.Add(time.Duration(i) * hour), SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: p,
+		})
+	}
+	s.AddReadings(priceReadings)
+	// Oven draws 1 kW in the cheap hour, washing 2 kW in the expensive one.
+	s.AddReadings([]model.Reading{
+		{Timestamp: startTime, SensorID: "sensor.oven", Type: model.SensorOven, Value: 1000},
+		{Timestamp: startTime.Add(hour), SensorID: "sensor.oven", Type: model.SensorOven, Value: 1000},
+	})
+	s.AddReadings([]model.Reading{
+		{Timestamp: startTime.Add(3 * hour), SensorID: "sensor.washing", Type: model.SensorWashing, Value: 2000},
+		{Timestamp: startTime.Add(4 * hour), SensorID: "sensor.washing", Type: model.SensorWashing, Value: 2000},
+	})
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	e.Step(5 * hour)
+
+	costs := cb.lastApplianceCosts()
+	require.Len(t, costs, 2)
+	assert.Equal(t, model.SensorOven, costs[0].Type)
+	assert.Equal(t, "Oven", costs[0].Name)
+	assert.InDelta(t, 1.0, costs[0].KWh, 1e-9)
+	assert.InDelta(t, 0.5, costs[0].CostPLN, 1e-9)
+	assert.InDelta(t, 0.5, costs[0].MonthCostPLN, 1e-9)
+	assert.Equal(t, model.SensorWashing, costs[1].Type)
+	assert.InDelta(t, 2.0, costs[1].KWh, 1e-9)
+	assert.InDelta(t, 4.0, costs[1].CostPLN, 1e-9)
+
+	// Seeking back clears the attribution
+	e.Seek(startTime)
+	assert.Empty(t, cb.lastApplianceCosts())
+}
+
+func TestEngine_ApplianceShift(t *testing.T) {
+	// Two days: 1.00 PLN/kWh except 0.20 at 03:00. The washing machine runs
+	// 2 kW from 18:00 to 19:00 each day; the house imports 3 kW meanwhile.
+	base := time.Date(2024, 11, 18, 0, 0, 0, 0, time.UTC)
+	newEngine := func() (*Engine, *mockCallback) {
+		s := store.New()
+		s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+		s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+		s.AddSensor(model.Sensor{ID: "sensor.washing", Name: "Washing Machine", Type: model.SensorWashing, Unit: "W"})
+		for i := 0; i < 48; i++ {
+			ts := base.Add(time.Duration(i) * hour)
+			price, washing := 1.0, 0.0
+			if ts.Hour() == 3 {
+				price = 0.2
+			}
+			if ts.Hour() == 18 {
+				washing = 2000
+			}
+			s.AddReadings([]model.Reading{
+				{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000 + washing},
+				{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price},
+				{Timestamp: ts, SensorID: "sensor.washing", Type: model.SensorWashing, Value: washing},
+			})
+		}
+		cb := &mockCallback{}
+		e := New(s, cb)
+		e.Init()
+		e.SetPriceSensor("sensor.price")
+		return e, cb
+	}
+
+	e, cb := newEngine()
+	e.Step(48 * hour)
+	unshifted := cb.lastSummary()
+	assert.Zero(t, unshifted.ApplianceShiftSavingsPLN)
+	assert.InDelta(t, unshifted.NetCostPLN, unshifted.ApplianceShiftedNetCostPLN, 1e-9)
+
+	e, cb = newEngine()
+	e.SetApplianceShift(model.SensorWashing, 0, 24)
+	e.Step(48 * hour)
+	shifted := cb.lastSummary()
+	// 2 kWh a day moved from 1.00 to 0.20 PLN/kWh
+	assert.InDelta(t, 2*2*0.8, shifted.ApplianceShiftSavingsPLN, 1e-9)
+	assert.InDelta(t, shifted.NetCostPLN-3.2, shifted.ApplianceShiftedNetCostPLN, 1e-9)
+	assert.InDelta(t, unshifted.NetCostPLN, shifted.NetCostPLN, 1e-9)
+
+	// A window that excludes the cheap hour cannot save anything.
+	e, cb = newEngine()
+	e.SetApplianceShift(model.SensorWashing, 12, 24)
+	e.Step(48 * hour)
+	assert.Zero(t, cb.lastSummary().ApplianceShiftSavingsPLN)
+}
+
+func TestEngine_ApplianceShiftWindowBounds(t *testing.T) {
+	// 1.00 PLN/kWh except 0.20 at cheapAt; the washing machine runs 2 kW
+	// for the hour from washAt.
+	newEngine := func(start time.Time, hours int, washAt, cheapAt time.Time) (*Engine, *mockCallback) {
+		s := store.New()
+		s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+		s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+		s.AddSensor(model.Sensor{ID: "sensor.washing", Name: "Washing Machine", Type: model.SensorWashing, Unit: "W"})
+		for i := 0; i < hours; i++ {
+			ts := start.Add(time.Duration(i) * hour)
+			price, washing := 1.0, 0.0
+			if ts.Equal(cheapAt) {
+				price = 0.2
+			}
+			if ts.Equal(washAt) {
+				washing = 2000
+			}
+			s.AddReadings([]model.Reading{
+				{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000 + washing},
+				{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price},
+				{Timestamp: ts, SensorID: "sensor.washing", Type: model.SensorWashing, Value: washing},
+			})
+		}
+		cb := &mockCallback{}
+		e := New(s, cb)
+		e.Init()
+		e.SetPriceSensor("sensor.price")
+		return e, cb
+	}
+
+	// A 22:00–04:00 window reaches the next morning's cheap hour.
+	base := time.Date(2024, 11, 18, 0, 0, 0, 0, time.UTC)
+	e, cb := newEngine(base, 48, base.Add(23*hour), base.Add(27*hour))
+	e.SetApplianceShift(model.SensorWashing, 22, 4)
+	e.Step(48 * hour)
+	assert.InDelta(t, 2*0.8, cb.lastSummary().ApplianceShiftSavingsPLN, 1e-9)
+
+	// On the 23-hour DST day the whole-day window ends at local midnight;
+	// the next day's cheap midnight hour is not part of it.
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	require.NoError(t, err)
+	dst := time.Date(2024, 3, 31, 0, 0, 0, 0, warsaw)
+	e, cb = newEngine(dst, 30, time.Date(2024, 3, 31, 18, 0, 0, 0, warsaw), time.Date(2024, 4, 1, 0, 0, 0, 0, warsaw))
+	e.SetApplianceShift(model.SensorWashing, 0, 24)
+	e.Step(30 * hour)
+	assert.Zero(t, cb.lastSummary().ApplianceShiftSavingsPLN)
+}
+
+func TestEngine_StepIntegrationForAppliance(t *testing.T) {
+	// The oven reports on change: on at 1 kW for an hour, then off.
+	newEngine := func() (*Engine, *mockCallback) {
+		s := store.New()
+		s.AddSensor(model.Sensor{ID: "sensor.oven", Name: "Oven", Type: model.SensorOven, Unit: "W"})
+		s.AddReadings([]model.Reading{
+			{Timestamp: startTime, SensorID: "sensor.oven", Type: model.SensorOven, Value: 1000},
+			{Timestamp: startTime.Add(hour), SensorID: "sensor.oven", Type: model.SensorOven, Value: 0},
+			{Timestamp: startTime.Add(3 * hour), SensorID: "sensor.oven", Type: model.SensorOven, Value: 0},
+		})
+		cb := &mockCallback{}
+		e := New(s, cb)
+		e.Init()
+		return e, cb
+	}
+
+	e, cb := newEngine()
+	e.Step(3 * hour)
+	costs := cb.lastApplianceCosts()
+	require.Len(t, costs, 1)
+	assert.InDelta(t, 0.5, costs[0].KWh, 1e-9, "trapezoid halves the step")
+
+	e, cb = newEngine()
+	e.SetIntegrationMethod(model.SensorOven, model.IntegrateStep)
+	e.Step(3 * hour)
+	costs = cb.lastApplianceCosts()
+	require.Len(t, costs, 1)
+	assert.InDelta(t, 1.0, costs[0].KWh, 1e-9)
+}
+
+func TestEngine_DailySummaryRollups(t *testing.T) {
+	// Three days of hourly grid import stepping 500 → 1000 → 1500 W, with
+	// a constant 1 kW of PV, ending just into the fourth day.
+	day0 := time.Date(2024, 11, 21, 0, 0, 0, 0, time.UTC)
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower, Unit: "W"})
+	var readings []model.Reading
+	for h := 0; h <= 3*24+2; h++ {
+		ts := day0.Add(time.Duration(h) * hour)
+		grid := 500 * float64(min(h/24, 2)+1)
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid},
+			model.Reading{Timestamp: ts, SensorID: "sensor.pv", Type: model.SensorPVPower, Value: 1000},
+		)
+	}
+	s.AddReadings(readings)
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	require.True(t, e.Init())
+	for i := 0; i < 3*24+2; i++ {
+		e.Step(hour)
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	require.Len(t, cb.dailySummaries, 3)
+	assert.Empty(t, cb.monthlySummaries)
+
+	// Each day owns the intervals starting in it; the 23:00→00:00 interval
+	// averages the two days' levels.
+	wantImport := []float64{23*0.5 + 0.75, 23*1.0 + 1.25, 24 * 1.5}
+	for i, d := range cb.dailySummaries {
+		assert.Equal(t, day0.AddDate(0, 0, i).Format(time.RFC3339), d.Start)
+		assert.InDelta(t, wantImport[i], d.GridImportKWh, 1e-9)
+		assert.Zero(t, d.GridExportKWh)
+		assert.InDelta(t, 24, d.PVKWh, 1e-9)
+	}
+}
+
+func TestEngine_MonthlyCosts(t *testing.T) {
+	// January 30 and 31 import 1 kW at 0.50 PLN/kWh; February 1 and 2
+	// export 1 kW at 1.00 PLN/kWh (sold at the 0.8 export coefficient).
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	start := time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC)
+	february := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	for h := 0; h <= 4*24; h++ {
+		ts := start.Add(time.Duration(h) * hour)
+		grid, price := 1000.0, 0.50
+		if !ts.Before(february) {
+			grid, price = -1000, 1.00
+		}
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price, Unit: "PLN/kWh"},
+		})
+	}
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	require.True(t, e.Init())
+	e.SetPriceSensor("sensor.price")
+	e.SetExportCoefficient(0.8)
+	for i := 0; i < 4*24; i++ {
+		e.Step(hour)
+	}
+
+	costs := cb.lastMonthlyCosts()
+	require.Len(t, costs, 2)
+	jan, feb := costs[0], costs[1]
+	assert.Equal(t, "2024-01", jan.Month)
+	assert.Equal(t, "2024-02", feb.Month)
+
+	// January owns the 23:00→00:00 interval into February, which averages to
+	// zero grid power.
+	assert.InDelta(t, 47*0.50, jan.ImportCostPLN, 1e-9)
+	assert.Zero(t, jan.ExportRevenuePLN)
+	assert.InDelta(t, 47*0.50, jan.NetCostPLN, 1e-9)
+	assert.Zero(t, feb.ImportCostPLN)
+	assert.InDelta(t, 48*0.80, feb.ExportRevenuePLN, 1e-9)
+	assert.InDelta(t, -48*0.80, feb.NetCostPLN, 1e-9)
+
+	summary := cb.lastSummary()
+	assert.InDelta(t, summary.NetCostPLN, jan.NetCostPLN+feb.NetCostPLN, 1e-9)
+	assert.InDelta(t, summary.GridImportCostPLN, jan.ImportCostPLN+feb.ImportCostPLN, 1e-9)
+	assert.InDelta(t, summary.GridExportRevenuePLN, jan.ExportRevenuePLN+feb.ExportRevenuePLN, 1e-9)
+
+	// Seeking back clears the months.
+	e.Seek(start)
+	e.Step(hour)
+	assert.Empty(t, cb.lastMonthlyCosts())
+}
+
+func TestEngine_MonthlyExportCoefficient(t *testing.T) {
+	// Identical 2 kWh exports at 0.50 PLN/kWh in June and December.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	june := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	december := time.Date(2024, 12, 15, 10, 0, 0, 0, time.UTC)
+	for _, base := range []time.Time{june, december} {
+		for h := 0; h <= 2; h++ {
+			ts := base.Add(time.Duration(h) * hour)
+			s.AddReadings([]model.Reading{
+				{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: -1000, Unit: "W"},
+				{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: 0.50, Unit: "PLN/kWh"},
+			})
+		}
+	}
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	coeffs := make([]float64, 12)
+	for i := range coeffs {
+		coeffs[i] = 0.8
+	}
+	coeffs[time.June-1] = 0.9
+	coeffs[time.December-1] = 0.4
+	e.SetMonthlyExportCoefficients(coeffs)
+
+	revenue := func(start time.Time) float64 {
+		e.SetTimeRange(model.TimeRange{Start: start, End: start.Add(2 * hour)})
+		e.Step(2 * hour)
+		sum := cb.lastSummary()
+		assert.InDelta(t, 2, sum.GridExportKWh, 1e-9)
+		return sum.GridExportRevenuePLN
+	}
+	assert.InDelta(t, 2*0.50*0.9, revenue(june), 1e-9)
+	assert.InDelta(t, 2*0.50*0.4, revenue(december), 1e-9)
+
+	// Dropping the curve falls back to the scalar.
+	e.SetMonthlyExportCoefficients(nil)
+	assert.InDelta(t, 2*0.50*0.8, revenue(december), 1e-9)
+}
+
+func TestEngine_ArbitrageBreakEvenSpread(t *testing.T) {
+	// Day 1 prices barely move (0.50–0.55); day 2 swings 0.20–1.00.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+
+	base := time.Date(2024, 11, 21, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for h := 0; h < 72; h++ {
+		ts := base.Add(time.Duration(h) * hour)
+		price := 0.50
+		if h%24 >= 12 {
+			price = 0.55
+		}
+		if h >= 24 {
+			price = 0.20
+			if h%24 >= 12 {
+				price = 1.00
+			}
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 1000, Unit: "W"},
+			model.Reading{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: price, Unit: "PLN/kWh"},
+		)
+	}
+	s.AddReadings(readings)
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	e.SetBattery(&BatteryConfig{
+		CapacityKWh:            10,
+		MaxPowerW:              5000,
+		DischargeToPercent:     10,
+		ChargeToPercent:        100,
+		RoundTripEfficiencyPct: 90,
+		CycleCostPLN:           2,
+	})
+
+	e.Step(72 * hour)
+
+	cb.mu.Lock()
+	require.NotEmpty(t, cb.arbitrageDayLogs)
+	records := cb.arbitrageDayLogs[len(cb.arbitrageDayLogs)-1]
+	cb.mu.Unlock()
+	require.GreaterOrEqual(t, len(records), 2)
+
+	// Break-even = low × (1/0.9 − 1) + 2/10
+	assert.InDelta(t, 0.05, records[0].SpreadPLN, 1e-9)
+	assert.InDelta(t, 0.50/9+0.2, records[0].BreakEvenSpreadPLN, 1e-9)
+	assert.False(t, records[0].Profitable)
+
+	assert.InDelta(t, 0.80, records[1].SpreadPLN, 1e-9)
+	assert.InDelta(t, 0.20/9+0.2, records[1].BreakEvenSpreadPLN, 1e-9)
+	assert.True(t, records[1].Profitable)
+
+	summary := cb.lastSummary()
+	assert.InDelta(t, 0.80, summary.ArbSpreadPLN, 1e-9)
+	assert.True(t, summary.ArbSpreadProfitable)
+}
+
+func TestEngine_NegativePriceExport(t *testing.T) {
+	// 2 kWh exported at -0.30 PLN/kWh, then 1 kWh imported at -0.30.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	grid := []float64{-1000, -1000, -1000, 1000, 1000}
+	for h, w := range grid {
+		ts := startTime.Add(time.Duration(h) * hour)
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: w, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: -0.30, Unit: "PLN/kWh"},
+		})
+	}
+
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	e.Step(4 * hour)
+
+	sum := cb.lastSummary()
+	// Two intervals at -1 kW, one averaging to 0, one at +1 kW.
+	assert.InDelta(t, 2, sum.GridExportKWh, 1e-9)
+	// Export at a negative price costs the full price; the 0.8 coefficient
+	// only discounts positive revenue.
+	assert.InDelta(t, -0.60, sum.GridExportRevenuePLN, 1e-9)
+	assert.InDelta(t, 2, sum.NegativeExportKWh, 1e-9)
+	assert.InDelta(t, 0.60, sum.NegativeExportCostPLN, 1e-9)
+	assert.InDelta(t, 2, sum.CheapExportKWh, 1e-9)
+	// Import at a negative price earns money.
+	assert.InDelta(t, 1, sum.GridImportKWh, 1e-9)
+	assert.InDelta(t, -0.30, sum.GridImportCostPLN, 1e-9)
+	assert.InDelta(t, 0.30, sum.NetCostPLN, 1e-9)
+}
+
+func TestEngine_PVDegradation(t *testing.T) {
+	// Three days of a noon-peaking PV profile; custom PV output at noon is
+	// compared at the start and five years in.
+	day0 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower, Unit: "W"})
+	var readings []model.Reading
+	for h := 0; h < 3*24; h++ {
+		pv := max(0, 5000*math.Cos(float64(h%24-12)/12*math.Pi))
+		readings = append(readings, model.Reading{Timestamp: day0.Add(time.Duration(h) * hour), SensorID: "sensor.pv", Type: model.SensorPVPower, Value: pv})
+	}
+	s.AddReadings(readings)
+
+	e := New(s, &mockCallback{})
+	require.True(t, e.Init())
+	e.SetPVConfig(true, []PVArrayConfig{{Name: "South", PeakWp: 6000, Azimuth: 180, Tilt: 35, Enabled: true}})
+
+	noon := day0.Add(12 * hour)
+	year5 := noon.AddDate(5, 0, 0)
+	e.mu.Lock()
+	fresh, _ := e.computeCustomPV(noon)
+	undegraded, _ := e.computeCustomPV(year5)
+	e.mu.Unlock()
+	require.Greater(t, fresh, 0.0)
+	assert.InDelta(t, fresh, undegraded, 1e-9, "default keeps output constant")
+
+	e.SetPVDegradation(0.5)
+	e.mu.Lock()
+	aged, _ := e.computeCustomPV(year5)
+	e.mu.Unlock()
+	// 2.5% less, give or take the half day from the range start to noon
+	assert.InDelta(t, fresh*(1-5*0.005), aged, 0.1)
+}
+
+func TestEngine_LoadShiftWindow(t *testing.T) {
+	// 1 kWh of heat pump use at 12:00 on Sunday for 1.00 PLN/kWh; 10:00
+	// costs 0.80 and 06:00 0.20, every other hour 1.00.
+	e := New(store.New(), &mockCallback{})
+	for h := 0; h < 24; h++ {
+		price := 1.00
+		switch h {
+		case 10:
+			price = 0.80
+		case 6:
+			price = 0.20
+		}
+		e.dayOfWeekHourly[0][h] = hourlySlot{priceSum: price, priceN: 1}
+	}
+	e.dayOfWeekHourly[0][12].hpWh = 1000
+	e.dayOfWeekHourly[0][12].hpCostPLN = 1.00
+
+	assert.Equal(t, DefaultLoadShiftWindowH, e.buildLoadShiftStats().ShiftWindowH)
+
+	e.SetLoadShiftWindow(2)
+	narrow := e.buildLoadShiftStats()
+	assert.Equal(t, 2, narrow.ShiftWindowH)
+	assert.InDelta(t, 0.20, narrow.ShiftSavingsPLN, 1e-9)
+
+	e.SetLoadShiftWindow(8)
+	wide := e.buildLoadShiftStats()
+	assert.Equal(t, 8, wide.ShiftWindowH)
+	assert.InDelta(t, 0.80, wide.ShiftSavingsPLN, 1e-9)
+
+	// Out of range is ignored.
+	e.SetLoadShiftWindow(13)
+	e.SetLoadShiftWindow(-1)
+	assert.Equal(t, 8, e.buildLoadShiftStats().ShiftWindowH)
+}
+
+func TestEngine_EmittedSensorTypes(t *testing.T) {
+	s := makeEnergyStore()
+	s.AddSensor(model.Sensor{ID: "sensor.outside", Name: "Outside", Type: model.SensorPumpExtTemp, Unit: "°C"})
+	s.AddReadings([]model.Reading{
+		{Timestamp: startTime, SensorID: "sensor.outside", Type: model.SensorPumpExtTemp, Value: 5, Unit: "°C"},
+		{Timestamp: startTime.Add(hour), SensorID: "sensor.outside", Type: model.SensorPumpExtTemp, Value: 6, Unit: "°C"},
+	})
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.SetEmittedSensorTypes([]model.SensorType{model.SensorGridPower})
+	e.Init()
+
+	e.Step(2 * hour)
+
+	readings := cb.allReadings()
+	require.Len(t, readings, 2)
+	for _, r := range readings {
+		assert.Equal(t, "sensor.grid", r.SensorID)
+	}
+	// Accounting still sees every sensor.
+	summary := cb.lastSummary()
+	assert.InDelta(t, 0.5, summary.TotalKWh, 0.01)
+	assert.InDelta(t, 1.0, summary.PVProductionKWh, 0.01)
+	assert.InDelta(t, 0.3, summary.HeatPumpKWh, 0.01)
+
+	// An empty list streams everything again.
+	e.SetEmittedSensorTypes(nil)
+	e.Seek(startTime)
+	e.Step(2 * hour)
+	assert.Len(t, cb.allReadings(), 2+8)
+}
+
+func TestEngine_SeekResolvesSensorsAddedAfterInit(t *testing.T) {
+	s := makeStore([]float64{1000, 1000})
+	e := New(s, &mockCallback{})
+	e.Init()
+	_, ok := e.gridVoltageAt(startTime)
+	assert.False(t, ok)
+
+	// A reload adds a voltage sensor; the next seek picks it up.
+	s.AddSensor(model.Sensor{ID: "sensor.voltage", Name: "Voltage", Type: model.SensorGridVoltage, Unit: "V"})
+	s.AddReadings([]model.Reading{{Timestamp: startTime, SensorID: "sensor.voltage", Type: model.SensorGridVoltage, Value: 241, Unit: "V"}})
+	e.Seek(startTime)
+	v, ok := e.gridVoltageAt(startTime)
+	require.True(t, ok)
+	assert.Equal(t, 241.0, v)
+}
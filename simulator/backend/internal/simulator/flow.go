@@ -0,0 +1,118 @@
+package simulator
+
+import (
+	"math"
+	"time"
+
+	"energy_simulator/internal/model"
+)
+
+// FlowEdges holds energy on each edge of the home energy-flow (sankey)
+// diagram. PV serves the home first, then charges the battery, and the rest
+// is exported; battery discharge serves the home before it is exported.
+type FlowEdges struct {
+	PVToHomeKWh      float64 `json:"pv_to_home_kwh"`
+	PVToBatteryKWh   float64 `json:"pv_to_battery_kwh"`
+	PVToGridKWh      float64 `json:"pv_to_grid_kwh"`
+	GridToHomeKWh    float64 `json:"grid_to_home_kwh"`
+	GridToBatteryKWh float64 `json:"grid_to_battery_kwh"`
+	BatteryToHomeKWh float64 `json:"battery_to_home_kwh"`
+	BatteryToGridKWh float64 `json:"battery_to_grid_kwh"`
+}
+
+func (f *FlowEdges) add(o FlowEdges) {
+	f.PVToHomeKWh += o.PVToHomeKWh
+	f.PVToBatteryKWh += o.PVToBatteryKWh
+	f.PVToGridKWh += o.PVToGridKWh
+	f.GridToHomeKWh += o.GridToHomeKWh
+	f.GridToBatteryKWh += o.GridToBatteryKWh
+	f.BatteryToHomeKWh += o.BatteryToHomeKWh
+	f.BatteryToGridKWh += o.BatteryToGridKWh
+}
+
+// FlowSankey is one finished hour of energy flow plus the running total since
+// the start of the replay.
+type FlowSankey struct {
+	Start string    `json:"start"` // hour start, RFC3339
+	Hour  FlowEdges `json:"hour"`
+	Total FlowEdges `json:"total"`
+}
+
+// splitFlow attributes one interval's energy between the flow edges from the
+// average battery-adjusted grid power (positive = import), PV power and
+// battery power (positive = discharge). Home demand is what the three supply
+// together, so import and export edges add up to the grid energy.
+func splitFlow(gridW, pvW, batteryW, hours float64) FlowEdges {
+	pv := math.Max(pvW, 0)
+	charge := math.Max(-batteryW, 0)
+	discharge := math.Max(batteryW, 0)
+	home := math.Max(gridW+pv+batteryW, 0)
+
+	pvToHome := math.Min(pv, home)
+	pvToBattery := math.Min(pv-pvToHome, charge)
+	batteryToHome := math.Min(discharge, home-pvToHome)
+
+	kwh := hours / 1000
+	return FlowEdges{
+		PVToHomeKWh:      pvToHome * kwh,
+		PVToBatteryKWh:   pvToBattery * kwh,
+		PVToGridKWh:      (pv - pvToHome - pvToBattery) * kwh,
+		GridToHomeKWh:    (home - pvToHome - batteryToHome) * kwh,
+		GridToBatteryKWh: (charge - pvToBattery) * kwh,
+		BatteryToHomeKWh: batteryToHome * kwh,
+		BatteryToGridKWh: (discharge - batteryToHome) * kwh,
+	}
+}
+
+// trackFlow adds the grid interval ending at t to the flow accumulators,
+// queueing the finished hour when the interval starts in a later one.
+// gridW is the battery-adjusted grid power at t and batteryW the battery
+// power applied over the interval. Grid and PV are averaged over the
+// interval like updateEnergy does, so the edges match the summary's energy.
+func (e *Engine) trackFlow(t time.Time, gridW, batteryW float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pvW := e.pvPowerAt(t)
+	last, lastGridW, lastPVW := e.flowLastTime, e.flowLastGridW, e.flowLastPVW
+	e.flowLastTime, e.flowLastGridW, e.flowLastPVW = t, gridW, pvW
+	if last.IsZero() {
+		return
+	}
+	hours := t.Sub(last).Hours()
+	if hours <= 0 {
+		return
+	}
+
+	if hour := last.Truncate(time.Hour); hour.After(e.flowHour) {
+		if !e.flowHour.IsZero() {
+			f := FlowSankey{Start: e.flowHour.Format(time.RFC3339), Hour: e.flowHourAcc, Total: e.flowTotal}
+			roundAmounts(&f, e.kwhDecimals)
+			e.pendingFlows = append(e.pendingFlows, f)
+		}
+		e.flowHour = hour
+		e.flowHourAcc = FlowEdges{}
+	}
+
+	// Inverter standby is drawn from the grid on top of the metered power.
+	avgGridW := e.intervalAverage(model.SensorGridPower, lastGridW, gridW) + e.standbyWh(hours)/hours
+	avgPVW := e.intervalAverage(model.SensorPVPower, lastPVW, pvW)
+	edges := splitFlow(avgGridW, avgPVW, batteryW, hours)
+	e.flowHourAcc.add(edges)
+	e.flowTotal.add(edges)
+}
+
+// pvPowerAt returns PV power at t: the custom PV model when enabled, else the
+// PV sensor reading at or before t. Sensors are replayed one after another
+// within a step, so the store is queried. Must be called with mu held.
+func (e *Engine) pvPowerAt(t time.Time) float64 {
+	if e.pvCustomEnabled {
+		pv, _ := e.computeCustomPV(t)
+		return pv
+	}
+	if e.pvSensorID == "" {
+		return 0
+	}
+	r, _ := e.store.ReadingAt(e.pvSensorID, t)
+	return r.Value
+}
@@ -0,0 +1,101 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+func TestSplitFlow(t *testing.T) {
+	// 3 kW PV, 1 kW home, battery charging at 1.5 kW: 0.5 kW exported.
+	f := splitFlow(-500, 3000, -1500, 1)
+	assert.InDelta(t, 1.0, f.PVToHomeKWh, 1e-9)
+	assert.InDelta(t, 1.5, f.PVToBatteryKWh, 1e-9)
+	assert.InDelta(t, 0.5, f.PVToGridKWh, 1e-9)
+	assert.Zero(t, f.GridToHomeKWh)
+	assert.Zero(t, f.GridToBatteryKWh)
+
+	// 2 kW home, 500 W PV, battery discharging 1 kW: grid covers the rest.
+	f = splitFlow(500, 500, 1000, 0.5)
+	assert.InDelta(t, 0.25, f.PVToHomeKWh, 1e-9)
+	assert.InDelta(t, 0.5, f.BatteryToHomeKWh, 1e-9)
+	assert.InDelta(t, 0.25, f.GridToHomeKWh, 1e-9)
+	assert.Zero(t, f.BatteryToGridKWh)
+
+	// Grid charging with no load or PV.
+	f = splitFlow(2000, 0, -2000, 1)
+	assert.InDelta(t, 2.0, f.GridToBatteryKWh, 1e-9)
+	assert.Zero(t, f.GridToHomeKWh)
+}
+
+// flowStore holds a day of hourly grid and PV power: 1 kW import overnight,
+// 3 kW PV against a 1 kW load (2 kW export) from 08:00 to 15:00, then a
+// 1.5 kW evening import.
+func flowStore() *store.Store {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower, Unit: "W"})
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for h := 0; h <= 24; h++ {
+		grid, pv := 1000.0, 0.0
+		switch {
+		case h >= 8 && h < 16:
+			grid, pv = -2000, 3000
+		case h >= 16:
+			grid = 1500
+		}
+		ts := base.Add(time.Duration(h) * time.Hour)
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid},
+			model.Reading{Timestamp: ts, SensorID: "sensor.pv", Type: model.SensorPVPower, Value: pv},
+		)
+	}
+	s.AddReadings(readings)
+	return s
+}
+
+func TestEngine_FlowSankey(t *testing.T) {
+	cb := &mockCallback{}
+	e := New(flowStore(), cb)
+	require.True(t, e.Init())
+	e.SetBattery(&BatteryConfig{CapacityKWh: 10, MaxPowerW: 2000, ChargeToPercent: 100})
+
+	for e.State().Time.Before(e.TimeRange().End) {
+		e.Step(time.Hour)
+	}
+
+	// One message per finished hour; the running total is the sum of them.
+	cb.mu.Lock()
+	flows := append([]FlowSankey(nil), cb.flows...)
+	cb.mu.Unlock()
+	require.Len(t, flows, 23)
+	assert.Equal(t, "2024-06-01T00:00:00Z", flows[0].Start)
+	var sum FlowEdges
+	for _, f := range flows {
+		sum.add(f.Hour)
+	}
+	last := flows[len(flows)-1].Total
+	assert.InDelta(t, last.PVToHomeKWh, sum.PVToHomeKWh, 0.01)
+	assert.InDelta(t, last.GridToHomeKWh, sum.GridToHomeKWh, 0.01)
+	assert.InDelta(t, last.BatteryToHomeKWh, sum.BatteryToHomeKWh, 0.01)
+
+	// The full total balances against the summary's grid and PV energy.
+	summary := e.CurrentSummary()
+	e.mu.Lock()
+	total := e.flowTotal
+	e.mu.Unlock()
+	assert.InDelta(t, summary.PVProductionKWh, total.PVToHomeKWh+total.PVToBatteryKWh+total.PVToGridKWh, 0.01)
+	assert.InDelta(t, summary.GridImportKWh, total.GridToHomeKWh+total.GridToBatteryKWh, 0.01)
+	assert.InDelta(t, summary.GridExportKWh, total.PVToGridKWh+total.BatteryToGridKWh, 0.01)
+
+	// The battery soaks up midday surplus and covers the evening.
+	assert.Greater(t, total.PVToBatteryKWh, 5.0)
+	assert.Greater(t, total.BatteryToHomeKWh, 5.0)
+	assert.Zero(t, total.BatteryToGridKWh)
+}
@@ -0,0 +1,107 @@
+package simulator
+
+import (
+	"math"
+	"time"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+const (
+	// heatLossMinDeltaC skips days with little heating demand, where
+	// internal and solar gains dominate the balance.
+	heatLossMinDeltaC = 5.0
+	// heatLossMinDays is the minimum number of usable days for a fit.
+	heatLossMinDays = 3
+	// heatLossAssumedCOP converts HP consumption to heat when no
+	// production sensor is available.
+	heatLossAssumedCOP = 3.0
+	// heatLossDefaultIndoorC is used when no indoor sensor is available.
+	heatLossDefaultIndoorC = 21.0
+)
+
+// HeatLossEstimate is a building heat-loss coefficient fitted from data.
+type HeatLossEstimate struct {
+	HeatLossWC float64         // fitted coefficient (W/°C)
+	Level      InsulationLevel // nearest insulation level
+	Days       int             // number of days used in the fit
+}
+
+// NearestInsulationLevel maps a heat-loss coefficient to the insulation level
+// whose nominal coefficient is closest.
+func NearestInsulationLevel(heatLossWC float64) InsulationLevel {
+	best := InsulationGood
+	bestDiff := math.Inf(1)
+	for _, level := range []InsulationLevel{InsulationVeryGood, InsulationGood, InsulationNormal, InsulationBasic} {
+		if d := math.Abs(HeatLossForInsulation(level) - heatLossWC); d < bestDiff {
+			best, bestDiff = level, d
+		}
+	}
+	return best
+}
+
+// EstimateHeatLoss fits the heat-loss coefficient H from daily means over tr,
+// assuming heat delivered by the heat pump balances H × (indoor − outdoor).
+// Heat comes from the production sensor, or consumption × an assumed COP.
+// Indoor temperature comes from a Netatmo sensor when present, otherwise the
+// default setpoint. Returns false when there are too few heating days.
+func EstimateHeatLoss(s *store.Store, tr model.TimeRange) (HeatLossEstimate, bool) {
+	heat := dailyMeans(s.SeriesByType(model.SensorPumpProduction, tr))
+	if len(heat) == 0 {
+		heat = dailyMeans(s.SeriesByType(model.SensorPumpConsumption, tr))
+		for day, w := range heat {
+			heat[day] = w * heatLossAssumedCOP
+		}
+	}
+	outdoor := dailyMeans(s.SeriesByType(model.SensorPumpExtTemp, tr))
+	if len(outdoor) == 0 {
+		outdoor = dailyMeans(s.SeriesByType(model.SensorNetatmoOutdoorTemp, tr))
+	}
+	indoor := dailyMeans(s.SeriesByType(model.SensorNetatmoLivingTemp, tr))
+	if len(indoor) == 0 {
+		indoor = dailyMeans(s.SeriesByType(model.SensorNetatmoTemp, tr))
+	}
+
+	// Least squares through the origin: H = Σ(P·ΔT) / Σ(ΔT²).
+	var sumPD, sumDD float64
+	days := 0
+	for day, p := range heat {
+		out, ok := outdoor[day]
+		if !ok {
+			continue
+		}
+		in, ok := indoor[day]
+		if !ok {
+			in = heatLossDefaultIndoorC
+		}
+		delta := in - out
+		if delta < heatLossMinDeltaC {
+			continue
+		}
+		sumPD += p * delta
+		sumDD += delta * delta
+		days++
+	}
+	if days < heatLossMinDays || sumDD == 0 {
+		return HeatLossEstimate{}, false
+	}
+
+	h := sumPD / sumDD
+	return HeatLossEstimate{HeatLossWC: h, Level: NearestInsulationLevel(h), Days: days}, true
+}
+
+// dailyMeans averages readings per calendar day (in the readings' location).
+func dailyMeans(readings []model.Reading) map[time.Time]float64 {
+	sums := make(map[time.Time]float64)
+	counts := make(map[time.Time]int)
+	for _, r := range readings {
+		day := startOfDay(r.Timestamp)
+		sums[day] += r.Value
+		counts[day]++
+	}
+	for day, n := range counts {
+		sums[day] /= float64(n)
+	}
+	return sums
+}
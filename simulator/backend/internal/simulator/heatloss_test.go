@@ -0,0 +1,76 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// heatLossStore builds 14 days of hourly data for a house with the given
+// heat-loss coefficient held at 21 °C, with a daily outdoor swing.
+func heatLossStore(heatLossWC float64, withProduction bool) (*store.Store, model.TimeRange) {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.out", Type: model.SensorPumpExtTemp, Unit: "°C"})
+	s.AddSensor(model.Sensor{ID: "sensor.in", Type: model.SensorNetatmoLivingTemp, Unit: "°C"})
+	heatID, heatType := "sensor.hp", model.SensorPumpConsumption
+	if withProduction {
+		heatID, heatType = "sensor.hp_prod", model.SensorPumpProduction
+	}
+	s.AddSensor(model.Sensor{ID: heatID, Type: heatType, Unit: "W"})
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for h := 0; h < 14*24; h++ {
+		ts := base.Add(time.Duration(h) * time.Hour)
+		day := h / 24
+		out := -8 + float64(day) + 3*math.Sin(float64(h%24)/24*2*math.Pi)
+		heat := heatLossWC * (21 - out)
+		if !withProduction {
+			heat /= heatLossAssumedCOP
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.out", Type: model.SensorPumpExtTemp, Value: out},
+			model.Reading{Timestamp: ts, SensorID: "sensor.in", Type: model.SensorNetatmoLivingTemp, Value: 21},
+			model.Reading{Timestamp: ts, SensorID: heatID, Type: heatType, Value: heat},
+		)
+	}
+	s.AddReadings(readings)
+	return s, model.TimeRange{Start: base, End: base.Add(14 * 24 * time.Hour)}
+}
+
+func TestEstimateHeatLoss_RecoversCoefficient(t *testing.T) {
+	s, tr := heatLossStore(180, true)
+
+	est, ok := EstimateHeatLoss(s, tr)
+	require.True(t, ok)
+	assert.InDelta(t, 180, est.HeatLossWC, 1)
+	assert.Equal(t, InsulationNormal, est.Level)
+	assert.Equal(t, 14, est.Days)
+}
+
+func TestEstimateHeatLoss_FromConsumption(t *testing.T) {
+	s, tr := heatLossStore(110, false)
+
+	est, ok := EstimateHeatLoss(s, tr)
+	require.True(t, ok)
+	assert.InDelta(t, 110, est.HeatLossWC, 1)
+	assert.Equal(t, InsulationVeryGood, est.Level)
+}
+
+func TestEstimateHeatLoss_NoHeatingDays(t *testing.T) {
+	_, ok := EstimateHeatLoss(store.New(), model.TimeRange{})
+	assert.False(t, ok)
+}
+
+func TestNearestInsulationLevel(t *testing.T) {
+	assert.Equal(t, InsulationVeryGood, NearestInsulationLevel(60))
+	assert.Equal(t, InsulationGood, NearestInsulationLevel(160))
+	assert.Equal(t, InsulationNormal, NearestInsulationLevel(230))
+	assert.Equal(t, InsulationBasic, NearestInsulationLevel(400))
+}
@@ -0,0 +1,118 @@
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HolidayCalendar decides which days weekend-aware tariffs (G12w and
+// similar) bill entirely at the off-peak rate: Saturdays, Sundays and
+// holidays. Holidays are the Polish statutory ones, optionally, plus any
+// configured dates. A nil calendar knows weekends only.
+type HolidayCalendar struct {
+	polish bool
+	extra  map[string]bool // "2006-01-02"
+
+	mu    sync.Mutex
+	years map[int]map[string]bool // PolishHolidays per year, built on first use
+}
+
+// NewHolidayCalendar builds a calendar with the built-in Polish holidays when
+// polish is set, plus extra dates in YYYY-MM-DD form.
+func NewHolidayCalendar(polish bool, extra []string) (*HolidayCalendar, error) {
+	c := &HolidayCalendar{polish: polish, extra: make(map[string]bool)}
+	for _, d := range extra {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return nil, fmt.Errorf("holiday %q: %w", d, err)
+		}
+		c.extra[d] = true
+	}
+	return c, nil
+}
+
+// IsHoliday reports whether t falls on a holiday, by its local calendar date.
+func (c *HolidayCalendar) IsHoliday(t time.Time) bool {
+	if c == nil {
+		return false
+	}
+	key := t.Format("2006-01-02")
+	if c.extra[key] {
+		return true
+	}
+	if !c.polish {
+		return false
+	}
+	return c.polishYear(t.Year())[key]
+}
+
+// polishYear returns the cached set of Polish holiday dates in year.
+func (c *HolidayCalendar) polishYear(year int) map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if days, ok := c.years[year]; ok {
+		return days
+	}
+	if c.years == nil {
+		c.years = make(map[int]map[string]bool)
+	}
+	days := make(map[string]bool)
+	for _, h := range PolishHolidays(year) {
+		days[h.Format("2006-01-02")] = true
+	}
+	c.years[year] = days
+	return days
+}
+
+// IsOffPeakDay reports whether the whole of t's day is off-peak: a weekend
+// or a holiday.
+func (c *HolidayCalendar) IsOffPeakDay(t time.Time) bool {
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return true
+	}
+	return c.IsHoliday(t)
+}
+
+// PolishHolidays returns the statutory non-working days of year in
+// chronological order (UTC dates). Christmas Eve is one from 2025 on.
+func PolishHolidays(year int) []time.Time {
+	date := func(m time.Month, d int) time.Time { return time.Date(year, m, d, 0, 0, 0, 0, time.UTC) }
+	easter := easterSunday(year)
+	days := []time.Time{
+		date(time.January, 1),    // Nowy Rok
+		date(time.January, 6),    // Trzech Króli
+		easter,                   // Wielkanoc
+		easter.AddDate(0, 0, 1),  // Poniedziałek Wielkanocny
+		date(time.May, 1),        // Święto Pracy
+		date(time.May, 3),        // Święto Konstytucji 3 Maja
+		easter.AddDate(0, 0, 49), // Zielone Świątki
+		easter.AddDate(0, 0, 60), // Boże Ciało
+		date(time.August, 15),    // Wniebowzięcie NMP
+		date(time.November, 1),   // Wszystkich Świętych
+		date(time.November, 11),  // Święto Niepodległości
+	}
+	if year >= 2025 {
+		days = append(days, date(time.December, 24)) // Wigilia
+	}
+	days = append(days, date(time.December, 25), date(time.December, 26))
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// easterSunday computes Western Easter with the anonymous Gregorian
+// (Meeus/Jones/Butcher) algorithm.
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
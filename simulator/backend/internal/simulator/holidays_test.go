@@ -0,0 +1,51 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolishHolidays(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	h2024 := PolishHolidays(2024)
+	assert.Len(t, h2024, 13)
+	assert.Contains(t, h2024, day(2024, time.March, 31)) // Easter
+	assert.Contains(t, h2024, day(2024, time.April, 1))  // Easter Monday
+	assert.Contains(t, h2024, day(2024, time.May, 30))   // Corpus Christi
+	assert.NotContains(t, h2024, day(2024, time.December, 24))
+
+	h2025 := PolishHolidays(2025)
+	assert.Len(t, h2025, 14)
+	assert.Contains(t, h2025, day(2025, time.April, 20)) // Easter
+	assert.Contains(t, h2025, day(2025, time.December, 24))
+	assert.True(t, h2025[0].Before(h2025[len(h2025)-1]))
+}
+
+func TestTOUTariff_HolidayBilledOffPeak(t *testing.T) {
+	cal, err := NewHolidayCalendar(true, []string{"2024-05-10"})
+	require.NoError(t, err)
+	tou := TOUTariff{PeakPLN: 1.10, OffPeakPLN: 0.60, Holidays: cal}
+
+	// Wednesday 1 May (Labour Day) vs Wednesday 8 May, both at 10:00.
+	holiday := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	workday := time.Date(2024, 5, 8, 10, 0, 0, 0, time.Local)
+	assert.Equal(t, 0.60, tou.RateAt(holiday))
+	assert.Equal(t, 1.10, tou.RateAt(workday))
+
+	// Configured extra date (Friday) and the weekday off-peak windows.
+	assert.Equal(t, 0.60, tou.RateAt(time.Date(2024, 5, 10, 10, 0, 0, 0, time.Local)))
+	assert.Equal(t, 0.60, tou.RateAt(workday.Add(3*time.Hour)))  // 13:00
+	assert.Equal(t, 0.60, tou.RateAt(workday.Add(-5*time.Hour))) // 05:00
+
+	// Without a calendar only weekends are off-peak all day.
+	plain := TOUTariff{PeakPLN: 1.10, OffPeakPLN: 0.60}
+	assert.Equal(t, 1.10, plain.RateAt(holiday))
+	assert.Equal(t, 0.60, plain.RateAt(time.Date(2024, 5, 11, 10, 0, 0, 0, time.Local)))
+
+	_, err = NewHolidayCalendar(false, []string{"10.05.2024"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// PhaseSumSensorID is the grid_power sensor SumGridPhases adds to a store.
+const PhaseSumSensorID = "sensor.grid_power_phase_sum"
+
+// PhaseEnergy holds grid energy through one phase of a three-phase install.
+type PhaseEnergy struct {
+	Phase     string  `json:"phase"` // "L1", "L2", "L3"
+	ImportKWh float64 `json:"import_kwh"`
+	ExportKWh float64 `json:"export_kwh"`
+}
+
+// phaseSensorIDs returns the IDs of the per-phase grid power sensors indexed
+// by phase, and whether all three are present.
+func phaseSensorIDs(s *store.Store) ([3]string, bool) {
+	var ids [3]string
+	for _, sensor := range s.Sensors() {
+		for i, st := range model.GridPhasePower {
+			if sensor.Type == st && ids[i] == "" {
+				ids[i] = sensor.ID
+			}
+		}
+	}
+	return ids, ids[0] != "" && ids[1] != "" && ids[2] != ""
+}
+
+// SumGridPhases gives a three-phase install a total grid_power sensor: when
+// s holds power sensors for all three phases and no grid_power sensor, it adds
+// one (PhaseSumSensorID) whose readings are the sum of the phases. A reading
+// is added at every phase timestamp once each phase has reported, holding the
+// latest value of the other two. Reports whether the sensor was added.
+//
+// Loaders call it once the data is loaded, before Engine.Init; Init only
+// reads the store. Phase readings appended later are summed by
+// ExtendGridPhaseSum.
+func SumGridPhases(s *store.Store) bool {
+	for _, sensor := range s.Sensors() {
+		if sensor.Type == model.SensorGridPower {
+			return false
+		}
+	}
+	ids, ok := phaseSensorIDs(s)
+	if !ok {
+		return false
+	}
+	tr, ok := s.GlobalTimeRange()
+	if !ok {
+		return false
+	}
+
+	readings := phaseSums(s, ids, tr.Start, tr.End.Add(time.Nanosecond))
+	if len(readings) == 0 {
+		return false
+	}
+	s.AddSensor(model.Sensor{
+		ID:   PhaseSumSensorID,
+		Name: "Grid Power (L1+L2+L3)",
+		Type: model.SensorGridPower,
+		Unit: "W",
+	})
+	s.AddReadings(readings)
+	return true
+}
+
+// ExtendGridPhaseSum sums phase readings newer than the last PhaseSumSensorID
+// reading, for data appended after SumGridPhases ran (e.g. a reload). Returns
+// the end of the summed series, and false when s has no phase sum or no new
+// sums were added.
+func ExtendGridPhaseSum(s *store.Store) (time.Time, bool) {
+	sumRange, ok := s.TimeRange(PhaseSumSensorID)
+	if !ok {
+		return time.Time{}, false
+	}
+	ids, ok := phaseSensorIDs(s)
+	if !ok {
+		return time.Time{}, false
+	}
+	tr, ok := s.GlobalTimeRange()
+	if !ok {
+		return time.Time{}, false
+	}
+
+	readings := phaseSums(s, ids, sumRange.End.Add(time.Nanosecond), tr.End.Add(time.Nanosecond))
+	if len(readings) == 0 {
+		return time.Time{}, false
+	}
+	s.AppendReadings(readings)
+	return readings[len(readings)-1].Timestamp, true
+}
+
+// phaseSums returns a PhaseSumSensorID reading at every phase timestamp in
+// [start, end) where all three phases have reported.
+func phaseSums(s *store.Store, ids [3]string, start, end time.Time) []model.Reading {
+	var stamps []time.Time
+	seen := make(map[time.Time]bool)
+	for _, id := range ids {
+		for _, r := range s.ReadingsInRange(id, start, end) {
+			if !seen[r.Timestamp] {
+				seen[r.Timestamp] = true
+				stamps = append(stamps, r.Timestamp)
+			}
+		}
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].Before(stamps[j]) })
+
+	readings := make([]model.Reading, 0, len(stamps))
+	for _, t := range stamps {
+		var sum float64
+		complete := true
+		for _, id := range ids {
+			r, ok := s.ReadingAt(id, t)
+			if !ok {
+				complete = false
+				break
+			}
+			sum += r.Value
+		}
+		if complete {
+			readings = append(readings, model.Reading{
+				Timestamp: t,
+				SensorID:  PhaseSumSensorID,
+				Type:      model.SensorGridPower,
+				Value:     sum,
+				Unit:      "W",
+			})
+		}
+	}
+	return readings
+}
+
+// phaseIndex returns the phase (0–2) of a per-phase grid power sensor type.
+func phaseIndex(st model.SensorType) (int, bool) {
+	for i, p := range model.GridPhasePower {
+		if st == p {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// trackPhaseImbalance adds the spread between the most and least loaded
+// phase at t, held over the preceding hours, to the imbalance statistics.
+// Export is negative power, so a phase exporting while another imports
+// widens the spread by both. Must be called with mu held.
+func (e *Engine) trackPhaseImbalance(t time.Time, hours float64) {
+	if !e.hasPhases || hours <= 0 {
+		return
+	}
+	var lo, hi float64
+	for i, id := range e.phaseIDs {
+		r, ok := e.store.ReadingAt(id, t)
+		if !ok {
+			return
+		}
+		if i == 0 || r.Value < lo {
+			lo = r.Value
+		}
+		if i == 0 || r.Value > hi {
+			hi = r.Value
+		}
+	}
+	imbalance := hi - lo
+	e.phaseImbalanceWh += imbalance * hours
+	e.phaseImbalanceHours += hours
+	e.phaseImbalanceMaxW = max(e.phaseImbalanceMaxW, imbalance)
+}
+
+// phaseEnergies returns per-phase grid energy for the summary, or nil for a
+// single-phase install. Must be called with mu held.
+func (e *Engine) phaseEnergies() []PhaseEnergy {
+	if !e.hasPhases {
+		return nil
+	}
+	out := make([]PhaseEnergy, 3)
+	for i := range out {
+		out[i] = PhaseEnergy{
+			Phase:     fmt.Sprintf("L%d", i+1),
+			ImportKWh: e.phaseImportWh[i] / 1000,
+			ExportKWh: e.phaseExportWh[i] / 1000,
+		}
+	}
+	return out
+}
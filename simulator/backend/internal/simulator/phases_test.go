@@ -0,0 +1,103 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// phaseStore holds a day of hourly per-phase grid power: L1 imports 1200 W,
+// L2 300 W, and L3 exports 600 W (PV on that phase) until noon, then idles.
+func phaseStore() *store.Store {
+	s := store.New()
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, st := range model.GridPhasePower {
+		id := "sensor." + string(st)
+		s.AddSensor(model.Sensor{ID: id, Type: st, Unit: "W"})
+		var readings []model.Reading
+		for h := 0; h <= 24; h++ {
+			v := []float64{1200, 300, -600}[i]
+			if i == 2 && h >= 12 {
+				v = 0
+			}
+			readings = append(readings, model.Reading{
+				Timestamp: base.Add(time.Duration(h) * time.Hour), SensorID: id, Type: st, Value: v,
+			})
+		}
+		s.AddReadings(readings)
+	}
+	return s
+}
+
+func TestExtendGridPhaseSum(t *testing.T) {
+	s := phaseStore()
+	_, ok := ExtendGridPhaseSum(s)
+	assert.False(t, ok, "no phase sum yet")
+	require.True(t, SumGridPhases(s))
+	_, ok = ExtendGridPhaseSum(s)
+	assert.False(t, ok, "nothing new to sum")
+
+	next := time.Date(2024, 6, 2, 1, 0, 0, 0, time.UTC)
+	for i, st := range model.GridPhasePower {
+		s.AppendReadings([]model.Reading{{
+			Timestamp: next, SensorID: "sensor." + string(st), Type: st, Value: []float64{1000, 200, 0}[i],
+		}})
+	}
+	end, ok := ExtendGridPhaseSum(s)
+	require.True(t, ok)
+	assert.Equal(t, next, end)
+	assert.Equal(t, 26, s.ReadingCount(PhaseSumSensorID))
+	r, ok := s.ReadingAt(PhaseSumSensorID, next)
+	require.True(t, ok)
+	assert.Equal(t, 1200.0, r.Value)
+}
+
+func TestEngine_ThreePhaseGrid(t *testing.T) {
+	s := phaseStore()
+	require.True(t, SumGridPhases(s))
+	e := New(s, &mockCallback{})
+	require.True(t, e.Init())
+
+	// The phases are summed into one grid_power series.
+	sum := s.SeriesByType(model.SensorGridPower, e.TimeRange())
+	require.NotEmpty(t, sum)
+	assert.Equal(t, PhaseSumSensorID, sum[0].SensorID)
+	assert.Equal(t, 900.0, sum[0].Value)
+
+	for e.State().Time.Before(e.TimeRange().End) {
+		e.Step(time.Hour)
+	}
+	summary := e.CurrentSummary()
+
+	// 11 h at 900 W, the noon ramp at 1200 W average, 12 h at 1500 W.
+	assert.InDelta(t, 29.1, summary.GridImportKWh, 0.001)
+	assert.Equal(t, 0.0, summary.GridExportKWh, "L3 export is netted by L1+L2")
+
+	require.Len(t, summary.Phases, 3)
+	assert.Equal(t, "L1", summary.Phases[0].Phase)
+	assert.InDelta(t, 28.8, summary.Phases[0].ImportKWh, 0.001)
+	assert.InDelta(t, 7.2, summary.Phases[1].ImportKWh, 0.001)
+	assert.InDelta(t, 6.9, summary.Phases[2].ExportKWh, 0.001)
+	assert.Equal(t, 0.0, summary.Phases[2].ImportKWh)
+
+	// Spread L1−L3: 1800 W for the 11 intervals ending before noon, then
+	// 1200 W (L1 against the idle L3) for the remaining 13.
+	assert.Equal(t, 1800.0, summary.PhaseImbalanceMaxW)
+	assert.InDelta(t, (11*1800.0+13*1200.0)/24, summary.PhaseImbalanceAvgW, 0.001)
+}
+
+func TestSumGridPhases_KeepsExistingGridSensor(t *testing.T) {
+	s := phaseStore()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	assert.False(t, SumGridPhases(s))
+
+	single := store.New()
+	single.AddSensor(model.Sensor{ID: "sensor.l1", Type: model.SensorGridPowerL1, Unit: "W"})
+	single.AddReadings([]model.Reading{{Timestamp: time.Now(), SensorID: "sensor.l1", Type: model.SensorGridPowerL1, Value: 1}})
+	assert.False(t, SumGridPhases(single))
+}
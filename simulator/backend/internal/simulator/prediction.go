@@ -1,12 +1,26 @@
 package simulator
 
 import (
+	"math"
 	"sync"
 	"time"
 
+	"energy_simulator/internal/model"
 	"energy_simulator/internal/predictor"
 )
 
+// maxCalibratedAnomaly bounds the fitted anomaly. The temperature model was
+// trained on anomalies in [-2, 2]; allow a little extrapolation beyond that.
+const maxCalibratedAnomaly = 3.0
+
+// anomalyCalibrationWindow is how much recent temperature history is fitted
+// when entering prediction mode.
+const anomalyCalibrationWindow = 48 * time.Hour
+
+// awayBaseTempC is the outdoor temperature at which the power model is taken
+// to predict base load alone, with no heating; see SetAwayMode.
+const awayBaseTempC = 15.0
+
 // PredictionProvider generates synthetic sensor readings from neural networks.
 type PredictionProvider struct {
 	tempPred  *predictor.TemperaturePredictor
@@ -15,8 +29,13 @@ type PredictionProvider struct {
 	tempOffsetC  float64
 
 	mu           sync.Mutex
+	anomaly      float64 // model input fitted by CalibrateAnomaly
 	tempSequence []float64
 	seqStartTime time.Time // truncated to hour
+
+	// Away-mode overlay, see SetAwayMode
+	awayStart, awayEnd time.Time
+	awayFactor         float64
 }
 
 // NewPredictionProvider creates a provider wrapping both NN models.
@@ -35,6 +54,33 @@ func (p *PredictionProvider) SetTempOffset(offset float64) {
 	p.mu.Unlock()
 }
 
+// SetAwayMode scales the predicted base load by factor (0–1) for readings
+// in [start, end), e.g. 0.3 for a two-week holiday. Heating is left alone:
+// the base load is the power predicted at awayBaseTempC, and only that part
+// (at most the whole prediction, never PV export) is scaled. An empty range
+// or a factor outside 0–1 disables the overlay.
+func (p *PredictionProvider) SetAwayMode(start, end time.Time, factor float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !end.After(start) || factor < 0 || factor >= 1 {
+		p.awayStart, p.awayEnd, p.awayFactor = time.Time{}, time.Time{}, 0
+		return
+	}
+	p.awayStart, p.awayEnd, p.awayFactor = start, end, factor
+}
+
+// predictPower returns the predicted grid power at t for outdoor temperature
+// temp, with the away-mode overlay applied. Must be called with mu held.
+func (p *PredictionProvider) predictPower(t time.Time, temp float64) float64 {
+	power := p.powerPred.Predict(int(t.Month()), t.Hour(), temp)
+	if p.awayEnd.IsZero() || t.Before(p.awayStart) || !t.Before(p.awayEnd) {
+		return power
+	}
+	base := p.powerPred.Predict(int(t.Month()), t.Hour(), awayBaseTempC)
+	base = math.Max(0, math.Min(base, power))
+	return power - base*(1-p.awayFactor)
+}
+
 // EnsureInitialized lazily generates a temperature sequence for the given start
 // time if one doesn't already exist. Safe to call multiple times.
 func (p *PredictionProvider) EnsureInitialized(startTime time.Time) {
@@ -46,7 +92,61 @@ func (p *PredictionProvider) EnsureInitialized(startTime time.Time) {
 	p.seqStartTime = startTime.Truncate(time.Hour)
 	startDay := p.seqStartTime.YearDay()
 	startHour := p.seqStartTime.Hour()
-	p.tempSequence = p.tempPred.PredictSequence(startDay, startHour, 8760, 0)
+	p.tempSequence = p.tempPred.PredictSequence(startDay, startHour, 8760, p.anomaly)
+}
+
+// CalibrateAnomaly least-squares-fits the temperature anomaly so that the
+// clean model matches recent observed temperatures, and returns it. The fitted
+// anomaly is used for sequences generated by subsequent Init calls. With no
+// readings the anomaly is reset to 0.
+func (p *PredictionProvider) CalibrateAnomaly(recent []model.Reading) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sse := func(a float64) float64 {
+		var sum float64
+		for _, r := range recent {
+			d := p.tempPred.PredictClean(r.Timestamp.YearDay(), r.Timestamp.Hour(), a) - r.Value
+			sum += d * d
+		}
+		return sum
+	}
+
+	var anomaly float64
+	if len(recent) > 0 {
+		anomaly = goldenSectionMin(sse, -maxCalibratedAnomaly, maxCalibratedAnomaly, 1e-3)
+	}
+
+	p.anomaly = anomaly
+	return anomaly
+}
+
+// Anomaly returns the anomaly fitted by the last CalibrateAnomaly call.
+func (p *PredictionProvider) Anomaly() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.anomaly
+}
+
+// goldenSectionMin returns the x in [lo, hi] minimizing a unimodal f.
+func goldenSectionMin(f func(float64) float64, lo, hi, tol float64) float64 {
+	invPhi := (math.Sqrt(5) - 1) / 2
+	a, b := lo, hi
+	c := b - invPhi*(b-a)
+	d := a + invPhi*(b-a)
+	fc, fd := f(c), f(d)
+	for b-a > tol {
+		if fc < fd {
+			b, d, fd = d, c, fc
+			c = b - invPhi*(b-a)
+			fc = f(c)
+		} else {
+			a, c, fc = c, d, fd
+			d = a + invPhi*(b-a)
+			fd = f(d)
+		}
+	}
+	return (a + b) / 2
 }
 
 // PredictedTempAt returns the predicted temperature at the given time.
@@ -75,8 +175,7 @@ func (p *PredictionProvider) PredictedPowerAt(t time.Time) (float64, bool) {
 		return 0, false
 	}
 	temp := p.tempSequence[idx] + p.tempOffsetC
-	power := p.powerPred.Predict(int(t.Month()), t.Hour(), temp)
-	return power, true
+	return p.predictPower(t, temp), true
 }
 
 // Init pre-generates a year of temperature predictions starting from startTime.
@@ -87,7 +186,7 @@ func (p *PredictionProvider) Init(startTime time.Time) {
 	p.seqStartTime = startTime.Truncate(time.Hour)
 	startDay := p.seqStartTime.YearDay()
 	startHour := p.seqStartTime.Hour()
-	p.tempSequence = p.tempPred.PredictSequence(startDay, startHour, 8760, 0)
+	p.tempSequence = p.tempPred.PredictSequence(startDay, startHour, 8760, p.anomaly)
 }
 
 // ReadingsForRange returns grid power readings for each hour in [from, to).
@@ -113,7 +212,7 @@ func (p *PredictionProvider) ReadingsForRange(from, to time.Time) []SensorReadin
 		extTime := p.seqStartTime.Add(time.Duration(extStart) * time.Hour)
 		extDay := extTime.YearDay()
 		extHour := extTime.Hour()
-		extra := p.tempPred.PredictSequence(extDay, extHour, 8760, 0)
+		extra := p.tempPred.PredictSequence(extDay, extHour, 8760, p.anomaly)
 		p.tempSequence = append(p.tempSequence, extra...)
 	}
 
@@ -125,7 +224,7 @@ func (p *PredictionProvider) ReadingsForRange(from, to time.Time) []SensorReadin
 		}
 
 		temp := p.tempSequence[i] + p.tempOffsetC
-		power := p.powerPred.Predict(int(t.Month()), t.Hour(), temp)
+		power := p.predictPower(t, temp)
 
 		readings = append(readings, SensorReading{
 			SensorID:  p.gridSensorID,
@@ -0,0 +1,227 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/predictor"
+	"energy_simulator/internal/store"
+)
+
+// linearTempModel is a single linear layer where the clean prediction is
+// 5°C + 1°C per unit of anomaly, independent of day and hour.
+const linearTempModel = `{
+	"network": {"layers": [{"weights": [[0, 0, 0, 0, 1]], "biases": [0]}]},
+	"normalization": {"temp_mean": 5, "temp_std": 1}
+}`
+
+func newTestPredictionProvider(t *testing.T) *PredictionProvider {
+	t.Helper()
+	tempPred, err := predictor.LoadTemperaturePredictor([]byte(linearTempModel), 1)
+	require.NoError(t, err)
+	return NewPredictionProvider(tempPred, nil, "sensor.grid")
+}
+
+func recentTemps(n int, temp float64) []model.Reading {
+	readings := make([]model.Reading, n)
+	for i := range readings {
+		readings[i] = model.Reading{
+			Timestamp: startTime.Add(time.Duration(i) * time.Hour),
+			SensorID:  "sensor.temp",
+			Type:      model.SensorPumpExtTemp,
+			Value:     temp,
+		}
+	}
+	return readings
+}
+
+func TestCalibrateAnomaly_WarmerThanModel(t *testing.T) {
+	p := newTestPredictionProvider(t)
+
+	anomaly := p.CalibrateAnomaly(recentTemps(24, 7))
+
+	assert.Greater(t, anomaly, 0.0)
+	assert.InDelta(t, 2.0, anomaly, 0.01)
+	assert.Equal(t, anomaly, p.Anomaly())
+}
+
+func TestCalibrateAnomaly_ColderThanModel(t *testing.T) {
+	p := newTestPredictionProvider(t)
+
+	anomaly := p.CalibrateAnomaly(recentTemps(24, 4))
+
+	assert.InDelta(t, -1.0, anomaly, 0.01)
+}
+
+func TestCalibrateAnomaly_NoReadingsResets(t *testing.T) {
+	p := newTestPredictionProvider(t)
+	p.CalibrateAnomaly(recentTemps(24, 7))
+
+	assert.Equal(t, 0.0, p.CalibrateAnomaly(nil))
+}
+
+func TestCalibrateAnomaly_ClampedToBound(t *testing.T) {
+	p := newTestPredictionProvider(t)
+
+	anomaly := p.CalibrateAnomaly(recentTemps(24, 30))
+
+	assert.InDelta(t, maxCalibratedAnomaly, anomaly, 0.01)
+}
+
+// constPowerModel predicts a flat 1000 W regardless of month, hour and temperature.
+const constPowerModel = `{
+	"network": {"layers": [{"weights": [[0, 0, 0, 0, 0]], "biases": [0]}]},
+	"normalization": {"temp_mean": 0, "temp_std": 1, "power_mean": 1000, "power_std": 1}
+}`
+
+// heatingPowerModel predicts 2500 W − 100 W/°C: 1000 W of base load at the
+// 15 °C away-mode base temperature, 2000 W at the test temperature model's 5 °C.
+const heatingPowerModel = `{
+	"network": {"layers": [{"weights": [[0, 0, 0, 0, -100]], "biases": [0]}]},
+	"normalization": {"temp_mean": 0, "temp_std": 1, "power_mean": 2500, "power_std": 1}
+}`
+
+func TestPredictionProvider_AwayMode(t *testing.T) {
+	tempPred, err := predictor.LoadTemperaturePredictor([]byte(linearTempModel), 1)
+	require.NoError(t, err)
+	powerPred, err := predictor.LoadPredictor([]byte(heatingPowerModel), 1)
+	require.NoError(t, err)
+	p := NewPredictionProvider(tempPred, powerPred, "sensor.grid")
+	p.Init(startTime)
+
+	awayStart, awayEnd := startTime.Add(24*hour), startTime.Add(48*hour)
+	p.SetAwayMode(awayStart, awayEnd, 0.3)
+
+	for _, r := range p.ReadingsForRange(startTime, startTime.Add(72*hour)) {
+		ts, err := time.Parse(time.RFC3339, r.Timestamp)
+		require.NoError(t, err)
+		if !ts.Before(awayStart) && ts.Before(awayEnd) {
+			// Heating 1000 W kept, base 1000 W scaled to 300 W.
+			assert.InDelta(t, 1300, r.Value, 1e-6, r.Timestamp)
+		} else {
+			assert.InDelta(t, 2000, r.Value, 1e-6, r.Timestamp)
+		}
+	}
+	away, ok := p.PredictedPowerAt(awayStart.Add(3 * hour))
+	require.True(t, ok)
+	normal, ok := p.PredictedPowerAt(awayEnd.Add(3 * hour))
+	require.True(t, ok)
+	assert.Less(t, away, normal)
+
+	// A factor of 1 switches the overlay off.
+	p.SetAwayMode(awayStart, awayEnd, 1)
+	away, _ = p.PredictedPowerAt(awayStart.Add(3 * hour))
+	assert.InDelta(t, 2000, away, 1e-6)
+}
+
+func TestEngine_PredictionCatchUpKeepsBatteryState(t *testing.T) {
+	tempPred, err := predictor.LoadTemperaturePredictor([]byte(linearTempModel), 1)
+	require.NoError(t, err)
+	powerPred, err := predictor.LoadPredictor([]byte(constPowerModel), 1)
+	require.NoError(t, err)
+
+	cb := &mockCallback{}
+	e := New(makeStore([]float64{1000, 1000, 1000, 1000}), cb)
+	e.Init()
+	e.SetPrediction(NewPredictionProvider(tempPred, powerPred, "sensor.grid"))
+	e.SetPredictionCatchUp(true)
+	e.SetBattery(&BatteryConfig{
+		CapacityKWh: 10, MaxPowerW: 5000, DischargeToPercent: 10, ChargeToPercent: 100, InitialSoCPercent: 90,
+	})
+
+	// Replay all history: 3 h of 1 kW discharge.
+	e.Step(3 * hour)
+	require.True(t, e.PredictionMode(), "end of data hands off to prediction")
+	cb.mu.Lock()
+	historyUpdates := len(cb.batteryUpdates)
+	handoffSoC := cb.batteryUpdates[historyUpdates-1].SoCPercent
+	cb.mu.Unlock()
+	historyImport := cb.lastSummary().GridImportKWh
+	assert.Less(t, handoffSoC, 90.0)
+	assert.Equal(t, startTime.Add(3*hour), e.State().Time)
+
+	e.Step(2 * hour)
+	cb.mu.Lock()
+	forecast := cb.batteryUpdates[historyUpdates:]
+	cb.mu.Unlock()
+	require.NotEmpty(t, forecast)
+	first, err := time.Parse(time.RFC3339, forecast[0].Timestamp)
+	require.NoError(t, err)
+	assert.False(t, first.Before(startTime.Add(3*hour)), "forecast starts where history ended")
+	// SoC continues from the handoff instead of returning to the initial 90%.
+	assert.LessOrEqual(t, forecast[0].SoCPercent, handoffSoC)
+	assert.Less(t, forecast[len(forecast)-1].SoCPercent, handoffSoC)
+	assert.GreaterOrEqual(t, cb.lastSummary().GridImportKWh, historyImport, "accumulators are not reset")
+	assert.Equal(t, startTime.Add(5*hour), e.State().Time)
+}
+
+func TestEngine_PredictionCatchUpKeepsMustRunLoad(t *testing.T) {
+	tempPred, err := predictor.LoadTemperaturePredictor([]byte(linearTempModel), 1)
+	require.NoError(t, err)
+	powerPred, err := predictor.LoadPredictor([]byte(constPowerModel), 1)
+	require.NoError(t, err)
+
+	cb := &mockCallback{}
+	e := New(makeStore([]float64{1000, 1000, 1000, 1000}), cb)
+	e.Init()
+	e.SetPrediction(NewPredictionProvider(tempPred, powerPred, "sensor.grid"))
+	e.SetPredictionCatchUp(true)
+	e.SetMustRunLoad(500)
+
+	e.Step(3 * hour)
+	require.True(t, e.PredictionMode())
+	assert.InDelta(t, 1.5, e.CurrentSummary().MustRunKWh, 1e-9)
+	historyImport := e.CurrentSummary().GridImportKWh
+
+	// The forecast (15:00, 16:00) keeps adding 500 W on top of the
+	// predicted 1 kW.
+	e.Step(2 * hour)
+	summary := e.CurrentSummary()
+	assert.InDelta(t, 2, summary.MustRunKWh, 1e-9)
+	assert.InDelta(t, historyImport+1.5, summary.GridImportKWh, 1e-6)
+	readings := cb.allReadings()
+	assert.InDelta(t, 1500, readings[len(readings)-1].Value, 1e-6)
+}
+
+func TestEngine_PredictionCatchUpOffEndsReplay(t *testing.T) {
+	cb := &mockCallback{}
+	e := New(makeStore([]float64{1000, 1000}), cb)
+	e.Init()
+	e.SetPrediction(newTestPredictionProvider(t))
+	e.Step(2 * hour)
+	assert.False(t, e.PredictionMode())
+}
+
+func TestEngine_AnomalyDayEventInDataZone(t *testing.T) {
+	tempPred, err := predictor.LoadTemperaturePredictor([]byte(linearTempModel), 1)
+	require.NoError(t, err)
+	powerPred, err := predictor.LoadPredictor([]byte(constPowerModel), 1)
+	require.NoError(t, err)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	// Two days drawing 3 kW against a 1 kW prediction.
+	start := time.Date(2024, 11, 21, 0, 0, 0, 0, tokyo)
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	for h := 0; h <= 48; h++ {
+		s.AddReadings([]model.Reading{{
+			Timestamp: start.Add(time.Duration(h) * hour), SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 3000, Unit: "W",
+		}})
+	}
+	cb := &mockCallback{}
+	e := New(s, cb)
+	require.True(t, e.Init())
+	pred := NewPredictionProvider(tempPred, powerPred, "sensor.grid")
+	pred.Init(start)
+	e.SetPrediction(pred)
+	e.Step(48 * hour)
+
+	events := cb.eventsOfKind(EventAnomalyDay)
+	require.NotEmpty(t, events)
+	assert.Equal(t, "2024-11-21T00:00:00+09:00", events[0].Timestamp, "midnight in the data's zone, not the host's")
+}
@@ -0,0 +1,56 @@
+package simulator
+
+import (
+	"time"
+
+	"energy_simulator/internal/model"
+)
+
+// summaryRangeStep is the replay step used when computing a range summary.
+const summaryRangeStep = time.Hour
+
+// SummaryForRange replays tr on a private engine sharing this engine's store
+// and configuration, and returns the resulting summary. The live simulation
+// (time, accumulators, battery state) is not touched.
+func (e *Engine) SummaryForRange(tr model.TimeRange) Summary {
+	e.mu.Lock()
+	child := e.cloneConfigLocked(discardCallback{})
+	e.mu.Unlock()
+
+	child.mu.Lock()
+	child.timeRange = tr
+	child.simTime = tr.Start
+	child.dayStart = startOfDay(tr.Start)
+	child.monthStart = startOfMonth(tr.Start)
+	child.resetAccumulators()
+	child.mu.Unlock()
+
+	for child.simTime.Before(tr.End) {
+		child.Step(summaryRangeStep)
+	}
+	return child.CurrentSummary()
+}
+
+// discardCallback ignores all engine events.
+type discardCallback struct{}
+
+func (discardCallback) OnState(State)                               {}
+func (discardCallback) OnReading(SensorReading)                     {}
+func (discardCallback) OnSummary(Summary)                           {}
+func (discardCallback) OnBatteryUpdate(BatteryUpdate)               {}
+func (discardCallback) OnBatterySummary(BatterySummary)             {}
+func (discardCallback) OnArbitrageDayLog([]ArbitrageDayRecord)      {}
+func (discardCallback) OnPredictionComparison(PredictionComparison) {}
+func (discardCallback) OnHeatingStats([]HeatingMonthStat)           {}
+func (discardCallback) OnMonthlyCosts([]MonthlyCost)                {}
+func (discardCallback) OnAnomalyDays([]AnomalyDayRecord)            {}
+func (discardCallback) OnLoadShiftStats(LoadShiftStats)             {}
+func (discardCallback) OnHPDiagnostics(HPDiagnostics)               {}
+func (discardCallback) OnPowerQuality(PowerQuality)                 {}
+func (discardCallback) OnApplianceCosts([]ApplianceCost)            {}
+func (discardCallback) OnStrategyComparison(StrategyComparison)     {}
+func (discardCallback) OnConfigComparison(ConfigComparison)         {}
+func (discardCallback) OnDailySummary(PeriodSummary)                {}
+func (discardCallback) OnMonthlySummary(PeriodSummary)              {}
+func (discardCallback) OnEvent(Event)                               {}
+func (discardCallback) OnFlowSankey(FlowSankey)                     {}
@@ -0,0 +1,22 @@
+package simulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"energy_simulator/internal/model"
+)
+
+func TestEngine_SummaryForRangeKeepsConfig(t *testing.T) {
+	// 4 hourly readings at 1000 W import = 3 kWh
+	e := New(makeStore([]float64{1000, 1000, 1000, 1000}), &mockCallback{})
+	e.Init()
+	e.SetCurrency("EUR")
+	e.SetMustRunLoad(500)
+
+	s := e.SummaryForRange(model.TimeRange{Start: startTime, End: startTime.Add(3 * hour)})
+	assert.Equal(t, "EUR", s.Currency)
+	assert.InDelta(t, 1.5, s.MustRunKWh, 1e-9)
+	assert.InDelta(t, 4.5, s.GridImportKWh, 1e-9)
+}
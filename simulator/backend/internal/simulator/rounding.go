@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"math"
+	"reflect"
+	"strings"
+)
+
+// RoundPLN rounds a monetary amount to the grosz (0.01 PLN). Negative zero
+// becomes zero, so float noise never surfaces as -0.00.
+func RoundPLN(v float64) float64 {
+	return RoundTo(v, 2)
+}
+
+// RoundTo rounds v to the given number of decimal places, normalizing
+// negative zero. A negative decimals leaves v unchanged.
+func RoundTo(v float64, decimals int) float64 {
+	if decimals < 0 {
+		return v
+	}
+	p := math.Pow(10, float64(decimals))
+	r := math.Round(v*p) / p
+	if r == 0 {
+		return 0
+	}
+	return r
+}
+
+// MoneyRounder rounds a stream of amounts (per-interval or per-day costs) to
+// grosze so the rounded parts always add up to the rounded running total:
+// each part is the step of the rounded total rather than the amount rounded
+// on its own, so rounding errors never accumulate.
+type MoneyRounder struct {
+	total, rounded float64
+}
+
+// Add adds v to the running total and returns its rounded share.
+func (r *MoneyRounder) Add(v float64) float64 {
+	r.total += v
+	next := RoundPLN(r.total)
+	part := RoundPLN(next - r.rounded)
+	r.rounded = next
+	return part
+}
+
+// defaultKWhDecimals is the summary kWh precision: 1 Wh.
+const defaultKWhDecimals = 3
+
+// periodRounding rounds consecutive day or month rollups so their costs
+// add up to the rounded totals.
+type periodRounding struct {
+	importCost, exportRevenue MoneyRounder
+}
+
+func (r *periodRounding) round(p PeriodSummary, kwhDecimals int) PeriodSummary {
+	p.ImportCostPLN = r.importCost.Add(p.ImportCostPLN)
+	p.ExportRevenuePLN = r.exportRevenue.Add(p.ExportRevenuePLN)
+	p.NetCostPLN = RoundPLN(p.ImportCostPLN - p.ExportRevenuePLN)
+	p.GridImportKWh = RoundTo(p.GridImportKWh, kwhDecimals)
+	p.GridExportKWh = RoundTo(p.GridExportKWh, kwhDecimals)
+	p.PVKWh = RoundTo(p.PVKWh, kwhDecimals)
+	return p
+}
+
+// roundAmounts rounds, in place, every float64 field of the struct pointed
+// to by v whose name ends in PLN to grosze and every one ending in KWh to
+// kwhDecimals places, descending into nested structs and slices of them.
+// Fields tagged `round:"-"` (per-kWh rates rather than amounts) are left
+// as they are.
+func roundAmounts(v any, kwhDecimals int) {
+	roundValue(reflect.ValueOf(v).Elem(), kwhDecimals)
+}
+
+func roundValue(v reflect.Value, kwhDecimals int) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			name := t.Field(i).Name
+			switch {
+			case t.Field(i).Tag.Get("round") == "-":
+			case f.Kind() == reflect.Float64 && strings.HasSuffix(name, "PLN"):
+				f.SetFloat(RoundPLN(f.Float()))
+			case f.Kind() == reflect.Float64 && strings.HasSuffix(name, "KWh"):
+				f.SetFloat(RoundTo(f.Float(), kwhDecimals))
+			default:
+				roundValue(f, kwhDecimals)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			roundValue(v.Index(i), kwhDecimals)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+func TestRoundPLN(t *testing.T) {
+	assert.Equal(t, 1.23, RoundPLN(1.234))
+	assert.Equal(t, -1.24, RoundPLN(-1.236))
+	assert.Equal(t, 2.5, RoundTo(2.4999, 3))
+	assert.Equal(t, 2.4999, RoundTo(2.4999, -1))
+
+	// Float noise just below zero must not become -0
+	z := RoundPLN(-0.0000001)
+	assert.Zero(t, z)
+	assert.False(t, math.Signbit(z))
+}
+
+func TestMoneyRounder_NoDrift(t *testing.T) {
+	// A million sub-grosz interval costs: rounding each on its own loses
+	// all of them, the rounder keeps the rounded total.
+	var r MoneyRounder
+	var total, naive, parts float64
+	for i := 0; i < 1_000_000; i++ {
+		cost := 0.00337 + 0.001*math.Sin(float64(i))
+		total += cost
+		naive += RoundPLN(cost)
+		parts += r.Add(cost)
+	}
+	assert.Greater(t, math.Abs(naive-RoundPLN(total)), 100.0)
+	assert.InDelta(t, RoundPLN(total), parts, 0.01)
+}
+
+func TestEngine_RoundedDailyCostsMatchTotal(t *testing.T) {
+	// Ten days of odd-valued import and export at odd prices; the last two
+	// readings are zero so the final day is complete.
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	base := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	const n = 10*24*4 + 2
+	for i := 0; i < n; i++ {
+		ts := base.Add(time.Duration(i) * 15 * time.Minute)
+		grid := 333.3 + 1777.7*math.Sin(float64(i)/7)
+		if i >= n-2 {
+			grid = 0
+		}
+		s.AddReadings([]model.Reading{
+			{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid, Unit: "W"},
+			{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: 0.4137 + 0.2*math.Cos(float64(i)/11), Unit: "PLN/kWh"},
+		})
+	}
+	cb := &mockCallback{}
+	e := New(s, cb)
+	e.Init()
+	e.SetPriceSensor("sensor.price")
+	e.Step(time.Duration(n) * 15 * time.Minute)
+
+	summary := cb.lastSummary()
+	require.Len(t, cb.dailySummaries, 10)
+	var importCost, exportRevenue, netCost float64
+	for _, d := range cb.dailySummaries {
+		assert.Equal(t, RoundPLN(d.NetCostPLN), d.NetCostPLN)
+		importCost += d.ImportCostPLN
+		exportRevenue += d.ExportRevenuePLN
+		netCost += d.NetCostPLN
+	}
+	assert.InDelta(t, summary.GridImportCostPLN, importCost, 1e-9)
+	assert.InDelta(t, summary.GridExportRevenuePLN, exportRevenue, 1e-9)
+	assert.InDelta(t, summary.NetCostPLN, netCost, 0.01+1e-9)
+	assert.Equal(t, RoundTo(summary.GridImportKWh, 3), summary.GridImportKWh)
+}
+
+func TestRoundAmounts_SkipsRates(t *testing.T) {
+	s := Summary{
+		NetCostPLN:            1.23456,
+		GridImportKWh:         2.34567,
+		ArbSpreadPLN:          0.0042,
+		ArbBreakEvenSpreadPLN: 0.0037,
+	}
+	roundAmounts(&s, 3)
+	assert.Equal(t, 1.23, s.NetCostPLN)
+	assert.Equal(t, 2.346, s.GridImportKWh)
+	assert.Equal(t, 0.0042, s.ArbSpreadPLN)
+	assert.Equal(t, 0.0037, s.ArbBreakEvenSpreadPLN)
+}
@@ -0,0 +1,80 @@
+package simulator
+
+import (
+	"sort"
+	"time"
+)
+
+// SchemeMonth is one calendar month of the net-metering vs net-billing
+// comparison. DifferencePLN is net billing minus net metering, so a positive
+// value means net metering was cheaper that month.
+type SchemeMonth struct {
+	Month         string  `json:"month"` // "2006-01"
+	NMNetCostPLN  float64 `json:"nm_net_cost_pln"`
+	NBNetCostPLN  float64 `json:"nb_net_cost_pln"`
+	DifferencePLN float64 `json:"difference_pln"`
+}
+
+// SchemeComparison contrasts the two Polish prosumer settlement schemes over
+// the replayed period: net metering (kWh credits at NetMeteringRatio, paying
+// only the distribution fee) and net billing (export valued at the monthly
+// average spot price into a PLN deposit). Cheaper is StrategyNetMetering or
+// StrategyNetBilling, or empty when they cost the same; SavingsPLN is how
+// much the cheaper one saves.
+type SchemeComparison struct {
+	Months        []SchemeMonth `json:"months"`
+	NMNetCostPLN  float64       `json:"nm_net_cost_pln"`
+	NBNetCostPLN  float64       `json:"nb_net_cost_pln"`
+	DifferencePLN float64       `json:"difference_pln"`
+	Cheaper       string        `json:"cheaper"`
+	SavingsPLN    float64       `json:"savings_pln"`
+}
+
+// addSchemeMonth adds net-metering and net-billing cost to the month of the
+// interval starting at t. Must be called with mu held.
+func (e *Engine) addSchemeMonth(t time.Time, nmPLN, nbPLN float64) {
+	if e.schemeMonths == nil {
+		e.schemeMonths = make(map[string]*SchemeMonth)
+	}
+	key := t.Format("2006-01")
+	m, ok := e.schemeMonths[key]
+	if !ok {
+		m = &SchemeMonth{Month: key}
+		e.schemeMonths[key] = m
+	}
+	m.NMNetCostPLN += nmPLN
+	m.NBNetCostPLN += nbPLN
+}
+
+// SchemeComparison returns the net-metering vs net-billing comparison so far.
+func (e *Engine) SchemeComparison() SchemeComparison {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c := SchemeComparison{
+		Months:       make([]SchemeMonth, 0, len(e.schemeMonths)),
+		NMNetCostPLN: RoundPLN(e.nmImportCostPLN),
+		NBNetCostPLN: RoundPLN(e.nbImportChargedPLN - e.nbDepositUsedPLN),
+	}
+	for _, m := range e.schemeMonths {
+		c.Months = append(c.Months, *m)
+	}
+	sort.Slice(c.Months, func(i, j int) bool { return c.Months[i].Month < c.Months[j].Month })
+	// Round months like the period rollups, so they add up to the totals.
+	var nm, nb MoneyRounder
+	for i := range c.Months {
+		m := &c.Months[i]
+		m.NMNetCostPLN = nm.Add(m.NMNetCostPLN)
+		m.NBNetCostPLN = nb.Add(m.NBNetCostPLN)
+		m.DifferencePLN = RoundPLN(m.NBNetCostPLN - m.NMNetCostPLN)
+	}
+
+	c.DifferencePLN = RoundPLN(c.NBNetCostPLN - c.NMNetCostPLN)
+	switch {
+	case c.DifferencePLN > 0:
+		c.Cheaper, c.SavingsPLN = StrategyNetMetering, c.DifferencePLN
+	case c.DifferencePLN < 0:
+		c.Cheaper, c.SavingsPLN = StrategyNetBilling, -c.DifferencePLN
+	}
+	return c
+}
@@ -0,0 +1,78 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/store"
+)
+
+// schemeStore holds June and July of hourly data at a flat 0.25 PLN/kWh spot
+// price: a 1 kW import except 10:00–14:00, when the house exports exportW.
+func schemeStore(exportW float64) *store.Store {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddSensor(model.Sensor{ID: "sensor.price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var readings []model.Reading
+	for i := 0; i <= 61*24; i++ {
+		ts := base.Add(time.Duration(i) * time.Hour)
+		grid := 1000.0
+		if h := ts.Hour(); h >= 10 && h < 14 {
+			grid = -exportW
+		}
+		readings = append(readings,
+			model.Reading{Timestamp: ts, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: grid},
+			model.Reading{Timestamp: ts, SensorID: "sensor.price", Type: model.SensorEnergyPrice, Value: 0.25},
+		)
+	}
+	s.AddReadings(readings)
+	return s
+}
+
+func runSchemes(t *testing.T, exportW float64) (SchemeComparison, Summary) {
+	t.Helper()
+	e := New(schemeStore(exportW), &mockCallback{})
+	require.True(t, e.Init())
+	e.SetPriceSensor("sensor.price")
+	for e.State().Time.Before(e.TimeRange().End) {
+		e.Step(24 * time.Hour)
+	}
+	return e.SchemeComparison(), e.CurrentSummary()
+}
+
+func TestSchemeComparison_RecommendationFlips(t *testing.T) {
+	// Mostly self-consumed: each exported kWh is worth 0.8 × (0.65 − 0.20)
+	// = 0.36 PLN as a net-metering credit but only the 0.25 PLN spot price in
+	// the net-billing deposit.
+	low, summary := runSchemes(t, 1000)
+	assert.Equal(t, StrategyNetMetering, low.Cheaper)
+	assert.Greater(t, low.SavingsPLN, 0.0)
+	assert.Equal(t, summary.NMNetCostPLN, low.NMNetCostPLN)
+	assert.Equal(t, summary.NBNetCostPLN, low.NBNetCostPLN)
+
+	// Export far beyond import: credits cover every imported kWh yet still
+	// leave the distribution fee, while the deposit pays the full tariff.
+	high, _ := runSchemes(t, 15000)
+	assert.Equal(t, StrategyNetBilling, high.Cheaper)
+	assert.InDelta(t, high.NMNetCostPLN-high.NBNetCostPLN, high.SavingsPLN, 0.001)
+
+	// June and July, adding up to the totals.
+	for _, c := range []SchemeComparison{low, high} {
+		require.Len(t, c.Months, 2)
+		assert.Equal(t, "2024-06", c.Months[0].Month)
+		assert.Equal(t, "2024-07", c.Months[1].Month)
+		var nm, nb float64
+		for _, m := range c.Months {
+			nm += m.NMNetCostPLN
+			nb += m.NBNetCostPLN
+			assert.InDelta(t, m.NBNetCostPLN-m.NMNetCostPLN, m.DifferencePLN, 0.001)
+		}
+		assert.InDelta(t, c.NMNetCostPLN, nm, 0.001)
+		assert.InDelta(t, c.NBNetCostPLN, nb, 0.001)
+	}
+}
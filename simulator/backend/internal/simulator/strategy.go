@@ -0,0 +1,62 @@
+package simulator
+
+import "sort"
+
+// Strategy names used in StrategyComparison.
+const (
+	StrategyNoBattery       = "no_battery"
+	StrategySelfConsumption = "self_consumption"
+	StrategyArbitrage       = "arbitrage"
+	StrategyHybrid          = "hybrid"
+	StrategyNetMetering     = "net_metering"
+	StrategyNetBilling      = "net_billing"
+)
+
+// StrategyResult is one strategy's net cost so far and its savings against
+// the no-battery spot-price baseline (negative when it costs more).
+type StrategyResult struct {
+	Name       string  `json:"name"`
+	NetCostPLN float64 `json:"net_cost_pln"`
+	SavingsPLN float64 `json:"savings_pln"`
+	Best       bool    `json:"best"`
+}
+
+// StrategyComparison lists the strategies the engine tracks in parallel,
+// cheapest first. Best names the cheapest one.
+type StrategyComparison struct {
+	Strategies []StrategyResult `json:"strategies"`
+	Best       string           `json:"best"`
+}
+
+// buildStrategyComparison ranks the strategies present in s. Battery
+// strategies are only included when their battery is simulated. Must be
+// called with mu held.
+func (e *Engine) buildStrategyComparison(s Summary) StrategyComparison {
+	results := []StrategyResult{
+		{Name: StrategyNoBattery, NetCostPLN: s.RawNetCostPLN},
+	}
+	if e.battery != nil {
+		results = append(results, StrategyResult{Name: StrategySelfConsumption, NetCostPLN: s.NetCostPLN})
+	}
+	if e.altBattery != nil {
+		results = append(results, StrategyResult{Name: StrategyArbitrage, NetCostPLN: s.ArbNetCostPLN})
+	}
+	if e.hybBattery != nil {
+		results = append(results, StrategyResult{Name: StrategyHybrid, NetCostPLN: s.HybridNetCostPLN})
+	}
+	results = append(results,
+		StrategyResult{Name: StrategyNetMetering, NetCostPLN: s.NMNetCostPLN},
+		StrategyResult{Name: StrategyNetBilling, NetCostPLN: s.NBNetCostPLN},
+	)
+
+	for i := range results {
+		results[i].SavingsPLN = s.RawNetCostPLN - results[i].NetCostPLN
+	}
+	// Stable, so ties keep the order above (no battery first).
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].NetCostPLN < results[j].NetCostPLN
+	})
+	results[0].Best = true
+
+	return StrategyComparison{Strategies: results, Best: results[0].Name}
+}
@@ -1,6 +1,10 @@
 package simulator
 
-import "time"
+import (
+	"math"
+	"sort"
+	"time"
+)
 
 // InsulationLevel categorizes building insulation quality.
 type InsulationLevel string
@@ -28,6 +32,28 @@ func HeatLossForInsulation(level InsulationLevel) float64 {
 	}
 }
 
+// COPPoint is one point of an outdoor temperature → COP curve.
+type COPPoint struct {
+	TempC float64
+	COP   float64
+}
+
+// Default indoor comfort band of the pre-heating simulation.
+const (
+	DefaultComfortMinC = 19.0
+	DefaultComfortMaxC = 24.0
+)
+
+// DefaultCOPCurve is a typical air-to-water heat pump heating a radiator
+// circuit, from about 2 at −15 °C to 4.5 at 15 °C.
+var DefaultCOPCurve = []COPPoint{
+	{TempC: -15, COP: 2.0},
+	{TempC: -7, COP: 2.5},
+	{TempC: 2, COP: 3.1},
+	{TempC: 7, COP: 3.7},
+	{TempC: 15, COP: 4.5},
+}
+
 // ThermalModel simulates building thermal mass for pre-heating optimization.
 // It runs as a shadow simulation (like arbitrage battery) tracking what heating
 // cost WOULD be if the heat pump pre-heated during cheap hours.
@@ -35,11 +61,19 @@ type ThermalModel struct {
 	IndoorTempC   float64         // current simulated indoor temperature
 	SetpointC     float64         // target temperature (default 21°C)
 	PreHeatDeltaC float64         // overheat amount during cheap hours (default 2°C)
+	ComfortMinC   float64         // lowest allowed indoor temperature (default 19°C)
+	ComfortMaxC   float64         // highest allowed indoor temperature (default 24°C)
 	ThermalMassJ  float64         // building thermal capacity in joules/°C (kWh/°C * 3.6e6)
 	HeatLossWC    float64         // heat loss coefficient from insulation level
 	Insulation    InsulationLevel // current insulation level
+	MinOnTime     time.Duration   // shortest compressor run once started (0 = none)
+	MinOffTime    time.Duration   // shortest pause once stopped (0 = none)
+	COPCurve      []COPPoint      // COP by outdoor temperature when none is measured; empty = 1
 	CostPLN       float64         // accumulated shadow cost
 	LastTimestamp time.Time
+
+	heating      bool      // HP state over the previous interval
+	heatingSince time.Time // when heating last switched; zero = unknown
 }
 
 // ThermalStepResult holds the output of one thermal simulation step.
@@ -55,6 +89,8 @@ func NewThermalModel(insulation InsulationLevel) *ThermalModel {
 		IndoorTempC:   21.0,
 		SetpointC:     21.0,
 		PreHeatDeltaC: 2.0,
+		ComfortMinC:   DefaultComfortMinC,
+		ComfortMaxC:   DefaultComfortMaxC,
 		ThermalMassJ:  2.0 * 3.6e6, // 2.0 kWh/°C converted to J/°C
 		HeatLossWC:    HeatLossForInsulation(insulation),
 		Insulation:    insulation,
@@ -67,7 +103,7 @@ func NewThermalModel(insulation InsulationLevel) *ThermalModel {
 //   - spotPrice: current electricity price (PLN/kWh)
 //   - lowThresh, highThresh: daily P33/P67 price thresholds
 //   - hpMaxPowerW: maximum heat pump electrical power
-//   - cop: current coefficient of performance
+//   - cop: measured coefficient of performance; 0 uses the COP curve
 //   - ts: current timestamp
 func (tm *ThermalModel) Step(outdoorTempC, spotPrice, lowThresh, highThresh, hpMaxPowerW, cop float64, ts time.Time) ThermalStepResult {
 	if tm.LastTimestamp.IsZero() {
@@ -79,7 +115,11 @@ func (tm *ThermalModel) Step(outdoorTempC, spotPrice, lowThresh, highThresh, hpM
 	if dt <= 0 {
 		return ThermalStepResult{IndoorTempC: tm.IndoorTempC}
 	}
+	prev := tm.LastTimestamp
 	tm.LastTimestamp = ts
+	if cop <= 0 {
+		cop = tm.COPAt(outdoorTempC)
+	}
 
 	// Heat loss from building to outside (W)
 	lossW := tm.HeatLossWC * (tm.IndoorTempC - outdoorTempC)
@@ -91,7 +131,9 @@ func (tm *ThermalModel) Step(outdoorTempC, spotPrice, lowThresh, highThresh, hpM
 	var hpElecW float64
 	hasPriceData := lowThresh != highThresh
 
-	if hasPriceData && spotPrice <= lowThresh && tm.IndoorTempC < tm.SetpointC+tm.PreHeatDeltaC {
+	preHeatCeilC := math.Min(tm.SetpointC+tm.PreHeatDeltaC, tm.ComfortMaxC)
+
+	if hasPriceData && spotPrice <= lowThresh && tm.IndoorTempC < preHeatCeilC {
 		// Cheap electricity: run HP at full power to pre-heat
 		hpElecW = hpMaxPowerW
 	} else if hasPriceData && spotPrice >= highThresh && tm.IndoorTempC > tm.SetpointC {
@@ -106,6 +148,31 @@ func (tm *ThermalModel) Step(outdoorTempC, spotPrice, lowThresh, highThresh, hpM
 		}
 	}
 
+	// Anti-cycling: hold the current state until its minimum time is up.
+	// The comfort band below still wins over it.
+	if !tm.heatingSince.IsZero() {
+		inState := prev.Sub(tm.heatingSince)
+		if tm.heating && inState < tm.MinOnTime {
+			hpElecW = hpMaxPowerW
+		} else if !tm.heating && inState < tm.MinOffTime {
+			hpElecW = 0
+		}
+	}
+
+	// Comfort band: heat regardless of price if the house would drop below
+	// the minimum, and never heat past the maximum.
+	if hpElecW == 0 && tm.IndoorTempC-lossW*dt/tm.ThermalMassJ < tm.ComfortMinC {
+		hpElecW = hpMaxPowerW
+	}
+	if cop > 0 {
+		maxElecW := ((tm.ComfortMaxC-tm.IndoorTempC)*tm.ThermalMassJ/dt + lossW) / cop
+		hpElecW = math.Max(0, math.Min(hpElecW, maxElecW))
+	}
+	if on := hpElecW > 0; on != tm.heating || tm.heatingSince.IsZero() {
+		tm.heating = on
+		tm.heatingSince = prev
+	}
+
 	// Thermal output from HP (W_thermal = W_electrical × COP)
 	hpThermalW := hpElecW * cop
 
@@ -134,9 +201,98 @@ func (tm *ThermalModel) Step(outdoorTempC, spotPrice, lowThresh, highThresh, hpM
 	}
 }
 
+// Track advances the model using the heat pump's actual electrical power over
+// the interval ending at ts instead of the pre-heating strategy, so the
+// modeled indoor temperature can be compared against a measured one. A cop
+// of 0 uses the COP curve. The first call only records the timestamp.
+func (tm *ThermalModel) Track(outdoorTempC, hpElecW, cop float64, ts time.Time) float64 {
+	if tm.LastTimestamp.IsZero() {
+		tm.LastTimestamp = ts
+		return tm.IndoorTempC
+	}
+	dt := ts.Sub(tm.LastTimestamp).Seconds()
+	if dt <= 0 {
+		return tm.IndoorTempC
+	}
+	tm.LastTimestamp = ts
+	if cop <= 0 {
+		cop = tm.COPAt(outdoorTempC)
+	}
+
+	lossW := math.Max(0, tm.HeatLossWC*(tm.IndoorTempC-outdoorTempC))
+	tm.IndoorTempC += (hpElecW*cop - lossW) * dt / tm.ThermalMassJ
+	if tm.IndoorTempC < outdoorTempC {
+		tm.IndoorTempC = outdoorTempC
+	}
+	return tm.IndoorTempC
+}
+
+// SetComfortBand sets the indoor temperature band the model must stay in.
+// A zero bound restores its default; a band with min above max is ignored.
+func (tm *ThermalModel) SetComfortBand(minC, maxC float64) {
+	minC, maxC, ok := ComfortBand(minC, maxC)
+	if !ok {
+		return
+	}
+	tm.ComfortMinC = minC
+	tm.ComfortMaxC = maxC
+}
+
+// ComfortBand resolves zero bounds to DefaultComfortMinC/DefaultComfortMaxC
+// and reports whether the resulting band is valid (min ≤ max).
+func ComfortBand(minC, maxC float64) (float64, float64, bool) {
+	if minC == 0 {
+		minC = DefaultComfortMinC
+	}
+	if maxC == 0 {
+		maxC = DefaultComfortMaxC
+	}
+	return minC, maxC, minC <= maxC
+}
+
+// SetCOPCurve sets the outdoor temperature → COP curve used when no
+// measured COP is available. Points may come in any order; nil restores a
+// flat COP of 1.
+func (tm *ThermalModel) SetCOPCurve(points []COPPoint) {
+	if len(points) == 0 {
+		tm.COPCurve = nil
+		return
+	}
+	tm.COPCurve = append([]COPPoint(nil), points...)
+	sort.Slice(tm.COPCurve, func(i, j int) bool { return tm.COPCurve[i].TempC < tm.COPCurve[j].TempC })
+}
+
+// COPAt interpolates the COP curve linearly at outdoorTempC, holding the end
+// values beyond the curve. Without a curve it returns 1.
+func (tm *ThermalModel) COPAt(outdoorTempC float64) float64 {
+	c := tm.COPCurve
+	if len(c) == 0 {
+		return 1
+	}
+	if outdoorTempC <= c[0].TempC {
+		return c[0].COP
+	}
+	for i := 1; i < len(c); i++ {
+		if outdoorTempC <= c[i].TempC {
+			f := (outdoorTempC - c[i-1].TempC) / (c[i].TempC - c[i-1].TempC)
+			return c[i-1].COP + f*(c[i].COP-c[i-1].COP)
+		}
+	}
+	return c[len(c)-1].COP
+}
+
+// SetMinRunTimes sets the heat pump anti-cycling limits: once started it
+// runs for at least minOn, once stopped it stays off for at least minOff.
+func (tm *ThermalModel) SetMinRunTimes(minOn, minOff time.Duration) {
+	tm.MinOnTime = minOn
+	tm.MinOffTime = minOff
+}
+
 // Reset resets the thermal model to initial state.
 func (tm *ThermalModel) Reset() {
 	tm.IndoorTempC = tm.SetpointC
 	tm.CostPLN = 0
 	tm.LastTimestamp = time.Time{}
+	tm.heating = false
+	tm.heatingSince = time.Time{}
 }
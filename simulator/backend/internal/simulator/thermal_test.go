@@ -0,0 +1,192 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runThermalDays steps the model every 15 min over two days at 0 °C outside:
+// hours 0-7 cheap, 8-15 mid, 16-23 expensive. Zero thresholds disable
+// pre-heating (plain thermostat baseline).
+func runThermalDays(tm *ThermalModel, low, high float64) float64 {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	for ts := start; ts.Before(start.Add(48 * time.Hour)); ts = ts.Add(15 * time.Minute) {
+		price := 0.60
+		switch h := ts.Hour(); {
+		case h < 8:
+			price = 0.20
+		case h >= 16:
+			price = 1.20
+		}
+		tm.Step(0, price, low, high, 2000, 3, ts)
+	}
+	return tm.CostPLN
+}
+
+func TestThermalModel_TightComfortBandReducesSavings(t *testing.T) {
+	baseline := runThermalDays(NewThermalModel(InsulationGood), 0, 0)
+
+	wide := NewThermalModel(InsulationGood)
+	wide.SetComfortBand(18, 24)
+	wideSavings := baseline - runThermalDays(wide, 0.30, 1.00)
+
+	tight := NewThermalModel(InsulationGood)
+	tight.SetComfortBand(20.5, 21.5)
+	tightSavings := baseline - runThermalDays(tight, 0.30, 1.00)
+
+	assert.Greater(t, wideSavings, 0.0)
+	assert.Greater(t, wideSavings, tightSavings)
+}
+
+func TestThermalModel_ComfortBandValidationAndReset(t *testing.T) {
+	tm := NewThermalModel(InsulationGood)
+	tm.SetComfortBand(20, 22)
+
+	// min above max is ignored
+	tm.SetComfortBand(23, 21)
+	assert.Equal(t, 20.0, tm.ComfortMinC)
+	assert.Equal(t, 22.0, tm.ComfortMaxC)
+
+	// zero bounds restore the defaults
+	tm.SetComfortBand(0, 0)
+	assert.Equal(t, DefaultComfortMinC, tm.ComfortMinC)
+	assert.Equal(t, DefaultComfortMaxC, tm.ComfortMaxC)
+
+	// a zero max resolves to the default before the check
+	tm.SetComfortBand(25, 0)
+	assert.Equal(t, DefaultComfortMinC, tm.ComfortMinC)
+}
+
+func TestThermalModel_ComfortMaxBlocksOvershoot(t *testing.T) {
+	tm := NewThermalModel(InsulationGood)
+	tm.SetComfortBand(0, 21.5)
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= 32; i++ {
+		r := tm.Step(0, 0.20, 0.30, 1.00, 2000, 3, start.Add(time.Duration(i)*15*time.Minute))
+		assert.LessOrEqual(t, r.IndoorTempC, 21.5+1e-9)
+	}
+	assert.InDelta(t, 21.5, tm.IndoorTempC, 1e-6)
+}
+
+func TestThermalModel_ComfortMinForcesHeating(t *testing.T) {
+	start := time.Date(2024, 1, 15, 16, 0, 0, 0, time.UTC)
+
+	// Expensive hour just above setpoint: the default model coasts.
+	tm := NewThermalModel(InsulationGood)
+	tm.IndoorTempC = 21.1
+	tm.Step(0, 1.20, 0.30, 1.00, 2000, 3, start)
+	r := tm.Step(0, 1.20, 0.30, 1.00, 2000, 3, start.Add(15*time.Minute))
+	assert.Zero(t, r.HPPowerW)
+
+	// Coasting would drop below a 21 °C minimum, so it heats despite the price.
+	tm = NewThermalModel(InsulationGood)
+	tm.SetComfortBand(21, 22)
+	tm.IndoorTempC = 21.1
+	tm.Step(0, 1.20, 0.30, 1.00, 2000, 3, start)
+	r = tm.Step(0, 1.20, 0.30, 1.00, 2000, 3, start.Add(15*time.Minute))
+	assert.Greater(t, r.HPPowerW, 0.0)
+	assert.GreaterOrEqual(t, r.IndoorTempC, 21.0)
+}
+
+func TestThermalModel_MinRunTimeAgainstOscillatingPrices(t *testing.T) {
+	// Price flips between cheap and expensive every 15 min; without limits
+	// the model would chase it and toggle the compressor each interval.
+	step := 15 * time.Minute
+	run := func(minOn, minOff time.Duration) []bool {
+		tm := NewThermalModel(InsulationGood)
+		tm.SetComfortBand(15, 26)
+		tm.SetMinRunTimes(minOn, minOff)
+		start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+		var states []bool
+		for i := 0; i <= 48; i++ {
+			price := 0.20
+			if i%2 == 1 {
+				price = 1.20
+			}
+			r := tm.Step(0, price, 0.30, 1.00, 2000, 3, start.Add(time.Duration(i)*step))
+			if i > 0 {
+				states = append(states, r.HPPowerW > 0)
+			}
+		}
+		return states
+	}
+	// runLengths returns the length (in intervals) of every run of the
+	// given state, ignoring the first and last runs, which may be cut off.
+	runLengths := func(states []bool, on bool) []int {
+		var runs [][2]int // {state, length}
+		for i, s := range states {
+			if i == 0 || s != states[i-1] {
+				runs = append(runs, [2]int{0, 0})
+				if s {
+					runs[len(runs)-1][0] = 1
+				}
+			}
+			runs[len(runs)-1][1]++
+		}
+		var lengths []int
+		for i := 1; i < len(runs)-1; i++ {
+			if (runs[i][0] == 1) == on {
+				lengths = append(lengths, runs[i][1])
+			}
+		}
+		return lengths
+	}
+
+	free := run(0, 0)
+	assert.Contains(t, runLengths(free, true), 1, "unconstrained model short-cycles")
+
+	limited := run(time.Hour, 30*time.Minute)
+	onRuns := runLengths(limited, true)
+	assert.NotEmpty(t, onRuns)
+	for _, n := range onRuns {
+		assert.GreaterOrEqual(t, n, 4, "each run lasts at least 1 h")
+	}
+	for _, n := range runLengths(limited, false) {
+		assert.GreaterOrEqual(t, n, 2, "each pause lasts at least 30 min")
+	}
+}
+
+func TestThermalModel_COPAt(t *testing.T) {
+	tm := NewThermalModel(InsulationGood)
+	assert.Equal(t, 1.0, tm.COPAt(-5))
+
+	tm.SetCOPCurve([]COPPoint{{TempC: 7, COP: 4}, {TempC: -7, COP: 2}})
+	assert.InDelta(t, 2.0, tm.COPAt(-20), 1e-9)
+	assert.InDelta(t, 3.0, tm.COPAt(0), 1e-9)
+	assert.InDelta(t, 2.5, tm.COPAt(-3.5), 1e-9)
+	assert.InDelta(t, 4.0, tm.COPAt(30), 1e-9)
+}
+
+func TestThermalModel_COPCurveChangesPreHeatSavings(t *testing.T) {
+	// Two days at −5 °C without a measured COP (cop 0), cheap nights and
+	// expensive evenings as in runThermalDays.
+	savings := func(curve []COPPoint) float64 {
+		run := func(low, high float64) float64 {
+			tm := NewThermalModel(InsulationGood)
+			tm.SetCOPCurve(curve)
+			start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+			for ts := start; ts.Before(start.Add(48 * time.Hour)); ts = ts.Add(15 * time.Minute) {
+				price := 0.60
+				switch h := ts.Hour(); {
+				case h < 8:
+					price = 0.20
+				case h >= 16:
+					price = 1.20
+				}
+				tm.Step(-5, price, low, high, 2000, 0, ts)
+			}
+			return tm.CostPLN
+		}
+		return run(0, 0) - run(0.30, 1.00)
+	}
+
+	// At COP 1 the 2 kW pump cannot cover the ~3.9 kW loss, so it runs
+	// flat out whatever the price and there is next to nothing to shift.
+	flat := savings(nil)
+	realistic := savings(DefaultCOPCurve)
+	assert.Less(t, flat, 0.5)
+	assert.Greater(t, realistic, flat+1)
+}
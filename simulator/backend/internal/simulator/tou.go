@@ -0,0 +1,30 @@
+package simulator
+
+import "time"
+
+// TOUTariff is a two-zone time-of-use tariff in the style of G12w: off-peak
+// from 22:00 to 06:00 and from 13:00 to 15:00 on working days, and all day on
+// weekends and holidays.
+type TOUTariff struct {
+	PeakPLN    float64 // PLN/kWh
+	OffPeakPLN float64 // PLN/kWh
+	// Holidays adds days billed off-peak all day; nil = weekends only.
+	Holidays *HolidayCalendar
+}
+
+// IsOffPeak reports whether ts falls in the off-peak zone.
+func (t TOUTariff) IsOffPeak(ts time.Time) bool {
+	if t.Holidays.IsOffPeakDay(ts) {
+		return true
+	}
+	h := ts.Hour()
+	return h >= 22 || h < 6 || h == 13 || h == 14
+}
+
+// RateAt returns the price per kWh at ts.
+func (t TOUTariff) RateAt(ts time.Time) float64 {
+	if t.IsOffPeak(ts) {
+		return t.OffPeakPLN
+	}
+	return t.PeakPLN
+}
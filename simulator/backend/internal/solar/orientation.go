@@ -0,0 +1,121 @@
+package solar
+
+import "math"
+
+// OrientationObjective selects what OptimizeOrientation maximizes.
+type OrientationObjective string
+
+const (
+	// ObjectiveTotalEnergy maximizes total generated energy.
+	ObjectiveTotalEnergy OrientationObjective = "total_energy"
+	// ObjectiveSelfConsumption maximizes generation consumed on site,
+	// i.e. min(PV, demand) summed over the day.
+	ObjectiveSelfConsumption OrientationObjective = "self_consumption"
+)
+
+// OrientationSearch configures the azimuth/tilt grid search.
+type OrientationSearch struct {
+	Objective OrientationObjective
+	// PeakWp is the array size used to convert factors to energy.
+	PeakWp float64
+	// BaseAzimuth is the azimuth of the installation the base profile came from.
+	BaseAzimuth float64
+	// DemandW holds the average home demand (W) for each hour [0-23].
+	// Only used by ObjectiveSelfConsumption.
+	DemandW [24]float64
+
+	AzimuthMin, AzimuthMax, AzimuthStep float64
+	TiltMin, TiltMax, TiltStep          float64
+}
+
+// DefaultOrientationSearch returns a search over east..west azimuths
+// (15° steps) and flat..vertical tilts (10° steps).
+func DefaultOrientationSearch(objective OrientationObjective, peakWp, baseAzimuth float64) OrientationSearch {
+	return OrientationSearch{
+		Objective:   objective,
+		PeakWp:      peakWp,
+		BaseAzimuth: baseAzimuth,
+		AzimuthMin:  90,
+		AzimuthMax:  270,
+		AzimuthStep: 15,
+		TiltMin:     0,
+		TiltMax:     90,
+		TiltStep:    10,
+	}
+}
+
+// OrientationCandidate is the estimated daily yield of one azimuth/tilt pair.
+type OrientationCandidate struct {
+	Azimuth         float64
+	Tilt            float64
+	EnergyKWh       float64 // generated energy per day
+	SelfConsumedKWh float64 // part of EnergyKWh covered by demand
+	Score           float64 // value of the selected objective
+}
+
+// OrientationResult holds the best orientation and the evaluated surface.
+type OrientationResult struct {
+	Best    OrientationCandidate
+	Surface []OrientationCandidate // ordered by azimuth, then tilt
+}
+
+// OptimizeOrientation grid-searches azimuth/tilt for the orientation that
+// maximizes the search objective.
+//
+// Generation is limited to the base profile's daylight hours (an oriented
+// profile can't produce after sunset), and scaled by the tilt efficiency
+// that GenerateOrientedProfile normalizes away.
+func OptimizeOrientation(base PVProfile, s OrientationSearch) OrientationResult {
+	if s.AzimuthStep <= 0 {
+		s.AzimuthStep = 15
+	}
+	if s.TiltStep <= 0 {
+		s.TiltStep = 10
+	}
+
+	var result OrientationResult
+	bestScore := -1.0
+	for az := s.AzimuthMin; az <= s.AzimuthMax+1e-9; az += s.AzimuthStep {
+		for tilt := s.TiltMin; tilt <= s.TiltMax+1e-9; tilt += s.TiltStep {
+			c := evaluateOrientation(base, s, az, tilt)
+			result.Surface = append(result.Surface, c)
+			if c.Score > bestScore {
+				bestScore = c.Score
+				result.Best = c
+			}
+		}
+	}
+	return result
+}
+
+// evaluateOrientation estimates daily energy for one orientation.
+func evaluateOrientation(base PVProfile, s OrientationSearch, azimuth, tilt float64) OrientationCandidate {
+	oriented := GenerateOrientedProfile(base, azimuth, tilt, s.BaseAzimuth)
+	efficiency := tiltEfficiency(tilt)
+
+	c := OrientationCandidate{Azimuth: azimuth, Tilt: tilt}
+	for h := 0; h < 24; h++ {
+		if base.HourlyFactor[h] <= 0 {
+			continue
+		}
+		pvW := oriented.HourlyFactor[h] * efficiency * s.PeakWp
+		c.EnergyKWh += pvW / 1000
+		c.SelfConsumedKWh += math.Min(pvW, s.DemandW[h]) / 1000
+	}
+
+	if s.Objective == ObjectiveSelfConsumption {
+		c.Score = c.SelfConsumedKWh
+	} else {
+		c.Score = c.EnergyKWh
+	}
+	return c
+}
+
+// tiltEfficiency returns the output reduction for a panel tilt, peaking at 35°.
+func tiltEfficiency(tiltDeg float64) float64 {
+	eff := math.Cos((tiltDeg - 35) * math.Pi / 180)
+	if eff < 0.5 {
+		eff = 0.5
+	}
+	return eff
+}
@@ -0,0 +1,70 @@
+package solar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noonProfile returns a symmetric profile peaking at 12:00, from a south-facing array.
+func noonProfile() PVProfile {
+	p := PVProfile{PeakHour: 12, PeakWp: 6500}
+	for h := 0; h < 24; h++ {
+		dist := float64(h) - 12.0
+		if dist*dist < 49 {
+			p.HourlyFactor[h] = 1.0 - dist*dist/49.0
+		}
+	}
+	return p
+}
+
+func TestOptimizeOrientation_TotalEnergySymmetric(t *testing.T) {
+	base := noonProfile()
+	search := DefaultOrientationSearch(ObjectiveTotalEnergy, 5000, 180)
+
+	result := OptimizeOrientation(base, search)
+
+	// Azimuths 90..270 step 15 (13) × tilts 0..90 step 10 (10)
+	require.Len(t, result.Surface, 130)
+	assert.InDelta(t, 180, result.Best.Azimuth, 15, "optimum should be near due south")
+	assert.Greater(t, result.Best.EnergyKWh, 0.0)
+	assert.Equal(t, result.Best.EnergyKWh, result.Best.Score)
+
+	// Symmetric profile: east and west offsets by the same angle yield the same energy
+	var east, west OrientationCandidate
+	for _, c := range result.Surface {
+		if c.Tilt == result.Best.Tilt && c.Azimuth == 135 {
+			east = c
+		}
+		if c.Tilt == result.Best.Tilt && c.Azimuth == 225 {
+			west = c
+		}
+	}
+	assert.InDelta(t, east.EnergyKWh, west.EnergyKWh, 0.01)
+	assert.Less(t, east.EnergyKWh, result.Best.EnergyKWh)
+}
+
+func TestOptimizeOrientation_SelfConsumptionFollowsDemand(t *testing.T) {
+	base := noonProfile()
+	search := DefaultOrientationSearch(ObjectiveSelfConsumption, 5000, 180)
+	// Demand only in the late afternoon
+	for h := 15; h <= 18; h++ {
+		search.DemandW[h] = 3000
+	}
+
+	result := OptimizeOrientation(base, search)
+
+	assert.Greater(t, result.Best.Azimuth, 180.0, "afternoon demand should favor a west-leaning array")
+	assert.Equal(t, result.Best.SelfConsumedKWh, result.Best.Score)
+	assert.LessOrEqual(t, result.Best.SelfConsumedKWh, result.Best.EnergyKWh)
+}
+
+func TestOptimizeOrientation_NoDemand(t *testing.T) {
+	search := DefaultOrientationSearch(ObjectiveSelfConsumption, 5000, 180)
+
+	result := OptimizeOrientation(noonProfile(), search)
+
+	assert.Equal(t, 0.0, result.Best.SelfConsumedKWh)
+	assert.NotEmpty(t, result.Surface)
+}
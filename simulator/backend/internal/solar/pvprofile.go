@@ -119,10 +119,7 @@ func GenerateOrientedProfile(base PVProfile, azimuthDeg, tiltDeg, baseAzimuth fl
 	}
 
 	// Also reduce total output for extreme tilts (vertical wall or flat)
-	tiltEfficiency := math.Cos((tiltDeg - 35) * math.Pi / 180)
-	if tiltEfficiency < 0.5 {
-		tiltEfficiency = 0.5
-	}
+	tiltEfficiency := tiltEfficiency(tiltDeg)
 
 	result := PVProfile{
 		PeakWp: base.PeakWp,
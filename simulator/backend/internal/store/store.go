@@ -1,7 +1,10 @@
 package store
 
 import (
+	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -9,19 +12,90 @@ import (
 )
 
 // Store holds sensor readings in memory, indexed by sensor ID.
+//
+// A Store is safe for concurrent use: reads take a shared lock and may run
+// in parallel, while AddSensor, AddReadings and AppendReadings take the
+// exclusive lock. Range queries return copies, so callers never observe a
+// slice that a later write mutates.
 type Store struct {
-	mu       sync.RWMutex
-	sensors  map[string]model.Sensor
-	readings map[string][]model.Reading // keyed by sensor ID, sorted by timestamp
+	mu          sync.RWMutex
+	sensors     map[string]model.Sensor
+	readings    map[string][]model.Reading // keyed by sensor ID, sorted by timestamp
+	calibration map[string]Calibration     // keyed by sensor ID, applied on read
 }
 
 func New() *Store {
 	return &Store{
-		sensors:  make(map[string]model.Sensor),
-		readings: make(map[string][]model.Reading),
+		sensors:     make(map[string]model.Sensor),
+		readings:    make(map[string][]model.Reading),
+		calibration: make(map[string]Calibration),
 	}
 }
 
+// Calibration corrects a sensor's systematic error: read values become
+// Value*Scale + Offset.
+type Calibration struct {
+	Scale  float64
+	Offset float64
+}
+
+// apply returns r with the calibration applied to Value and, when set,
+// Min/Max.
+func (c Calibration) apply(r model.Reading) model.Reading {
+	r.Value = r.Value*c.Scale + c.Offset
+	if r.Min != 0 || r.Max != 0 {
+		r.Min = r.Min*c.Scale + c.Offset
+		r.Max = r.Max*c.Scale + c.Offset
+	}
+	return r
+}
+
+// SetCalibration makes every read of sensorID return Value*scale + offset,
+// e.g. scale 1.03 for a PV meter known to read 3% low. The stored readings
+// are kept raw, so a new calibration replaces the old one rather than
+// stacking. Scale 1 with offset 0 removes it; a zero scale is ignored.
+func (s *Store) SetCalibration(sensorID string, scale, offset float64) {
+	if scale == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if scale == 1 && offset == 0 {
+		delete(s.calibration, sensorID)
+		return
+	}
+	s.calibration[sensorID] = Calibration{Scale: scale, Offset: offset}
+}
+
+// ParseCalibrations parses a comma-separated list of
+// sensor_id=scale[:offset] pairs, e.g. "sensor.pv=1.03,sensor.grid=1:-5".
+func ParseCalibrations(spec string) (map[string]Calibration, error) {
+	out := make(map[string]Calibration)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid calibration %q: want sensor_id=scale[:offset]", pair)
+		}
+		scaleStr, offsetStr, hasOffset := strings.Cut(value, ":")
+		scale, err := strconv.ParseFloat(strings.TrimSpace(scaleStr), 64)
+		if err != nil || scale == 0 {
+			return nil, fmt.Errorf("invalid calibration scale in %q", pair)
+		}
+		c := Calibration{Scale: scale}
+		if hasOffset {
+			if c.Offset, err = strconv.ParseFloat(strings.TrimSpace(offsetStr), 64); err != nil {
+				return nil, fmt.Errorf("invalid calibration offset in %q", pair)
+			}
+		}
+		out[strings.TrimSpace(id)] = c
+	}
+	return out, nil
+}
+
 // AddSensor registers a sensor.
 func (s *Store) AddSensor(sensor model.Sensor) {
 	s.mu.Lock()
@@ -52,20 +126,109 @@ func (s *Store) AddReadings(readings []model.Reading) {
 				return all[i].Timestamp.Before(all[j].Timestamp)
 			})
 			// Remove duplicates: keep last value for each timestamp.
-			n := 0
-			for i := range all {
-				if n > 0 && all[i].Timestamp.Equal(all[n-1].Timestamp) {
-					all[n-1] = all[i] // overwrite with later-loaded value
-				} else {
-					all[n] = all[i]
-					n++
-				}
-			}
-			s.readings[r.SensorID] = all[:n]
+			s.readings[r.SensorID] = dedupSorted(all)
+		}
+	}
+}
+
+// AppendReadings merges new readings into the existing sorted slices.
+// Intended for incremental loads while the simulation is running: readings
+// past the current end take a fast append path, older ones are merged in
+// order. As in AddReadings, a reading with an existing timestamp replaces it.
+func (s *Store) AppendReadings(readings []model.Reading) {
+	if len(readings) == 0 {
+		return
+	}
+
+	bySensor := make(map[string][]model.Reading)
+	for _, r := range readings {
+		bySensor[r.SensorID] = append(bySensor[r.SensorID], r)
+	}
+	for _, batch := range bySensor {
+		sort.SliceStable(batch, func(i, j int) bool {
+			return batch[i].Timestamp.Before(batch[j].Timestamp)
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, batch := range bySensor {
+		existing := s.readings[id]
+		if len(existing) == 0 || batch[0].Timestamp.After(existing[len(existing)-1].Timestamp) {
+			s.readings[id] = dedupSorted(append(existing, batch...))
+			continue
 		}
+		s.readings[id] = mergeSorted(existing, batch)
 	}
 }
 
+// Merge copies other's sensors, raw readings and calibrations into s. On a
+// duplicate sensor and timestamp the reading from other wins, so merging
+// stores in order gives later sources precedence.
+func (s *Store) Merge(other *Store) {
+	other.mu.RLock()
+	sensors := make([]model.Sensor, 0, len(other.sensors))
+	for _, sensor := range other.sensors {
+		sensors = append(sensors, sensor)
+	}
+	readings := make(map[string][]model.Reading, len(other.readings))
+	for id, rs := range other.readings {
+		readings[id] = append([]model.Reading(nil), rs...)
+	}
+	calibration := make(map[string]Calibration, len(other.calibration))
+	for id, c := range other.calibration {
+		calibration[id] = c
+	}
+	other.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sensor := range sensors {
+		s.sensors[sensor.ID] = sensor
+	}
+	for id, c := range calibration {
+		s.calibration[id] = c
+	}
+	for id, rs := range readings {
+		s.readings[id] = mergeSorted(s.readings[id], rs)
+	}
+}
+
+// mergeSorted merges two timestamp-sorted slices into a new slice.
+// On equal timestamps the reading from b wins.
+func mergeSorted(a, b []model.Reading) []model.Reading {
+	out := make([]model.Reading, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j >= len(b) || (i < len(a) && a[i].Timestamp.Before(b[j].Timestamp)):
+			out = append(out, a[i])
+			i++
+		case i >= len(a) || b[j].Timestamp.Before(a[i].Timestamp):
+			out = append(out, b[j])
+			j++
+		default: // equal timestamps
+			i++
+		}
+	}
+	return dedupSorted(out)
+}
+
+// dedupSorted removes duplicate timestamps in place, keeping the last value.
+func dedupSorted(all []model.Reading) []model.Reading {
+	n := 0
+	for i := range all {
+		if n > 0 && all[i].Timestamp.Equal(all[n-1].Timestamp) {
+			all[n-1] = all[i]
+		} else {
+			all[n] = all[i]
+			n++
+		}
+	}
+	return all[:n]
+}
+
 // Sensors returns all registered sensors.
 func (s *Store) Sensors() []model.Sensor {
 	s.mu.RLock()
@@ -101,6 +264,41 @@ func (s *Store) TimeRange(sensorID string) (model.TimeRange, bool) {
 	}, true
 }
 
+// Coverage summarizes how completely a sensor's data covers time.
+type Coverage struct {
+	First          time.Time
+	Last           time.Time
+	Count          int
+	MedianInterval time.Duration // 0 with fewer than two readings
+}
+
+// Coverage returns the first/last timestamp, reading count and median gap
+// between consecutive readings of a sensor.
+func (s *Store) Coverage(sensorID string) (Coverage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	readings := s.readings[sensorID]
+	if len(readings) == 0 {
+		return Coverage{}, false
+	}
+
+	c := Coverage{
+		First: readings[0].Timestamp,
+		Last:  readings[len(readings)-1].Timestamp,
+		Count: len(readings),
+	}
+	if len(readings) > 1 {
+		gaps := make([]time.Duration, len(readings)-1)
+		for i := 1; i < len(readings); i++ {
+			gaps[i-1] = readings[i].Timestamp.Sub(readings[i-1].Timestamp)
+		}
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		c.MedianInterval = gaps[len(gaps)/2]
+	}
+	return c, true
+}
+
 // GlobalTimeRange returns the union of all sensors' time ranges.
 // Start is the earliest first-reading, End is the latest last-reading.
 func (s *Store) GlobalTimeRange() (model.TimeRange, bool) {
@@ -141,7 +339,44 @@ func (s *Store) GlobalTimeRange() (model.TimeRange, bool) {
 func (s *Store) ReadingsInRange(sensorID string, start, end time.Time) []model.Reading {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.readingsInRangeLocked(sensorID, start, end)
+}
 
+// SeriesByType returns the readings of every registered sensor of type t in
+// tr (Start inclusive, End exclusive), in timestamp order. With a single
+// matching sensor this equals ReadingsInRange for it. With several, their
+// readings are merged; readings sharing a timestamp are all kept, ordered by
+// sensor ID.
+func (s *Store) SeriesByType(t model.SensorType, tr model.TimeRange) []model.Reading {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for id, sensor := range s.sensors {
+		if sensor.Type == t {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	if len(ids) == 1 {
+		return s.readingsInRangeLocked(ids[0], tr.Start, tr.End)
+	}
+
+	var out []model.Reading
+	for _, id := range ids {
+		out = append(out, s.readingsInRangeLocked(id, tr.Start, tr.End)...)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out
+}
+
+// readingsInRangeLocked implements ReadingsInRange. Must be called with mu held.
+func (s *Store) readingsInRangeLocked(sensorID string, start, end time.Time) []model.Reading {
 	all := s.readings[sensorID]
 	if len(all) == 0 {
 		return nil
@@ -163,9 +398,140 @@ func (s *Store) ReadingsInRange(sensorID string, start, end time.Time) []model.R
 
 	result := make([]model.Reading, endIdx-startIdx)
 	copy(result, all[startIdx:endIdx])
+	if c, ok := s.calibration[sensorID]; ok {
+		for i := range result {
+			result[i] = c.apply(result[i])
+		}
+	}
 	return result
 }
 
+// Downsample aggregates a sensor's readings in tr into at most buckets
+// equal-width time buckets, for overview charts. Each returned reading is
+// stamped at its bucket start and carries the bucket mean as Value and the
+// extremes of the underlying readings' Min/Max. Empty buckets are omitted.
+func (s *Store) Downsample(sensorID string, tr model.TimeRange, buckets int) []model.Reading {
+	if buckets <= 0 || !tr.Start.Before(tr.End) {
+		return nil
+	}
+	readings := s.ReadingsInRange(sensorID, tr.Start, tr.End)
+	if len(readings) == 0 {
+		return nil
+	}
+
+	width := tr.End.Sub(tr.Start) / time.Duration(buckets)
+	if width <= 0 {
+		width = 1
+	}
+
+	var out []model.Reading
+	var sum float64
+	var count int
+	var cur model.Reading
+	curIdx := -1
+	flush := func() {
+		if count > 0 {
+			cur.Value = sum / float64(count)
+			out = append(out, cur)
+		}
+	}
+
+	for _, r := range readings {
+		idx := int(r.Timestamp.Sub(tr.Start) / width)
+		if idx >= buckets {
+			idx = buckets - 1
+		}
+		lo, hi := readingBounds(r)
+		if idx != curIdx {
+			flush()
+			curIdx = idx
+			sum, count = 0, 0
+			cur = model.Reading{
+				Timestamp: tr.Start.Add(time.Duration(idx) * width),
+				SensorID:  r.SensorID,
+				Type:      r.Type,
+				Unit:      r.Unit,
+				Min:       lo,
+				Max:       hi,
+			}
+		}
+		sum += r.Value
+		count++
+		cur.Min = min(cur.Min, lo)
+		cur.Max = max(cur.Max, hi)
+	}
+	flush()
+	return out
+}
+
+// TopN returns the n most extreme readings of a sensor in tr (Start
+// inclusive, End exclusive): the highest values first when byMax, else the
+// lowest first. Readings with equal values keep timestamp order.
+func (s *Store) TopN(sensorID string, tr model.TimeRange, n int, byMax bool) []model.Reading {
+	if n <= 0 {
+		return nil
+	}
+	readings := s.ReadingsInRange(sensorID, tr.Start, tr.End)
+	sort.SliceStable(readings, func(i, j int) bool {
+		if byMax {
+			return readings[i].Value > readings[j].Value
+		}
+		return readings[i].Value < readings[j].Value
+	})
+	if len(readings) > n {
+		readings = readings[:n]
+	}
+	return readings
+}
+
+// Resample buckets one series into interval-aligned slots (timestamps
+// truncated to interval) and returns one reading per non-empty slot, stamped
+// at the slot start with the slot mean as Value, in time order. Unlike
+// Downsample the slots are fixed to the clock rather than to a range, so two
+// series sampled on different clocks land in the same slots and can be joined
+// on timestamp.
+func Resample(readings []model.Reading, interval time.Duration) []model.Reading {
+	if interval <= 0 || len(readings) == 0 {
+		return nil
+	}
+
+	type slot struct {
+		r     model.Reading
+		sum   float64
+		count int
+	}
+	slots := make(map[time.Time]*slot)
+	for _, r := range readings {
+		ts := r.Timestamp.Truncate(interval)
+		sl, ok := slots[ts]
+		if !ok {
+			sl = &slot{r: model.Reading{Timestamp: ts, SensorID: r.SensorID, Type: r.Type, Unit: r.Unit}}
+			slots[ts] = sl
+		}
+		sl.sum += r.Value
+		sl.count++
+	}
+
+	out := make([]model.Reading, 0, len(slots))
+	for _, sl := range slots {
+		sl.r.Value = sl.sum / float64(sl.count)
+		out = append(out, sl.r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out
+}
+
+// readingBounds returns a reading's min/max, falling back to Value when
+// Min/Max are unset.
+func readingBounds(r model.Reading) (lo, hi float64) {
+	if r.Min == 0 && r.Max == 0 {
+		return r.Value, r.Value
+	}
+	return min(r.Min, r.Value), max(r.Max, r.Value)
+}
+
 // ReadingAt returns the most recent reading at or before the given timestamp.
 func (s *Store) ReadingAt(sensorID string, t time.Time) (model.Reading, bool) {
 	s.mu.RLock()
@@ -185,5 +551,8 @@ func (s *Store) ReadingAt(sensorID string, t time.Time) (model.Reading, bool) {
 		return model.Reading{}, false
 	}
 
+	if c, ok := s.calibration[sensorID]; ok {
+		return c.apply(all[idx-1]), true
+	}
 	return all[idx-1], true
 }
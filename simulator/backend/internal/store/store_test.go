@@ -1,6 +1,8 @@
 package store
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -53,6 +55,46 @@ func TestStore_TimeRange(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestStore_Coverage(t *testing.T) {
+	s := New()
+	readings := makeReadings(sensorID, []float64{1, 2, 3, 4, 5}, startTime, time.Minute)
+	readings[4].Timestamp = startTime.Add(3 * hour) // one long gap
+	s.AddReadings(readings)
+
+	c, ok := s.Coverage(sensorID)
+	require.True(t, ok)
+	assert.Equal(t, startTime, c.First)
+	assert.Equal(t, startTime.Add(3*hour), c.Last)
+	assert.Equal(t, 5, c.Count)
+	assert.Equal(t, time.Minute, c.MedianInterval)
+
+	_, ok = s.Coverage("nonexistent")
+	assert.False(t, ok)
+}
+
+func TestStore_Merge(t *testing.T) {
+	a := New()
+	a.AddSensor(model.Sensor{ID: sensorID, Name: "Grid A"})
+	a.AddReadings(makeReadings(sensorID, []float64{1, 2, 3}, startTime, hour))
+
+	b := New()
+	b.AddSensor(model.Sensor{ID: sensorID, Name: "Grid B"})
+	b.AddSensor(model.Sensor{ID: "sensor.pv", Name: "PV"})
+	b.AddReadings(makeReadings(sensorID, []float64{20, 30, 40}, startTime.Add(hour), hour))
+	b.AddReadings(makeReadings("sensor.pv", []float64{5}, startTime, hour))
+
+	a.Merge(b)
+
+	got := a.ReadingsInRange(sensorID, startTime, startTime.Add(4*hour))
+	require.Len(t, got, 4)
+	assert.Equal(t, []float64{1, 20, 30, 40}, []float64{got[0].Value, got[1].Value, got[2].Value, got[3].Value})
+	assert.Equal(t, 1, a.ReadingCount("sensor.pv"))
+	assert.Len(t, a.Sensors(), 2)
+
+	// The merged-in store is left untouched
+	assert.Equal(t, 3, b.ReadingCount(sensorID))
+}
+
 func TestStore_ReadingsInRange(t *testing.T) {
 	s := New()
 	readings := makeReadings(sensorID, []float64{100, 200, 300, 400, 500}, startTime, hour)
@@ -73,6 +115,52 @@ func TestStore_ReadingsInRange(t *testing.T) {
 	assert.Empty(t, result)
 }
 
+func TestStore_SeriesByType_SingleSensor(t *testing.T) {
+	s := New()
+	s.AddSensor(model.Sensor{ID: sensorID, Type: model.SensorGridPower})
+	s.AddReadings(makeReadings(sensorID, []float64{100, 200, 300, 400}, startTime, hour))
+
+	tr := model.TimeRange{Start: startTime.Add(hour), End: startTime.Add(3 * hour)}
+	assert.Equal(t, s.ReadingsInRange(sensorID, tr.Start, tr.End), s.SeriesByType(model.SensorGridPower, tr))
+	assert.Nil(t, s.SeriesByType(model.SensorPVPower, tr))
+}
+
+func TestStore_SeriesByType_MergesSensorsOfSameType(t *testing.T) {
+	s := New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid_b", Type: model.SensorGridPower})
+	s.AddSensor(model.Sensor{ID: "sensor.grid_a", Type: model.SensorGridPower})
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Type: model.SensorPVPower})
+	// grid_b covers hours 0 and 2, grid_a hours 1 and 2 (shared timestamp).
+	s.AddReadings([]model.Reading{
+		{Timestamp: startTime, SensorID: "sensor.grid_b", Type: model.SensorGridPower, Value: 10},
+		{Timestamp: startTime.Add(2 * hour), SensorID: "sensor.grid_b", Type: model.SensorGridPower, Value: 12},
+		{Timestamp: startTime.Add(hour), SensorID: "sensor.grid_a", Type: model.SensorGridPower, Value: 21},
+		{Timestamp: startTime.Add(2 * hour), SensorID: "sensor.grid_a", Type: model.SensorGridPower, Value: 22},
+		{Timestamp: startTime.Add(hour), SensorID: "sensor.pv", Type: model.SensorPVPower, Value: 99},
+	})
+
+	tr := model.TimeRange{Start: startTime, End: startTime.Add(3 * hour)}
+	series := s.SeriesByType(model.SensorGridPower, tr)
+
+	require.Len(t, series, 4)
+	var got []string
+	for _, r := range series {
+		got = append(got, fmt.Sprintf("%s=%.0f", r.SensorID, r.Value))
+	}
+	// Time order; the shared timestamp is ordered by sensor ID.
+	assert.Equal(t, []string{
+		"sensor.grid_b=10",
+		"sensor.grid_a=21",
+		"sensor.grid_a=22",
+		"sensor.grid_b=12",
+	}, got)
+
+	// Repeated calls give the same order regardless of map iteration.
+	for range 10 {
+		assert.Equal(t, series, s.SeriesByType(model.SensorGridPower, tr))
+	}
+}
+
 func TestStore_ReadingAt(t *testing.T) {
 	s := New()
 	readings := makeReadings(sensorID, []float64{100, 200, 300}, startTime, hour)
@@ -93,6 +181,42 @@ func TestStore_ReadingAt(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestStore_SetCalibration(t *testing.T) {
+	s := New()
+	s.AddReadings(makeReadings(sensorID, []float64{100, 200}, startTime, hour))
+
+	s.SetCalibration(sensorID, 1.03, -1)
+	rs := s.ReadingsInRange(sensorID, startTime, startTime.Add(2*hour))
+	require.Len(t, rs, 2)
+	assert.InDelta(t, 102, rs[0].Value, 1e-9)
+	assert.InDelta(t, 205, rs[1].Value, 1e-9)
+	r, ok := s.ReadingAt(sensorID, startTime.Add(hour))
+	require.True(t, ok)
+	assert.InDelta(t, 205, r.Value, 1e-9)
+
+	// Replaces rather than stacks; scale 1 with no offset removes it.
+	s.SetCalibration(sensorID, 2, 0)
+	r, _ = s.ReadingAt(sensorID, startTime)
+	assert.InDelta(t, 200, r.Value, 1e-9)
+	s.SetCalibration(sensorID, 1, 0)
+	r, _ = s.ReadingAt(sensorID, startTime)
+	assert.InDelta(t, 100, r.Value, 1e-9)
+}
+
+func TestParseCalibrations(t *testing.T) {
+	got, err := ParseCalibrations("sensor.pv=1.03, sensor.grid=1:-5")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Calibration{
+		"sensor.pv":   {Scale: 1.03},
+		"sensor.grid": {Scale: 1, Offset: -5},
+	}, got)
+
+	for _, bad := range []string{"sensor.pv", "sensor.pv=x", "sensor.pv=0", "sensor.pv=1:y"} {
+		_, err := ParseCalibrations(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
 func TestStore_Sensors(t *testing.T) {
 	s := New()
 	s.AddSensor(model.Sensor{ID: "sensor.grid", Name: "Grid Power", Type: model.SensorGridPower, Unit: "W"})
@@ -172,3 +296,275 @@ func TestStore_AddReadingsUnsorted(t *testing.T) {
 	assert.InDelta(t, 200.0, result[1].Value, 0.001)
 	assert.InDelta(t, 300.0, result[2].Value, 0.001)
 }
+
+func TestStore_AppendReadings(t *testing.T) {
+	s := New()
+	s.AddReadings(makeReadings(sensorID, []float64{100, 200, 300}, startTime, hour))
+
+	// New data after the current end
+	s.AppendReadings(makeReadings(sensorID, []float64{400, 500}, startTime.Add(3*hour), hour))
+
+	result := s.ReadingsInRange(sensorID, startTime, startTime.Add(10*hour))
+	require.Len(t, result, 5)
+	assert.InDelta(t, 400.0, result[3].Value, 0.001)
+	assert.InDelta(t, 500.0, result[4].Value, 0.001)
+
+	tr, ok := s.GlobalTimeRange()
+	require.True(t, ok)
+	assert.Equal(t, startTime.Add(4*hour), tr.End)
+}
+
+func TestStore_AppendReadingsOverlapAndUnsorted(t *testing.T) {
+	s := New()
+	s.AddReadings(makeReadings(sensorID, []float64{100, 200, 300}, startTime, 2*hour))
+
+	// Unsorted batch: fills a gap, overwrites an existing timestamp, extends the end
+	s.AppendReadings([]model.Reading{
+		{Timestamp: startTime.Add(6 * hour), SensorID: sensorID, Value: 400},
+		{Timestamp: startTime.Add(hour), SensorID: sensorID, Value: 150},
+		{Timestamp: startTime.Add(2 * hour), SensorID: sensorID, Value: 250},
+	})
+
+	result := s.ReadingsInRange(sensorID, startTime, startTime.Add(10*hour))
+	require.Len(t, result, 5)
+	values := make([]float64, len(result))
+	for i, r := range result {
+		values[i] = r.Value
+	}
+	assert.Equal(t, []float64{100, 150, 250, 300, 400}, values)
+	for i := 1; i < len(result); i++ {
+		assert.True(t, result[i-1].Timestamp.Before(result[i].Timestamp))
+	}
+}
+
+func TestStore_AppendReadingsNewSensor(t *testing.T) {
+	s := New()
+	s.AppendReadings(makeReadings("sensor.new", []float64{1, 1, 2}, startTime, hour))
+	assert.Equal(t, 3, s.ReadingCount("sensor.new"))
+}
+
+// Run with -race to catch unsynchronised access.
+func TestStore_ConcurrentReadersAndWriter(t *testing.T) {
+	s := New()
+	s.AddSensor(model.Sensor{ID: sensorID, Name: "Grid", Type: model.SensorGridPower, Unit: "W"})
+	s.AddReadings(makeReadings(sensorID, []float64{100, 200, 300}, startTime, hour))
+
+	const batches = 50
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < batches; i++ {
+			s.AddSensor(model.Sensor{ID: fmt.Sprintf("sensor.extra%d", i), Type: model.SensorPVPower})
+			s.AppendReadings(makeReadings(sensorID, []float64{float64(i)}, startTime.Add(time.Duration(3+i)*hour), hour))
+			s.AddReadings(makeReadings("sensor.other", []float64{float64(i)}, startTime.Add(time.Duration(i)*hour), hour))
+		}
+	}()
+
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < batches; i++ {
+				readings := s.ReadingsInRange(sensorID, startTime, startTime.Add(100*hour))
+				for j := 1; j < len(readings); j++ {
+					if !readings[j-1].Timestamp.Before(readings[j].Timestamp) {
+						t.Errorf("readings out of order at %d", j)
+						return
+					}
+				}
+				s.ReadingAt(sensorID, startTime.Add(time.Duration(i)*hour))
+				s.Sensors()
+				s.GlobalTimeRange()
+				s.TimeRange(sensorID)
+				s.ReadingCount(sensorID)
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 3+batches, s.ReadingCount(sensorID))
+	assert.Len(t, s.Sensors(), 1+batches)
+}
+
+// linearReadingsInRange is the reference implementation for range queries.
+func linearReadingsInRange(all []model.Reading, start, end time.Time) []model.Reading {
+	var out []model.Reading
+	for _, r := range all {
+		if !r.Timestamp.Before(start) && r.Timestamp.Before(end) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// linearReadingAt is the reference implementation for point lookups.
+func linearReadingAt(all []model.Reading, t time.Time) (model.Reading, bool) {
+	var found model.Reading
+	ok := false
+	for _, r := range all {
+		if r.Timestamp.After(t) {
+			break
+		}
+		found, ok = r, true
+	}
+	return found, ok
+}
+
+func TestStore_BinarySearchMatchesLinearScan(t *testing.T) {
+	values := make([]float64, 500)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	all := makeReadings(sensorID, values, startTime, 7*time.Minute)
+	s := New()
+	s.AddReadings(all)
+
+	// Query boundaries on, between, before and after reading timestamps
+	for _, offset := range []time.Duration{-time.Hour, 0, time.Minute, 7 * time.Minute, 13 * time.Hour, 58*time.Hour + 17*time.Minute, 100 * time.Hour} {
+		for _, span := range []time.Duration{0, time.Minute, 7 * time.Minute, 5 * time.Hour, 200 * time.Hour} {
+			start := startTime.Add(offset)
+			end := start.Add(span)
+			assert.Equal(t, linearReadingsInRange(all, start, end), s.ReadingsInRange(sensorID, start, end),
+				"range %v +%v", offset, span)
+		}
+
+		want, wantOK := linearReadingAt(all, startTime.Add(offset))
+		got, gotOK := s.ReadingAt(sensorID, startTime.Add(offset))
+		assert.Equal(t, wantOK, gotOK)
+		assert.Equal(t, want, got)
+	}
+}
+
+func benchmarkStore(b *testing.B) (*Store, []model.Reading) {
+	b.Helper()
+	values := make([]float64, 1_000_000)
+	all := makeReadings(sensorID, values, startTime, time.Minute)
+	s := New()
+	s.AddReadings(all)
+	return s, all
+}
+
+// BenchmarkReadingsInRange queries one hour out of ~2 years of minute data.
+func BenchmarkReadingsInRange(b *testing.B) {
+	s, _ := benchmarkStore(b)
+	start := startTime.Add(500_000 * time.Minute)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ReadingsInRange(sensorID, start, start.Add(time.Hour))
+	}
+}
+
+// BenchmarkReadingsInRange_Linear is the linear-scan baseline for comparison.
+func BenchmarkReadingsInRange_Linear(b *testing.B) {
+	_, all := benchmarkStore(b)
+	start := startTime.Add(500_000 * time.Minute)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearReadingsInRange(all, start, start.Add(time.Hour))
+	}
+}
+
+func BenchmarkReadingAt(b *testing.B) {
+	s, _ := benchmarkStore(b)
+	at := startTime.Add(500_000 * time.Minute)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ReadingAt(sensorID, at)
+	}
+}
+
+func TestStore_Downsample(t *testing.T) {
+	values := make([]float64, 240) // 10 days hourly
+	for i := range values {
+		values[i] = float64(i % 24)
+	}
+	s := New()
+	s.AddReadings(makeReadings(sensorID, values, startTime, hour))
+	tr := model.TimeRange{Start: startTime, End: startTime.Add(240 * hour)}
+
+	out := s.Downsample(sensorID, tr, 10)
+	require.Len(t, out, 10)
+	for i, r := range out {
+		assert.Equal(t, startTime.Add(time.Duration(i)*24*hour), r.Timestamp)
+		assert.InDelta(t, 11.5, r.Value, 1e-9) // mean of 0..23
+		assert.Equal(t, 0.0, r.Min)
+		assert.Equal(t, 23.0, r.Max)
+		assert.Equal(t, sensorID, r.SensorID)
+	}
+}
+
+func TestStore_DownsamplePreservesReadingMinMax(t *testing.T) {
+	s := New()
+	s.AddReadings([]model.Reading{
+		{Timestamp: startTime, SensorID: sensorID, Value: 100, Min: 20, Max: 900},
+		{Timestamp: startTime.Add(30 * time.Minute), SensorID: sensorID, Value: 200, Min: 150, Max: 250},
+		{Timestamp: startTime.Add(hour), SensorID: sensorID, Value: 50, Min: -300, Max: 60},
+	})
+	tr := model.TimeRange{Start: startTime, End: startTime.Add(2 * hour)}
+
+	out := s.Downsample(sensorID, tr, 2)
+	require.Len(t, out, 2)
+	assert.InDelta(t, 150, out[0].Value, 1e-9)
+	assert.Equal(t, 20.0, out[0].Min)
+	assert.Equal(t, 900.0, out[0].Max)
+	assert.Equal(t, -300.0, out[1].Min)
+	assert.Equal(t, 60.0, out[1].Max)
+}
+
+func TestStore_DownsampleSparse(t *testing.T) {
+	s := New()
+	s.AddReadings(makeReadings(sensorID, []float64{1, 2, 3}, startTime, hour))
+	tr := model.TimeRange{Start: startTime, End: startTime.Add(3 * hour)}
+
+	// More buckets than readings: empty buckets are omitted
+	assert.Len(t, s.Downsample(sensorID, tr, 100), 3)
+	assert.Nil(t, s.Downsample(sensorID, tr, 0))
+	assert.Nil(t, s.Downsample("nonexistent", tr, 10))
+}
+
+func TestStore_TopN(t *testing.T) {
+	s := New()
+	s.AddReadings(makeReadings(sensorID, []float64{300, 4200, -1500, 800, 4200, 50, -2600, 3900}, startTime, hour))
+	tr := model.TimeRange{Start: startTime, End: startTime.Add(8 * hour)}
+
+	values := func(rs []model.Reading) []float64 {
+		out := make([]float64, len(rs))
+		for i, r := range rs {
+			out[i] = r.Value
+		}
+		return out
+	}
+
+	top := s.TopN(sensorID, tr, 3, true)
+	assert.Equal(t, []float64{4200, 4200, 3900}, values(top))
+	// Ties keep timestamp order.
+	assert.Equal(t, startTime.Add(hour), top[0].Timestamp)
+	assert.Equal(t, startTime.Add(4*hour), top[1].Timestamp)
+
+	assert.Equal(t, []float64{-2600, -1500, 50}, values(s.TopN(sensorID, tr, 3, false)))
+
+	// The range bounds the search and n larger than the range returns all.
+	early := model.TimeRange{Start: startTime, End: startTime.Add(4 * hour)}
+	assert.Equal(t, []float64{4200, 800, 300, -1500}, values(s.TopN(sensorID, early, 10, true)))
+
+	assert.Nil(t, s.TopN(sensorID, tr, 0, true))
+	assert.Empty(t, s.TopN("nonexistent", tr, 5, true))
+}
+
+func TestResample_HourlyMean(t *testing.T) {
+	// 15-minute readings starting 10 minutes past the hour.
+	readings := makeReadings(sensorID, []float64{100, 200, 300, 400, 500, 600}, startTime.Add(10*time.Minute), 15*time.Minute)
+
+	out := Resample(readings, hour)
+	require.Len(t, out, 2)
+	assert.Equal(t, startTime, out[0].Timestamp)
+	assert.InDelta(t, 250, out[0].Value, 1e-9) // 12:10, 12:25, 12:40, 12:55
+	assert.Equal(t, startTime.Add(hour), out[1].Timestamp)
+	assert.InDelta(t, 550, out[1].Value, 1e-9)
+	assert.Equal(t, sensorID, out[1].SensorID)
+
+	assert.Nil(t, Resample(readings, 0))
+	assert.Nil(t, Resample(nil, hour))
+}
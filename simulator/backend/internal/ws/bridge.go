@@ -67,9 +67,14 @@ func (b *Bridge) OnBatterySummary(s simulator.BatterySummary) {
 		Cycles:               s.Cycles,
 		EffectiveCapacityKWh: s.EffectiveCapacityKWh,
 		DegradationPct:       s.DegradationPct,
+		ReclaimedKWh:         s.ReclaimedKWh,
 		TimeAtPowerSec:       s.TimeAtPowerSec,
 		TimeAtSoCPctSec:      s.TimeAtSoCPctSec,
 		MonthSoCSeconds:      s.MonthSoCSeconds,
+
+		ArbChargeKWhByPrice:    s.ArbChargeKWhByPrice,
+		ArbDischargeKWhByPrice: s.ArbDischargeKWhByPrice,
+		ImportLimitedIntervals: s.ImportLimitedIntervals,
 	})
 	if err != nil {
 		log.Printf("Error marshaling battery summary: %v", err)
@@ -146,3 +151,75 @@ func (b *Bridge) OnPowerQuality(pq simulator.PowerQuality) {
 	}
 	b.hub.Broadcast(msg)
 }
+
+func (b *Bridge) OnDailySummary(s simulator.PeriodSummary) {
+	msg, err := NewEnvelope(TypeDailySummary, PeriodSummaryFromEngine(s))
+	if err != nil {
+		log.Printf("Error marshaling daily summary: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
+
+func (b *Bridge) OnMonthlySummary(s simulator.PeriodSummary) {
+	msg, err := NewEnvelope(TypeMonthlySummary, PeriodSummaryFromEngine(s))
+	if err != nil {
+		log.Printf("Error marshaling monthly summary: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
+
+func (b *Bridge) OnApplianceCosts(costs []simulator.ApplianceCost) {
+	msg, err := NewEnvelope(TypeApplianceCosts, ApplianceCostsFromEngine(costs))
+	if err != nil {
+		log.Printf("Error marshaling appliance costs: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
+
+func (b *Bridge) OnStrategyComparison(c simulator.StrategyComparison) {
+	msg, err := NewEnvelope(TypeStrategyComparison, StrategyComparisonFromEngine(c))
+	if err != nil {
+		log.Printf("Error marshaling strategy comparison: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
+
+func (b *Bridge) OnConfigComparison(c simulator.ConfigComparison) {
+	msg, err := NewEnvelope(TypeConfigComparison, ConfigComparisonFromEngine(c))
+	if err != nil {
+		log.Printf("Error marshaling config comparison: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
+
+func (b *Bridge) OnMonthlyCosts(costs []simulator.MonthlyCost) {
+	msg, err := NewEnvelope(TypeCostMonthly, MonthlyCostsFromEngine(costs))
+	if err != nil {
+		log.Printf("Error marshaling monthly costs: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
+
+func (b *Bridge) OnEvent(ev simulator.Event) {
+	msg, err := NewEnvelope(TypeEventLog, EventFromEngine(ev))
+	if err != nil {
+		log.Printf("Error marshaling event: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
+
+func (b *Bridge) OnFlowSankey(f simulator.FlowSankey) {
+	msg, err := NewEnvelope(TypeFlowSankey, FlowSankeyFromEngine(f))
+	if err != nil {
+		log.Printf("Error marshaling flow sankey: %v", err)
+		return
+	}
+	b.hub.Broadcast(msg)
+}
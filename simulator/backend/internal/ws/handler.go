@@ -1,44 +1,109 @@
 package ws
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 
 	"energy_simulator/internal/model"
 	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/solar"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+// AccessConfig controls who may open a WebSocket connection.
+type AccessConfig struct {
+	// AllowedOrigins lists origins (e.g. "https://energy.example.com") allowed
+	// in addition to the server's own. "*" allows any origin.
+	AllowedOrigins []string
+	// Token, when set, must be presented as "Authorization: Bearer <token>"
+	// or as a ?token= query parameter (browsers can't set WS headers).
+	Token string
 }
 
 // Handler manages WebSocket connections and routes messages to the engine.
 type Handler struct {
 	hub          *Hub
 	engine       *simulator.Engine
+	mu           sync.RWMutex // guards sourceRanges
 	sourceRanges map[string]model.TimeRange
+	namedRanges  *NamedRanges
+	access       AccessConfig
+	upgrader     websocket.Upgrader
 }
 
+// NewHandler creates a handler accepting same-origin connections without auth.
 func NewHandler(hub *Hub, engine *simulator.Engine, sourceRanges map[string]model.TimeRange) *Handler {
-	return &Handler{hub: hub, engine: engine, sourceRanges: sourceRanges}
+	h := &Handler{hub: hub, engine: engine, sourceRanges: sourceRanges, namedRanges: NewNamedRanges()}
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	return h
+}
+
+// SetNamedRanges replaces the in-memory named range registry, e.g. with one
+// persisted to a file.
+func (h *Handler) SetNamedRanges(nr *NamedRanges) {
+	h.namedRanges = nr
+}
+
+// SetAccess configures allowed origins and the bearer token.
+func (h *Handler) SetAccess(cfg AccessConfig) {
+	h.access = cfg
+}
+
+// checkOrigin allows requests without an Origin header (non-browser clients),
+// same-origin requests, and origins in the allow list.
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range h.access.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized reports whether the request carries the configured token.
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.access.Token == "" {
+		return true
+	}
+	got := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(h.access.Token)) == 1
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Upgrade responds with 403 Forbidden when checkOrigin rejects the request.
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
-	client := &Client{
-		hub:  h.hub,
-		conn: conn,
-		send: make(chan []byte, 256),
-	}
+	client := h.hub.newClient(conn)
 
 	h.hub.Register(client)
 	go client.writePump()
@@ -94,6 +159,14 @@ func (h *Handler) handleMessage(msg []byte) {
 		}
 		h.engine.SetSpeed(p.Speed)
 
+	case TypeSimFinishIn:
+		var p FinishInPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			log.Printf("Invalid finish_in payload: %v", err)
+			return
+		}
+		h.engine.SetSpeedToFinishIn(time.Duration(p.Seconds * float64(time.Second)))
+
 	case TypeSimSeek:
 		var p SeekPayload
 		if err := json.Unmarshal(env.Payload, &p); err != nil {
@@ -113,7 +186,12 @@ func (h *Handler) handleMessage(msg []byte) {
 			log.Printf("Invalid set_source payload: %v", err)
 			return
 		}
+		h.mu.RLock()
 		tr, ok := h.sourceRanges[p.Source]
+		h.mu.RUnlock()
+		if !ok {
+			tr, ok = h.namedRanges.Get(p.Source)
+		}
 		if !ok {
 			log.Printf("Unknown source: %s", p.Source)
 			return
@@ -128,12 +206,10 @@ func (h *Handler) handleMessage(msg []byte) {
 			return
 		}
 		if p.Enabled {
-			cfg := &simulator.BatteryConfig{
-				CapacityKWh:        p.CapacityKWh,
-				MaxPowerW:          p.MaxPowerW,
-				DischargeToPercent: p.DischargeToPercent,
-				ChargeToPercent:    p.ChargeToPercent,
-				DegradationCycles:  p.DegradationCycles,
+			cfg, err := batteryConfigFromPayload(p)
+			if err != nil {
+				log.Printf("Invalid battery config payload: %v", err)
+				return
 			}
 			h.engine.SetBattery(cfg)
 		} else {
@@ -142,6 +218,25 @@ func (h *Handler) handleMessage(msg []byte) {
 		// Reset simulation to apply battery from the start
 		h.engine.Seek(h.engine.TimeRange().Start)
 
+	case TypeCompareConfig:
+		var p CompareConfigPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			log.Printf("Invalid compare config payload: %v", err)
+			return
+		}
+		if p.Enabled {
+			cfg, err := batteryConfigFromPayload(p.Config)
+			if err != nil {
+				log.Printf("Invalid compare config payload: %v", err)
+				return
+			}
+			h.engine.SetCompareBattery(cfg, p.Strategy)
+		} else {
+			h.engine.SetCompareBattery(nil, "")
+		}
+		// Replay from the start so both batteries cover the same data
+		h.engine.Seek(h.engine.TimeRange().Start)
+
 	case TypeSimSetPrediction:
 		var p SetPredictionPayload
 		if err := json.Unmarshal(env.Payload, &p); err != nil {
@@ -149,7 +244,13 @@ func (h *Handler) handleMessage(msg []byte) {
 			return
 		}
 		h.engine.Pause()
-		h.engine.SetPredictionMode(p.Enabled)
+		if p.Enabled && p.CatchUp {
+			h.engine.SetPredictionMode(false)
+			h.engine.SetPredictionCatchUp(true)
+		} else {
+			h.engine.SetPredictionCatchUp(false)
+			h.engine.SetPredictionMode(p.Enabled)
+		}
 		h.broadcastDataLoaded()
 		if p.Enabled {
 			h.engine.Start()
@@ -162,8 +263,29 @@ func (h *Handler) handleMessage(msg []byte) {
 			return
 		}
 		h.engine.SetExportCoefficient(p.ExportCoefficient)
+		if n := len(p.ExportCoefficientMonthly); n != 0 && n != 12 {
+			log.Printf("config:update: export_coefficient_monthly needs 12 values, got %d", n)
+		} else {
+			h.engine.SetMonthlyExportCoefficients(p.ExportCoefficientMonthly)
+		}
 		h.engine.SetPriceThreshold(p.PriceThresholdPLN)
+		h.engine.SetCheapExportPercentile(p.CheapExportPercentile)
 		h.engine.SetTempOffset(p.TempOffsetC)
+		h.setAwayMode(p)
+		h.setTOUTariff(p)
+		h.engine.SetMustRunLoad(p.MustRunW)
+		if w := p.LoadShiftWindowH; w != nil {
+			if *w < 0 || *w > simulator.MaxLoadShiftWindowH {
+				log.Printf("config:update: load_shift_window_h must be 0–%d, got %d", simulator.MaxLoadShiftWindowH, *w)
+			} else {
+				h.engine.SetLoadShiftWindow(*w)
+			}
+		}
+		emitted := make([]model.SensorType, len(p.EmittedSensorTypes))
+		for i, t := range p.EmittedSensorTypes {
+			emitted[i] = model.SensorType(t)
+		}
+		h.engine.SetEmittedSensorTypes(emitted)
 		if p.FixedTariffPLN > 0 {
 			h.engine.SetFixedTariff(p.FixedTariffPLN)
 		}
@@ -173,9 +295,33 @@ func (h *Handler) handleMessage(msg []byte) {
 		if p.NetMeteringRatio > 0 {
 			h.engine.SetNetMeteringRatio(p.NetMeteringRatio)
 		}
+		if p.TanPhiLimit > 0 {
+			h.engine.SetTanPhiLimit(p.TanPhiLimit)
+		}
+		if p.ReactivePricePLN > 0 {
+			h.engine.SetReactivePrice(p.ReactivePricePLN)
+		}
 		if p.InsulationLevel != "" {
 			h.engine.SetInsulationLevel(simulator.InsulationLevel(p.InsulationLevel))
 		}
+		if minC, maxC, ok := simulator.ComfortBand(p.ComfortMinC, p.ComfortMaxC); ok {
+			h.engine.SetComfortBand(minC, maxC)
+		} else {
+			log.Printf("config:update: comfort band min %g °C is above max %g °C", minC, maxC)
+		}
+		h.engine.SetApplianceShift(model.SensorType(p.ShiftAppliance), p.ShiftWindowStartH, p.ShiftWindowEndH)
+		if p.HPMinOnMinutes != nil || p.HPMinOffMinutes != nil {
+			minOn, minOff := h.engine.HeatPumpMinRunTimes()
+			if p.HPMinOnMinutes != nil {
+				minOn = time.Duration(*p.HPMinOnMinutes * float64(time.Minute))
+			}
+			if p.HPMinOffMinutes != nil {
+				minOff = time.Duration(*p.HPMinOffMinutes * float64(time.Minute))
+			}
+			h.engine.SetHeatPumpMinRunTimes(minOn, minOff)
+		}
+
+		h.setCOPCurve(p)
 
 	case TypePVConfig:
 		var p PVConfigPayload
@@ -194,14 +340,205 @@ func (h *Handler) handleMessage(msg []byte) {
 			}
 		}
 		h.engine.SetPVConfig(p.Enabled, arrays)
+		h.engine.SetPVDegradation(p.DegradationPctPerYear)
 		// Reset simulation to apply PV config from the start
 		h.engine.Seek(h.engine.TimeRange().Start)
 
+	case TypePVOptimize:
+		var p PVOptimizePayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			log.Printf("Invalid pv:optimize payload: %v", err)
+			return
+		}
+		objective := solar.OrientationObjective(p.Objective)
+		if objective != solar.ObjectiveSelfConsumption {
+			objective = solar.ObjectiveTotalEnergy
+		}
+		result, ok := h.engine.OptimizePVOrientation(objective, p.PeakWp)
+		if !ok {
+			log.Printf("pv:optimize: no PV data available")
+			return
+		}
+		msg, err := NewEnvelope(TypePVOptimization, PVOptimizationFromResult(objective, result))
+		if err != nil {
+			log.Printf("Error creating pv:optimization message: %v", err)
+			return
+		}
+		h.hub.Broadcast(msg)
+
+	case TypeRangeSave:
+		var p RangeSavePayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			log.Printf("Invalid range:save payload: %v", err)
+			return
+		}
+		h.handleRangeSave(p)
+
+	case TypeRangeList:
+		h.broadcastRangeList()
+
+	case TypeDataOverview:
+		var p DataOverviewPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			log.Printf("Invalid data:overview payload: %v", err)
+			return
+		}
+		h.handleDataOverview(p)
+
+	case TypeSummaryRange:
+		var p SummaryRangePayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			log.Printf("Invalid summary:range payload: %v", err)
+			return
+		}
+		// Replaying a long range takes a while; don't block this client's reader.
+		go h.handleSummaryRange(p)
+
 	default:
 		log.Printf("Unknown message type: %s", env.Type)
 	}
 }
 
+func (h *Handler) handleRangeSave(p RangeSavePayload) {
+	if p.Name == "" {
+		log.Printf("range:save: empty name")
+		return
+	}
+	h.mu.RLock()
+	_, builtin := h.sourceRanges[p.Name]
+	h.mu.RUnlock()
+	if builtin {
+		log.Printf("range:save: %q is a built-in source", p.Name)
+		return
+	}
+	start, err := time.Parse(time.RFC3339, p.Start)
+	if err != nil {
+		log.Printf("Invalid range:save start: %v", err)
+		return
+	}
+	end, err := time.Parse(time.RFC3339, p.End)
+	if err != nil {
+		log.Printf("Invalid range:save end: %v", err)
+		return
+	}
+	if !end.After(start) {
+		log.Printf("range:save: end %s is not after start %s", p.End, p.Start)
+		return
+	}
+	if err := h.namedRanges.Set(p.Name, model.TimeRange{Start: start, End: end}); err != nil {
+		log.Printf("range:save: %v", err)
+	}
+	h.broadcastRangeList()
+}
+
+func (h *Handler) broadcastRangeList() {
+	msg, err := NewEnvelope(TypeRangeListResult, RangeListResultPayload{Ranges: h.namedRanges.List()})
+	if err != nil {
+		log.Printf("Error creating range:list_result message: %v", err)
+		return
+	}
+	h.hub.Broadcast(msg)
+}
+
+const (
+	defaultOverviewBuckets = 500
+	maxOverviewBuckets     = 5000
+)
+
+func (h *Handler) handleDataOverview(p DataOverviewPayload) {
+	tr := h.engine.TimeRange()
+	if p.Start != "" {
+		t, err := time.Parse(time.RFC3339, p.Start)
+		if err != nil {
+			log.Printf("Invalid data:overview start: %v", err)
+			return
+		}
+		tr.Start = t
+	}
+	if p.End != "" {
+		t, err := time.Parse(time.RFC3339, p.End)
+		if err != nil {
+			log.Printf("Invalid data:overview end: %v", err)
+			return
+		}
+		tr.End = t
+	}
+	buckets := p.Buckets
+	if buckets <= 0 {
+		buckets = defaultOverviewBuckets
+	}
+	if buckets > maxOverviewBuckets {
+		buckets = maxOverviewBuckets
+	}
+
+	readings := h.engine.Overview(p.SensorID, tr, buckets)
+	points := make([]OverviewPoint, len(readings))
+	for i, r := range readings {
+		points[i] = OverviewPoint{
+			Timestamp: r.Timestamp.Format(time.RFC3339),
+			Value:     r.Value,
+			Min:       r.Min,
+			Max:       r.Max,
+		}
+	}
+
+	msg, err := NewEnvelope(TypeDataOverviewResult, DataOverviewResultPayload{SensorID: p.SensorID, Points: points})
+	if err != nil {
+		log.Printf("Error creating data:overview_result message: %v", err)
+		return
+	}
+	h.hub.Broadcast(msg)
+}
+
+// handleSummaryRange replays [start, end] on a private engine and broadcasts
+// the resulting summary; the live simulation is left untouched. It runs on
+// its own goroutine.
+func (h *Handler) handleSummaryRange(p SummaryRangePayload) {
+	start, err := time.Parse(time.RFC3339, p.Start)
+	if err != nil {
+		log.Printf("Invalid summary:range start: %v", err)
+		return
+	}
+	end, err := time.Parse(time.RFC3339, p.End)
+	if err != nil {
+		log.Printf("Invalid summary:range end: %v", err)
+		return
+	}
+	if !end.After(start) {
+		log.Printf("summary:range: end %s is not after start %s", p.End, p.Start)
+		return
+	}
+
+	summary := h.engine.SummaryForRange(model.TimeRange{Start: start, End: end})
+	msg, err := NewEnvelope(TypeSummaryRangeResult, SummaryRangeResultPayload{
+		Start:   p.Start,
+		End:     p.End,
+		Summary: SummaryFromEngine(summary),
+	})
+	if err != nil {
+		log.Printf("Error creating summary:range_result message: %v", err)
+		return
+	}
+	h.hub.Broadcast(msg)
+}
+
+// ExtendData is called after new readings were appended to the store.
+// It extends the named source ranges and the engine's range to end, then
+// tells clients about the new range.
+func (h *Handler) ExtendData(end time.Time, sources ...string) {
+	h.mu.Lock()
+	for _, name := range sources {
+		if tr, ok := h.sourceRanges[name]; ok && end.After(tr.End) {
+			tr.End = end
+			h.sourceRanges[name] = tr
+		}
+	}
+	h.mu.Unlock()
+
+	h.engine.ExtendTimeRange(end)
+	h.broadcastDataLoaded()
+}
+
 func (h *Handler) broadcastDataLoaded() {
 	msg, err := h.dataLoadedMessage()
 	if err != nil {
@@ -216,20 +553,25 @@ func (h *Handler) dataLoadedMessage() ([]byte, error) {
 	modelSensors := h.engine.Sensors()
 	sensors := make([]SensorInfo, 0, len(modelSensors))
 	for _, s := range modelSensors {
-		sensors = append(sensors, SensorInfo{
+		info := SensorInfo{
 			ID:   s.ID,
 			Name: s.Name,
 			Type: string(s.Type),
 			Unit: s.Unit,
-		})
+		}
+		if c, ok := h.engine.SensorCoverage(s.ID); ok {
+			info.FirstReading = c.First.Format(time.RFC3339)
+			info.LastReading = c.Last.Format(time.RFC3339)
+			info.ReadingCount = c.Count
+			info.MedianIntervalS = c.MedianInterval.Seconds()
+		}
+		sensors = append(sensors, info)
 	}
 
 	payload := DataLoadedPayload{
-		Sensors: sensors,
-		TimeRange: TimeRangeInfo{
-			Start: tr.Start.Format(time.RFC3339),
-			End:   tr.End.Format(time.RFC3339),
-		},
+		Sensors:      sensors,
+		TimeRange:    timeRangeInfo(tr),
+		Capabilities: CapabilitiesFromEngine(h.engine.Capabilities()),
 	}
 
 	return NewEnvelope(TypeDataLoaded, payload)
@@ -259,3 +601,82 @@ func (h *Handler) sendSimState(c *Client) {
 	default:
 	}
 }
+
+// setAwayMode applies the prediction's away-mode overlay from a config
+// update; missing or invalid dates switch it off.
+func (h *Handler) setAwayMode(p ConfigUpdatePayload) {
+	var start, end time.Time
+	if p.AwayStart != "" && p.AwayEnd != "" {
+		var err1, err2 error
+		start, err1 = time.Parse(time.RFC3339, p.AwayStart)
+		end, err2 = time.Parse(time.RFC3339, p.AwayEnd)
+		if err1 != nil || err2 != nil {
+			log.Printf("config:update: invalid away_start/away_end %q–%q", p.AwayStart, p.AwayEnd)
+			start, end = time.Time{}, time.Time{}
+		}
+	}
+	h.engine.SetAwayMode(start, end, p.AwayFactor)
+}
+
+// setTOUTariff applies the time-of-use import tariff from a config update.
+func (h *Handler) setTOUTariff(p ConfigUpdatePayload) {
+	if p.TOUPeakPLN <= 0 || p.TOUOffPeakPLN <= 0 {
+		h.engine.SetTOUTariff(nil)
+		return
+	}
+	cal, err := simulator.NewHolidayCalendar(p.TOUPolishHolidays, p.TOUHolidays)
+	if err != nil {
+		log.Printf("config:update: invalid tou_holidays: %v", err)
+		cal, _ = simulator.NewHolidayCalendar(p.TOUPolishHolidays, nil)
+	}
+	h.engine.SetTOUTariff(&simulator.TOUTariff{PeakPLN: p.TOUPeakPLN, OffPeakPLN: p.TOUOffPeakPLN, Holidays: cal})
+}
+
+// setCOPCurve applies the config's COP curve. An absent curve keeps the
+// current one and an empty one restores a flat COP of 1; a curve with a
+// non-positive COP is logged and ignored.
+func (h *Handler) setCOPCurve(p ConfigUpdatePayload) {
+	if p.COPCurve == nil {
+		return
+	}
+	curve := make([]simulator.COPPoint, len(p.COPCurve))
+	for i, pt := range p.COPCurve {
+		if pt.COP <= 0 {
+			log.Printf("config:update: cop_curve needs positive COPs, got %g at %g °C", pt.COP, pt.TempC)
+			return
+		}
+		curve[i] = simulator.COPPoint(pt)
+	}
+	h.engine.SetCOPCurve(curve)
+}
+
+// batteryConfigFromPayload converts a battery config message to the engine's
+// BatteryConfig, rejecting an unknown charge priority.
+func batteryConfigFromPayload(p BatteryConfigPayload) (*simulator.BatteryConfig, error) {
+	priority, err := simulator.ParseChargePriority(p.ChargePriority)
+	if err != nil {
+		return nil, err
+	}
+	return &simulator.BatteryConfig{
+		CapacityKWh:            p.CapacityKWh,
+		MaxPowerW:              p.MaxPowerW,
+		MaxChargeW:             p.MaxChargeW,
+		MaxDischargeW:          p.MaxDischargeW,
+		DischargeToPercent:     p.DischargeToPercent,
+		ChargeToPercent:        p.ChargeToPercent,
+		DegradationCycles:      p.DegradationCycles,
+		MinDwellMinutes:        p.MinDwellMinutes,
+		InitialSoCPercent:      p.InitialSoCPercent,
+		CalendarFadePctPerYear: p.CalendarFadePctPerYear,
+		RoundTripEfficiencyPct: p.RoundTripEfficiencyPct,
+		CycleCostPLN:           p.CycleCostPLN,
+		SelfDischargePctPerDay: p.SelfDischargePctPerDay,
+		CurtailmentVoltageV:    p.CurtailmentVoltageV,
+		ExportLimitW:           p.ExportLimitW,
+		ChargePriority:         priority,
+		MaxDailyCycles:         p.MaxDailyCycles,
+		InverterStandbyW:       p.InverterStandbyW,
+		ChargeTaperStartPct:    p.ChargeTaperStartPct,
+		GridImportLimitW:       p.GridImportLimitW,
+	}, nil
+}
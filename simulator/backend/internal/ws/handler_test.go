@@ -154,6 +154,24 @@ func TestHandler_SetSpeed(t *testing.T) {
 	assert.Equal(t, 7200.0, engine.State().Speed)
 }
 
+func TestHandler_FinishIn(t *testing.T) {
+	engine, _ := testEngine()
+	hub := NewHub()
+	handler := NewHandler(hub, engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	// 4h of data in 60s → 240x
+	sendJSON(t, conn, TypeSimFinishIn, FinishInPayload{Seconds: 60})
+	time.Sleep(50 * time.Millisecond)
+
+	assert.InDelta(t, 240.0, engine.State().Speed, 1e-9)
+}
+
 func TestHandler_Seek(t *testing.T) {
 	engine, _ := testEngine()
 	hub := NewHub()
@@ -253,6 +271,33 @@ func TestHandler_BatteryDisable(t *testing.T) {
 	assert.Equal(t, engine.TimeRange().Start, engine.State().Time)
 }
 
+func TestHandler_ConfigUpdatePartialMinRunTimes(t *testing.T) {
+	engine, _ := testEngine()
+	engine.SetHeatPumpMinRunTimes(5*time.Minute, 20*time.Minute)
+	hub := NewHub()
+	handler := NewHandler(hub, engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	// Only the on time is sent; the off time is kept.
+	sendJSON(t, conn, TypeConfigUpdate, map[string]any{"hp_min_on_minutes": 10})
+	time.Sleep(50 * time.Millisecond)
+	minOn, minOff := engine.HeatPumpMinRunTimes()
+	assert.Equal(t, 10*time.Minute, minOn)
+	assert.Equal(t, 20*time.Minute, minOff)
+
+	// An explicit 0 disables a limit.
+	sendJSON(t, conn, TypeConfigUpdate, map[string]any{"hp_min_off_minutes": 0})
+	time.Sleep(50 * time.Millisecond)
+	minOn, minOff = engine.HeatPumpMinRunTimes()
+	assert.Equal(t, 10*time.Minute, minOn)
+	assert.Zero(t, minOff)
+}
+
 func TestHandler_InvalidMessage(t *testing.T) {
 	engine, _ := testEngine()
 	hub := NewHub()
@@ -342,8 +387,338 @@ func TestHandler_DataLoadedPayloadContent(t *testing.T) {
 			assert.Equal(t, "Grid Power", s.Name)
 			assert.Equal(t, "grid_power", s.Type)
 			assert.Equal(t, "W", s.Unit)
+			assert.Equal(t, 5, s.ReadingCount)
+			assert.Equal(t, 3600.0, s.MedianIntervalS)
+			assert.Equal(t, "2024-11-21T12:00:00Z", s.FirstReading)
+			assert.Equal(t, "2024-11-21T16:00:00Z", s.LastReading)
 			found = true
 		}
 	}
 	assert.True(t, found, "grid sensor should be in data:loaded payload")
 }
+
+func TestHandler_PVOptimize(t *testing.T) {
+	engine, s := testEngine()
+	s.AddSensor(model.Sensor{ID: "sensor.pv", Name: "PV Power", Type: model.SensorPVPower, Unit: "W"})
+	base := time.Date(2024, 11, 21, 0, 0, 0, 0, time.UTC)
+	var pv []model.Reading
+	for i, v := range []float64{1000, 2000, 3000, 4000, 5000, 4000, 3000, 2000, 1000} {
+		pv = append(pv, model.Reading{
+			Timestamp: base.Add(time.Duration(6+i) * time.Hour),
+			SensorID:  "sensor.pv",
+			Type:      model.SensorPVPower,
+			Value:     v,
+			Unit:      "W",
+		})
+	}
+	s.AddReadings(pv)
+
+	hub := NewHub()
+	handler := NewHandler(hub, engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	sendJSON(t, conn, TypePVOptimize, PVOptimizePayload{Objective: "total_energy", PeakWp: 5000})
+
+	env := readJSON(t, conn)
+	require.Equal(t, TypePVOptimization, env.Type)
+
+	var p PVOptimizationPayload
+	require.NoError(t, json.Unmarshal(env.Payload, &p))
+	assert.Equal(t, "total_energy", p.Objective)
+	assert.NotEmpty(t, p.Surface)
+	assert.Greater(t, p.Best.EnergyKWh, 0.0)
+}
+
+func TestHandler_DataLoadedCapabilities(t *testing.T) {
+	engine, _ := testEngine() // grid sensor only, no price sensor configured
+	hub := NewHub()
+	handler := NewHandler(hub, engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+
+	env := readJSON(t, conn)
+	require.Equal(t, TypeDataLoaded, env.Type)
+
+	var dl DataLoadedPayload
+	require.NoError(t, json.Unmarshal(env.Payload, &dl))
+
+	caps := make(map[string]CapabilityInfo)
+	for _, c := range dl.Capabilities {
+		caps[c.Name] = c
+	}
+	require.Contains(t, caps, "cost_tracking")
+	assert.False(t, caps["cost_tracking"].Enabled)
+	assert.Equal(t, "no energy_price sensor", caps["cost_tracking"].Reason)
+	assert.False(t, caps["arbitrage"].Enabled)
+	assert.False(t, caps["prediction_mode"].Enabled)
+}
+
+func TestHandler_DataLoadedCapabilitiesWithPriceSensor(t *testing.T) {
+	engine, s := testEngine()
+	s.AddSensor(model.Sensor{ID: "sensor.price", Name: "Price", Type: model.SensorEnergyPrice, Unit: "PLN/kWh"})
+	engine.SetPriceSensor("sensor.price")
+	hub := NewHub()
+	handler := NewHandler(hub, engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+
+	env := readJSON(t, conn)
+	var dl DataLoadedPayload
+	require.NoError(t, json.Unmarshal(env.Payload, &dl))
+
+	for _, c := range dl.Capabilities {
+		if c.Name == "cost_tracking" {
+			assert.True(t, c.Enabled)
+			assert.Empty(t, c.Reason)
+		}
+	}
+}
+
+// dialWithHeader dials the handler with the given request headers, returning the HTTP response.
+func dialWithHeader(t *testing.T, handler *Handler, path string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + path
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func TestHandler_OriginCheck(t *testing.T) {
+	engine, _ := testEngine()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+	handler.SetAccess(AccessConfig{AllowedOrigins: []string{"https://energy.example.com"}})
+
+	t.Run("disallowed origin rejected", func(t *testing.T) {
+		_, resp, err := dialWithHeader(t, handler, "/ws", http.Header{"Origin": {"https://evil.example.com"}})
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("allowed origin upgrades", func(t *testing.T) {
+		conn, _, err := dialWithHeader(t, handler, "/ws", http.Header{"Origin": {"https://energy.example.com"}})
+		require.NoError(t, err)
+		assert.Equal(t, TypeDataLoaded, readJSON(t, conn).Type)
+	})
+}
+
+func TestHandler_SameOriginByDefault(t *testing.T) {
+	engine, _ := testEngine()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {server.URL}})
+	require.NoError(t, err)
+	conn.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"http://other.example.com"}})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestHandler_BearerToken(t *testing.T) {
+	engine, _ := testEngine()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+	handler.SetAccess(AccessConfig{Token: "secret"})
+
+	t.Run("missing token", func(t *testing.T) {
+		_, resp, err := dialWithHeader(t, handler, "/ws", nil)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		_, resp, err := dialWithHeader(t, handler, "/ws", http.Header{"Authorization": {"Bearer nope"}})
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("header token", func(t *testing.T) {
+		_, _, err := dialWithHeader(t, handler, "/ws", http.Header{"Authorization": {"Bearer secret"}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("query token", func(t *testing.T) {
+		_, _, err := dialWithHeader(t, handler, "/ws?token=secret", nil)
+		assert.NoError(t, err)
+	})
+}
+
+func TestHandler_ExtendData(t *testing.T) {
+	engine, s := testEngine()
+	tr := engine.TimeRange()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": tr, "current": tr})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	newEnd := tr.End.Add(2 * time.Hour)
+	s.AppendReadings([]model.Reading{
+		{Timestamp: newEnd, SensorID: "sensor.grid", Type: model.SensorGridPower, Value: 600, Unit: "W"},
+	})
+	handler.ExtendData(newEnd, "all")
+
+	assert.Equal(t, newEnd, engine.TimeRange().End)
+
+	env := readJSON(t, conn)
+	require.Equal(t, TypeDataLoaded, env.Type)
+	var dl DataLoadedPayload
+	require.NoError(t, json.Unmarshal(env.Payload, &dl))
+	assert.Equal(t, newEnd.Format(time.RFC3339), dl.TimeRange.End)
+
+	// The extended source keeps its new end when selected again
+	sendJSON(t, conn, TypeSimSetSource, SetSourcePayload{Source: "all"})
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, newEnd, engine.TimeRange().End)
+}
+
+func TestHandler_DataOverview(t *testing.T) {
+	engine, _ := testEngine()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": engine.TimeRange()})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	// 5 hourly readings (100..500) over a 4h range → 2 buckets of 2h
+	sendJSON(t, conn, TypeDataOverview, DataOverviewPayload{SensorID: "sensor.grid", Buckets: 2})
+
+	env := readJSON(t, conn)
+	require.Equal(t, TypeDataOverviewResult, env.Type)
+	var p DataOverviewResultPayload
+	require.NoError(t, json.Unmarshal(env.Payload, &p))
+	assert.Equal(t, "sensor.grid", p.SensorID)
+	require.Len(t, p.Points, 2)
+	assert.InDelta(t, 150, p.Points[0].Value, 1e-9)
+	assert.Equal(t, 100.0, p.Points[0].Min)
+	assert.Equal(t, 200.0, p.Points[0].Max)
+	// Range end is exclusive, so the 500 W reading at the end is not included
+	assert.InDelta(t, 350, p.Points[1].Value, 1e-9)
+}
+
+func TestHandler_NamedRangeSaveAndSelect(t *testing.T) {
+	engine, _ := testEngine()
+	tr := engine.TimeRange()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": tr})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	coldSnap := model.TimeRange{Start: tr.Start.Add(time.Hour), End: tr.Start.Add(3 * time.Hour)}
+	sendJSON(t, conn, TypeRangeSave, RangeSavePayload{
+		Name:  "cold snap",
+		Start: coldSnap.Start.Format(time.RFC3339),
+		End:   coldSnap.End.Format(time.RFC3339),
+	})
+
+	env := readJSON(t, conn)
+	require.Equal(t, TypeRangeListResult, env.Type)
+	var list RangeListResultPayload
+	require.NoError(t, json.Unmarshal(env.Payload, &list))
+	require.Len(t, list.Ranges, 1)
+	assert.Equal(t, "cold snap", list.Ranges[0].Name)
+	assert.Equal(t, coldSnap.Start.Format(time.RFC3339), list.Ranges[0].TimeRange.Start)
+
+	sendJSON(t, conn, TypeSimSetSource, SetSourcePayload{Source: "cold snap"})
+	env = readJSON(t, conn)
+	require.Equal(t, TypeDataLoaded, env.Type)
+	assert.Equal(t, coldSnap, engine.TimeRange())
+
+	// Listing returns the same registry
+	sendJSON(t, conn, TypeRangeList, nil)
+	env = readJSON(t, conn)
+	require.Equal(t, TypeRangeListResult, env.Type)
+}
+
+func TestHandler_NamedRangeRejectsBuiltinAndInverted(t *testing.T) {
+	engine, _ := testEngine()
+	tr := engine.TimeRange()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": tr})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	sendJSON(t, conn, TypeRangeSave, RangeSavePayload{
+		Name: "all", Start: tr.Start.Format(time.RFC3339), End: tr.End.Format(time.RFC3339),
+	})
+	sendJSON(t, conn, TypeRangeSave, RangeSavePayload{
+		Name: "backwards", Start: tr.End.Format(time.RFC3339), End: tr.Start.Format(time.RFC3339),
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Empty(t, handler.namedRanges.List())
+}
+
+func TestHandler_SummaryRange(t *testing.T) {
+	engine, _ := testEngine()
+	tr := engine.TimeRange()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": tr})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	// Sub-range 13:00–15:00 covers readings 200, 300, 400 W.
+	start := tr.Start.Add(time.Hour)
+	end := tr.Start.Add(3 * time.Hour)
+	sendJSON(t, conn, TypeSummaryRange, SummaryRangePayload{
+		Start: start.Format(time.RFC3339),
+		End:   end.Format(time.RFC3339),
+	})
+
+	env := readJSON(t, conn)
+	require.Equal(t, TypeSummaryRangeResult, env.Type)
+	var p SummaryRangeResultPayload
+	require.NoError(t, json.Unmarshal(env.Payload, &p))
+	assert.Equal(t, start.Format(time.RFC3339), p.Start)
+
+	// Trapezoid: (200+300)/2 + (300+400)/2 = 600 Wh
+	assert.InDelta(t, 0.6, p.Summary.GridImportKWh, 1e-9)
+	assert.InDelta(t, 0.6, p.Summary.TodayKWh, 1e-9)
+	assert.Zero(t, p.Summary.GridExportKWh)
+
+	// Live simulation is untouched.
+	assert.Equal(t, tr.Start, engine.State().Time)
+	assert.Zero(t, engine.CurrentSummary().GridImportKWh)
+}
+
+func TestHandler_SummaryRangeRejectsInverted(t *testing.T) {
+	engine, _ := testEngine()
+	tr := engine.TimeRange()
+	handler := NewHandler(NewHub(), engine, map[string]model.TimeRange{"all": tr})
+
+	conn, cleanup := dialHandler(t, handler)
+	defer cleanup()
+	readJSON(t, conn)
+	readJSON(t, conn)
+
+	sendJSON(t, conn, TypeSummaryRange, SummaryRangePayload{
+		Start: tr.End.Format(time.RFC3339),
+		End:   tr.Start.Format(time.RFC3339),
+	})
+
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err := conn.ReadMessage()
+	assert.Error(t, err)
+}
@@ -1,31 +1,76 @@
 package ws
 
 import (
+	"bytes"
 	"log"
 	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
+// DefaultSendQueue is the per-client send queue length, in messages.
+const DefaultSendQueue = 256
+
 // Client represents a connected WebSocket client.
 type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
 	send chan []byte
+
+	mu      sync.Mutex
+	held    []heldMessage // waiting for room in send, oldest first
+	dropped int           // sensor readings skipped while behind
+}
+
+// heldMessage is a message waiting for room in a client's send queue.
+type heldMessage struct {
+	msgType string
+	msg     []byte
+}
+
+// appendTypes are message types that each carry new entries (a finished
+// day, new events) rather than replacing the previous message, so every one
+// must reach the client. Other types are state snapshots; only the newest
+// one of those matters.
+var appendTypes = map[string]bool{
+	TypeDailySummary:    true,
+	TypeMonthlySummary:  true,
+	TypeEventLog:        true,
+	TypeArbitrageDayLog: true,
 }
 
 // Hub manages WebSocket clients and broadcasts messages.
 type Hub struct {
-	mu      sync.RWMutex
-	clients map[*Client]bool
+	mu        sync.RWMutex
+	clients   map[*Client]bool
+	queueSize int
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients: make(map[*Client]bool),
+		clients:   make(map[*Client]bool),
+		queueSize: DefaultSendQueue,
 	}
 }
 
+// SetSendQueue sets the send queue length of clients connecting afterwards;
+// n <= 0 restores DefaultSendQueue.
+func (h *Hub) SetSendQueue(n int) {
+	if n <= 0 {
+		n = DefaultSendQueue
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.queueSize = n
+}
+
+// newClient creates an unregistered client for conn.
+func (h *Hub) newClient(conn *websocket.Conn) *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return &Client{hub: h, conn: conn, send: make(chan []byte, h.queueSize)}
+}
+
 func (h *Hub) Register(c *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -41,18 +86,95 @@ func (h *Hub) Unregister(c *Client) {
 	}
 }
 
-// Broadcast sends a message to all connected clients.
+// Broadcast sends a message to all connected clients without blocking, so a
+// slow client cannot stall the engine; see Client.enqueue.
 func (h *Hub) Broadcast(msg []byte) {
+	msgType := envelopeType(msg)
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	for c := range h.clients {
+		c.enqueue(msgType, msg)
+	}
+}
+
+// envelopeType returns the type of an envelope built by NewEnvelope, which
+// always marshals the type first, or "" for anything else.
+func envelopeType(msg []byte) string {
+	rest, ok := bytes.CutPrefix(msg, []byte(`{"type":"`))
+	if !ok {
+		return ""
+	}
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return ""
+	}
+	return string(rest[:end])
+}
+
+// enqueue queues msg for the client without blocking. Once the send queue is
+// three quarters full the client is behind, and sensor readings are dropped:
+// the next reading supersedes them anyway. Other messages use the remaining
+// room; when the queue is full they are held, in order, and writePump sends
+// them as soon as slots free. Held state snapshots are coalesced to the
+// newest per type, so the client still ends on the latest summary and state;
+// appendTypes messages are all kept. Must be called with the hub's mu held.
+func (c *Client) enqueue(msgType string, msg []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if msgType == TypeSensorReading && len(c.send) >= cap(c.send)*3/4 {
+		c.dropped++
+		return
+	}
+	// Behind held messages, queueing directly could overtake an older
+	// message of the same type.
+	if len(c.held) == 0 {
 		select {
 		case c.send <- msg:
+			return
 		default:
-			// Client buffer full, skip
-			log.Printf("client buffer full, dropping message")
 		}
 	}
+	if !appendTypes[msgType] {
+		for i, h := range c.held {
+			if h.msgType == msgType {
+				c.held = append(c.held[:i], c.held[i+1:]...)
+				break
+			}
+		}
+	}
+	c.held = append(c.held, heldMessage{msgType: msgType, msg: msg})
+}
+
+// flushHeld moves held messages into the send queue while it has room.
+func (c *Client) flushHeld() {
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	if !c.hub.clients[c] {
+		return // send is closed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.held) > 0 {
+		select {
+		case c.send <- c.held[0].msg:
+			c.held[0] = heldMessage{}
+			c.held = c.held[1:]
+		default:
+			return
+		}
+	}
+	c.held = nil
+}
+
+// CloseAll disconnects every client. Used on server shutdown, since
+// http.Server.Shutdown does not close hijacked WebSocket connections.
+func (h *Hub) CloseAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		delete(h.clients, c)
+		close(c.send)
+	}
 }
 
 // ClientCount returns the number of connected clients.
@@ -63,10 +185,18 @@ func (h *Hub) ClientCount() int {
 }
 
 func (c *Client) writePump() {
-	defer c.conn.Close()
+	defer func() {
+		c.conn.Close()
+		c.mu.Lock()
+		if c.dropped > 0 {
+			log.Printf("WebSocket client was behind, dropped %d sensor readings", c.dropped)
+		}
+		c.mu.Unlock()
+	}()
 	for msg := range c.send {
 		if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
 			return
 		}
+		c.flushHeld()
 	}
 }
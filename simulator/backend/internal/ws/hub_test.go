@@ -2,10 +2,16 @@ package ws
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/store"
 )
 
 func TestNewEnvelope(t *testing.T) {
@@ -76,6 +82,165 @@ func TestHub_Broadcast(t *testing.T) {
 	assert.Equal(t, msg, <-c2.send)
 }
 
+func TestHub_CloseAll(t *testing.T) {
+	hub := NewHub()
+
+	c := &Client{hub: hub, send: make(chan []byte, 16)}
+	hub.Register(c)
+
+	hub.CloseAll()
+	assert.Equal(t, 0, hub.ClientCount())
+	_, open := <-c.send
+	assert.False(t, open, "send channel should be closed")
+
+	// A later Unregister from the read pump must not double-close
+	assert.NotPanics(t, func() { hub.Unregister(c) })
+}
+
+func TestEnvelopeType(t *testing.T) {
+	msg, err := NewEnvelope(TypeSensorReading, SensorReadingPayload{SensorID: "sensor.grid"})
+	require.NoError(t, err)
+	assert.Equal(t, TypeSensorReading, envelopeType(msg))
+	assert.Equal(t, "", envelopeType([]byte(`{"payload":{}}`)))
+	assert.Equal(t, "", envelopeType([]byte(`{"type":"unterminated`)))
+}
+
+// drain reads everything queued for c the way writePump does, moving held
+// messages into the queue after each one.
+func drain(c *Client) []Envelope {
+	var envs []Envelope
+	for {
+		select {
+		case msg := <-c.send:
+			var env Envelope
+			if json.Unmarshal(msg, &env) == nil {
+				envs = append(envs, env)
+			}
+			c.flushHeld()
+		default:
+			return envs
+		}
+	}
+}
+
+func TestHub_BroadcastSlowClient(t *testing.T) {
+	hub := NewHub()
+	hub.SetSendQueue(8)
+	c := hub.newClient(nil)
+	hub.Register(c)
+
+	reading, _ := NewEnvelope(TypeSensorReading, SensorReadingPayload{SensorID: "sensor.grid"})
+	for i := 0; i < 20; i++ {
+		hub.Broadcast(reading)
+	}
+	// Readings stop at three quarters, leaving room for other messages.
+	assert.Equal(t, 6, len(c.send))
+	for i := 0; i < 5; i++ {
+		state, _ := NewEnvelope(TypeSimState, SimStatePayload{Speed: float64(i)})
+		hub.Broadcast(state)
+	}
+
+	envs := drain(c)
+	require.NotEmpty(t, envs)
+	last := envs[len(envs)-1]
+	assert.Equal(t, TypeSimState, last.Type)
+	var p SimStatePayload
+	require.NoError(t, json.Unmarshal(last.Payload, &p))
+	assert.Equal(t, 4.0, p.Speed, "the newest state is delivered")
+	assert.Equal(t, 14, c.dropped)
+}
+
+func TestHub_HeldMessagesKeepOrder(t *testing.T) {
+	hub := NewHub()
+	hub.SetSendQueue(2)
+	c := hub.newClient(nil)
+	hub.Register(c)
+
+	state := func(speed float64) []byte {
+		msg, _ := NewEnvelope(TypeSimState, SimStatePayload{Speed: speed})
+		return msg
+	}
+	day := func(period string) []byte {
+		msg, _ := NewEnvelope(TypeDailySummary, PeriodSummaryPayload{Start: period})
+		return msg
+	}
+	hub.Broadcast(state(0))
+	hub.Broadcast(state(1)) // queue full from here on
+	hub.Broadcast(day("2024-11-21"))
+	hub.Broadcast(state(2))
+	hub.Broadcast(day("2024-11-22"))
+	hub.Broadcast(state(3))
+
+	var got []string
+	for _, env := range drain(c) {
+		switch env.Type {
+		case TypeSimState:
+			var p SimStatePayload
+			require.NoError(t, json.Unmarshal(env.Payload, &p))
+			got = append(got, fmt.Sprintf("state %g", p.Speed))
+		case TypeDailySummary:
+			var p PeriodSummaryPayload
+			require.NoError(t, json.Unmarshal(env.Payload, &p))
+			got = append(got, "day "+p.Start)
+		}
+	}
+	// Every day is delivered in order; held states coalesce to the newest.
+	assert.Equal(t, []string{"state 0", "state 1", "day 2024-11-21", "day 2024-11-22", "state 3"}, got)
+}
+
+func TestHub_SlowClientDoesNotStallEngine(t *testing.T) {
+	s := store.New()
+	s.AddSensor(model.Sensor{ID: "sensor.grid", Type: model.SensorGridPower, Unit: "W"})
+	base := time.Date(2024, 11, 21, 0, 0, 0, 0, time.UTC)
+	readings := make([]model.Reading, 24*60)
+	for i := range readings {
+		readings[i] = model.Reading{
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+			SensorID:  "sensor.grid",
+			Type:      model.SensorGridPower,
+			Value:     1000,
+			Unit:      "W",
+		}
+	}
+	s.AddReadings(readings)
+
+	hub := NewHub()
+	hub.SetSendQueue(16)
+	c := hub.newClient(nil) // nobody reads until the replay is over
+	hub.Register(c)
+	engine := simulator.New(s, NewBridge(hub))
+	require.True(t, engine.Init())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for engine.State().Time.Before(engine.TimeRange().End) {
+			engine.Step(10 * time.Minute)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine blocked on a client that is not reading")
+	}
+
+	var summary *Envelope
+	sensorReadings := 0
+	for _, env := range drain(c) {
+		switch env.Type {
+		case TypeSummaryUpdate:
+			summary = &env
+		case TypeSensorReading:
+			sensorReadings++
+		}
+	}
+	assert.Less(t, sensorReadings, len(readings))
+	require.NotNil(t, summary, "the client still gets a summary")
+	want, err := json.Marshal(SummaryFromEngine(engine.CurrentSummary()))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(summary.Payload), "and it is the final one")
+}
+
 func TestMessageTypes(t *testing.T) {
 	assert.Equal(t, "sim:start", TypeSimStart)
 	assert.Equal(t, "sim:pause", TypeSimPause)
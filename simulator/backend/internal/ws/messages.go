@@ -2,8 +2,11 @@ package ws
 
 import (
 	"encoding/json"
+	"time"
 
+	"energy_simulator/internal/model"
 	"energy_simulator/internal/simulator"
+	"energy_simulator/internal/solar"
 )
 
 // Envelope wraps all WebSocket messages with a type discriminator.
@@ -18,6 +21,11 @@ type SetSpeedPayload struct {
 	Speed float64 `json:"speed"`
 }
 
+// FinishInPayload asks for a speed that replays the remaining range in Seconds.
+type FinishInPayload struct {
+	Seconds float64 `json:"seconds"`
+}
+
 type SeekPayload struct {
 	Timestamp string `json:"timestamp"`
 }
@@ -26,6 +34,14 @@ type SetSourcePayload struct {
 	Source string `json:"source"`
 }
 
+// RangeSavePayload stores a named replay window, selectable later with
+// sim:set_source. Start and End are RFC3339.
+type RangeSavePayload struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
 // Server -> Client messages
 
 type SimStatePayload struct {
@@ -42,6 +58,7 @@ type SensorReadingPayload struct {
 }
 
 type SummaryPayload struct {
+	Currency           string  `json:"currency"`
 	TodayKWh           float64 `json:"today_kwh"`
 	MonthKWh           float64 `json:"month_kwh"`
 	TotalKWh           float64 `json:"total_kwh"`
@@ -66,18 +83,41 @@ type SummaryPayload struct {
 	ArbNetCostPLN        float64 `json:"arb_net_cost_pln"`
 	ArbBatterySavingsPLN float64 `json:"arb_battery_savings_pln"`
 
-	CheapExportKWh    float64 `json:"cheap_export_kwh"`
-	CheapExportRevPLN float64 `json:"cheap_export_rev_pln"`
-	CurrentSpotPrice  float64 `json:"current_spot_price"`
+	ArbSpreadPLN          float64 `json:"arb_spread_pln"`
+	ArbBreakEvenSpreadPLN float64 `json:"arb_break_even_spread_pln"`
+	ArbSpreadProfitable   bool    `json:"arb_spread_profitable"`
+
+	HybridNetCostPLN        float64 `json:"hybrid_net_cost_pln"`
+	HybridBatterySavingsPLN float64 `json:"hybrid_battery_savings_pln"`
+
+	CheapExportKWh        float64 `json:"cheap_export_kwh"`
+	CheapExportRevPLN     float64 `json:"cheap_export_rev_pln"`
+	NegativeExportKWh     float64 `json:"negative_export_kwh"`
+	NegativeExportCostPLN float64 `json:"negative_export_cost_pln"`
+	CurrentSpotPrice      float64 `json:"current_spot_price"`
 
 	NMNetCostPLN    float64 `json:"nm_net_cost_pln"`
 	NMCreditBankKWh float64 `json:"nm_credit_bank_kwh"`
 	NBNetCostPLN    float64 `json:"nb_net_cost_pln"`
 	NBDepositPLN    float64 `json:"nb_deposit_pln"`
 
+	ReactivePenaltyPLN float64 `json:"reactive_penalty_pln"`
+
+	ApplianceShiftSavingsPLN   float64 `json:"appliance_shift_savings_pln"`
+	ApplianceShiftedNetCostPLN float64 `json:"appliance_shifted_net_cost_pln"`
+
 	PreHeatCostPLN    float64             `json:"pre_heat_cost_pln"`
 	PreHeatSavingsPLN float64             `json:"pre_heat_savings_pln"`
+	ThermalRMSEC      float64             `json:"thermal_rmse_c,omitempty"`
+	ThermalSamples    int                 `json:"thermal_samples,omitempty"`
 	PVArrayProduction []PVArrayProdPayload `json:"pv_array_production,omitempty"`
+	Counters          map[string]float64   `json:"counters,omitempty"`
+
+	Phases             []PhaseEnergyPayload `json:"phases,omitempty"`
+	PhaseImbalanceAvgW float64              `json:"phase_imbalance_avg_w,omitempty"`
+	PhaseImbalanceMaxW float64              `json:"phase_imbalance_max_w,omitempty"`
+
+	MustRunKWh float64 `json:"must_run_kwh,omitempty"`
 }
 
 type PVArrayProdPayload struct {
@@ -85,11 +125,22 @@ type PVArrayProdPayload struct {
 	KWh  float64 `json:"kwh"`
 }
 
+type PhaseEnergyPayload struct {
+	Phase     string  `json:"phase"`
+	ImportKWh float64 `json:"import_kwh"`
+	ExportKWh float64 `json:"export_kwh"`
+}
+
 type SensorInfo struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 	Type string `json:"type"`
 	Unit string `json:"unit"`
+	// Data coverage; empty for sensors without readings.
+	FirstReading    string  `json:"first_reading,omitempty"`
+	LastReading     string  `json:"last_reading,omitempty"`
+	ReadingCount    int     `json:"reading_count"`
+	MedianIntervalS float64 `json:"median_interval_s"`
 }
 
 type TimeRangeInfo struct {
@@ -97,23 +148,95 @@ type TimeRangeInfo struct {
 	End   string `json:"end"`
 }
 
-type DataLoadedPayload struct {
-	Sensors   []SensorInfo  `json:"sensors"`
+func timeRangeInfo(tr model.TimeRange) TimeRangeInfo {
+	return TimeRangeInfo{
+		Start: tr.Start.Format(time.RFC3339),
+		End:   tr.End.Format(time.RFC3339),
+	}
+}
+
+type NamedRangeInfo struct {
+	Name      string        `json:"name"`
 	TimeRange TimeRangeInfo `json:"time_range"`
 }
 
+type RangeListResultPayload struct {
+	Ranges []NamedRangeInfo `json:"ranges"`
+}
+
+// DataOverviewPayload requests a downsampled series. Empty Start/End
+// default to the engine's time range.
+type DataOverviewPayload struct {
+	SensorID string `json:"sensor_id"`
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	Buckets  int    `json:"buckets"`
+}
+
+type OverviewPoint struct {
+	Timestamp string  `json:"timestamp"`
+	Value     float64 `json:"value"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+}
+
+type DataOverviewResultPayload struct {
+	SensorID string          `json:"sensor_id"`
+	Points   []OverviewPoint `json:"points"`
+}
+
+// SummaryRangePayload requests a summary computed over [Start, End] without
+// affecting the live simulation.
+type SummaryRangePayload struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type SummaryRangeResultPayload struct {
+	Start   string         `json:"start"`
+	End     string         `json:"end"`
+	Summary SummaryPayload `json:"summary"`
+}
+
+type DataLoadedPayload struct {
+	Sensors      []SensorInfo     `json:"sensors"`
+	TimeRange    TimeRangeInfo    `json:"time_range"`
+	Capabilities []CapabilityInfo `json:"capabilities"`
+}
+
+type CapabilityInfo struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func CapabilitiesFromEngine(caps []simulator.Capability) []CapabilityInfo {
+	out := make([]CapabilityInfo, len(caps))
+	for i, c := range caps {
+		out[i] = CapabilityInfo{Name: c.Name, Enabled: c.Enabled, Reason: c.Reason}
+	}
+	return out
+}
+
 // Message type constants
 const (
 	// Client -> Server
 	TypeSimStart         = "sim:start"
 	TypeSimPause         = "sim:pause"
 	TypeSimSetSpeed      = "sim:set_speed"
+	TypeSimFinishIn      = "sim:finish_in"
 	TypeSimSeek          = "sim:seek"
 	TypeSimSetSource     = "sim:set_source"
 	TypeBatteryConfig    = "battery:config"
 	TypeSimSetPrediction = "sim:set_prediction"
 	TypeConfigUpdate     = "config:update"
 	TypePVConfig         = "pv:config"
+	TypePVOptimize       = "pv:optimize"
+	TypeDataOverview     = "data:overview"
+	TypeRangeSave        = "range:save"
+	TypeRangeList        = "range:list"
+	TypeSummaryRange     = "summary:range"
+	TypeCompareConfig    = "battery:compare_config"
 
 	// Server -> Client
 	TypeSimState              = "sim:state"
@@ -129,10 +252,25 @@ const (
 	TypeLoadShiftStats        = "load_shift:stats"
 	TypeHPDiagnostics         = "hp:diagnostics"
 	TypePowerQuality          = "power:quality"
+	TypePVOptimization        = "pv:optimization"
+	TypeDataOverviewResult    = "data:overview_result"
+	TypeRangeListResult       = "range:list_result"
+	TypeSummaryRangeResult    = "summary:range_result"
+	TypeApplianceCosts        = "appliance:costs"
+	TypeStrategyComparison    = "strategy:comparison"
+	TypeDailySummary          = "daily:summary"
+	TypeMonthlySummary        = "monthly:summary"
+	TypeEventLog              = "event:log"
+	TypeFlowSankey            = "flow:sankey"
+	TypeConfigComparison      = "config:comparison"
+	TypeCostMonthly           = "cost:monthly"
 )
 
 type SetPredictionPayload struct {
 	Enabled bool `json:"enabled"`
+	// CatchUp replays history from the current position up to the latest
+	// reading, then continues into prediction without resetting state.
+	CatchUp bool `json:"catch_up,omitempty"`
 }
 
 type ConfigUpdatePayload struct {
@@ -142,7 +280,62 @@ type ConfigUpdatePayload struct {
 	FixedTariffPLN     float64 `json:"fixed_tariff_pln"`
 	DistributionFeePLN float64 `json:"distribution_fee_pln"`
 	NetMeteringRatio   float64 `json:"net_metering_ratio"`
+	TanPhiLimit        float64 `json:"tan_phi_limit,omitempty"`
+	ReactivePricePLN   float64 `json:"reactive_price_pln,omitempty"`
 	InsulationLevel    string  `json:"insulation_level,omitempty"`
+	// ComfortMinC/ComfortMaxC bound the pre-heating indoor temperature; 0
+	// uses the default (19/24 °C).
+	ComfortMinC float64 `json:"comfort_min_c,omitempty"`
+	ComfortMaxC float64 `json:"comfort_max_c,omitempty"`
+	// HPMinOnMinutes/HPMinOffMinutes are the pre-heating heat pump's
+	// anti-cycling limits; absent keeps a limit, 0 disables it.
+	HPMinOnMinutes  *float64 `json:"hp_min_on_minutes,omitempty"`
+	HPMinOffMinutes *float64 `json:"hp_min_off_minutes,omitempty"`
+	// ShiftAppliance is an appliance sensor type whose energy in the daily
+	// window [ShiftWindowStartH, ShiftWindowEndH) is simulated as moved to
+	// the window's cheapest hour; an end at or before the start wraps past
+	// midnight (0, 0 is the whole day). Empty disables shifting.
+	ShiftAppliance    string `json:"shift_appliance,omitempty"`
+	ShiftWindowStartH int    `json:"shift_window_start_h,omitempty"`
+	ShiftWindowEndH   int    `json:"shift_window_end_h,omitempty"`
+	// ExportCoefficientMonthly holds 12 per-month coefficients (Jan..Dec)
+	// overriding ExportCoefficient; empty uses the scalar.
+	ExportCoefficientMonthly []float64 `json:"export_coefficient_monthly,omitempty"`
+	// CheapExportPercentile flags export below this percentile of the day's
+	// prices as cheap instead of PriceThresholdPLN; 0 keeps the threshold.
+	CheapExportPercentile int `json:"cheap_export_percentile,omitempty"`
+	// COPCurve is the pre-heating heat pump's outdoor temperature → COP
+	// curve, used when no production data gives a measured COP. Absent keeps
+	// the current curve, [] restores a flat COP of 1.
+	COPCurve []COPPointPayload `json:"cop_curve,omitempty"`
+	// MustRunW is a constant must-run load added to the measured demand;
+	// negative removes load, 0 disables.
+	MustRunW float64 `json:"must_run_w,omitempty"`
+	// LoadShiftWindowH is how far (hours, 0–12) the load shift stats may move
+	// heat pump consumption; absent keeps the current window.
+	LoadShiftWindowH *int `json:"load_shift_window_h,omitempty"`
+	// EmittedSensorTypes limits streamed sensor readings to these types
+	// (e.g. "grid_power", "pv_power"); empty streams all.
+	EmittedSensorTypes []string `json:"emitted_sensor_types,omitempty"`
+	// AwayStart/AwayEnd (RFC3339) bound a holiday in the prediction, during
+	// which the predicted base load is scaled by AwayFactor (0–1); empty
+	// disables it.
+	AwayStart  string  `json:"away_start,omitempty"`
+	AwayEnd    string  `json:"away_end,omitempty"`
+	AwayFactor float64 `json:"away_factor,omitempty"`
+	// TOUPeakPLN/TOUOffPeakPLN bill net metering/billing imports by a G12w
+	// style tariff instead of FixedTariffPLN; either at 0 disables it.
+	// Weekends, the Polish holidays (TOUPolishHolidays) and the TOUHolidays
+	// dates (YYYY-MM-DD) are off-peak all day.
+	TOUPeakPLN        float64  `json:"tou_peak_pln,omitempty"`
+	TOUOffPeakPLN     float64  `json:"tou_offpeak_pln,omitempty"`
+	TOUPolishHolidays bool     `json:"tou_polish_holidays,omitempty"`
+	TOUHolidays       []string `json:"tou_holidays,omitempty"`
+}
+
+type COPPointPayload struct {
+	TempC float64 `json:"temp_c"`
+	COP   float64 `json:"cop"`
 }
 
 // PV config payloads
@@ -150,6 +343,8 @@ type ConfigUpdatePayload struct {
 type PVConfigPayload struct {
 	Enabled bool                   `json:"enabled"`
 	Arrays  []PVArrayConfigPayload `json:"arrays"`
+	// Linear output loss per simulated year in percent; 0 = none
+	DegradationPctPerYear float64 `json:"degradation_pct_per_year,omitempty"`
 }
 
 type PVArrayConfigPayload struct {
@@ -160,6 +355,49 @@ type PVArrayConfigPayload struct {
 	Enabled bool    `json:"enabled"`
 }
 
+// PVOptimizePayload requests an azimuth/tilt search for an array of PeakWp.
+// Objective is "total_energy" (default) or "self_consumption".
+type PVOptimizePayload struct {
+	Objective string  `json:"objective"`
+	PeakWp    float64 `json:"peak_wp"`
+}
+
+type PVOrientationPayload struct {
+	Azimuth         float64 `json:"azimuth"`
+	Tilt            float64 `json:"tilt"`
+	EnergyKWh       float64 `json:"energy_kwh"`
+	SelfConsumedKWh float64 `json:"self_consumed_kwh"`
+	Score           float64 `json:"score"`
+}
+
+type PVOptimizationPayload struct {
+	Objective string                 `json:"objective"`
+	Best      PVOrientationPayload   `json:"best"`
+	Surface   []PVOrientationPayload `json:"surface"`
+}
+
+func PVOptimizationFromResult(objective solar.OrientationObjective, r solar.OrientationResult) PVOptimizationPayload {
+	surface := make([]PVOrientationPayload, len(r.Surface))
+	for i, c := range r.Surface {
+		surface[i] = pvOrientationFromCandidate(c)
+	}
+	return PVOptimizationPayload{
+		Objective: string(objective),
+		Best:      pvOrientationFromCandidate(r.Best),
+		Surface:   surface,
+	}
+}
+
+func pvOrientationFromCandidate(c solar.OrientationCandidate) PVOrientationPayload {
+	return PVOrientationPayload{
+		Azimuth:         c.Azimuth,
+		Tilt:            c.Tilt,
+		EnergyKWh:       c.EnergyKWh,
+		SelfConsumedKWh: c.SelfConsumedKWh,
+		Score:           c.Score,
+	}
+}
+
 type PredictionComparisonPayload struct {
 	ActualPowerW    float64 `json:"actual_power_w"`
 	PredictedPowerW float64 `json:"predicted_power_w"`
@@ -174,9 +412,40 @@ type BatteryConfigPayload struct {
 	Enabled            bool    `json:"enabled"`
 	CapacityKWh        float64 `json:"capacity_kwh"`
 	MaxPowerW          float64 `json:"max_power_w"`
+	MaxChargeW         float64 `json:"max_charge_w"`
+	MaxDischargeW      float64 `json:"max_discharge_w"`
 	DischargeToPercent float64 `json:"discharge_to_percent"`
 	ChargeToPercent    float64 `json:"charge_to_percent"`
 	DegradationCycles  float64 `json:"degradation_cycles"`
+	MinDwellMinutes    float64 `json:"min_dwell_minutes"`
+	InitialSoCPercent  float64 `json:"initial_soc_percent"`
+	// CalendarFadePctPerYear is time-based capacity fade; 0 = disabled.
+	CalendarFadePctPerYear float64 `json:"calendar_fade_pct_per_year"`
+	// RoundTripEfficiencyPct and CycleCostPLN set the arbitrage break-even
+	// spread; 0 = lossless / no wear cost.
+	RoundTripEfficiencyPct float64 `json:"round_trip_efficiency_pct"`
+	CycleCostPLN           float64 `json:"cycle_cost_pln"`
+	// SelfDischargePctPerDay drains the SoC and skips arbitrage charging the
+	// expected idle loss makes unprofitable; 0 = disabled.
+	SelfDischargePctPerDay float64 `json:"self_discharge_pct_per_day"`
+	// CurtailmentVoltageV forces max charging while exporting at or above
+	// this grid voltage; 0 = disabled.
+	CurtailmentVoltageV float64 `json:"curtailment_voltage_v"`
+	// ExportLimitW caps arbitrage discharge to grid; 0 = unlimited.
+	ExportLimitW float64 `json:"export_limit_w"`
+	// ChargePriority is "price-first" (default) or "pv-first".
+	ChargePriority string `json:"charge_priority"`
+	// MaxDailyCycles idles the battery for the rest of the day once reached;
+	// 0 = unlimited.
+	MaxDailyCycles float64 `json:"max_daily_cycles"`
+	// InverterStandbyW is a constant load while the battery is enabled.
+	InverterStandbyW float64 `json:"inverter_standby_w"`
+	// ChargeTaperStartPct derates charge power linearly above this SoC;
+	// 0 = disabled.
+	ChargeTaperStartPct float64 `json:"charge_taper_start_pct"`
+	// GridImportLimitW (main fuse) clamps battery charging from grid;
+	// 0 = unlimited.
+	GridImportLimitW float64 `json:"grid_import_limit_w"`
 }
 
 type BatteryUpdatePayload struct {
@@ -191,9 +460,15 @@ type BatterySummaryPayload struct {
 	Cycles               float64                    `json:"cycles"`
 	EffectiveCapacityKWh float64                    `json:"effective_capacity_kwh"`
 	DegradationPct       float64                    `json:"degradation_pct"`
+	ReclaimedKWh         float64                    `json:"reclaimed_kwh"`
 	TimeAtPowerSec       map[int]float64            `json:"time_at_power_sec"`
 	TimeAtSoCPctSec      map[int]float64            `json:"time_at_soc_pct_sec"`
 	MonthSoCSeconds      map[string]map[int]float64 `json:"month_soc_seconds"`
+	// Arbitrage battery kWh per 10 gr price band (key = band start in grosze)
+	ArbChargeKWhByPrice    map[int]float64 `json:"arb_charge_kwh_by_price,omitempty"`
+	ArbDischargeKWhByPrice map[int]float64 `json:"arb_discharge_kwh_by_price,omitempty"`
+	// Intervals whose charging was clamped by the grid import limit
+	ImportLimitedIntervals int `json:"import_limited_intervals,omitempty"`
 }
 
 func NewEnvelope(msgType string, payload any) ([]byte, error) {
@@ -227,6 +502,9 @@ type ArbitrageDayRecordPayload struct {
 	GapMinutes         int     `json:"gap_minutes"`
 	CyclesDelta        float64 `json:"cycles_delta"`
 	EarningsPLN        float64 `json:"earnings_pln"`
+	SpreadPLN          float64 `json:"spread_pln"`
+	BreakEvenSpreadPLN float64 `json:"break_even_spread_pln"`
+	Profitable         bool    `json:"profitable"`
 }
 
 type ArbitrageDayLogPayload struct {
@@ -247,6 +525,9 @@ func ArbitrageDayLogFromEngine(records []simulator.ArbitrageDayRecord) Arbitrage
 			GapMinutes:         r.GapMinutes,
 			CyclesDelta:        r.CyclesDelta,
 			EarningsPLN:        r.EarningsPLN,
+			SpreadPLN:          r.SpreadPLN,
+			BreakEvenSpreadPLN: r.BreakEvenSpreadPLN,
+			Profitable:         r.Profitable,
 		}
 	}
 	return ArbitrageDayLogPayload{Records: out}
@@ -278,6 +559,23 @@ func HeatingStatsFromEngine(stats []simulator.HeatingMonthStat) []HeatingMonthSt
 	return out
 }
 
+// Per-month cost payloads
+
+type MonthlyCostPayload struct {
+	Month            string  `json:"month"`
+	ImportCostPLN    float64 `json:"import_cost_pln"`
+	ExportRevenuePLN float64 `json:"export_revenue_pln"`
+	NetCostPLN       float64 `json:"net_cost_pln"`
+}
+
+func MonthlyCostsFromEngine(costs []simulator.MonthlyCost) []MonthlyCostPayload {
+	out := make([]MonthlyCostPayload, len(costs))
+	for i, c := range costs {
+		out[i] = MonthlyCostPayload(c)
+	}
+	return out
+}
+
 // Anomaly day payloads
 
 type AnomalyDayPayload struct {
@@ -304,6 +602,7 @@ func AnomalyDaysFromEngine(records []simulator.AnomalyDayRecord) []AnomalyDayPay
 
 func SummaryFromEngine(s simulator.Summary) SummaryPayload {
 	return SummaryPayload{
+		Currency:           s.Currency,
 		TodayKWh:           s.TodayKWh,
 		MonthKWh:           s.MonthKWh,
 		TotalKWh:           s.TotalKWh,
@@ -328,19 +627,53 @@ func SummaryFromEngine(s simulator.Summary) SummaryPayload {
 		ArbNetCostPLN:        s.ArbNetCostPLN,
 		ArbBatterySavingsPLN: s.ArbBatterySavingsPLN,
 
-		CheapExportKWh:    s.CheapExportKWh,
-		CheapExportRevPLN: s.CheapExportRevPLN,
-		CurrentSpotPrice:  s.CurrentSpotPrice,
+		ArbSpreadPLN:          s.ArbSpreadPLN,
+		ArbBreakEvenSpreadPLN: s.ArbBreakEvenSpreadPLN,
+		ArbSpreadProfitable:   s.ArbSpreadProfitable,
+
+		HybridNetCostPLN:        s.HybridNetCostPLN,
+		HybridBatterySavingsPLN: s.HybridBatterySavingsPLN,
+
+		CheapExportKWh:        s.CheapExportKWh,
+		CheapExportRevPLN:     s.CheapExportRevPLN,
+		NegativeExportKWh:     s.NegativeExportKWh,
+		NegativeExportCostPLN: s.NegativeExportCostPLN,
+		CurrentSpotPrice:      s.CurrentSpotPrice,
 
 		NMNetCostPLN:    s.NMNetCostPLN,
 		NMCreditBankKWh: s.NMCreditBankKWh,
 		NBNetCostPLN:    s.NBNetCostPLN,
 		NBDepositPLN:    s.NBDepositPLN,
 
+		ReactivePenaltyPLN: s.ReactivePenaltyPLN,
+
+		ApplianceShiftSavingsPLN:   s.ApplianceShiftSavingsPLN,
+		ApplianceShiftedNetCostPLN: s.ApplianceShiftedNetCostPLN,
+
 		PreHeatCostPLN:    s.PreHeatCostPLN,
 		PreHeatSavingsPLN: s.PreHeatSavingsPLN,
+		ThermalRMSEC:      s.ThermalRMSEC,
+		ThermalSamples:    s.ThermalSamples,
 		PVArrayProduction: pvArrayProdFromEngine(s.PVArrayProduction),
+		Counters:          countersFromEngine(s.Counters),
+
+		Phases:             phasesFromEngine(s.Phases),
+		PhaseImbalanceAvgW: s.PhaseImbalanceAvgW,
+		PhaseImbalanceMaxW: s.PhaseImbalanceMaxW,
+
+		MustRunKWh: s.MustRunKWh,
+	}
+}
+
+func countersFromEngine(counters map[model.SensorType]float64) map[string]float64 {
+	if len(counters) == 0 {
+		return nil
+	}
+	out := make(map[string]float64, len(counters))
+	for st, v := range counters {
+		out[string(st)] = v
 	}
+	return out
 }
 
 func pvArrayProdFromEngine(prods []simulator.PVArrayProd) []PVArrayProdPayload {
@@ -354,6 +687,17 @@ func pvArrayProdFromEngine(prods []simulator.PVArrayProd) []PVArrayProdPayload {
 	return out
 }
 
+func phasesFromEngine(phases []simulator.PhaseEnergy) []PhaseEnergyPayload {
+	if len(phases) == 0 {
+		return nil
+	}
+	out := make([]PhaseEnergyPayload, len(phases))
+	for i, p := range phases {
+		out[i] = PhaseEnergyPayload{Phase: p.Phase, ImportKWh: p.ImportKWh, ExportKWh: p.ExportKWh}
+	}
+	return out
+}
+
 // Load shift stats payloads
 
 type LoadShiftHeatmapCell struct {
@@ -407,6 +751,196 @@ func HPDiagnosticsFromEngine(d simulator.HPDiagnostics) HPDiagnosticsPayload {
 	}
 }
 
+// Appliance cost payload
+
+type ApplianceCostPayload struct {
+	Type         string  `json:"type"`
+	Name         string  `json:"name"`
+	KWh          float64 `json:"kwh"`
+	CostPLN      float64 `json:"cost_pln"`
+	MonthKWh     float64 `json:"month_kwh"`
+	MonthCostPLN float64 `json:"month_cost_pln"`
+}
+
+func ApplianceCostsFromEngine(costs []simulator.ApplianceCost) []ApplianceCostPayload {
+	out := make([]ApplianceCostPayload, len(costs))
+	for i, c := range costs {
+		out[i] = ApplianceCostPayload{
+			Type:         string(c.Type),
+			Name:         c.Name,
+			KWh:          c.KWh,
+			CostPLN:      c.CostPLN,
+			MonthKWh:     c.MonthKWh,
+			MonthCostPLN: c.MonthCostPLN,
+		}
+	}
+	return out
+}
+
+// Strategy comparison payload
+
+type StrategyResultPayload struct {
+	Name       string  `json:"name"`
+	NetCostPLN float64 `json:"net_cost_pln"`
+	SavingsPLN float64 `json:"savings_pln"`
+	Best       bool    `json:"best"`
+}
+
+type StrategyComparisonPayload struct {
+	Strategies []StrategyResultPayload `json:"strategies"`
+	Best       string                  `json:"best"`
+}
+
+func StrategyComparisonFromEngine(c simulator.StrategyComparison) StrategyComparisonPayload {
+	out := StrategyComparisonPayload{
+		Strategies: make([]StrategyResultPayload, len(c.Strategies)),
+		Best:       c.Best,
+	}
+	for i, r := range c.Strategies {
+		out.Strategies[i] = StrategyResultPayload{
+			Name:       r.Name,
+			NetCostPLN: r.NetCostPLN,
+			SavingsPLN: r.SavingsPLN,
+			Best:       r.Best,
+		}
+	}
+	return out
+}
+
+// Comparison battery payloads
+
+// CompareConfigPayload sets up (Enabled) or removes the comparison battery.
+type CompareConfigPayload struct {
+	Enabled  bool                 `json:"enabled"`
+	Strategy string               `json:"strategy"`
+	Config   BatteryConfigPayload `json:"config"`
+}
+
+type ConfigComparisonSidePayload struct {
+	Strategy    string  `json:"strategy"`
+	CapacityKWh float64 `json:"capacity_kwh"`
+	MaxPowerW   float64 `json:"max_power_w"`
+	NetCostPLN  float64 `json:"net_cost_pln"`
+	SavingsPLN  float64 `json:"savings_pln"`
+}
+
+type ConfigComparisonPayload struct {
+	A             ConfigComparisonSidePayload `json:"a"`
+	B             ConfigComparisonSidePayload `json:"b"`
+	DifferencePLN float64                     `json:"difference_pln"`
+	Better        string                      `json:"better"`
+}
+
+func ConfigComparisonFromEngine(c simulator.ConfigComparison) ConfigComparisonPayload {
+	return ConfigComparisonPayload{
+		A:             ConfigComparisonSidePayload(c.A),
+		B:             ConfigComparisonSidePayload(c.B),
+		DifferencePLN: c.DifferencePLN,
+		Better:        c.Better,
+	}
+}
+
+// Net metering vs net billing payload, served at GET /schemes
+
+type SchemeMonthPayload struct {
+	Month         string  `json:"month"`
+	NMNetCostPLN  float64 `json:"nm_net_cost_pln"`
+	NBNetCostPLN  float64 `json:"nb_net_cost_pln"`
+	DifferencePLN float64 `json:"difference_pln"`
+}
+
+type SchemeComparisonPayload struct {
+	Months        []SchemeMonthPayload `json:"months"`
+	NMNetCostPLN  float64              `json:"nm_net_cost_pln"`
+	NBNetCostPLN  float64              `json:"nb_net_cost_pln"`
+	DifferencePLN float64              `json:"difference_pln"`
+	Cheaper       string               `json:"cheaper"`
+	SavingsPLN    float64              `json:"savings_pln"`
+}
+
+func SchemeComparisonFromEngine(c simulator.SchemeComparison) SchemeComparisonPayload {
+	out := SchemeComparisonPayload{
+		Months:        make([]SchemeMonthPayload, len(c.Months)),
+		NMNetCostPLN:  c.NMNetCostPLN,
+		NBNetCostPLN:  c.NBNetCostPLN,
+		DifferencePLN: c.DifferencePLN,
+		Cheaper:       c.Cheaper,
+		SavingsPLN:    c.SavingsPLN,
+	}
+	for i, m := range c.Months {
+		out.Months[i] = SchemeMonthPayload(m)
+	}
+	return out
+}
+
+// Period summary payload
+
+type PeriodSummaryPayload struct {
+	Start            string  `json:"start"`
+	GridImportKWh    float64 `json:"grid_import_kwh"`
+	GridExportKWh    float64 `json:"grid_export_kwh"`
+	ImportCostPLN    float64 `json:"import_cost_pln"`
+	ExportRevenuePLN float64 `json:"export_revenue_pln"`
+	NetCostPLN       float64 `json:"net_cost_pln"`
+	PVKWh            float64 `json:"pv_kwh"`
+}
+
+func PeriodSummaryFromEngine(s simulator.PeriodSummary) PeriodSummaryPayload {
+	return PeriodSummaryPayload{
+		Start:            s.Start,
+		GridImportKWh:    s.GridImportKWh,
+		GridExportKWh:    s.GridExportKWh,
+		ImportCostPLN:    s.ImportCostPLN,
+		ExportRevenuePLN: s.ExportRevenuePLN,
+		NetCostPLN:       s.NetCostPLN,
+		PVKWh:            s.PVKWh,
+	}
+}
+
+// Replay event payload
+
+type EventPayload struct {
+	Kind      string  `json:"kind"`
+	Timestamp string  `json:"timestamp"`
+	Message   string  `json:"message"`
+	Value     float64 `json:"value"`
+}
+
+func EventFromEngine(ev simulator.Event) EventPayload {
+	return EventPayload{
+		Kind:      string(ev.Kind),
+		Timestamp: ev.Timestamp,
+		Message:   ev.Message,
+		Value:     ev.Value,
+	}
+}
+
+// Energy flow (sankey) payload
+
+type FlowEdgesPayload struct {
+	PVToHomeKWh      float64 `json:"pv_to_home_kwh"`
+	PVToBatteryKWh   float64 `json:"pv_to_battery_kwh"`
+	PVToGridKWh      float64 `json:"pv_to_grid_kwh"`
+	GridToHomeKWh    float64 `json:"grid_to_home_kwh"`
+	GridToBatteryKWh float64 `json:"grid_to_battery_kwh"`
+	BatteryToHomeKWh float64 `json:"battery_to_home_kwh"`
+	BatteryToGridKWh float64 `json:"battery_to_grid_kwh"`
+}
+
+type FlowSankeyPayload struct {
+	Start string           `json:"start"`
+	Hour  FlowEdgesPayload `json:"hour"`
+	Total FlowEdgesPayload `json:"total"`
+}
+
+func FlowSankeyFromEngine(f simulator.FlowSankey) FlowSankeyPayload {
+	return FlowSankeyPayload{
+		Start: f.Start,
+		Hour:  FlowEdgesPayload(f.Hour),
+		Total: FlowEdgesPayload(f.Total),
+	}
+}
+
 // Power quality payload
 
 type PowerQualityPayload struct {
@@ -1,11 +1,14 @@
 package ws
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"energy_simulator/internal/model"
 	"energy_simulator/internal/simulator"
 )
 
@@ -69,6 +72,21 @@ func TestSummaryFromEngine(t *testing.T) {
 	assert.InDelta(t, 25.0, p.BatterySavingsKWh, 0.001)
 }
 
+func TestSummaryFromEngine_Counters(t *testing.T) {
+	p := SummaryFromEngine(simulator.Summary{
+		Counters: map[model.SensorType]float64{model.SensorPumpHeaterRoom: 8},
+	})
+	assert.Equal(t, map[string]float64{"pump_heater_room_hours": 8}, p.Counters)
+	assert.Nil(t, SummaryFromEngine(simulator.Summary{}).Counters)
+}
+
+func TestSummaryFromEngine_Currency(t *testing.T) {
+	p := SummaryFromEngine(simulator.Summary{Currency: "EUR", NetCostPLN: 12.5})
+	data, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"currency":"EUR"`)
+}
+
 func TestSummaryFromEngine_Zeros(t *testing.T) {
 	p := SummaryFromEngine(simulator.Summary{})
 
@@ -0,0 +1,89 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"energy_simulator/internal/model"
+)
+
+// NamedRanges holds user-saved replay windows ("that cold snap"). When path
+// is set, every change is written to it as JSON so ranges survive restarts.
+type NamedRanges struct {
+	mu     sync.RWMutex
+	path   string
+	ranges map[string]model.TimeRange
+}
+
+// NewNamedRanges returns an empty in-memory registry.
+func NewNamedRanges() *NamedRanges {
+	return &NamedRanges{ranges: make(map[string]model.TimeRange)}
+}
+
+// LoadNamedRanges reads ranges from path. A missing file yields an empty
+// registry that will be created on the first save.
+func LoadNamedRanges(path string) (*NamedRanges, error) {
+	nr := NewNamedRanges()
+	nr.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nr, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading named ranges: %w", err)
+	}
+	if err := json.Unmarshal(data, &nr.ranges); err != nil {
+		return nil, fmt.Errorf("parsing named ranges %s: %w", path, err)
+	}
+	if nr.ranges == nil { // the file held "null"
+		nr.ranges = make(map[string]model.TimeRange)
+	}
+	return nr, nil
+}
+
+// Get returns the range saved under name.
+func (nr *NamedRanges) Get(name string) (model.TimeRange, bool) {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+	tr, ok := nr.ranges[name]
+	return tr, ok
+}
+
+// Set saves tr under name, replacing any previous range of that name.
+func (nr *NamedRanges) Set(name string, tr model.TimeRange) error {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+	nr.ranges[name] = tr
+	return nr.saveLocked()
+}
+
+// List returns all saved ranges sorted by name.
+func (nr *NamedRanges) List() []NamedRangeInfo {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+	out := make([]NamedRangeInfo, 0, len(nr.ranges))
+	for name, tr := range nr.ranges {
+		out = append(out, NamedRangeInfo{Name: name, TimeRange: timeRangeInfo(tr)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (nr *NamedRanges) saveLocked() error {
+	if nr.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(nr.ranges, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := nr.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing named ranges: %w", err)
+	}
+	return os.Rename(tmp, nr.path)
+}
@@ -0,0 +1,60 @@
+package ws
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"energy_simulator/internal/model"
+)
+
+func TestNamedRanges_PersistsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.json")
+
+	nr, err := LoadNamedRanges(path)
+	require.NoError(t, err)
+	assert.Empty(t, nr.List())
+
+	week := model.TimeRange{
+		Start: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 6, 17, 0, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, nr.Set("curtailment week", week))
+
+	reloaded, err := LoadNamedRanges(path)
+	require.NoError(t, err)
+	got, ok := reloaded.Get("curtailment week")
+	require.True(t, ok)
+	assert.True(t, week.Start.Equal(got.Start))
+	assert.True(t, week.End.Equal(got.End))
+}
+
+func TestNamedRanges_ListSortedByName(t *testing.T) {
+	nr := NewNamedRanges()
+	tr := model.TimeRange{Start: time.Unix(0, 0).UTC(), End: time.Unix(3600, 0).UTC()}
+	require.NoError(t, nr.Set("b", tr))
+	require.NoError(t, nr.Set("a", tr))
+
+	list := nr.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "a", list[0].Name)
+	assert.Equal(t, "b", list[1].Name)
+}
+
+func TestNamedRanges_NullFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.json")
+	require.NoError(t, os.WriteFile(path, []byte("null"), 0o644))
+
+	nr, err := LoadNamedRanges(path)
+	require.NoError(t, err)
+	assert.Empty(t, nr.List())
+
+	tr := model.TimeRange{Start: time.Unix(0, 0).UTC(), End: time.Unix(3600, 0).UTC()}
+	require.NoError(t, nr.Set("a", tr))
+	_, ok := nr.Get("a")
+	assert.True(t, ok)
+}
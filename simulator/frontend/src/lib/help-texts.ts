@@ -201,6 +201,20 @@ export const helpTexts: Record<string, HelpEntry> = {
 	},
 
 	// ── CostSummary: Cheap Export ──
+	reactivePenalty: {
+		title: 'Reactive Energy Penalty',
+		description:
+			'Commercial tariffs allow reactive energy up to tan φ × active energy imported (tan φ 0.4 by default). Reactive energy above that is charged per kvarh. Needs the reactive energy meter sensor.',
+		example: '3 kWh imported allows 1.2 kvarh; 3 kvarh measured leaves 1.8 kvarh × 0.65 PLN = 1.17 PLN.',
+		insight: 'A battery that cuts grid import also shrinks the reactive allowance, so the penalty can grow with self-consumption.'
+	},
+	applianceShift: {
+		title: 'Appliance Load Shift',
+		description:
+			"Net cost recomputed as if the selected appliance's energy within the daily window had run at that window's cheapest hour instead. Energy outside the window is not moved.",
+		example: 'A washer using 2 kWh at 1.00 PLN/kWh, shifted to a 0.20 PLN/kWh night hour, saves 1.60 PLN that day.',
+		insight: 'Unlike the load-shift potential estimate, this is per day and uses the actual prices of that day.'
+	},
 	cheapExportEnergy: {
 		title: 'Cheap Export Energy',
 		description:
@@ -271,6 +285,13 @@ export const helpTexts: Record<string, HelpEntry> = {
 			'Distribution of how long the battery spent at each power level. Negative values = charging, positive = discharging.',
 		insight: 'Ideally shows a balanced charge/discharge pattern. Heavy idle time means the battery is oversized.'
 	},
+	arbPriceBands: {
+		title: 'Arbitrage Energy by Price',
+		description:
+			'kWh the arbitrage battery charged (+) and discharged (−) in each 0.10 PLN/kWh spot price band.',
+		example: 'Charging concentrated at 0.2 PLN and discharging at 0.8 PLN means arbitrage is buying low and selling high.',
+		insight: 'Charging in mid-price bands points to thresholds that are too loose for the day\'s spread.'
+	},
 	timeAtSoC: {
 		title: 'Time at SoC',
 		description:
@@ -314,6 +335,55 @@ export const helpTexts: Record<string, HelpEntry> = {
 		example: 'A value of 6000 means after 6000 cycles the battery retains 80% capacity.',
 		insight: 'LFP batteries typically achieve 5000–8000 cycles. NMC batteries around 2000–4000.'
 	},
+	calendarFade: {
+		title: 'Calendar Fade',
+		description:
+			'Capacity lost per year regardless of use, added to cycle degradation. Based on simulated time elapsed.',
+		example: 'At 2%/yr a battery idle for 5 years retains 90% capacity.',
+		insight: 'Calendar aging dominates for lightly cycled home batteries; typical LFP values are 1–3%/yr.'
+	},
+	maxDailyCycles: {
+		title: 'Max Cycles per Day',
+		description:
+			'Caps battery throughput per calendar day, in equivalent full cycles. Once reached the battery idles until midnight. 0 = unlimited.',
+		example: 'At 1.5 on a 10 kWh battery, the battery stops after 30 kWh charged plus discharged in a day.',
+		insight: 'Limits wear on volatile-price days at the cost of skipping late arbitrage opportunities.'
+	},
+	inverterStandby: {
+		title: 'Inverter Standby Draw',
+		description:
+			'Constant power the inverter and BMS consume while the battery is installed, charged to grid import in every battery scenario. 0 = none.',
+		example: 'A 30 W idle draw adds about 22 kWh of import per month, roughly 260 kWh a year.',
+		insight: 'On small batteries with thin arbitrage spreads, standby losses can eat a noticeable share of the savings.'
+	},
+	chargeTaper: {
+		title: 'Charge Taper',
+		description:
+			'SoC above which the battery accepts less charge power, as in the constant-voltage phase of a real charge. Max charge power falls linearly to 10% at full. 0 = off.',
+		example: 'Tapering from 80%, a 5 kW battery at 90% SoC charges at 2.75 kW.',
+		insight: 'Makes high-SoC charging realistic: a nearly full battery absorbs a little less midday surplus, so slightly more is exported.'
+	},
+	chargePriority: {
+		title: 'Charge Priority',
+		description:
+			'Which source fills the arbitrage and hybrid batteries when PV surplus and a cheap grid price coincide. Cheap grid first charges at max power, topping up PV with grid energy; PV first charges only from the free surplus.',
+		example: 'With 2 kW surplus at a cheap hour and a 5 kW inverter: cheap grid first charges at 5 kW (3 kW imported), PV first at 2 kW.',
+		insight: 'PV first avoids paying for energy the sun would have supplied later; cheap grid first fills faster before a price peak.'
+	},
+	exportLimit: {
+		title: 'Export Limit',
+		description:
+			'Feed-in cap from your grid connection agreement. Arbitrage discharge that would push net export above it is skipped; discharge covering home load is never limited. 0 = unlimited.',
+		example: 'At 3 kW with 1 kW of load, arbitrage can discharge at most 4 kW.',
+		insight: 'A low cap makes arbitrage depend on your own evening load rather than selling to the grid.'
+	},
+	importLimit: {
+		title: 'Import Limit',
+		description:
+			'Main fuse rating as power. Battery charging that would push grid import above it is reduced, in every strategy; household load itself is never cut. Clamped intervals are counted as would-be fuse trips. 0 = unlimited.',
+		example: 'With an 11 kW limit and 4 kW of load, cheap-hour charging is held to 7 kW.',
+		insight: 'A large battery on a small connection cannot fill up in one cheap hour, which narrows the arbitrage it can capture.'
+	},
 
 	// ── SimConfig ──
 	exportCoefficient: {
@@ -330,6 +400,13 @@ export const helpTexts: Record<string, HelpEntry> = {
 		example: 'Set to 0.10 means any export at prices below 0.10 PLN/kWh is flagged.',
 		insight: 'Set this to your break-even price to identify when exporting costs you money.'
 	},
+	cheapExportPercentile: {
+		title: 'Cheap Export Percentile',
+		description:
+			'When above 0, export is flagged as cheap below this percentile of each day\'s spot prices instead of the fixed threshold, so the definition follows seasonal price levels.',
+		example: 'Set to 25 to flag export during the cheapest quarter of every day, whether prices are high in winter or low in summer.',
+		insight: 'Leave at 0 to use the fixed Cheap Export Threshold.'
+	},
 	tempOffset: {
 		title: 'Temperature Offset',
 		description:
@@ -424,6 +501,12 @@ export const helpTexts: Record<string, HelpEntry> = {
 	},
 
 	// ── AnomalyLog ──
+	eventLog: {
+		title: 'Replay Events',
+		description:
+			'Notable moments detected during the replay: battery reaching its ceiling or floor, charging from curtailed PV, anomalous consumption days and expired net-metering credits.',
+		insight: 'Frequent "battery full" events around midday suggest a larger battery would capture more PV.'
+	},
 	anomalyLog: {
 		title: 'Consumption Anomalies',
 		description:
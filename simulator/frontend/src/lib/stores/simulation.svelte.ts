@@ -9,16 +9,25 @@ import {
 	MSG_ARBITRAGE_DAY_LOG,
 	MSG_PREDICTION_COMPARISON,
 	MSG_HEATING_STATS,
+	MSG_COST_MONTHLY,
 	MSG_ANOMALY_DAYS,
 	MSG_LOAD_SHIFT_STATS,
 	MSG_HP_DIAGNOSTICS,
 	MSG_POWER_QUALITY,
+	MSG_APPLIANCE_COSTS,
+	MSG_STRATEGY_COMPARISON,
+	MSG_CONFIG_COMPARISON,
+	MSG_DAILY_SUMMARY,
+	MSG_MONTHLY_SUMMARY,
+	MSG_EVENT_LOG,
+	MSG_FLOW_SANKEY,
 	MSG_SIM_START,
 	MSG_SIM_PAUSE,
 	MSG_SIM_SET_SPEED,
 	MSG_SIM_SEEK,
 	MSG_SIM_SET_SOURCE,
 	MSG_BATTERY_CONFIG,
+	MSG_COMPARE_CONFIG,
 	MSG_SIM_SET_PREDICTION,
 	MSG_CONFIG_UPDATE,
 	MSG_PV_CONFIG,
@@ -32,11 +41,20 @@ import {
 	type ArbitrageDayRecord,
 	type PredictionComparisonPayload,
 	type HeatingMonthStatPayload,
+	type MonthlyCostPayload,
 	type AnomalyDayPayload,
 	type LoadShiftStatsPayload,
 	type HPDiagnosticsPayload,
 	type PowerQualityPayload,
+	type ApplianceCostPayload,
+	type StrategyComparisonPayload,
+	type CompareConfigPayload,
+	type ConfigComparisonPayload,
+	type PeriodSummaryPayload,
+	type EventPayload,
+	type FlowSankeyPayload,
 	type PVArrayProdPayload,
+	type PhaseEnergyPayload,
 	type SensorInfo,
 	type Envelope
 } from '$lib/ws/messages';
@@ -44,6 +62,9 @@ import {
 // Max data points to keep in the time series buffer
 const MAX_CHART_POINTS = 2500;
 
+// Max replay events to keep (oldest dropped first)
+const MAX_EVENTS = 200;
+
 export interface TimeSeriesPoint {
 	timestamp: Date;
 	gridPowerW: number;
@@ -79,6 +100,7 @@ class SimulationStore {
 	running = $state(false);
 	dataSource = $state('all');
 	predictionEnabled = $state(false);
+	predictionCatchUp = $state(false);
 
 	// Sensors
 	sensors = $state<SensorInfo[]>([]);
@@ -122,15 +144,23 @@ class SimulationStore {
 	batterySavingsPLN = $state(0);
 	arbNetCostPLN = $state(0);
 	arbBatterySavingsPLN = $state(0);
+	arbSpreadPLN = $state(0);
+	arbBreakEvenSpreadPLN = $state(0);
+	arbSpreadProfitable = $state(false);
+	hybridNetCostPLN = $state(0);
+	hybridBatterySavingsPLN = $state(0);
 
 	// Cheap export tracking
 	cheapExportKWh = $state(0);
 	cheapExportRevPLN = $state(0);
+	negativeExportKWh = $state(0);
+	negativeExportCostPLN = $state(0);
 	currentSpotPrice = $state(0);
 
 	// Config
 	exportCoefficient = $state(0.8);
 	priceThresholdPLN = $state(0.1);
+	cheapExportPercentile = $state(0); // 0 = fixed threshold
 	tempOffsetC = $state(0);
 	fixedTariffPLN = $state(0.65);
 	distributionFeePLN = $state(0.20);
@@ -143,6 +173,11 @@ class SimulationStore {
 	nbNetCostPLN = $state(0);
 	nbDepositPLN = $state(0);
 
+	// Reactive energy beyond the tan φ limit
+	reactivePenaltyPLN = $state(0);
+	applianceShiftSavingsPLN = $state(0);
+	applianceShiftedNetCostPLN = $state(0);
+
 	// Prediction comparison
 	predActualPowerW = $state(0);
 	predPredictedPowerW = $state(0);
@@ -168,11 +203,21 @@ class SimulationStore {
 	adjustedGridW = $state(0);
 	batteryCycles = $state(0);
 	batteryDegradationCycles = $state(4000);
+	batteryCalendarFadePctPerYear = $state(0);
+	batteryExportLimitKW = $state(0);
+	batteryImportLimitKW = $state(0);
+	batteryChargePriority = $state<'price-first' | 'pv-first'>('price-first');
+	batteryMaxDailyCycles = $state(0);
+	batteryInverterStandbyW = $state(0);
+	batteryChargeTaperStartPct = $state(0);
 	batteryEffectiveCapacityKWh = $state(0);
 	batteryDegradationPct = $state(0);
 	batteryTimeAtPowerSec = $state<Record<string, number>>({});
 	batteryTimeAtSoCPctSec = $state<Record<string, number>>({});
 	batteryMonthSoCSeconds = $state<Record<string, Record<string, number>>>({});
+	batteryArbChargeKWhByPrice = $state<Record<string, number>>({});
+	batteryArbDischargeKWhByPrice = $state<Record<string, number>>({});
+	batteryImportLimitedIntervals = $state(0);
 
 	// Arbitrage day log
 	arbitrageDayRecords = $state<ArbitrageDayRecord[]>([]);
@@ -180,12 +225,17 @@ class SimulationStore {
 	// Heating month stats
 	heatingMonthStats = $state<HeatingMonthStatPayload[]>([]);
 
+	// Grid costs per calendar month
+	monthlyCosts = $state<MonthlyCostPayload[]>([]);
+
 	// Anomaly day records
 	anomalyDayRecords = $state<AnomalyDayPayload[]>([]);
 
 	// Pre-heating
 	preHeatCostPLN = $state(0);
 	preHeatSavingsPLN = $state(0);
+	thermalRMSEC = $state(0);
+	thermalSamples = $state(0);
 
 	// Insulation config
 	insulationLevel = $state('good');
@@ -199,9 +249,34 @@ class SimulationStore {
 	// Power quality
 	powerQuality = $state<PowerQualityPayload | null>(null);
 
+	// Per-appliance spot-priced costs
+	applianceCosts = $state<ApplianceCostPayload[]>([]);
+
+	// Strategies ranked by net cost, sent with each summary
+	strategyComparison = $state<StrategyComparisonPayload | null>(null);
+
+	// Configured battery vs the comparison battery, sent with each summary
+	// while a comparison battery is set
+	configComparison = $state<ConfigComparisonPayload | null>(null);
+
+	// Finished per-day and per-month rollups
+	dailySummaries = $state<PeriodSummaryPayload[]>([]);
+	monthlySummaries = $state<PeriodSummaryPayload[]>([]);
+
+	// Replay events (battery full/empty, curtailment, anomalies, credit expiry)
+	replayEvents = $state<EventPayload[]>([]);
+
+	// Latest finished hour of energy flow, with the running total
+	flowSankey = $state<FlowSankeyPayload | null>(null);
+
 	// PV array production
 	pvArrayProduction = $state<PVArrayProdPayload[]>([]);
 
+	// Three-phase grid: per-phase energy and imbalance
+	phases = $state<PhaseEnergyPayload[]>([]);
+	phaseImbalanceAvgW = $state(0);
+	phaseImbalanceMaxW = $state(0);
+
 	// Custom PV config
 	pvCustomEnabled = $state(false);
 	pvArrays = $state([
@@ -209,6 +284,7 @@ class SimulationStore {
 		{ name: 'South', peak_wp: 0, azimuth: 180, tilt: 40, enabled: false },
 		{ name: 'West', peak_wp: 0, azimuth: 270, tilt: 40, enabled: false }
 	]);
+	pvDegradationPctPerYear = $state(0);
 
 	// Daily off-grid tracking
 	dailyRecords = $state<DailyRecord[]>([]);
@@ -270,7 +346,12 @@ class SimulationStore {
 		this.dailyRecords = [];
 		this.arbitrageDayRecords = [];
 		this.heatingMonthStats = [];
+		this.monthlyCosts = [];
 		this.anomalyDayRecords = [];
+		this.dailySummaries = [];
+		this.monthlySummaries = [];
+		this.replayEvents = [];
+		this.flowSankey = null;
 		this.currentDayKey = '';
 	}
 
@@ -281,7 +362,12 @@ class SimulationStore {
 		this.dailyRecords = [];
 		this.arbitrageDayRecords = [];
 		this.heatingMonthStats = [];
+		this.monthlyCosts = [];
 		this.anomalyDayRecords = [];
+		this.dailySummaries = [];
+		this.monthlySummaries = [];
+		this.replayEvents = [];
+		this.flowSankey = null;
 		this.currentDayKey = '';
 	}
 
@@ -298,23 +384,59 @@ class SimulationStore {
 			max_power_w: this.batteryMaxPowerKW * 1000,
 			discharge_to_percent: this.batteryDischargeToPercent,
 			charge_to_percent: this.batteryChargeToPercent,
-			degradation_cycles: this.batteryDegradationCycles
+			degradation_cycles: this.batteryDegradationCycles,
+			calendar_fade_pct_per_year: this.batteryCalendarFadePctPerYear,
+			export_limit_w: this.batteryExportLimitKW * 1000,
+			grid_import_limit_w: this.batteryImportLimitKW * 1000,
+			charge_priority: this.batteryChargePriority,
+			max_daily_cycles: this.batteryMaxDailyCycles,
+			inverter_standby_w: this.batteryInverterStandbyW,
+			charge_taper_start_pct: this.batteryChargeTaperStartPct
 		});
 		this.timeSeriesData = [];
 		this.dailyRecords = [];
 		this.arbitrageDayRecords = [];
 		this.heatingMonthStats = [];
+		this.monthlyCosts = [];
+		this.anomalyDayRecords = [];
+		this.dailySummaries = [];
+		this.monthlySummaries = [];
+		this.replayEvents = [];
+		this.flowSankey = null;
+		this.currentDayKey = '';
+	}
+
+	setCompareConfig(payload: CompareConfigPayload): void {
+		this.client?.send(MSG_COMPARE_CONFIG, payload);
+		this.configComparison = null;
+		this.timeSeriesData = [];
+		this.dailyRecords = [];
+		this.arbitrageDayRecords = [];
+		this.heatingMonthStats = [];
+		this.monthlyCosts = [];
 		this.anomalyDayRecords = [];
+		this.dailySummaries = [];
+		this.monthlySummaries = [];
+		this.replayEvents = [];
+		this.flowSankey = null;
 		this.currentDayKey = '';
 	}
 
 	setPredictionMode(): void {
-		this.client?.send(MSG_SIM_SET_PREDICTION, { enabled: this.predictionEnabled });
+		this.client?.send(MSG_SIM_SET_PREDICTION, {
+			enabled: this.predictionEnabled,
+			catch_up: this.predictionCatchUp
+		});
 		this.timeSeriesData = [];
 		this.dailyRecords = [];
 		this.arbitrageDayRecords = [];
 		this.heatingMonthStats = [];
+		this.monthlyCosts = [];
 		this.anomalyDayRecords = [];
+		this.dailySummaries = [];
+		this.monthlySummaries = [];
+		this.replayEvents = [];
+		this.flowSankey = null;
 		this.currentDayKey = '';
 		this.predHasData = false;
 		this.predPowerErrors = [];
@@ -325,6 +447,7 @@ class SimulationStore {
 		this.client?.send(MSG_CONFIG_UPDATE, {
 			export_coefficient: this.exportCoefficient,
 			price_threshold_pln: this.priceThresholdPLN,
+			cheap_export_percentile: this.cheapExportPercentile,
 			temp_offset_c: this.tempOffsetC,
 			fixed_tariff_pln: this.fixedTariffPLN,
 			distribution_fee_pln: this.distributionFeePLN,
@@ -336,7 +459,8 @@ class SimulationStore {
 	setPVConfig(): void {
 		this.client?.send(MSG_PV_CONFIG, {
 			enabled: this.pvCustomEnabled,
-			arrays: this.pvArrays
+			arrays: this.pvArrays,
+			degradation_pct_per_year: this.pvDegradationPctPerYear
 		});
 		this.timeSeriesData = [];
 		this.dailyRecords = [];
@@ -422,16 +546,31 @@ class SimulationStore {
 				this.batterySavingsPLN = p.battery_savings_pln;
 				this.arbNetCostPLN = p.arb_net_cost_pln;
 				this.arbBatterySavingsPLN = p.arb_battery_savings_pln;
+				this.arbSpreadPLN = p.arb_spread_pln;
+				this.arbBreakEvenSpreadPLN = p.arb_break_even_spread_pln;
+				this.arbSpreadProfitable = p.arb_spread_profitable;
+				this.hybridNetCostPLN = p.hybrid_net_cost_pln;
+				this.hybridBatterySavingsPLN = p.hybrid_battery_savings_pln;
 				this.cheapExportKWh = p.cheap_export_kwh;
 				this.cheapExportRevPLN = p.cheap_export_rev_pln;
+				this.negativeExportKWh = p.negative_export_kwh;
+				this.negativeExportCostPLN = p.negative_export_cost_pln;
 				this.currentSpotPrice = p.current_spot_price;
 				this.nmNetCostPLN = p.nm_net_cost_pln;
 				this.nmCreditBankKWh = p.nm_credit_bank_kwh;
 				this.nbNetCostPLN = p.nb_net_cost_pln;
 				this.nbDepositPLN = p.nb_deposit_pln;
+				this.reactivePenaltyPLN = p.reactive_penalty_pln;
+				this.applianceShiftSavingsPLN = p.appliance_shift_savings_pln;
+				this.applianceShiftedNetCostPLN = p.appliance_shifted_net_cost_pln;
 				this.preHeatCostPLN = p.pre_heat_cost_pln;
 				this.preHeatSavingsPLN = p.pre_heat_savings_pln;
+				this.thermalRMSEC = p.thermal_rmse_c ?? 0;
+				this.thermalSamples = p.thermal_samples ?? 0;
 				this.pvArrayProduction = p.pv_array_production ?? [];
+				this.phases = p.phases ?? [];
+				this.phaseImbalanceAvgW = p.phase_imbalance_avg_w ?? 0;
+				this.phaseImbalanceMaxW = p.phase_imbalance_max_w ?? 0;
 				this.trackDailyData(p);
 				break;
 			}
@@ -457,6 +596,9 @@ class SimulationStore {
 				this.batteryTimeAtPowerSec = p.time_at_power_sec;
 				this.batteryTimeAtSoCPctSec = p.time_at_soc_pct_sec;
 				this.batteryMonthSoCSeconds = p.month_soc_seconds ?? {};
+				this.batteryArbChargeKWhByPrice = p.arb_charge_kwh_by_price ?? {};
+				this.batteryArbDischargeKWhByPrice = p.arb_discharge_kwh_by_price ?? {};
+				this.batteryImportLimitedIntervals = p.import_limited_intervals ?? 0;
 				break;
 			}
 			case MSG_ARBITRAGE_DAY_LOG: {
@@ -483,6 +625,10 @@ class SimulationStore {
 				this.heatingMonthStats = envelope.payload as HeatingMonthStatPayload[];
 				break;
 			}
+			case MSG_COST_MONTHLY: {
+				this.monthlyCosts = envelope.payload as MonthlyCostPayload[];
+				break;
+			}
 			case MSG_ANOMALY_DAYS: {
 				this.anomalyDayRecords = envelope.payload as AnomalyDayPayload[];
 				break;
@@ -499,6 +645,34 @@ class SimulationStore {
 				this.powerQuality = envelope.payload as PowerQualityPayload;
 				break;
 			}
+			case MSG_APPLIANCE_COSTS: {
+				this.applianceCosts = envelope.payload as ApplianceCostPayload[];
+				break;
+			}
+			case MSG_STRATEGY_COMPARISON: {
+				this.strategyComparison = envelope.payload as StrategyComparisonPayload;
+				break;
+			}
+			case MSG_CONFIG_COMPARISON: {
+				this.configComparison = envelope.payload as ConfigComparisonPayload;
+				break;
+			}
+			case MSG_DAILY_SUMMARY: {
+				this.dailySummaries = [...this.dailySummaries, envelope.payload as PeriodSummaryPayload];
+				break;
+			}
+			case MSG_MONTHLY_SUMMARY: {
+				this.monthlySummaries = [...this.monthlySummaries, envelope.payload as PeriodSummaryPayload];
+				break;
+			}
+			case MSG_EVENT_LOG: {
+				this.replayEvents = [...this.replayEvents, envelope.payload as EventPayload].slice(-MAX_EVENTS);
+				break;
+			}
+			case MSG_FLOW_SANKEY: {
+				this.flowSankey = envelope.payload as FlowSankeyPayload;
+				break;
+			}
 			case MSG_DATA_LOADED: {
 				const p = envelope.payload as DataLoadedPayload;
 				this.sensors = p.sensors;
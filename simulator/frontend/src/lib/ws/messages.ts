@@ -9,12 +9,19 @@ export interface Envelope {
 export const MSG_SIM_START = 'sim:start';
 export const MSG_SIM_PAUSE = 'sim:pause';
 export const MSG_SIM_SET_SPEED = 'sim:set_speed';
+export const MSG_SIM_FINISH_IN = 'sim:finish_in';
 export const MSG_SIM_SEEK = 'sim:seek';
 export const MSG_SIM_SET_SOURCE = 'sim:set_source';
 export const MSG_BATTERY_CONFIG = 'battery:config';
 export const MSG_SIM_SET_PREDICTION = 'sim:set_prediction';
 export const MSG_CONFIG_UPDATE = 'config:update';
 export const MSG_PV_CONFIG = 'pv:config';
+export const MSG_PV_OPTIMIZE = 'pv:optimize';
+export const MSG_DATA_OVERVIEW = 'data:overview';
+export const MSG_RANGE_SAVE = 'range:save';
+export const MSG_RANGE_LIST = 'range:list';
+export const MSG_SUMMARY_RANGE = 'summary:range';
+export const MSG_COMPARE_CONFIG = 'battery:compare_config';
 
 // Server -> Client
 export const MSG_SIM_STATE = 'sim:state';
@@ -30,11 +37,27 @@ export const MSG_ANOMALY_DAYS = 'anomaly:days';
 export const MSG_LOAD_SHIFT_STATS = 'load_shift:stats';
 export const MSG_HP_DIAGNOSTICS = 'hp:diagnostics';
 export const MSG_POWER_QUALITY = 'power:quality';
+export const MSG_PV_OPTIMIZATION = 'pv:optimization';
+export const MSG_DATA_OVERVIEW_RESULT = 'data:overview_result';
+export const MSG_RANGE_LIST_RESULT = 'range:list_result';
+export const MSG_SUMMARY_RANGE_RESULT = 'summary:range_result';
+export const MSG_APPLIANCE_COSTS = 'appliance:costs';
+export const MSG_STRATEGY_COMPARISON = 'strategy:comparison';
+export const MSG_DAILY_SUMMARY = 'daily:summary';
+export const MSG_MONTHLY_SUMMARY = 'monthly:summary';
+export const MSG_EVENT_LOG = 'event:log';
+export const MSG_FLOW_SANKEY = 'flow:sankey';
+export const MSG_CONFIG_COMPARISON = 'config:comparison';
+export const MSG_COST_MONTHLY = 'cost:monthly';
 
 export interface SetSpeedPayload {
 	speed: number;
 }
 
+export interface FinishInPayload {
+	seconds: number;
+}
+
 export interface SeekPayload {
 	timestamp: string;
 }
@@ -43,6 +66,21 @@ export interface SetSourcePayload {
 	source: string;
 }
 
+export interface RangeSavePayload {
+	name: string;
+	start: string;
+	end: string;
+}
+
+export interface NamedRangeInfo {
+	name: string;
+	time_range: { start: string; end: string };
+}
+
+export interface RangeListResultPayload {
+	ranges: NamedRangeInfo[];
+}
+
 export interface SimStatePayload {
 	time: string;
 	speed: number;
@@ -57,6 +95,7 @@ export interface SensorReadingPayload {
 }
 
 export interface SummaryPayload {
+	currency: string;
 	today_kwh: number;
 	month_kwh: number;
 	total_kwh: number;
@@ -80,18 +119,37 @@ export interface SummaryPayload {
 
 	arb_net_cost_pln: number;
 	arb_battery_savings_pln: number;
+	arb_spread_pln: number;
+	arb_break_even_spread_pln: number;
+	arb_spread_profitable: boolean;
+
+	hybrid_net_cost_pln: number;
+	hybrid_battery_savings_pln: number;
 
 	cheap_export_kwh: number;
 	cheap_export_rev_pln: number;
+	negative_export_kwh: number;
+	negative_export_cost_pln: number;
 	current_spot_price: number;
 
 	nm_net_cost_pln: number;
 	nm_credit_bank_kwh: number;
 	nb_net_cost_pln: number;
 	nb_deposit_pln: number;
+
+	reactive_penalty_pln: number;
+	appliance_shift_savings_pln: number;
+	appliance_shifted_net_cost_pln: number;
 	pre_heat_cost_pln: number;
 	pre_heat_savings_pln: number;
+	thermal_rmse_c?: number;
+	thermal_samples?: number;
 	pv_array_production?: PVArrayProdPayload[];
+	counters?: Record<string, number>;
+	phases?: PhaseEnergyPayload[];
+	phase_imbalance_avg_w?: number;
+	phase_imbalance_max_w?: number;
+	must_run_kwh?: number;
 }
 
 export interface PVArrayProdPayload {
@@ -99,11 +157,21 @@ export interface PVArrayProdPayload {
 	kwh: number;
 }
 
+export interface PhaseEnergyPayload {
+	phase: string;
+	import_kwh: number;
+	export_kwh: number;
+}
+
 export interface SensorInfo {
 	id: string;
 	name: string;
 	type: string;
 	unit: string;
+	first_reading?: string;
+	last_reading?: string;
+	reading_count?: number;
+	median_interval_s?: number;
 }
 
 export interface TimeRangeInfo {
@@ -111,9 +179,46 @@ export interface TimeRangeInfo {
 	end: string;
 }
 
+export interface DataOverviewPayload {
+	sensor_id: string;
+	start?: string;
+	end?: string;
+	buckets: number;
+}
+
+export interface OverviewPoint {
+	timestamp: string;
+	value: number;
+	min: number;
+	max: number;
+}
+
+export interface DataOverviewResultPayload {
+	sensor_id: string;
+	points: OverviewPoint[];
+}
+
+export interface SummaryRangePayload {
+	start: string;
+	end: string;
+}
+
+export interface SummaryRangeResultPayload {
+	start: string;
+	end: string;
+	summary: SummaryPayload;
+}
+
 export interface DataLoadedPayload {
 	sensors: SensorInfo[];
 	time_range: TimeRangeInfo;
+	capabilities?: CapabilityInfo[];
+}
+
+export interface CapabilityInfo {
+	name: string;
+	enabled: boolean;
+	reason?: string;
 }
 
 // Battery
@@ -122,9 +227,24 @@ export interface BatteryConfigPayload {
 	enabled: boolean;
 	capacity_kwh: number;
 	max_power_w: number;
+	max_charge_w?: number;
+	max_discharge_w?: number;
 	discharge_to_percent: number;
 	charge_to_percent: number;
 	degradation_cycles: number;
+	min_dwell_minutes?: number;
+	initial_soc_percent?: number;
+	calendar_fade_pct_per_year?: number;
+	round_trip_efficiency_pct?: number;
+	cycle_cost_pln?: number;
+	self_discharge_pct_per_day?: number;
+	curtailment_voltage_v?: number;
+	export_limit_w?: number;
+	charge_priority?: 'price-first' | 'pv-first';
+	max_daily_cycles?: number;
+	inverter_standby_w?: number;
+	charge_taper_start_pct?: number;
+	grid_import_limit_w?: number;
 }
 
 export interface BatteryUpdatePayload {
@@ -139,9 +259,13 @@ export interface BatterySummaryPayload {
 	cycles: number;
 	effective_capacity_kwh: number;
 	degradation_pct: number;
+	reclaimed_kwh?: number;
 	time_at_power_sec: Record<string, number>;
 	time_at_soc_pct_sec: Record<string, number>;
 	month_soc_seconds: Record<string, Record<string, number>>;
+	arb_charge_kwh_by_price?: Record<string, number>;
+	arb_discharge_kwh_by_price?: Record<string, number>;
+	import_limited_intervals?: number;
 }
 
 export interface ArbitrageDayRecord {
@@ -155,6 +279,9 @@ export interface ArbitrageDayRecord {
 	gap_minutes: number;
 	cycles_delta: number;
 	earnings_pln: number;
+	spread_pln: number;
+	break_even_spread_pln: number;
+	profitable: boolean;
 }
 
 export interface ArbitrageDayLogPayload {
@@ -163,17 +290,43 @@ export interface ArbitrageDayLogPayload {
 
 export interface ConfigUpdatePayload {
 	export_coefficient: number;
+	export_coefficient_monthly?: number[];
 	price_threshold_pln: number;
+	cheap_export_percentile?: number;
 	temp_offset_c: number;
 	fixed_tariff_pln: number;
 	distribution_fee_pln: number;
 	net_metering_ratio: number;
 	insulation_level?: string;
+	comfort_min_c?: number;
+	comfort_max_c?: number;
+	hp_min_on_minutes?: number;
+	hp_min_off_minutes?: number;
+	shift_appliance?: string;
+	shift_window_start_h?: number;
+	shift_window_end_h?: number;
+	cop_curve?: COPPointPayload[];
+	must_run_w?: number;
+	load_shift_window_h?: number;
+	emitted_sensor_types?: string[];
+	away_start?: string;
+	away_end?: string;
+	away_factor?: number;
+	tou_peak_pln?: number;
+	tou_offpeak_pln?: number;
+	tou_polish_holidays?: boolean;
+	tou_holidays?: string[];
+}
+
+export interface COPPointPayload {
+	temp_c: number;
+	cop: number;
 }
 
 export interface PVConfigPayload {
 	enabled: boolean;
 	arrays: PVArrayConfigPayload[];
+	degradation_pct_per_year?: number;
 }
 
 export interface PVArrayConfigPayload {
@@ -184,6 +337,25 @@ export interface PVArrayConfigPayload {
 	enabled: boolean;
 }
 
+export interface PVOptimizePayload {
+	objective: 'total_energy' | 'self_consumption';
+	peak_wp: number;
+}
+
+export interface PVOrientationPayload {
+	azimuth: number;
+	tilt: number;
+	energy_kwh: number;
+	self_consumed_kwh: number;
+	score: number;
+}
+
+export interface PVOptimizationPayload {
+	objective: string;
+	best: PVOrientationPayload;
+	surface: PVOrientationPayload[];
+}
+
 export interface PredictionComparisonPayload {
 	actual_power_w: number;
 	predicted_power_w: number;
@@ -201,6 +373,14 @@ export interface HeatingMonthStatPayload {
 	avg_temp_c: number;
 }
 
+// Grid import cost and export revenue per calendar month (YYYY-MM)
+export interface MonthlyCostPayload {
+	month: string;
+	import_cost_pln: number;
+	export_revenue_pln: number;
+	net_cost_pln: number;
+}
+
 export interface AnomalyDayPayload {
 	date: string;
 	actual_kwh: number;
@@ -244,6 +424,100 @@ export interface HPDiagnosticsPayload {
 	z1_target_temp_c: number;
 }
 
+// Appliance costs
+
+export interface ApplianceCostPayload {
+	type: string;
+	name: string;
+	kwh: number;
+	cost_pln: number;
+	month_kwh: number;
+	month_cost_pln: number;
+}
+
+// Strategy comparison (cheapest first)
+
+export interface StrategyResultPayload {
+	name: 'no_battery' | 'self_consumption' | 'arbitrage' | 'hybrid' | 'net_metering' | 'net_billing';
+	net_cost_pln: number;
+	savings_pln: number;
+	best: boolean;
+}
+
+export interface StrategyComparisonPayload {
+	strategies: StrategyResultPayload[];
+	best: StrategyResultPayload['name'];
+}
+
+// Configured battery (a) vs the comparison battery (b)
+
+export interface CompareConfigPayload {
+	enabled: boolean;
+	strategy: 'self_consumption' | 'arbitrage' | 'hybrid';
+	config: BatteryConfigPayload;
+}
+
+export interface ConfigComparisonSidePayload {
+	strategy: 'no_battery' | 'self_consumption' | 'arbitrage' | 'hybrid';
+	capacity_kwh: number;
+	max_power_w: number;
+	net_cost_pln: number;
+	savings_pln: number;
+}
+
+export interface ConfigComparisonPayload {
+	a: ConfigComparisonSidePayload;
+	b: ConfigComparisonSidePayload;
+	difference_pln: number;
+	better: 'a' | 'b' | '';
+}
+
+// Per-day / per-month rollups
+
+export interface PeriodSummaryPayload {
+	start: string;
+	grid_import_kwh: number;
+	grid_export_kwh: number;
+	import_cost_pln: number;
+	export_revenue_pln: number;
+	net_cost_pln: number;
+	pv_kwh: number;
+}
+
+// Replay events
+
+export type ReplayEventKind =
+	| 'battery_full'
+	| 'battery_empty'
+	| 'curtailment'
+	| 'anomaly_day'
+	| 'nm_credit_expired';
+
+export interface EventPayload {
+	kind: ReplayEventKind;
+	timestamp: string;
+	message: string;
+	value: number;
+}
+
+// Energy flow (sankey), one message per finished hour
+
+export interface FlowEdgesPayload {
+	pv_to_home_kwh: number;
+	pv_to_battery_kwh: number;
+	pv_to_grid_kwh: number;
+	grid_to_home_kwh: number;
+	grid_to_battery_kwh: number;
+	battery_to_home_kwh: number;
+	battery_to_grid_kwh: number;
+}
+
+export interface FlowSankeyPayload {
+	start: string;
+	hour: FlowEdgesPayload;
+	total: FlowEdgesPayload;
+}
+
 // Power quality
 
 export interface PowerQualityPayload {
@@ -53,6 +53,7 @@ describe('Message payload types', () => {
 
 	it('SummaryPayload has correct shape', () => {
 		const payload: SummaryPayload = {
+			currency: 'PLN',
 			today_kwh: 12.3,
 			month_kwh: 345.6,
 			total_kwh: 1234.5,
@@ -73,13 +74,23 @@ describe('Message payload types', () => {
 			battery_savings_pln: 20.0,
 			arb_net_cost_pln: 65.0,
 			arb_battery_savings_pln: 35.0,
+			arb_spread_pln: 0.42,
+			arb_break_even_spread_pln: 0.18,
+			arb_spread_profitable: true,
+			hybrid_net_cost_pln: 60.0,
+			hybrid_battery_savings_pln: 40.0,
 			cheap_export_kwh: 5.0,
 			cheap_export_rev_pln: 0.25,
+			negative_export_kwh: 1.5,
+			negative_export_cost_pln: 0.12,
 			current_spot_price: 0.45,
 			nm_net_cost_pln: 55.0,
 			nm_credit_bank_kwh: 12.5,
 			nb_net_cost_pln: 60.0,
 			nb_deposit_pln: 8.3,
+			reactive_penalty_pln: 0,
+			appliance_shift_savings_pln: 0,
+			appliance_shifted_net_cost_pln: 0,
 			heat_pump_cost_pln: 130.0,
 			pre_heat_cost_pln: 110.0,
 			pre_heat_savings_pln: 20.0
@@ -100,7 +111,10 @@ describe('Message payload types', () => {
 					discharge_kwh: 7.2,
 					gap_minutes: 480,
 					cycles_delta: 0.85,
-					earnings_pln: 2.3
+					earnings_pln: 2.3,
+					spread_pln: 0.42,
+					break_even_spread_pln: 0.18,
+					profitable: true
 				}
 			]
 		};